@@ -0,0 +1,97 @@
+package metrics
+
+import "strings"
+
+// OverflowTagValue replaces every tag value of a series registered beyond the
+// limit set by StandardRegistry.SetSeriesLimit, so that all such series of a
+// name are aggregated into one.
+const OverflowTagValue = "__other__"
+
+// SeriesDroppedName is the name of the counter, tagged with name=<name>, that
+// StandardRegistry.SetSeriesLimit registers to count how often a series of
+// that name was redirected to its overflow series.
+const SeriesDroppedName = "metrics.series_dropped"
+
+// baseName returns a name in the form returned by TaggedName without its tags.
+func baseName(name string) string {
+	if i := strings.IndexByte(name, ';'); -1 != i {
+		return name[:i]
+	}
+	return name
+}
+
+// countSeries adds delta to the number of series registered under the base
+// name of name, if the registry limits them.  Overflow series don't count
+// against the limit.  It must be called with r.mutex held.
+func (r *StandardRegistry) countSeries(name string, delta int) {
+	if nil == r.series || isOverflow(name) {
+		return
+	}
+	base := baseName(name)
+	if n := r.series[base] + delta; n > 0 {
+		r.series[base] = n
+	} else {
+		delete(r.series, base)
+	}
+}
+
+// isOverflow reports whether a name in the form returned by TaggedName is
+// that of an overflow series.
+func isOverflow(name string) bool {
+	if !strings.Contains(name, "="+OverflowTagValue) {
+		return false
+	}
+	_, tags := SplitTaggedName(name)
+	for _, v := range tags {
+		if OverflowTagValue != v {
+			return false
+		}
+	}
+	return true
+}
+
+// recountSeries counts the series registered under each base name afresh, if
+// the registry limits them.  It must be called with r.mutex held.
+func (r *StandardRegistry) recountSeries() {
+	if 0 == r.seriesLimit {
+		r.series = nil
+		return
+	}
+	r.series = make(map[string]int)
+	for name := range r.metrics {
+		r.countSeries(name, 1)
+	}
+}
+
+// overflow returns the overflow series of a tagged name not yet registered,
+// and the tags it carries, if its base name already has as many series as
+// the limit allows.  It must be called with r.mutex held.
+func (r *StandardRegistry) overflow(name string) (string, map[string]string, bool) {
+	if 0 == r.seriesLimit || -1 == strings.IndexByte(name, ';') {
+		return "", nil, false
+	}
+	base, tags := SplitTaggedName(name)
+	if r.series[base] < r.seriesLimit || 0 == len(tags) {
+		return "", nil, false
+	}
+	for k := range tags {
+		tags[k] = OverflowTagValue
+	}
+	return r.key(base + tagSuffix(tags)), tags, true
+}
+
+// dropSeries counts a series of the given base name redirected to its
+// overflow series.  It must be called with r.mutex held.
+func (r *StandardRegistry) dropSeries(base string) {
+	name := r.key(TaggedName(SeriesDroppedName, map[string]string{"name": base}))
+	i, ok := r.metrics[name]
+	if !ok {
+		i = NewCounter()
+		touchMetric(i)
+		r.set(name, i)
+		r.countSeries(name, 1)
+	}
+	if c, ok := i.(Counter); ok {
+		c.Inc(1)
+	}
+}
@@ -0,0 +1,77 @@
+package metrics
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestRegistrySeriesLimit(t *testing.T) {
+	r := NewRegistry().(*StandardRegistry)
+	r.SetSeriesLimit(2)
+	for i := 0; i < 5; i++ {
+		GetOrRegisterCounterT("logins", map[string]string{"user": fmt.Sprint(i)}, r).Inc(1)
+	}
+	GetOrRegisterCounter("other", r).Inc(1)
+
+	for _, name := range []string{"logins;user=0", "logins;user=1", "other"} {
+		if c, ok := r.Get(name).(Counter); !ok || 1 != c.Count() {
+			t.Errorf("%s: %v\n", name, r.Get(name))
+		}
+	}
+	if nil != r.Get("logins;user=2") {
+		t.Error("logins;user=2 registered beyond the limit")
+	}
+	c, ok := r.Get("logins;user=" + OverflowTagValue).(Counter)
+	if !ok {
+		t.Fatal("no overflow series")
+	}
+	if 3 != c.Count() {
+		t.Errorf("overflow.Count(): 3 != %v\n", c.Count())
+	}
+	if tags := c.(Taggable).GetTags(); OverflowTagValue != tags["user"] {
+		t.Errorf("overflow tags: %v\n", tags)
+	}
+	dropped, ok := r.Get(SeriesDroppedName + ";name=logins").(Counter)
+	if !ok {
+		t.Fatal("no dropped series counter")
+	}
+	if 3 != dropped.Count() {
+		t.Errorf("dropped.Count(): 3 != %v\n", dropped.Count())
+	}
+
+	// Unregistering a series makes room for another.
+	r.Unregister("logins;user=0")
+	GetOrRegisterCounterT("logins", map[string]string{"user": "5"}, r)
+	if nil == r.Get("logins;user=5") {
+		t.Error("logins;user=5 not registered after making room")
+	}
+	if err := r.Register("logins;user=6", NewCounter()); nil != err {
+		t.Error(err)
+	}
+	if nil != r.Get("logins;user=6") {
+		t.Error("logins;user=6 registered beyond the limit")
+	}
+	if 4 != dropped.Count() {
+		t.Errorf("dropped.Count(): 4 != %v\n", dropped.Count())
+	}
+
+	r.SetSeriesLimit(0)
+	GetOrRegisterCounterT("logins", map[string]string{"user": "7"}, r)
+	if nil == r.Get("logins;user=7") {
+		t.Error("logins;user=7 not registered without a limit")
+	}
+}
+
+func TestRegistrySeriesLimitStopsRedirected(t *testing.T) {
+	r := NewRegistry().(*StandardRegistry)
+	r.SetSeriesLimit(1)
+	a := GetOrRegisterMeterT("requests", map[string]string{"path": "/a"}, r)
+	overflow := GetOrRegisterMeterT("requests", map[string]string{"path": "/b"}, r)
+	if m := GetOrRegisterMeterT("requests", map[string]string{"path": "/c"}, r); m != overflow {
+		t.Errorf("GetOrRegisterMeterT(): %v != %v\n", overflow, m)
+	}
+	r.Clear()
+	if meterTicked(a.(*StandardMeter)) || meterTicked(overflow.(*StandardMeter)) {
+		t.Error("cleared meters still ticked")
+	}
+}
@@ -0,0 +1,103 @@
+package metrics
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// A Clock tells the time and makes Tickers for meters, timers, registries
+// expiring metrics and reporters, so that tests can set a mock one, such as
+// metricstest.Clock, and move time on without sleeping.  See SetClock.
+type Clock interface {
+	Now() time.Time
+	Ticker(d time.Duration) Ticker
+}
+
+// A Ticker delivers the ticks of a Clock every period on a channel, like a
+// time.Ticker.  Whatever receives a tick calls Done once it's handled it, so
+// that a mock clock can wait for the metrics to catch up before returning.
+type Ticker interface {
+	C() <-chan time.Time
+	Done()
+	Stop()
+}
+
+// SystemClock is the Clock of the system, returning time.Now and
+// time.Tickers.
+type SystemClock struct{}
+
+// Now returns time.Now().
+func (SystemClock) Now() time.Time { return time.Now() }
+
+// Ticker returns a Ticker wrapping a time.Ticker with the given period.
+func (SystemClock) Ticker(d time.Duration) Ticker {
+	return systemTicker{time.NewTicker(d)}
+}
+
+type systemTicker struct {
+	*time.Ticker
+}
+
+func (t systemTicker) C() <-chan time.Time { return t.Ticker.C }
+
+func (systemTicker) Done() {}
+
+// currentClock holds a clockHolder, since an atomic.Value only ever holds
+// one concrete type.
+var currentClock atomic.Value
+
+type clockHolder struct {
+	c Clock
+}
+
+// CurrentClock returns the Clock set by SetClock, or SystemClock.
+func CurrentClock() Clock {
+	if h, ok := currentClock.Load().(clockHolder); ok {
+		return h.c
+	}
+	return SystemClock{}
+}
+
+// SetClock sets the Clock used by metrics from now on, or SystemClock if c is
+// nil.  Meters switch to ticking off it at once, but Tickers already running,
+// such as those of reporters and of registries expiring metrics, keep the
+// clock they started with, so a test should set its clock before starting
+// those.  Meters and timers mix times from both clocks if it's changed while
+// they're in use, as do callers of Timer.UpdateSince passing time.Now().
+func SetClock(c Clock) {
+	if nil == c {
+		c = SystemClock{}
+	}
+	currentClock.Store(clockHolder{c})
+	// The clock stamping updates never moves back by itself, so set it to
+	// the new clock's time rather than leave it in the old one's future.
+	atomic.StoreInt64(&clock, c.Now().UnixNano())
+	arbiter.setClock(c)
+}
+
+// now returns the time of the current clock.
+func now() time.Time { return CurrentClock().Now() }
+
+// since returns the time elapsed on the current clock since t.
+func since(t time.Time) time.Duration { return now().Sub(t) }
+
+// every calls f with the time of each tick of t until stop or closed is
+// closed, and then stops t.  Either may be nil, which never is.  Reporters
+// pass Closed of their registry as closed.
+func every(t Ticker, stop, closed <-chan struct{}, f func(time.Time)) {
+	defer t.Stop()
+	for {
+		select {
+		case now := <-t.C():
+			f(now)
+			t.Done()
+		case <-stop:
+			return
+		case <-closed:
+			return
+		}
+	}
+}
+
+// tick returns a Ticker of the current clock with period d.
+func tick(d time.Duration) Ticker { return CurrentClock().Ticker(d) }
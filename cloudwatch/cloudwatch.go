@@ -0,0 +1,283 @@
+// Package cloudwatch reports the metrics in a go-metrics Registry to Amazon
+// CloudWatch with PutMetricData.  It doesn't depend on the AWS SDK; a Client
+// adapting the SDK's CloudWatch client takes a few lines.
+package cloudwatch
+
+import (
+	"context"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+// MaxDatums is the most datums CloudWatch accepts in one PutMetricData call.
+const MaxDatums = 1000
+
+// DefaultMaxDimensions is the most dimensions CloudWatch accepts on one
+// datum, used unless Config.MaxDimensions says otherwise.
+const DefaultMaxDimensions = 30
+
+// Units of datums, as CloudWatch names them.
+const (
+	UnitNone         = "None"
+	UnitCount        = "Count"
+	UnitMilliseconds = "Milliseconds"
+)
+
+// A Dimension is a name and value identifying a metric, one per tag.
+type Dimension struct {
+	Name  string
+	Value string
+}
+
+// A StatisticSet summarizes many observations in one datum, which CloudWatch
+// bills as one.
+type StatisticSet struct {
+	SampleCount float64
+	Sum         float64
+	Minimum     float64
+	Maximum     float64
+}
+
+// A Datum is one value, or one StatisticSet if StatisticValues is set, of a
+// metric.
+type Datum struct {
+	MetricName      string
+	Dimensions      []Dimension
+	Timestamp       time.Time
+	Unit            string
+	Value           float64
+	StatisticValues *StatisticSet
+}
+
+// A Client sends one PutMetricData call of up to MaxDatums datums.
+type Client interface {
+	PutMetricData(namespace string, datums []Datum) error
+}
+
+// ClientFunc is a Client of an ordinary function.
+type ClientFunc func(namespace string, datums []Datum) error
+
+// PutMetricData calls f(namespace, datums).
+func (f ClientFunc) PutMetricData(namespace string, datums []Datum) error {
+	return f(namespace, datums)
+}
+
+// Config configures the CloudWatch reporter.
+type Config struct {
+	Client        Client               // Client making the calls
+	Namespace     string               // CloudWatch namespace of every metric, e.g. MyApp
+	Registry      metrics.Registry     // Registry to be exported
+	FlushInterval time.Duration        // Flush interval
+	Dimensions    map[string]string    // Dimensions added to every datum, which the metric's own tags override
+	Percentiles   []float64            // Percentiles to export from timers and histograms, each as a datum of its own
+	LargeInts     metrics.Int64Coercer // Conversion of int64 values beyond ±2^53
+
+	// Schedule aligns and jitters the flushes of Run within FlushInterval,
+	// e.g. so that a fleet doesn't call PutMetricData all at once.
+	Schedule metrics.FlushSchedule
+
+	// MaxDimensions is the most dimensions of one datum.  Those beyond it,
+	// in order of name, are dropped rather than have CloudWatch reject
+	// the whole call.  Zero means DefaultMaxDimensions.
+	MaxDimensions int
+
+	OnError func(error)              // Called with each error of Run, which logs it if nil
+	Metrics *metrics.ReporterMetrics // Records each Flush, counting the datums of failed calls as dropped
+}
+
+// Reporter sends the metrics in a registry to CloudWatch.  Counters and
+// meters are sent as their change in count since the previous flush, gauges
+// as their values, and timers, in milliseconds, and histograms as a
+// StatisticSet of what they observed since the previous flush, so that each
+// costs one datum however busy it is.  A StatisticSet's count is exact but
+// its sum, minimum and maximum are estimated from the metric's sample.
+// Counts which didn't change and timers and histograms which observed
+// nothing aren't sent.  Tags become dimensions.
+type Reporter struct {
+	c      Config
+	mutex  sync.Mutex
+	counts map[string]int64
+}
+
+// NewReporter returns a Reporter sending through c.Client.
+func NewReporter(c Config) *Reporter {
+	return &Reporter{c: c, counts: make(map[string]int64)}
+}
+
+// CloudWatch is a blocking exporter function which reports metrics in
+// c.Registry to CloudWatch every c.FlushInterval, passing errors to c.OnError,
+// or logging them, until c.Registry is closed.
+func CloudWatch(c Config) {
+	NewReporter(c).Run()
+}
+
+// Flush sends every metric once, in calls of up to MaxDatums datums,
+// returning the first error of a call.  The calls after a failed one are
+// still made.
+func (r *Reporter) Flush() error {
+	return r.c.Metrics.Flush(r.flush)
+}
+
+func (r *Reporter) flush() error {
+	datums := r.datums(time.Now())
+	var err error
+	for 0 != len(datums) {
+		n := MaxDatums
+		if n > len(datums) {
+			n = len(datums)
+		}
+		if e := r.c.Client.PutMetricData(r.c.Namespace, datums[:n]); nil != e {
+			r.c.Metrics.Drop(n)
+			if nil == err {
+				err = e
+			}
+		}
+		datums = datums[n:]
+	}
+	return err
+}
+
+// Run flushes every c.FlushInterval, passing errors to c.OnError, or logging
+// them, until c.Registry is closed.
+func (r *Reporter) Run() {
+	r.RunContext(context.Background())
+}
+
+// RunContext is Run until ctx is done, when it flushes a final time before
+// returning.
+func (r *Reporter) RunContext(ctx context.Context) {
+	r.c.Schedule.RunContext(ctx, r.c.FlushInterval, metrics.Closed(r.c.Registry), func(time.Time) {
+		metrics.ReportError(r.c.OnError, r.Flush())
+	})
+}
+
+// datums renders every metric in the registry, sorted by name.
+func (r *Reporter) datums(now time.Time) []Datum {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	var datums []Datum
+	seen := make(map[string]bool)
+	r.c.Registry.EachSnapshot(func(name string, i interface{}) {
+		base, tags := metrics.SplitTaggedName(name)
+		dimensions := r.dimensions(tags)
+		datum := func(field, unit string, v float64) {
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				return
+			}
+			datums = append(datums, Datum{
+				MetricName: metricName(base, field),
+				Dimensions: dimensions,
+				Timestamp:  now,
+				Unit:       unit,
+				Value:      v,
+			})
+		}
+		statistics := func(count int64, mean float64, min, max int64, scale float64, unit string) {
+			datums = append(datums, Datum{
+				MetricName: base,
+				Dimensions: dimensions,
+				Timestamp:  now,
+				Unit:       unit,
+				StatisticValues: &StatisticSet{
+					SampleCount: r.c.LargeInts.Float64(count),
+					Sum:         float64(count) * mean / scale,
+					Minimum:     r.c.LargeInts.Float64(min) / scale,
+					Maximum:     r.c.LargeInts.Float64(max) / scale,
+				},
+			})
+		}
+		switch metric := i.(type) {
+		case metrics.Counter:
+			seen[name] = true
+			if delta := r.delta(name, metric.Count()); 0 != delta {
+				datum("", UnitCount, r.c.LargeInts.Float64(delta))
+			}
+		case metrics.Gauge:
+			datum("", UnitNone, r.c.LargeInts.Float64(metric.Value()))
+		case metrics.GaugeFloat64:
+			datum("", UnitNone, metric.Value())
+		case metrics.MergeableGaugeFloat64:
+			datum("", UnitNone, metric.Value())
+		case metrics.Histogram:
+			seen[name] = true
+			if delta := r.delta(name, metric.Count()); 0 < delta {
+				statistics(delta, metric.Mean(), metric.Min(), metric.Max(), 1, UnitNone)
+				percentiles := metrics.MetricPercentiles(r.c.Percentiles, metric)
+				ps := metric.Percentiles(percentiles)
+				for i, p := range percentiles {
+					datum(metrics.PercentileName(p), UnitNone, ps[i])
+				}
+			}
+		case metrics.Meter:
+			seen[name] = true
+			if delta := r.delta(name, metric.Count()); 0 != delta {
+				datum("", UnitCount, r.c.LargeInts.Float64(delta))
+			}
+		case metrics.Timer:
+			seen[name] = true
+			if delta := r.delta(name, metric.Count()); 0 < delta {
+				ms := float64(time.Millisecond)
+				statistics(delta, metric.Mean(), metric.Min(), metric.Max(), ms, UnitMilliseconds)
+				percentiles := metrics.MetricPercentiles(r.c.Percentiles, metric)
+				ps := metric.Percentiles(percentiles)
+				for i, p := range percentiles {
+					datum(metrics.PercentileName(p), UnitMilliseconds, ps[i]/ms)
+				}
+			}
+		}
+	})
+	for name := range r.counts {
+		if !seen[name] {
+			delete(r.counts, name)
+		}
+	}
+	sort.SliceStable(datums, func(i, j int) bool { return datums[i].MetricName < datums[j].MetricName })
+	return datums
+}
+
+// delta returns the change in the named count since the previous flush.
+func (r *Reporter) delta(name string, count int64) int64 {
+	delta := count - r.counts[name]
+	r.counts[name] = count
+	return delta
+}
+
+// dimensions merges the configured dimensions and the tags, sorted by name
+// and cut down to MaxDimensions.  Tags with empty values are left out, since
+// CloudWatch rejects them.
+func (r *Reporter) dimensions(tags map[string]string) []Dimension {
+	merged := make(map[string]string, len(r.c.Dimensions)+len(tags))
+	for k, v := range r.c.Dimensions {
+		merged[k] = v
+	}
+	for k, v := range tags {
+		merged[k] = v
+	}
+	dimensions := make([]Dimension, 0, len(merged))
+	for k, v := range merged {
+		if "" != v {
+			dimensions = append(dimensions, Dimension{Name: k, Value: v})
+		}
+	}
+	sort.Slice(dimensions, func(i, j int) bool { return dimensions[i].Name < dimensions[j].Name })
+	max := r.c.MaxDimensions
+	if max <= 0 {
+		max = DefaultMaxDimensions
+	}
+	if len(dimensions) > max {
+		dimensions = dimensions[:max]
+	}
+	return dimensions
+}
+
+// metricName joins the name of a metric and of one of its fields with a dot.
+func metricName(name, field string) string {
+	if "" == field {
+		return name
+	}
+	return name + "." + field
+}
@@ -0,0 +1,99 @@
+package cloudwatch
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+func TestDatums(t *testing.T) {
+	reg := metrics.NewRegistry()
+	metrics.GetOrRegisterCounterT("hits", map[string]string{"endpoint": "/users"}, reg).Inc(3)
+	metrics.NewRegisteredGauge("depth", reg).Update(7)
+	tm := metrics.NewRegisteredTimer("latency", reg)
+	tm.Update(10 * time.Millisecond)
+	tm.Update(30 * time.Millisecond)
+	r := NewReporter(Config{Registry: reg, Dimensions: map[string]string{"host": "a", "endpoint": "other"}})
+	now := time.Unix(100, 0)
+	want := []Datum{
+		{MetricName: "depth", Dimensions: []Dimension{{"endpoint", "other"}, {"host", "a"}}, Timestamp: now, Unit: UnitNone, Value: 7},
+		{MetricName: "hits", Dimensions: []Dimension{{"endpoint", "/users"}, {"host", "a"}}, Timestamp: now, Unit: UnitCount, Value: 3},
+		{MetricName: "latency", Dimensions: []Dimension{{"endpoint", "other"}, {"host", "a"}}, Timestamp: now, Unit: UnitMilliseconds, StatisticValues: &StatisticSet{SampleCount: 2, Sum: 40, Minimum: 10, Maximum: 30}},
+	}
+	if got := r.datums(now); !reflect.DeepEqual(want, got) {
+		t.Errorf("datums(): %+v != %+v\n", want, got)
+	}
+
+	// Counts which didn't change and timers which observed nothing since
+	// the previous flush aren't sent.
+	if got := r.datums(now); 1 != len(got) || "depth" != got[0].MetricName {
+		t.Errorf("datums(): %+v\n", got)
+	}
+}
+
+func TestDatumsLargeInts(t *testing.T) {
+	reg := metrics.NewRegistry()
+	metrics.NewRegisteredGauge("bytes", reg).Update(1<<53 + 1)
+	lost := metrics.NewCounter()
+	r := NewReporter(Config{Registry: reg, LargeInts: metrics.Int64Coercer{Handling: metrics.LargeIntWarn, PrecisionLoss: lost}})
+	if got := r.datums(time.Now()); 1 != len(got) || float64(1<<53) != got[0].Value {
+		t.Errorf("datums(): %+v\n", got)
+	}
+	if count := lost.Count(); 1 != count {
+		t.Errorf("lost.Count(): 1 != %v\n", count)
+	}
+}
+
+func TestDimensionsLimit(t *testing.T) {
+	reg := metrics.NewRegistry()
+	metrics.GetOrRegisterGaugeT("g", map[string]string{"a": "1", "b": "2", "c": "3", "d": ""}, reg).Update(1)
+	r := NewReporter(Config{Registry: reg, MaxDimensions: 2})
+	want := []Dimension{{"a", "1"}, {"b", "2"}}
+	if got := r.datums(time.Now())[0].Dimensions; !reflect.DeepEqual(want, got) {
+		t.Errorf("Dimensions: %v != %v\n", want, got)
+	}
+}
+
+func TestFlushBatches(t *testing.T) {
+	reg := metrics.NewRegistry()
+	for i := 0; i < 2500; i++ {
+		metrics.NewRegisteredGauge(fmt.Sprintf("g%04d", i), reg).Update(1)
+	}
+	var sizes []int
+	client := ClientFunc(func(namespace string, datums []Datum) error {
+		if "app" != namespace {
+			t.Errorf("namespace: app != %q\n", namespace)
+		}
+		sizes = append(sizes, len(datums))
+		if 1 == len(sizes) {
+			return errors.New("throttled")
+		}
+		return nil
+	})
+	err := NewReporter(Config{Client: client, Namespace: "app", Registry: reg}).Flush()
+	if nil == err || "throttled" != err.Error() {
+		t.Errorf("Flush(): throttled != %v\n", err)
+	}
+	if want := []int{1000, 1000, 500}; !reflect.DeepEqual(want, sizes) {
+		t.Errorf("sizes: %v != %v\n", want, sizes)
+	}
+}
+
+func TestRunStopsOnClose(t *testing.T) {
+	reg := metrics.NewRegistry()
+	done := make(chan struct{})
+	go func() {
+		CloudWatch(Config{Client: ClientFunc(func(string, []Datum) error { return nil }), Registry: reg, FlushInterval: time.Hour})
+		close(done)
+	}()
+	reg.Close()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("CloudWatch still running")
+	}
+}
@@ -0,0 +1,77 @@
+package metrics
+
+import (
+	"math"
+	"strconv"
+)
+
+// LargeIntHandling selects how an Int64Coercer converts int64 values which a
+// float64 can't represent exactly, i.e. most of those beyond ±2^53.
+type LargeIntHandling int
+
+const (
+	// LargeIntAsIs converts large values to the nearest float64, silently
+	// losing precision.  This is the default.
+	LargeIntAsIs LargeIntHandling = iota
+
+	// LargeIntWarn converts large values to the nearest float64 like
+	// LargeIntAsIs but counts every lossy conversion.
+	LargeIntWarn
+
+	// LargeIntString converts large values to their exact decimal string
+	// representation, for backends which accept string fields.
+	LargeIntString
+)
+
+// Int64Coercer converts int64 metric values for exporters to backends which
+// only accept floating-point values.
+type Int64Coercer struct {
+	Handling LargeIntHandling
+
+	// PrecisionLoss is incremented for every lossy conversion when Handling
+	// is LargeIntWarn, or by Float64 when it's LargeIntString.  It may be
+	// nil.
+	PrecisionLoss Counter
+}
+
+// Coerce returns v as a float64 or, if Handling is LargeIntString and v can't
+// be represented exactly by a float64, as a decimal string.
+func (c *Int64Coercer) Coerce(v int64) interface{} {
+	f, exact := Int64ToFloat64(v)
+	if !exact {
+		switch c.Handling {
+		case LargeIntWarn:
+			if nil != c.PrecisionLoss {
+				c.PrecisionLoss.Inc(1)
+			}
+		case LargeIntString:
+			return strconv.FormatInt(v, 10)
+		}
+	}
+	return f
+}
+
+// Float64 returns v as the nearest float64, for backends without string
+// fields.  Lossy conversions are counted when Handling is LargeIntWarn or
+// LargeIntString, since there's no string to fall back to.
+func (c *Int64Coercer) Float64(v int64) float64 {
+	f, exact := Int64ToFloat64(v)
+	if !exact && LargeIntAsIs != c.Handling && nil != c.PrecisionLoss {
+		c.PrecisionLoss.Inc(1)
+	}
+	return f
+}
+
+// Int64ToFloat64 converts v to the nearest float64 and reports whether the
+// conversion was exact.
+func Int64ToFloat64(v int64) (float64, bool) {
+	f := float64(v)
+	if -1<<53 <= v && v <= 1<<53 {
+		return f, true
+	}
+	// float64(math.MaxInt64) rounds up to 2^63, which doesn't convert back.
+	if f >= math.MaxInt64 {
+		return f, false
+	}
+	return f, int64(f) == v
+}
@@ -0,0 +1,83 @@
+package metrics
+
+import (
+	"math"
+	"testing"
+)
+
+func TestInt64ToFloat64(t *testing.T) {
+	for _, c := range []struct {
+		v     int64
+		exact bool
+	}{
+		{0, true},
+		{1 << 53, true},
+		{-1 << 53, true},
+		{1<<53 + 1, false},
+		{-1<<53 - 1, false},
+		{1<<53 + 2, true},
+		{1 << 62, true},
+		{math.MaxInt64, false},
+		{math.MinInt64, true},
+	} {
+		f, exact := Int64ToFloat64(c.v)
+		if exact != c.exact {
+			t.Errorf("Int64ToFloat64(%d): exact %v != %v\n", c.v, c.exact, exact)
+		}
+		if float64(c.v) != f {
+			t.Errorf("Int64ToFloat64(%d): %v != %v\n", c.v, float64(c.v), f)
+		}
+	}
+}
+
+func TestInt64CoercerAsIs(t *testing.T) {
+	c := &Int64Coercer{}
+	if v := c.Coerce(1<<53 + 1); float64(1<<53) != v {
+		t.Errorf("c.Coerce(2^53+1): %v != %v\n", float64(1<<53), v)
+	}
+}
+
+func TestInt64CoercerWarn(t *testing.T) {
+	c := &Int64Coercer{Handling: LargeIntWarn, PrecisionLoss: NewCounter()}
+	if v := c.Coerce(1 << 53); float64(1<<53) != v {
+		t.Errorf("c.Coerce(2^53): %v != %v\n", float64(1<<53), v)
+	}
+	if count := c.PrecisionLoss.Count(); 0 != count {
+		t.Errorf("c.PrecisionLoss.Count(): 0 != %v\n", count)
+	}
+	if v := c.Coerce(1<<53 + 1); float64(1<<53) != v {
+		t.Errorf("c.Coerce(2^53+1): %v != %v\n", float64(1<<53), v)
+	}
+	if count := c.PrecisionLoss.Count(); 1 != count {
+		t.Errorf("c.PrecisionLoss.Count(): 1 != %v\n", count)
+	}
+}
+
+func TestInt64CoercerString(t *testing.T) {
+	c := &Int64Coercer{Handling: LargeIntString}
+	if v := c.Coerce(1 << 53); float64(1<<53) != v {
+		t.Errorf("c.Coerce(2^53): %v != %v\n", float64(1<<53), v)
+	}
+	if v := c.Coerce(1<<53 + 1); "9007199254740993" != v {
+		t.Errorf("c.Coerce(2^53+1): 9007199254740993 != %v\n", v)
+	}
+}
+
+func TestInt64CoercerFloat64(t *testing.T) {
+	for _, handling := range []LargeIntHandling{LargeIntAsIs, LargeIntWarn, LargeIntString} {
+		c := &Int64Coercer{Handling: handling, PrecisionLoss: NewCounter()}
+		if v := c.Float64(1 << 53); float64(1<<53) != v {
+			t.Errorf("%v: c.Float64(2^53): %v != %v\n", handling, float64(1<<53), v)
+		}
+		if v := c.Float64(1<<53 + 1); float64(1<<53) != v {
+			t.Errorf("%v: c.Float64(2^53+1): %v != %v\n", handling, float64(1<<53), v)
+		}
+		var lost int64 = 1
+		if LargeIntAsIs == handling {
+			lost = 0
+		}
+		if count := c.PrecisionLoss.Count(); lost != count {
+			t.Errorf("%v: c.PrecisionLoss.Count(): %v != %v\n", handling, lost, count)
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package metrics
+
+import "context"
+
+// registryKey is the key of the Registry in a context.  It's unexported so
+// that only NewContext can set it.
+type registryKey struct{}
+
+// NewContext returns a copy of ctx carrying the registry r, for code further
+// down the call stack to record in with FromContext, e.g. a registry of one
+// request or tenant.
+func NewContext(ctx context.Context, r Registry) context.Context {
+	return context.WithValue(ctx, registryKey{}, r)
+}
+
+// FromContext returns the registry carried by ctx, or DefaultRegistry if it
+// carries none.
+func FromContext(ctx context.Context) Registry {
+	if r, ok := ctx.Value(registryKey{}).(Registry); ok && nil != r {
+		return r
+	}
+	return DefaultRegistry
+}
@@ -0,0 +1,27 @@
+package metrics
+
+import (
+	"context"
+	"testing"
+)
+
+func TestContext(t *testing.T) {
+	r := NewRegistry()
+	ctx := NewContext(context.Background(), r)
+	if got := FromContext(ctx); r != got {
+		t.Errorf("FromContext(ctx): %v != %v\n", r, got)
+	}
+	GetOrRegisterCounter("foo", FromContext(ctx)).Inc(1)
+	if nil == r.Get("foo") {
+		t.Error("foo not registered in the registry from the context")
+	}
+}
+
+func TestContextDefault(t *testing.T) {
+	if r := FromContext(context.Background()); DefaultRegistry != r {
+		t.Errorf("FromContext(context.Background()): %v != %v\n", DefaultRegistry, r)
+	}
+	if r := FromContext(NewContext(context.Background(), nil)); DefaultRegistry != r {
+		t.Errorf("FromContext(NewContext(ctx, nil)): %v != %v\n", DefaultRegistry, r)
+	}
+}
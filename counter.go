@@ -1,6 +1,9 @@
 package metrics
 
-import "sync/atomic"
+import (
+	"sync/atomic"
+	"time"
+)
 
 // Counters hold an int64 value that can be incremented and decremented.
 type Counter interface {
@@ -12,34 +15,60 @@ type Counter interface {
 }
 
 // GetOrRegisterCounter returns an existing Counter or constructs and registers
-// a new StandardCounter.
+// a new StandardCounter, or ShardedCounter if r uses them.
 func GetOrRegisterCounter(name string, r Registry) Counter {
 	if nil == r {
 		r = DefaultRegistry
 	}
-	return r.GetOrRegister(name, NewCounter).(Counter)
+	return getOrRegister(r, name, counterConstructor(r), NilCounter{}).(Counter)
+}
+
+// GetOrRegisterCounterT returns the existing Counter identified by name and
+// tags together or constructs and registers a new one carrying the tags, all
+// at once, so that goroutines using the series for the first time
+// concurrently share one counter rather than racing to register and then tag
+// their own.
+func GetOrRegisterCounterT(name string, tags map[string]string, r Registry) Counter {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	return getOrRegisterTagged(r, name, tags, func() interface{} { return counterConstructor(r)() }, NilCounter{}).(Counter)
 }
 
 // NewCounter constructs a new StandardCounter.
 func NewCounter() Counter {
-	if UseNilMetrics {
+	if useNilMetrics() {
 		return NilCounter{}
 	}
-	return &StandardCounter{0}
+	return &StandardCounter{}
 }
 
-// NewRegisteredCounter constructs and registers a new StandardCounter.
+// NewRegisteredCounter constructs and registers a new StandardCounter, or
+// ShardedCounter if r uses them.
 func NewRegisteredCounter(name string, r Registry) Counter {
-	c := NewCounter()
 	if nil == r {
 		r = DefaultRegistry
 	}
+	if usesNilMetrics(r) {
+		return NilCounter{}
+	}
+	c := counterConstructor(r)()
 	r.Register(name, c)
 	return c
 }
 
-// CounterSnapshot is a read-only copy of another Counter.
-type CounterSnapshot int64
+// CounterSnapshot is a read-only copy of another Counter, which records when it
+// was taken.
+type CounterSnapshot struct {
+	count     int64
+	timestamp time.Time
+}
+
+// NewCounterSnapshot constructs a CounterSnapshot of the given count, taken
+// at the given time, which is zero if it isn't known.
+func NewCounterSnapshot(count int64, timestamp time.Time) CounterSnapshot {
+	return CounterSnapshot{count: count, timestamp: timestamp}
+}
 
 // Clear panics.
 func (CounterSnapshot) Clear() {
@@ -47,7 +76,7 @@ func (CounterSnapshot) Clear() {
 }
 
 // Count returns the count at the time the snapshot was taken.
-func (c CounterSnapshot) Count() int64 { return int64(c) }
+func (c CounterSnapshot) Count() int64 { return c.count }
 
 // Dec panics.
 func (CounterSnapshot) Dec(int64) {
@@ -62,9 +91,19 @@ func (CounterSnapshot) Inc(int64) {
 // Snapshot returns the snapshot.
 func (c CounterSnapshot) Snapshot() Counter { return c }
 
+// Timestamp returns the time the snapshot was taken, or the zero time if it
+// isn't known.
+func (c CounterSnapshot) Timestamp() time.Time { return c.timestamp }
+
 // NilCounter is a no-op Counter.
 type NilCounter struct{}
 
+// AddDynamicTag is a no-op.
+func (NilCounter) AddDynamicTag(string, func() string) error { return nil }
+
+// AddTags is a no-op.
+func (NilCounter) AddTags(map[string]string) {}
+
 // Clear is a no-op.
 func (NilCounter) Clear() {}
 
@@ -74,16 +113,29 @@ func (NilCounter) Count() int64 { return 0 }
 // Dec is a no-op.
 func (NilCounter) Dec(i int64) {}
 
+// GetTags is a no-op.
+func (NilCounter) GetTags() map[string]string { return nil }
+
 // Inc is a no-op.
 func (NilCounter) Inc(i int64) {}
 
+// RemoveTag is a no-op.
+func (NilCounter) RemoveTag(string) {}
+
+// SetTags is a no-op.
+func (NilCounter) SetTags(map[string]string) {}
+
 // Snapshot is a no-op.
 func (NilCounter) Snapshot() Counter { return NilCounter{} }
 
 // StandardCounter is the standard implementation of a Counter and uses the
 // sync/atomic package to manage a single int64 value.
 type StandardCounter struct {
+	tagSet
+	lastUpdate
+
 	count int64
+	last  atomic.Value // Counter, the latest snapshot
 }
 
 // Clear sets the counter to zero.
@@ -98,15 +150,38 @@ func (c *StandardCounter) Count() int64 {
 
 // Dec decrements the counter by the given amount.
 func (c *StandardCounter) Dec(i int64) {
+	c.touch()
 	atomic.AddInt64(&c.count, -i)
 }
 
 // Inc increments the counter by the given amount.
 func (c *StandardCounter) Inc(i int64) {
+	c.touch()
 	atomic.AddInt64(&c.count, i)
 }
 
-// Snapshot returns a read-only copy of the counter.
+// Snapshot returns a read-only copy of the counter.  While neither the count
+// nor the clock has moved it returns its last snapshot again, which costs no
+// allocation.
 func (c *StandardCounter) Snapshot() Counter {
-	return CounterSnapshot(c.Count())
+	count, t := c.Count(), now()
+	v := c.last.Load()
+	if last, ok := v.(CounterSnapshot); ok && count == last.count && t.Equal(last.timestamp) {
+		return v.(Counter)
+	}
+	snapshot := Counter(CounterSnapshot{count: count, timestamp: t})
+	c.last.Store(snapshot)
+	return snapshot
+}
+
+// ReadInto stores the counter's count and the time in s, which reads the
+// counter without allocating a snapshot; see SnapshotBuffer.
+func (c *StandardCounter) ReadInto(s *CounterSnapshot) {
+	*s = CounterSnapshot{count: c.Count(), timestamp: now()}
+}
+
+// snapshotAndReset returns a read-only copy of the counter and atomically sets
+// it to zero.
+func (c *StandardCounter) snapshotAndReset() interface{} {
+	return CounterSnapshot{count: atomic.SwapInt64(&c.count, 0), timestamp: now()}
 }
@@ -0,0 +1,183 @@
+package metrics
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// CounterFloat64s hold a float64 value that can be incremented and
+// decremented by fractional amounts, e.g. of megabytes, dollars or seconds.
+type CounterFloat64 interface {
+	Clear()
+	Count() float64
+	Dec(float64)
+	Inc(float64)
+	Snapshot() CounterFloat64
+}
+
+// GetOrRegisterCounterFloat64 returns an existing CounterFloat64 or constructs
+// and registers a new StandardCounterFloat64.
+func GetOrRegisterCounterFloat64(name string, r Registry) CounterFloat64 {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	return getOrRegister(r, name, NewCounterFloat64, NilCounterFloat64{}).(CounterFloat64)
+}
+
+// GetOrRegisterCounterFloat64T returns the existing CounterFloat64 identified
+// by name and tags together or constructs and registers a new one carrying the
+// tags; see GetOrRegisterCounterT.
+func GetOrRegisterCounterFloat64T(name string, tags map[string]string, r Registry) CounterFloat64 {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	return getOrRegisterTagged(r, name, tags, func() interface{} { return NewCounterFloat64() }, NilCounterFloat64{}).(CounterFloat64)
+}
+
+// NewCounterFloat64 constructs a new StandardCounterFloat64.
+func NewCounterFloat64() CounterFloat64 {
+	if useNilMetrics() {
+		return NilCounterFloat64{}
+	}
+	return &StandardCounterFloat64{}
+}
+
+// NewRegisteredCounterFloat64 constructs and registers a new
+// StandardCounterFloat64.
+func NewRegisteredCounterFloat64(name string, r Registry) CounterFloat64 {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	if usesNilMetrics(r) {
+		return NilCounterFloat64{}
+	}
+	c := NewCounterFloat64()
+	r.Register(name, c)
+	return c
+}
+
+// CounterFloat64Snapshot is a read-only copy of another CounterFloat64, which
+// records when it was taken.
+type CounterFloat64Snapshot struct {
+	count     float64
+	timestamp time.Time
+}
+
+// NewCounterFloat64Snapshot constructs a CounterFloat64Snapshot of the given
+// count, taken at the given time, which is zero if it isn't known.
+func NewCounterFloat64Snapshot(count float64, timestamp time.Time) CounterFloat64Snapshot {
+	return CounterFloat64Snapshot{count: count, timestamp: timestamp}
+}
+
+// Clear panics.
+func (CounterFloat64Snapshot) Clear() {
+	panic("Clear called on a CounterFloat64Snapshot")
+}
+
+// Count returns the count at the time the snapshot was taken.
+func (c CounterFloat64Snapshot) Count() float64 { return c.count }
+
+// Dec panics.
+func (CounterFloat64Snapshot) Dec(float64) {
+	panic("Dec called on a CounterFloat64Snapshot")
+}
+
+// Inc panics.
+func (CounterFloat64Snapshot) Inc(float64) {
+	panic("Inc called on a CounterFloat64Snapshot")
+}
+
+// Snapshot returns the snapshot.
+func (c CounterFloat64Snapshot) Snapshot() CounterFloat64 { return c }
+
+// Timestamp returns the time the snapshot was taken, or the zero time if it
+// isn't known.
+func (c CounterFloat64Snapshot) Timestamp() time.Time { return c.timestamp }
+
+// NilCounterFloat64 is a no-op CounterFloat64.
+type NilCounterFloat64 struct{}
+
+// AddDynamicTag is a no-op.
+func (NilCounterFloat64) AddDynamicTag(string, func() string) error { return nil }
+
+// AddTags is a no-op.
+func (NilCounterFloat64) AddTags(map[string]string) {}
+
+// Clear is a no-op.
+func (NilCounterFloat64) Clear() {}
+
+// Count is a no-op.
+func (NilCounterFloat64) Count() float64 { return 0.0 }
+
+// Dec is a no-op.
+func (NilCounterFloat64) Dec(float64) {}
+
+// GetTags is a no-op.
+func (NilCounterFloat64) GetTags() map[string]string { return nil }
+
+// Inc is a no-op.
+func (NilCounterFloat64) Inc(float64) {}
+
+// RemoveTag is a no-op.
+func (NilCounterFloat64) RemoveTag(string) {}
+
+// SetTags is a no-op.
+func (NilCounterFloat64) SetTags(map[string]string) {}
+
+// Snapshot is a no-op.
+func (NilCounterFloat64) Snapshot() CounterFloat64 { return NilCounterFloat64{} }
+
+// StandardCounterFloat64 is the standard implementation of a CounterFloat64.
+// It stores its float64 value as its IEEE 754 bits in a uint64, like a
+// StandardGaugeFloat64, and adds to it in a compare-and-swap loop, since there
+// is no atomic floating-point add.
+type StandardCounterFloat64 struct {
+	tagSet
+	lastUpdate
+
+	bits uint64
+}
+
+// Clear sets the counter to zero.
+func (c *StandardCounterFloat64) Clear() {
+	atomic.StoreUint64(&c.bits, 0)
+}
+
+// Count returns the current count.
+func (c *StandardCounterFloat64) Count() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&c.bits))
+}
+
+// Dec decrements the counter by the given amount.
+func (c *StandardCounterFloat64) Dec(v float64) {
+	c.Inc(-v)
+}
+
+// Inc increments the counter by the given amount.
+func (c *StandardCounterFloat64) Inc(v float64) {
+	c.touch()
+	for {
+		old := atomic.LoadUint64(&c.bits)
+		sum := math.Float64bits(math.Float64frombits(old) + v)
+		if atomic.CompareAndSwapUint64(&c.bits, old, sum) {
+			return
+		}
+	}
+}
+
+// Snapshot returns a read-only copy of the counter.
+func (c *StandardCounterFloat64) Snapshot() CounterFloat64 {
+	return CounterFloat64Snapshot{count: c.Count(), timestamp: now()}
+}
+
+// ReadInto stores the counter's count in s; see StandardCounter.ReadInto.
+func (c *StandardCounterFloat64) ReadInto(s *CounterFloat64Snapshot) {
+	*s = CounterFloat64Snapshot{count: c.Count(), timestamp: now()}
+}
+
+// snapshotAndReset returns a read-only copy of the counter and atomically sets
+// it to zero.
+func (c *StandardCounterFloat64) snapshotAndReset() interface{} {
+	return CounterFloat64Snapshot{count: math.Float64frombits(atomic.SwapUint64(&c.bits, 0)), timestamp: now()}
+}
@@ -0,0 +1,117 @@
+package metrics
+
+import (
+	"sync"
+	"testing"
+)
+
+func BenchmarkCounterFloat64(b *testing.B) {
+	c := NewCounterFloat64()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.Inc(1.5)
+	}
+}
+
+func BenchmarkCounterFloat64Parallel(b *testing.B) {
+	c := NewCounterFloat64()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			c.Inc(1.5)
+		}
+	})
+}
+
+func TestCounterFloat64Clear(t *testing.T) {
+	c := NewCounterFloat64()
+	c.Inc(1.5)
+	c.Clear()
+	if count := c.Count(); 0 != count {
+		t.Errorf("c.Count(): 0 != %v\n", count)
+	}
+}
+
+func TestCounterFloat64Dec(t *testing.T) {
+	c := NewCounterFloat64()
+	c.Dec(0.25)
+	if count := c.Count(); -0.25 != count {
+		t.Errorf("c.Count(): -0.25 != %v\n", count)
+	}
+}
+
+func TestCounterFloat64Inc(t *testing.T) {
+	c := NewCounterFloat64()
+	c.Inc(0.5)
+	c.Inc(0.25)
+	if count := c.Count(); 0.75 != count {
+		t.Errorf("c.Count(): 0.75 != %v\n", count)
+	}
+}
+
+func TestCounterFloat64Concurrent(t *testing.T) {
+	c := NewCounterFloat64()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				c.Inc(0.5)
+			}
+		}()
+	}
+	wg.Wait()
+	if count := c.Count(); 4000 != count {
+		t.Errorf("c.Count(): 4000 != %v\n", count)
+	}
+}
+
+func TestCounterFloat64Snapshot(t *testing.T) {
+	c := NewCounterFloat64()
+	c.Inc(1.5)
+	snapshot := c.Snapshot()
+	c.Inc(1)
+	if count := snapshot.Count(); 1.5 != count {
+		t.Errorf("snapshot.Count(): 1.5 != %v\n", count)
+	}
+}
+
+func TestCounterFloat64SnapshotAndReset(t *testing.T) {
+	r := NewRegistry()
+	GetOrRegisterCounterFloat64("foo", r).Inc(2.5)
+	snapshot := r.SnapshotAndReset()
+	if count := snapshot.Get("foo").(CounterFloat64).Count(); 2.5 != count {
+		t.Errorf("snapshot count: 2.5 != %v\n", count)
+	}
+	if count := GetOrRegisterCounterFloat64("foo", r).Count(); 0 != count {
+		t.Errorf("count: 0 != %v\n", count)
+	}
+}
+
+func TestGetOrRegisterCounterFloat64(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredCounterFloat64("foo", r).Inc(47.5)
+	if c := GetOrRegisterCounterFloat64("foo", r); 47.5 != c.Count() {
+		t.Fatal(c)
+	}
+}
+
+func TestGetOrRegisterCounterFloat64T(t *testing.T) {
+	r := NewRegistry()
+	tags := map[string]string{"currency": "eur"}
+	GetOrRegisterCounterFloat64T("revenue", tags, r).Inc(9.99)
+	c := GetOrRegisterCounterFloat64T("revenue", tags, r)
+	if count := c.Count(); 9.99 != count {
+		t.Errorf("c.Count(): 9.99 != %v\n", count)
+	}
+	if got := c.(Taggable).GetTags(); "eur" != got["currency"] {
+		t.Errorf("c.GetTags(): %v\n", got)
+	}
+}
+
+func TestCounterFloat64NilRegistry(t *testing.T) {
+	if _, ok := GetOrRegisterCounterFloat64("foo", NilRegistry{}).(NilCounterFloat64); !ok {
+		t.Fatal(GetOrRegisterCounterFloat64("foo", NilRegistry{}))
+	}
+}
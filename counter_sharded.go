@@ -0,0 +1,116 @@
+package metrics
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// NewShardedCounter constructs a new ShardedCounter.
+func NewShardedCounter() Counter {
+	if useNilMetrics() {
+		return NilCounter{}
+	}
+	n := 1
+	for n < runtime.GOMAXPROCS(0) {
+		n <<= 1
+	}
+	c := &ShardedCounter{cells: make([]counterCell, n)}
+	c.pool.New = func() interface{} {
+		return &c.cells[int(atomic.AddUint32(&c.next, 1))&(len(c.cells)-1)]
+	}
+	return c
+}
+
+// ShardedCounter is an implementation of a Counter for counters incremented
+// from many cores at once, tens of millions of times a second, at which a
+// StandardCounter's single int64 becomes contended.  It stripes the count
+// across cells on cache lines of their own, one per processor or so, and sums
+// them on Count.  It costs more memory and a slower Count, and under little
+// contention its Inc is slower than a StandardCounter's, so use it only where
+// profiles show counters contended.
+//
+// Registries switched over by SetUseShardedCounters construct ShardedCounters
+// in GetOrRegisterCounter and NewRegisteredCounter.
+type ShardedCounter struct {
+	tagSet
+	lastUpdate
+
+	cells []counterCell
+	next  uint32    // Round-robin assignment of cells to processors
+	pool  sync.Pool // Per-processor cache of a cell
+}
+
+// counterCell is one stripe of a ShardedCounter, padded to fill a cache line
+// so that cells don't share one.
+type counterCell struct {
+	count int64
+	_     [56]byte
+}
+
+// Clear sets the counter to zero.
+func (c *ShardedCounter) Clear() {
+	for i := range c.cells {
+		atomic.StoreInt64(&c.cells[i].count, 0)
+	}
+}
+
+// Count returns the current count, the sum of the cells.
+func (c *ShardedCounter) Count() int64 {
+	var count int64
+	for i := range c.cells {
+		count += atomic.LoadInt64(&c.cells[i].count)
+	}
+	return count
+}
+
+// Dec decrements the counter by the given amount.
+func (c *ShardedCounter) Dec(i int64) {
+	c.Inc(-i)
+}
+
+// Inc increments the counter by the given amount.
+func (c *ShardedCounter) Inc(i int64) {
+	// sync.Pool keeps a cell per processor, so goroutines on different
+	// processors mostly add to different cells.
+	c.touch()
+	cell := c.pool.Get().(*counterCell)
+	atomic.AddInt64(&cell.count, i)
+	c.pool.Put(cell)
+}
+
+// Snapshot returns a read-only copy of the counter.
+func (c *ShardedCounter) Snapshot() Counter {
+	return CounterSnapshot{count: c.Count(), timestamp: now()}
+}
+
+// snapshotAndReset returns a read-only copy of the counter and sets it to
+// zero, cell by cell, so that no increment is lost in between.
+func (c *ShardedCounter) snapshotAndReset() interface{} {
+	var count int64
+	for i := range c.cells {
+		count += atomic.SwapInt64(&c.cells[i].count, 0)
+	}
+	return CounterSnapshot{count: count, timestamp: now()}
+}
+
+// shardedCountersRegistry is implemented by registries which can be switched
+// to constructing ShardedCounters.
+type shardedCountersRegistry interface {
+	UseShardedCounters() bool
+}
+
+// usesShardedCounters reports whether counters constructed for r should be
+// ShardedCounters.
+func usesShardedCounters(r Registry) bool {
+	s, ok := r.(shardedCountersRegistry)
+	return ok && s.UseShardedCounters()
+}
+
+// counterConstructor returns the constructor of the counters r registers.
+func counterConstructor(r Registry) func() Counter {
+	if usesShardedCounters(r) {
+		return NewShardedCounter
+	}
+	return NewCounter
+}
@@ -0,0 +1,85 @@
+package metrics
+
+import (
+	"sync"
+	"testing"
+)
+
+func BenchmarkCounterParallel(b *testing.B) {
+	c := NewCounter()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			c.Inc(1)
+		}
+	})
+}
+
+func BenchmarkShardedCounterParallel(b *testing.B) {
+	c := NewShardedCounter()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			c.Inc(1)
+		}
+	})
+}
+
+func TestShardedCounter(t *testing.T) {
+	c := NewShardedCounter()
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10000; j++ {
+				c.Inc(2)
+				c.Dec(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if count := c.Count(); 160000 != count {
+		t.Errorf("c.Count(): 160000 != %v\n", count)
+	}
+	snapshot := c.Snapshot()
+	c.Clear()
+	if count := snapshot.Count(); 160000 != count {
+		t.Errorf("snapshot.Count(): 160000 != %v\n", count)
+	}
+	if count := c.Count(); 0 != count {
+		t.Errorf("c.Count(): 0 != %v\n", count)
+	}
+}
+
+func TestShardedCounterSnapshotAndReset(t *testing.T) {
+	c := NewShardedCounter().(*ShardedCounter)
+	c.Inc(47)
+	if count := c.snapshotAndReset().(Counter).Count(); 47 != count {
+		t.Errorf("c.snapshotAndReset().Count(): 47 != %v\n", count)
+	}
+	if count := c.Count(); 0 != count {
+		t.Errorf("c.Count(): 0 != %v\n", count)
+	}
+}
+
+func TestRegistryUseShardedCounters(t *testing.T) {
+	r := NewRegistry()
+	r.(*StandardRegistry).SetUseShardedCounters(true)
+	if _, ok := GetOrRegisterCounter("foo", r).(*ShardedCounter); !ok {
+		t.Error("GetOrRegisterCounter didn't construct a ShardedCounter")
+	}
+	if _, ok := NewRegisteredCounter("bar", r).(*ShardedCounter); !ok {
+		t.Error("NewRegisteredCounter didn't construct a ShardedCounter")
+	}
+	if _, ok := GetOrRegisterCounter("baz", NewPrefixedChildRegistry(r, "p.")).(*ShardedCounter); !ok {
+		t.Error("GetOrRegisterCounter didn't construct a ShardedCounter in a child registry")
+	}
+	c := GetOrRegisterCounter("foo", r)
+	c.(Taggable).AddTags(map[string]string{"k": "v"})
+	if tags := c.(Taggable).GetTags(); "v" != tags["k"] {
+		t.Errorf("tags: %v\n", tags)
+	}
+	r.(*StandardRegistry).SetUseShardedCounters(false)
+	if _, ok := GetOrRegisterCounter("qux", r).(*StandardCounter); !ok {
+		t.Error("GetOrRegisterCounter didn't construct a StandardCounter")
+	}
+}
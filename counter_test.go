@@ -1,6 +1,9 @@
 package metrics
 
-import "testing"
+import (
+	"testing"
+	"time"
+)
 
 func BenchmarkCounter(b *testing.B) {
 	c := NewCounter()
@@ -10,6 +13,41 @@ func BenchmarkCounter(b *testing.B) {
 	}
 }
 
+func BenchmarkCounterSnapshot(b *testing.B) {
+	c := NewCounter()
+	c.Inc(1 << 40)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.Snapshot()
+	}
+}
+
+// Counter snapshots are taken thousands of times per flush so snapshotting a
+// counter which hasn't moved mustn't allocate.
+func TestCounterSnapshotAllocs(t *testing.T) {
+	clock := &stepClock{now: time.Unix(100, 0)}
+	SetClock(clock)
+	defer SetClock(nil)
+	c := NewCounter()
+	c.Inc(1 << 40)
+	var snapshot Counter
+	if allocs := testing.AllocsPerRun(100, func() { snapshot = c.Snapshot() }); 0 != allocs {
+		t.Errorf("c.Snapshot(): 0 != %v allocations\n", allocs)
+	}
+	if count := snapshot.Count(); 1<<40 != count {
+		t.Errorf("snapshot.Count(): 1<<40 != %v\n", count)
+	}
+	c.Inc(1)
+	if count := c.Snapshot().Count(); 1<<40+1 != count {
+		t.Errorf("c.Snapshot().Count(): 1<<40+1 != %v\n", count)
+	}
+	clock.now = clock.now.Add(time.Second)
+	if ts := c.Snapshot().(CounterSnapshot).Timestamp(); !clock.now.Equal(ts) {
+		t.Errorf("c.Snapshot().Timestamp(): %v != %v\n", clock.now, ts)
+	}
+}
+
 func TestCounterClear(t *testing.T) {
 	c := NewCounter()
 	c.Inc(1)
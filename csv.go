@@ -0,0 +1,117 @@
+package metrics
+
+import (
+	"context"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CSVConfig provides a container with configuration parameters for the CSV
+// exporter.
+type CSVConfig struct {
+	Registry      Registry         // Registry to be exported
+	FlushInterval time.Duration    // Flush interval
+	Schedule      FlushSchedule    // Alignment and jitter of flushes, each row timestamped when it was due
+	DurationUnit  time.Duration    // Time conversion unit for durations
+	Dir           string           // Directory of the CSV files, which must exist
+	Percentiles   []float64        // Percentiles of histograms and timers, or nil for the registry's
+	OnError       func(error)      // Called with each error of CSVWithConfig instead of logging it
+	Metrics       *ReporterMetrics // Times the flushes of CSVOnce and counts those which fail
+}
+
+// CSV is a blocking exporter function which appends a row for each metric in
+// r to its CSV file in dir every d duration, so that long-running processes
+// such as benchmarks can be analyzed offline.
+func CSV(r Registry, d time.Duration, dir string) {
+	CSVWithConfig(CSVConfig{
+		Registry:      r,
+		FlushInterval: d,
+		DurationUnit:  time.Nanosecond,
+		Dir:           dir,
+	})
+}
+
+// CSVWithConfig is a blocking exporter function just like CSV, but it takes a
+// CSVConfig instead.
+func CSVWithConfig(c CSVConfig) {
+	CSVContext(context.Background(), c)
+}
+
+// CSVContext is CSVWithConfig until ctx is done, when it appends a final row
+// before returning.
+func CSVContext(ctx context.Context, c CSVConfig) {
+	c.Schedule.RunContext(ctx, c.FlushInterval, Closed(c.Registry), func(now time.Time) {
+		ReportError(c.OnError, CSVOnce(c, now))
+	})
+}
+
+// CSVOnce appends one row timestamped now to the CSV file of each metric in
+// c.Registry, returning the first error.  Each metric has a file of its own,
+// named after the metric, tags included, with any path separators replaced by
+// underscores and ".csv" appended.  A new file starts with a header row naming
+// the columns: "timestamp", in Unix seconds, followed by the metric's values,
+// the same ones the Log exporter logs, with timer durations in
+// c.DurationUnit.  The header isn't rewritten, so the percentiles mustn't
+// change between calls.
+func CSVOnce(c CSVConfig, now time.Time) error {
+	return c.Metrics.Flush(func() error { return csvOnce(c, now) })
+}
+
+func csvOnce(c CSVConfig, now time.Time) error {
+	if 0 == c.DurationUnit {
+		c.DurationUnit = time.Nanosecond
+	}
+	du := float64(c.DurationUnit)
+	ps := reportedPercentiles(c.Percentiles, c.Registry)
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	var err error
+	c.Registry.EachSnapshot(func(name string, i interface{}) {
+		fields := metricLogFields(name, i, du, ps)
+		if nil == fields {
+			return
+		}
+		header, row := []string{"timestamp"}, []string{timestamp}
+		for _, f := range fields[2:] { // Skip the type and name.
+			header = append(header, f.key)
+			row = append(row, logfmtValue(f.value))
+		}
+		if e := appendCSV(filepath.Join(c.Dir, csvFileName(name)), header, row); nil != e && nil == err {
+			err = e
+		}
+	})
+	return err
+}
+
+var csvFileNameReplacer = strings.NewReplacer("/", "_", "\\", "_", "\x00", "_")
+
+func csvFileName(name string) string {
+	return csvFileNameReplacer.Replace(name) + ".csv"
+}
+
+// appendCSV appends row to the named file, first writing the header if the
+// file is new or empty.
+func appendCSV(path string, header, row []string) error {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if nil != err {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if nil != err {
+		return err
+	}
+	w := csv.NewWriter(f)
+	if 0 == info.Size() {
+		w.Write(header)
+	}
+	w.Write(row)
+	w.Flush()
+	if err := w.Error(); nil != err {
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,50 @@
+package metrics
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCSVOnce(t *testing.T) {
+	dir := t.TempDir()
+	r := NewRegistry()
+	c := NewCounter()
+	c.(Taggable).AddTags(map[string]string{"endpoint": "/users"})
+	r.Register("requests", c)
+	NewRegisteredTimer("latency", r).Update(2 * time.Millisecond)
+	config := CSVConfig{Registry: r, Dir: dir, DurationUnit: time.Millisecond}
+
+	c.Inc(1)
+	if err := CSVOnce(config, time.Unix(100, 0)); nil != err {
+		t.Fatal(err)
+	}
+	c.Inc(1)
+	if err := CSVOnce(config, time.Unix(110, 0)); nil != err {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, "requests;endpoint=_users.csv"))
+	if nil != err {
+		t.Fatal(err)
+	}
+	if want := "timestamp,count\n100,1\n110,2\n"; want != string(b) {
+		t.Errorf("requests: %q != %q\n", want, b)
+	}
+	b, err = ioutil.ReadFile(filepath.Join(dir, "latency.csv"))
+	if nil != err {
+		t.Fatal(err)
+	}
+	if want := "timestamp,count,min,max,"; want != string(b[:len(want)]) {
+		t.Errorf("latency: %q\n", b)
+	}
+}
+
+func TestCSVOnceMissingDir(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredCounter("foo", r)
+	if err := CSVOnce(CSVConfig{Registry: r, Dir: filepath.Join(t.TempDir(), "missing")}, time.Now()); nil == err {
+		t.Error("CSVOnce(): want error\n")
+	}
+}
@@ -0,0 +1,317 @@
+// Package datadog reports the metrics in a go-metrics Registry straight to the
+// Datadog series API over HTTP, for hosts without a Datadog agent to send
+// DogStatsD to.
+package datadog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+// DefaultURL is the series API of Datadog's US1 site.  Other sites have
+// their own, e.g. https://api.datadoghq.eu/api/v1/series.
+const DefaultURL = "https://api.datadoghq.com/api/v1/series"
+
+// DefaultRetryBackoff is how long a failed request waits before its first
+// retry, unless Config.RetryBackoff says otherwise.  Each later retry waits
+// twice as long as the one before.
+const DefaultRetryBackoff = time.Second
+
+// Types of series, as Datadog names them.
+const (
+	TypeGauge = "gauge"
+	TypeCount = "count"
+)
+
+// Config configures the Datadog reporter.
+type Config struct {
+	URL           string               // Series API URL, or DefaultURL if empty
+	APIKey        string               // API key, sent as the DD-API-KEY header
+	Registry      metrics.Registry     // Registry to be exported
+	FlushInterval time.Duration        // Flush interval, also the interval of counts
+	Prefix        string               // Prefix for every metric name, joined with a dot
+	Host          string               // Host of every series, if not empty
+	Tags          map[string]string    // Tags added to every series, which the metric's own tags override
+	Percentiles   []float64            // Percentiles to export from timers and histograms
+	LargeInts     metrics.Int64Coercer // Conversion of int64 values beyond ±2^53
+
+	// Schedule aligns the flushes of Run to multiples of FlushInterval
+	// and jitters them.
+	Schedule metrics.FlushSchedule
+
+	// MaxRetries is how many times a request which fails to connect, or
+	// which Datadog answers with a 429 or 5xx status, is sent again.
+	MaxRetries int
+
+	// RetryBackoff is how long the first retry waits, doubling for each
+	// retry after it.  Zero means DefaultRetryBackoff.
+	RetryBackoff time.Duration
+
+	// DisableCompression sends requests uncompressed rather than gzipped.
+	DisableCompression bool
+
+	Client *http.Client // Nil means http.DefaultClient
+
+	// OnError is called with the error of every flush of Run which fails,
+	// instead of logging it.
+	OnError func(error)
+
+	// Metrics, if set, records every Flush, counting the series of those
+	// which fail once the retries are exhausted as dropped.
+	Metrics *metrics.ReporterMetrics
+}
+
+// Series is one metric in a submission to the series API.
+type Series struct {
+	Metric   string       `json:"metric"`
+	Points   [][2]float64 `json:"points"`
+	Type     string       `json:"type,omitempty"`
+	Interval int64        `json:"interval,omitempty"`
+	Host     string       `json:"host,omitempty"`
+	Tags     []string     `json:"tags,omitempty"`
+}
+
+// Reporter sends the metrics in a registry to Datadog.  Counters and meters
+// are sent as counts of their change since the previous flush, gauges as
+// gauges, and histograms and timers, in milliseconds, as a count of what
+// they observed since the previous flush and gauges of their statistics.
+// Meters and timers also send their one-minute rates as gauges.
+type Reporter struct {
+	c      Config
+	mutex  sync.Mutex
+	counts map[string]int64
+	sleep  func(time.Duration)
+}
+
+// NewReporter returns a Reporter sending to c.URL.
+func NewReporter(c Config) *Reporter {
+	return &Reporter{c: c, counts: make(map[string]int64), sleep: time.Sleep}
+}
+
+// Datadog is a blocking exporter function which reports metrics in c.Registry
+// to Datadog every c.FlushInterval, passing errors to c.OnError, or logging
+// them, until c.Registry is closed.
+func Datadog(c Config) {
+	NewReporter(c).Run()
+}
+
+// Flush sends every metric once, retrying as configured.
+func (r *Reporter) Flush() error {
+	return r.c.Metrics.Flush(r.flush)
+}
+
+func (r *Reporter) flush() error {
+	series := r.series(time.Now())
+	if 0 == len(series) {
+		return nil
+	}
+	body, err := json.Marshal(struct {
+		Series []Series `json:"series"`
+	}{series})
+	if nil != err {
+		return err
+	}
+	if !r.c.DisableCompression {
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(body); nil != err {
+			return err
+		}
+		if err := w.Close(); nil != err {
+			return err
+		}
+		body = buf.Bytes()
+	}
+	backoff := r.c.RetryBackoff
+	if backoff <= 0 {
+		backoff = DefaultRetryBackoff
+	}
+	for retry := 0; ; retry++ {
+		var retryable bool
+		if retryable, err = r.post(body); nil == err || !retryable || retry >= r.c.MaxRetries {
+			if nil != err {
+				r.c.Metrics.Drop(len(series))
+			}
+			return err
+		}
+		r.sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// Run flushes every c.FlushInterval, passing errors to c.OnError, or logging
+// them, until c.Registry is closed.
+func (r *Reporter) Run() {
+	r.RunContext(context.Background())
+}
+
+// RunContext is Run until ctx is done, when it flushes a final time, with the
+// retries of any other flush, before returning.
+func (r *Reporter) RunContext(ctx context.Context) {
+	r.c.Schedule.RunContext(ctx, r.c.FlushInterval, metrics.Closed(r.c.Registry), func(time.Time) {
+		metrics.ReportError(r.c.OnError, r.Flush())
+	})
+}
+
+// post sends the body once, returning whether an error is worth retrying.
+func (r *Reporter) post(body []byte) (bool, error) {
+	u := r.c.URL
+	if "" == u {
+		u = DefaultURL
+	}
+	req, err := http.NewRequest("POST", u, bytes.NewReader(body))
+	if nil != err {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("DD-API-KEY", r.c.APIKey)
+	if !r.c.DisableCompression {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	client := r.c.Client
+	if nil == client {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if nil != err {
+		return true, err
+	}
+	defer resp.Body.Close()
+	respBody, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		err := fmt.Errorf("Datadog submission failed: %s %s", resp.Status, bytes.TrimSpace(respBody))
+		return http.StatusTooManyRequests == resp.StatusCode || resp.StatusCode >= 500, err
+	}
+	return false, nil
+}
+
+// series renders every metric in the registry, sorted by name.
+func (r *Reporter) series(now time.Time) []Series {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	ts := float64(now.Unix())
+	interval := int64(r.c.FlushInterval / time.Second)
+	var series []Series
+	seen := make(map[string]bool)
+	r.c.Registry.EachSnapshot(func(name string, i interface{}) {
+		base, tags := metrics.SplitTaggedName(name)
+		tagList := r.tags(tags)
+		add := func(field, typ string, v float64) {
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				return
+			}
+			s := Series{
+				Metric: r.name(base, field),
+				Points: [][2]float64{{ts, v}},
+				Type:   typ,
+				Host:   r.c.Host,
+				Tags:   tagList,
+			}
+			if TypeCount == typ {
+				s.Interval = interval
+			}
+			series = append(series, s)
+		}
+		count := func(field string, count int64) {
+			seen[name] = true
+			if delta := r.delta(name, count); 0 != delta {
+				add(field, TypeCount, r.c.LargeInts.Float64(delta))
+			}
+		}
+		switch metric := i.(type) {
+		case metrics.Counter:
+			count("", metric.Count())
+		case metrics.Gauge:
+			add("", TypeGauge, r.c.LargeInts.Float64(metric.Value()))
+		case metrics.GaugeFloat64:
+			add("", TypeGauge, metric.Value())
+		case metrics.MergeableGaugeFloat64:
+			add("", TypeGauge, metric.Value())
+		case metrics.Histogram:
+			count("count", metric.Count())
+			add("min", TypeGauge, r.c.LargeInts.Float64(metric.Min()))
+			add("max", TypeGauge, r.c.LargeInts.Float64(metric.Max()))
+			add("mean", TypeGauge, metric.Mean())
+			percentiles := metrics.MetricPercentiles(r.c.Percentiles, metric)
+			ps := metric.Percentiles(percentiles)
+			for i, p := range percentiles {
+				add(metrics.PercentileName(p), TypeGauge, ps[i])
+			}
+		case metrics.Meter:
+			count("count", metric.Count())
+			add("rate1", TypeGauge, metric.Rate1())
+		case metrics.Timer:
+			ms := float64(time.Millisecond)
+			count("count", metric.Count())
+			add("min", TypeGauge, r.c.LargeInts.Float64(metric.Min())/ms)
+			add("max", TypeGauge, r.c.LargeInts.Float64(metric.Max())/ms)
+			add("mean", TypeGauge, metric.Mean()/ms)
+			percentiles := metrics.MetricPercentiles(r.c.Percentiles, metric)
+			ps := metric.Percentiles(percentiles)
+			for i, p := range percentiles {
+				add(metrics.PercentileName(p), TypeGauge, ps[i]/ms)
+			}
+			add("rate1", TypeGauge, metric.Rate1())
+		}
+	})
+	for name := range r.counts {
+		if !seen[name] {
+			delete(r.counts, name)
+		}
+	}
+	sort.SliceStable(series, func(i, j int) bool { return series[i].Metric < series[j].Metric })
+	return series
+}
+
+// delta returns the change in the named count since the previous flush.
+func (r *Reporter) delta(name string, count int64) int64 {
+	delta := count - r.counts[name]
+	r.counts[name] = count
+	return delta
+}
+
+func (r *Reporter) name(name, field string) string {
+	if "" != r.c.Prefix {
+		name = r.c.Prefix + "." + name
+	}
+	if "" != field {
+		name += "." + field
+	}
+	return name
+}
+
+// tags merges the configured tags and the metric's, rendered as "key:value"
+// and sorted.  A tag with an empty value is rendered as its key alone.
+func (r *Reporter) tags(tags map[string]string) []string {
+	merged := make(map[string]string, len(r.c.Tags)+len(tags))
+	for k, v := range r.c.Tags {
+		merged[k] = v
+	}
+	for k, v := range tags {
+		merged[k] = v
+	}
+	list := make([]string, 0, len(merged))
+	for k, v := range merged {
+		if "" == v {
+			list = append(list, k)
+		} else {
+			list = append(list, k+":"+v)
+		}
+	}
+	sort.Strings(list)
+	if 0 == len(list) {
+		return nil
+	}
+	return list
+}
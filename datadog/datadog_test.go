@@ -0,0 +1,108 @@
+package datadog
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+func TestSeries(t *testing.T) {
+	reg := metrics.NewRegistry()
+	metrics.GetOrRegisterCounterT("hits", map[string]string{"endpoint": "/users"}, reg).Inc(3)
+	metrics.NewRegisteredGauge("depth", reg).Update(7)
+	r := NewReporter(Config{Registry: reg, FlushInterval: 10 * time.Second, Prefix: "app", Host: "h", Tags: map[string]string{"env": "prod", "canary": ""}})
+	now := time.Unix(100, 0)
+	want := []Series{
+		{Metric: "app.depth", Points: [][2]float64{{100, 7}}, Type: TypeGauge, Host: "h", Tags: []string{"canary", "env:prod"}},
+		{Metric: "app.hits", Points: [][2]float64{{100, 3}}, Type: TypeCount, Interval: 10, Host: "h", Tags: []string{"canary", "endpoint:/users", "env:prod"}},
+	}
+	if got := r.series(now); !reflect.DeepEqual(want, got) {
+		t.Errorf("series(): %+v != %+v\n", want, got)
+	}
+
+	// Counts are only sent when they change.
+	if got := r.series(now); 1 != len(got) || "app.depth" != got[0].Metric {
+		t.Errorf("series(): %+v\n", got)
+	}
+}
+
+func TestSeriesLargeInts(t *testing.T) {
+	reg := metrics.NewRegistry()
+	metrics.NewRegisteredGauge("bytes", reg).Update(1<<53 + 1)
+	lost := metrics.NewCounter()
+	r := NewReporter(Config{Registry: reg, LargeInts: metrics.Int64Coercer{Handling: metrics.LargeIntWarn, PrecisionLoss: lost}})
+	if got := r.series(time.Now()); 1 != len(got) || float64(1<<53) != got[0].Points[0][1] {
+		t.Errorf("series(): %+v\n", got)
+	}
+	if count := lost.Count(); 1 != count {
+		t.Errorf("lost.Count(): 1 != %v\n", count)
+	}
+}
+
+func TestFlush(t *testing.T) {
+	var got struct {
+		Series []Series `json:"series"`
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if "key" != req.Header.Get("DD-API-KEY") {
+			t.Errorf("DD-API-KEY: key != %q\n", req.Header.Get("DD-API-KEY"))
+		}
+		if "gzip" != req.Header.Get("Content-Encoding") {
+			t.Errorf("Content-Encoding: gzip != %q\n", req.Header.Get("Content-Encoding"))
+		}
+		body, err := gzip.NewReader(req.Body)
+		if nil != err {
+			t.Fatal(err)
+		}
+		if err := json.NewDecoder(body).Decode(&got); nil != err {
+			t.Fatal(err)
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+	reg := metrics.NewRegistry()
+	metrics.NewRegisteredGauge("depth", reg).Update(7)
+	if err := NewReporter(Config{URL: server.URL, APIKey: "key", Registry: reg}).Flush(); nil != err {
+		t.Fatal(err)
+	}
+	if 1 != len(got.Series) || "depth" != got.Series[0].Metric || 7 != got.Series[0].Points[0][1] {
+		t.Errorf("series: %+v\n", got.Series)
+	}
+}
+
+func TestFlushRetries(t *testing.T) {
+	statuses := []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusAccepted}
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(statuses[requests])
+		requests++
+	}))
+	defer server.Close()
+	reg := metrics.NewRegistry()
+	metrics.NewRegisteredGauge("depth", reg).Update(7)
+	r := NewReporter(Config{URL: server.URL, Registry: reg, MaxRetries: 2, RetryBackoff: time.Second})
+	var waits []time.Duration
+	r.sleep = func(d time.Duration) { waits = append(waits, d) }
+	if err := r.Flush(); nil != err {
+		t.Fatal(err)
+	}
+	if want := []time.Duration{time.Second, 2 * time.Second}; !reflect.DeepEqual(want, waits) {
+		t.Errorf("waits: %v != %v\n", want, waits)
+	}
+
+	// Client errors aren't retried.
+	requests, waits = 0, nil
+	statuses = []int{http.StatusForbidden}
+	if err := r.Flush(); nil == err {
+		t.Error("Flush(): want error\n")
+	}
+	if 1 != requests || 0 != len(waits) {
+		t.Errorf("requests: 1 != %v, waits: %v\n", requests, waits)
+	}
+}
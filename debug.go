@@ -22,8 +22,36 @@ var (
 // Capture new values for the Go garbage collector statistics exported in
 // debug.GCStats.  This is designed to be called as a goroutine.
 func CaptureDebugGCStats(r Registry, d time.Duration) {
-	for _ = range time.Tick(d) {
-		CaptureDebugGCStatsOnce(r)
+	CaptureDebugGCStatsPausable(r, d, nil)
+}
+
+// Capture new values for the Go garbage collector statistics exported in
+// debug.GCStats like CaptureDebugGCStats, but stop capturing while paused.
+// Sending true on pause pauses capturing, keeping the last values, and sending
+// false resumes it; closing pause resumes capturing for good.  Pauses of the
+// garbage collector which happened while paused aren't recorded.  It returns
+// once r is closed.  This is designed to be called as a goroutine.
+func CaptureDebugGCStatsPausable(r Registry, d time.Duration, pause <-chan bool) {
+	ticker := time.NewTicker(d)
+	defer ticker.Stop()
+	paused := false
+	for {
+		select {
+		case <-ticker.C:
+			if !paused {
+				CaptureDebugGCStatsOnce(r)
+			}
+		case p, ok := <-pause:
+			if !ok {
+				pause = nil
+			}
+			if paused && !p {
+				debug.ReadGCStats(&gcStats)
+			}
+			paused = p
+		case <-Closed(r):
+			return
+		}
 	}
 }
 
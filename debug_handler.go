@@ -0,0 +1,231 @@
+package metrics
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// DebugConfig provides a container with configuration parameters for
+// DebugHandlerWithConfig.
+type DebugConfig struct {
+	Registry     Registry      // Registry whose metrics are listed
+	DurationUnit time.Duration // Time conversion unit for timer durations
+}
+
+// DebugHandler returns an http.HandlerFunc rendering every metric in the
+// given registry as a table, for a human to look at on a page such as
+// /debug/metrics, with timer durations in milliseconds.  See
+// DebugHandlerWithConfig.
+func DebugHandler(r Registry) http.HandlerFunc {
+	return DebugHandlerWithConfig(DebugConfig{
+		Registry:     r,
+		DurationUnit: time.Millisecond,
+	})
+}
+
+// DebugHandlerWithConfig returns an http.HandlerFunc just like DebugHandler,
+// but it takes a DebugConfig instead.  Each metric is a row of its name,
+// tags, type, main value and other values.  The main value is the count of
+// counters, meters, histograms and timers, the value of gauges and the error
+// of healthchecks, which are checked.
+//
+// The table is HTML unless the query has format=text or the request accepts
+// text/plain but not text/html, in which case it's aligned plain text, as
+// suits curl.  It's sorted by name, or by main value with sort=value, and
+// in reverse with order=desc; the HTML table's headings link to each order.
+func DebugHandlerWithConfig(c DebugConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		r := c.Registry
+		if nil == r {
+			r = DefaultRegistry
+		}
+		du := c.DurationUnit
+		if 0 == du {
+			du = time.Nanosecond
+		}
+		query := req.URL.Query()
+		by, desc := query.Get("sort"), "desc" == query.Get("order")
+		rows := debugRows(r, float64(du))
+		sortDebugRows(rows, by, desc)
+		if debugWantsText(req) {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			writeDebugText(w, rows)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		debugTemplate.Execute(w, debugPage{
+			Unit:       du.String()[1:],
+			Rows:       rows,
+			NameOrder:  debugNextOrder("name", by, desc),
+			ValueOrder: debugNextOrder("value", by, desc),
+		})
+	}
+}
+
+type debugRow struct {
+	Name, Tags, Type, Value string
+	Fields                  string
+	key                     float64 // the main value, for sorting
+}
+
+// debugRows returns a row for each snapshot of a metric in r of one of the
+// standard types.
+func debugRows(r Registry, du float64) []debugRow {
+	var rows []debugRow
+	ps := RegistryPercentiles(r)
+	r.EachSnapshot(func(name string, i interface{}) {
+		base, tags := SplitTaggedName(name)
+		fields := metricLogFields(base, i, du, ps)
+		if len(fields) < 3 {
+			return
+		}
+		row := debugRow{
+			Name: base,
+			Tags: strings.TrimPrefix(tagSuffix(tags), ";"),
+			Type: fields[0].value.(string),
+		}
+		// The fields are the type, the name, the main value and the rest.
+		switch v := fields[2].value.(type) {
+		case int64:
+			row.Value, row.key = strconv.FormatInt(v, 10), float64(v)
+		case float64:
+			row.Value, row.key = formatDebugFloat(v), v
+		case string:
+			row.Value, row.key = v, 1
+		case nil:
+			row.Value = "ok"
+		}
+		var rest []string
+		for _, f := range fields[3:] {
+			rest = append(rest, f.key+"="+formatDebugValue(f.value))
+		}
+		row.Fields = strings.Join(rest, " ")
+		rows = append(rows, row)
+	})
+	return rows
+}
+
+// sortDebugRows sorts rows by name or, if by is "value", by main value and
+// then name.
+func sortDebugRows(rows []debugRow, by string, desc bool) {
+	var sorted sort.Interface = debugRowSlice{rows, "value" == by}
+	if desc {
+		sorted = sort.Reverse(sorted)
+	}
+	sort.Sort(sorted)
+}
+
+// debugRowSlice is a slice of debugRows that implements sort.Interface.
+type debugRowSlice struct {
+	rows    []debugRow
+	byValue bool
+}
+
+func (s debugRowSlice) Len() int { return len(s.rows) }
+
+func (s debugRowSlice) Less(i, j int) bool {
+	a, b := &s.rows[i], &s.rows[j]
+	if s.byValue && a.key != b.key {
+		return a.key < b.key
+	}
+	if a.Name != b.Name {
+		return a.Name < b.Name
+	}
+	return a.Tags < b.Tags
+}
+
+func (s debugRowSlice) Swap(i, j int) { s.rows[i], s.rows[j] = s.rows[j], s.rows[i] }
+
+// debugNextOrder returns the order a heading's link sorts by column in:
+// the reverse of the current order if the table is already sorted by it.
+func debugNextOrder(column, by string, desc bool) string {
+	if "" == by {
+		by = "name"
+	}
+	if column == by && !desc {
+		return "desc"
+	}
+	return "asc"
+}
+
+func debugWantsText(req *http.Request) bool {
+	switch req.URL.Query().Get("format") {
+	case "text":
+		return true
+	case "html":
+		return false
+	}
+	accept := req.Header.Get("Accept")
+	return strings.Contains(accept, "text/plain") && !strings.Contains(accept, "text/html")
+}
+
+func writeDebugText(w io.Writer, rows []debugRow) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tTAGS\tTYPE\tVALUE\tDETAILS")
+	for _, row := range rows {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", row.Name, row.Tags, row.Type, row.Value, row.Fields)
+	}
+	tw.Flush()
+}
+
+func formatDebugValue(v interface{}) string {
+	switch v := v.(type) {
+	case float64:
+		return formatDebugFloat(v)
+	case nil:
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+func formatDebugFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', 3, 64)
+}
+
+type debugPage struct {
+	Unit                  string
+	Rows                  []debugRow
+	NameOrder, ValueOrder string
+}
+
+var debugTemplate = template.Must(template.New("debug").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Metrics</title>
+<style>
+body { font-family: monospace; }
+table { border-collapse: collapse; }
+th, td { padding: 2px 8px; text-align: left; vertical-align: top; }
+tr:nth-child(even) { background: #f0f0f0; }
+td.value { text-align: right; }
+</style>
+</head>
+<body>
+<p>{{len .Rows}} metrics; timer durations in {{.Unit}}.  <a href="?format=text">Plain text</a></p>
+<table>
+<tr>
+<th><a href="?sort=name&amp;order={{.NameOrder}}">Name</a></th>
+<th>Tags</th>
+<th>Type</th>
+<th><a href="?sort=value&amp;order={{.ValueOrder}}">Value</a></th>
+<th>Details</th>
+</tr>
+{{range .Rows}}<tr>
+<td>{{.Name}}</td>
+<td>{{.Tags}}</td>
+<td>{{.Type}}</td>
+<td class="value">{{.Value}}</td>
+<td>{{.Fields}}</td>
+</tr>
+{{end}}</table>
+</body>
+</html>
+`))
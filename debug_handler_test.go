@@ -0,0 +1,62 @@
+package metrics
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func serveDebug(r Registry, target string) string {
+	w := httptest.NewRecorder()
+	DebugHandler(r)(w, httptest.NewRequest("GET", target, nil))
+	return w.Body.String()
+}
+
+func TestDebugHandlerText(t *testing.T) {
+	r := NewRegistry()
+	GetOrRegisterCounter("b", r).Inc(1)
+	GetOrRegisterCounterT("a", map[string]string{"host": "x"}, r).Inc(3)
+	GetOrRegisterGauge("c", r).Update(2)
+	r.Register("d", NewHealthcheck(func(h Healthcheck) { h.Unhealthy(errors.New("down")) }))
+
+	lines := strings.Split(strings.TrimSpace(serveDebug(r, "/debug/metrics?format=text")), "\n")
+	if 5 != len(lines) || !strings.HasPrefix(lines[0], "NAME") {
+		t.Fatalf("%q\n", lines)
+	}
+	for i, want := range []string{"a", "b", "c", "d"} {
+		if fields := strings.Fields(lines[i+1]); want != fields[0] {
+			t.Errorf("row %d: %v != %v\n", i, want, fields[0])
+		}
+	}
+	if fields := strings.Fields(lines[1]); "host=x" != fields[1] || "counter" != fields[2] || "3" != fields[3] {
+		t.Errorf("%q\n", lines[1])
+	}
+
+	lines = strings.Split(strings.TrimSpace(serveDebug(r, "/?format=text&sort=value&order=desc")), "\n")
+	for i, want := range []string{"a", "c", "d", "b"} {
+		if fields := strings.Fields(lines[i+1]); want != fields[0] {
+			t.Errorf("sorted by value, row %d: %v != %v\n", i, want, fields[0])
+		}
+	}
+}
+
+func TestDebugHandlerHTML(t *testing.T) {
+	r := NewRegistry()
+	GetOrRegisterTimer("<script>", r).Update(2e6)
+	w := httptest.NewRecorder()
+	DebugHandler(r)(w, httptest.NewRequest("GET", "/debug/metrics", nil))
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Fatal(ct)
+	}
+	body := w.Body.String()
+	if strings.Contains(body, "<script>") || !strings.Contains(body, "&lt;script&gt;") {
+		t.Errorf("name not escaped: %s\n", body)
+	}
+	if !strings.Contains(body, "max=2.000") {
+		t.Errorf("timer not in milliseconds: %s\n", body)
+	}
+	if !strings.Contains(body, "?sort=name&amp;order=desc") {
+		t.Errorf("no link reversing the order: %s\n", body)
+	}
+}
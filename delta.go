@@ -0,0 +1,97 @@
+package metrics
+
+import "time"
+
+// DeltaRegistry is a view of a registry for push backends, such as StatsD
+// and some InfluxDB pipelines, which expect counts per flush rather than
+// totals.  Each, EachSnapshot and Snapshot pass snapshots of the counters
+// and meters holding the change in count since the previous call, as tracked
+// by Registry.Delta under the view's consumer ID, and read-only snapshots of
+// every other metric whole.  Nothing is reset, so exporters scraping the
+// underlying registry still see totals.  Every other method passes through to
+// the underlying registry.
+//
+// Pass it to an exporter in place of the registry, and make a view for each
+// exporter, since each call moves its consumer on to the next flush.  Don't
+// combine it with an exporter's own CounterDelta emission, which would take
+// deltas of the deltas.
+type DeltaRegistry struct {
+	Registry
+	consumerID string
+}
+
+// NewDeltaRegistry returns a view of r which reports the counts of counters
+// and meters since the previous flush, tracked under consumerID, which must be
+// unique to the exporter.
+func NewDeltaRegistry(r Registry, consumerID string) *DeltaRegistry {
+	return &DeltaRegistry{Registry: r, consumerID: consumerID}
+}
+
+// Each calls f with a read-only snapshot of each registered metric, those of
+// counters and meters holding the change in count since the previous call.
+func (r *DeltaRegistry) Each(f func(string, interface{})) {
+	deltas := r.Registry.Delta(r.consumerID)
+	r.Registry.Each(func(key string, i interface{}) {
+		f(key, deltaSnapshot(i, deltas, key))
+	})
+}
+
+// EachSnapshot is Each with the underlying registry's default tags merged
+// into the names, as its EachSnapshot would.
+func (r *DeltaRegistry) EachSnapshot(f func(string, interface{})) {
+	eachSnapshot(r, f)
+}
+
+// GetAll returns the values of the snapshots Each would pass by field, keyed
+// by name.
+func (r *DeltaRegistry) GetAll() map[string]map[string]interface{} {
+	return getAll(r.EachSnapshot, RegistryPercentiles(r))
+}
+
+// Snapshot returns the snapshots Each would pass by name.
+func (r *DeltaRegistry) Snapshot() *RegistrySnapshot {
+	return newRegistrySnapshot(r)
+}
+
+// Subscribe watches every metric of the underlying registry, as its Subscribe
+// would.  Events carry counts rather than the changes in them Each reports,
+// and subscribing leaves the consumer's deltas alone.
+func (r *DeltaRegistry) Subscribe(match func(string) bool, interval time.Duration, buffer int) *Subscription {
+	return r.Registry.Subscribe(match, interval, buffer)
+}
+
+// deltaSnapshot returns a read-only copy of a metric, holding the change in
+// count from deltas, by key, if it's a counter or meter.  The copy is of the
+// metric's own snapshot, so that it keeps when that was taken and any tags it
+// carries, as a meter's does; a counter's tags are those of the metric, which
+// eachSnapshotOf names the copy by.  A metric with no delta was registered
+// since Delta was called, so this is its first flush and its delta is the
+// count itself.
+func deltaSnapshot(i interface{}, deltas map[string]int64, key string) interface{} {
+	switch m := i.(type) {
+	case Counter:
+		snapshot := m.Snapshot()
+		delta, ok := deltas[key]
+		if !ok {
+			return snapshot
+		}
+		if s, ok := snapshot.(CounterSnapshot); ok {
+			s.count = delta
+			return s
+		}
+		return NewCounterSnapshot(delta, SnapshotTime(snapshot, now()))
+	case Meter:
+		snapshot := m.Snapshot()
+		s, ok := snapshot.(*MeterSnapshot)
+		if !ok {
+			return snapshot
+		}
+		if delta, ok := deltas[key]; ok {
+			c := *s
+			c.count = delta
+			return &c
+		}
+		return s
+	}
+	return snapshotMetric(i)
+}
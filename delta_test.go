@@ -0,0 +1,130 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDeltaRegistry(t *testing.T) {
+	r := NewRegistry()
+	c := GetOrRegisterCounter("foo", r)
+	m := GetOrRegisterMeter("bar", r)
+	defer m.Stop()
+	g := GetOrRegisterGauge("baz", r)
+	d := NewDeltaRegistry(r, "test")
+
+	c.Inc(3)
+	m.Mark(2)
+	g.Update(47)
+	s := d.Snapshot()
+	if count := s.Get("foo").(Counter).Count(); 3 != count {
+		t.Errorf("foo: 3 != %v\n", count)
+	}
+	if count := s.Get("bar").(Meter).Count(); 2 != count {
+		t.Errorf("bar: 2 != %v\n", count)
+	}
+
+	c.Inc(1)
+	m.Mark(5)
+	s = d.Snapshot()
+	if count := s.Get("foo").(Counter).Count(); 1 != count {
+		t.Errorf("foo: 1 != %v\n", count)
+	}
+	if count := s.Get("bar").(Meter).Count(); 5 != count {
+		t.Errorf("bar: 5 != %v\n", count)
+	}
+	if value := s.Get("baz").(Gauge).Value(); 47 != value {
+		t.Errorf("baz: 47 != %v\n", value)
+	}
+
+	// The underlying registry keeps its totals.
+	if count := c.Count(); 4 != count {
+		t.Errorf("c.Count(): 4 != %v\n", count)
+	}
+	if count := m.Count(); 7 != count {
+		t.Errorf("m.Count(): 7 != %v\n", count)
+	}
+}
+
+func TestDeltaRegistryConsumers(t *testing.T) {
+	r := NewRegistry()
+	c := GetOrRegisterCounter("foo", r)
+	a, b := NewDeltaRegistry(r, "a"), NewDeltaRegistry(r, "b")
+	c.Inc(1)
+	a.Snapshot()
+	c.Inc(2)
+	if count := a.Snapshot().Get("foo").(Counter).Count(); 2 != count {
+		t.Errorf("a: 2 != %v\n", count)
+	}
+	if count := b.Snapshot().Get("foo").(Counter).Count(); 3 != count {
+		t.Errorf("b: 3 != %v\n", count)
+	}
+}
+
+func TestDeltaRegistryDefaultTags(t *testing.T) {
+	r := NewRegistry()
+	r.(*StandardRegistry).SetDefaultTags(map[string]string{"host": "a"})
+	c := GetOrRegisterCounter("foo", r)
+	d := NewDeltaRegistry(r, "test")
+	c.Inc(1)
+	d.Snapshot()
+	c.Inc(1)
+	var count int64 = -1
+	d.EachSnapshot(func(name string, i interface{}) {
+		if "foo;host=a" == name {
+			count = i.(Counter).Count()
+		}
+	})
+	if 1 != count {
+		t.Errorf("foo;host=a: 1 != %v\n", count)
+	}
+}
+
+func TestDeltaRegistryRetagged(t *testing.T) {
+	r := NewRegistry()
+	c := GetOrRegisterCounterT("foo", map[string]string{"a": "1"}, r)
+	d := NewDeltaRegistry(r, "test")
+	c.Inc(10)
+	d.Snapshot()
+	c.(Taggable).SetTags(map[string]string{"a": "2"})
+	for _, inc := range []int64{5, 3} {
+		c.Inc(inc)
+		s := d.Snapshot()
+		if names := s.Names(); 1 != len(names) || "foo;a=2" != names[0] {
+			t.Fatalf("s.Names(): [foo;a=2] != %v\n", names)
+		}
+		if count := s.Get("foo;a=2").(Counter).Count(); inc != count {
+			t.Errorf("foo;a=2: %v != %v\n", inc, count)
+		}
+	}
+}
+
+func TestDeltaRegistryKeepsTags(t *testing.T) {
+	clock := &stepClock{now: time.Unix(100, 0)}
+	SetClock(clock)
+	defer SetClock(nil)
+	r := NewRegistry()
+	c := GetOrRegisterCounterT("foo", map[string]string{"a": "1"}, r)
+	c.(DynamicTaggable).AddDynamicTag("version", func() string { return "1.0" })
+	m := GetOrRegisterMeterT("bar", map[string]string{"a": "1"}, r)
+	defer m.Stop()
+	d := NewDeltaRegistry(r, "test")
+	c.Inc(3)
+	m.Mark(3)
+	d.Snapshot()
+	c.Inc(1)
+	m.Mark(2)
+	clock.now = clock.now.Add(time.Second)
+	s := d.Snapshot()
+	counter, ok := s.Get("foo;a=1;version=1.0").(CounterSnapshot)
+	if !ok {
+		t.Fatalf("s.Names(): %v\n", s.Names())
+	}
+	if 1 != counter.Count() || !clock.now.Equal(counter.Timestamp()) {
+		t.Errorf("foo: 1 at %v != %v at %v\n", clock.now, counter.Count(), counter.Timestamp())
+	}
+	meter := s.Get("bar;a=1").(*MeterSnapshot)
+	if 2 != meter.Count() || "1" != meter.GetTags()["a"] {
+		t.Errorf("bar: 2 with a=1 != %v with %v\n", meter.Count(), meter.GetTags())
+	}
+}
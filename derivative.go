@@ -0,0 +1,110 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+)
+
+// GetOrRegisterDerivativeGauge returns an existing GaugeFloat64 or constructs
+// and registers a new DerivativeGauge of the given metric.  The metric is only
+// kept if the gauge is new.
+func GetOrRegisterDerivativeGauge(name string, r Registry, c Countable) GaugeFloat64 {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	return getOrRegister(r, name, func() GaugeFloat64 { return NewDerivativeGauge(c) }, NilGaugeFloat64{}).(GaugeFloat64)
+}
+
+// GetOrRegisterDerivativeGaugeT returns the existing GaugeFloat64 identified
+// by name and tags together or constructs and registers a new DerivativeGauge
+// carrying the tags; see GetOrRegisterCounterT.
+func GetOrRegisterDerivativeGaugeT(name string, tags map[string]string, r Registry, c Countable) GaugeFloat64 {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	return getOrRegisterTagged(r, name, tags, func() interface{} { return NewDerivativeGauge(c) }, NilGaugeFloat64{}).(GaugeFloat64)
+}
+
+// NewDerivativeGauge constructs a new DerivativeGauge of the given metric,
+// whose first rate is that since now.
+func NewDerivativeGauge(c Countable) GaugeFloat64 {
+	if useNilMetrics() {
+		return NilGaugeFloat64{}
+	}
+	return &DerivativeGauge{countable: c, count: c.Count(), time: now()}
+}
+
+// NewRegisteredDerivativeGauge constructs and registers a new DerivativeGauge
+// of the given metric.
+func NewRegisteredDerivativeGauge(name string, r Registry, c Countable) GaugeFloat64 {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	if usesNilMetrics(r) {
+		return NilGaugeFloat64{}
+	}
+	g := NewDerivativeGauge(c)
+	r.Register(name, g)
+	return g
+}
+
+// DerivativeGauge is a GaugeFloat64 whose value is the per-second rate at
+// which the count of a metric, usually a Counter, grew between the last two
+// snapshots of the gauge, so that a counter keeps its use once exported to a
+// backend with no rate function, such as plain Graphite.  Reporters snapshot
+// every metric on each flush, so the rate is that over the last flush
+// interval, provided only one reporter reports the gauge; two sharing it
+// would each see rates over the time since the other flushed.
+//
+// A count lower than the last one is taken to be a reset, e.g. by Clear, and
+// the rate is that of the whole of the new count.  Value returns the rate
+// worked out by the last snapshot without taking another.
+type DerivativeGauge struct {
+	tagSet
+
+	countable Countable
+
+	mutex sync.Mutex
+	count int64     // the count at the last snapshot
+	time  time.Time // the time of the last snapshot
+	rate  float64
+}
+
+// Snapshot works out the rate since the last snapshot and returns a read-only
+// copy of it.
+func (g *DerivativeGauge) Snapshot() GaugeFloat64 {
+	t := now()
+	return GaugeFloat64Snapshot{value: g.update(t), timestamp: t}
+}
+
+// Update panics.
+func (*DerivativeGauge) Update(float64) {
+	panic("Update called on a DerivativeGauge")
+}
+
+// Value returns the rate worked out by the last snapshot, or zero before the
+// first.
+func (g *DerivativeGauge) Value() float64 {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return g.rate
+}
+
+// update works out the rate from the last snapshot to t and returns it.  The
+// rate is left as it was if no time has passed.
+func (g *DerivativeGauge) update(t time.Time) float64 {
+	count := g.countable.Count()
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	elapsed := t.Sub(g.time)
+	if elapsed <= 0 {
+		return g.rate
+	}
+	delta := count - g.count
+	if delta < 0 {
+		delta = count
+	}
+	g.rate = float64(delta) / elapsed.Seconds()
+	g.count, g.time = count, t
+	return g.rate
+}
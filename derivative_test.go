@@ -0,0 +1,51 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDerivativeGauge(t *testing.T) {
+	c := NewCounter()
+	c.Inc(5)
+	g := NewDerivativeGauge(c).(*DerivativeGauge)
+	start := g.time
+	if v := g.Value(); 0 != v {
+		t.Errorf("g.Value(): 0 != %v\n", v)
+	}
+	c.Inc(20)
+	if v := g.update(start.Add(10 * time.Second)); 2 != v {
+		t.Errorf("g.update(): 2 != %v\n", v)
+	}
+	c.Inc(5)
+	if v := g.Value(); 2 != v {
+		t.Errorf("g.Value(): 2 != %v\n", v)
+	}
+	if v := g.update(start.Add(15 * time.Second)); 1 != v {
+		t.Errorf("g.update(): 1 != %v\n", v)
+	}
+	if v := g.update(start.Add(15 * time.Second)); 1 != v {
+		t.Errorf("g.update() with no time passed: 1 != %v\n", v)
+	}
+	c.Clear()
+	c.Inc(3)
+	if v := g.update(start.Add(18 * time.Second)); 1 != v {
+		t.Errorf("g.update() after a reset: 1 != %v\n", v)
+	}
+}
+
+func TestGetOrRegisterDerivativeGaugeT(t *testing.T) {
+	r := NewRegistry()
+	c := GetOrRegisterCounter("requests", r)
+	tags := map[string]string{"service": "users"}
+	g := GetOrRegisterDerivativeGaugeT("requests.rate", tags, r, c)
+	if _, ok := r.Get("requests.rate;service=users").(*DerivativeGauge); !ok {
+		t.Fatal(r.Get("requests.rate;service=users"))
+	}
+	if g2 := GetOrRegisterDerivativeGaugeT("requests.rate", tags, r, NewCounter()); g2 != g {
+		t.Error(g2)
+	}
+	if _, ok := r.Snapshot().Get("requests.rate;service=users").(GaugeFloat64Snapshot); !ok {
+		t.Error(r.Snapshot().Get("requests.rate;service=users"))
+	}
+}
@@ -0,0 +1,76 @@
+package metrics
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// DisableHandler returns an http.HandlerFunc through which an administrator
+// disables and enables metrics of the given registry, or DefaultRegistry if
+// it's nil, at runtime.  A POST disables the metrics a selector selects and a
+// DELETE enables them again, both responding 204 No Content; the selector is
+// given by the query parameters name, the base name, and tag, once per tag as
+// "key:value", e.g. "?name=db.query&tag=table:users".  A GET responds with the
+// selectors disabling metrics, as a JSON array of their Strings.  Requests
+// without the token, as "Authorization: Bearer <token>", get 403 Forbidden, as
+// do all requests if the token is empty; see ResetHandler.
+func DisableHandler(r *StandardRegistry, token string) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if !authorized(req, token) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		registry := r
+		if nil == registry {
+			var ok bool
+			if registry, ok = DefaultRegistry.(*StandardRegistry); !ok {
+				http.Error(w, "DefaultRegistry isn't a *StandardRegistry", http.StatusInternalServerError)
+				return
+			}
+		}
+		switch req.Method {
+		case http.MethodGet:
+			selectors := []string{}
+			for _, s := range registry.Disabled() {
+				selectors = append(selectors, s.String())
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(selectors)
+		case http.MethodPost, http.MethodDelete:
+			s, err := selectorFromQuery(req)
+			if nil != err {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if http.MethodPost == req.Method {
+				registry.Disable(s)
+			} else {
+				registry.Enable(s)
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.Header().Set("Allow", "GET, POST, DELETE")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// selectorFromQuery parses the MetricSelector given by a request's query
+// parameters for DisableHandler.
+func selectorFromQuery(req *http.Request) (MetricSelector, error) {
+	q := req.URL.Query()
+	s := MetricSelector{Name: q.Get("name")}
+	for _, tag := range q["tag"] {
+		i := strings.Index(tag, ":")
+		if i <= 0 {
+			return MetricSelector{}, fmt.Errorf("tag %q isn't key:value", tag)
+		}
+		if nil == s.Tags {
+			s.Tags = make(map[string]string)
+		}
+		s.Tags[tag[:i]] = tag[i+1:]
+	}
+	return s, nil
+}
@@ -0,0 +1,51 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDisableHandler(t *testing.T) {
+	r := NewRegistry().(*StandardRegistry)
+	GetOrRegisterTimer("db.query;table=users", r)
+	h := DisableHandler(r, "secret")
+	do := func(method, target, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		if "" != token {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		h(w, req)
+		return w
+	}
+
+	if w := do("POST", "/admin/metrics?name=db.query", "wrong"); http.StatusForbidden != w.Code {
+		t.Errorf("POST with the wrong token: %d != %d\n", http.StatusForbidden, w.Code)
+	}
+	if w := do("POST", "/admin/metrics?tag=table", "secret"); http.StatusBadRequest != w.Code {
+		t.Errorf("POST with a bad tag: %d != %d\n", http.StatusBadRequest, w.Code)
+	}
+	if w := do("PUT", "/admin/metrics", "secret"); http.StatusMethodNotAllowed != w.Code {
+		t.Errorf("PUT: %d != %d\n", http.StatusMethodNotAllowed, w.Code)
+	}
+	if w := do("POST", "/admin/metrics?name=db.query&tag=table:users", "secret"); http.StatusNoContent != w.Code {
+		t.Errorf("POST: %d != %d\n", http.StatusNoContent, w.Code)
+	}
+	if _, ok := r.Get("db.query;table=users").(NilTimer); !ok {
+		t.Errorf("Get(): %T, want NilTimer\n", r.Get("db.query;table=users"))
+	}
+	if w := do("GET", "/admin/metrics", "secret"); `["db.query;table=users"]` != strings.TrimSpace(w.Body.String()) {
+		t.Errorf("GET: %s\n", w.Body.String())
+	}
+	if w := do("DELETE", "/admin/metrics?name=db.query&tag=table:users", "secret"); http.StatusNoContent != w.Code {
+		t.Errorf("DELETE: %d != %d\n", http.StatusNoContent, w.Code)
+	}
+	if _, ok := r.Get("db.query;table=users").(*StandardTimer); !ok {
+		t.Errorf("Get(): %T, want *StandardTimer\n", r.Get("db.query;table=users"))
+	}
+	if w := do("GET", "/admin/metrics", "secret"); "[]" != strings.TrimSpace(w.Body.String()) {
+		t.Errorf("GET: %s\n", w.Body.String())
+	}
+}
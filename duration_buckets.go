@@ -0,0 +1,105 @@
+package metrics
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// DefaultDurationBounds are the bucket bounds of DurationBuckets constructed
+// with none, those the Prometheus client libraries default to.
+var DefaultDurationBounds = []time.Duration{
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// DurationBuckets counts durations in the series of a Prometheus classic
+// histogram, made of plain counters, for backends which can't ingest
+// histograms or summaries but can sum counters and compute quantiles from
+// them.  For a name of "requests" these are
+//
+//	requests_bucket;le=0.1   durations of at most 100ms, one per bound
+//	requests_bucket;le=+Inf  every duration
+//	requests_count           every duration, too
+//	requests_sum             the sum of the durations, a CounterFloat64
+//
+// with bounds and sums in seconds.  The buckets are cumulative: a duration is
+// counted in the bucket of every bound it doesn't exceed.  Every series is
+// registered on construction, so that each bucket is reported even before
+// it's counted anything.
+type DurationBuckets struct {
+	bounds  []time.Duration
+	buckets []Counter // one per bound, then +Inf
+	count   Counter
+	sum     CounterFloat64
+}
+
+// NewDurationBuckets constructs a new DurationBuckets whose counters are
+// named after name, carry the given tags and are registered in r, or
+// DefaultRegistry if r is nil, with GetOrRegisterCounterT, so that constructing
+// one with the same name and tags again counts in the same series.  Nil bounds
+// mean DefaultDurationBounds.  Bounds must be strictly ascending and
+// NewDurationBuckets panics if they aren't.
+func NewDurationBuckets(name string, tags map[string]string, bounds []time.Duration, r Registry) *DurationBuckets {
+	if nil == bounds {
+		bounds = DefaultDurationBounds
+	}
+	for i := 1; i < len(bounds); i++ {
+		if bounds[i] <= bounds[i-1] {
+			panic(fmt.Errorf("bucket bounds not ascending: %v after %v", bounds[i], bounds[i-1]))
+		}
+	}
+	if nil == r {
+		r = DefaultRegistry
+	}
+	b := &DurationBuckets{
+		bounds:  append([]time.Duration(nil), bounds...),
+		buckets: make([]Counter, len(bounds)+1),
+		count:   GetOrRegisterCounterT(name+"_count", tags, r),
+		sum:     GetOrRegisterCounterFloat64T(name+"_sum", tags, r),
+	}
+	le := make(map[string]string, len(tags)+1)
+	for k, v := range tags {
+		le[k] = v
+	}
+	for i, bound := range b.bounds {
+		le["le"] = strconv.FormatFloat(bound.Seconds(), 'g', -1, 64)
+		b.buckets[i] = GetOrRegisterCounterT(name+"_bucket", le, r)
+	}
+	le["le"] = "+Inf"
+	b.buckets[len(b.bounds)] = GetOrRegisterCounterT(name+"_bucket", le, r)
+	return b
+}
+
+// Time records the duration of the execution of the given function.
+func (b *DurationBuckets) Time(f func()) {
+	ts := now()
+	f()
+	b.Update(since(ts))
+}
+
+// Update counts the duration d in the bucket of every bound it doesn't
+// exceed and in the count and sum.
+func (b *DurationBuckets) Update(d time.Duration) {
+	i := sort.Search(len(b.bounds), func(i int) bool { return d <= b.bounds[i] })
+	for _, c := range b.buckets[i:] {
+		c.Inc(1)
+	}
+	b.count.Inc(1)
+	b.sum.Inc(d.Seconds())
+}
+
+// UpdateSince counts the time elapsed since ts, by the clock set by SetClock.
+func (b *DurationBuckets) UpdateSince(ts time.Time) {
+	b.Update(since(ts))
+}
@@ -0,0 +1,51 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDurationBuckets(t *testing.T) {
+	r := NewRegistry()
+	tags := map[string]string{"route": "/users"}
+	b := NewDurationBuckets("requests", tags, []time.Duration{100 * time.Millisecond, 500 * time.Millisecond}, r)
+	for _, d := range []time.Duration{50 * time.Millisecond, 100 * time.Millisecond, 200 * time.Millisecond, time.Second} {
+		b.Update(d)
+	}
+	for le, want := range map[string]int64{"0.1": 2, "0.5": 3, "+Inf": 4} {
+		name := TaggedName("requests_bucket", map[string]string{"route": "/users", "le": le})
+		if c, ok := r.Get(name).(Counter); !ok || want != c.Count() {
+			t.Errorf("%s: %v != %v\n", name, want, r.Get(name))
+		}
+	}
+	if c := GetOrRegisterCounterT("requests_count", tags, r); 4 != c.Count() {
+		t.Errorf("requests_count: 4 != %v\n", c.Count())
+	}
+	if c := GetOrRegisterCounterFloat64T("requests_sum", tags, r); 1.35 != c.Count() {
+		t.Errorf("requests_sum: 1.35 != %v\n", c.Count())
+	}
+	if n := r.Snapshot().Len(); 5 != n {
+		t.Errorf("r.Snapshot().Len(): 5 != %v\n", n)
+	}
+}
+
+func TestDurationBucketsShared(t *testing.T) {
+	r := NewRegistry()
+	NewDurationBuckets("requests", nil, nil, r).Update(time.Millisecond)
+	NewDurationBuckets("requests", nil, nil, r).Update(time.Millisecond)
+	if c := r.Get("requests_bucket;le=0.005").(Counter); 2 != c.Count() {
+		t.Errorf("requests_bucket;le=0.005: 2 != %v\n", c.Count())
+	}
+	if n := r.Snapshot().Len(); len(DefaultDurationBounds)+3 != n {
+		t.Errorf("r.Snapshot().Len(): %v != %v\n", len(DefaultDurationBounds)+3, n)
+	}
+}
+
+func TestDurationBucketsNotAscending(t *testing.T) {
+	defer func() {
+		if nil == recover() {
+			t.Error("NewDurationBuckets(): no panic\n")
+		}
+	}()
+	NewDurationBuckets("requests", nil, []time.Duration{time.Second, time.Second}, NewRegistry())
+}
@@ -0,0 +1,118 @@
+package metrics
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// CounterEmission selects the forms in which an exporter emits each counter.
+// The flags may be combined, e.g. CounterCumulative|CounterRate, to satisfy
+// consumers with different expectations of counter semantics from a single
+// exporter.  The zero value emits the cumulative count alone.
+type CounterEmission int
+
+const (
+	// CounterCumulative emits the count itself, suffixed "count".
+	CounterCumulative CounterEmission = 1 << iota
+
+	// CounterDelta emits the change in count since the exporter's previous
+	// flush, suffixed "delta".
+	CounterDelta
+
+	// CounterRate emits the change in count since the exporter's previous
+	// flush divided by the seconds elapsed since it, suffixed "rate".  The
+	// first flush, whose change is the count since startup, emits no rate.
+	CounterRate
+)
+
+// counterEmitter computes the forms of each counter in a registry to be
+// emitted during one flush.
+type counterEmitter struct {
+	emission CounterEmission
+	deltas   map[string]int64
+	interval float64
+}
+
+// newCounterEmitter returns a counterEmitter for one flush of r.  Deltas are
+// tracked by Registry.Delta under the given consumer ID, which must be unique
+// to the exporter, and are only computed and emitted if aggregate is true, so
+// that they cover whole aggregation intervals.  Rates are per second elapsed
+// since the consumer's previous call to Delta, or of interval if r isn't
+// built on a StandardRegistry, which records when that was.
+func newCounterEmitter(r Registry, emission CounterEmission, consumerID string, interval time.Duration, aggregate bool) *counterEmitter {
+	if 0 == emission {
+		emission = CounterCumulative
+	}
+	if !aggregate {
+		emission &^= CounterDelta | CounterRate
+	}
+	ce := &counterEmitter{emission: emission, interval: interval.Seconds()}
+	if 0 != emission&(CounterDelta|CounterRate) {
+		ce.deltas = r.Delta(consumerID)
+		// Flushes may be late or fail, so rates are over the time which
+		// actually elapsed since the consumer's previous flush.
+		if last, ok := lastDelta(r, consumerID); ok {
+			ce.interval = last.elapsed.Seconds()
+		}
+	}
+	return ce
+}
+
+// aggregationWindow returns the interval over which deltas and rates are
+// aggregated and whether a flush at the given time begins an aggregation
+// window, i.e. falls in a later window than the consumer's last flush which
+// aggregated, as recorded by Registry.Delta.  Windows are aligned to the clock,
+// and comparing them rather than looking for a flush just after a boundary
+// means that a late flush still begins its window.  The consumer's first flush
+// begins one, as does every flush without an aggregation interval.  If r isn't
+// built on a StandardRegistry, which records the flushes, a flush in the first
+// flush interval of a window begins it.
+func aggregationWindow(r Registry, consumerID string, now time.Time, flushInterval, aggregationInterval time.Duration) (time.Duration, bool) {
+	if 0 == aggregationInterval {
+		return flushInterval, true
+	}
+	if nil == standardRegistryOf(r) {
+		return aggregationInterval, now.Sub(now.Truncate(aggregationInterval)) < flushInterval
+	}
+	last, ok := lastDelta(r, consumerID)
+	return aggregationInterval, !ok || !last.at.Truncate(aggregationInterval).Equal(now.Truncate(aggregationInterval))
+}
+
+// validateAggregationInterval returns an error unless the aggregation interval
+// is unset or a positive multiple of the flush interval.
+func validateAggregationInterval(flushInterval, aggregationInterval time.Duration) error {
+	if 0 == aggregationInterval {
+		return nil
+	}
+	if flushInterval <= 0 || aggregationInterval < 0 || 0 != aggregationInterval%flushInterval {
+		return fmt.Errorf("aggregation interval %v is not a multiple of flush interval %v", aggregationInterval, flushInterval)
+	}
+	return nil
+}
+
+// emit calls f with the suffix and formatted value of each form of the counter
+// registered under the given key, as passed by eachSnapshotOf, to be emitted.
+// The key, unlike the name the counter is reported under, doesn't change with
+// its tags.  Rates are omitted if the interval since the previous flush is
+// unknown, as on the first.
+func (ce *counterEmitter) emit(key string, c Counter, f func(string, string)) {
+	count := c.Count()
+	if 0 != ce.emission&CounterCumulative {
+		f("count", strconv.FormatInt(count, 10))
+	}
+	if 0 == ce.emission&(CounterDelta|CounterRate) {
+		return
+	}
+	delta, ok := ce.deltas[key]
+	if !ok {
+		// Registered since Delta was called, so this is its first flush.
+		delta = count
+	}
+	if 0 != ce.emission&CounterDelta {
+		f("delta", strconv.FormatInt(delta, 10))
+	}
+	if 0 != ce.emission&CounterRate && ce.interval > 0 {
+		f("rate", strconv.FormatFloat(float64(delta)/ce.interval, 'f', 2, 64))
+	}
+}
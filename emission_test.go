@@ -0,0 +1,164 @@
+package metrics
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func emitted(ce *counterEmitter, name string, c Counter) map[string]string {
+	values := make(map[string]string)
+	ce.emit(name, c, func(suffix, v string) { values[suffix] = v })
+	return values
+}
+
+func TestCounterEmissionDefault(t *testing.T) {
+	r := NewRegistry()
+	c := NewRegisteredCounter("foo", r)
+	c.Inc(47)
+	values := emitted(newCounterEmitter(r, 0, "test", time.Second, true), "foo", c)
+	if 1 != len(values) || "47" != values["count"] {
+		t.Fatal(values)
+	}
+}
+
+func TestCounterEmissionCombined(t *testing.T) {
+	clock := &stepClock{now: time.Unix(100, 0)}
+	SetClock(clock)
+	defer SetClock(nil)
+	r := NewRegistry()
+	c := NewRegisteredCounter("foo", r)
+	emission := CounterCumulative | CounterDelta | CounterRate
+	c.Inc(10)
+	newCounterEmitter(r, emission, "test", 2*time.Second, true)
+	c.Inc(5)
+	clock.now = clock.now.Add(2 * time.Second)
+	values := emitted(newCounterEmitter(r, emission, "test", 2*time.Second, true), "foo", c)
+	if "15" != values["count"] {
+		t.Errorf("count: 15 != %v\n", values["count"])
+	}
+	if "5" != values["delta"] {
+		t.Errorf("delta: 5 != %v\n", values["delta"])
+	}
+	if "2.50" != values["rate"] {
+		t.Errorf("rate: 2.50 != %v\n", values["rate"])
+	}
+}
+
+func TestCounterEmissionDefaultTags(t *testing.T) {
+	r := NewRegistry()
+	r.(*StandardRegistry).SetDefaultTags(map[string]string{"host": "a"})
+	c := NewRegisteredCounter("foo", r)
+	c.Inc(10)
+	newCounterEmitter(r, CounterDelta, "test", time.Second, true)
+	c.Inc(5)
+	var values map[string]string
+	ce := newCounterEmitter(r, CounterDelta, "test", time.Second, true)
+	eachSnapshotOf(r, func(key, _ string, i, _ interface{}) {
+		values = emitted(ce, key, i.(Counter))
+	})
+	if "5" != values["delta"] {
+		t.Errorf("delta: 5 != %v\n", values["delta"])
+	}
+}
+
+func TestCounterEmissionRetagged(t *testing.T) {
+	r := NewRegistry()
+	c := GetOrRegisterCounterT("foo", map[string]string{"a": "1"}, r)
+	c.Inc(10)
+	newCounterEmitter(r, CounterDelta, "test", time.Second, true)
+	c.(Taggable).SetTags(map[string]string{"a": "2"})
+	for _, inc := range []int64{5, 3} {
+		c.Inc(inc)
+		values := make(map[string]string)
+		ce := newCounterEmitter(r, CounterDelta, "test", time.Second, true)
+		eachSnapshotOf(r, func(key, name string, i, _ interface{}) {
+			if "foo;a=2" != name {
+				t.Errorf("name: foo;a=2 != %v\n", name)
+			}
+			ce.emit(key, i.(Counter), func(suffix, v string) { values[suffix] = v })
+		})
+		if want := strconv.FormatInt(inc, 10); want != values["delta"] {
+			t.Errorf("delta: %v != %v\n", want, values["delta"])
+		}
+	}
+}
+
+func TestCounterEmissionRateWithoutInterval(t *testing.T) {
+	r := NewRegistry()
+	c := NewRegisteredCounter("foo", r)
+	c.Inc(47)
+	values := emitted(newCounterEmitter(r, CounterDelta|CounterRate, "test", 0, true), "foo", c)
+	if 1 != len(values) || "47" != values["delta"] {
+		t.Fatal(values)
+	}
+}
+
+func TestCounterEmissionRateOverElapsedTime(t *testing.T) {
+	clock := &stepClock{now: time.Unix(100, 0)}
+	SetClock(clock)
+	defer SetClock(nil)
+	r := NewRegistry()
+	c := NewRegisteredCounter("foo", r)
+	c.Inc(10)
+	values := emitted(newCounterEmitter(r, CounterDelta|CounterRate, "test", time.Second, true), "foo", c)
+	if 1 != len(values) || "10" != values["delta"] {
+		t.Fatalf("first flush: %v\n", values)
+	}
+	c.Inc(8)
+	clock.now = clock.now.Add(4 * time.Second) // a late flush
+	values = emitted(newCounterEmitter(r, CounterDelta|CounterRate, "test", time.Second, true), "foo", c)
+	if "8" != values["delta"] || "2.00" != values["rate"] {
+		t.Errorf("late flush: 8 at 2.00 != %v at %v\n", values["delta"], values["rate"])
+	}
+}
+
+func TestCounterEmissionBetweenAggregationBoundaries(t *testing.T) {
+	r := NewRegistry()
+	c := NewRegisteredCounter("foo", r)
+	emission := CounterCumulative | CounterDelta
+	c.Inc(10)
+	newCounterEmitter(r, emission, "test", time.Minute, true)
+	c.Inc(5)
+	values := emitted(newCounterEmitter(r, emission, "test", time.Minute, false), "foo", c)
+	if 1 != len(values) || "15" != values["count"] {
+		t.Fatal(values)
+	}
+	c.Inc(5)
+	values = emitted(newCounterEmitter(r, emission, "test", time.Minute, true), "foo", c)
+	if "10" != values["delta"] {
+		t.Errorf("delta: 10 != %v\n", values["delta"])
+	}
+}
+
+func TestAggregationWindow(t *testing.T) {
+	clock := &stepClock{now: time.Unix(1200, 0)}
+	SetClock(clock)
+	defer SetClock(nil)
+	r := NewRegistry()
+	NewRegisteredCounter("foo", r)
+	var boundaries []int
+	// Flushes every 10s, 3s into each interval, the sixth late by 9s so
+	// that it's the first of its window, 60s after the window began.
+	for i := 0; i < 12; i++ {
+		clock.now = time.Unix(1200, 0).Add(time.Duration(i)*10*time.Second + 3*time.Second)
+		if 6 == i {
+			clock.now = clock.now.Add(9 * time.Second)
+		}
+		interval, boundary := aggregationWindow(r, "test", clock.now, 10*time.Second, time.Minute)
+		if time.Minute != interval {
+			t.Fatal(interval)
+		}
+		if boundary {
+			boundaries = append(boundaries, i)
+			newCounterEmitter(r, CounterDelta, "test", interval, true)
+		}
+	}
+	if want := []int{0, 6}; !reflect.DeepEqual(want, boundaries) {
+		t.Errorf("boundaries: %v != %v\n", want, boundaries)
+	}
+	if interval, boundary := aggregationWindow(r, "test", clock.now, 10*time.Second, 0); 10*time.Second != interval || !boundary {
+		t.Fatal(interval, boundary)
+	}
+}
@@ -0,0 +1,131 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"time"
+)
+
+// An Encoder renders a snapshot of a registry, taken at the given time, in
+// some output format.  Adding a format only takes an Encoder; an
+// EncodingReporter does the snapshotting, scheduling and writing.
+type Encoder interface {
+	Encode(s *RegistrySnapshot, now time.Time) ([]byte, error)
+}
+
+// EncoderFunc is an Encoder of an ordinary function.
+type EncoderFunc func(s *RegistrySnapshot, now time.Time) ([]byte, error)
+
+// Encode calls f(s, now).
+func (f EncoderFunc) Encode(s *RegistrySnapshot, now time.Time) ([]byte, error) {
+	return f(s, now)
+}
+
+// JSONEncoder encodes snapshots as one JSON object per line, as WriteJSON
+// writes them.
+type JSONEncoder struct {
+	Percentiles []float64 // Percentiles of histograms and timers, or nil for the registry's
+}
+
+// Encode renders s as JSON followed by a newline.
+func (e JSONEncoder) Encode(s *RegistrySnapshot, _ time.Time) ([]byte, error) {
+	b, err := marshalJSON(s.Each, s.reportedPercentiles(e.Percentiles))
+	if nil != err {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
+// TextEncoder encodes snapshots as plain text, as Write writes them.
+type TextEncoder struct {
+	Percentiles []float64 // Percentiles of histograms and timers, or nil for the registry's
+}
+
+// Encode renders s as plain text, sorted by name.
+func (e TextEncoder) Encode(s *RegistrySnapshot, _ time.Time) ([]byte, error) {
+	var buf bytes.Buffer
+	writeText(s.Each, s.reportedPercentiles(e.Percentiles), &buf)
+	return buf.Bytes(), nil
+}
+
+// EncodingReporter writes snapshots of a registry to an io.Writer in the
+// format of its Encoder.
+type EncodingReporter struct {
+	Registry Registry
+	Encoder  Encoder
+	Writer   io.Writer
+	Tags     map[string]string // Tags added to every series, which its own tags override
+	Reset    bool              // Reset counters, histograms and peak gauges on each flush
+	Schedule FlushSchedule     // Alignment and jitter of the flushes of Run
+	OnError  func(error)       // Called with every error of Run, which logs them if it's nil
+	Metrics  *ReporterMetrics  // Records every Report, counting the series of failed writes as dropped
+
+	// AggregateTags are tag keys, e.g. "pod", aggregated away before each
+	// snapshot is encoded, summing or merging the series which differ only
+	// by them; see RegistrySnapshot.Aggregate.
+	AggregateTags []string
+
+	// StaleAfter, if positive, leaves out of each snapshot encoded the
+	// gauges which haven't been updated for that long, or with MarkStale set
+	// encodes them as StaleNaN; see RegistrySnapshot.Stale.
+	StaleAfter time.Duration
+	MarkStale  bool
+}
+
+// NewEncodingReporter constructs a new EncodingReporter writing snapshots of
+// r, or of DefaultRegistry if r is nil, encoded by e to w.
+func NewEncodingReporter(r Registry, e Encoder, w io.Writer) *EncodingReporter {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	return &EncodingReporter{Registry: r, Encoder: e, Writer: w}
+}
+
+// Flush snapshots the registry, encodes the snapshot and writes it in a
+// single Write, so that a writer shared between goroutines never sees one
+// flush interleaved with another.  Nothing is written if the encoder returns
+// no bytes.  With Reset set, the registry is snapshotted by SnapshotAndReset,
+// so each flush holds what accumulated since the last.
+func (r *EncodingReporter) Flush() error {
+	if r.Reset {
+		return r.Report(newRegistrySnapshotAndReset(r.Registry))
+	}
+	return r.Report(r.Registry.Snapshot())
+}
+
+// Report encodes the given snapshot, e.g. one a MultiReporter took, and
+// writes it as Flush does.  The encoder is passed the time the snapshot was
+// taken, so that points are stamped with when they were observed however long
+// a snapshot waits to be reported, or now if the snapshot doesn't know.
+func (r *EncodingReporter) Report(s *RegistrySnapshot) error {
+	return r.Metrics.Flush(func() error {
+		b, err := r.Encoder.Encode(s.withoutStale(r.StaleAfter, r.MarkStale).Aggregate(r.AggregateTags...).WithTags(r.Tags), SnapshotTime(s, now()))
+		if nil != err {
+			return err
+		}
+		if 0 == len(b) {
+			return nil
+		}
+		if _, err = r.Writer.Write(b); nil != err {
+			r.Metrics.Drop(s.Len())
+		}
+		return err
+	})
+}
+
+// Run calls Flush every d until stop is closed, or forever if stop is nil,
+// logging errors.  This is designed to be called as a goroutine.
+func (r *EncodingReporter) Run(d time.Duration, stop <-chan struct{}) {
+	r.Schedule.Run(d, stop, Closed(r.Registry), func(time.Time) {
+		ReportError(r.OnError, r.Flush())
+	})
+}
+
+// RunContext calls Flush every d until ctx is done, when it flushes a final
+// time, or the registry is closed, logging errors.
+func (r *EncodingReporter) RunContext(ctx context.Context, d time.Duration) {
+	r.Schedule.RunContext(ctx, d, Closed(r.Registry), func(time.Time) {
+		ReportError(r.OnError, r.Flush())
+	})
+}
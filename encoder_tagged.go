@@ -0,0 +1,150 @@
+package metrics
+
+import (
+	"bytes"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WavefrontEncoder encodes snapshots in the Wavefront data format, one line
+// per value, with each series' tags as point tags rather than flattened into
+// its name:
+//
+//	<prefix><name>.<field> <value> <timestamp> source=<source> <key>="<value>" ...
+//
+// The fields are those the Log exporter logs, e.g. count, p99 and rate1, with
+// timer durations in DurationUnit.  A series' own source tag overrides Source.
+type WavefrontEncoder struct {
+	Prefix       string        // Prefix of every metric name, e.g. "myapp."
+	Source       string        // Source of every point, or the host name if empty
+	DurationUnit time.Duration // Unit of timer durations, or nanoseconds if zero
+	Percentiles  []float64     // Percentiles of histograms and timers, or nil for the registry's
+}
+
+// Encode renders s, each point stamped with now in Unix seconds.  Healthchecks
+// and values which aren't finite, such as StaleNaN, are left out.
+func (e WavefrontEncoder) Encode(s *RegistrySnapshot, now time.Time) ([]byte, error) {
+	source := e.Source
+	if "" == source {
+		source, _ = os.Hostname()
+	}
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	var buf bytes.Buffer
+	eachTaggedValue(s, e.DurationUnit, s.reportedPercentiles(e.Percentiles), func(name, field, value string, tags Tags) {
+		buf.WriteString(wavefrontName(e.Prefix + name + "." + field))
+		buf.WriteByte(' ')
+		buf.WriteString(value)
+		buf.WriteByte(' ')
+		buf.WriteString(timestamp)
+		if !tags.Has("source") {
+			buf.WriteString(" source=")
+			buf.WriteString(strconv.Quote(source))
+		}
+		tags.Each(func(k, v string) {
+			buf.WriteByte(' ')
+			buf.WriteString(wavefrontName(k))
+			buf.WriteByte('=')
+			buf.WriteString(strconv.Quote(v))
+		})
+		buf.WriteByte('\n')
+	})
+	return buf.Bytes(), nil
+}
+
+// wavefrontName replaces the characters Wavefront doesn't allow in metric
+// names and point tag keys with underscores.
+func wavefrontName(s string) string {
+	return strings.Map(func(c rune) rune {
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || strings.ContainsRune("-_./,", c) {
+			return c
+		}
+		return '_'
+	}, s)
+}
+
+// Carbon2Encoder encodes snapshots in the Carbon2 format of Metrics 2.0, one
+// line per value, with the name, field and each series' tags as intrinsic
+// tags:
+//
+//	metric=<prefix><name> field=<field> <key>=<value> ...  <value> <timestamp>
+//
+// The fields are those of WavefrontEncoder.  Spaces and '=' in tags are
+// replaced with underscores, since Carbon2 doesn't quote.
+type Carbon2Encoder struct {
+	Prefix       string        // Prefix of every metric name, e.g. "myapp."
+	DurationUnit time.Duration // Unit of timer durations, or nanoseconds if zero
+	Percentiles  []float64     // Percentiles of histograms and timers, or nil for the registry's
+}
+
+// Encode renders s, each point stamped with now in Unix seconds.  Healthchecks
+// and values which aren't finite are left out.
+func (e Carbon2Encoder) Encode(s *RegistrySnapshot, now time.Time) ([]byte, error) {
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	var buf bytes.Buffer
+	eachTaggedValue(s, e.DurationUnit, s.reportedPercentiles(e.Percentiles), func(name, field, value string, tags Tags) {
+		buf.WriteString("metric=")
+		buf.WriteString(carbon2Tag(e.Prefix + name))
+		buf.WriteString(" field=")
+		buf.WriteString(field)
+		tags.Each(func(k, v string) {
+			if "metric" == k || "field" == k {
+				return
+			}
+			buf.WriteByte(' ')
+			buf.WriteString(carbon2Tag(k))
+			buf.WriteByte('=')
+			buf.WriteString(carbon2Tag(v))
+		})
+		// Two spaces separate the intrinsic tags from the meta tags, of
+		// which there are none.
+		buf.WriteString("  ")
+		buf.WriteString(value)
+		buf.WriteByte(' ')
+		buf.WriteString(timestamp)
+		buf.WriteByte('\n')
+	})
+	return buf.Bytes(), nil
+}
+
+var carbon2TagReplacer = strings.NewReplacer(" ", "_", "\t", "_", "\n", "_", "=", "_")
+
+func carbon2Tag(s string) string {
+	if "" == s {
+		return "_"
+	}
+	return carbon2TagReplacer.Replace(s)
+}
+
+// eachTaggedValue calls f with every value of the snapshots in s, in order of
+// name and, within a series, in the order the Log exporter logs them, along
+// with the series' base name and tags, with timer durations in du, or
+// nanoseconds if it's zero, and the percentiles ps.
+func eachTaggedValue(s *RegistrySnapshot, du time.Duration, ps []float64, f func(name, field, value string, tags Tags)) {
+	if 0 == du {
+		du = time.Nanosecond
+	}
+	s.Each(func(name string, i interface{}) {
+		if _, ok := i.(Healthcheck); ok {
+			return
+		}
+		base, tagMap := SplitTaggedName(name)
+		fields := metricLogFields(base, i, float64(du), ps)
+		if nil == fields {
+			return
+		}
+		tags := NewTags(tagMap)
+		for _, field := range fields[2:] { // Skip the type and name.
+			switch v := field.value.(type) {
+			case int64:
+				f(base, field.key, strconv.FormatInt(v, 10), tags)
+			case float64:
+				if !math.IsNaN(v) && !math.IsInf(v, 0) {
+					f(base, field.key, strconv.FormatFloat(v, 'f', -1, 64), tags)
+				}
+			}
+		}
+	})
+}
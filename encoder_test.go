@@ -0,0 +1,229 @@
+package metrics
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEncodingReporterJSON(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredCounter("foo", r).Inc(47)
+	var buf bytes.Buffer
+	if err := NewEncodingReporter(r, JSONEncoder{}, &buf).Flush(); nil != err {
+		t.Fatal(err)
+	}
+	var want bytes.Buffer
+	WriteJSONOnce(r, &want)
+	if want.String() != buf.String() {
+		t.Errorf("Flush():\n%s\n!=\n%s\n", want.String(), buf.String())
+	}
+}
+
+func TestEncodingReporterText(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredGauge("bar", r).Update(47)
+	NewRegisteredCounter("foo", r).Inc(1)
+	var buf bytes.Buffer
+	if err := NewEncodingReporter(r, TextEncoder{}, &buf).Flush(); nil != err {
+		t.Fatal(err)
+	}
+	var want bytes.Buffer
+	WriteOnce(r, &want)
+	if want.String() != buf.String() {
+		t.Errorf("Flush():\n%s\n!=\n%s\n", want.String(), buf.String())
+	}
+}
+
+type countingWriter struct {
+	writes int
+	bytes.Buffer
+}
+
+func (w *countingWriter) Write(b []byte) (int, error) {
+	w.writes++
+	return w.Buffer.Write(b)
+}
+
+func TestEncodingReporterWritesOnce(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredCounter("foo", r).Inc(1)
+	NewRegisteredCounter("bar", r).Inc(2)
+	w := &countingWriter{}
+	if err := NewEncodingReporter(r, TextEncoder{}, w).Flush(); nil != err {
+		t.Fatal(err)
+	}
+	if 1 != w.writes {
+		t.Errorf("writes: 1 != %v\n", w.writes)
+	}
+}
+
+func TestEncodingReporterErrors(t *testing.T) {
+	r := NewRegistry()
+	var buf bytes.Buffer
+	want := errors.New("boom")
+	e := EncoderFunc(func(*RegistrySnapshot, time.Time) ([]byte, error) { return []byte("x"), want })
+	if err := NewEncodingReporter(r, e, &buf).Flush(); want != err {
+		t.Errorf("Flush(): %v != %v\n", want, err)
+	}
+	if 0 != buf.Len() {
+		t.Errorf("buf: %q\n", buf.String())
+	}
+}
+
+func TestEncoderFuncTime(t *testing.T) {
+	var got time.Time
+	e := EncoderFunc(func(s *RegistrySnapshot, now time.Time) ([]byte, error) {
+		got = now
+		return []byte(strings.Join(s.Names(), ",")), nil
+	})
+	r := NewRegistry()
+	NewRegisteredCounter("foo", r)
+	var buf bytes.Buffer
+	before := time.Now()
+	if err := NewEncodingReporter(r, e, &buf).Flush(); nil != err {
+		t.Fatal(err)
+	}
+	if got.Before(before) {
+		t.Errorf("now: %v before %v\n", got, before)
+	}
+	if "foo" != buf.String() {
+		t.Errorf("buf: foo != %q\n", buf.String())
+	}
+}
+
+func TestEncodingReporterSnapshotTime(t *testing.T) {
+	clock := &stepClock{now: time.Unix(100, 0)}
+	SetClock(clock)
+	defer SetClock(nil)
+	r := NewRegistry()
+	NewRegisteredCounter("foo", r)
+	s := r.Snapshot()
+	clock.now = clock.now.Add(time.Minute)
+	var got time.Time
+	e := EncoderFunc(func(_ *RegistrySnapshot, now time.Time) ([]byte, error) {
+		got = now
+		return nil, nil
+	})
+	if err := NewEncodingReporter(r, e, ioutil.Discard).Report(s); nil != err {
+		t.Fatal(err)
+	}
+	if want := time.Unix(100, 0); !want.Equal(got) {
+		t.Errorf("now: %v != %v\n", want, got)
+	}
+}
+
+func TestEncodingReporterTags(t *testing.T) {
+	r := NewRegistry()
+	GetOrRegisterCounterT("foo", map[string]string{"host": "a"}, r)
+	NewRegisteredCounter("bar", r)
+	var buf bytes.Buffer
+	w := NewEncodingReporter(r, EncoderFunc(func(s *RegistrySnapshot, _ time.Time) ([]byte, error) {
+		return []byte(strings.Join(s.Names(), ",")), nil
+	}), &buf)
+	w.Tags = map[string]string{"host": "b"}
+	if err := w.Flush(); nil != err {
+		t.Fatal(err)
+	}
+	if "bar;host=b,foo;host=a" != buf.String() {
+		t.Errorf("buf: %q\n", buf.String())
+	}
+}
+
+func TestEncodingReporterReset(t *testing.T) {
+	r := NewRegistry()
+	r.(*StandardRegistry).SetDefaultTags(map[string]string{"host": "a"})
+	c := NewRegisteredCounter("foo", r)
+	g := NewRegisteredMaxGauge("peak", r)
+	var counts, peaks []int64
+	var names string
+	w := NewEncodingReporter(r, EncoderFunc(func(s *RegistrySnapshot, _ time.Time) ([]byte, error) {
+		names = strings.Join(s.Names(), ",")
+		counts = append(counts, s.Get("foo;host=a").(Counter).Count())
+		peaks = append(peaks, s.Get("peak;host=a").(Gauge).Value())
+		return nil, nil
+	}), ioutil.Discard)
+	w.Reset = true
+	c.Inc(3)
+	g.Update(5)
+	g.Update(2)
+	w.Flush()
+	c.Inc(1)
+	g.Update(1)
+	w.Flush()
+	if "foo;host=a,peak;host=a" != names {
+		t.Errorf("names: %q\n", names)
+	}
+	if 3 != counts[0] || 1 != counts[1] || 5 != peaks[0] || 1 != peaks[1] {
+		t.Errorf("counts: %v, peaks: %v\n", counts, peaks)
+	}
+}
+
+func TestEncodingReporterPercentiles(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredHistogram("foo", r, NewUniformSample(10)).Update(47)
+	r.(*StandardRegistry).SetPercentiles([]float64{0.9})
+	var buf bytes.Buffer
+	if err := NewEncodingReporter(r, JSONEncoder{}, &buf).Flush(); nil != err {
+		t.Fatal(err)
+	}
+	if s := buf.String(); !strings.Contains(s, `"90%":47`) || strings.Contains(s, "median") {
+		t.Errorf("Flush(): %s\n", s)
+	}
+	buf.Reset()
+	if err := NewEncodingReporter(r, JSONEncoder{Percentiles: []float64{0.999}}, &buf).Flush(); nil != err {
+		t.Fatal(err)
+	}
+	if s := buf.String(); !strings.Contains(s, `"99.9%":47`) || strings.Contains(s, `"90%"`) {
+		t.Errorf("Flush(): %s\n", s)
+	}
+}
+
+func TestWavefrontEncoder(t *testing.T) {
+	r := NewRegistry()
+	GetOrRegisterCounterT("requests", map[string]string{"route": "/users", "code": "200"}, r).Inc(3)
+	GetOrRegisterGaugeT("queue", map[string]string{"source": "worker-1"}, r).Update(7)
+	NewRegisteredHealthcheck("db", r, func(Healthcheck) {})
+	b, err := WavefrontEncoder{Prefix: "app.", Source: "host-a"}.Encode(r.Snapshot(), time.Unix(100, 0))
+	if nil != err {
+		t.Fatal(err)
+	}
+	want := "app.queue.value 7 100 source=\"worker-1\"\n" +
+		"app.requests.count 3 100 source=\"host-a\" code=\"200\" route=\"/users\"\n"
+	if got := string(b); want != got {
+		t.Errorf("Encode(): %q != %q\n", want, got)
+	}
+}
+
+func TestCarbon2Encoder(t *testing.T) {
+	r := NewRegistry()
+	GetOrRegisterCounterT("requests", map[string]string{"route": "/users", "status": "not found"}, r).Inc(3)
+	GetOrRegisterGaugeFloat64("load", r).Update(0.5)
+	b, err := Carbon2Encoder{}.Encode(r.Snapshot(), time.Unix(100, 0))
+	if nil != err {
+		t.Fatal(err)
+	}
+	want := "metric=load field=value  0.5 100\n" +
+		"metric=requests field=count route=/users status=not_found  3 100\n"
+	if got := string(b); want != got {
+		t.Errorf("Encode(): %q != %q\n", want, got)
+	}
+}
+
+func TestCarbon2EncoderTimer(t *testing.T) {
+	r := NewRegistry()
+	GetOrRegisterTimer("latency", r).Update(2 * time.Millisecond)
+	b, _ := Carbon2Encoder{DurationUnit: time.Millisecond, Percentiles: []float64{0.99}}.Encode(r.Snapshot(), time.Unix(100, 0))
+	for _, want := range []string{
+		"metric=latency field=count  1 100\n",
+		"metric=latency field=max  2 100\n",
+		"metric=latency field=p99  2 100\n",
+	} {
+		if !strings.Contains(string(b), want) {
+			t.Errorf("Encode(): %q doesn't contain %q\n", b, want)
+		}
+	}
+}
@@ -15,9 +15,23 @@ type EWMA interface {
 	Update(int64)
 }
 
+// GetOrRegisterEWMA returns the EWMA registered under the given name or
+// registers the given one; see NewRegisteredEWMA.  a is only kept if the EWMA
+// is new.
+func GetOrRegisterEWMA(name string, r Registry, a EWMA) EWMA {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	i := getOrRegister(r, name, func() GaugeFloat64 { return newEWMAGauge(a) }, NilGaugeFloat64{})
+	if g, ok := i.(*ewmaGauge); ok {
+		return g.ewma
+	}
+	return NilEWMA{}
+}
+
 // NewEWMA constructs a new EWMA with the given alpha.
 func NewEWMA(alpha float64) EWMA {
-	if UseNilMetrics {
+	if useNilMetrics() {
 		return NilEWMA{}
 	}
 	return &StandardEWMA{alpha: alpha}
@@ -38,6 +52,22 @@ func NewEWMA15() EWMA {
 	return NewEWMA(1 - math.Exp(-5.0/60.0/15))
 }
 
+// NewRegisteredEWMA registers the given EWMA, e.g. one from NewEWMA1, and
+// ticks it every five seconds, so that a rate such as that of errors can be
+// tracked without a whole Meter.  Its rate is
+// registered as a GaugeFloat64, which is how reporters see it, and
+// unregistering it stops the ticking.  Don't tick it yourself, too.
+func NewRegisteredEWMA(name string, r Registry, a EWMA) EWMA {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	if usesNilMetrics(r) {
+		return NilEWMA{}
+	}
+	r.Register(name, newEWMAGauge(a))
+	return a
+}
+
 // EWMASnapshot is a read-only copy of another EWMA.
 type EWMASnapshot float64
 
@@ -116,3 +146,53 @@ func (a *StandardEWMA) Tick() {
 func (a *StandardEWMA) Update(n int64) {
 	atomic.AddInt64(&a.uncounted, n)
 }
+
+// tickN ticks the EWMA n times at once.  The uncounted events fall in the
+// first interval, so the rest only decay the rate.
+func (a *StandardEWMA) tickN(n int64) {
+	a.Tick()
+	if n > 1 {
+		a.mutex.Lock()
+		defer a.mutex.Unlock()
+		a.rate *= math.Pow(1-a.alpha, float64(n-1))
+	}
+}
+
+// tickEWMA ticks a n times, all at once if it's a StandardEWMA.
+func tickEWMA(a EWMA, n int64) {
+	if s, ok := a.(*StandardEWMA); ok {
+		s.tickN(n)
+		return
+	}
+	for ; n > 0; n-- {
+		a.Tick()
+	}
+}
+
+// ewmaGauge is a GaugeFloat64 of the rate of an EWMA which the meter arbiter
+// ticks until the gauge is stopped.
+type ewmaGauge struct {
+	FunctionalGaugeFloat64
+	ewma EWMA
+}
+
+func newEWMAGauge(a EWMA) *ewmaGauge {
+	g := &ewmaGauge{FunctionalGaugeFloat64: FunctionalGaugeFloat64{value: a.Rate}, ewma: a}
+	arbiter.Lock()
+	defer arbiter.Unlock()
+	arbiter.ewmas = append(arbiter.ewmas, a)
+	arbiter.start()
+	return g
+}
+
+// Stop stops the ticking of the EWMA.
+func (g *ewmaGauge) Stop() {
+	arbiter.Lock()
+	defer arbiter.Unlock()
+	for i, a := range arbiter.ewmas {
+		if a == g.ewma {
+			arbiter.ewmas = append(arbiter.ewmas[:i], arbiter.ewmas[i+1:]...)
+			return
+		}
+	}
+}
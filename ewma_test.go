@@ -218,6 +218,34 @@ func TestEWMA15(t *testing.T) {
 	}
 }
 
+func TestRegisteredEWMA(t *testing.T) {
+	r := NewRegistry()
+	a := NewRegisteredEWMA("errors", r, NewEWMA1())
+	if b := GetOrRegisterEWMA("errors", r, NewEWMA5()); b != a {
+		t.Fatal(b)
+	}
+	a.Update(5)
+	arbiter.tickEWMAs()
+	g, ok := r.Get("errors").(GaugeFloat64)
+	if !ok {
+		t.Fatal(r.Get("errors"))
+	}
+	if v := g.Value(); 1 != v {
+		t.Errorf("g.Value(): 1 != %v\n", v)
+	}
+	if v := g.Snapshot().Value(); 1 != v {
+		t.Errorf("g.Snapshot().Value(): 1 != %v\n", v)
+	}
+	r.Unregister("errors")
+	arbiter.RLock()
+	defer arbiter.RUnlock()
+	for _, b := range arbiter.ewmas {
+		if b == a {
+			t.Error("EWMA still ticked")
+		}
+	}
+}
+
 func elapseMinute(a EWMA) {
 	for i := 0; i < 12; i++ {
 		a.Tick()
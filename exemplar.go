@@ -0,0 +1,88 @@
+package metrics
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Exemplar is a single recorded value along with the trace ID of the
+// operation which produced it, so that e.g. a slow request can be looked up
+// in a distributed tracing system.
+type Exemplar struct {
+	TraceID   string
+	Value     int64
+	Timestamp time.Time
+}
+
+// ExemplarConfig controls which values a timer keeps as exemplars.
+type ExemplarConfig struct {
+	// ContextKey is the key under which the trace ID is found in the context
+	// passed to TimeContextWithExemplar.  The value must be a string or a
+	// fmt.Stringer.
+	ContextKey interface{}
+
+	// Threshold is the duration a value must exceed to be kept as an
+	// exemplar, limiting the overhead to slow operations.
+	Threshold time.Duration
+
+	// Size bounds the number of exemplars kept; the oldest are discarded
+	// first.  It defaults to 10.
+	Size int
+}
+
+// exemplarRing keeps the most recent exemplars up to a fixed size.
+type exemplarRing struct {
+	config    ExemplarConfig
+	exemplars []Exemplar
+	mutex     sync.Mutex
+	next      int
+}
+
+func newExemplarRing(c ExemplarConfig) *exemplarRing {
+	if c.Size <= 0 {
+		c.Size = 10
+	}
+	return &exemplarRing{config: c, exemplars: make([]Exemplar, 0, c.Size)}
+}
+
+// traceID returns the trace ID stored under the configured key, if any.
+func (r *exemplarRing) traceID(v interface{}) (string, bool) {
+	switch id := v.(type) {
+	case string:
+		return id, "" != id
+	case fmt.Stringer:
+		s := id.String()
+		return s, "" != s
+	}
+	return "", false
+}
+
+// update keeps the value as an exemplar if it exceeds the threshold.
+func (r *exemplarRing) update(d time.Duration, v interface{}) {
+	if d <= r.config.Threshold {
+		return
+	}
+	id, ok := r.traceID(v)
+	if !ok {
+		return
+	}
+	e := Exemplar{TraceID: id, Value: int64(d), Timestamp: time.Now()}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if len(r.exemplars) < cap(r.exemplars) {
+		r.exemplars = append(r.exemplars, e)
+		return
+	}
+	r.exemplars[r.next] = e
+	r.next = (r.next + 1) % len(r.exemplars)
+}
+
+// values returns a copy of the exemplars, oldest first.
+func (r *exemplarRing) values() []Exemplar {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	exemplars := make([]Exemplar, 0, len(r.exemplars))
+	exemplars = append(exemplars, r.exemplars[r.next:]...)
+	return append(exemplars, r.exemplars[:r.next]...)
+}
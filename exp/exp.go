@@ -6,6 +6,8 @@ import (
 	"expvar"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 	"sync"
 
 	"github.com/rcrowley/go-metrics"
@@ -83,6 +85,10 @@ func (exp *exp) publishCounter(name string, metric metrics.Counter) {
 	v.Set(metric.Count())
 }
 
+func (exp *exp) publishCounterFloat64(name string, metric metrics.CounterFloat64) {
+	exp.getFloat(name).Set(metric.Count())
+}
+
 func (exp *exp) publishGauge(name string, metric metrics.Gauge) {
 	v := exp.getInt(name)
 	v.Set(metric.Value())
@@ -91,19 +97,24 @@ func (exp *exp) publishGaugeFloat64(name string, metric metrics.GaugeFloat64) {
 	exp.getFloat(name).Set(metric.Value())
 }
 
+func (exp *exp) publishMergeableGaugeFloat64(name string, metric metrics.MergeableGaugeFloat64) {
+	g := metric.Snapshot()
+	exp.getFloat(name).Set(g.Value())
+	exp.getInt(name + ".count").Set(g.Count())
+}
+
 func (exp *exp) publishHistogram(name string, metric metrics.Histogram) {
 	h := metric.Snapshot()
-	ps := h.Percentiles([]float64{0.5, 0.75, 0.95, 0.99, 0.999})
+	ps := metrics.MetricPercentiles(metrics.RegistryPercentiles(exp.registry), h)
+	scores := h.Percentiles(ps)
 	exp.getInt(name + ".count").Set(h.Count())
 	exp.getFloat(name + ".min").Set(float64(h.Min()))
 	exp.getFloat(name + ".max").Set(float64(h.Max()))
 	exp.getFloat(name + ".mean").Set(float64(h.Mean()))
 	exp.getFloat(name + ".std-dev").Set(float64(h.StdDev()))
-	exp.getFloat(name + ".50-percentile").Set(float64(ps[0]))
-	exp.getFloat(name + ".75-percentile").Set(float64(ps[1]))
-	exp.getFloat(name + ".95-percentile").Set(float64(ps[2]))
-	exp.getFloat(name + ".99-percentile").Set(float64(ps[3]))
-	exp.getFloat(name + ".999-percentile").Set(float64(ps[4]))
+	for i, p := range ps {
+		exp.getFloat(name + "." + percentileKey(p)).Set(scores[i])
+	}
 }
 
 func (exp *exp) publishMeter(name string, metric metrics.Meter) {
@@ -117,17 +128,16 @@ func (exp *exp) publishMeter(name string, metric metrics.Meter) {
 
 func (exp *exp) publishTimer(name string, metric metrics.Timer) {
 	t := metric.Snapshot()
-	ps := t.Percentiles([]float64{0.5, 0.75, 0.95, 0.99, 0.999})
+	ps := metrics.MetricPercentiles(metrics.RegistryPercentiles(exp.registry), t)
+	scores := t.Percentiles(ps)
 	exp.getInt(name + ".count").Set(t.Count())
 	exp.getFloat(name + ".min").Set(float64(t.Min()))
 	exp.getFloat(name + ".max").Set(float64(t.Max()))
 	exp.getFloat(name + ".mean").Set(float64(t.Mean()))
 	exp.getFloat(name + ".std-dev").Set(float64(t.StdDev()))
-	exp.getFloat(name + ".50-percentile").Set(float64(ps[0]))
-	exp.getFloat(name + ".75-percentile").Set(float64(ps[1]))
-	exp.getFloat(name + ".95-percentile").Set(float64(ps[2]))
-	exp.getFloat(name + ".99-percentile").Set(float64(ps[3]))
-	exp.getFloat(name + ".999-percentile").Set(float64(ps[4]))
+	for i, p := range ps {
+		exp.getFloat(name + "." + percentileKey(p)).Set(scores[i])
+	}
 	exp.getFloat(name + ".one-minute").Set(float64(t.Rate1()))
 	exp.getFloat(name + ".five-minute").Set(float64(t.Rate5()))
 	exp.getFloat(name + ".fifteen-minute").Set(float64((t.Rate15())))
@@ -139,10 +149,14 @@ func (exp *exp) syncToExpvar() {
 		switch i.(type) {
 		case metrics.Counter:
 			exp.publishCounter(name, i.(metrics.Counter))
+		case metrics.CounterFloat64:
+			exp.publishCounterFloat64(name, i.(metrics.CounterFloat64))
 		case metrics.Gauge:
 			exp.publishGauge(name, i.(metrics.Gauge))
 		case metrics.GaugeFloat64:
 			exp.publishGaugeFloat64(name, i.(metrics.GaugeFloat64))
+		case metrics.MergeableGaugeFloat64:
+			exp.publishMergeableGaugeFloat64(name, i.(metrics.MergeableGaugeFloat64))
 		case metrics.Histogram:
 			exp.publishHistogram(name, i.(metrics.Histogram))
 		case metrics.Meter:
@@ -154,3 +168,107 @@ func (exp *exp) syncToExpvar() {
 		}
 	})
 }
+
+// Publish publishes every metric in r as the expvar with the given name, so
+// that it shows up at /debug/vars alongside the process's other expvars.  The
+// metrics are read afresh on every request rather than copied into expvars by
+// a background goroutine.  Each metric is an object of its values, the same
+// ones ExpHandler serves, and tagged metrics carry their tags, including the
+// registry's default tags, in a nested "tags" object.  Metrics registered
+// under the same name with different tags are grouped into an array.
+// Like expvar.Publish, Publish panics if the name is already in use.
+func Publish(name string, r metrics.Registry) {
+	expvar.Publish(name, expvar.Func(func() interface{} { return registryVar(r) }))
+}
+
+func registryVar(r metrics.Registry) map[string]interface{} {
+	ps := metrics.RegistryPercentiles(r)
+	series := make(map[string][]map[string]interface{})
+	r.EachSnapshot(func(name string, i interface{}) {
+		values := metricValues(i, ps)
+		if nil == values {
+			return
+		}
+		name, tags := metrics.SplitTaggedName(name)
+		if 0 != len(tags) {
+			values["tags"] = tags
+		}
+		series[name] = append(series[name], values)
+	})
+	v := make(map[string]interface{}, len(series))
+	for name, s := range series {
+		if 1 == len(s) {
+			v[name] = s[0]
+		} else {
+			v[name] = s
+		}
+	}
+	return v
+}
+
+// metricValues returns the values of a metric snapshot, with the percentiles
+// ps of histograms and timers, or nil for healthchecks and types it doesn't
+// know.
+func metricValues(i interface{}, ps []float64) map[string]interface{} {
+	switch m := i.(type) {
+	case metrics.Counter:
+		return map[string]interface{}{"count": m.Count()}
+	case metrics.CounterFloat64:
+		return map[string]interface{}{"count": m.Count()}
+	case metrics.Gauge:
+		return map[string]interface{}{"value": m.Value()}
+	case metrics.GaugeFloat64:
+		return map[string]interface{}{"value": m.Value()}
+	case metrics.MergeableGaugeFloat64:
+		return map[string]interface{}{"value": m.Value(), "count": m.Count()}
+	case metrics.Histogram:
+		values := map[string]interface{}{
+			"count":   m.Count(),
+			"min":     m.Min(),
+			"max":     m.Max(),
+			"mean":    m.Mean(),
+			"std-dev": m.StdDev(),
+		}
+		ps := metrics.MetricPercentiles(ps, m)
+		addPercentiles(values, ps, m.Percentiles(ps))
+		return values
+	case metrics.Meter:
+		return map[string]interface{}{
+			"count":          m.Count(),
+			"one-minute":     m.Rate1(),
+			"five-minute":    m.Rate5(),
+			"fifteen-minute": m.Rate15(),
+			"mean":           m.RateMean(),
+		}
+	case metrics.Timer:
+		values := map[string]interface{}{
+			"count":          m.Count(),
+			"min":            m.Min(),
+			"max":            m.Max(),
+			"mean":           m.Mean(),
+			"std-dev":        m.StdDev(),
+			"one-minute":     m.Rate1(),
+			"five-minute":    m.Rate5(),
+			"fifteen-minute": m.Rate15(),
+			"mean-rate":      m.RateMean(),
+		}
+		ps := metrics.MetricPercentiles(ps, m)
+		addPercentiles(values, ps, m.Percentiles(ps))
+		return values
+	}
+	return nil
+}
+
+// addPercentiles adds the scores of the percentiles ps to values.
+func addPercentiles(values map[string]interface{}, ps, scores []float64) {
+	for i, p := range ps {
+		values[percentileKey(p)] = scores[i]
+	}
+}
+
+// percentileKey names the percentile p as the Graphite exporter does, e.g.
+// 50-percentile for 0.5 and 999-percentile for 0.999.
+func percentileKey(p float64) string {
+	s := strings.TrimRight(strconv.FormatFloat(p*100, 'f', 6, 64), "0")
+	return strings.Replace(strings.TrimSuffix(s, "."), ".", "", 1) + "-percentile"
+}
@@ -0,0 +1,45 @@
+package exp
+
+import (
+	"encoding/json"
+	"expvar"
+	"testing"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+func TestPublish(t *testing.T) {
+	r := metrics.NewRegistry()
+	for _, endpoint := range []string{"/users", "/groups"} {
+		c := metrics.NewCounter()
+		c.(metrics.Taggable).AddTags(map[string]string{"endpoint": endpoint})
+		c.Inc(1)
+		r.Register("requests", c)
+	}
+	g := metrics.NewRegisteredGauge("depth", r)
+	Publish("test-metrics", r)
+
+	// The expvar reads the registry on every request.
+	g.Update(7)
+	var v struct {
+		Depth    map[string]float64
+		Requests []struct {
+			Count float64
+			Tags  map[string]string
+		}
+	}
+	if err := json.Unmarshal([]byte(expvar.Get("test-metrics").String()), &v); nil != err {
+		t.Fatal(err)
+	}
+	if 7 != v.Depth["value"] {
+		t.Errorf("depth: %v\n", v.Depth)
+	}
+	if 2 != len(v.Requests) {
+		t.Fatalf("requests: %v\n", v.Requests)
+	}
+	for _, s := range v.Requests {
+		if 1 != s.Count || "" == s.Tags["endpoint"] {
+			t.Errorf("requests: %v\n", s)
+		}
+	}
+}
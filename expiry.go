@@ -0,0 +1,85 @@
+package metrics
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// clock is the time in nanoseconds since the epoch as of the latest sweep of
+// any registry expiring metrics or call to SetClock, or zero if neither has
+// happened.  Metrics stamp
+// themselves with it rather than calling time.Now on every update, so it's
+// only as fine as the sweeps, which is all StandardRegistry.SetTTL needs.
+var clock int64
+
+// advanceClock moves the clock forward to now, never back.
+func advanceClock(now time.Time) {
+	nanos := now.UnixNano()
+	for {
+		old := atomic.LoadInt64(&clock)
+		if nanos <= old || atomic.CompareAndSwapInt64(&clock, old, nanos) {
+			return
+		}
+	}
+}
+
+// lastUpdate is embedded in the Standard metric types to record when they
+// were last updated for StandardRegistry.SetTTL.  Updates load the clock and
+// only store it when it's moved on since, so a busy metric doesn't bounce its
+// cache line between processors.  The zero value has never been updated.
+type lastUpdate struct {
+	nanos int64
+}
+
+// LastUpdated returns when the metric was last updated or registered, to the
+// resolution of the sweeps of registries expiring metrics, or the zero time
+// if it hasn't been since one started.
+func (u *lastUpdate) LastUpdated() time.Time {
+	nanos := atomic.LoadInt64(&u.nanos)
+	if 0 == nanos {
+		return time.Time{}
+	}
+	return time.Unix(0, nanos)
+}
+
+func (u *lastUpdate) touch() {
+	if now := atomic.LoadInt64(&clock); now != atomic.LoadInt64(&u.nanos) {
+		atomic.StoreInt64(&u.nanos, now)
+	}
+}
+
+// expirable is implemented by metrics which record when they were last
+// updated.  Others, such as functional gauges and healthchecks, never expire.
+type expirable interface {
+	LastUpdated() time.Time
+	touch()
+}
+
+// touchMetric stamps a metric which records when it was last updated.
+func touchMetric(i interface{}) {
+	if e, ok := i.(expirable); ok {
+		e.touch()
+	}
+}
+
+// sweep unregisters the metrics of r last updated longer than ttl before now
+// on every tick of t, which ticks every interval, until done is closed.
+func (r *StandardRegistry) sweep(ttl, interval time.Duration, t Ticker, done chan struct{}) {
+	every(t, done, nil, func(now time.Time) {
+		// A stamp may be up to an interval older than the update it records,
+		// so allow for that rather than expire a metric early.
+		advanceClock(now)
+		r.expire(now, ttl+interval)
+	})
+}
+
+// expire unregisters the metrics last updated longer than age before now.
+func (r *StandardRegistry) expire(now time.Time, age time.Duration) {
+	cutoff := now.Add(-age)
+	r.EachAndUpdate(func(_ string, i interface{}) Action {
+		if e, ok := i.(expirable); ok && e.LastUpdated().Before(cutoff) {
+			return ActionUnregister
+		}
+		return ActionKeep
+	})
+}
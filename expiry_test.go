@@ -0,0 +1,110 @@
+package metrics
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func BenchmarkCounterIncTTL(b *testing.B) {
+	r := NewRegistry().(*StandardRegistry)
+	r.SetTTL(time.Hour)
+	defer r.SetTTL(0)
+	c := GetOrRegisterCounter("foo", r)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.Inc(1)
+	}
+}
+
+func TestRegistryExpire(t *testing.T) {
+	r := NewRegistry().(*StandardRegistry)
+	// The clock never goes back, so don't move it past the present.
+	now := time.Now()
+	advanceClock(now)
+	c := GetOrRegisterCounter("stale", r)
+	m := GetOrRegisterMeter("stale.meter", r).(*StandardMeter)
+	GetOrRegisterGauge("busy", r)
+	NewRegisteredFunctionalGauge("lazy", r, func() int64 { return 47 })
+	r.Alias("stale", "alias")
+
+	time.Sleep(2 * time.Millisecond)
+	later := time.Now()
+	advanceClock(later)
+	GetOrRegisterGauge("busy", r).Update(47)
+	if lu := c.(*StandardCounter).LastUpdated(); !lu.Equal(time.Unix(0, now.UnixNano())) {
+		t.Errorf("c.LastUpdated(): %v != %v\n", now, lu)
+	}
+
+	r.expire(later, later.Sub(now)/2)
+	for _, name := range []string{"stale", "alias", "stale.meter"} {
+		if nil != r.Get(name) {
+			t.Errorf("%s not expired\n", name)
+		}
+	}
+	for _, name := range []string{"busy", "lazy"} {
+		if nil == r.Get(name) {
+			t.Errorf("%s expired\n", name)
+		}
+	}
+	if meterTicked(m) {
+		t.Error("expired meter still ticked")
+	}
+
+	if c2 := GetOrRegisterCounter("stale", r); c2 == c {
+		t.Error("expired counter registered again")
+	}
+}
+
+func TestRegistrySetTTL(t *testing.T) {
+	r := NewRegistry().(*StandardRegistry)
+	c := NewRegisteredCounter("foo", r)
+	r.SetTTL(40 * time.Millisecond)
+	defer r.SetTTL(0)
+	if c.(*StandardCounter).LastUpdated().IsZero() {
+		t.Error("counter registered before SetTTL not stamped")
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for nil != r.Get("foo") {
+		if time.Now().After(deadline) {
+			t.Fatal("foo never expired")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	r.SetTTL(0)
+	NewRegisteredCounter("bar", r)
+	time.Sleep(100 * time.Millisecond)
+	if nil == r.Get("bar") {
+		t.Error("bar expired after SetTTL(0)")
+	}
+}
+
+func TestLastUpdated(t *testing.T) {
+	advanceClock(time.Now())
+	want := time.Unix(0, atomic.LoadInt64(&clock))
+	for name, f := range map[string]func() interface{}{
+		"counter":  func() interface{} { c := NewCounter(); c.Inc(1); return c },
+		"sharded":  func() interface{} { c := NewShardedCounter(); c.Inc(1); return c },
+		"gauge":    func() interface{} { g := NewGauge(); g.Update(1); return g },
+		"float64":  func() interface{} { g := NewGaugeFloat64(); g.Update(1); return g },
+		"mergable": func() interface{} { g := NewMergeableGaugeFloat64(); g.Update(1); return g },
+		"histogram": func() interface{} {
+			h := NewHistogram(NewUniformSample(10))
+			h.Update(1)
+			return h
+		},
+		"windowed": func() interface{} {
+			h := NewWindowedHistogram(time.Minute, time.Second)
+			defer h.(*StandardWindowedHistogram).Stop()
+			h.Update(1)
+			return h
+		},
+		"meter": func() interface{} { m := NewMeter(); defer m.Stop(); m.Mark(1); return m },
+		"timer": func() interface{} { tm := NewTimer(); defer tm.Stop(); tm.Update(1); return tm },
+	} {
+		if lu := f().(expirable).LastUpdated(); !lu.Equal(want) {
+			t.Errorf("%s LastUpdated(): %v != %v\n", name, want, lu)
+		}
+	}
+}
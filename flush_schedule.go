@@ -0,0 +1,135 @@
+package metrics
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// A FlushSchedule says when, within each flush interval, a reporter flushes.
+// The zero value flushes once every interval from when the reporter starts,
+// as reporters always have.
+type FlushSchedule struct {
+	// Align starts each flush on a multiple of the interval since the Unix
+	// epoch, e.g. on the :00, :10, :20 seconds and so on of a 10s interval,
+	// so that every process flushes into the same Graphite bucket rather
+	// than some into the one before.
+	Align bool
+
+	// Jitter, if set, delays each flush by a random duration up to it,
+	// spreading the writes of a fleet of identical services rather than
+	// have them all arrive at once.  It's capped at the interval.
+	Jitter time.Duration
+}
+
+// Run calls f every d by the clock set by SetClock, as the schedule says,
+// until stop or closed is closed; either may be nil, which never is.  f is
+// passed the time a flush was due before its jitter, so that points it stamps
+// with that time still fall on the boundaries.  This is designed to be called
+// as a goroutine by reporters, passing Closed of their registry as closed.
+//
+// Since a jittered flush waits on a ticker of its own, a mock clock such as
+// metricstest.Clock must be moved on past the jitter for it to happen.
+func (s FlushSchedule) Run(d time.Duration, stop, closed <-chan struct{}, f func(time.Time)) {
+	if !s.Align && s.Jitter <= 0 {
+		every(tick(d), stop, closed, f)
+		return
+	}
+	c := CurrentClock()
+	if s.Align {
+		s.runAligned(c, d, stop, closed, f)
+		return
+	}
+	t := c.Ticker(d)
+	defer t.Stop()
+	for {
+		select {
+		case due := <-t.C():
+			t.Done()
+			if !s.flush(c, d, due, stop, closed, f) {
+				return
+			}
+		case <-stop:
+			return
+		case <-closed:
+			return
+		}
+	}
+}
+
+// RunContext is Run until ctx is done or closed is closed.  Once ctx is done,
+// unless closed is too, it calls f once more with the time then, so that what
+// was recorded since the last flush isn't lost on shutdown, and returns when
+// that flush does.  Reporters' RunContext methods and the XxxContext
+// exporters are built on it.
+func (s FlushSchedule) RunContext(ctx context.Context, d time.Duration, closed <-chan struct{}, f func(time.Time)) {
+	s.Run(d, ctx.Done(), closed, f)
+	if nil == ctx.Err() {
+		return
+	}
+	select {
+	case <-closed:
+	default:
+		f(now())
+	}
+}
+
+// runAligned waits for each boundary by the wall clock rather than ticking,
+// so that flushes stay on the boundaries however the system clock is
+// adjusted.  Boundaries which pass during a flush are skipped, as a ticker
+// drops ticks.
+func (s FlushSchedule) runAligned(c Clock, d time.Duration, stop, closed <-chan struct{}, f func(time.Time)) {
+	now := c.Now()
+	next := now.Add(alignDelay(now, d)).Round(0) // Round(0) strips the monotonic reading.
+	for {
+		if !wait(c, next.Sub(c.Now()), stop, closed) {
+			return
+		}
+		if !s.flush(c, d, next, stop, closed, f) {
+			return
+		}
+		for now = c.Now(); !next.After(now); {
+			next = next.Add(d)
+		}
+	}
+}
+
+// flush calls f once the jitter has passed, returning false if stop or
+// closed is closed first.
+func (s FlushSchedule) flush(c Clock, d time.Duration, due time.Time, stop, closed <-chan struct{}, f func(time.Time)) bool {
+	if jitter := s.Jitter; 0 < jitter {
+		if jitter > d {
+			jitter = d
+		}
+		if !wait(c, time.Duration(rand.Int63n(int64(jitter))), stop, closed) {
+			return false
+		}
+	}
+	f(due)
+	return true
+}
+
+// alignDelay returns how long after t the next multiple of d since the Unix
+// epoch falls, d if t is one.
+func alignDelay(t time.Time, d time.Duration) time.Duration {
+	return d - time.Duration(t.UnixNano()%int64(d))
+}
+
+// wait blocks for d by the clock c, returning false if stop or closed is
+// closed first.
+func wait(c Clock, d time.Duration, stop, closed <-chan struct{}) bool {
+	if d <= 0 {
+		return true
+	}
+	t := c.Ticker(d)
+	defer t.Stop()
+	select {
+	case <-t.C():
+		t.Done()
+		return true
+	case <-stop:
+		return false
+	case <-closed:
+		return false
+	}
+}
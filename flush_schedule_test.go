@@ -0,0 +1,116 @@
+package metrics
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestAlignDelay(t *testing.T) {
+	for _, c := range []struct {
+		t    time.Time
+		want time.Duration
+	}{
+		{time.Unix(100, 0), 10 * time.Second},
+		{time.Unix(101, 0), 9 * time.Second},
+		{time.Unix(109, int64(500*time.Millisecond)), 500 * time.Millisecond},
+	} {
+		if d := alignDelay(c.t, 10*time.Second); c.want != d {
+			t.Errorf("alignDelay(%v): %v != %v\n", c.t, c.want, d)
+		}
+	}
+}
+
+func TestFlushScheduleAlign(t *testing.T) {
+	const d = 20 * time.Millisecond
+	stop := make(chan struct{})
+	dues := make(chan time.Time, 3)
+	go FlushSchedule{Align: true}.Run(d, stop, nil, func(due time.Time) {
+		if now := time.Now(); now.Before(due) {
+			t.Errorf("flushed at %v, before %v\n", now, due)
+		}
+		dues <- due
+		if 3 == len(dues) {
+			close(stop)
+		}
+	})
+	var last time.Time
+	for i := 0; i < 3; i++ {
+		due := <-dues
+		if 0 != due.UnixNano()%int64(d) {
+			t.Errorf("due %v: not a multiple of %v\n", due, d)
+		}
+		if !last.IsZero() && !due.After(last) {
+			t.Errorf("due %v: not after %v\n", due, last)
+		}
+		last = due
+	}
+}
+
+func TestFlushScheduleJitter(t *testing.T) {
+	const d, jitter = 10 * time.Millisecond, 5 * time.Millisecond
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	flushes := 0
+	go func() {
+		defer close(done)
+		FlushSchedule{Jitter: jitter}.Run(d, stop, nil, func(due time.Time) {
+			if now := time.Now(); now.Before(due) {
+				t.Errorf("flushed at %v, before %v\n", now, due)
+			}
+			if flushes++; 3 == flushes {
+				close(stop)
+			}
+		})
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Run(): still running after stop\n")
+	}
+	if 3 != flushes {
+		t.Errorf("flushes: 3 != %v\n", flushes)
+	}
+}
+
+func TestFlushScheduleStopsWhileWaiting(t *testing.T) {
+	closed := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		FlushSchedule{Align: true}.Run(time.Hour, nil, closed, func(time.Time) {
+			t.Error("flushed\n")
+		})
+	}()
+	close(closed)
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Run(): still waiting for the boundary after closed\n")
+	}
+}
+
+func TestFlushScheduleRunContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	flushes := 0
+	go func() {
+		defer close(done)
+		FlushSchedule{}.RunContext(ctx, time.Hour, nil, func(time.Time) { flushes++ })
+	}()
+	cancel()
+	<-done
+	if 1 != flushes {
+		t.Errorf("flushes: 1 != %v\n", flushes)
+	}
+}
+
+func TestFlushScheduleRunContextClosed(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	closed := make(chan struct{})
+	close(closed)
+	FlushSchedule{}.RunContext(ctx, time.Hour, closed, func(time.Time) {
+		t.Error("flushed after the registry was closed\n")
+	})
+}
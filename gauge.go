@@ -1,6 +1,9 @@
 package metrics
 
-import "sync/atomic"
+import (
+	"sync/atomic"
+	"time"
+)
 
 // Gauges hold an int64 value that can be set arbitrarily.
 type Gauge interface {
@@ -15,62 +18,117 @@ func GetOrRegisterGauge(name string, r Registry) Gauge {
 	if nil == r {
 		r = DefaultRegistry
 	}
-	return r.GetOrRegister(name, NewGauge).(Gauge)
+	return getOrRegister(r, name, NewGauge, NilGauge{}).(Gauge)
+}
+
+// GetOrRegisterGaugeT returns the existing Gauge identified by name and tags
+// together or constructs and registers a new one carrying the tags; see
+// GetOrRegisterCounterT.
+func GetOrRegisterGaugeT(name string, tags map[string]string, r Registry) Gauge {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	return getOrRegisterTagged(r, name, tags, func() interface{} { return NewGauge() }, NilGauge{}).(Gauge)
 }
 
 // NewGauge constructs a new StandardGauge.
 func NewGauge() Gauge {
-	if UseNilMetrics {
+	if useNilMetrics() {
 		return NilGauge{}
 	}
-	return &StandardGauge{0}
+	return &StandardGauge{}
 }
 
 // NewRegisteredGauge constructs and registers a new StandardGauge.
 func NewRegisteredGauge(name string, r Registry) Gauge {
-	c := NewGauge()
 	if nil == r {
 		r = DefaultRegistry
 	}
+	if usesNilMetrics(r) {
+		return NilGauge{}
+	}
+	c := NewGauge()
 	r.Register(name, c)
 	return c
 }
 
+// GetOrRegisterFunctionalGauge returns an existing Gauge or constructs and
+// registers a new FunctionalGauge.  f is only kept if the gauge is new.
+func GetOrRegisterFunctionalGauge(name string, r Registry, f func() int64) Gauge {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	return getOrRegister(r, name, func() Gauge { return NewFunctionalGauge(f) }, NilGauge{}).(Gauge)
+}
+
 // NewFunctionalGauge constructs a new FunctionalGauge.
 func NewFunctionalGauge(f func() int64) Gauge {
-	if UseNilMetrics {
+	if useNilMetrics() {
 		return NilGauge{}
 	}
 	return &FunctionalGauge{value: f}
 }
 
-// NewRegisteredFunctionalGauge constructs and registers a new StandardGauge.
+// NewRegisteredFunctionalGauge constructs and registers a new
+// FunctionalGauge.
 func NewRegisteredFunctionalGauge(name string, r Registry, f func() int64) Gauge {
-	c := NewFunctionalGauge(f)
 	if nil == r {
 		r = DefaultRegistry
 	}
+	if usesNilMetrics(r) {
+		return NilGauge{}
+	}
+	c := NewFunctionalGauge(f)
 	r.Register(name, c)
 	return c
 }
 
-// GaugeSnapshot is a read-only copy of another Gauge.
-type GaugeSnapshot int64
+// GaugeSnapshot is a read-only copy of another Gauge, which records when it
+// was taken.
+type GaugeSnapshot struct {
+	value     int64
+	timestamp time.Time
+}
+
+// NewGaugeSnapshot constructs a GaugeSnapshot of the given value, taken
+// at the given time, which is zero if it isn't known.
+func NewGaugeSnapshot(value int64, timestamp time.Time) GaugeSnapshot {
+	return GaugeSnapshot{value: value, timestamp: timestamp}
+}
 
 // Snapshot returns the snapshot.
 func (g GaugeSnapshot) Snapshot() Gauge { return g }
 
+// Timestamp returns the time the snapshot was taken, or the zero time if it
+// isn't known.
+func (g GaugeSnapshot) Timestamp() time.Time { return g.timestamp }
+
 // Update panics.
 func (GaugeSnapshot) Update(int64) {
 	panic("Update called on a GaugeSnapshot")
 }
 
 // Value returns the value at the time the snapshot was taken.
-func (g GaugeSnapshot) Value() int64 { return int64(g) }
+func (g GaugeSnapshot) Value() int64 { return g.value }
 
 // NilGauge is a no-op Gauge.
 type NilGauge struct{}
 
+// AddDynamicTag is a no-op.
+func (NilGauge) AddDynamicTag(string, func() string) error { return nil }
+
+// AddTags is a no-op.
+func (NilGauge) AddTags(map[string]string) {}
+
+// GetTags is a no-op.
+func (NilGauge) GetTags() map[string]string { return nil }
+
+// RemoveTag is a no-op.
+func (NilGauge) RemoveTag(string) {}
+
+// SetTags is a no-op.
+func (NilGauge) SetTags(map[string]string) {}
+
 // Snapshot is a no-op.
 func (NilGauge) Snapshot() Gauge { return NilGauge{} }
 
@@ -83,38 +141,81 @@ func (NilGauge) Value() int64 { return 0 }
 // StandardGauge is the standard implementation of a Gauge and uses the
 // sync/atomic package to manage a single int64 value.
 type StandardGauge struct {
+	tagSet
+	lastUpdate
+	updateTime
+
 	value int64
+	last  atomic.Value // Gauge, the latest snapshot
 }
 
-// Snapshot returns a read-only copy of the gauge.
+// Snapshot returns a read-only copy of the gauge, or its last one again while
+// neither the value nor the clock has moved; see StandardCounter.Snapshot.
 func (g *StandardGauge) Snapshot() Gauge {
-	return GaugeSnapshot(g.Value())
+	value, t := g.Value(), now()
+	v := g.last.Load()
+	if last, ok := v.(GaugeSnapshot); ok && value == last.value && t.Equal(last.timestamp) {
+		return v.(Gauge)
+	}
+	snapshot := Gauge(GaugeSnapshot{value: value, timestamp: t})
+	g.last.Store(snapshot)
+	return snapshot
+}
+
+// ReadInto stores the gauge's value in s; see StandardCounter.ReadInto.
+func (g *StandardGauge) ReadInto(s *GaugeSnapshot) {
+	*s = GaugeSnapshot{value: g.Value(), timestamp: now()}
 }
 
 // Update updates the gauge's value.
 func (g *StandardGauge) Update(v int64) {
+	g.touch()
+	g.stamp()
 	atomic.StoreInt64(&g.value, v)
 }
 
+// UpdateIfMax updates the gauge's value to v if it's greater than the current
+// value.  See also NewMaxGauge.
+func (g *StandardGauge) UpdateIfMax(v int64) {
+	g.touch()
+	g.stamp()
+	updateIfMax(&g.value, v)
+}
+
+// UpdateIfMin updates the gauge's value to v if it's less than the current
+// value.  See also NewMinGauge.
+func (g *StandardGauge) UpdateIfMin(v int64) {
+	g.touch()
+	g.stamp()
+	updateIfMin(&g.value, v)
+}
+
 // Value returns the gauge's current value.
 func (g *StandardGauge) Value() int64 {
 	return atomic.LoadInt64(&g.value)
 }
 
-// FunctionalGauge returns value from given function
+// FunctionalGauge returns value from given function, called whenever the
+// gauge is read or snapshotted, e.g. by a reporter, so that values such as a
+// queue's length needn't be pushed on a timer.  f must be safe to call
+// concurrently.
 type FunctionalGauge struct {
+	tagSet
+
 	value func() int64
 }
 
 // Value returns the gauge's current value.
-func (g FunctionalGauge) Value() int64 {
+func (g *FunctionalGauge) Value() int64 {
 	return g.value()
 }
 
 // Snapshot returns the snapshot.
-func (g FunctionalGauge) Snapshot() Gauge { return GaugeSnapshot(g.Value()) }
+func (g *FunctionalGauge) Snapshot() Gauge {
+	return GaugeSnapshot{value: g.Value(), timestamp: now()}
+}
 
 // Update panics.
-func (FunctionalGauge) Update(int64) {
+func (*FunctionalGauge) Update(int64) {
 	panic("Update called on a FunctionalGauge")
 }
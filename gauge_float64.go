@@ -1,6 +1,10 @@
 package metrics
 
-import "sync"
+import (
+	"math"
+	"sync/atomic"
+	"time"
+)
 
 // GaugeFloat64s hold a float64 value that can be set arbitrarily.
 type GaugeFloat64 interface {
@@ -15,64 +19,118 @@ func GetOrRegisterGaugeFloat64(name string, r Registry) GaugeFloat64 {
 	if nil == r {
 		r = DefaultRegistry
 	}
-	return r.GetOrRegister(name, NewGaugeFloat64()).(GaugeFloat64)
+	return getOrRegister(r, name, NewGaugeFloat64, NilGaugeFloat64{}).(GaugeFloat64)
+}
+
+// GetOrRegisterGaugeFloat64T returns the existing GaugeFloat64 identified by
+// name and tags together or constructs and registers a new one carrying the
+// tags; see GetOrRegisterCounterT.
+func GetOrRegisterGaugeFloat64T(name string, tags map[string]string, r Registry) GaugeFloat64 {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	return getOrRegisterTagged(r, name, tags, func() interface{} { return NewGaugeFloat64() }, NilGaugeFloat64{}).(GaugeFloat64)
 }
 
 // NewGaugeFloat64 constructs a new StandardGaugeFloat64.
 func NewGaugeFloat64() GaugeFloat64 {
-	if UseNilMetrics {
+	if useNilMetrics() {
 		return NilGaugeFloat64{}
 	}
-	return &StandardGaugeFloat64{
-		value: 0.0,
-	}
+	return &StandardGaugeFloat64{}
 }
 
 // NewRegisteredGaugeFloat64 constructs and registers a new StandardGaugeFloat64.
 func NewRegisteredGaugeFloat64(name string, r Registry) GaugeFloat64 {
-	c := NewGaugeFloat64()
 	if nil == r {
 		r = DefaultRegistry
 	}
+	if usesNilMetrics(r) {
+		return NilGaugeFloat64{}
+	}
+	c := NewGaugeFloat64()
 	r.Register(name, c)
 	return c
 }
 
-// NewFunctionalGauge constructs a new FunctionalGauge.
+// GetOrRegisterFunctionalGaugeFloat64 returns an existing GaugeFloat64 or
+// constructs and registers a new FunctionalGaugeFloat64.  f is only kept if
+// the gauge is new.
+func GetOrRegisterFunctionalGaugeFloat64(name string, r Registry, f func() float64) GaugeFloat64 {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	return getOrRegister(r, name, func() GaugeFloat64 { return NewFunctionalGaugeFloat64(f) }, NilGaugeFloat64{}).(GaugeFloat64)
+}
+
+// NewFunctionalGaugeFloat64 constructs a new FunctionalGaugeFloat64.
 func NewFunctionalGaugeFloat64(f func() float64) GaugeFloat64 {
-	if UseNilMetrics {
+	if useNilMetrics() {
 		return NilGaugeFloat64{}
 	}
 	return &FunctionalGaugeFloat64{value: f}
 }
 
-// NewRegisteredFunctionalGauge constructs and registers a new StandardGauge.
+// NewRegisteredFunctionalGaugeFloat64 constructs and registers a new
+// FunctionalGaugeFloat64.
 func NewRegisteredFunctionalGaugeFloat64(name string, r Registry, f func() float64) GaugeFloat64 {
-	c := NewFunctionalGaugeFloat64(f)
 	if nil == r {
 		r = DefaultRegistry
 	}
+	if usesNilMetrics(r) {
+		return NilGaugeFloat64{}
+	}
+	c := NewFunctionalGaugeFloat64(f)
 	r.Register(name, c)
 	return c
 }
 
-// GaugeFloat64Snapshot is a read-only copy of another GaugeFloat64.
-type GaugeFloat64Snapshot float64
+// GaugeFloat64Snapshot is a read-only copy of another GaugeFloat64, which
+// records when it was taken.
+type GaugeFloat64Snapshot struct {
+	value     float64
+	timestamp time.Time
+}
+
+// NewGaugeFloat64Snapshot constructs a GaugeFloat64Snapshot of the given
+// value, taken at the given time, which is zero if it isn't known.
+func NewGaugeFloat64Snapshot(value float64, timestamp time.Time) GaugeFloat64Snapshot {
+	return GaugeFloat64Snapshot{value: value, timestamp: timestamp}
+}
 
 // Snapshot returns the snapshot.
 func (g GaugeFloat64Snapshot) Snapshot() GaugeFloat64 { return g }
 
+// Timestamp returns the time the snapshot was taken, or the zero time if it
+// isn't known.
+func (g GaugeFloat64Snapshot) Timestamp() time.Time { return g.timestamp }
+
 // Update panics.
 func (GaugeFloat64Snapshot) Update(float64) {
 	panic("Update called on a GaugeFloat64Snapshot")
 }
 
 // Value returns the value at the time the snapshot was taken.
-func (g GaugeFloat64Snapshot) Value() float64 { return float64(g) }
+func (g GaugeFloat64Snapshot) Value() float64 { return g.value }
 
 // NilGauge is a no-op Gauge.
 type NilGaugeFloat64 struct{}
 
+// AddDynamicTag is a no-op.
+func (NilGaugeFloat64) AddDynamicTag(string, func() string) error { return nil }
+
+// AddTags is a no-op.
+func (NilGaugeFloat64) AddTags(map[string]string) {}
+
+// GetTags is a no-op.
+func (NilGaugeFloat64) GetTags() map[string]string { return nil }
+
+// RemoveTag is a no-op.
+func (NilGaugeFloat64) RemoveTag(string) {}
+
+// SetTags is a no-op.
+func (NilGaugeFloat64) SetTags(map[string]string) {}
+
 // Snapshot is a no-op.
 func (NilGaugeFloat64) Snapshot() GaugeFloat64 { return NilGaugeFloat64{} }
 
@@ -83,45 +141,57 @@ func (NilGaugeFloat64) Update(v float64) {}
 func (NilGaugeFloat64) Value() float64 { return 0.0 }
 
 // StandardGaugeFloat64 is the standard implementation of a GaugeFloat64 and uses
-// sync.Mutex to manage a single float64 value.
+// the sync/atomic package to manage a single float64 value, stored as its IEEE
+// 754 bits in a uint64.
 type StandardGaugeFloat64 struct {
-	mutex sync.Mutex
-	value float64
+	tagSet
+	lastUpdate
+	updateTime
+
+	bits uint64
 }
 
 // Snapshot returns a read-only copy of the gauge.
 func (g *StandardGaugeFloat64) Snapshot() GaugeFloat64 {
-	return GaugeFloat64Snapshot(g.Value())
+	return GaugeFloat64Snapshot{value: g.Value(), timestamp: now()}
+}
+
+// ReadInto stores the gauge's value in s; see StandardCounter.ReadInto.
+func (g *StandardGaugeFloat64) ReadInto(s *GaugeFloat64Snapshot) {
+	*s = GaugeFloat64Snapshot{value: g.Value(), timestamp: now()}
 }
 
 // Update updates the gauge's value.
 func (g *StandardGaugeFloat64) Update(v float64) {
-	g.mutex.Lock()
-	defer g.mutex.Unlock()
-	g.value = v
+	g.touch()
+	g.stamp()
+	atomic.StoreUint64(&g.bits, math.Float64bits(v))
 }
 
 // Value returns the gauge's current value.
 func (g *StandardGaugeFloat64) Value() float64 {
-	g.mutex.Lock()
-	defer g.mutex.Unlock()
-	return g.value
+	return math.Float64frombits(atomic.LoadUint64(&g.bits))
 }
 
-// FunctionalGaugeFloat64 returns value from given function
+// FunctionalGaugeFloat64 returns value from given function, called whenever
+// the gauge is read or snapshotted, like a FunctionalGauge.
 type FunctionalGaugeFloat64 struct {
+	tagSet
+
 	value func() float64
 }
 
 // Value returns the gauge's current value.
-func (g FunctionalGaugeFloat64) Value() float64 {
+func (g *FunctionalGaugeFloat64) Value() float64 {
 	return g.value()
 }
 
 // Snapshot returns the snapshot.
-func (g FunctionalGaugeFloat64) Snapshot() GaugeFloat64 { return GaugeFloat64Snapshot(g.Value()) }
+func (g *FunctionalGaugeFloat64) Snapshot() GaugeFloat64 {
+	return GaugeFloat64Snapshot{value: g.Value(), timestamp: now()}
+}
 
 // Update panics.
-func (FunctionalGaugeFloat64) Update(float64) {
+func (*FunctionalGaugeFloat64) Update(float64) {
 	panic("Update called on a FunctionalGaugeFloat64")
 }
@@ -0,0 +1,225 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+)
+
+// MergeableGaugeFloat64s hold the mean of a series of float64 values along
+// with the number of values that contributed to it.  Unlike a GaugeFloat64,
+// which keeps only the last value, two MergeableGaugeFloat64s maintained
+// independently (e.g. one per shard or worker) can be merged into a correctly
+// weighted mean.
+type MergeableGaugeFloat64 interface {
+	Clear()
+	Count() int64
+	Merge(MergeableGaugeFloat64)
+	Snapshot() MergeableGaugeFloat64
+	Update(float64)
+	Value() float64
+}
+
+// GetOrRegisterMergeableGaugeFloat64 returns an existing
+// MergeableGaugeFloat64 or constructs and registers a new
+// StandardMergeableGaugeFloat64.
+func GetOrRegisterMergeableGaugeFloat64(name string, r Registry) MergeableGaugeFloat64 {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	return getOrRegister(r, name, NewMergeableGaugeFloat64, NilMergeableGaugeFloat64{}).(MergeableGaugeFloat64)
+}
+
+// GetOrRegisterMergeableGaugeFloat64T is GetOrRegisterCounterT for
+// MergeableGaugeFloat64s.
+func GetOrRegisterMergeableGaugeFloat64T(name string, tags map[string]string, r Registry) MergeableGaugeFloat64 {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	return getOrRegisterTagged(r, name, tags, func() interface{} { return NewMergeableGaugeFloat64() }, NilMergeableGaugeFloat64{}).(MergeableGaugeFloat64)
+}
+
+// NewMergeableGaugeFloat64 constructs a new StandardMergeableGaugeFloat64.
+func NewMergeableGaugeFloat64() MergeableGaugeFloat64 {
+	if useNilMetrics() {
+		return NilMergeableGaugeFloat64{}
+	}
+	return &StandardMergeableGaugeFloat64{}
+}
+
+// NewRegisteredMergeableGaugeFloat64 constructs and registers a new
+// StandardMergeableGaugeFloat64.
+func NewRegisteredMergeableGaugeFloat64(name string, r Registry) MergeableGaugeFloat64 {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	if usesNilMetrics(r) {
+		return NilMergeableGaugeFloat64{}
+	}
+	c := NewMergeableGaugeFloat64()
+	r.Register(name, c)
+	return c
+}
+
+// MergeableGaugeFloat64Snapshot is a read-only copy of another
+// MergeableGaugeFloat64.
+type MergeableGaugeFloat64Snapshot struct {
+	count     int64
+	value     float64
+	timestamp time.Time
+}
+
+// Clear panics.
+func (*MergeableGaugeFloat64Snapshot) Clear() {
+	panic("Clear called on a MergeableGaugeFloat64Snapshot")
+}
+
+// Count returns the number of values contributing to the mean at the time the
+// snapshot was taken.
+func (g *MergeableGaugeFloat64Snapshot) Count() int64 { return g.count }
+
+// Merge panics.
+func (*MergeableGaugeFloat64Snapshot) Merge(MergeableGaugeFloat64) {
+	panic("Merge called on a MergeableGaugeFloat64Snapshot")
+}
+
+// Snapshot returns the snapshot.
+func (g *MergeableGaugeFloat64Snapshot) Snapshot() MergeableGaugeFloat64 { return g }
+
+// Update panics.
+func (*MergeableGaugeFloat64Snapshot) Update(float64) {
+	panic("Update called on a MergeableGaugeFloat64Snapshot")
+}
+
+// Timestamp returns the time the snapshot was taken, by the clock set by
+// SetClock.
+func (g *MergeableGaugeFloat64Snapshot) Timestamp() time.Time { return g.timestamp }
+
+// Value returns the mean at the time the snapshot was taken.
+func (g *MergeableGaugeFloat64Snapshot) Value() float64 { return g.value }
+
+// NilMergeableGaugeFloat64 is a no-op MergeableGaugeFloat64.
+type NilMergeableGaugeFloat64 struct{}
+
+// AddDynamicTag is a no-op.
+func (NilMergeableGaugeFloat64) AddDynamicTag(string, func() string) error { return nil }
+
+// AddTags is a no-op.
+func (NilMergeableGaugeFloat64) AddTags(map[string]string) {}
+
+// Clear is a no-op.
+func (NilMergeableGaugeFloat64) Clear() {}
+
+// Count is a no-op.
+func (NilMergeableGaugeFloat64) Count() int64 { return 0 }
+
+// GetTags is a no-op.
+func (NilMergeableGaugeFloat64) GetTags() map[string]string { return nil }
+
+// Merge is a no-op.
+func (NilMergeableGaugeFloat64) Merge(MergeableGaugeFloat64) {}
+
+// RemoveTag is a no-op.
+func (NilMergeableGaugeFloat64) RemoveTag(string) {}
+
+// SetTags is a no-op.
+func (NilMergeableGaugeFloat64) SetTags(map[string]string) {}
+
+// Snapshot is a no-op.
+func (NilMergeableGaugeFloat64) Snapshot() MergeableGaugeFloat64 {
+	return NilMergeableGaugeFloat64{}
+}
+
+// Update is a no-op.
+func (NilMergeableGaugeFloat64) Update(v float64) {}
+
+// Value is a no-op.
+func (NilMergeableGaugeFloat64) Value() float64 { return 0.0 }
+
+// StandardMergeableGaugeFloat64 is the standard implementation of a
+// MergeableGaugeFloat64 and uses sync.Mutex to manage the running sum and
+// count of values.
+type StandardMergeableGaugeFloat64 struct {
+	tagSet
+	lastUpdate
+	updateTime
+
+	count int64
+	mutex sync.Mutex
+	sum   float64
+}
+
+// Clear discards all values, resetting the mean and the count to zero.
+func (g *StandardMergeableGaugeFloat64) Clear() {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.count = 0
+	g.sum = 0.0
+}
+
+// Count returns the number of values contributing to the mean.
+func (g *StandardMergeableGaugeFloat64) Count() int64 {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return g.count
+}
+
+// Merge combines the values of another MergeableGaugeFloat64 into this one.
+// The resulting mean is weighted by the count of each gauge.  The other gauge
+// is left untouched.
+func (g *StandardMergeableGaugeFloat64) Merge(other MergeableGaugeFloat64) {
+	// Snapshot first so that merging a gauge into itself doesn't deadlock.
+	s := other.Snapshot()
+	count := s.Count()
+	if 0 == count {
+		return
+	}
+	g.touch()
+	g.stamp()
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.count += count
+	g.sum += s.Value() * float64(count)
+}
+
+// Snapshot returns a read-only copy of the gauge.
+func (g *StandardMergeableGaugeFloat64) Snapshot() MergeableGaugeFloat64 {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return &MergeableGaugeFloat64Snapshot{count: g.count, value: g.value(), timestamp: now()}
+}
+
+// snapshotAndReset returns a read-only copy of the gauge and atomically
+// resets the mean and the count to zero.
+func (g *StandardMergeableGaugeFloat64) snapshotAndReset() interface{} {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	snapshot := &MergeableGaugeFloat64Snapshot{count: g.count, value: g.value(), timestamp: now()}
+	g.count = 0
+	g.sum = 0.0
+	return snapshot
+}
+
+// Update adds a value to the mean and increments the count.
+func (g *StandardMergeableGaugeFloat64) Update(v float64) {
+	g.touch()
+	g.stamp()
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.count++
+	g.sum += v
+}
+
+// Value returns the mean of all values contributing to the gauge.
+func (g *StandardMergeableGaugeFloat64) Value() float64 {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return g.value()
+}
+
+func (g *StandardMergeableGaugeFloat64) value() float64 {
+	// should run with g.mutex held
+	if 0 == g.count {
+		return 0.0
+	}
+	return g.sum / float64(g.count)
+}
@@ -0,0 +1,99 @@
+package metrics
+
+import "testing"
+
+func BenchmarkMergeableGaugeFloat64(b *testing.B) {
+	g := NewMergeableGaugeFloat64()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		g.Update(float64(i))
+	}
+}
+
+func TestMergeableGaugeFloat64(t *testing.T) {
+	g := NewMergeableGaugeFloat64()
+	g.Update(1.0)
+	g.Update(2.0)
+	g.Update(6.0)
+	if v := g.Value(); 3.0 != v {
+		t.Errorf("g.Value(): 3.0 != %v\n", v)
+	}
+	if count := g.Count(); 3 != count {
+		t.Errorf("g.Count(): 3 != %v\n", count)
+	}
+}
+
+func TestMergeableGaugeFloat64Clear(t *testing.T) {
+	g := NewMergeableGaugeFloat64()
+	g.Update(47.0)
+	g.Clear()
+	if v := g.Value(); 0.0 != v {
+		t.Errorf("g.Value(): 0.0 != %v\n", v)
+	}
+	if count := g.Count(); 0 != count {
+		t.Errorf("g.Count(): 0 != %v\n", count)
+	}
+}
+
+func TestMergeableGaugeFloat64Merge(t *testing.T) {
+	a, b := NewMergeableGaugeFloat64(), NewMergeableGaugeFloat64()
+	a.Update(10.0)
+	b.Update(1.0)
+	b.Update(2.0)
+	b.Update(3.0)
+	a.Merge(b)
+	if v := a.Value(); 4.0 != v {
+		t.Errorf("a.Value(): 4.0 != %v\n", v)
+	}
+	if count := a.Count(); 4 != count {
+		t.Errorf("a.Count(): 4 != %v\n", count)
+	}
+	if count := b.Count(); 3 != count {
+		t.Errorf("b.Count(): 3 != %v\n", count)
+	}
+}
+
+func TestMergeableGaugeFloat64MergeEmpty(t *testing.T) {
+	g := NewMergeableGaugeFloat64()
+	g.Update(47.0)
+	g.Merge(NewMergeableGaugeFloat64())
+	if v := g.Value(); 47.0 != v {
+		t.Errorf("g.Value(): 47.0 != %v\n", v)
+	}
+	if count := g.Count(); 1 != count {
+		t.Errorf("g.Count(): 1 != %v\n", count)
+	}
+}
+
+func TestMergeableGaugeFloat64MergeSelf(t *testing.T) {
+	g := NewMergeableGaugeFloat64()
+	g.Update(47.0)
+	g.Merge(g)
+	if v := g.Value(); 47.0 != v {
+		t.Errorf("g.Value(): 47.0 != %v\n", v)
+	}
+	if count := g.Count(); 2 != count {
+		t.Errorf("g.Count(): 2 != %v\n", count)
+	}
+}
+
+func TestMergeableGaugeFloat64Snapshot(t *testing.T) {
+	g := NewMergeableGaugeFloat64()
+	g.Update(47.0)
+	snapshot := g.Snapshot()
+	g.Update(0.0)
+	if v := snapshot.Value(); 47.0 != v {
+		t.Errorf("snapshot.Value(): 47.0 != %v\n", v)
+	}
+	if count := snapshot.Count(); 1 != count {
+		t.Errorf("snapshot.Count(): 1 != %v\n", count)
+	}
+}
+
+func TestGetOrRegisterMergeableGaugeFloat64(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredMergeableGaugeFloat64("foo", r).Update(47.0)
+	if g := GetOrRegisterMergeableGaugeFloat64("foo", r); 47.0 != g.Value() {
+		t.Fatal(g)
+	}
+}
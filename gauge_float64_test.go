@@ -1,6 +1,10 @@
 package metrics
 
-import "testing"
+import (
+	"math"
+	"sync"
+	"testing"
+)
 
 func BenchmarkGuageFloat64(b *testing.B) {
 	g := NewGaugeFloat64()
@@ -18,6 +22,69 @@ func TestGaugeFloat64(t *testing.T) {
 	}
 }
 
+func TestGaugeFloat64SpecialValues(t *testing.T) {
+	g := NewGaugeFloat64()
+	g.Update(math.Copysign(0, -1))
+	if v := g.Value(); 0 != v || !math.Signbit(v) {
+		t.Errorf("g.Value(): -0 != %v\n", v)
+	}
+	g.Update(math.Inf(1))
+	if v := g.Value(); !math.IsInf(v, 1) {
+		t.Errorf("g.Value(): +Inf != %v\n", v)
+	}
+	g.Update(math.NaN())
+	if v := g.Value(); !math.IsNaN(v) {
+		t.Errorf("g.Value(): NaN != %v\n", v)
+	}
+}
+
+func TestGaugeFloat64Concurrent(t *testing.T) {
+	g := NewGaugeFloat64()
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				g.Update(float64(i))
+				if v := g.Value(); v < 0 || v > 3 || v != math.Trunc(v) {
+					t.Error(v)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestGetOrRegisterFunctionalGaugeFloat64IsLazy(t *testing.T) {
+	r := NewRegistry()
+	var calls int64
+	g := GetOrRegisterFunctionalGaugeFloat64("pool.utilization", r, func() float64 {
+		calls++
+		return 0.5
+	})
+	if 0 != calls {
+		t.Errorf("calls before reading: 0 != %v\n", calls)
+	}
+	if g2 := GetOrRegisterFunctionalGaugeFloat64("pool.utilization", r, func() float64 { return 0 }); g2 != g {
+		t.Errorf("GetOrRegisterFunctionalGaugeFloat64 replaced %v with %v\n", g, g2)
+	}
+	if v := g.Snapshot().Value(); 0.5 != v {
+		t.Errorf("g.Snapshot().Value(): 0.5 != %v\n", v)
+	}
+	if 1 != calls {
+		t.Errorf("calls after a snapshot: 1 != %v\n", calls)
+	}
+}
+
+func TestFunctionalGaugeFloat64Tags(t *testing.T) {
+	fg := NewFunctionalGaugeFloat64(func() float64 { return 47 }).(Taggable)
+	fg.AddTags(map[string]string{"cpu": "0"})
+	if tags := fg.GetTags(); "0" != tags["cpu"] {
+		t.Errorf("fg.GetTags(): %v\n", tags)
+	}
+}
+
 func TestGaugeFloat64Snapshot(t *testing.T) {
 	g := NewGaugeFloat64()
 	g.Update(float64(47.0))
@@ -0,0 +1,184 @@
+package metrics
+
+import (
+	"math"
+	"sync/atomic"
+)
+
+// PeakGauges hold the highest or lowest value they've been updated with since
+// they were last reset, e.g. the peak depth of a queue in each flush
+// interval, which a gauge sampled at flush time would miss.  They're reset by
+// Clear and by SnapshotAndReset, so a reporter with Reset set reports the
+// peak of each interval; otherwise they hold the peak since they were made.
+type PeakGauge interface {
+	Gauge
+	Clear()
+}
+
+// GetOrRegisterMaxGauge returns an existing PeakGauge or constructs and
+// registers a new StandardPeakGauge holding the highest value.
+func GetOrRegisterMaxGauge(name string, r Registry) PeakGauge {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	return getOrRegister(r, name, NewMaxGauge, NilPeakGauge{}).(PeakGauge)
+}
+
+// GetOrRegisterMaxGaugeT returns the existing PeakGauge identified by name and
+// tags together or constructs and registers a new one holding the highest
+// value and carrying the tags; see GetOrRegisterCounterT.
+func GetOrRegisterMaxGaugeT(name string, tags map[string]string, r Registry) PeakGauge {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	return getOrRegisterTagged(r, name, tags, func() interface{} { return NewMaxGauge() }, NilPeakGauge{}).(PeakGauge)
+}
+
+// GetOrRegisterMinGauge returns an existing PeakGauge or constructs and
+// registers a new StandardPeakGauge holding the lowest value.
+func GetOrRegisterMinGauge(name string, r Registry) PeakGauge {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	return getOrRegister(r, name, NewMinGauge, NilPeakGauge{}).(PeakGauge)
+}
+
+// GetOrRegisterMinGaugeT returns the existing PeakGauge identified by name and
+// tags together or constructs and registers a new one holding the lowest
+// value and carrying the tags; see GetOrRegisterCounterT.
+func GetOrRegisterMinGaugeT(name string, tags map[string]string, r Registry) PeakGauge {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	return getOrRegisterTagged(r, name, tags, func() interface{} { return NewMinGauge() }, NilPeakGauge{}).(PeakGauge)
+}
+
+// NewMaxGauge constructs a new StandardPeakGauge holding the highest value.
+func NewMaxGauge() PeakGauge {
+	if useNilMetrics() {
+		return NilPeakGauge{}
+	}
+	return &StandardPeakGauge{value: math.MinInt64}
+}
+
+// NewMinGauge constructs a new StandardPeakGauge holding the lowest value.
+func NewMinGauge() PeakGauge {
+	if useNilMetrics() {
+		return NilPeakGauge{}
+	}
+	return &StandardPeakGauge{min: true, value: math.MaxInt64}
+}
+
+// NewRegisteredMaxGauge constructs and registers a new StandardPeakGauge
+// holding the highest value.
+func NewRegisteredMaxGauge(name string, r Registry) PeakGauge {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	if usesNilMetrics(r) {
+		return NilPeakGauge{}
+	}
+	g := NewMaxGauge()
+	r.Register(name, g)
+	return g
+}
+
+// NewRegisteredMinGauge constructs and registers a new StandardPeakGauge
+// holding the lowest value.
+func NewRegisteredMinGauge(name string, r Registry) PeakGauge {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	if usesNilMetrics(r) {
+		return NilPeakGauge{}
+	}
+	g := NewMinGauge()
+	r.Register(name, g)
+	return g
+}
+
+// NilPeakGauge is a no-op PeakGauge.
+type NilPeakGauge struct {
+	NilGauge
+}
+
+// Clear is a no-op.
+func (NilPeakGauge) Clear() {}
+
+// StandardPeakGauge is the standard implementation of a PeakGauge.  It holds
+// the peak in a single int64, updated by compare-and-swap, with the lowest
+// int64 standing for no value since a max gauge was reset and the highest for
+// a min gauge.
+type StandardPeakGauge struct {
+	tagSet
+	lastUpdate
+
+	min   bool
+	value int64
+}
+
+// Clear resets the gauge, so that it holds no value until it's next updated.
+func (g *StandardPeakGauge) Clear() {
+	atomic.StoreInt64(&g.value, g.empty())
+}
+
+// Snapshot returns a read-only copy of the gauge.
+func (g *StandardPeakGauge) Snapshot() Gauge {
+	return GaugeSnapshot{value: g.Value(), timestamp: now()}
+}
+
+// Update sets the gauge's value to v if it's beyond the peak so far.
+func (g *StandardPeakGauge) Update(v int64) {
+	g.touch()
+	if g.min {
+		updateIfMin(&g.value, v)
+	} else {
+		updateIfMax(&g.value, v)
+	}
+}
+
+// Value returns the peak since the gauge was reset, or zero if it hasn't been
+// updated since.
+func (g *StandardPeakGauge) Value() int64 {
+	return g.peak(atomic.LoadInt64(&g.value))
+}
+
+func (g *StandardPeakGauge) empty() int64 {
+	if g.min {
+		return math.MaxInt64
+	}
+	return math.MinInt64
+}
+
+func (g *StandardPeakGauge) peak(v int64) int64 {
+	if g.empty() == v {
+		return 0
+	}
+	return v
+}
+
+// snapshotAndReset returns a read-only copy of the gauge and atomically
+// resets it.
+func (g *StandardPeakGauge) snapshotAndReset() interface{} {
+	return GaugeSnapshot{value: g.peak(atomic.SwapInt64(&g.value, g.empty())), timestamp: now()}
+}
+
+// updateIfMax stores v at addr if it's greater than the value there.
+func updateIfMax(addr *int64, v int64) {
+	for {
+		old := atomic.LoadInt64(addr)
+		if v <= old || atomic.CompareAndSwapInt64(addr, old, v) {
+			return
+		}
+	}
+}
+
+// updateIfMin stores v at addr if it's less than the value there.
+func updateIfMin(addr *int64, v int64) {
+	for {
+		old := atomic.LoadInt64(addr)
+		if v >= old || atomic.CompareAndSwapInt64(addr, old, v) {
+			return
+		}
+	}
+}
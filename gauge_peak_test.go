@@ -0,0 +1,86 @@
+package metrics
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestMaxGauge(t *testing.T) {
+	g := NewMaxGauge()
+	if v := g.Value(); 0 != v {
+		t.Errorf("g.Value(): 0 != %v\n", v)
+	}
+	g.Update(-3)
+	if v := g.Value(); -3 != v {
+		t.Errorf("g.Value(): -3 != %v\n", v)
+	}
+	g.Update(7)
+	g.Update(2)
+	snapshot := g.Snapshot()
+	g.Update(9)
+	if v := snapshot.Value(); 7 != v {
+		t.Errorf("snapshot.Value(): 7 != %v\n", v)
+	}
+	if v := g.Value(); 9 != v {
+		t.Errorf("g.Value(): 9 != %v\n", v)
+	}
+	g.Clear()
+	if v := g.Value(); 0 != v {
+		t.Errorf("g.Value() after Clear: 0 != %v\n", v)
+	}
+}
+
+func TestMinGauge(t *testing.T) {
+	g := NewMinGauge()
+	if v := g.Value(); 0 != v {
+		t.Errorf("g.Value(): 0 != %v\n", v)
+	}
+	g.Update(7)
+	g.Update(3)
+	g.Update(5)
+	if v := g.Value(); 3 != v {
+		t.Errorf("g.Value(): 3 != %v\n", v)
+	}
+}
+
+func TestMaxGaugeConcurrent(t *testing.T) {
+	g := NewMaxGauge()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				g.Update(int64(i*1000 + j))
+			}
+		}(i)
+	}
+	wg.Wait()
+	if v := g.Value(); 7999 != v {
+		t.Errorf("g.Value(): 7999 != %v\n", v)
+	}
+}
+
+func TestPeakGaugeSnapshotAndReset(t *testing.T) {
+	r := NewRegistry()
+	g := GetOrRegisterMaxGauge("queue.depth.max", r)
+	g.Update(12)
+	g.Update(4)
+	if v := r.SnapshotAndReset().Get("queue.depth.max").(Gauge).Value(); 12 != v {
+		t.Errorf("SnapshotAndReset(): 12 != %v\n", v)
+	}
+	if v := g.Value(); 0 != v {
+		t.Errorf("g.Value() after SnapshotAndReset: 0 != %v\n", v)
+	}
+}
+
+func TestGetOrRegisterPeakGaugeNil(t *testing.T) {
+	if _, ok := GetOrRegisterMinGauge("foo", NilRegistry{}).(NilPeakGauge); !ok {
+		t.Error(GetOrRegisterMinGauge("foo", NilRegistry{}))
+	}
+	r := NewRegistry()
+	g := GetOrRegisterMaxGaugeT("foo", map[string]string{"queue": "a"}, r)
+	if g2 := GetOrRegisterMaxGaugeT("foo", map[string]string{"queue": "a"}, r); g != g2 {
+		t.Error(g2)
+	}
+}
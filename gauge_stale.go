@@ -0,0 +1,149 @@
+package metrics
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// staleNaNBits are the bits of StaleNaN.
+const staleNaNBits = 0x7ff0000000000002
+
+// StaleNaN is the value RegistrySnapshot.MarkStale gives the gauges it finds
+// stale: the NaN by which Prometheus marks series as stale, which is distinct
+// from the NaN of math.NaN, so that a backend can tell a gauge which stopped
+// being updated from one holding NaN.
+var StaleNaN = math.Float64frombits(staleNaNBits)
+
+// IsStaleNaN returns true if f is StaleNaN rather than any other NaN.
+func IsStaleNaN(f float64) bool { return staleNaNBits == math.Float64bits(f) }
+
+// isStale returns true if i is the snapshot of a gauge MarkStale marked.
+func isStale(i interface{}) bool {
+	g, ok := i.(GaugeFloat64Snapshot)
+	return ok && IsStaleNaN(g.value)
+}
+
+// updateTime is embedded in the standard gauges to record when they were
+// last updated for RegistrySnapshot.Stale.  Unlike lastUpdate it reads the
+// clock on every update, so that a gauge updated just before a flush isn't
+// taken for stale; gauges are seldom updated often enough for that to cost.
+// The zero value has never been updated.
+type updateTime struct {
+	nanos int64
+}
+
+// UpdatedAt returns when the gauge was last updated, by the clock set by
+// SetClock, or the zero time if it never has been.
+func (u *updateTime) UpdatedAt() time.Time {
+	nanos := atomic.LoadInt64(&u.nanos)
+	if 0 == nanos {
+		return time.Time{}
+	}
+	return time.Unix(0, nanos)
+}
+
+func (u *updateTime) stamp() {
+	atomic.StoreInt64(&u.nanos, now().UnixNano())
+}
+
+// stamp records when the given metric, whose snapshot is by the given name,
+// was last updated if it's a gauge recording its updates.
+func (s *RegistrySnapshot) stamp(name string, i interface{}) {
+	u, ok := i.(interface{ UpdatedAt() time.Time })
+	if !ok {
+		return
+	}
+	if at := u.UpdatedAt(); !at.IsZero() {
+		if nil == s.updated {
+			s.updated = make(map[string]time.Time)
+		}
+		s.updated[name] = at
+	}
+}
+
+// gaugesUpdated returns when each gauge registered in r which records its
+// updates was last updated, by name with the default tags of the registry at
+// the root of r, or nil if none has been, for a RegistrySnapshot which isn't
+// taken of the gauges themselves.  The metrics a DeltaRegistry passes are
+// snapshots already, so nothing is known of its gauges, and walking it would
+// move its consumer on.
+func gaugesUpdated(r Registry) map[string]time.Time {
+	if _, ok := r.(*DeltaRegistry); ok {
+		return nil
+	}
+	s := getEachScratch()
+	defer s.release()
+	s.names, s.metrics = appendRegistered(r, s.names, s.metrics)
+	defaults := defaultTagsOf(r)
+	stamped := &RegistrySnapshot{}
+	for i, name := range s.names {
+		stamped.stamp(withDefaultTags(name, defaults), s.metrics[i])
+	}
+	return stamped.updated
+}
+
+// LastUpdated returns when the gauge by the given name, which includes any
+// tags, was last updated, or the zero time if it never has been or isn't a
+// standard gauge, e.g. a functional gauge, or the snapshots were decoded by
+// UnmarshalSnapshot and the like.
+func (s *RegistrySnapshot) LastUpdated(name string) time.Time {
+	return s.updated[TaggedName(name, nil)]
+}
+
+// Stale returns true if the snapshot by the given name, which includes any
+// tags, is of a gauge last updated longer than age before the snapshots were
+// taken, e.g. one whose producer goroutine has died.  Gauges which have
+// never been updated, and those of which LastUpdated knows nothing, are never
+// stale.
+func (s *RegistrySnapshot) Stale(name string, age time.Duration) bool {
+	return s.stale(TaggedName(name, nil), age)
+}
+
+func (s *RegistrySnapshot) stale(name string, age time.Duration) bool {
+	updated, ok := s.updated[name]
+	return ok && updated.Before(s.timestamp.Add(-age))
+}
+
+// WithoutStale returns the snapshots without those of the gauges Stale finds
+// stale for age, so that a dashboard stops showing their frozen values, or s
+// if age isn't positive.
+func (s *RegistrySnapshot) WithoutStale(age time.Duration) *RegistrySnapshot {
+	if age <= 0 || 0 == len(s.updated) {
+		return s
+	}
+	return s.Filter(func(name string) bool { return !s.stale(name, age) })
+}
+
+// MarkStale returns a copy of the snapshots in which those of the gauges Stale
+// finds stale for age are replaced by GaugeFloat64Snapshots of StaleNaN, for
+// backends which understand it, or s if age isn't positive.  Aggregate leaves
+// marked gauges out of the sums of those which aren't.
+func (s *RegistrySnapshot) MarkStale(age time.Duration) *RegistrySnapshot {
+	if age <= 0 || 0 == len(s.updated) {
+		return s
+	}
+	marked := &RegistrySnapshot{
+		names:       s.names,
+		metrics:     make(map[string]interface{}, len(s.metrics)),
+		percentiles: s.percentiles,
+		timestamp:   s.timestamp,
+		updated:     s.updated,
+	}
+	for name, i := range s.metrics {
+		if s.stale(name, age) {
+			i = GaugeFloat64Snapshot{value: StaleNaN, timestamp: s.timestamp}
+		}
+		marked.metrics[name] = i
+	}
+	return marked
+}
+
+// withoutStale returns the snapshots without stale gauges or with them marked
+// stale, as a reporter's StaleAfter and MarkStale say.
+func (s *RegistrySnapshot) withoutStale(age time.Duration, mark bool) *RegistrySnapshot {
+	if mark {
+		return s.MarkStale(age)
+	}
+	return s.WithoutStale(age)
+}
@@ -0,0 +1,113 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRegistrySnapshotStale(t *testing.T) {
+	clock := &stepClock{now: time.Unix(100, 0)}
+	SetClock(clock)
+	defer SetClock(nil)
+	r := NewRegistry()
+	dead := NewRegisteredGauge("workers.dead", r)
+	dead.Update(1)
+	live := NewRegisteredGaugeFloat64("workers.live", r)
+	NewRegisteredFunctionalGauge("workers.functional", r, func() int64 { return 3 })
+	NewRegisteredCounter("requests", r)
+	r.Snapshot()
+
+	clock.now = clock.now.Add(time.Minute)
+	live.Update(2)
+	s := r.Snapshot()
+	if !s.Stale("workers.dead", 30*time.Second) {
+		t.Error("workers.dead: not stale\n")
+	}
+	if s.Stale("workers.dead", 2*time.Minute) {
+		t.Error("workers.dead: stale for 2m\n")
+	}
+	for _, name := range []string{"workers.live", "workers.functional", "requests"} {
+		if s.Stale(name, 30*time.Second) {
+			t.Errorf("%s: stale\n", name)
+		}
+	}
+	if updated := s.LastUpdated("workers.dead"); !updated.Equal(time.Unix(100, 0)) {
+		t.Errorf("s.LastUpdated(): %v\n", updated)
+	}
+
+	if names := s.WithoutStale(30 * time.Second).Names(); 3 != len(names) || nil != s.WithoutStale(30*time.Second).Get("workers.dead") {
+		t.Errorf("s.WithoutStale(): %v\n", names)
+	}
+	marked := s.MarkStale(30 * time.Second)
+	if g, ok := marked.Get("workers.dead").(GaugeFloat64Snapshot); !ok || !IsStaleNaN(g.Value()) {
+		t.Errorf("s.MarkStale(): %v\n", marked.Get("workers.dead"))
+	}
+	if 1 != s.Get("workers.dead").(Gauge).Value() {
+		t.Error("s.MarkStale() changed s\n")
+	}
+}
+
+func TestRegistrySnapshotStaleAggregate(t *testing.T) {
+	clock := &stepClock{now: time.Unix(100, 0)}
+	SetClock(clock)
+	defer SetClock(nil)
+	r := NewRegistry()
+	GetOrRegisterGaugeFloat64T("queue", map[string]string{"pod": "a"}, r).Update(5)
+	b := GetOrRegisterGaugeFloat64T("queue", map[string]string{"pod": "b"}, r)
+	r.Snapshot()
+	clock.now = clock.now.Add(time.Minute)
+	b.Update(2)
+
+	s := r.Snapshot().MarkStale(30 * time.Second).Aggregate("pod")
+	if v := s.Get("queue").(GaugeFloat64).Value(); 2 != v {
+		t.Errorf("queue: 2 != %v\n", v)
+	}
+	if s.Stale("queue", 30*time.Second) {
+		t.Error("queue: stale\n")
+	}
+}
+
+func TestMultiReporterStaleAfter(t *testing.T) {
+	clock := &stepClock{now: time.Unix(100, 0)}
+	SetClock(clock)
+	defer SetClock(nil)
+	r := NewRegistry()
+	NewRegisteredGauge("workers.dead", r).Update(1)
+	NewRegisteredCounter("requests", r).Inc(1)
+	r.Snapshot()
+	clock.now = clock.now.Add(time.Minute)
+
+	var buf bytes.Buffer
+	m := NewMultiReporter(r)
+	m.Add(NewEncodingReporter(r, TextEncoder{}, &buf), ReporterFilter{StaleAfter: 30 * time.Second})
+	if err := m.Flush(); nil != err {
+		t.Fatal(err)
+	}
+	if got := buf.String(); strings.Contains(got, "workers.dead") || !strings.Contains(got, "requests") {
+		t.Errorf("flushed: %q\n", got)
+	}
+}
+
+func TestEncodingReporterStaleAfterReset(t *testing.T) {
+	clock := &stepClock{now: time.Unix(100, 0)}
+	SetClock(clock)
+	defer SetClock(nil)
+	r := NewRegistry()
+	NewRegisteredGauge("workers.dead", r).Update(1)
+	clock.now = clock.now.Add(time.Minute)
+	NewRegisteredGauge("workers.live", r).Update(2)
+
+	var buf bytes.Buffer
+	e := NewEncodingReporter(r, TextEncoder{}, &buf)
+	e.Reset = true
+	e.StaleAfter = 30 * time.Second
+	e.MarkStale = true
+	if err := e.Flush(); nil != err {
+		t.Fatal(err)
+	}
+	if got := buf.String(); !strings.Contains(got, "workers.dead") || !strings.Contains(got, "NaN") || !strings.Contains(got, "workers.live") {
+		t.Errorf("flushed: %q\n", got)
+	}
+}
@@ -3,6 +3,7 @@ package metrics
 import (
 	"fmt"
 	"testing"
+	"time"
 )
 
 func BenchmarkGuage(b *testing.B) {
@@ -13,6 +14,16 @@ func BenchmarkGuage(b *testing.B) {
 	}
 }
 
+func BenchmarkGaugeSnapshot(b *testing.B) {
+	g := NewGauge()
+	g.Update(1 << 40)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		g.Snapshot()
+	}
+}
+
 func TestGauge(t *testing.T) {
 	g := NewGauge()
 	g.Update(int64(47))
@@ -21,6 +32,24 @@ func TestGauge(t *testing.T) {
 	}
 }
 
+func TestGaugeUpdateIfMaxMin(t *testing.T) {
+	g := NewGauge().(*StandardGauge)
+	g.Update(5)
+	g.UpdateIfMax(3)
+	if v := g.Value(); 5 != v {
+		t.Errorf("g.Value(): 5 != %v\n", v)
+	}
+	g.UpdateIfMax(8)
+	if v := g.Value(); 8 != v {
+		t.Errorf("g.Value(): 8 != %v\n", v)
+	}
+	g.UpdateIfMin(9)
+	g.UpdateIfMin(-1)
+	if v := g.Value(); -1 != v {
+		t.Errorf("g.Value(): -1 != %v\n", v)
+	}
+}
+
 func TestGaugeSnapshot(t *testing.T) {
 	g := NewGauge()
 	g.Update(int64(47))
@@ -31,6 +60,25 @@ func TestGaugeSnapshot(t *testing.T) {
 	}
 }
 
+func TestGaugeSnapshotAllocs(t *testing.T) {
+	clock := &stepClock{now: time.Unix(100, 0)}
+	SetClock(clock)
+	defer SetClock(nil)
+	g := NewGauge()
+	g.Update(1 << 40)
+	var snapshot Gauge
+	if allocs := testing.AllocsPerRun(100, func() { snapshot = g.Snapshot() }); 0 != allocs {
+		t.Errorf("g.Snapshot(): 0 != %v allocations\n", allocs)
+	}
+	if v := snapshot.Value(); 1<<40 != v {
+		t.Errorf("snapshot.Value(): 1<<40 != %v\n", v)
+	}
+	g.Update(1)
+	if v := g.Snapshot().Value(); 1 != v {
+		t.Errorf("g.Snapshot().Value(): 1 != %v\n", v)
+	}
+}
+
 func TestGetOrRegisterGauge(t *testing.T) {
 	r := NewRegistry()
 	NewRegisteredGauge("foo", r).Update(47)
@@ -60,6 +108,37 @@ func TestGetOrRegisterFunctionalGauge(t *testing.T) {
 	}
 }
 
+func TestGetOrRegisterFunctionalGaugeIsLazy(t *testing.T) {
+	r := NewRegistry()
+	var calls int64
+	g := GetOrRegisterFunctionalGauge("queue.length", r, func() int64 {
+		calls++
+		return 47
+	})
+	if 0 != calls {
+		t.Errorf("calls before reading: 0 != %v\n", calls)
+	}
+	if g2 := GetOrRegisterFunctionalGauge("queue.length", r, func() int64 { return 0 }); g2 != g {
+		t.Errorf("GetOrRegisterFunctionalGauge replaced %v with %v\n", g, g2)
+	}
+	r.EachSnapshot(func(name string, i interface{}) {
+		if v := i.(Gauge).Value(); 47 != v {
+			t.Errorf("%s: 47 != %v\n", name, v)
+		}
+	})
+	if 1 != calls {
+		t.Errorf("calls after a snapshot: 1 != %v\n", calls)
+	}
+}
+
+func TestFunctionalGaugeTags(t *testing.T) {
+	fg := NewFunctionalGauge(func() int64 { return 47 }).(Taggable)
+	fg.AddTags(map[string]string{"cache": "users"})
+	if tags := fg.GetTags(); "users" != tags["cache"] {
+		t.Errorf("fg.GetTags(): %v\n", tags)
+	}
+}
+
 func ExampleGetOrRegisterGauge() {
 	m := "server.bytes_sent"
 	g := GetOrRegisterGauge(m, nil)
@@ -0,0 +1,62 @@
+package metrics
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"strconv"
+)
+
+// The opcodes of pickle protocol 2 which graphitePickle uses.
+const (
+	pickleProto      = 0x80
+	pickleEmptyList  = ']'
+	pickleMark       = '('
+	pickleBinUnicode = 'X'
+	pickleBinInt     = 'J'
+	pickleLong1      = 0x8a
+	pickleBinFloat   = 'G'
+	pickleTuple2     = 0x86
+	pickleAppends    = 'e'
+	pickleStop       = '.'
+)
+
+// graphitePickle encodes the datapoints as carbon's pickle receiver reads
+// them: a pickled list of (path, (timestamp, value)) tuples, preceded by its
+// length as a four-byte big-endian integer.
+func graphitePickle(points []graphitePoint) []byte {
+	var buf bytes.Buffer
+	buf.Write([]byte{0, 0, 0, 0})
+	buf.Write([]byte{pickleProto, 2, pickleEmptyList, pickleMark})
+	var b [8]byte
+	for _, p := range points {
+		buf.WriteByte(pickleBinUnicode)
+		binary.LittleEndian.PutUint32(b[:4], uint32(len(p.path)))
+		buf.Write(b[:4])
+		buf.WriteString(p.path)
+		if p.timestamp >= math.MinInt32 && p.timestamp <= math.MaxInt32 {
+			buf.WriteByte(pickleBinInt)
+			binary.LittleEndian.PutUint32(b[:4], uint32(p.timestamp))
+			buf.Write(b[:4])
+		} else {
+			buf.Write([]byte{pickleLong1, 8})
+			binary.LittleEndian.PutUint64(b[:], uint64(p.timestamp))
+			buf.Write(b[:])
+		}
+		// Values are rendered as the plaintext protocol writes them, so
+		// they parse, but one which somehow didn't is sent as NaN rather
+		// than dropped.
+		value, err := strconv.ParseFloat(p.value, 64)
+		if nil != err {
+			value = math.NaN()
+		}
+		buf.WriteByte(pickleBinFloat)
+		binary.BigEndian.PutUint64(b[:], math.Float64bits(value))
+		buf.Write(b[:])
+		buf.Write([]byte{pickleTuple2, pickleTuple2})
+	}
+	buf.Write([]byte{pickleAppends, pickleStop})
+	pickle := buf.Bytes()
+	binary.BigEndian.PutUint32(pickle, uint32(len(pickle)-4))
+	return pickle
+}
@@ -1,7 +1,20 @@
 package metrics
 
 import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
 	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
 	"time"
 )
 
@@ -20,3 +33,269 @@ func ExampleGraphiteWithConfig() {
 		Percentiles:   []float64{0.5, 0.75, 0.99, 0.999},
 	})
 }
+
+// graphiteServer accepts connections on a local port and sends each line it
+// reads on the returned channel.
+func graphiteServer(t *testing.T) (*net.TCPAddr, <-chan string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if nil != err {
+		t.Fatal(err)
+	}
+	return serveGraphite(t, l)
+}
+
+func serveGraphite(t *testing.T, l net.Listener) (*net.TCPAddr, <-chan string) {
+	t.Cleanup(func() { l.Close() })
+	lines := make(chan string, 100)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if nil != err {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				s := bufio.NewScanner(conn)
+				for s.Scan() {
+					lines <- s.Text()
+				}
+			}()
+		}
+	}()
+	return l.Addr().(*net.TCPAddr), lines
+}
+
+func TestGraphiteTagStyles(t *testing.T) {
+	for style, want := range map[GraphiteTagStyle]string{
+		GraphiteLegacyTags:   "p.hits.endpoint._users.host.a_b.count 1 ",
+		GraphiteTaggedSeries: "p.hits.count;endpoint=/users;host=a.b 1 ",
+	} {
+		addr, lines := graphiteServer(t)
+		r := NewRegistry()
+		c := NewCounter()
+		c.(Taggable).AddTags(map[string]string{"endpoint": "/users", "host": "a.b"})
+		c.Inc(1)
+		r.Register("hits", c)
+		if err := GraphiteOnce(GraphiteConfig{Addr: addr, Registry: r, Prefix: "p", TagStyle: style}); nil != err {
+			t.Fatal(err)
+		}
+		if line := <-lines; !strings.HasPrefix(line, want) {
+			t.Errorf("line: %q != %q\n", want, line)
+		}
+	}
+}
+
+func TestGraphiteRegistryPercentiles(t *testing.T) {
+	r := NewRegistry().(*StandardRegistry)
+	if err := r.SetPercentiles([]float64{0.9}); nil != err {
+		t.Fatal(err)
+	}
+	NewRegisteredHistogram("size", r, NewUniformSample(100)).Update(1)
+	points, err := graphitePoints(&GraphiteConfig{DurationUnit: time.Nanosecond, Prefix: "p", Registry: r}, time.Now())
+	if nil != err {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, p := range points {
+		if strings.HasSuffix(p.path, "-percentile") {
+			paths = append(paths, p.path)
+		}
+	}
+	if 1 != len(paths) || "p.size.90-percentile" != paths[0] {
+		t.Errorf("percentiles: %v\n", paths)
+	}
+}
+
+func TestGraphiteReconnect(t *testing.T) {
+	addr, lines := graphiteServer(t)
+	r := NewRegistry()
+	NewRegisteredGauge("g", r).Update(1)
+	g := &graphiteConn{c: &GraphiteConfig{Addr: addr, Registry: r, Prefix: "p", ReconnectAttempts: 1}}
+	defer g.close()
+	if err := g.flush(now()); nil != err {
+		t.Fatal(err)
+	}
+	<-lines
+	g.conn.Close() // Leave a dead connection behind.
+	if err := g.flush(now()); nil != err {
+		t.Fatal(err)
+	}
+	if line := <-lines; !strings.HasPrefix(line, "p.g.value 1 ") {
+		t.Errorf("line: %q\n", line)
+	}
+}
+
+func TestGraphiteGivesUpWithoutReconnectAttempts(t *testing.T) {
+	addr, _ := graphiteServer(t)
+	r := NewRegistry()
+	NewRegisteredGauge("g", r).Update(1)
+	g := &graphiteConn{c: &GraphiteConfig{Addr: addr, Registry: r}}
+	defer g.close()
+	if err := g.flush(now()); nil != err {
+		t.Fatal(err)
+	}
+	g.conn.Close()
+	if err := g.flush(now()); nil == err {
+		t.Error("flush(): want error\n")
+	}
+	if nil != g.conn {
+		t.Error("g.conn: want nil after a failed write\n")
+	}
+}
+
+func TestGraphiteTLS(t *testing.T) {
+	s := httptest.NewTLSServer(nil) // For its certificate for 127.0.0.1.
+	defer s.Close()
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: s.TLS.Certificates})
+	if nil != err {
+		t.Fatal(err)
+	}
+	addr, lines := serveGraphite(t, l)
+	r := NewRegistry()
+	NewRegisteredGauge("g", r).Update(1)
+	c := GraphiteConfig{Addr: addr, Registry: r, Prefix: "p"}
+	c.TLSConfig = &tls.Config{RootCAs: x509.NewCertPool()}
+	if err := GraphiteOnce(c); nil == err {
+		t.Error("GraphiteOnce(): want error verifying an unknown certificate\n")
+	}
+	c.TLSConfig.RootCAs.AddCert(s.Certificate())
+	if err := GraphiteOnce(c); nil != err {
+		t.Fatal(err)
+	}
+	if line := <-lines; !strings.HasPrefix(line, "p.g.value 1 ") {
+		t.Errorf("line: %q\n", line)
+	}
+}
+
+// graphiteProxy accepts CONNECT requests bearing the given credentials and
+// relays each connection to the address it names.
+func graphiteProxy(t *testing.T, user, password string) *url.URL {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if nil != err {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	auth := "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+password))
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if nil != err {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				req, err := http.ReadRequest(bufio.NewReader(conn))
+				if nil != err {
+					return
+				}
+				if auth != req.Header.Get("Proxy-Authorization") {
+					io.WriteString(conn, "HTTP/1.1 407 Proxy Authentication Required\r\n\r\n")
+					return
+				}
+				upstream, err := net.Dial("tcp", req.Host)
+				if nil != err {
+					io.WriteString(conn, "HTTP/1.1 502 Bad Gateway\r\n\r\n")
+					return
+				}
+				defer upstream.Close()
+				io.WriteString(conn, "HTTP/1.1 200 OK\r\n\r\n")
+				io.Copy(upstream, conn)
+			}()
+		}
+	}()
+	return &url.URL{Scheme: "http", Host: l.Addr().String(), User: url.UserPassword(user, password)}
+}
+
+func TestGraphiteProxy(t *testing.T) {
+	addr, lines := graphiteServer(t)
+	proxy := graphiteProxy(t, "u", "p")
+	r := NewRegistry()
+	NewRegisteredGauge("g", r).Update(1)
+	c := GraphiteConfig{Host: addr.String(), Registry: r, Prefix: "p", Proxy: proxy}
+	if err := GraphiteOnce(c); nil != err {
+		t.Fatal(err)
+	}
+	if line := <-lines; !strings.HasPrefix(line, "p.g.value 1 ") {
+		t.Errorf("line: %q\n", line)
+	}
+	c.Proxy = &url.URL{Scheme: "http", Host: proxy.Host, User: url.UserPassword("u", "wrong")}
+	if err := GraphiteOnce(c); nil == err || !strings.Contains(err.Error(), "407") {
+		t.Errorf("GraphiteOnce(): want a 407 error, got %v\n", err)
+	}
+}
+
+func TestGraphiteBatches(t *testing.T) {
+	r := NewRegistry()
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		NewRegisteredGauge(name, r).Update(1)
+	}
+	batches, _, err := graphiteBatches(&GraphiteConfig{Addr: &net.TCPAddr{}, Registry: r, Prefix: "p", BatchSize: 2}, now())
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 3 != len(batches) {
+		t.Fatalf("len(batches): 3 != %v\n", len(batches))
+	}
+	for i, want := range []int{2, 2, 1} {
+		if n := bytes.Count(batches[i], []byte("\n")); want != n {
+			t.Errorf("lines in batch %d: %v != %v\n", i, want, n)
+		}
+	}
+}
+
+func TestGraphitePickle(t *testing.T) {
+	pickle := graphitePickle([]graphitePoint{{path: "p.g.value", value: "1.50", timestamp: 100}})
+	want := []byte("\x00\x00\x00\x24" +
+		"\x80\x02](" +
+		"X\x09\x00\x00\x00p.g.value" +
+		"J\x64\x00\x00\x00" +
+		"G\x3f\xf8\x00\x00\x00\x00\x00\x00" +
+		"\x86\x86e.")
+	if !bytes.Equal(want, pickle) {
+		t.Errorf("graphitePickle(): %q != %q\n", want, pickle)
+	}
+}
+
+func TestGraphitePickleBatches(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	sizes := make(chan uint32, 10)
+	go func() {
+		conn, err := l.Accept()
+		if nil != err {
+			return
+		}
+		defer conn.Close()
+		var header [4]byte
+		for {
+			if _, err := io.ReadFull(conn, header[:]); nil != err {
+				close(sizes)
+				return
+			}
+			size := binary.BigEndian.Uint32(header[:])
+			if _, err := io.CopyN(ioutil.Discard, conn, int64(size)); nil != err {
+				close(sizes)
+				return
+			}
+			sizes <- size
+		}
+	}()
+	r := NewRegistry()
+	for _, name := range []string{"a", "b", "c"} {
+		NewRegisteredGauge(name, r).Update(1)
+	}
+	c := GraphiteConfig{Addr: l.Addr().(*net.TCPAddr), Registry: r, Prefix: "p", Protocol: GraphitePickle, BatchSize: 2}
+	if err := GraphiteOnce(c); nil != err {
+		t.Fatal(err)
+	}
+	n := 0
+	for range sizes {
+		n++
+	}
+	if 2 != n {
+		t.Errorf("batches: 2 != %v\n", n)
+	}
+}
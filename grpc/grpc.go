@@ -0,0 +1,132 @@
+// Package grpc provides gRPC interceptors which record, for clients and
+// servers, a counter of calls, a counter of errors by status code and a timer
+// of latency, each tagged with the service and method, so that services get
+// standard metrics by adding the interceptors to their options.
+package grpc
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryServerInterceptor returns an interceptor recording unary calls served
+// in r, or metrics.DefaultRegistry if r is nil, under the names grpc.server.calls,
+// grpc.server.errors and grpc.server.latency.
+func UnaryServerInterceptor(r metrics.Registry) grpc.UnaryServerInterceptor {
+	rec := newRecorder(r, "grpc.server")
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		rec.record(info.FullMethod, err, time.Since(start))
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor returns an interceptor recording streams served in
+// r like UnaryServerInterceptor, timing each stream from start to finish.
+func StreamServerInterceptor(r metrics.Registry) grpc.StreamServerInterceptor {
+	rec := newRecorder(r, "grpc.server")
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		err := handler(srv, ss)
+		rec.record(info.FullMethod, err, time.Since(start))
+		return err
+	}
+}
+
+// UnaryClientInterceptor returns an interceptor recording unary calls made in
+// r, or metrics.DefaultRegistry if r is nil, under the names grpc.client.calls,
+// grpc.client.errors and grpc.client.latency.
+func UnaryClientInterceptor(r metrics.Registry) grpc.UnaryClientInterceptor {
+	rec := newRecorder(r, "grpc.client")
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		start := time.Now()
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		rec.record(method, err, time.Since(start))
+		return err
+	}
+}
+
+// StreamClientInterceptor returns an interceptor recording streams opened in
+// r like UnaryClientInterceptor.  A stream is recorded when it finishes, that
+// is when receiving from it returns an error, io.EOF counting as success, or
+// when it fails to open.  Streams abandoned without receiving to the end
+// aren't recorded.
+func StreamClientInterceptor(r metrics.Registry) grpc.StreamClientInterceptor {
+	rec := newRecorder(r, "grpc.client")
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		start := time.Now()
+		cs, err := streamer(ctx, desc, cc, method, opts...)
+		if nil != err {
+			rec.record(method, err, time.Since(start))
+			return nil, err
+		}
+		return &clientStream{ClientStream: cs, finish: func(err error) {
+			rec.record(method, err, time.Since(start))
+		}}, nil
+	}
+}
+
+// clientStream calls finish once, when receiving from the stream it wraps
+// first fails.
+type clientStream struct {
+	grpc.ClientStream
+	finish func(error)
+	once   sync.Once
+}
+
+func (s *clientStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	if nil != err {
+		s.once.Do(func() {
+			if io.EOF == err {
+				s.finish(nil)
+			} else {
+				s.finish(err)
+			}
+		})
+	}
+	return err
+}
+
+type recorder struct {
+	prefix   string
+	registry metrics.Registry
+}
+
+func newRecorder(r metrics.Registry, prefix string) *recorder {
+	if nil == r {
+		r = metrics.DefaultRegistry
+	}
+	return &recorder{prefix: prefix, registry: r}
+}
+
+// record records a call to the given full method, e.g.
+// "/package.Service/Method", which returned err after d.
+func (rec *recorder) record(fullMethod string, err error, d time.Duration) {
+	service, method := splitMethod(fullMethod)
+	tags := map[string]string{"service": service, "method": method}
+	metrics.GetOrRegisterCounterT(rec.prefix+".calls", tags, rec.registry).Inc(1)
+	metrics.GetOrRegisterTimerT(rec.prefix+".latency", tags, rec.registry).Update(d)
+	if nil != err {
+		tags["code"] = status.Code(err).String()
+		metrics.GetOrRegisterCounterT(rec.prefix+".errors", tags, rec.registry).Inc(1)
+	}
+}
+
+// splitMethod splits a full method name such as "/package.Service/Method"
+// into the service and the method.
+func splitMethod(fullMethod string) (string, string) {
+	fullMethod = strings.TrimPrefix(fullMethod, "/")
+	if i := strings.LastIndexByte(fullMethod, '/'); -1 != i {
+		return fullMethod[:i], fullMethod[i+1:]
+	}
+	return "unknown", fullMethod
+}
@@ -0,0 +1,94 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/rcrowley/go-metrics"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestSplitMethod(t *testing.T) {
+	for fullMethod, want := range map[string][2]string{
+		"/helloworld.Greeter/SayHello": {"helloworld.Greeter", "SayHello"},
+		"/Greeter/SayHello":            {"Greeter", "SayHello"},
+		"SayHello":                     {"unknown", "SayHello"},
+	} {
+		if service, method := splitMethod(fullMethod); want[0] != service || want[1] != method {
+			t.Errorf("splitMethod(%q): %v != %v %v\n", fullMethod, want, service, method)
+		}
+	}
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	r := metrics.NewRegistry()
+	i := UnaryServerInterceptor(r)
+	info := &grpc.UnaryServerInfo{FullMethod: "/helloworld.Greeter/SayHello"}
+	ok := func(context.Context, interface{}) (interface{}, error) { return "hello", nil }
+	fail := func(context.Context, interface{}) (interface{}, error) {
+		return nil, status.Error(codes.NotFound, "nobody")
+	}
+	i(context.Background(), nil, info, ok)
+	i(context.Background(), nil, info, fail)
+
+	tags := ";method=SayHello;service=helloworld.Greeter"
+	if c := r.Get("grpc.server.calls" + tags).(metrics.Counter); 2 != c.Count() {
+		t.Errorf("calls: 2 != %v\n", c.Count())
+	}
+	if tm := r.Get("grpc.server.latency" + tags).(metrics.Timer); 2 != tm.Count() {
+		t.Errorf("latency: 2 != %v\n", tm.Count())
+	}
+	if c := r.Get("grpc.server.errors;code=NotFound" + tags).(metrics.Counter); 1 != c.Count() {
+		t.Errorf("errors: 1 != %v\n", c.Count())
+	}
+}
+
+type fakeClientStream struct {
+	grpc.ClientStream
+	errs []error
+}
+
+func (s *fakeClientStream) RecvMsg(interface{}) error {
+	err := s.errs[0]
+	s.errs = s.errs[1:]
+	return err
+}
+
+func TestStreamClientInterceptor(t *testing.T) {
+	r := metrics.NewRegistry()
+	i := StreamClientInterceptor(r)
+	streamer := func(context.Context, *grpc.StreamDesc, *grpc.ClientConn, string, ...grpc.CallOption) (grpc.ClientStream, error) {
+		return &fakeClientStream{errs: []error{nil, io.EOF, io.EOF}}, nil
+	}
+	cs, err := i(context.Background(), &grpc.StreamDesc{}, nil, "/Greeter/Chat", streamer)
+	if nil != err {
+		t.Fatal(err)
+	}
+	tags := ";method=Chat;service=Greeter"
+	cs.RecvMsg(nil)
+	if nil != r.Get("grpc.client.calls"+tags) {
+		t.Error("stream recorded before it finished")
+	}
+	cs.RecvMsg(nil)
+	cs.RecvMsg(nil)
+	if c := r.Get("grpc.client.calls" + tags).(metrics.Counter); 1 != c.Count() {
+		t.Errorf("calls: 1 != %v\n", c.Count())
+	}
+	if nil != r.Get("grpc.client.errors;code=OK"+tags) {
+		t.Error("io.EOF recorded as an error")
+	}
+
+	failing := func(context.Context, *grpc.StreamDesc, *grpc.ClientConn, string, ...grpc.CallOption) (grpc.ClientStream, error) {
+		return nil, errors.New("unreachable")
+	}
+	if _, err := i(context.Background(), &grpc.StreamDesc{}, nil, "/Greeter/Chat", failing); nil == err {
+		t.Fatal("no error")
+	}
+	if c := r.Get("grpc.client.errors;code=Unknown" + tags).(metrics.Counter); 1 != c.Count() {
+		t.Errorf("errors: 1 != %v\n", c.Count())
+	}
+}
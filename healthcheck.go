@@ -1,5 +1,7 @@
 package metrics
 
+import "sync"
+
 // Healthchecks hold an error value describing an arbitrary up/down status.
 type Healthcheck interface {
 	Check()
@@ -8,35 +10,79 @@ type Healthcheck interface {
 	Unhealthy(error)
 }
 
+// GetOrRegisterHealthcheck returns an existing Healthcheck or constructs and
+// registers a new StandardHealthcheck which will use the given function to
+// update its status, so that HealthHandler and reporters find it alongside
+// the registry's other metrics.
+func GetOrRegisterHealthcheck(name string, r Registry, f func(Healthcheck)) Healthcheck {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	return getOrRegister(r, name, func() Healthcheck { return NewHealthcheck(f) }, NilHealthcheck{}).(Healthcheck)
+}
+
 // NewHealthcheck constructs a new Healthcheck which will use the given
 // function to update its status.
 func NewHealthcheck(f func(Healthcheck)) Healthcheck {
-	if UseNilMetrics {
+	if useNilMetrics() {
 		return NilHealthcheck{}
 	}
-	return &StandardHealthcheck{nil, f}
+	return &StandardHealthcheck{f: f}
+}
+
+// NewRegisteredHealthcheck constructs and registers a new
+// StandardHealthcheck which will use the given function to update its status.
+func NewRegisteredHealthcheck(name string, r Registry, f func(Healthcheck)) Healthcheck {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	if usesNilMetrics(r) {
+		return NilHealthcheck{}
+	}
+	h := NewHealthcheck(f)
+	r.Register(name, h)
+	return h
 }
 
 // NilHealthcheck is a no-op.
 type NilHealthcheck struct{}
 
+// AddDynamicTag is a no-op.
+func (NilHealthcheck) AddDynamicTag(string, func() string) error { return nil }
+
+// AddTags is a no-op.
+func (NilHealthcheck) AddTags(map[string]string) {}
+
 // Check is a no-op.
 func (NilHealthcheck) Check() {}
 
 // Error is a no-op.
 func (NilHealthcheck) Error() error { return nil }
 
+// GetTags is a no-op.
+func (NilHealthcheck) GetTags() map[string]string { return nil }
+
 // Healthy is a no-op.
 func (NilHealthcheck) Healthy() {}
 
+// RemoveTag is a no-op.
+func (NilHealthcheck) RemoveTag(string) {}
+
+// SetTags is a no-op.
+func (NilHealthcheck) SetTags(map[string]string) {}
+
 // Unhealthy is a no-op.
 func (NilHealthcheck) Unhealthy(error) {}
 
 // StandardHealthcheck is the standard implementation of a Healthcheck and
-// stores the status and a function to call to update the status.
+// stores the status and a function to call to update the status.  It uses
+// sync.Mutex so that it may be checked concurrently, e.g. by HealthHandler.
 type StandardHealthcheck struct {
-	err error
-	f   func(Healthcheck)
+	tagSet
+
+	err   error
+	f     func(Healthcheck)
+	mutex sync.Mutex
 }
 
 // Check runs the healthcheck function to update the healthcheck's status.
@@ -46,16 +92,22 @@ func (h *StandardHealthcheck) Check() {
 
 // Error returns the healthcheck's status, which will be nil if it is healthy.
 func (h *StandardHealthcheck) Error() error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
 	return h.err
 }
 
 // Healthy marks the healthcheck as healthy.
 func (h *StandardHealthcheck) Healthy() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
 	h.err = nil
 }
 
 // Unhealthy marks the healthcheck as unhealthy.  The error is stored and
 // may be retrieved by the Error method.
 func (h *StandardHealthcheck) Unhealthy(err error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
 	h.err = err
 }
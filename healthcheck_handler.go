@@ -0,0 +1,118 @@
+package metrics
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// HealthConfig provides a container with configuration parameters for
+// HealthHandlerWithConfig.
+type HealthConfig struct {
+	Registry Registry      // Registry whose healthchecks are run
+	Timeout  time.Duration // Time each healthcheck may take before failing
+}
+
+// HealthStatus is the status of a single healthcheck as reported by
+// HealthHandler.
+type HealthStatus struct {
+	Healthy bool   `json:"healthy"`
+	Error   string `json:"error,omitempty"`
+}
+
+// HealthReport is the JSON body written by HealthHandler.
+type HealthReport struct {
+	Healthy bool                    `json:"healthy"`
+	Checks  map[string]HealthStatus `json:"checks"`
+}
+
+// HealthHandler returns an http.HandlerFunc suitable for readiness and
+// liveness probes which runs every healthcheck in the given registry, each
+// with a timeout of five seconds.  See HealthHandlerWithConfig.
+func HealthHandler(r Registry) http.HandlerFunc {
+	return HealthHandlerWithConfig(HealthConfig{
+		Registry: r,
+		Timeout:  5 * time.Second,
+	})
+}
+
+// HealthHandlerWithConfig returns an http.HandlerFunc just like
+// HealthHandler, but it takes a HealthConfig instead.  The healthchecks are
+// run concurrently and any which doesn't complete within the timeout fails.
+// If every healthcheck passes it responds 200 OK with a HealthReport listing
+// each of them; otherwise 503 Service Unavailable with a HealthReport listing
+// only those which failed, along with their errors.
+func HealthHandlerWithConfig(c HealthConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		r := c.Registry
+		if nil == r {
+			r = DefaultRegistry
+		}
+		report := runHealthchecks(r, c.Timeout)
+		status := http.StatusOK
+		if !report.Healthy {
+			status = http.StatusServiceUnavailable
+			for name, check := range report.Checks {
+				if check.Healthy {
+					delete(report.Checks, name)
+				}
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(report)
+	}
+}
+
+// runHealthchecks checks every healthcheck in r concurrently, failing those
+// which take longer than the timeout, if there is one.
+func runHealthchecks(r Registry, timeout time.Duration) *HealthReport {
+	type result struct {
+		name   string
+		status HealthStatus
+	}
+	results := make(chan result)
+	n := 0
+	r.Each(func(name string, i interface{}) {
+		h, ok := i.(Healthcheck)
+		if !ok {
+			return
+		}
+		n++
+		go func() {
+			done := make(chan error, 1)
+			go func() {
+				h.Check()
+				done <- h.Error()
+			}()
+			var expired <-chan time.Time
+			if timeout > 0 {
+				timer := time.NewTimer(timeout)
+				defer timer.Stop()
+				expired = timer.C
+			}
+			select {
+			case err := <-done:
+				if nil != err {
+					results <- result{name, HealthStatus{Error: err.Error()}}
+				} else {
+					results <- result{name, HealthStatus{Healthy: true}}
+				}
+			case <-expired:
+				results <- result{name, HealthStatus{
+					Error: fmt.Sprintf("healthcheck timed out after %v", timeout),
+				}}
+			}
+		}()
+	})
+	report := &HealthReport{Healthy: true, Checks: make(map[string]HealthStatus, n)}
+	for ; n > 0; n-- {
+		res := <-results
+		report.Checks[res.name] = res.status
+		if !res.status.Healthy {
+			report.Healthy = false
+		}
+	}
+	return report
+}
@@ -0,0 +1,57 @@
+package metrics
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func serveHealth(t *testing.T, h http.HandlerFunc) (int, HealthReport) {
+	w := httptest.NewRecorder()
+	h(w, httptest.NewRequest("GET", "/health", nil))
+	var report HealthReport
+	if err := json.Unmarshal(w.Body.Bytes(), &report); nil != err {
+		t.Fatal(w.Body.String(), err)
+	}
+	return w.Code, report
+}
+
+func TestHealthHandler(t *testing.T) {
+	r := NewRegistry()
+	r.Register("foo", NewHealthcheck(func(h Healthcheck) { h.Healthy() }))
+	r.Register("bar", NewHealthcheck(func(h Healthcheck) { h.Healthy() }))
+	NewRegisteredCounter("baz", r)
+	code, report := serveHealth(t, HealthHandler(r))
+	if http.StatusOK != code {
+		t.Fatal(code)
+	}
+	if !report.Healthy || 2 != len(report.Checks) || !report.Checks["foo"].Healthy {
+		t.Fatal(report)
+	}
+}
+
+func TestHealthHandlerFailing(t *testing.T) {
+	r := NewRegistry()
+	r.Register("foo", NewHealthcheck(func(h Healthcheck) { h.Healthy() }))
+	r.Register("bar", NewHealthcheck(func(h Healthcheck) { h.Unhealthy(errors.New("down")) }))
+	r.Register("baz", NewHealthcheck(func(h Healthcheck) { time.Sleep(time.Second) }))
+	code, report := serveHealth(t, HealthHandlerWithConfig(HealthConfig{
+		Registry: r,
+		Timeout:  10 * time.Millisecond,
+	}))
+	if http.StatusServiceUnavailable != code {
+		t.Fatal(code)
+	}
+	if report.Healthy || 2 != len(report.Checks) {
+		t.Fatal(report)
+	}
+	if "down" != report.Checks["bar"].Error {
+		t.Error(report.Checks["bar"])
+	}
+	if "healthcheck timed out after 10ms" != report.Checks["baz"].Error {
+		t.Error(report.Checks["baz"])
+	}
+}
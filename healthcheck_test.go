@@ -0,0 +1,33 @@
+package metrics
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestGetOrRegisterHealthcheck(t *testing.T) {
+	r := NewRegistry()
+	calls := 0
+	h := GetOrRegisterHealthcheck("db", r, func(h Healthcheck) {
+		calls++
+		h.Unhealthy(errors.New("down"))
+	})
+	if h2 := GetOrRegisterHealthcheck("db", r, func(Healthcheck) { t.Error("constructed twice") }); h2 != h {
+		t.Fatal(h2)
+	}
+	r.RunHealthchecks()
+	if 1 != calls || nil == h.Error() {
+		t.Fatal(calls, h.Error())
+	}
+}
+
+func TestNewRegisteredHealthcheckNilMetrics(t *testing.T) {
+	r := NewRegistry().(*StandardRegistry)
+	r.SetUseNilMetrics(true)
+	if _, ok := NewRegisteredHealthcheck("db", r, func(Healthcheck) {}).(NilHealthcheck); !ok {
+		t.Error("not a NilHealthcheck")
+	}
+	if nil != r.Get("db") {
+		t.Error("registered")
+	}
+}
@@ -1,6 +1,18 @@
 package metrics
 
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
 // Histograms calculate distribution statistics from a series of int64 values.
+//
+// Sum is of every value counted since the histogram was last cleared, as
+// exporters of Prometheus and OpenTelemetry histograms need alongside Count,
+// when its sample keeps a running sum, as the built-in ones do; otherwise it's
+// of the values in the sample, like Variance and the other statistics.
 type Histogram interface {
 	Clear()
 	Count() int64
@@ -13,22 +25,71 @@ type Histogram interface {
 	Snapshot() Histogram
 	StdDev() float64
 	Sum() int64
+	SumOverflowed() bool
 	Update(int64)
+	UpdateAggregate(Aggregate)
+	UpdateN(int64, int64)
 	Variance() float64
 }
 
+// An Aggregate summarises a block of values already aggregated elsewhere, e.g.
+// by a batch processor, for Histogram.UpdateAggregate and, in nanoseconds,
+// Timer.UpdateAggregate.
+type Aggregate struct {
+	Count    int64 // Number of values
+	Sum      int64 // Sum of the values
+	Min, Max int64 // Least and greatest of the values
+}
+
+// updateAggregate records the values a summarises by calls to updateN: the
+// least and greatest once each and the rest of the sum spread as evenly over
+// the others as whole numbers allow.  The count, sum, min and max recorded are
+// exact, but the values in between are taken to be close to their mean.
+func updateAggregate(a Aggregate, updateN func(v, n int64)) {
+	switch {
+	case a.Count <= 0:
+		return
+	case 1 == a.Count:
+		updateN(a.Sum, 1)
+		return
+	case 2 == a.Count:
+		updateN(a.Min, 1)
+		updateN(a.Sum-a.Min, 1)
+		return
+	}
+	updateN(a.Min, 1)
+	updateN(a.Max, 1)
+	rest := a.Count - 2
+	q, r := (a.Sum-a.Min-a.Max)/rest, (a.Sum-a.Min-a.Max)%rest
+	if r < 0 {
+		q, r = q-1, r+rest
+	}
+	updateN(q+1, r)
+	updateN(q, rest-r)
+}
+
 // GetOrRegisterHistogram returns an existing Histogram or constructs and
 // registers a new StandardHistogram.
 func GetOrRegisterHistogram(name string, r Registry, s Sample) Histogram {
 	if nil == r {
 		r = DefaultRegistry
 	}
-	return r.GetOrRegister(name, func() Histogram { return NewHistogram(s) }).(Histogram)
+	return getOrRegister(r, name, func() Histogram { return NewHistogram(s) }, NilHistogram{}).(Histogram)
+}
+
+// GetOrRegisterHistogramT returns the existing Histogram identified by name
+// and tags together or constructs and registers a new one carrying the tags
+// from s, which is only used if the series is new; see GetOrRegisterCounterT.
+func GetOrRegisterHistogramT(name string, tags map[string]string, r Registry, s Sample) Histogram {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	return getOrRegisterTagged(r, name, tags, func() interface{} { return NewHistogram(s) }, NilHistogram{}).(Histogram)
 }
 
 // NewHistogram constructs a new StandardHistogram from a Sample.
 func NewHistogram(s Sample) Histogram {
-	if UseNilMetrics {
+	if useNilMetrics() {
 		return NilHistogram{}
 	}
 	return &StandardHistogram{sample: s}
@@ -37,17 +98,60 @@ func NewHistogram(s Sample) Histogram {
 // NewRegisteredHistogram constructs and registers a new StandardHistogram from
 // a Sample.
 func NewRegisteredHistogram(name string, r Registry, s Sample) Histogram {
-	c := NewHistogram(s)
 	if nil == r {
 		r = DefaultRegistry
 	}
+	if usesNilMetrics(r) {
+		return NilHistogram{}
+	}
+	c := NewHistogram(s)
 	r.Register(name, c)
 	return c
 }
 
 // HistogramSnapshot is a read-only copy of another Histogram.
 type HistogramSnapshot struct {
-	sample *SampleSnapshot
+	percentiles []float64 // declared by the histogram; see MetricPercentiles
+	sample      Sample    // A read-only snapshot, usually a *SampleSnapshot
+	tags        Tags
+	timestamp   time.Time
+}
+
+// AddTags panics.
+func (*HistogramSnapshot) AddTags(map[string]string) {
+	panic("AddTags called on a HistogramSnapshot")
+}
+
+// Buckets returns, for each of the given bounds, the number of values recorded
+// which were less than or equal to it, i.e. cumulative bucket counts such as
+// Prometheus' le buckets.  Bounds must be ascending and Buckets panics if they
+// aren't; see ValidateBucketBounds.
+//
+// The counts are approximate: they're the proportion of the sample at or below
+// each bound scaled up to the total count, so they're only as representative
+// as the sample is, and exact only while the sample still holds every value.
+// An HDRSample counts from its buckets instead, exactly to its precision.
+func (h *HistogramSnapshot) Buckets(bounds []float64) []uint64 {
+	if err := ValidateBucketBounds(bounds); nil != err {
+		panic(err)
+	}
+	if s, ok := h.sample.(bucketingSample); ok {
+		return s.Buckets(bounds)
+	}
+	buckets := make([]uint64, len(bounds))
+	values := int64Slice(h.sample.Values())
+	if 0 == len(values) {
+		return buckets
+	}
+	sort.Sort(values)
+	scale := float64(h.sample.Count()) / float64(len(values))
+	for i, bound := range bounds {
+		n := sort.Search(len(values), func(j int) bool {
+			return float64(values[j]) > bound
+		})
+		buckets[i] = uint64(float64(n)*scale + 0.5)
+	}
+	return buckets
 }
 
 // Clear panics.
@@ -59,6 +163,23 @@ func (*HistogramSnapshot) Clear() {
 // taken.
 func (h *HistogramSnapshot) Count() int64 { return h.sample.Count() }
 
+// GetTags returns a copy of the tags the histogram had at the time the
+// snapshot was taken.
+func (h *HistogramSnapshot) GetTags() map[string]string { return h.tags.Map() }
+
+// RemoveTag panics.
+func (*HistogramSnapshot) RemoveTag(string) {
+	panic("RemoveTag called on a HistogramSnapshot")
+}
+
+// SetTags panics.
+func (*HistogramSnapshot) SetTags(map[string]string) {
+	panic("SetTags called on a HistogramSnapshot")
+}
+
+// Tags returns the tags the histogram had at the time the snapshot was taken.
+func (h *HistogramSnapshot) Tags() Tags { return h.tags }
+
 // Max returns the maximum value in the sample at the time the snapshot was
 // taken.
 func (h *HistogramSnapshot) Max() int64 { return h.sample.Max() }
@@ -96,23 +217,52 @@ func (h *HistogramSnapshot) StdDev() float64 { return h.sample.StdDev() }
 // Sum returns the sum in the sample at the time the snapshot was taken.
 func (h *HistogramSnapshot) Sum() int64 { return h.sample.Sum() }
 
+// Timestamp returns the time the snapshot was taken, by the clock set by
+// SetClock, or the zero time if it was decoded, e.g. by UnmarshalSummary.
+func (h *HistogramSnapshot) Timestamp() time.Time { return h.timestamp }
+
+// SumOverflowed returns true if the sum in the sample at the time the snapshot
+// was taken didn't fit in an int64, in which case Sum is saturated.
+func (h *HistogramSnapshot) SumOverflowed() bool {
+	return sampleSumOverflowed(h.sample)
+}
+
 // Update panics.
 func (*HistogramSnapshot) Update(int64) {
 	panic("Update called on a HistogramSnapshot")
 }
 
+// UpdateAggregate panics.
+func (*HistogramSnapshot) UpdateAggregate(Aggregate) {
+	panic("UpdateAggregate called on a HistogramSnapshot")
+}
+
+// UpdateN panics.
+func (*HistogramSnapshot) UpdateN(int64, int64) {
+	panic("UpdateN called on a HistogramSnapshot")
+}
+
 // Variance returns the variance of inputs at the time the snapshot was taken.
 func (h *HistogramSnapshot) Variance() float64 { return h.sample.Variance() }
 
 // NilHistogram is a no-op Histogram.
 type NilHistogram struct{}
 
+// AddDynamicTag is a no-op.
+func (NilHistogram) AddDynamicTag(string, func() string) error { return nil }
+
+// AddTags is a no-op.
+func (NilHistogram) AddTags(map[string]string) {}
+
 // Clear is a no-op.
 func (NilHistogram) Clear() {}
 
 // Count is a no-op.
 func (NilHistogram) Count() int64 { return 0 }
 
+// GetTags is a no-op.
+func (NilHistogram) GetTags() map[string]string { return nil }
+
 // Max is a no-op.
 func (NilHistogram) Max() int64 { return 0 }
 
@@ -130,9 +280,15 @@ func (NilHistogram) Percentiles(ps []float64) []float64 {
 	return make([]float64, len(ps))
 }
 
+// RemoveTag is a no-op.
+func (NilHistogram) RemoveTag(string) {}
+
 // Sample is a no-op.
 func (NilHistogram) Sample() Sample { return NilSample{} }
 
+// SetTags is a no-op.
+func (NilHistogram) SetTags(map[string]string) {}
+
 // Snapshot is a no-op.
 func (NilHistogram) Snapshot() Histogram { return NilHistogram{} }
 
@@ -142,16 +298,29 @@ func (NilHistogram) StdDev() float64 { return 0.0 }
 // Sum is a no-op.
 func (NilHistogram) Sum() int64 { return 0 }
 
+// SumOverflowed is a no-op.
+func (NilHistogram) SumOverflowed() bool { return false }
+
 // Update is a no-op.
 func (NilHistogram) Update(v int64) {}
 
+// UpdateAggregate is a no-op.
+func (NilHistogram) UpdateAggregate(Aggregate) {}
+
+// UpdateN is a no-op.
+func (NilHistogram) UpdateN(int64, int64) {}
+
 // Variance is a no-op.
 func (NilHistogram) Variance() float64 { return 0.0 }
 
 // StandardHistogram is the standard implementation of a Histogram and uses a
 // Sample to bound its memory use.
 type StandardHistogram struct {
-	sample Sample
+	tagSet
+	lastUpdate
+
+	percentiles []float64 // reported of it alone, sorted; see MetricPercentiles
+	sample      Sample
 }
 
 // Clear clears the histogram and its sample.
@@ -186,17 +355,117 @@ func (h *StandardHistogram) Sample() Sample { return h.sample }
 
 // Snapshot returns a read-only copy of the histogram.
 func (h *StandardHistogram) Snapshot() Histogram {
-	return &HistogramSnapshot{sample: h.sample.Snapshot().(*SampleSnapshot)}
+	return &HistogramSnapshot{
+		percentiles: h.percentiles,
+		sample:      h.sample.Snapshot(),
+		tags:        h.resolve(),
+		timestamp:   now(),
+	}
+}
+
+// ReadInto copies the histogram's sample and tags into s, as Snapshot would.
+// The values of exponentially-decaying and uniform samples are copied into
+// those s holds from a previous call, if it has room, so that reading a
+// histogram over and over stops allocating; other samples are snapshotted
+// anew.  Nothing may still be reading s.
+func (h *StandardHistogram) ReadInto(s *HistogramSnapshot) {
+	if r, ok := h.sample.(sampleReader); ok {
+		dst, _ := s.sample.(*SampleSnapshot)
+		if nil == dst {
+			dst = &SampleSnapshot{}
+		}
+		r.readInto(dst)
+		s.sample = dst
+	} else {
+		s.sample = h.sample.Snapshot()
+	}
+	s.percentiles = h.percentiles
+	s.tags = h.resolve()
+	s.timestamp = now()
+}
+
+// snapshotAndReset returns a read-only copy of the histogram and clears it.
+// No update is lost in between unless the sample is of a type defined outside
+// this package.
+func (h *StandardHistogram) snapshotAndReset() interface{} {
+	if s, ok := h.sample.(clearingSample); ok {
+		return &HistogramSnapshot{percentiles: h.percentiles, sample: s.snapshotAndClear(), tags: h.resolve(), timestamp: now()}
+	}
+	snapshot := h.Snapshot()
+	h.Clear()
+	return snapshot
 }
 
 // StdDev returns the standard deviation of the values in the sample.
 func (h *StandardHistogram) StdDev() float64 { return h.sample.StdDev() }
 
-// Sum returns the sum in the sample.
+// Sum returns the sum in the sample, which is of every value counted if it
+// keeps a running sum.
 func (h *StandardHistogram) Sum() int64 { return h.sample.Sum() }
 
+// SumOverflowed returns true if the sum in the sample doesn't fit in an int64,
+// in which case Sum is saturated.
+func (h *StandardHistogram) SumOverflowed() bool {
+	return sampleSumOverflowed(h.sample)
+}
+
 // Update samples a new value.
-func (h *StandardHistogram) Update(v int64) { h.sample.Update(v) }
+func (h *StandardHistogram) Update(v int64) {
+	h.touch()
+	h.sample.Update(v)
+}
+
+// UpdateAggregate samples a block of values from their count, sum, min and
+// max; see Aggregate.
+func (h *StandardHistogram) UpdateAggregate(a Aggregate) {
+	h.touch()
+	updateAggregate(a, h.updateN)
+}
+
+// UpdateN samples n copies of a value, at less cost than n calls to Update
+// if the sample is one of the built-in ones.
+func (h *StandardHistogram) UpdateN(v, n int64) {
+	h.touch()
+	h.updateN(v, n)
+}
+
+func (h *StandardHistogram) updateN(v, n int64) { sampleUpdateN(h.sample, v, n) }
 
 // Variance returns the variance of the values in the sample.
 func (h *StandardHistogram) Variance() float64 { return h.sample.Variance() }
+
+// ValidateBucketBounds returns an error unless bounds are strictly ascending
+// and none is NaN, as HistogramSnapshot.Buckets requires.
+func ValidateBucketBounds(bounds []float64) error {
+	for i, bound := range bounds {
+		if math.IsNaN(bound) {
+			return fmt.Errorf("bucket bound %d is NaN", i)
+		}
+		if i > 0 && bound <= bounds[i-1] {
+			return fmt.Errorf("bucket bounds not ascending: %v after %v", bound, bounds[i-1])
+		}
+	}
+	return nil
+}
+
+// sampleReader is implemented by samples which can copy themselves into a
+// SampleSnapshot, reusing the values it already holds; see
+// StandardHistogram.ReadInto.
+type sampleReader interface {
+	readInto(*SampleSnapshot)
+}
+
+// bucketingSample is implemented by samples which count values into buckets
+// themselves rather than keep the values.
+type bucketingSample interface {
+	Buckets([]float64) []uint64
+}
+
+// sampleSumOverflowed returns true if the sum in s doesn't fit in an int64,
+// asking the sample itself if it keeps a running sum.
+func sampleSumOverflowed(s Sample) bool {
+	if o, ok := s.(interface{ SumOverflowed() bool }); ok {
+		return o.SumOverflowed()
+	}
+	return SampleSumOverflowed(s.Values())
+}
@@ -1,6 +1,9 @@
 package metrics
 
-import "testing"
+import (
+	"math"
+	"testing"
+)
 
 func BenchmarkHistogram(b *testing.B) {
 	h := NewHistogram(NewUniformSample(100))
@@ -56,6 +59,35 @@ func TestHistogramEmpty(t *testing.T) {
 	}
 }
 
+func TestHistogramUpdateN(t *testing.T) {
+	h := NewHistogram(NewUniformSample(100))
+	h.UpdateN(3, 10)
+	h.UpdateN(5, 0)
+	if 10 != h.Count() || 30 != h.Sum() || 3 != h.Min() || 3 != h.Max() {
+		t.Errorf("count %v, sum %v, min %v, max %v\n", h.Count(), h.Sum(), h.Min(), h.Max())
+	}
+}
+
+func TestHistogramUpdateAggregate(t *testing.T) {
+	for _, a := range []Aggregate{
+		{Count: 1, Sum: 7, Min: 7, Max: 7},
+		{Count: 2, Sum: 10, Min: 3, Max: 7},
+		{Count: 10, Sum: 101, Min: 1, Max: 30},
+		{Count: 10, Sum: -101, Min: -30, Max: -1},
+	} {
+		h := NewHistogram(NewUniformSample(100))
+		h.UpdateAggregate(a)
+		if a.Count != h.Count() || a.Sum != h.Sum() || a.Min != h.Min() || a.Max != h.Max() {
+			t.Errorf("%+v: count %v, sum %v, min %v, max %v\n", a, h.Count(), h.Sum(), h.Min(), h.Max())
+		}
+	}
+	h := NewHistogram(NewUniformSample(100))
+	h.UpdateAggregate(Aggregate{})
+	if 0 != h.Count() {
+		t.Errorf("h.Count(): 0 != %v\n", h.Count())
+	}
+}
+
 func TestHistogramSnapshot(t *testing.T) {
 	h := NewHistogram(NewUniformSample(100000))
 	for i := 1; i <= 10000; i++ {
@@ -66,6 +98,125 @@ func TestHistogramSnapshot(t *testing.T) {
 	testHistogram10000(t, snapshot)
 }
 
+func TestHistogramSumOverflow(t *testing.T) {
+	h := NewHistogram(NewUniformSample(100))
+	for i := 0; i < 4; i++ {
+		h.Update(math.MaxInt64 / 2)
+	}
+	if !h.SumOverflowed() {
+		t.Error("h.SumOverflowed(): false")
+	}
+	if sum := h.Sum(); math.MaxInt64 != sum {
+		t.Errorf("h.Sum(): %v != %v\n", int64(math.MaxInt64), sum)
+	}
+	if mean := h.Mean(); float64(math.MaxInt64/2) != mean {
+		t.Errorf("h.Mean(): %v != %v\n", float64(math.MaxInt64/2), mean)
+	}
+	snapshot := h.Snapshot()
+	if !snapshot.SumOverflowed() {
+		t.Error("snapshot.SumOverflowed(): false")
+	}
+
+	h = NewHistogram(NewUniformSample(100))
+	for i := 0; i < 4; i++ {
+		h.Update(math.MinInt64 / 2)
+	}
+	if sum := h.Sum(); math.MinInt64 != sum {
+		t.Errorf("h.Sum(): %v != %v\n", int64(math.MinInt64), sum)
+	}
+	if mean := h.Mean(); float64(math.MinInt64/2) != mean {
+		t.Errorf("h.Mean(): %v != %v\n", float64(math.MinInt64/2), mean)
+	}
+}
+
+func TestHistogramSumOverflowRecovers(t *testing.T) {
+	h := NewHistogram(NewUniformSample(100))
+	h.Update(math.MaxInt64)
+	h.Update(math.MaxInt64)
+	h.Update(math.MinInt64)
+	if h.SumOverflowed() {
+		t.Error("h.SumOverflowed(): true")
+	}
+	if sum := h.Sum(); math.MaxInt64-1 != sum {
+		t.Errorf("h.Sum(): %v != %v\n", int64(math.MaxInt64-1), sum)
+	}
+}
+
+func TestHistogramSnapshotBuckets(t *testing.T) {
+	h := NewHistogram(NewUniformSample(100000))
+	for i := 1; i <= 10000; i++ {
+		h.Update(int64(i))
+	}
+	buckets := h.Snapshot().(*HistogramSnapshot).Buckets([]float64{0, 1, 99.5, 5000, 10000, math.Inf(1)})
+	for i, want := range []uint64{0, 1, 99, 5000, 10000, 10000} {
+		if want != buckets[i] {
+			t.Errorf("buckets[%d]: %v != %v\n", i, want, buckets[i])
+		}
+	}
+}
+
+func TestHistogramSnapshotBucketsScaled(t *testing.T) {
+	s := NewSampleSnapshot(1000, []int64{1, 2, 3, 4})
+	buckets := (&HistogramSnapshot{sample: s}).Buckets([]float64{1, 2, 4})
+	for i, want := range []uint64{250, 500, 1000} {
+		if want != buckets[i] {
+			t.Errorf("buckets[%d]: %v != %v\n", i, want, buckets[i])
+		}
+	}
+}
+
+func TestHistogramSnapshotBucketsEmpty(t *testing.T) {
+	buckets := NewHistogram(NewUniformSample(100)).Snapshot().(*HistogramSnapshot).Buckets([]float64{1, 2})
+	if 2 != len(buckets) || 0 != buckets[0] || 0 != buckets[1] {
+		t.Fatal(buckets)
+	}
+}
+
+func TestHistogramSnapshotTags(t *testing.T) {
+	h := NewHistogram(NewUniformSample(100))
+	h.(Taggable).AddTags(map[string]string{"endpoint": "/users"})
+	snapshot := h.Snapshot().(Taggable)
+	h.(Taggable).AddTags(map[string]string{"endpoint": "/groups"})
+	if tags := snapshot.GetTags(); "/users" != tags["endpoint"] {
+		t.Errorf("snapshot.GetTags(): %v\n", tags)
+	}
+	r := NewRegistry()
+	r.Register("foo", h)
+	if tags := r.SnapshotAndReset().Get("foo;endpoint=/groups").(Taggable).GetTags(); "/groups" != tags["endpoint"] {
+		t.Errorf("SnapshotAndReset().GetTags(): %v\n", tags)
+	}
+}
+
+func TestHistogramSnapshotDynamicTags(t *testing.T) {
+	h := NewHistogram(NewUniformSample(100))
+	h.(Taggable).AddTags(map[string]string{"host": "a"})
+	version := "1.0"
+	h.(DynamicTaggable).AddDynamicTag("version", func() string { return version })
+	h.(DynamicTaggable).AddDynamicTag("host", func() string { return "b" })
+	snapshot := h.Snapshot().(Taggable)
+	version = "1.1"
+	if tags := snapshot.GetTags(); 2 != len(tags) || "a" != tags["host"] || "1.0" != tags["version"] {
+		t.Errorf("snapshot.GetTags(): %v\n", tags)
+	}
+	if tags := h.Snapshot().(Taggable).GetTags(); "1.1" != tags["version"] {
+		t.Errorf("Snapshot().GetTags() after a change: %v\n", tags)
+	}
+	if tags := h.(Taggable).GetTags(); 1 != len(tags) {
+		t.Errorf("GetTags(): %v\n", tags)
+	}
+}
+
+func TestValidateBucketBounds(t *testing.T) {
+	if err := ValidateBucketBounds([]float64{math.Inf(-1), 0, 1, math.Inf(1)}); nil != err {
+		t.Error(err)
+	}
+	for _, bounds := range [][]float64{{1, 1}, {2, 1}, {math.NaN()}} {
+		if err := ValidateBucketBounds(bounds); nil == err {
+			t.Errorf("ValidateBucketBounds(%v): expected error", bounds)
+		}
+	}
+}
+
 func testHistogram10000(t *testing.T, h Histogram) {
 	if count := h.Count(); 10000 != count {
 		t.Errorf("h.Count(): 10000 != %v\n", count)
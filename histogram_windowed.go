@@ -0,0 +1,249 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+)
+
+// WindowedHistograms calculate distribution statistics from only those values
+// recorded within a rolling window, e.g. the p99 over the last minute.  The
+// window is divided into buckets which are rotated on a ticker, so recent
+// changes show up as soon as a bucket rotates rather than once a decaying
+// sample has settled.  Stop must be called to release the ticker.
+type WindowedHistogram interface {
+	Histogram
+	Stop()
+}
+
+// GetOrRegisterWindowedHistogram returns an existing WindowedHistogram or
+// constructs and registers a new StandardWindowedHistogram.
+func GetOrRegisterWindowedHistogram(name string, r Registry, window, granularity time.Duration) WindowedHistogram {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	return getOrRegister(r, name, func() WindowedHistogram {
+		return NewWindowedHistogram(window, granularity)
+	}, NilWindowedHistogram{}).(WindowedHistogram)
+}
+
+// DefaultWindowedHistogramWindow is the window of a WindowedHistogram
+// constructed with a window which isn't positive.
+const DefaultWindowedHistogramWindow = time.Minute
+
+// DefaultWindowedHistogramBuckets is the number of buckets of a
+// WindowedHistogram constructed with a granularity which isn't positive.
+const DefaultWindowedHistogramBuckets = 6
+
+// NewWindowedHistogram constructs a new StandardWindowedHistogram covering the
+// given window in buckets of the given granularity, which must divide it, and
+// launches the goroutine which rotates them.  A window which isn't positive
+// is DefaultWindowedHistogramWindow and a granularity which isn't positive
+// divides the window into DefaultWindowedHistogramBuckets.  Each bucket is
+// backed by a uniform sample of the same size as NewTimer's reservoir.
+func NewWindowedHistogram(window, granularity time.Duration) WindowedHistogram {
+	if useNilMetrics() {
+		return NilWindowedHistogram{}
+	}
+	if window <= 0 {
+		window = DefaultWindowedHistogramWindow
+	}
+	if granularity <= 0 {
+		granularity = window / DefaultWindowedHistogramBuckets
+	}
+	n := int(window / granularity)
+	if n < 1 {
+		n = 1
+	}
+	h := &StandardWindowedHistogram{
+		buckets: make([]Sample, n),
+		done:    make(chan struct{}),
+	}
+	for i := range h.buckets {
+		h.buckets[i] = NewUniformSample(windowedHistogramReservoirSize)
+	}
+	go every(tick(granularity), h.done, nil, func(time.Time) { h.tick() })
+	return h
+}
+
+// NewRegisteredWindowedHistogram constructs and registers a new
+// StandardWindowedHistogram.
+func NewRegisteredWindowedHistogram(name string, r Registry, window, granularity time.Duration) WindowedHistogram {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	if usesNilMetrics(r) {
+		return NilWindowedHistogram{}
+	}
+	c := NewWindowedHistogram(window, granularity)
+	r.Register(name, c)
+	return c
+}
+
+const windowedHistogramReservoirSize = 1028
+
+// NilWindowedHistogram is a no-op WindowedHistogram.
+type NilWindowedHistogram struct {
+	NilHistogram
+}
+
+// Stop is a no-op.
+func (NilWindowedHistogram) Stop() {}
+
+// StandardWindowedHistogram is the standard implementation of a
+// WindowedHistogram and uses a ring of uniform samples, one per bucket.
+type StandardWindowedHistogram struct {
+	tagSet
+	lastUpdate
+
+	buckets  []Sample
+	count    int64
+	current  int
+	mutex    sync.Mutex
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// Clear discards every value and resets the count to zero.
+func (h *StandardWindowedHistogram) Clear() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	for _, s := range h.buckets {
+		s.Clear()
+	}
+	h.count = 0
+}
+
+// Count returns the number of values recorded since the histogram was last
+// cleared, including those which have since left the window.
+func (h *StandardWindowedHistogram) Count() int64 {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.count
+}
+
+// Max returns the maximum value in the window.
+func (h *StandardWindowedHistogram) Max() int64 { return h.Snapshot().Max() }
+
+// Mean returns the mean of the values in the window.
+func (h *StandardWindowedHistogram) Mean() float64 { return h.Snapshot().Mean() }
+
+// Min returns the minimum value in the window.
+func (h *StandardWindowedHistogram) Min() int64 { return h.Snapshot().Min() }
+
+// Percentile returns an arbitrary percentile of the values in the window.
+func (h *StandardWindowedHistogram) Percentile(p float64) float64 {
+	return h.Snapshot().Percentile(p)
+}
+
+// Percentiles returns a slice of arbitrary percentiles of the values in the
+// window.
+func (h *StandardWindowedHistogram) Percentiles(ps []float64) []float64 {
+	return h.Snapshot().Percentiles(ps)
+}
+
+// Sample returns a read-only Sample of the values in the window.
+func (h *StandardWindowedHistogram) Sample() Sample {
+	return h.Snapshot().Sample()
+}
+
+// Snapshot returns a read-only copy of the values in the window.
+func (h *StandardWindowedHistogram) Snapshot() Histogram {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	var values []int64
+	for _, s := range h.buckets {
+		values = append(values, s.Values()...)
+	}
+	return &HistogramSnapshot{
+		sample:    NewSampleSnapshot(h.count, values),
+		tags:      h.resolve(),
+		timestamp: now(),
+	}
+}
+
+// snapshotAndReset returns a read-only copy of the values in the window and
+// atomically discards them.
+func (h *StandardWindowedHistogram) snapshotAndReset() interface{} {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	var values []int64
+	for _, s := range h.buckets {
+		values = append(values, s.Values()...)
+		s.Clear()
+	}
+	snapshot := &HistogramSnapshot{
+		sample:    NewSampleSnapshot(h.count, values),
+		tags:      h.resolve(),
+		timestamp: now(),
+	}
+	h.count = 0
+	return snapshot
+}
+
+// StdDev returns the standard deviation of the values in the window.
+func (h *StandardWindowedHistogram) StdDev() float64 {
+	return h.Snapshot().StdDev()
+}
+
+// Stop stops the goroutine rotating the buckets.  The window stops moving,
+// too.  It is safe to call more than once.
+func (h *StandardWindowedHistogram) Stop() {
+	h.stopOnce.Do(func() { close(h.done) })
+}
+
+// Sum returns the sum of the values in the window.
+func (h *StandardWindowedHistogram) Sum() int64 { return h.Snapshot().Sum() }
+
+// SumOverflowed returns true if the sum of the values in the window doesn't
+// fit in an int64, in which case Sum is saturated.
+func (h *StandardWindowedHistogram) SumOverflowed() bool {
+	return h.Snapshot().SumOverflowed()
+}
+
+// Update records a new value in the current bucket.
+func (h *StandardWindowedHistogram) Update(v int64) {
+	h.touch()
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.buckets[h.current].Update(v)
+	h.count++
+}
+
+// UpdateAggregate records a block of values in the current bucket from their
+// count, sum, min and max; see Aggregate.
+func (h *StandardWindowedHistogram) UpdateAggregate(a Aggregate) {
+	h.touch()
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	updateAggregate(a, h.updateN)
+}
+
+// UpdateN records n copies of a value in the current bucket.
+func (h *StandardWindowedHistogram) UpdateN(v, n int64) {
+	h.touch()
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.updateN(v, n)
+}
+
+func (h *StandardWindowedHistogram) updateN(v, n int64) {
+	// should run with h.mutex held
+	if n <= 0 {
+		return
+	}
+	sampleUpdateN(h.buckets[h.current], v, n)
+	h.count += n
+}
+
+// Variance returns the variance of the values in the window.
+func (h *StandardWindowedHistogram) Variance() float64 {
+	return h.Snapshot().Variance()
+}
+
+// tick discards the oldest bucket and makes it the current one.
+func (h *StandardWindowedHistogram) tick() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.current = (h.current + 1) % len(h.buckets)
+	h.buckets[h.current].Clear()
+}
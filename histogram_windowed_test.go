@@ -0,0 +1,113 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+)
+
+func BenchmarkWindowedHistogram(b *testing.B) {
+	h := NewWindowedHistogram(time.Minute, 10*time.Second)
+	defer h.Stop()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		h.Update(int64(i))
+	}
+}
+
+func TestWindowedHistogram(t *testing.T) {
+	h := NewWindowedHistogram(time.Hour, 20*time.Minute).(*StandardWindowedHistogram)
+	defer h.Stop()
+	if 3 != len(h.buckets) {
+		t.Fatal(len(h.buckets))
+	}
+	for i := 1; i <= 100; i++ {
+		h.Update(1000)
+	}
+	h.tick()
+	for i := 1; i <= 100; i++ {
+		h.Update(int64(i))
+	}
+	if max := h.Max(); 1000 != max {
+		t.Errorf("h.Max(): 1000 != %v\n", max)
+	}
+	h.tick()
+	h.tick()
+	if count := h.Count(); 200 != count {
+		t.Errorf("h.Count(): 200 != %v\n", count)
+	}
+	if max := h.Max(); 100 != max {
+		t.Errorf("h.Max(): 100 != %v\n", max)
+	}
+	if p := h.Percentile(0.5); 50.5 != p {
+		t.Errorf("h.Percentile(0.5): 50.5 != %v\n", p)
+	}
+	h.tick()
+	if max := h.Max(); 0 != max {
+		t.Errorf("h.Max(): 0 != %v\n", max)
+	}
+}
+
+func TestWindowedHistogramDefaults(t *testing.T) {
+	for _, c := range []struct{ window, granularity time.Duration }{
+		{0, 0},
+		{-time.Second, 0},
+		{DefaultWindowedHistogramWindow, -time.Second},
+	} {
+		h := NewWindowedHistogram(c.window, c.granularity).(*StandardWindowedHistogram)
+		h.Stop()
+		if DefaultWindowedHistogramBuckets != len(h.buckets) {
+			t.Errorf("NewWindowedHistogram(%v, %v): %v buckets\n", c.window, c.granularity, len(h.buckets))
+		}
+	}
+}
+
+func TestWindowedHistogramSnapshot(t *testing.T) {
+	h := NewWindowedHistogram(time.Hour, time.Hour)
+	defer h.Stop()
+	h.Update(47)
+	snapshot := h.Snapshot()
+	h.Update(0)
+	if sum := snapshot.Sum(); 47 != sum {
+		t.Errorf("snapshot.Sum(): 47 != %v\n", sum)
+	}
+	if count := snapshot.Count(); 1 != count {
+		t.Errorf("snapshot.Count(): 1 != %v\n", count)
+	}
+}
+
+func TestWindowedHistogramRotates(t *testing.T) {
+	h := NewWindowedHistogram(2*time.Millisecond, time.Millisecond)
+	h.Update(47)
+	time.Sleep(20 * time.Millisecond)
+	h.Stop()
+	h.Stop()
+	if max := h.Max(); 0 != max {
+		t.Errorf("h.Max(): 0 != %v\n", max)
+	}
+}
+
+func TestGetOrRegisterWindowedHistogram(t *testing.T) {
+	r := NewRegistry()
+	h := NewRegisteredWindowedHistogram("foo", r, time.Minute, time.Second)
+	defer h.Stop()
+	h.Update(47)
+	if h := GetOrRegisterWindowedHistogram("foo", r, time.Minute, time.Second); 47 != h.Max() {
+		t.Fatal(h)
+	}
+	if _, ok := r.Get("foo").(Histogram); !ok {
+		t.Fatal(r.Get("foo"))
+	}
+}
+
+func TestWindowedHistogramUpdateN(t *testing.T) {
+	h := NewWindowedHistogram(time.Hour, 20*time.Minute)
+	defer h.Stop()
+	h.UpdateN(4, 25)
+	h.UpdateAggregate(Aggregate{Count: 5, Sum: 50, Min: 2, Max: 20})
+	if count := h.Count(); 30 != count {
+		t.Errorf("h.Count(): 30 != %v\n", count)
+	}
+	if sum := h.Sum(); 150 != sum {
+		t.Errorf("h.Sum(): 150 != %v\n", sum)
+	}
+}
@@ -0,0 +1,86 @@
+package metrics
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BatchErrors is every error of the batches of one flush which failed, in no
+// particular order.
+type BatchErrors []error
+
+func (errs BatchErrors) Error() string {
+	s := make([]string, len(errs))
+	for i, err := range errs {
+		s[i] = err.Error()
+	}
+	return strings.Join(s, "; ")
+}
+
+// NewHTTPClient returns an http.Client for exporters posting over HTTP whose
+// requests time out after the given duration and whose transport keeps up
+// to conns idle connections open to each host, enough for conns requests in
+// flight at once.  Exporters sharing one client share its connections.
+func NewHTTPClient(conns int, timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			DialContext: (&net.Dialer{
+				Timeout:   timeout,
+				KeepAlive: 30 * time.Second,
+			}).DialContext,
+			MaxIdleConns:        conns,
+			MaxIdleConnsPerHost: conns,
+			IdleConnTimeout:     90 * time.Second,
+		},
+	}
+}
+
+// SendBatches splits n points into batches of at most size each, or one
+// batch if size is zero, and calls send with the bounds [i, j) of each, with
+// up to concurrency calls in flight at once, or one at a time if it's zero.
+// It waits for every call to return, and returns nil if none failed, the
+// error if one did, or a BatchErrors if more than one did.
+func SendBatches(n, size, concurrency int, send func(i, j int) error) error {
+	if size <= 0 {
+		size = n
+	}
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	var (
+		errs  BatchErrors
+		mutex sync.Mutex
+		wg    sync.WaitGroup
+	)
+	sem := make(chan struct{}, concurrency)
+	for i := 0; i < n; i += size {
+		j := i + size
+		if j > n {
+			j = n
+		}
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i, j int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err := send(i, j); nil != err {
+				mutex.Lock()
+				errs = append(errs, err)
+				mutex.Unlock()
+			}
+		}(i, j)
+	}
+	wg.Wait()
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	}
+	return errs
+}
@@ -0,0 +1,61 @@
+package metrics
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSendBatches(t *testing.T) {
+	var (
+		mutex               sync.Mutex
+		points, inFlight, n int
+		maxInFlight         int
+	)
+	err := SendBatches(7, 2, 2, func(i, j int) error {
+		mutex.Lock()
+		points += j - i
+		n++
+		if inFlight++; inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mutex.Unlock()
+		time.Sleep(time.Millisecond)
+		mutex.Lock()
+		inFlight--
+		mutex.Unlock()
+		return nil
+	})
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 4 != n {
+		t.Errorf("batches: 4 != %v\n", n)
+	}
+	if 7 != points {
+		t.Errorf("points: 7 != %v\n", points)
+	}
+	if maxInFlight > 2 {
+		t.Errorf("maxInFlight: 2 < %v\n", maxInFlight)
+	}
+}
+
+func TestSendBatchesErrors(t *testing.T) {
+	failure := errors.New("no")
+	if err := SendBatches(3, 0, 0, func(i, j int) error {
+		if 0 != i || 3 != j {
+			t.Errorf("send(%v, %v)\n", i, j)
+		}
+		return failure
+	}); failure != err {
+		t.Errorf("SendBatches(): %v\n", err)
+	}
+	err := SendBatches(2, 1, 2, func(int, int) error { return failure })
+	if errs, ok := err.(BatchErrors); !ok || 2 != len(errs) || "no; no" != err.Error() {
+		t.Errorf("SendBatches(): want 2 BatchErrors != %v\n", err)
+	}
+	if err := SendBatches(0, 1, 1, func(int, int) error { return failure }); nil != err {
+		t.Errorf("SendBatches(): %v\n", err)
+	}
+}
@@ -0,0 +1,190 @@
+package metrics
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// HTTPConfig provides a container with configuration parameters for
+// HTTPMiddlewareWithConfig.
+type HTTPConfig struct {
+	Registry   Registry                   // Registry to record in, or DefaultRegistry if nil
+	Prefix     string                     // Prefix of metric names, "http.server" if empty
+	Route      func(*http.Request) string // Route of a request once it's served, or nil
+	UsePattern bool                       // Take the route from the ServeMux pattern (Go 1.23+)
+}
+
+// HTTPMiddleware returns middleware which instruments the handler it wraps,
+// recording in the given registry with no route tag.  See
+// HTTPMiddlewareWithConfig.
+func HTTPMiddleware(r Registry) func(http.Handler) http.Handler {
+	return HTTPMiddlewareWithConfig(HTTPConfig{Registry: r})
+}
+
+// HTTPMiddlewareWithConfig returns middleware just like HTTPMiddleware, but it
+// takes an HTTPConfig instead.  For each request it records, with Prefix
+// ".requests", a counter and, with ".latency", a timer tagged with the
+// request's method, its route and the class of its response status, e.g.
+// "2xx", and with ".in_flight" a gauge of the requests being served by
+// method.
+//
+// The route is what Route returns, or with UsePattern the pattern of the
+// http.ServeMux the request was routed by, or "unmatched" if none matched;
+// with neither there is no route tag.  Raw paths would make a series of every
+// URL, so they're never used.  A ServeMux sets the pattern on the request it's
+// given, so with UsePattern any middleware in between mustn't replace it, as
+// WithContext does, and GODEBUG=httpmuxgo121=1, the default for code built
+// without a go.mod of Go 1.22 or later, leaves every route "unmatched".  Methods other than the standard ones count as "OTHER"
+// for the same reason.
+func HTTPMiddlewareWithConfig(c HTTPConfig) func(http.Handler) http.Handler {
+	if nil == c.Registry {
+		c.Registry = DefaultRegistry
+	}
+	if "" == c.Prefix {
+		c.Prefix = "http.server"
+	}
+	return func(h http.Handler) http.Handler {
+		return &httpMiddleware{config: c, next: h}
+	}
+}
+
+type httpMiddleware struct {
+	config   HTTPConfig
+	next     http.Handler
+	inFlight sync.Map // method to *int64
+}
+
+func (m *httpMiddleware) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	method := httpMethod(req.Method)
+	inFlight := m.inFlightOf(method)
+	atomic.AddInt64(inFlight, 1)
+	rec := &statusRecorder{ResponseWriter: w}
+	start := time.Now()
+	defer func() {
+		d := time.Since(start)
+		atomic.AddInt64(inFlight, -1)
+		status := rec.status
+		p := recover()
+		if nil != p && 0 == status {
+			status = http.StatusInternalServerError
+		}
+		m.record(req, method, status, d)
+		if nil != p {
+			panic(p)
+		}
+	}()
+	m.next.ServeHTTP(rec, req)
+}
+
+// inFlightOf returns the count of requests being served by the given method,
+// registering the gauge which reads it the first time.
+func (m *httpMiddleware) inFlightOf(method string) *int64 {
+	if n, ok := m.inFlight.Load(method); ok {
+		return n.(*int64)
+	}
+	n, loaded := m.inFlight.LoadOrStore(method, new(int64))
+	if !loaded {
+		GetOrRegisterFunctionalGauge(
+			TaggedName(m.config.Prefix+".in_flight", map[string]string{"method": method}),
+			m.config.Registry,
+			func() int64 { return atomic.LoadInt64(n.(*int64)) },
+		)
+	}
+	return n.(*int64)
+}
+
+func (m *httpMiddleware) record(req *http.Request, method string, status int, d time.Duration) {
+	if 0 == status {
+		status = http.StatusOK
+	}
+	tags := map[string]string{
+		"method": method,
+		"status": statusClass(status),
+	}
+	switch {
+	case nil != m.config.Route:
+		tags["route"] = routeOrUnmatched(m.config.Route(req))
+	case m.config.UsePattern:
+		tags["route"] = routeOrUnmatched(requestPattern(req))
+	}
+	GetOrRegisterCounterT(m.config.Prefix+".requests", tags, m.config.Registry).Inc(1)
+	GetOrRegisterTimerT(m.config.Prefix+".latency", tags, m.config.Registry).Update(d)
+}
+
+func routeOrUnmatched(route string) string {
+	if "" == route {
+		return "unmatched"
+	}
+	return route
+}
+
+// httpMethod returns the given method if it's a standard one and "OTHER"
+// otherwise, so that clients can't make a series of every method they send.
+func httpMethod(method string) string {
+	switch method {
+	case http.MethodConnect, http.MethodDelete, http.MethodGet, http.MethodHead,
+		http.MethodOptions, http.MethodPatch, http.MethodPost, http.MethodPut,
+		http.MethodTrace:
+		return method
+	}
+	return "OTHER"
+}
+
+// statusClass returns the class of an HTTP status, e.g. "4xx" for 404.
+func statusClass(status int) string {
+	if status < 100 || status > 599 {
+		return "other"
+	}
+	return strconv.Itoa(status/100) + "xx"
+}
+
+// statusRecorder records the status written to the ResponseWriter it wraps.
+// The status is zero until the handler writes a header or body.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusRecorder) Flush() {
+	if 0 == w.status {
+		w.status = http.StatusOK
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("metrics: ResponseWriter doesn't support hijacking")
+	}
+	if 0 == w.status {
+		w.status = http.StatusSwitchingProtocols
+	}
+	return h.Hijack()
+}
+
+// Unwrap returns the wrapped ResponseWriter, for http.ResponseController.
+func (w *statusRecorder) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+func (w *statusRecorder) Write(b []byte) (int, error) {
+	if 0 == w.status {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	// Informational headers may precede the final one.
+	if 0 == w.status || w.status < 200 && status >= 200 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
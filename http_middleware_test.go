@@ -0,0 +1,98 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHTTPMiddleware(t *testing.T) {
+	r := NewRegistry()
+	var inFlight int64
+	h := HTTPMiddleware(r)(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if "GET" == req.Method {
+			inFlight = r.Get("http.server.in_flight;method=GET").(Gauge).Value()
+		}
+		if "/missing" == req.URL.Path {
+			http.NotFound(w, req)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	for _, path := range []string{"/", "/", "/missing"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("BREW", "/", nil))
+
+	if 1 != inFlight {
+		t.Errorf("in_flight while serving: 1 != %v\n", inFlight)
+	}
+	if v := r.Get("http.server.in_flight;method=GET").(Gauge).Value(); 0 != v {
+		t.Errorf("in_flight after serving: 0 != %v\n", v)
+	}
+	for name, want := range map[string]int64{
+		"http.server.requests;method=GET;status=2xx":   2,
+		"http.server.requests;method=GET;status=4xx":   1,
+		"http.server.requests;method=OTHER;status=2xx": 1,
+	} {
+		if c, ok := r.Get(name).(Counter); !ok || want != c.Count() {
+			t.Errorf("%s: %v != %v\n", name, want, r.Get(name))
+		}
+	}
+	if tm, ok := r.Get("http.server.latency;method=GET;status=2xx").(Timer); !ok || 2 != tm.Count() {
+		t.Errorf("latency: %v\n", r.Get("http.server.latency;method=GET;status=2xx"))
+	}
+}
+
+func TestHTTPMiddlewareRoute(t *testing.T) {
+	r := NewRegistry()
+	h := HTTPMiddlewareWithConfig(HTTPConfig{
+		Registry: r,
+		Prefix:   "api",
+		Route:    func(req *http.Request) string { return req.Header.Get("X-Route") },
+	})(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+	req := httptest.NewRequest("POST", "/users/47", nil)
+	req.Header.Set("X-Route", "/users/{id}")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/elsewhere", nil))
+	for _, name := range []string{
+		"api.requests;method=POST;route=/users/{id};status=2xx",
+		"api.requests;method=POST;route=unmatched;status=2xx",
+	} {
+		if nil == r.Get(name) {
+			t.Errorf("%s not registered\n", name)
+		}
+	}
+}
+
+func TestHTTPMiddlewarePanic(t *testing.T) {
+	r := NewRegistry()
+	h := HTTPMiddleware(r)(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic("oops")
+	}))
+	func() {
+		defer func() {
+			if p := recover(); "oops" != p {
+				t.Errorf("recover(): oops != %v\n", p)
+			}
+		}()
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	}()
+	if nil == r.Get("http.server.requests;method=GET;status=5xx") {
+		t.Error("panic not recorded as 5xx")
+	}
+	if v := r.Get("http.server.in_flight;method=GET").(Gauge).Value(); 0 != v {
+		t.Errorf("in_flight: 0 != %v\n", v)
+	}
+}
+
+func TestStatusRecorderFlush(t *testing.T) {
+	w := httptest.NewRecorder()
+	rec := &statusRecorder{ResponseWriter: w}
+	rec.Flush()
+	if http.StatusOK != rec.status || !w.Flushed {
+		t.Errorf("status: %v, flushed: %v\n", rec.status, w.Flushed)
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !go1.23
+// +build !go1.23
+
+package metrics
+
+import "net/http"
+
+// requestPattern returns the empty string, since http.ServeMux only records
+// the pattern which matched a request from Go 1.23.
+func requestPattern(*http.Request) string { return "" }
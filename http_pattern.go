@@ -0,0 +1,10 @@
+//go:build go1.23
+// +build go1.23
+
+package metrics
+
+import "net/http"
+
+// requestPattern returns the pattern of the http.ServeMux route which matched
+// the request, if any.
+func requestPattern(req *http.Request) string { return req.Pattern }
@@ -0,0 +1,35 @@
+//go:build go1.23
+// +build go1.23
+
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHTTPMiddlewarePattern(t *testing.T) {
+	probe := httptest.NewRequest("GET", "/", nil)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(http.ResponseWriter, *http.Request) {})
+	mux.ServeHTTP(httptest.NewRecorder(), probe)
+	if "" == probe.Pattern {
+		t.Skip("ServeMux doesn't record patterns with GODEBUG=httpmuxgo121=1")
+	}
+
+	r := NewRegistry()
+	mux = http.NewServeMux()
+	mux.HandleFunc("GET /users/{id}", func(http.ResponseWriter, *http.Request) {})
+	h := HTTPMiddlewareWithConfig(HTTPConfig{Registry: r, UsePattern: true})(mux)
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/users/47", nil))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/nowhere", nil))
+	for _, name := range []string{
+		"http.server.requests;method=GET;route=GET /users/{id};status=2xx",
+		"http.server.requests;method=GET;route=unmatched;status=4xx",
+	} {
+		if nil == r.Get(name) {
+			t.Errorf("%s not registered\n", name)
+		}
+	}
+}
@@ -0,0 +1,396 @@
+// Package influxdb reports the metrics in a go-metrics Registry to InfluxDB
+// 1.x or 2.x, writing them in the line protocol over HTTP.
+package influxdb
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+// Version selects the write API of the InfluxDB server.
+type Version int
+
+const (
+	// V1 writes to /write, selecting the database and retention policy.
+	// This is the default.
+	V1 Version = iota
+
+	// V2 writes to /api/v2/write, selecting the organization and bucket.
+	V2
+)
+
+// Config configures the InfluxDB reporter.
+type Config struct {
+	URL           string            // Base URL of the server, e.g. http://localhost:8086
+	Registry      metrics.Registry  // Registry to be exported
+	FlushInterval time.Duration     // Flush interval
+	DurationUnit  time.Duration     // Time conversion unit for timers, defaulting to nanoseconds
+	Precision     time.Duration     // Timestamp precision: a nanosecond, the default, microsecond, millisecond or second
+	Namespace     string            // Prefix for every measurement name, joined with a dot
+	Tags          map[string]string // Tags added to every point, which the metric's own tags override
+	Percentiles   []float64         // Percentiles of timers and histograms, or nil for the registry's
+
+	// Schedule aligns the flushes of InfluxDB to multiples of FlushInterval,
+	// so that every process's points share timestamps, and jitters them.
+	Schedule metrics.FlushSchedule
+
+	Version Version // Write API to use
+
+	// Database, RetentionPolicy, Username and Password configure the 1.x
+	// API.  An empty retention policy selects the database's default.  The
+	// username and password are sent by basic authentication unless Token is
+	// set.
+	Database        string
+	RetentionPolicy string
+	Username        string
+	Password        string
+
+	// Org and Bucket configure the 2.x API.  Token, if set, is sent as
+	// "Authorization: Token <token>" by either API, as InfluxDB 2.x and
+	// hosted InfluxDB require even of the 1.x one.
+	Org    string
+	Bucket string
+	Token  string
+
+	// Headers are added to every request, e.g. the key a gateway in front
+	// of the server authenticates requests by.
+	Headers map[string]string
+
+	// BatchSize is the maximum number of points written by each request.
+	// Zero writes every point of a flush in one request.
+	BatchSize int
+
+	// Concurrency is the maximum number of requests of one flush in flight
+	// at once.  Zero or one sends the batches one after another.
+	Concurrency int
+
+	// Client sends the requests.  Sharing one client between reporters
+	// shares its pool of connections; metrics.NewHTTPClient builds one with
+	// a tuned transport.  Nil means http.DefaultClient, or a client of its
+	// own if TLSConfig or Proxy is set.
+	Client *http.Client
+
+	// TLSConfig and Proxy configure the client used when Client is nil:
+	// TLSConfig, e.g. with the certificates of a private CA or of the client
+	// itself, for https URLs, and Proxy the URL of the HTTP proxy to send
+	// every request through instead of the one named by the environment.
+	// Set them on the transport of Client instead if it's set.
+	TLSConfig *tls.Config
+	Proxy     *url.URL
+
+	// OnError is called with the error of every flush of InfluxDB which
+	// fails.  Nil logs it.
+	OnError func(error)
+
+	// Metrics, if set, records every flush, counting the points of the
+	// requests which failed as dropped.
+	Metrics *metrics.ReporterMetrics
+}
+
+// client returns the client to send requests with and whether it was built
+// for this Config alone.
+func (c *Config) client() (*http.Client, bool) {
+	if nil != c.Client {
+		return c.Client, false
+	}
+	if nil == c.TLSConfig && nil == c.Proxy {
+		return http.DefaultClient, false
+	}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	if nil != c.TLSConfig {
+		t.TLSClientConfig = c.TLSConfig
+	}
+	if nil != c.Proxy {
+		t.Proxy = http.ProxyURL(c.Proxy)
+	}
+	return &http.Client{Transport: t}, true
+}
+
+// InfluxDB is a blocking exporter function which reports metrics in c.Registry
+// to InfluxDB every c.FlushInterval, passing errors to c.OnError, or logging
+// them, until c.Registry is closed.
+func InfluxDB(c Config) {
+	InfluxDBContext(context.Background(), c)
+}
+
+// InfluxDBContext is InfluxDB until ctx is done, when it flushes a final time
+// before returning.
+func InfluxDBContext(ctx context.Context, c Config) {
+	client, own := c.client()
+	if own {
+		defer client.CloseIdleConnections()
+	}
+	c.Client = client
+	c.Schedule.RunContext(ctx, c.FlushInterval, metrics.Closed(c.Registry), func(time.Time) {
+		metrics.ReportError(c.OnError, Once(c))
+	})
+}
+
+// Once performs a single submission to InfluxDB, returning a non-nil error if
+// any request failed.  It waits for every request of the flush to finish, so
+// the error is a metrics.BatchErrors if more than one failed.
+func Once(c Config) error {
+	if client, own := c.client(); own {
+		defer client.CloseIdleConnections()
+		c.Client = client
+	}
+	return c.Metrics.Flush(func() error { return send(c, Lines(c, time.Now())) })
+}
+
+// NewReporter returns a metrics.SnapshotReporter writing each snapshot it's
+// given to InfluxDB as Once does, e.g. the series a metrics.MultiReporter
+// selects for it.  c.Registry is ignored.
+func NewReporter(c Config) metrics.SnapshotReporter {
+	c.Client, _ = c.client()
+	return metrics.SnapshotReporterFunc(func(s *metrics.RegistrySnapshot) error {
+		return c.Metrics.Flush(func() error { return send(c, lines(c, s.Each, time.Now())) })
+	})
+}
+
+// send writes the lines in batches.
+func send(c Config, lines []string) error {
+	if 0 == len(lines) {
+		return nil
+	}
+	u, err := writeURL(&c)
+	if nil != err {
+		return err
+	}
+	return metrics.SendBatches(len(lines), c.BatchSize, c.Concurrency, func(i, j int) error {
+		err := write(&c, u, lines[i:j])
+		if nil != err {
+			c.Metrics.Drop(j - i)
+		}
+		return err
+	})
+}
+
+// Lines renders every metric in c.Registry as a point in the line protocol,
+// timestamped now at c.Precision, one line per metric without the trailing
+// newline.  The tags in each registered name and the registry's default tags
+// become Influx tags.  Fields which aren't finite numbers are left out, since
+// InfluxDB can't store them, and so are metrics left with no fields.
+func Lines(c Config, now time.Time) []string {
+	return lines(c, c.Registry.EachSnapshot, now)
+}
+
+// NewEncoder returns a metrics.Encoder rendering snapshots in the line
+// protocol as Lines does, one point per line, for a metrics.EncodingReporter
+// to write, e.g. to a file or a socket of Telegraf.  c.Registry is ignored.
+func NewEncoder(c Config) metrics.Encoder {
+	return metrics.EncoderFunc(func(s *metrics.RegistrySnapshot, now time.Time) ([]byte, error) {
+		var buf bytes.Buffer
+		for _, line := range lines(c, s.Each, now) {
+			buf.WriteString(line)
+			buf.WriteByte('\n')
+		}
+		return buf.Bytes(), nil
+	})
+}
+
+// lines renders each metric snapshot passed by each as Lines does.
+func lines(c Config, each func(func(string, interface{})), now time.Time) []string {
+	precision := c.Precision
+	if 0 == precision {
+		precision = time.Nanosecond
+	}
+	du := c.DurationUnit
+	if 0 == du {
+		du = time.Nanosecond
+	}
+	timestamp := strconv.FormatInt(now.UnixNano()/int64(precision), 10)
+	percentiles := c.Percentiles
+	if nil == percentiles {
+		percentiles = metrics.RegistryPercentiles(c.Registry)
+	}
+	var lines []string
+	each(func(name string, i interface{}) {
+		name, tags := metrics.SplitTaggedName(name)
+		if "" != c.Namespace {
+			name = c.Namespace + "." + name
+		}
+		var f fields
+		switch metric := i.(type) {
+		case metrics.Counter:
+			f.int("count", metric.Count())
+		case metrics.CounterFloat64:
+			f.float("count", metric.Count())
+		case metrics.Gauge:
+			f.int("value", metric.Value())
+		case metrics.GaugeFloat64:
+			f.float("value", metric.Value())
+		case metrics.MergeableGaugeFloat64:
+			f.float("value", metric.Value())
+			f.int("count", metric.Count())
+		case metrics.Histogram:
+			percentiles := metrics.MetricPercentiles(percentiles, metric)
+			ps := metric.Percentiles(percentiles)
+			f.int("count", metric.Count())
+			f.int("min", metric.Min())
+			f.int("max", metric.Max())
+			f.float("mean", metric.Mean())
+			f.float("stddev", metric.StdDev())
+			f.int("sum", metric.Sum())
+			for i, p := range percentiles {
+				f.float(metrics.PercentileName(p), ps[i])
+			}
+		case metrics.Meter:
+			f.int("count", metric.Count())
+			f.float("m1", metric.Rate1())
+			f.float("m5", metric.Rate5())
+			f.float("m15", metric.Rate15())
+			f.float("mean", metric.RateMean())
+		case metrics.Timer:
+			d := float64(du)
+			percentiles := metrics.MetricPercentiles(percentiles, metric)
+			ps := metric.Percentiles(percentiles)
+			f.int("count", metric.Count())
+			f.int("min", metric.Min()/int64(du))
+			f.int("max", metric.Max()/int64(du))
+			f.float("mean", metric.Mean()/d)
+			f.float("stddev", metric.StdDev()/d)
+			f.int("sum", metric.Sum()/int64(du))
+			for i, p := range percentiles {
+				f.float(metrics.PercentileName(p), ps[i]/d)
+			}
+			f.float("m1", metric.Rate1())
+			f.float("m5", metric.Rate5())
+			f.float("m15", metric.Rate15())
+			f.float("meanrate", metric.RateMean())
+		default:
+			return
+		}
+		if 0 == len(f) {
+			return
+		}
+		lines = append(lines, measurementEscaper.Replace(name)+tagString(c.Tags, tags)+" "+strings.Join(f, ",")+" "+timestamp)
+	})
+	sort.Strings(lines)
+	return lines
+}
+
+// fields accumulates the rendered fields of one point.
+type fields []string
+
+func (f *fields) float(key string, v float64) {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return
+	}
+	*f = append(*f, keyEscaper.Replace(key)+"="+strconv.FormatFloat(v, 'g', -1, 64))
+}
+
+func (f *fields) int(key string, v int64) {
+	*f = append(*f, keyEscaper.Replace(key)+"="+strconv.FormatInt(v, 10)+"i")
+}
+
+var (
+	measurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `)
+	keyEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+)
+
+// tagString renders the merged tags sorted by key, as InfluxDB recommends,
+// each preceded by a comma.  Tags with empty values are left out, since
+// InfluxDB rejects them.
+func tagString(defaults, tags map[string]string) string {
+	merged := make(map[string]string, len(defaults)+len(tags))
+	for k, v := range defaults {
+		merged[k] = v
+	}
+	for k, v := range tags {
+		merged[k] = v
+	}
+	keys := make([]string, 0, len(merged))
+	for k, v := range merged {
+		if "" != v {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	var s string
+	for _, k := range keys {
+		s += "," + keyEscaper.Replace(k) + "=" + keyEscaper.Replace(merged[k])
+	}
+	return s
+}
+
+// writeURL returns the URL of the configured write API.
+func writeURL(c *Config) (string, error) {
+	precision, err := precisionName(c.Precision, c.Version)
+	if nil != err {
+		return "", err
+	}
+	q := url.Values{}
+	q.Set("precision", precision)
+	path := "/write"
+	if V2 == c.Version {
+		path = "/api/v2/write"
+		q.Set("org", c.Org)
+		q.Set("bucket", c.Bucket)
+	} else {
+		q.Set("db", c.Database)
+		if "" != c.RetentionPolicy {
+			q.Set("rp", c.RetentionPolicy)
+		}
+	}
+	return strings.TrimSuffix(c.URL, "/") + path + "?" + q.Encode(), nil
+}
+
+func precisionName(precision time.Duration, version Version) (string, error) {
+	switch precision {
+	case 0, time.Nanosecond:
+		if V2 == version {
+			return "ns", nil
+		}
+		return "n", nil
+	case time.Microsecond:
+		if V2 == version {
+			return "us", nil
+		}
+		return "u", nil
+	case time.Millisecond:
+		return "ms", nil
+	case time.Second:
+		return "s", nil
+	}
+	return "", fmt.Errorf("unsupported InfluxDB precision %v", precision)
+}
+
+// write sends one batch of lines.
+func write(c *Config, u string, lines []string) error {
+	req, err := http.NewRequest("POST", u, bytes.NewBufferString(strings.Join(lines, "\n")+"\n"))
+	if nil != err {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	for k, v := range c.Headers {
+		req.Header.Set(k, v)
+	}
+	if "" != c.Token {
+		req.Header.Set("Authorization", "Token "+c.Token)
+	} else if V1 == c.Version && "" != c.Username {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+	client, _ := c.client()
+	resp, err := client.Do(req)
+	if nil != err {
+		return err
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("InfluxDB write of %d points failed: %s %s", len(lines), resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
@@ -0,0 +1,323 @@
+package influxdb
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+	"github.com/rcrowley/go-metrics/metricstest"
+)
+
+func TestLines(t *testing.T) {
+	r := metrics.NewRegistry()
+	c := metrics.NewCounter()
+	c.(metrics.Taggable).AddTags(map[string]string{"endpoint": "/users", "host": "a b"})
+	c.Inc(3)
+	r.Register("http.requests", c)
+	metrics.NewRegisteredGaugeFloat64("temp,c", r).Update(21.5)
+	h := metrics.NewRegisteredHistogram("size", r, metrics.NewUniformSample(100))
+	h.Update(1)
+	h.Update(3)
+	lines := Lines(Config{
+		Registry:    r,
+		Namespace:   "app",
+		Precision:   time.Second,
+		Tags:        map[string]string{"host": "default", "dc": "eu"},
+		Percentiles: []float64{0.5},
+	}, time.Unix(100, 0))
+	want := []string{
+		`app.http.requests,dc=eu,endpoint=/users,host=a\ b count=3i 100`,
+		`app.size,dc=eu,host=default count=2i,min=1i,max=3i,mean=2,stddev=1,sum=4i,p50=2 100`,
+		`app.temp\,c,dc=eu,host=default value=21.5 100`,
+	}
+	if len(want) != len(lines) {
+		t.Fatalf("len(lines): %v != %v\n%s", len(want), len(lines), strings.Join(lines, "\n"))
+	}
+	for i := range want {
+		if want[i] != lines[i] {
+			t.Errorf("lines[%d]: %q != %q\n", i, want[i], lines[i])
+		}
+	}
+}
+
+func TestLinesRegistryPercentiles(t *testing.T) {
+	r := metrics.NewRegistry()
+	if err := r.(*metrics.StandardRegistry).SetPercentiles([]float64{0.9}); nil != err {
+		t.Fatal(err)
+	}
+	metrics.NewRegisteredHistogram("size", r, metrics.NewUniformSample(100)).Update(1)
+	lines := Lines(Config{Registry: r}, time.Unix(100, 0))
+	if 1 != len(lines) || !strings.Contains(lines[0], ",p90=1 ") || strings.Contains(lines[0], "p50") {
+		t.Errorf("Lines(): %v\n", lines)
+	}
+}
+
+func TestLinesSkipsNonFiniteFields(t *testing.T) {
+	r := metrics.NewRegistry()
+	metrics.NewRegisteredGaugeFloat64("nan", r).Update(0 / zero)
+	if lines := Lines(Config{Registry: r}, time.Now()); 0 != len(lines) {
+		t.Errorf("Lines(): %v\n", lines)
+	}
+}
+
+var zero float64
+
+func TestOnceV1(t *testing.T) {
+	var got *http.Request
+	var body string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		b, _ := ioutil.ReadAll(req.Body)
+		got, body = req, string(b)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer s.Close()
+	r := metrics.NewRegistry()
+	metrics.NewRegisteredCounter("hits", r).Inc(1)
+	err := Once(Config{
+		URL:             s.URL,
+		Registry:        r,
+		Database:        "db",
+		RetentionPolicy: "rp",
+		Username:        "u",
+		Password:        "p",
+		Precision:       time.Millisecond,
+	})
+	if nil != err {
+		t.Fatal(err)
+	}
+	if "/write" != got.URL.Path {
+		t.Errorf("path: /write != %v\n", got.URL.Path)
+	}
+	q := got.URL.Query()
+	if "db" != q.Get("db") || "rp" != q.Get("rp") || "ms" != q.Get("precision") {
+		t.Errorf("query: %v\n", q)
+	}
+	if u, p, ok := got.BasicAuth(); !ok || "u" != u || "p" != p {
+		t.Errorf("BasicAuth(): %v %v %v\n", u, p, ok)
+	}
+	if !strings.HasPrefix(body, "hits count=1i ") {
+		t.Errorf("body: %q\n", body)
+	}
+}
+
+func TestOnceV2(t *testing.T) {
+	var got *http.Request
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		got = req
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer s.Close()
+	r := metrics.NewRegistry()
+	metrics.NewRegisteredCounter("hits", r).Inc(1)
+	if err := Once(Config{URL: s.URL + "/", Registry: r, Version: V2, Org: "o", Bucket: "b", Token: "t"}); nil != err {
+		t.Fatal(err)
+	}
+	if "/api/v2/write" != got.URL.Path {
+		t.Errorf("path: /api/v2/write != %v\n", got.URL.Path)
+	}
+	q := got.URL.Query()
+	if "o" != q.Get("org") || "b" != q.Get("bucket") || "ns" != q.Get("precision") {
+		t.Errorf("query: %v\n", q)
+	}
+	if a := got.Header.Get("Authorization"); "Token t" != a {
+		t.Errorf("Authorization: Token t != %v\n", a)
+	}
+}
+
+func TestOnceBatchesConcurrently(t *testing.T) {
+	var (
+		requests, inFlight, maxInFlight int32
+		mutex                           sync.Mutex
+		points                          int
+	)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			m := atomic.LoadInt32(&maxInFlight)
+			if n <= m || atomic.CompareAndSwapInt32(&maxInFlight, m, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		b, _ := ioutil.ReadAll(req.Body)
+		mutex.Lock()
+		points += strings.Count(string(b), "\n")
+		mutex.Unlock()
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer s.Close()
+	r := metrics.NewRegistry()
+	for _, name := range []string{"a", "b", "c", "d", "e", "f", "g"} {
+		metrics.NewRegisteredCounter(name, r).Inc(1)
+	}
+	err := Once(Config{URL: s.URL, Registry: r, BatchSize: 2, Concurrency: 2, Client: metrics.NewHTTPClient(2, time.Second)})
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 4 != requests {
+		t.Errorf("requests: 4 != %v\n", requests)
+	}
+	if 7 != points {
+		t.Errorf("points: 7 != %v\n", points)
+	}
+	if maxInFlight > 2 {
+		t.Errorf("maxInFlight: 2 < %v\n", maxInFlight)
+	}
+}
+
+func TestOnceTLS(t *testing.T) {
+	var got *http.Request
+	s := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		got = req
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	s.Config.ErrorLog = log.New(ioutil.Discard, "", 0) // Of the unverified handshake.
+	defer s.Close()
+	r := metrics.NewRegistry()
+	metrics.NewRegisteredCounter("hits", r).Inc(1)
+	c := Config{
+		URL:       s.URL,
+		Registry:  r,
+		Database:  "db",
+		Username:  "u",
+		Password:  "p",
+		Token:     "t",
+		Headers:   map[string]string{"X-Api-Key": "k"},
+		TLSConfig: &tls.Config{RootCAs: x509.NewCertPool()},
+	}
+	if err := Once(c); nil == err {
+		t.Error("Once(): want error verifying an unknown certificate\n")
+	}
+	c.TLSConfig.RootCAs.AddCert(s.Certificate())
+	if err := Once(c); nil != err {
+		t.Fatal(err)
+	}
+	if a := got.Header.Get("Authorization"); "Token t" != a {
+		t.Errorf("Authorization: Token t != %v\n", a)
+	}
+	if k := got.Header.Get("X-Api-Key"); "k" != k {
+		t.Errorf("X-Api-Key: k != %v\n", k)
+	}
+}
+
+func TestOnceProxy(t *testing.T) {
+	var got *http.Request
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		got = req
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer proxy.Close()
+	u, _ := url.Parse(proxy.URL)
+	r := metrics.NewRegistry()
+	metrics.NewRegisteredCounter("hits", r).Inc(1)
+	if err := Once(Config{URL: "http://influxdb.invalid:8086", Registry: r, Database: "db", Proxy: u}); nil != err {
+		t.Fatal(err)
+	}
+	if "http://influxdb.invalid:8086/write?db=db&precision=n" != got.RequestURI {
+		t.Errorf("RequestURI: %v\n", got.RequestURI)
+	}
+}
+
+func TestOnceErrors(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.Error(w, "no", http.StatusBadRequest)
+	}))
+	defer s.Close()
+	r := metrics.NewRegistry()
+	metrics.NewRegisteredCounter("a", r).Inc(1)
+	metrics.NewRegisteredCounter("b", r).Inc(1)
+	err := Once(Config{URL: s.URL, Registry: r, BatchSize: 1})
+	errs, ok := err.(metrics.BatchErrors)
+	if !ok || 2 != len(errs) {
+		t.Fatalf("Once(): want 2 BatchErrors != %v\n", err)
+	}
+	if !strings.Contains(errs[0].Error(), "400") {
+		t.Errorf("errs[0]: %v\n", errs[0])
+	}
+}
+
+func TestOnceMetrics(t *testing.T) {
+	var calls int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if 1 == atomic.AddInt32(&calls, 1) {
+			http.Error(w, "no", http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer s.Close()
+	r := metrics.NewRegistry()
+	for _, name := range []string{"a", "b", "c"} {
+		metrics.NewRegisteredCounter(name, r).Inc(1)
+	}
+	m := metrics.NewReporterMetrics("influxdb", metrics.NewRegistry())
+	if err := Once(Config{URL: s.URL, Registry: r, BatchSize: 2, Metrics: m}); nil == err {
+		t.Fatal("Once(): want error\n")
+	}
+	if count := m.FailedFlushes.Count(); 1 != count {
+		t.Errorf("failed-flushes: 1 != %v\n", count)
+	}
+	if count := m.DroppedPoints.Count(); 2 != count {
+		t.Errorf("dropped-points: 2 != %v\n", count)
+	}
+	if count := m.FlushTimer.Count(); 1 != count {
+		t.Errorf("flush count: 1 != %v\n", count)
+	}
+}
+
+func TestUnsupportedPrecision(t *testing.T) {
+	r := metrics.NewRegistry()
+	metrics.NewRegisteredCounter("a", r).Inc(1)
+	if err := Once(Config{URL: "http://localhost", Registry: r, Precision: time.Minute}); nil == err {
+		t.Error("Once(): want error\n")
+	}
+}
+
+func TestEncoder(t *testing.T) {
+	r := metrics.NewRegistry()
+	metrics.NewRegisteredCounter("hits", r).Inc(2)
+	metrics.NewRegisteredGauge("depth", r).Update(7)
+	metrics.SetClock(metricstest.NewClock(time.Unix(100, 0)))
+	defer metrics.SetClock(nil)
+	var buf strings.Builder
+	w := metrics.NewEncodingReporter(r, NewEncoder(Config{Precision: time.Second}), &buf)
+	if err := w.Flush(); nil != err {
+		t.Fatal(err)
+	}
+	if want := "depth value=7i 100\nhits count=2i 100\n"; want != buf.String() {
+		t.Errorf("Flush():\n%q\n!=\n%q\n", want, buf.String())
+	}
+}
+
+func TestReporter(t *testing.T) {
+	var body string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		b, _ := ioutil.ReadAll(req.Body)
+		body = string(b)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer s.Close()
+	r := metrics.NewRegistry()
+	metrics.NewRegisteredCounter("orders", r).Inc(2)
+	metrics.NewRegisteredTimer("latency", r)
+	m := metrics.NewMultiReporter(r)
+	m.Add(NewReporter(Config{URL: s.URL, Database: "db", Precision: time.Second}), metrics.ReporterFilter{Include: []string{"orders"}})
+	if err := m.Flush(); nil != err {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(body, "orders count=2i ") || strings.Contains(body, "latency") {
+		t.Errorf("body: %q\n", body)
+	}
+}
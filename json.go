@@ -1,6 +1,7 @@
 package metrics
 
 import (
+	"context"
 	"encoding/json"
 	"io"
 	"time"
@@ -9,16 +10,37 @@ import (
 // MarshalJSON returns a byte slice containing a JSON representation of all
 // the metrics in the Registry.
 func (r *StandardRegistry) MarshalJSON() ([]byte, error) {
+	return marshalJSON(r.EachSnapshot, r.percentiles())
+}
+
+// marshalJSON renders the values of each metric snapshot passed by each as
+// getAll returns them.
+func marshalJSON(each func(func(string, interface{})), ps []float64) ([]byte, error) {
+	return json.Marshal(getAll(each, ps))
+}
+
+// getAll returns the values of each metric snapshot passed by each by field,
+// keyed by its name, which includes any tags, with the percentiles ps of
+// histograms and timers.  Tagged metrics also carry their tags, including the
+// registry's default tags, in a "tags" field.  Healthchecks are checked, and
+// carry their error or nil.
+func getAll(each func(func(string, interface{})), ps []float64) map[string]map[string]interface{} {
 	data := make(map[string]map[string]interface{})
-	r.Each(func(name string, i interface{}) {
+	each(func(name string, i interface{}) {
 		values := make(map[string]interface{})
 		switch metric := i.(type) {
 		case Counter:
 			values["count"] = metric.Count()
+		case CounterFloat64:
+			values["count"] = metric.Count()
 		case Gauge:
 			values["value"] = metric.Value()
 		case GaugeFloat64:
 			values["value"] = metric.Value()
+		case MergeableGaugeFloat64:
+			g := metric.Snapshot()
+			values["value"] = g.Value()
+			values["count"] = g.Count()
 		case Healthcheck:
 			values["error"] = nil
 			metric.Check()
@@ -27,17 +49,16 @@ func (r *StandardRegistry) MarshalJSON() ([]byte, error) {
 			}
 		case Histogram:
 			h := metric.Snapshot()
-			ps := h.Percentiles([]float64{0.5, 0.75, 0.95, 0.99, 0.999})
+			ps := MetricPercentiles(ps, h)
+			scores := h.Percentiles(ps)
 			values["count"] = h.Count()
 			values["min"] = h.Min()
 			values["max"] = h.Max()
 			values["mean"] = h.Mean()
 			values["stddev"] = h.StdDev()
-			values["median"] = ps[0]
-			values["75%"] = ps[1]
-			values["95%"] = ps[2]
-			values["99%"] = ps[3]
-			values["99.9%"] = ps[4]
+			for i, p := range ps {
+				values[percentileLabel(p)] = scores[i]
+			}
 		case Meter:
 			m := metric.Snapshot()
 			values["count"] = m.Count()
@@ -47,33 +68,41 @@ func (r *StandardRegistry) MarshalJSON() ([]byte, error) {
 			values["mean.rate"] = m.RateMean()
 		case Timer:
 			t := metric.Snapshot()
-			ps := t.Percentiles([]float64{0.5, 0.75, 0.95, 0.99, 0.999})
+			ps := MetricPercentiles(ps, t)
+			scores := t.Percentiles(ps)
 			values["count"] = t.Count()
 			values["min"] = t.Min()
 			values["max"] = t.Max()
 			values["mean"] = t.Mean()
 			values["stddev"] = t.StdDev()
-			values["median"] = ps[0]
-			values["75%"] = ps[1]
-			values["95%"] = ps[2]
-			values["99%"] = ps[3]
-			values["99.9%"] = ps[4]
+			for i, p := range ps {
+				values[percentileLabel(p)] = scores[i]
+			}
 			values["1m.rate"] = t.Rate1()
 			values["5m.rate"] = t.Rate5()
 			values["15m.rate"] = t.Rate15()
 			values["mean.rate"] = t.RateMean()
+			values["interval.rate"] = t.IntervalRate()
+		}
+		if _, tags := SplitTaggedName(name); 0 != len(tags) {
+			values["tags"] = tags
 		}
 		data[name] = values
 	})
-	return json.Marshal(data)
+	return data
 }
 
 // WriteJSON writes metrics from the given registry  periodically to the
-// specified io.Writer as JSON.
+// specified io.Writer as JSON, one object per line, which suits log shipping
+// pipelines.
 func WriteJSON(r Registry, d time.Duration, w io.Writer) {
-	for _ = range time.Tick(d) {
-		WriteJSONOnce(r, w)
-	}
+	WriteJSONContext(context.Background(), r, d, w)
+}
+
+// WriteJSONContext is WriteJSON until ctx is done, when it writes a final
+// object before returning.
+func WriteJSONContext(ctx context.Context, r Registry, d time.Duration, w io.Writer) {
+	FlushSchedule{}.RunContext(ctx, d, Closed(r), func(time.Time) { WriteJSONOnce(r, w) })
 }
 
 // WriteJSONOnce writes metrics from the given registry to the specified
@@ -82,6 +111,20 @@ func WriteJSONOnce(r Registry, w io.Writer) {
 	json.NewEncoder(w).Encode(r)
 }
 
-func (p *PrefixedRegistry) MarshalJSON() ([]byte, error) {
-	return json.Marshal(p.underlying)
+// MarshalJSON returns a byte slice containing a JSON representation of the
+// metrics in the PrefixedRegistry, which all have its prefix.
+func (r *PrefixedRegistry) MarshalJSON() ([]byte, error) {
+	return marshalJSON(r.EachSnapshot, RegistryPercentiles(r))
+}
+
+// MarshalJSON returns a byte slice containing a JSON representation of the
+// metrics registered through the TaggedSubRegistry.
+func (r *TaggedSubRegistry) MarshalJSON() ([]byte, error) {
+	return marshalJSON(r.EachSnapshot, RegistryPercentiles(r))
+}
+
+// MarshalJSON returns a byte slice containing a JSON representation of the
+// snapshots, in the same form as that of the registry they were taken of.
+func (s *RegistrySnapshot) MarshalJSON() ([]byte, error) {
+	return marshalJSON(s.Each, s.reportedPercentiles(nil))
 }
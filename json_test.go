@@ -26,3 +26,33 @@ func TestRegistryWriteJSONOnce(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestRegistryMarshalJSONTags(t *testing.T) {
+	r := NewRegistry()
+	r.(*StandardRegistry).SetDefaultTags(map[string]string{"host": "a"})
+	c := NewCounter()
+	c.(Taggable).AddTags(map[string]string{"endpoint": "/users"})
+	c.Inc(1)
+	r.Register("counter", c)
+	b, err := json.Marshal(r)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if s := string(b); `{"counter;endpoint=/users;host=a":{"count":1,"tags":{"endpoint":"/users","host":"a"}}}` != s {
+		t.Errorf("json.Marshal(): %s\n", s)
+	}
+}
+
+func TestPrefixedRegistryMarshalJSON(t *testing.T) {
+	r := NewRegistry()
+	r.Register("other", NewCounter())
+	pr := NewPrefixedChildRegistry(r, "prefix.")
+	pr.Register("counter", NewCounter())
+	b, err := json.Marshal(pr)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if s := string(b); `{"prefix.counter":{"count":0}}` != s {
+		t.Errorf("json.Marshal(): %s\n", s)
+	}
+}
@@ -0,0 +1,340 @@
+// Package kafka publishes the metrics in a go-metrics Registry to a Kafka
+// topic, one message per series each flush, as JSON or Avro.  It doesn't
+// depend on a Kafka client; a Producer adapting sarama's or franz-go's takes
+// a few lines.
+package kafka
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+// A Format is the encoding of the values of messages.
+type Format int
+
+const (
+	// JSON encodes each Record as a JSON object.
+	JSON Format = iota
+
+	// Avro encodes each Record in the Avro binary encoding of Schema.
+	Avro
+)
+
+// Schema is the Avro schema of a Record, for a consumer's reader or a schema
+// registry.  Timestamps are Unix milliseconds.
+const Schema = `{"type":"record","name":"Metric","namespace":"com.github.rcrowley.gometrics","fields":[` +
+	`{"name":"name","type":"string"},` +
+	`{"name":"tags","type":{"type":"map","values":"string"}},` +
+	`{"name":"type","type":"string"},` +
+	`{"name":"timestamp","type":{"type":"long","logicalType":"timestamp-millis"}},` +
+	`{"name":"fields","type":{"type":"map","values":"double"}}]}`
+
+// A Record is one series of a snapshot, as the value of a message carries it.
+type Record struct {
+	Name      string             `json:"name"`           // Name without tags
+	Tags      map[string]string  `json:"tags,omitempty"` // Tags of the series, and those of Config.Tags
+	Type      string             `json:"type"`           // counter, gauge, histogram, meter or timer
+	Timestamp int64              `json:"timestamp"`      // When the series was observed, in Unix milliseconds
+	Fields    map[string]float64 `json:"fields"`         // Values by name, e.g. count, p99 and m1
+}
+
+// A Message is one Kafka message.  Its key is the name of the series, tags
+// included, so that a series' messages all land in one partition.
+type Message struct {
+	Key   []byte
+	Value []byte
+}
+
+// A Producer publishes the messages of one flush to a topic, returning once
+// they're acknowledged or have failed.
+type Producer interface {
+	Produce(topic string, messages []Message) error
+}
+
+// ProducerFunc is a Producer of an ordinary function.
+type ProducerFunc func(topic string, messages []Message) error
+
+// Produce calls f(topic, messages).
+func (f ProducerFunc) Produce(topic string, messages []Message) error {
+	return f(topic, messages)
+}
+
+// Config configures the Kafka reporter.
+type Config struct {
+	Producer      Producer          // Producer publishing the messages
+	Topic         string            // Topic of every message
+	Registry      metrics.Registry  // Registry to be exported
+	FlushInterval time.Duration     // Flush interval
+	Format        Format            // Encoding of the values of messages
+	Tags          map[string]string // Tags added to every record, which the series' own tags override
+	DurationUnit  time.Duration     // Unit of timer durations, or nanoseconds if zero
+	Percentiles   []float64         // Percentiles of timers and histograms, each a field of its own
+
+	// SchemaID, if set, prefixes Avro values with the header of the
+	// Confluent wire format naming their schema, Schema as registered in a
+	// Confluent schema registry under that ID.
+	SchemaID int32
+
+	// Schedule aligns and jitters the flushes of Run within FlushInterval.
+	Schedule metrics.FlushSchedule
+
+	OnError func(error)              // Called with each error of Run, which logs it if nil
+	Metrics *metrics.ReporterMetrics // Records each flush, counting the messages of failed ones as dropped
+}
+
+// Reporter publishes snapshots of a registry to Kafka.
+type Reporter struct {
+	c Config
+}
+
+// NewReporter returns a Reporter publishing through c.Producer.  It's a
+// metrics.SnapshotReporter too, e.g. for the series a metrics.MultiReporter
+// selects for it.
+func NewReporter(c Config) *Reporter {
+	return &Reporter{c: c}
+}
+
+// Kafka is a blocking exporter function which publishes the metrics in
+// c.Registry to c.Topic every c.FlushInterval, passing errors to c.OnError,
+// or logging them, until c.Registry is closed.
+func Kafka(c Config) {
+	NewReporter(c).Run()
+}
+
+// Flush publishes a snapshot of the registry in one call to Produce.
+func (r *Reporter) Flush() error {
+	return r.Report(r.c.Registry.Snapshot())
+}
+
+// Report publishes the given snapshot in one call to Produce, each message
+// stamped with the time its series was observed.  Nothing is produced if it
+// holds no series Messages renders.
+func (r *Reporter) Report(s *metrics.RegistrySnapshot) error {
+	return r.c.Metrics.Flush(func() error {
+		messages, err := Messages(r.c, s)
+		if nil != err || 0 == len(messages) {
+			return err
+		}
+		if err := r.c.Producer.Produce(r.c.Topic, messages); nil != err {
+			r.c.Metrics.Drop(len(messages))
+			return err
+		}
+		return nil
+	})
+}
+
+// Run flushes every c.FlushInterval, passing errors to c.OnError, or logging
+// them, until c.Registry is closed.
+func (r *Reporter) Run() {
+	r.RunContext(context.Background())
+}
+
+// RunContext is Run until ctx is done, when it publishes a final snapshot
+// before returning.
+func (r *Reporter) RunContext(ctx context.Context) {
+	r.c.Schedule.RunContext(ctx, r.c.FlushInterval, metrics.Closed(r.c.Registry), func(time.Time) {
+		metrics.ReportError(r.c.OnError, r.Flush())
+	})
+}
+
+// Messages renders each series of s as a message in c.Format, in order of
+// name.  Healthchecks, metrics of types this package doesn't know and values
+// which aren't finite are left out.
+func Messages(c Config, s *metrics.RegistrySnapshot) ([]Message, error) {
+	var messages []Message
+	var err error
+	s.Each(func(name string, i interface{}) {
+		if nil != err {
+			return
+		}
+		record, ok := NewRecord(c, name, i, metrics.SnapshotTime(i, s.Timestamp()))
+		if !ok {
+			return
+		}
+		var value []byte
+		switch c.Format {
+		case JSON:
+			value, err = json.Marshal(record)
+		case Avro:
+			value = appendAvro(confluentHeader(c.SchemaID), record)
+		default:
+			err = fmt.Errorf("kafka: unknown format %d", c.Format)
+		}
+		messages = append(messages, Message{Key: []byte(name), Value: value})
+	})
+	if nil != err {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// NewRecord returns the record of the snapshot i of the series by the given
+// name, observed at the given time, or false if it isn't a metric this
+// package knows.
+func NewRecord(c Config, name string, i interface{}, observed time.Time) (Record, bool) {
+	if observed.IsZero() {
+		observed = time.Now()
+	}
+	base, tags := metrics.SplitTaggedName(name)
+	r := Record{
+		Name:      base,
+		Tags:      mergeTags(c.Tags, tags),
+		Timestamp: observed.UnixNano() / int64(time.Millisecond),
+		Fields:    make(map[string]float64),
+	}
+	field := func(key string, v float64) {
+		if !math.IsNaN(v) && !math.IsInf(v, 0) {
+			r.Fields[key] = v
+		}
+	}
+	du := float64(c.DurationUnit)
+	if 0 == du {
+		du = float64(time.Nanosecond)
+	}
+	switch metric := i.(type) {
+	case metrics.Counter:
+		r.Type = "counter"
+		field("count", float64(metric.Count()))
+	case metrics.CounterFloat64:
+		r.Type = "counter"
+		field("count", metric.Count())
+	case metrics.Gauge:
+		r.Type = "gauge"
+		field("value", float64(metric.Value()))
+	case metrics.GaugeFloat64:
+		r.Type = "gauge"
+		field("value", metric.Value())
+	case metrics.MergeableGaugeFloat64:
+		r.Type = "gauge"
+		field("value", metric.Value())
+		field("count", float64(metric.Count()))
+	case metrics.Histogram:
+		r.Type = "histogram"
+		percentiles := metrics.MetricPercentiles(c.Percentiles, metric)
+		ps := metric.Percentiles(percentiles)
+		field("count", float64(metric.Count()))
+		field("min", float64(metric.Min()))
+		field("max", float64(metric.Max()))
+		field("mean", metric.Mean())
+		field("stddev", metric.StdDev())
+		field("sum", float64(metric.Sum()))
+		for i, p := range percentiles {
+			field(metrics.PercentileName(p), ps[i])
+		}
+	case metrics.Meter:
+		r.Type = "meter"
+		field("count", float64(metric.Count()))
+		field("m1", metric.Rate1())
+		field("m5", metric.Rate5())
+		field("m15", metric.Rate15())
+		field("mean", metric.RateMean())
+	case metrics.Timer:
+		r.Type = "timer"
+		percentiles := metrics.MetricPercentiles(c.Percentiles, metric)
+		ps := metric.Percentiles(percentiles)
+		field("count", float64(metric.Count()))
+		field("min", float64(metric.Min())/du)
+		field("max", float64(metric.Max())/du)
+		field("mean", metric.Mean()/du)
+		field("stddev", metric.StdDev()/du)
+		field("sum", float64(metric.Sum())/du)
+		for i, p := range percentiles {
+			field(metrics.PercentileName(p), ps[i]/du)
+		}
+		field("m1", metric.Rate1())
+		field("m5", metric.Rate5())
+		field("m15", metric.Rate15())
+		field("meanrate", metric.RateMean())
+	default:
+		return Record{}, false
+	}
+	return r, true
+}
+
+// mergeTags returns the configured tags overridden by those of the series,
+// or nil if there are neither.
+func mergeTags(defaults, tags map[string]string) map[string]string {
+	if 0 == len(defaults) {
+		if 0 == len(tags) {
+			return nil
+		}
+		return tags
+	}
+	merged := make(map[string]string, len(defaults)+len(tags))
+	for k, v := range defaults {
+		merged[k] = v
+	}
+	for k, v := range tags {
+		merged[k] = v
+	}
+	return merged
+}
+
+// confluentHeader returns the magic byte and big-endian schema ID which
+// prefix a value in the Confluent wire format, or nil if id is zero.
+func confluentHeader(id int32) []byte {
+	if 0 == id {
+		return nil
+	}
+	b := make([]byte, 5)
+	binary.BigEndian.PutUint32(b[1:], uint32(id))
+	return b
+}
+
+// appendAvro appends the Avro binary encoding of r, per Schema, to b.  Map
+// entries are written in order of key, so that equal records encode equally.
+func appendAvro(b []byte, r Record) []byte {
+	buf := bytes.NewBuffer(b)
+	avroString(buf, r.Name)
+	keys := make([]string, 0, len(r.Tags))
+	for k := range r.Tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	if 0 != len(keys) {
+		avroLong(buf, int64(len(keys)))
+		for _, k := range keys {
+			avroString(buf, k)
+			avroString(buf, r.Tags[k])
+		}
+	}
+	avroLong(buf, 0)
+	avroString(buf, r.Type)
+	avroLong(buf, r.Timestamp)
+	keys = keys[:0]
+	for k := range r.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	if 0 != len(keys) {
+		avroLong(buf, int64(len(keys)))
+		for _, k := range keys {
+			avroString(buf, k)
+			var d [8]byte
+			binary.LittleEndian.PutUint64(d[:], math.Float64bits(r.Fields[k]))
+			buf.Write(d[:])
+		}
+	}
+	avroLong(buf, 0)
+	return buf.Bytes()
+}
+
+// avroLong writes an Avro long: a zig-zag varint.
+func avroLong(buf *bytes.Buffer, v int64) {
+	var b [binary.MaxVarintLen64]byte
+	buf.Write(b[:binary.PutVarint(b[:], v)])
+}
+
+// avroString writes an Avro string: its length as a long, then its bytes.
+func avroString(buf *bytes.Buffer, s string) {
+	avroLong(buf, int64(len(s)))
+	buf.WriteString(s)
+}
@@ -0,0 +1,173 @@
+package kafka
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+func TestMessagesJSON(t *testing.T) {
+	r := metrics.NewRegistry()
+	metrics.GetOrRegisterCounterT("hits", map[string]string{"endpoint": "/users"}, r).Inc(3)
+	tm := metrics.NewRegisteredTimer("latency", r)
+	tm.Update(10 * time.Millisecond)
+	metrics.NewRegisteredHealthcheck("db", r, func(metrics.Healthcheck) {})
+	c := Config{Tags: map[string]string{"host": "a"}, DurationUnit: time.Millisecond, Percentiles: []float64{0.5}}
+	messages, err := Messages(c, r.Snapshot())
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 2 != len(messages) {
+		t.Fatalf("Messages(): %d messages\n", len(messages))
+	}
+	if key := string(messages[0].Key); "hits;endpoint=/users" != key {
+		t.Errorf("key: %q\n", key)
+	}
+	var hits Record
+	if err := json.Unmarshal(messages[0].Value, &hits); nil != err {
+		t.Fatal(err)
+	}
+	if "hits" != hits.Name || "counter" != hits.Type || 3 != hits.Fields["count"] || !reflect.DeepEqual(map[string]string{"endpoint": "/users", "host": "a"}, hits.Tags) {
+		t.Errorf("hits: %+v\n", hits)
+	}
+	if 0 == hits.Timestamp {
+		t.Error("hits: no timestamp\n")
+	}
+	var latency Record
+	if err := json.Unmarshal(messages[1].Value, &latency); nil != err {
+		t.Fatal(err)
+	}
+	if "timer" != latency.Type || 10 != latency.Fields["max"] || 10 != latency.Fields["p50"] {
+		t.Errorf("latency: %+v\n", latency)
+	}
+}
+
+func TestMessagesAvro(t *testing.T) {
+	r := metrics.NewRegistry()
+	metrics.GetOrRegisterGaugeFloat64T("load", map[string]string{"cpu": "0"}, r).Update(0.5)
+	messages, err := Messages(Config{Format: Avro, SchemaID: 7}, r.Snapshot())
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 1 != len(messages) {
+		t.Fatalf("Messages(): %d messages\n", len(messages))
+	}
+	value := messages[0].Value
+	if header := []byte{0, 0, 0, 0, 7}; !bytes.Equal(header, value[:5]) {
+		t.Fatalf("header: %v\n", value[:5])
+	}
+	record := decodeAvro(t, bytes.NewReader(value[5:]))
+	if "load" != record.Name || "gauge" != record.Type || !reflect.DeepEqual(map[string]string{"cpu": "0"}, record.Tags) || !reflect.DeepEqual(map[string]float64{"value": 0.5}, record.Fields) {
+		t.Errorf("record: %+v\n", record)
+	}
+}
+
+func TestReport(t *testing.T) {
+	reg := metrics.NewRegistry()
+	metrics.NewRegisteredCounter("hits", reg).Inc(1)
+	metrics.NewRegisteredGauge("depth", reg).Update(2)
+	var topic string
+	var produced []Message
+	r := NewReporter(Config{
+		Producer: ProducerFunc(func(t string, messages []Message) error {
+			topic, produced = t, messages
+			return nil
+		}),
+		Topic:    "metrics",
+		Registry: reg,
+	})
+	var _ metrics.SnapshotReporter = r
+	if err := r.Flush(); nil != err {
+		t.Fatal(err)
+	}
+	if "metrics" != topic || 2 != len(produced) {
+		t.Errorf("Produce(%q, %d messages)\n", topic, len(produced))
+	}
+}
+
+func TestRunContext(t *testing.T) {
+	reg := metrics.NewRegistry()
+	metrics.NewRegisteredCounter("hits", reg).Inc(1)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	produced := 0
+	NewReporter(Config{
+		Producer: ProducerFunc(func(string, []Message) error {
+			produced++
+			return nil
+		}),
+		Registry:      reg,
+		FlushInterval: time.Hour,
+	}).RunContext(ctx)
+	if 1 != produced {
+		t.Errorf("produced: 1 != %v\n", produced)
+	}
+}
+
+func TestReportError(t *testing.T) {
+	reg := metrics.NewRegistry()
+	metrics.NewRegisteredCounter("hits", reg).Inc(1)
+	m := metrics.NewReporterMetrics("kafka", metrics.NewRegistry())
+	failure := errors.New("broker unavailable")
+	r := NewReporter(Config{
+		Producer: ProducerFunc(func(string, []Message) error { return failure }),
+		Registry: reg,
+		Metrics:  m,
+	})
+	if err := r.Flush(); failure != err {
+		t.Errorf("Flush(): %v\n", err)
+	}
+	if n := m.DroppedPoints.Count(); 1 != n {
+		t.Errorf("DroppedPoints: 1 != %v\n", n)
+	}
+}
+
+// decodeAvro decodes a Record per Schema.
+func decodeAvro(t *testing.T, r *bytes.Reader) Record {
+	long := func() int64 {
+		v, err := binary.ReadVarint(r)
+		if nil != err {
+			t.Fatal(err)
+		}
+		return v
+	}
+	str := func() string {
+		b := make([]byte, long())
+		r.Read(b)
+		return string(b)
+	}
+	var record Record
+	record.Name = str()
+	for n := long(); 0 != n; n = long() {
+		if nil == record.Tags {
+			record.Tags = make(map[string]string)
+		}
+		for ; 0 < n; n-- {
+			k := str()
+			record.Tags[k] = str()
+		}
+	}
+	record.Type = str()
+	record.Timestamp = long()
+	record.Fields = make(map[string]float64)
+	for n := long(); 0 != n; n = long() {
+		for ; 0 < n; n-- {
+			k := str()
+			var d [8]byte
+			r.Read(d[:])
+			record.Fields[k] = math.Float64frombits(binary.LittleEndian.Uint64(d[:]))
+		}
+	}
+	if 0 != r.Len() {
+		t.Errorf("%d bytes left over\n", r.Len())
+	}
+	return record
+}
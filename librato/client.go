@@ -13,6 +13,7 @@ const OperationsShort = "ops"
 
 type LibratoClient struct {
 	Email, Token string
+	Client       *http.Client // Posts the requests; nil means http.DefaultClient
 }
 
 // property strings
@@ -65,6 +66,28 @@ type Batch struct {
 	Source      string        `json:"source"`
 }
 
+// part returns the batch of the measurements [i, j) of the gauges followed
+// by the counters.
+func (b Batch) part(i, j int) Batch {
+	p := Batch{MeasureTime: b.MeasureTime, Source: b.Source}
+	g := len(b.Gauges)
+	if i < g {
+		k := j
+		if k > g {
+			k = g
+		}
+		p.Gauges = b.Gauges[i:k]
+	}
+	if j > g {
+		k := i - g
+		if k < 0 {
+			k = 0
+		}
+		p.Counters = b.Counters[k : j-g]
+	}
+	return p
+}
+
 func (self *LibratoClient) PostMetrics(batch Batch) (err error) {
 	var (
 		js   []byte
@@ -87,7 +110,11 @@ func (self *LibratoClient) PostMetrics(batch Batch) (err error) {
 	req.Header.Set("Content-Type", "application/json")
 	req.SetBasicAuth(self.Email, self.Token)
 
-	if resp, err = http.DefaultClient.Do(req); err != nil {
+	client := self.Client
+	if nil == client {
+		client = http.DefaultClient
+	}
+	if resp, err = client.Do(req); err != nil {
 		return
 	}
 
@@ -1,10 +1,14 @@
 package librato
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"math"
+	"net/http"
 	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/rcrowley/go-metrics"
@@ -29,33 +33,76 @@ type Reporter struct {
 	Registry        metrics.Registry
 	Percentiles     []float64              // percentiles to report on histogram metrics
 	TimerAttributes map[string]interface{} // units in which timers will be displayed
-	intervalSec     int64
+	LargeInts       metrics.Int64Coercer   // conversion of int64 values beyond ±2^53
+
+	// BatchSize is the maximum number of measurements posted by each
+	// request.  Zero posts every measurement of a flush in one request.
+	BatchSize int
+
+	// Concurrency is the maximum number of requests of one flush in flight
+	// at once.  Zero or one posts them one after another.
+	Concurrency int
+
+	// Client posts the requests.  Sharing one client between reporters
+	// shares its pool of connections; metrics.NewHTTPClient builds one with
+	// a tuned transport.  Nil means http.DefaultClient.
+	Client *http.Client
+
+	// Metrics, if set, records the export lag of Run.
+	Metrics *metrics.ReporterMetrics
+
+	intervalSec int64
 }
 
 func NewReporter(r metrics.Registry, d time.Duration, e string, t string, s string, p []float64, u time.Duration) *Reporter {
-	return &Reporter{e, t, "", s, d, r, p, translateTimerAttributes(u), int64(d / time.Second)}
+	return &Reporter{
+		Email:           e,
+		Token:           t,
+		Source:          s,
+		Interval:        d,
+		Registry:        r,
+		Percentiles:     p,
+		TimerAttributes: translateTimerAttributes(u),
+		intervalSec:     int64(d / time.Second),
+	}
 }
 
 func Librato(r metrics.Registry, d time.Duration, e string, t string, s string, p []float64, u time.Duration) {
 	NewReporter(r, d, e, t, s, p, u).Run()
 }
 
+// Run posts the metrics every Interval until the registry is closed.
 func (self *Reporter) Run() {
+	self.RunContext(context.Background())
+}
+
+// RunContext is Run until ctx is done, when it posts a final time before
+// returning.
+func (self *Reporter) RunContext(ctx context.Context) {
 	log.Printf("WARNING: This client has been DEPRECATED! It has been moved to https://github.com/mihasya/go-metrics-librato and will be removed from rcrowley/go-metrics on August 5th 2015")
-	ticker := time.Tick(self.Interval)
-	metricsApi := &LibratoClient{self.Email, self.Token}
-	for now := range ticker {
-		var metrics Batch
-		var err error
-		if metrics, err = self.BuildRequest(now, self.Registry); err != nil {
+	metricsApi := &LibratoClient{Email: self.Email, Token: self.Token, Client: self.Client}
+	metrics.FlushSchedule{}.RunContext(ctx, self.Interval, metrics.Closed(self.Registry), func(now time.Time) {
+		batch, err := self.BuildRequest(now, self.Registry)
+		if err != nil {
 			log.Printf("ERROR constructing librato request body %s", err)
-			continue
+			return
 		}
-		if err := metricsApi.PostMetrics(metrics); err != nil {
+		if err := self.Metrics.Flush(func() error { return self.post(batch, metricsApi.PostMetrics) }); err != nil {
 			log.Printf("ERROR sending metrics to librato %s", err)
-			continue
 		}
+	})
+}
+
+// post posts batch with postMetrics in parts of at most BatchSize
+// measurements, up to Concurrency of them at once, waiting for them all.
+func (self *Reporter) post(batch Batch, postMetrics func(Batch) error) error {
+	n := len(batch.Gauges) + len(batch.Counters)
+	if 0 == n {
+		return nil
 	}
+	return metrics.SendBatches(n, self.BatchSize, self.Concurrency, func(i, j int) error {
+		return postMetrics(batch.part(i, j))
+	})
 }
 
 // calculate sum of squares from data provided by metrics.Histogram
@@ -88,7 +135,7 @@ func (self *Reporter) BuildRequest(now time.Time, r metrics.Registry) (snapshot
 	snapshot.Gauges = make([]Measurement, 0)
 	snapshot.Counters = make([]Measurement, 0)
 	histogramGaugeCount := 1 + len(self.Percentiles)
-	r.Each(func(name string, metric interface{}) {
+	r.EachSnapshot(func(name string, metric interface{}) {
 		if self.Namespace != "" {
 			name = fmt.Sprintf("%s.%s", self.Namespace, name)
 		}
@@ -98,7 +145,7 @@ func (self *Reporter) BuildRequest(now time.Time, r metrics.Registry) (snapshot
 		case metrics.Counter:
 			if m.Count() > 0 {
 				measurement[Name] = fmt.Sprintf("%s.%s", name, "count")
-				measurement[Value] = float64(m.Count())
+				measurement[Value] = self.LargeInts.Coerce(m.Count())
 				measurement[Attributes] = map[string]interface{}{
 					DisplayUnitsLong:  Operations,
 					DisplayUnitsShort: OperationsShort,
@@ -108,26 +155,36 @@ func (self *Reporter) BuildRequest(now time.Time, r metrics.Registry) (snapshot
 			}
 		case metrics.Gauge:
 			measurement[Name] = name
-			measurement[Value] = float64(m.Value())
+			measurement[Value] = self.LargeInts.Coerce(m.Value())
 			snapshot.Gauges = append(snapshot.Gauges, measurement)
 		case metrics.GaugeFloat64:
 			measurement[Name] = name
 			measurement[Value] = float64(m.Value())
 			snapshot.Gauges = append(snapshot.Gauges, measurement)
+		case metrics.MergeableGaugeFloat64:
+			g := m.Snapshot()
+			measurement[Name] = name
+			measurement[Value] = g.Value()
+			snapshot.Gauges = append(snapshot.Gauges, measurement)
+			snapshot.Counters = append(snapshot.Counters, Measurement{
+				Name:   fmt.Sprintf("%s.%s", name, "count"),
+				Value:  self.LargeInts.Coerce(g.Count()),
+				Period: measurement[Period],
+			})
 		case metrics.Histogram:
 			if m.Count() > 0 {
 				gauges := make([]Measurement, histogramGaugeCount, histogramGaugeCount)
 				s := m.Sample()
 				measurement[Name] = fmt.Sprintf("%s.%s", name, "hist")
 				measurement[Count] = uint64(s.Count())
-				measurement[Max] = float64(s.Max())
-				measurement[Min] = float64(s.Min())
-				measurement[Sum] = float64(s.Sum())
+				measurement[Max] = self.LargeInts.Coerce(s.Max())
+				measurement[Min] = self.LargeInts.Coerce(s.Min())
+				measurement[Sum] = self.LargeInts.Coerce(s.Sum())
 				measurement[SumSquares] = sumSquares(s)
 				gauges[0] = measurement
 				for i, p := range self.Percentiles {
 					gauges[i+1] = Measurement{
-						Name:   fmt.Sprintf("%s.%.2f", measurement[Name], p),
+						Name:   fmt.Sprintf("%s.%s", measurement[Name], percentileSuffix("%.2f", p)),
 						Value:  s.Percentile(p),
 						Period: measurement[Period],
 					}
@@ -136,7 +193,7 @@ func (self *Reporter) BuildRequest(now time.Time, r metrics.Registry) (snapshot
 			}
 		case metrics.Meter:
 			measurement[Name] = name
-			measurement[Value] = float64(m.Count())
+			measurement[Value] = self.LargeInts.Coerce(m.Count())
 			snapshot.Counters = append(snapshot.Counters, measurement)
 			snapshot.Gauges = append(snapshot.Gauges,
 				Measurement{
@@ -172,7 +229,7 @@ func (self *Reporter) BuildRequest(now time.Time, r metrics.Registry) (snapshot
 			)
 		case metrics.Timer:
 			measurement[Name] = name
-			measurement[Value] = float64(m.Count())
+			measurement[Value] = self.LargeInts.Coerce(m.Count())
 			snapshot.Counters = append(snapshot.Counters, measurement)
 			if m.Count() > 0 {
 				libratoName := fmt.Sprintf("%s.%s", name, "timer.mean")
@@ -181,15 +238,15 @@ func (self *Reporter) BuildRequest(now time.Time, r metrics.Registry) (snapshot
 					Name:       libratoName,
 					Count:      uint64(m.Count()),
 					Sum:        m.Mean() * float64(m.Count()),
-					Max:        float64(m.Max()),
-					Min:        float64(m.Min()),
+					Max:        self.LargeInts.Coerce(m.Max()),
+					Min:        self.LargeInts.Coerce(m.Min()),
 					SumSquares: sumSquaresTimer(m),
 					Period:     int64(self.Interval.Seconds()),
 					Attributes: self.TimerAttributes,
 				}
 				for i, p := range self.Percentiles {
 					gauges[i+1] = Measurement{
-						Name:       fmt.Sprintf("%s.timer.%2.0f", name, p*100),
+						Name:       fmt.Sprintf("%s.timer.%s", name, percentileSuffix("%2.0f", p*100)),
 						Value:      m.Percentile(p),
 						Period:     int64(self.Interval.Seconds()),
 						Attributes: self.TimerAttributes,
@@ -233,3 +290,15 @@ func (self *Reporter) BuildRequest(now time.Time, r metrics.Registry) (snapshot
 	})
 	return
 }
+
+// percentileSuffix formats p according to format unless that would round it,
+// as "%.2f" does to 0.999 and "%2.0f" to 99.9, in which case p is formatted
+// with as many decimals as it needs so that p99.9 and p99.99 don't collide.
+func percentileSuffix(format string, p float64) string {
+	s := fmt.Sprintf(format, p)
+	if v, err := strconv.ParseFloat(strings.TrimSpace(s), 64); nil == err && math.Abs(v-p) < 1e-9 {
+		return s
+	}
+	s = strings.TrimRight(strconv.FormatFloat(p, 'f', 6, 64), "0")
+	return strings.TrimSuffix(s, ".")
+}
@@ -0,0 +1,63 @@
+package librato
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestPercentileSuffix(t *testing.T) {
+	for _, c := range []struct {
+		format string
+		p      float64
+		want   string
+	}{
+		{"%.2f", 0.5, "0.50"},
+		{"%.2f", 0.99, "0.99"},
+		{"%.2f", 0.999, "0.999"},
+		{"%.2f", 0.9999, "0.9999"},
+		{"%2.0f", 0.05 * 100, " 5"},
+		{"%2.0f", 0.99 * 100, "99"},
+		{"%2.0f", 0.999 * 100, "99.9"},
+		{"%2.0f", 0.9999 * 100, "99.99"},
+	} {
+		if s := percentileSuffix(c.format, c.p); c.want != s {
+			t.Errorf("percentileSuffix(%q, %v): %q != %q\n", c.format, c.p, c.want, s)
+		}
+	}
+}
+
+func TestPostBatches(t *testing.T) {
+	batch := Batch{Source: "host", MeasureTime: 60}
+	for i := 0; i < 3; i++ {
+		batch.Gauges = append(batch.Gauges, Measurement{Name: "g"})
+		batch.Counters = append(batch.Counters, Measurement{Name: "c"})
+	}
+	var (
+		mutex            sync.Mutex
+		gauges, counters int
+		requests         int
+	)
+	r := &Reporter{BatchSize: 4, Concurrency: 2}
+	err := r.post(batch, func(b Batch) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if "host" != b.Source || 60 != b.MeasureTime || len(b.Gauges)+len(b.Counters) > 4 {
+			t.Errorf("batch: %+v\n", b)
+		}
+		requests++
+		gauges += len(b.Gauges)
+		counters += len(b.Counters)
+		return nil
+	})
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 2 != requests || 3 != gauges || 3 != counters {
+		t.Errorf("%d requests of %d gauges and %d counters\n", requests, gauges, counters)
+	}
+	failure := errors.New("no")
+	if err := r.post(batch, func(Batch) error { return failure }); nil == err {
+		t.Error("post(): want error\n")
+	}
+}
@@ -1,6 +1,12 @@
 package metrics
 
 import (
+	"context"
+	"encoding/json"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -8,6 +14,34 @@ type Logger interface {
 	Printf(format string, v ...interface{})
 }
 
+// LogFormat selects how the Log exporter formats each metric.
+type LogFormat int
+
+const (
+	// LogPretty logs each metric over several human-readable lines.  This is
+	// the default.
+	LogPretty LogFormat = iota
+
+	// LogLogfmt logs each metric on one line of key=value pairs, quoting
+	// values which contain spaces, quotes or equals signs.
+	LogLogfmt
+
+	// LogJSON logs each metric on one line as a JSON object.
+	LogJSON
+)
+
+// LogConfig provides a container with configuration parameters for the Log
+// exporter.
+type LogConfig struct {
+	Registry      Registry      // Registry to be exported
+	FlushInterval time.Duration // Flush interval
+	Schedule      FlushSchedule // Alignment and jitter of flushes within FlushInterval
+	DurationUnit  time.Duration // Time conversion unit for durations
+	Logger        Logger        // Logger to write to
+	Format        LogFormat     // Format of each metric
+	Percentiles   []float64     // Percentiles of histograms and timers, or nil for the registry's
+}
+
 func Log(r Registry, freq time.Duration, l Logger) {
 	LogScaled(r, freq, time.Nanosecond, l)
 }
@@ -15,66 +49,316 @@ func Log(r Registry, freq time.Duration, l Logger) {
 // Output each metric in the given registry periodically using the given
 // logger. Print timings in `scale` units (eg time.Millisecond) rather than nanos.
 func LogScaled(r Registry, freq time.Duration, scale time.Duration, l Logger) {
-	du := float64(scale)
-	duSuffix := scale.String()[1:]
-
-	for _ = range time.Tick(freq) {
-		r.Each(func(name string, i interface{}) {
-			switch metric := i.(type) {
-			case Counter:
-				l.Printf("counter %s\n", name)
-				l.Printf("  count:       %9d\n", metric.Count())
-			case Gauge:
-				l.Printf("gauge %s\n", name)
-				l.Printf("  value:       %9d\n", metric.Value())
-			case GaugeFloat64:
-				l.Printf("gauge %s\n", name)
-				l.Printf("  value:       %f\n", metric.Value())
-			case Healthcheck:
-				metric.Check()
-				l.Printf("healthcheck %s\n", name)
-				l.Printf("  error:       %v\n", metric.Error())
-			case Histogram:
-				h := metric.Snapshot()
-				ps := h.Percentiles([]float64{0.5, 0.75, 0.95, 0.99, 0.999})
-				l.Printf("histogram %s\n", name)
-				l.Printf("  count:       %9d\n", h.Count())
-				l.Printf("  min:         %9d\n", h.Min())
-				l.Printf("  max:         %9d\n", h.Max())
-				l.Printf("  mean:        %12.2f\n", h.Mean())
-				l.Printf("  stddev:      %12.2f\n", h.StdDev())
-				l.Printf("  median:      %12.2f\n", ps[0])
-				l.Printf("  75%%:         %12.2f\n", ps[1])
-				l.Printf("  95%%:         %12.2f\n", ps[2])
-				l.Printf("  99%%:         %12.2f\n", ps[3])
-				l.Printf("  99.9%%:       %12.2f\n", ps[4])
-			case Meter:
-				m := metric.Snapshot()
-				l.Printf("meter %s\n", name)
-				l.Printf("  count:       %9d\n", m.Count())
-				l.Printf("  1-min rate:  %12.2f\n", m.Rate1())
-				l.Printf("  5-min rate:  %12.2f\n", m.Rate5())
-				l.Printf("  15-min rate: %12.2f\n", m.Rate15())
-				l.Printf("  mean rate:   %12.2f\n", m.RateMean())
-			case Timer:
-				t := metric.Snapshot()
-				ps := t.Percentiles([]float64{0.5, 0.75, 0.95, 0.99, 0.999})
-				l.Printf("timer %s\n", name)
-				l.Printf("  count:       %9d\n", t.Count())
-				l.Printf("  min:         %12.2f%s\n", float64(t.Min())/du, duSuffix)
-				l.Printf("  max:         %12.2f%s\n", float64(t.Max())/du, duSuffix)
-				l.Printf("  mean:        %12.2f%s\n", t.Mean()/du, duSuffix)
-				l.Printf("  stddev:      %12.2f%s\n", t.StdDev()/du, duSuffix)
-				l.Printf("  median:      %12.2f%s\n", ps[0]/du, duSuffix)
-				l.Printf("  75%%:         %12.2f%s\n", ps[1]/du, duSuffix)
-				l.Printf("  95%%:         %12.2f%s\n", ps[2]/du, duSuffix)
-				l.Printf("  99%%:         %12.2f%s\n", ps[3]/du, duSuffix)
-				l.Printf("  99.9%%:       %12.2f%s\n", ps[4]/du, duSuffix)
-				l.Printf("  1-min rate:  %12.2f\n", t.Rate1())
-				l.Printf("  5-min rate:  %12.2f\n", t.Rate5())
-				l.Printf("  15-min rate: %12.2f\n", t.Rate15())
-				l.Printf("  mean rate:   %12.2f\n", t.RateMean())
+	LogWithConfig(LogConfig{
+		Registry:      r,
+		FlushInterval: freq,
+		DurationUnit:  scale,
+		Logger:        l,
+	})
+}
+
+// LogWithConfig is a blocking exporter function just like LogScaled, but it
+// takes a LogConfig instead.
+func LogWithConfig(c LogConfig) {
+	LogContext(context.Background(), c)
+}
+
+// LogContext is LogWithConfig until ctx is done, when it logs the metrics a
+// final time before returning.
+func LogContext(ctx context.Context, c LogConfig) {
+	c.Schedule.RunContext(ctx, c.FlushInterval, Closed(c.Registry), func(time.Time) { LogOnce(c) })
+}
+
+// LogOnce outputs each metric in the given registry once.  This can be used
+// in a loop similar to LogWithConfig for custom scheduling.
+func LogOnce(c LogConfig) {
+	if 0 == c.DurationUnit {
+		c.DurationUnit = time.Nanosecond
+	}
+	switch c.Format {
+	case LogLogfmt, LogJSON:
+		logStructured(&c)
+	default:
+		logPretty(&c)
+	}
+}
+
+func logPretty(c *LogConfig) {
+	du := float64(c.DurationUnit)
+	duSuffix := c.DurationUnit.String()[1:]
+	ps := reportedPercentiles(c.Percentiles, c.Registry)
+	l := c.Logger
+
+	c.Registry.EachSnapshot(func(name string, i interface{}) {
+		name, tags := SplitTaggedName(name)
+		if 0 != len(tags) {
+			// Tags follow the first line, which names the metric.
+			l = &taggedLogger{Logger: c.Logger, tags: tags}
+		} else {
+			l = c.Logger
+		}
+		switch metric := i.(type) {
+		case Counter:
+			l.Printf("counter %s\n", name)
+			l.Printf("  count:       %9d\n", metric.Count())
+		case CounterFloat64:
+			l.Printf("counter %s\n", name)
+			l.Printf("  count:       %f\n", metric.Count())
+		case Gauge:
+			l.Printf("gauge %s\n", name)
+			l.Printf("  value:       %9d\n", metric.Value())
+		case GaugeFloat64:
+			l.Printf("gauge %s\n", name)
+			l.Printf("  value:       %f\n", metric.Value())
+		case MergeableGaugeFloat64:
+			g := metric.Snapshot()
+			l.Printf("gauge %s\n", name)
+			l.Printf("  value:       %f\n", g.Value())
+			l.Printf("  count:       %9d\n", g.Count())
+		case Healthcheck:
+			metric.Check()
+			l.Printf("healthcheck %s\n", name)
+			l.Printf("  error:       %v\n", metric.Error())
+		case Histogram:
+			h := metric.Snapshot()
+			ps := MetricPercentiles(ps, h)
+			scores := h.Percentiles(ps)
+			l.Printf("histogram %s\n", name)
+			l.Printf("  count:       %9d\n", h.Count())
+			l.Printf("  min:         %9d\n", h.Min())
+			l.Printf("  max:         %9d\n", h.Max())
+			l.Printf("  mean:        %12.2f\n", h.Mean())
+			l.Printf("  stddev:      %12.2f\n", h.StdDev())
+			for i, p := range ps {
+				l.Printf("  %-13s%12.2f\n", percentileLabel(p)+":", scores[i])
+			}
+		case Meter:
+			m := metric.Snapshot()
+			l.Printf("meter %s\n", name)
+			l.Printf("  count:       %9d\n", m.Count())
+			l.Printf("  1-min rate:  %12.2f\n", m.Rate1())
+			l.Printf("  5-min rate:  %12.2f\n", m.Rate5())
+			l.Printf("  15-min rate: %12.2f\n", m.Rate15())
+			l.Printf("  mean rate:   %12.2f\n", m.RateMean())
+		case Timer:
+			t := metric.Snapshot()
+			ps := MetricPercentiles(ps, t)
+			scores := t.Percentiles(ps)
+			l.Printf("timer %s\n", name)
+			l.Printf("  count:       %9d\n", t.Count())
+			l.Printf("  min:         %12.2f%s\n", float64(t.Min())/du, duSuffix)
+			l.Printf("  max:         %12.2f%s\n", float64(t.Max())/du, duSuffix)
+			l.Printf("  mean:        %12.2f%s\n", t.Mean()/du, duSuffix)
+			l.Printf("  stddev:      %12.2f%s\n", t.StdDev()/du, duSuffix)
+			for i, p := range ps {
+				l.Printf("  %-13s%12.2f%s\n", percentileLabel(p)+":", scores[i]/du, duSuffix)
+			}
+			l.Printf("  1-min rate:  %12.2f\n", t.Rate1())
+			l.Printf("  5-min rate:  %12.2f\n", t.Rate5())
+			l.Printf("  15-min rate: %12.2f\n", t.Rate15())
+			l.Printf("  mean rate:   %12.2f\n", t.RateMean())
+		}
+	})
+}
+
+// taggedLogger logs the tags of a metric, pretty-printed, after the first line
+// logged for it.
+type taggedLogger struct {
+	Logger
+	tags   map[string]string
+	logged bool
+}
+
+func (l *taggedLogger) Printf(format string, v ...interface{}) {
+	l.Logger.Printf(format, v...)
+	if l.logged {
+		return
+	}
+	l.logged = true
+	pairs := make([]string, 0, len(l.tags))
+	for _, k := range sortedTagKeys(l.tags) {
+		pairs = append(pairs, k+"="+l.tags[k])
+	}
+	l.Logger.Printf("  tags:        %s\n", strings.Join(pairs, " "))
+}
+
+func sortedTagKeys(tags map[string]string) []string {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// logField is one key and value of a metric logged in a structured format.
+type logField struct {
+	key   string
+	value interface{}
+}
+
+func logStructured(c *LogConfig) {
+	du := float64(c.DurationUnit)
+	ps := reportedPercentiles(c.Percentiles, c.Registry)
+	c.Registry.EachSnapshot(func(name string, i interface{}) {
+		fields := logFields(name, i, du, ps)
+		if nil == fields {
+			return
+		}
+		if l, ok := c.Logger.(structuredLogger); ok {
+			l.logMetric(fields)
+			return
+		}
+		if LogJSON == c.Format {
+			object := make(map[string]interface{}, len(fields))
+			for _, f := range fields {
+				object[f.key] = jsonSafe(f.value)
 			}
-		})
+			b, err := json.Marshal(object)
+			if nil != err {
+				c.Logger.Printf("metrics: %v\n", err)
+				return
+			}
+			c.Logger.Printf("%s\n", b)
+			return
+		}
+		pairs := make([]string, 0, len(fields))
+		for _, f := range fields {
+			if tags, ok := f.value.(map[string]string); ok {
+				for _, k := range sortedTagKeys(tags) {
+					pairs = append(pairs, "tag."+k+"="+logfmtValue(tags[k]))
+				}
+				continue
+			}
+			pairs = append(pairs, f.key+"="+logfmtValue(f.value))
+		}
+		c.Logger.Printf("%s\n", strings.Join(pairs, " "))
+	})
+}
+
+// structuredLogger is a Logger which logs the fields of each metric itself
+// when the Log exporter's format is structured.
+type structuredLogger interface {
+	logMetric([]logField)
+}
+
+// logFields returns the type, name, values and tags of a metric in the order
+// they're logged, with the percentiles ps of histograms and timers and timer
+// durations scaled by du, or nil if the metric isn't one of the standard
+// types.  Tags, if any, are a map[string]string.
+func logFields(name string, i interface{}, du float64, ps []float64) []logField {
+	name, tags := SplitTaggedName(name)
+	fields := metricLogFields(name, i, du, ps)
+	if nil != fields && 0 != len(tags) {
+		fields = append(fields, logField{"tags", tags})
+	}
+	return fields
+}
+
+func metricLogFields(name string, i interface{}, du float64, ps []float64) []logField {
+	switch metric := i.(type) {
+	case Counter:
+		return []logField{
+			{"type", "counter"}, {"name", name},
+			{"count", metric.Count()},
+		}
+	case CounterFloat64:
+		return []logField{
+			{"type", "counter"}, {"name", name},
+			{"count", metric.Count()},
+		}
+	case Gauge:
+		return []logField{
+			{"type", "gauge"}, {"name", name},
+			{"value", metric.Value()},
+		}
+	case GaugeFloat64:
+		return []logField{
+			{"type", "gauge"}, {"name", name},
+			{"value", metric.Value()},
+		}
+	case MergeableGaugeFloat64:
+		g := metric.Snapshot()
+		return []logField{
+			{"type", "gauge"}, {"name", name},
+			{"value", g.Value()}, {"count", g.Count()},
+		}
+	case Healthcheck:
+		metric.Check()
+		var err interface{}
+		if e := metric.Error(); nil != e {
+			err = e.Error()
+		}
+		return []logField{
+			{"type", "healthcheck"}, {"name", name},
+			{"error", err},
+		}
+	case Histogram:
+		h := metric.Snapshot()
+		ps := MetricPercentiles(ps, h)
+		scores := h.Percentiles(ps)
+		fields := []logField{
+			{"type", "histogram"}, {"name", name},
+			{"count", h.Count()}, {"min", h.Min()}, {"max", h.Max()},
+			{"mean", h.Mean()}, {"stddev", h.StdDev()},
+		}
+		for i, p := range ps {
+			fields = append(fields, logField{percentileKey(p), scores[i]})
+		}
+		return fields
+	case Meter:
+		m := metric.Snapshot()
+		return []logField{
+			{"type", "meter"}, {"name", name},
+			{"count", m.Count()},
+			{"rate1", m.Rate1()}, {"rate5", m.Rate5()},
+			{"rate15", m.Rate15()}, {"rate_mean", m.RateMean()},
+		}
+	case Timer:
+		t := metric.Snapshot()
+		ps := MetricPercentiles(ps, t)
+		scores := t.Percentiles(ps)
+		fields := []logField{
+			{"type", "timer"}, {"name", name},
+			{"count", t.Count()},
+			{"min", float64(t.Min()) / du}, {"max", float64(t.Max()) / du},
+			{"mean", t.Mean() / du}, {"stddev", t.StdDev() / du},
+		}
+		for i, p := range ps {
+			fields = append(fields, logField{percentileKey(p), scores[i] / du})
+		}
+		return append(fields,
+			logField{"rate1", t.Rate1()}, logField{"rate5", t.Rate5()},
+			logField{"rate15", t.Rate15()}, logField{"rate_mean", t.RateMean()},
+		)
+	}
+	return nil
+}
+
+// jsonSafe replaces the non-finite floats which JSON can't represent with
+// null.
+func jsonSafe(v interface{}) interface{} {
+	if f, ok := v.(float64); ok && (math.IsNaN(f) || math.IsInf(f, 0)) {
+		return nil
+	}
+	return v
+}
+
+// logfmtValue formats a value for logfmt, quoting strings which would
+// otherwise be ambiguous.
+func logfmtValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case string:
+		if "" == v || strings.ContainsAny(v, " =\"\\") || strconv.Quote(v) != `"`+v+`"` {
+			return strconv.Quote(v)
+		}
+		return v
 	}
+	return ""
 }
@@ -0,0 +1,45 @@
+//go:build go1.21
+// +build go1.21
+
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// NewSlogLogger returns a Logger for the Log exporter which writes to l at the
+// given level.  With a structured LogFormat, i.e. LogLogfmt or LogJSON, each
+// metric is one record whose attributes are its values, with its tags in a
+// "tags" group, and l's handler decides how it's rendered.  Otherwise each
+// pretty-printed line is the message of a record of its own.
+func NewSlogLogger(l *slog.Logger, level slog.Level) Logger {
+	return &slogLogger{l: l, level: level}
+}
+
+type slogLogger struct {
+	l     *slog.Logger
+	level slog.Level
+}
+
+func (l *slogLogger) Printf(format string, v ...interface{}) {
+	l.l.Log(context.Background(), l.level, strings.TrimSuffix(fmt.Sprintf(format, v...), "\n"))
+}
+
+func (l *slogLogger) logMetric(fields []logField) {
+	attrs := make([]slog.Attr, 0, len(fields))
+	for _, f := range fields {
+		if tags, ok := f.value.(map[string]string); ok {
+			group := make([]slog.Attr, 0, len(tags))
+			for _, k := range sortedTagKeys(tags) {
+				group = append(group, slog.String(k, tags[k]))
+			}
+			attrs = append(attrs, slog.Attr{Key: f.key, Value: slog.GroupValue(group...)})
+			continue
+		}
+		attrs = append(attrs, slog.Any(f.key, f.value))
+	}
+	l.l.LogAttrs(context.Background(), l.level, "metric", attrs...)
+}
@@ -0,0 +1,45 @@
+//go:build go1.21
+// +build go1.21
+
+package metrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+)
+
+func TestLogOnceSlog(t *testing.T) {
+	r := NewRegistry()
+	c := NewCounter()
+	c.(Taggable).AddTags(map[string]string{"endpoint": "/users"})
+	c.Inc(47)
+	r.Register("foo", c)
+	var b bytes.Buffer
+	l := NewSlogLogger(slog.New(slog.NewJSONHandler(&b, nil)), slog.LevelInfo)
+	LogOnce(LogConfig{Registry: r, Logger: l, Format: LogJSON})
+	var record struct {
+		Msg   string
+		Type  string
+		Name  string
+		Count int64
+		Tags  map[string]string
+	}
+	if err := json.Unmarshal(b.Bytes(), &record); nil != err {
+		t.Fatal(b.String(), err)
+	}
+	if "metric" != record.Msg || "counter" != record.Type || "foo" != record.Name || 47 != record.Count || "/users" != record.Tags["endpoint"] {
+		t.Errorf("record: %+v\n", record)
+	}
+}
+
+func TestLogOnceSlogPretty(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredCounter("foo", r).Inc(47)
+	var b bytes.Buffer
+	LogOnce(LogConfig{Registry: r, Logger: NewSlogLogger(slog.New(slog.NewTextHandler(&b, nil)), slog.LevelInfo)})
+	if n := bytes.Count(b.Bytes(), []byte("level=INFO")); 2 != n {
+		t.Errorf("records: 2 != %v\n%s", n, b.String())
+	}
+}
@@ -0,0 +1,146 @@
+package metrics
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+type bufferLogger struct {
+	lines []string
+}
+
+func (l *bufferLogger) Printf(format string, v ...interface{}) {
+	l.lines = append(l.lines, fmt.Sprintf(format, v...))
+}
+
+func TestLogOncePretty(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredCounter("foo", r).Inc(47)
+	l := &bufferLogger{}
+	LogOnce(LogConfig{Registry: r, Logger: l})
+	if "counter foo\n  count:              47\n" != strings.Join(l.lines, "") {
+		t.Fatal(l.lines)
+	}
+}
+
+func TestLogOnceLogfmt(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredCounter("foo bar", r).Inc(47)
+	NewRegisteredGaugeFloat64("baz", r).Update(1.5)
+	NewRegisteredTimer("qux", r).Update(2 * time.Millisecond)
+	l := &bufferLogger{}
+	LogOnce(LogConfig{
+		Registry:     r,
+		DurationUnit: time.Millisecond,
+		Logger:       l,
+		Format:       LogLogfmt,
+	})
+	if 3 != len(l.lines) {
+		t.Fatal(l.lines)
+	}
+	for _, line := range l.lines {
+		switch {
+		case strings.HasPrefix(line, "type=counter "):
+			if `type=counter name="foo bar" count=47`+"\n" != line {
+				t.Error(line)
+			}
+		case strings.HasPrefix(line, "type=gauge "):
+			if "type=gauge name=baz value=1.5\n" != line {
+				t.Error(line)
+			}
+		case strings.HasPrefix(line, "type=timer "):
+			if !strings.HasPrefix(line, "type=timer name=qux count=1 min=2 max=2 ") {
+				t.Error(line)
+			}
+		default:
+			t.Error(line)
+		}
+	}
+}
+
+func TestLogOnceJSON(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredCounter("foo", r).Inc(47)
+	NewRegisteredHistogram("bar", r, NewUniformSample(10)).Update(1)
+	NewRegisteredGaugeFloat64("baz", r).Update(0)
+	l := &bufferLogger{}
+	LogOnce(LogConfig{Registry: r, Logger: l, Format: LogJSON})
+	if 3 != len(l.lines) {
+		t.Fatal(l.lines)
+	}
+	for _, line := range l.lines {
+		if strings.Count(line, "\n") != 1 || !strings.HasSuffix(line, "\n") {
+			t.Errorf("%q is not one line", line)
+		}
+		var object map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &object); nil != err {
+			t.Fatal(line, err)
+		}
+		if "foo" == object["name"] && (47.0 != object["count"] || "counter" != object["type"]) {
+			t.Error(object)
+		}
+	}
+}
+
+func TestLogfmtValue(t *testing.T) {
+	for v, want := range map[interface{}]string{
+		"foo":      "foo",
+		"foo bar":  `"foo bar"`,
+		"a=b":      `"a=b"`,
+		`say "hi"`: `"say \"hi\""`,
+		"":         `""`,
+		"tab\t":    `"tab\t"`,
+		int64(47):  "47",
+		0.5:        "0.5",
+	} {
+		if got := logfmtValue(v); want != got {
+			t.Errorf("logfmtValue(%#v): %s != %s\n", v, want, got)
+		}
+	}
+}
+
+func TestLogOnceTags(t *testing.T) {
+	r := NewRegistry()
+	c := NewCounter()
+	c.(Taggable).AddTags(map[string]string{"endpoint": "/users", "host": "a"})
+	c.Inc(47)
+	r.Register("foo", c)
+
+	l := &bufferLogger{}
+	LogOnce(LogConfig{Registry: r, Logger: l})
+	if want := "counter foo\n  tags:        endpoint=/users host=a\n  count:              47\n"; want != strings.Join(l.lines, "") {
+		t.Errorf("pretty: %q != %q\n", want, strings.Join(l.lines, ""))
+	}
+
+	l = &bufferLogger{}
+	LogOnce(LogConfig{Registry: r, Logger: l, Format: LogLogfmt})
+	if want := "type=counter name=foo count=47 tag.endpoint=/users tag.host=a\n"; 1 != len(l.lines) || want != l.lines[0] {
+		t.Errorf("logfmt: %q != %q\n", want, l.lines)
+	}
+
+	l = &bufferLogger{}
+	LogOnce(LogConfig{Registry: r, Logger: l, Format: LogJSON})
+	var object struct{ Tags map[string]string }
+	if err := json.Unmarshal([]byte(l.lines[0]), &object); nil != err || "/users" != object.Tags["endpoint"] {
+		t.Errorf("JSON: %v %v\n", l.lines, err)
+	}
+}
+
+func TestLogOncePercentiles(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredTimer("foo", r).Update(2 * time.Millisecond)
+	l := &bufferLogger{}
+	LogOnce(LogConfig{
+		Registry:     r,
+		DurationUnit: time.Millisecond,
+		Logger:       l,
+		Format:       LogLogfmt,
+		Percentiles:  []float64{0.5, 0.9999},
+	})
+	if 1 != len(l.lines) || !strings.Contains(l.lines[0], " stddev=0 median=2 p9999=2 rate1=") {
+		t.Error(l.lines)
+	}
+}
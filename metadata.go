@@ -0,0 +1,94 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+)
+
+// MetadataMode selects when an exporter writes the metadata of a metric, such
+// as its type, help and unit.
+type MetadataMode int
+
+const (
+	// MetadataAlways writes the metadata of every metric on every flush, as
+	// consumers which keep none, like Prometheus scraping, expect.  This is
+	// the default.
+	MetadataAlways MetadataMode = iota
+
+	// MetadataOnChange writes the metadata of a metric only to a consumer
+	// which hasn't been sent it yet or was last sent different metadata,
+	// saving the repetition to consumers which cache it.  A metric which
+	// disappears and comes back is sent its metadata again.
+	MetadataOnChange
+)
+
+// DefaultMetadataIdleTimeout is how long a MetadataTracker remembers a
+// consumer it hasn't heard from, unless told otherwise.
+const DefaultMetadataIdleTimeout = 15 * time.Minute
+
+// MetadataTracker remembers the metadata an exporter in MetadataOnChange mode
+// has sent to each of its consumers, by metric name.  Exporters tell their
+// consumers apart by IDs of their choosing.  A consumer not seen for the
+// tracker's idle timeout is forgotten, as is one whose flush failed, so that
+// it's sent all metadata again.
+type MetadataTracker struct {
+	idle      time.Duration
+	mutex     sync.Mutex
+	consumers map[string]*sentMetadata
+}
+
+// sentMetadata is the metadata last sent to one consumer and when.
+type sentMetadata struct {
+	metadata map[string]string
+	seen     time.Time
+}
+
+// NewMetadataTracker constructs a new MetadataTracker which forgets consumers
+// idle for longer than idle, or DefaultMetadataIdleTimeout if it isn't
+// positive.
+func NewMetadataTracker(idle time.Duration) *MetadataTracker {
+	if idle <= 0 {
+		idle = DefaultMetadataIdleTimeout
+	}
+	return &MetadataTracker{idle: idle, consumers: make(map[string]*sentMetadata)}
+}
+
+// Forget forgets the consumer, e.g. because what it was sent may not have
+// arrived, so that it's sent all metadata again.
+func (t *MetadataTracker) Forget(consumer string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	delete(t.consumers, consumer)
+}
+
+// Sent returns the metadata last sent to the consumer, by metric name, which
+// mustn't be modified.
+func (t *MetadataTracker) Sent(consumer string) map[string]string {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.expire(now())
+	if s, ok := t.consumers[consumer]; ok {
+		return s.metadata
+	}
+	return nil
+}
+
+// Set records the metadata of every metric just sent to the consumer,
+// forgetting that of metrics which weren't.
+func (t *MetadataTracker) Set(consumer string, metadata map[string]string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	now := now()
+	t.expire(now)
+	t.consumers[consumer] = &sentMetadata{metadata: metadata, seen: now}
+}
+
+// expire forgets every consumer whose metadata was last set more than the
+// idle timeout before now.  It must be called with the mutex held.
+func (t *MetadataTracker) expire(now time.Time) {
+	for consumer, s := range t.consumers {
+		if now.Sub(s.seen) > t.idle {
+			delete(t.consumers, consumer)
+		}
+	}
+}
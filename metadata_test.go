@@ -0,0 +1,40 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMetadataTracker(t *testing.T) {
+	tr := NewMetadataTracker(0)
+	if sent := tr.Sent("a"); nil != sent {
+		t.Errorf("Sent(\"a\"): %v\n", sent)
+	}
+	tr.Set("a", map[string]string{"hits": "counter"})
+	if sent := tr.Sent("a"); "counter" != sent["hits"] {
+		t.Errorf("Sent(\"a\"): %v\n", sent)
+	}
+	if sent := tr.Sent("b"); nil != sent {
+		t.Errorf("Sent(\"b\"): %v\n", sent)
+	}
+	tr.Forget("a")
+	if sent := tr.Sent("a"); nil != sent {
+		t.Errorf("Sent(\"a\") after Forget: %v\n", sent)
+	}
+}
+
+func TestMetadataTrackerExpiresIdleConsumers(t *testing.T) {
+	tr := NewMetadataTracker(time.Minute)
+	tr.Set("a", map[string]string{"hits": "counter"})
+	tr.consumers["a"].seen = tr.consumers["a"].seen.Add(-2 * time.Minute)
+	tr.Set("b", map[string]string{"hits": "counter"})
+	if 1 != len(tr.consumers) {
+		t.Errorf("consumers: 1 != %v\n", len(tr.consumers))
+	}
+	if sent := tr.Sent("a"); nil != sent {
+		t.Errorf("Sent(\"a\") when idle: %v\n", sent)
+	}
+	if sent := tr.Sent("b"); nil == sent {
+		t.Error("Sent(\"b\"): nil\n")
+	}
+}
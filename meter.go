@@ -15,6 +15,7 @@ type Meter interface {
 	Rate15() float64
 	RateMean() float64
 	Snapshot() Meter
+	Stop()
 }
 
 // GetOrRegisterMeter returns an existing Meter or constructs and registers a
@@ -23,32 +24,36 @@ func GetOrRegisterMeter(name string, r Registry) Meter {
 	if nil == r {
 		r = DefaultRegistry
 	}
-	return r.GetOrRegister(name, NewMeter).(Meter)
+	return getOrRegister(r, name, NewMeter, NilMeter{}).(Meter)
 }
 
-// NewMeter constructs a new StandardMeter and launches a goroutine.
+// GetOrRegisterMeterT returns the existing Meter identified by name and tags
+// together or constructs and registers a new one carrying the tags; see
+// GetOrRegisterCounterT.
+func GetOrRegisterMeterT(name string, tags map[string]string, r Registry) Meter {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	return getOrRegisterTagged(r, name, tags, func() interface{} { return NewMeter() }, NilMeter{}).(Meter)
+}
+
+// NewMeter constructs a new StandardMeter.
 func NewMeter() Meter {
-	if UseNilMetrics {
+	if useNilMetrics() {
 		return NilMeter{}
 	}
-	m := newStandardMeter()
-	arbiter.Lock()
-	defer arbiter.Unlock()
-	arbiter.meters = append(arbiter.meters, m)
-	if !arbiter.started {
-		arbiter.started = true
-		go arbiter.tick()
-	}
-	return m
+	return newStandardMeter()
 }
 
-// NewMeter constructs and registers a new StandardMeter and launches a
-// goroutine.
+// NewRegisteredMeter constructs and registers a new StandardMeter.
 func NewRegisteredMeter(name string, r Registry) Meter {
-	c := NewMeter()
 	if nil == r {
 		r = DefaultRegistry
 	}
+	if usesNilMetrics(r) {
+		return NilMeter{}
+	}
+	c := NewMeter()
 	r.Register(name, c)
 	return c
 }
@@ -57,11 +62,36 @@ func NewRegisteredMeter(name string, r Registry) Meter {
 type MeterSnapshot struct {
 	count                          int64
 	rate1, rate5, rate15, rateMean float64
+	intervalRate                   float64 // over the latest complete tick interval, see Timer.IntervalRate
+	tags                           Tags
+	timestamp                      time.Time
+}
+
+// AddTags panics.
+func (*MeterSnapshot) AddTags(map[string]string) {
+	panic("AddTags called on a MeterSnapshot")
 }
 
 // Count returns the count of events at the time the snapshot was taken.
 func (m *MeterSnapshot) Count() int64 { return m.count }
 
+// GetTags returns a copy of the tags the meter had at the time the snapshot was
+// taken.
+func (m *MeterSnapshot) GetTags() map[string]string { return m.tags.Map() }
+
+// RemoveTag panics.
+func (*MeterSnapshot) RemoveTag(string) {
+	panic("RemoveTag called on a MeterSnapshot")
+}
+
+// SetTags panics.
+func (*MeterSnapshot) SetTags(map[string]string) {
+	panic("SetTags called on a MeterSnapshot")
+}
+
+// Tags returns the tags the meter had at the time the snapshot was taken.
+func (m *MeterSnapshot) Tags() Tags { return m.tags }
+
 // Mark panics.
 func (*MeterSnapshot) Mark(n int64) {
 	panic("Mark called on a MeterSnapshot")
@@ -86,12 +116,28 @@ func (m *MeterSnapshot) RateMean() float64 { return m.rateMean }
 // Snapshot returns the snapshot.
 func (m *MeterSnapshot) Snapshot() Meter { return m }
 
+// Stop is a no-op.
+func (*MeterSnapshot) Stop() {}
+
+// Timestamp returns the time the snapshot was taken, by the clock set by
+// SetClock.
+func (m *MeterSnapshot) Timestamp() time.Time { return m.timestamp }
+
 // NilMeter is a no-op Meter.
 type NilMeter struct{}
 
+// AddDynamicTag is a no-op.
+func (NilMeter) AddDynamicTag(string, func() string) error { return nil }
+
+// AddTags is a no-op.
+func (NilMeter) AddTags(map[string]string) {}
+
 // Count is a no-op.
 func (NilMeter) Count() int64 { return 0 }
 
+// GetTags is a no-op.
+func (NilMeter) GetTags() map[string]string { return nil }
+
 // Mark is a no-op.
 func (NilMeter) Mark(n int64) {}
 
@@ -107,24 +153,48 @@ func (NilMeter) Rate15() float64 { return 0.0 }
 // RateMean is a no-op.
 func (NilMeter) RateMean() float64 { return 0.0 }
 
+// RemoveTag is a no-op.
+func (NilMeter) RemoveTag(string) {}
+
+// SetTags is a no-op.
+func (NilMeter) SetTags(map[string]string) {}
+
 // Snapshot is a no-op.
 func (NilMeter) Snapshot() Meter { return NilMeter{} }
 
-// StandardMeter is the standard implementation of a Meter.
+// Stop is a no-op.
+func (NilMeter) Stop() {}
+
+// meterTickInterval is how often a Meter's moving averages tick.
+const meterTickInterval = 5 * time.Second
+
+// StandardMeter is the standard implementation of a Meter.  It has no
+// goroutine or ticker: whenever it's marked or read it ticks its moving
+// averages once for every five seconds elapsed since they last ticked, all at
+// once, so that any number of meters cost nothing while they're idle and
+// neither contend for a lock shared between them nor hold up one another.
 type StandardMeter struct {
+	tagSet
+	lastUpdate
+
 	lock        sync.RWMutex
 	snapshot    *MeterSnapshot
 	a1, a5, a15 EWMA
 	startTime   time.Time
+	lastTick    time.Time // a whole number of intervals after startTime
+	tickCount   int64     // count as of lastTick
+	stopped     bool
 }
 
 func newStandardMeter() *StandardMeter {
+	t := now()
 	return &StandardMeter{
 		snapshot:  &MeterSnapshot{},
 		a1:        NewEWMA1(),
 		a5:        NewEWMA5(),
 		a15:       NewEWMA15(),
-		startTime: time.Now(),
+		startTime: t,
+		lastTick:  t,
 	}
 }
 
@@ -138,96 +208,171 @@ func (m *StandardMeter) Count() int64 {
 
 // Mark records the occurance of n events.
 func (m *StandardMeter) Mark(n int64) {
+	m.touch()
+	t := now()
 	m.lock.Lock()
 	defer m.lock.Unlock()
+	// Tick first, so that the events count towards the interval they're in.
+	m.catchUp(t)
 	m.snapshot.count += n
 	m.a1.Update(n)
 	m.a5.Update(n)
 	m.a15.Update(n)
-	m.updateSnapshot()
+	m.updateSnapshot(t)
 }
 
 // Rate1 returns the one-minute moving average rate of events per second.
-func (m *StandardMeter) Rate1() float64 {
-	m.lock.RLock()
-	rate1 := m.snapshot.rate1
-	m.lock.RUnlock()
-	return rate1
-}
+func (m *StandardMeter) Rate1() float64 { return m.read().rate1 }
 
 // Rate5 returns the five-minute moving average rate of events per second.
-func (m *StandardMeter) Rate5() float64 {
-	m.lock.RLock()
-	rate5 := m.snapshot.rate5
-	m.lock.RUnlock()
-	return rate5
-}
+func (m *StandardMeter) Rate5() float64 { return m.read().rate5 }
 
 // Rate15 returns the fifteen-minute moving average rate of events per second.
-func (m *StandardMeter) Rate15() float64 {
-	m.lock.RLock()
-	rate15 := m.snapshot.rate15
-	m.lock.RUnlock()
-	return rate15
-}
+func (m *StandardMeter) Rate15() float64 { return m.read().rate15 }
 
 // RateMean returns the meter's mean rate of events per second.
-func (m *StandardMeter) RateMean() float64 {
-	m.lock.RLock()
-	rateMean := m.snapshot.rateMean
-	m.lock.RUnlock()
-	return rateMean
-}
+func (m *StandardMeter) RateMean() float64 { return m.read().rateMean }
 
 // Snapshot returns a read-only copy of the meter.
 func (m *StandardMeter) Snapshot() Meter {
-	m.lock.RLock()
-	snapshot := *m.snapshot
-	m.lock.RUnlock()
+	snapshot := m.read()
+	snapshot.tags = m.resolve()
 	return &snapshot
 }
 
-func (m *StandardMeter) updateSnapshot() {
-	// should run with write lock held on m.lock
-	snapshot := m.snapshot
-	snapshot.rate1 = m.a1.Rate()
-	snapshot.rate5 = m.a5.Rate()
-	snapshot.rate15 = m.a15.Rate()
-	snapshot.rateMean = float64(snapshot.count) / time.Since(m.startTime).Seconds()
+// ReadInto copies the meter's count, rates and tags into s, as Snapshot
+// would, without allocating.
+func (m *StandardMeter) ReadInto(s *MeterSnapshot) {
+	*s = m.read()
+	s.tags = m.resolve()
 }
 
-func (m *StandardMeter) tick() {
+// Stop stops the meter's rates from decaying.  Mark still counts events
+// and updates them.  Meters needn't be stopped to be garbage collected, but
+// registries stop those they unregister.  It is safe to call more than once.
+func (m *StandardMeter) Stop() {
 	m.lock.Lock()
 	defer m.lock.Unlock()
-	m.a1.Tick()
-	m.a5.Tick()
-	m.a15.Tick()
-	m.updateSnapshot()
+	m.stopped = true
 }
 
+// reset returns the meter to the state it was constructed in, as of now, for
+// Registry.ResetAll.
+func (m *StandardMeter) reset() {
+	t := now()
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.snapshot = &MeterSnapshot{}
+	m.a1, m.a5, m.a15 = NewEWMA1(), NewEWMA5(), NewEWMA15()
+	m.startTime, m.lastTick, m.tickCount = t, t, 0
+}
+
+// catchUp ticks the moving averages for the intervals elapsed by t since they
+// last ticked, unless the meter is stopped, and returns true if they ticked.
+// Marks catch up before counting, so the events counted since the last tick
+// all fall in the interval it began, and the latest complete interval holds
+// them if it's that one or none otherwise.  It must be called with m.lock
+// held.
+func (m *StandardMeter) catchUp(t time.Time) bool {
+	if m.stopped {
+		return false
+	}
+	ticks := int64(t.Sub(m.lastTick) / meterTickInterval)
+	if ticks <= 0 {
+		return false
+	}
+	tickEWMA(m.a1, ticks)
+	tickEWMA(m.a5, ticks)
+	tickEWMA(m.a15, ticks)
+	m.lastTick = m.lastTick.Add(time.Duration(ticks) * meterTickInterval)
+	m.snapshot.intervalRate = 0
+	if 1 == ticks {
+		m.snapshot.intervalRate = float64(m.snapshot.count-m.tickCount) / meterTickInterval.Seconds()
+	}
+	m.tickCount = m.snapshot.count
+	return true
+}
+
+// read returns a copy of the meter's snapshot, updated as the meter would have
+// been by the ticks due since it last ticked.  The mean rate is updated by
+// ticks and marks, so that reads in between agree.
+func (m *StandardMeter) read() MeterSnapshot {
+	t := now()
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.catchUp(t) {
+		m.updateSnapshot(t)
+	}
+	snapshot := *m.snapshot
+	snapshot.timestamp = t
+	return snapshot
+}
+
+// updateSnapshot must be called with m.lock held.
+func (m *StandardMeter) updateSnapshot(t time.Time) {
+	snapshot := m.snapshot
+	snapshot.rate1 = m.a1.Rate()
+	snapshot.rate5 = m.a5.Rate()
+	snapshot.rate15 = m.a15.Rate()
+	snapshot.rateMean = float64(snapshot.count) / t.Sub(m.startTime).Seconds()
+}
+
+// meterArbiter ticks the EWMAs registered by NewRegisteredEWMA every five
+// seconds.
 type meterArbiter struct {
 	sync.RWMutex
 	started bool
-	meters  []*StandardMeter
-	ticker  *time.Ticker
+	ewmas   []EWMA
+	ticker  Ticker
+	reset   chan struct{} // signalled when ticker is replaced
 }
 
-var arbiter = meterArbiter{ticker: time.NewTicker(5e9)}
+var arbiter = meterArbiter{reset: make(chan struct{}, 1)}
+
+// start launches the goroutine ticking EWMAs unless it's running.  It must be
+// called with ma locked.
+func (ma *meterArbiter) start() {
+	if !ma.started {
+		ma.started = true
+		ma.ticker = CurrentClock().Ticker(meterTickInterval)
+		go ma.tick()
+	}
+}
+
+// setClock replaces the ticker of the running goroutine by one of c.
+func (ma *meterArbiter) setClock(c Clock) {
+	ma.Lock()
+	defer ma.Unlock()
+	if !ma.started {
+		return
+	}
+	ma.ticker.Stop()
+	ma.ticker = c.Ticker(meterTickInterval)
+	select {
+	case ma.reset <- struct{}{}:
+	default:
+	}
+}
 
-// Ticks meters on the scheduled interval
+// Ticks EWMAs on the scheduled interval
 func (ma *meterArbiter) tick() {
 	for {
+		ma.RLock()
+		ticker := ma.ticker
+		ma.RUnlock()
 		select {
-		case <-ma.ticker.C:
-			ma.tickMeters()
+		case <-ticker.C():
+			ma.tickEWMAs()
+			ticker.Done()
+		case <-ma.reset:
 		}
 	}
 }
 
-func (ma *meterArbiter) tickMeters() {
+func (ma *meterArbiter) tickEWMAs() {
 	ma.RLock()
 	defer ma.RUnlock()
-	for _, meter := range ma.meters {
-		meter.tick()
+	for _, a := range ma.ewmas {
+		a.Tick()
 	}
 }
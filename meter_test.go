@@ -1,6 +1,7 @@
 package metrics
 
 import (
+	"math"
 	"testing"
 	"time"
 )
@@ -21,21 +22,59 @@ func TestGetOrRegisterMeter(t *testing.T) {
 	}
 }
 
-func TestMeterDecay(t *testing.T) {
-	ma := meterArbiter{
-		ticker: time.NewTicker(time.Millisecond),
+func BenchmarkMeterMany(b *testing.B) {
+	meters := make([]Meter, 50000)
+	for i := range meters {
+		meters[i] = NewMeter()
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		meters[i%len(meters)].Mark(1)
 	}
+}
+
+// elapse moves the meter's times back by d, as if d had elapsed.
+func elapse(m *StandardMeter, d time.Duration) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.startTime = m.startTime.Add(-d)
+	m.lastTick = m.lastTick.Add(-d)
+}
+
+func TestMeterDecay(t *testing.T) {
 	m := newStandardMeter()
-	ma.meters = append(ma.meters, m)
-	go ma.tick()
 	m.Mark(1)
 	rateMean := m.RateMean()
-	time.Sleep(100 * time.Millisecond)
+	elapse(m, 5*time.Second)
 	if m.RateMean() >= rateMean {
 		t.Error("m.RateMean() didn't decrease")
 	}
 }
 
+func TestMeterTicksLazily(t *testing.T) {
+	m := newStandardMeter()
+	m.Mark(5)
+	if rate1 := m.Rate1(); 0 != rate1 {
+		t.Errorf("m.Rate1() before a tick: 0 != %v\n", rate1)
+	}
+	elapse(m, 5*time.Second)
+	if rate1 := m.Rate1(); 1 != rate1 {
+		t.Errorf("m.Rate1(): 1 != %v\n", rate1)
+	}
+	elapse(m, time.Minute)
+	if rate1 := m.Rate1(); math.Abs(math.Exp(-1)-rate1) > 1e-9 {
+		t.Errorf("m.Rate1(): %v != %v\n", math.Exp(-1), rate1)
+	}
+	// Events marked after a tick is due count towards the next interval.
+	elapse(m, 5*time.Second)
+	m.Mark(10)
+	rate15 := m.Rate15()
+	elapse(m, 5*time.Second)
+	if m.Rate15() <= rate15 {
+		t.Errorf("m.Rate15(): %v <= %v\n", m.Rate15(), rate15)
+	}
+}
+
 func TestMeterNonzero(t *testing.T) {
 	m := NewMeter()
 	m.Mark(3)
@@ -52,6 +91,32 @@ func TestMeterSnapshot(t *testing.T) {
 	}
 }
 
+func TestMeterSnapshotTags(t *testing.T) {
+	m := NewMeter()
+	defer m.Stop()
+	m.(Taggable).AddTags(map[string]string{"queue": "jobs"})
+	m.(DynamicTaggable).AddDynamicTag("shard", func() string { return "3" })
+	if tags := m.Snapshot().(Taggable).GetTags(); "jobs" != tags["queue"] || "3" != tags["shard"] {
+		t.Errorf("m.Snapshot().GetTags(): %v\n", tags)
+	}
+}
+
+func TestMeterStop(t *testing.T) {
+	m := NewMeter()
+	if !meterTicked(m.(*StandardMeter)) {
+		t.Fatal("meter not ticked")
+	}
+	m.Stop()
+	m.Stop()
+	if meterTicked(m.(*StandardMeter)) {
+		t.Fatal("meter still ticked")
+	}
+	m.Mark(1)
+	if count := m.Count(); 1 != count {
+		t.Errorf("m.Count(): 1 != %v\n", count)
+	}
+}
+
 func TestMeterZero(t *testing.T) {
 	m := NewMeter()
 	if count := m.Count(); 0 != count {
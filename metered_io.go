@@ -0,0 +1,114 @@
+package metrics
+
+import (
+	"io"
+	"time"
+)
+
+// IOMetrics are the metrics a MeteredReader or MeteredWriter feeds, which many
+// of them may share, e.g. every upload of a server.  Any may be nil.
+type IOMetrics struct {
+	Bytes      Counter // Bytes transferred
+	Throughput Meter   // Rate of bytes transferred
+	Latency    Timer   // Duration of each Read or Write
+}
+
+// NewIOMetrics returns the IOMetrics of the counter name+".bytes" and the
+// meter name+".throughput" and, if timed, the timer name+".latency", getting
+// or registering them in r, or DefaultRegistry if it's nil.  Timing costs two
+// reads of the clock per call, so leave it out of paths reading or writing a
+// few bytes at a time.
+func NewIOMetrics(name string, r Registry, timed bool) IOMetrics {
+	m := IOMetrics{
+		Bytes:      GetOrRegisterCounter(name+".bytes", r),
+		Throughput: GetOrRegisterMeter(name+".throughput", r),
+	}
+	if timed {
+		m.Latency = GetOrRegisterTimer(name+".latency", r)
+	}
+	return m
+}
+
+// record records one Read or Write of n bytes which began at start.
+func (m IOMetrics) record(n int, start time.Time) {
+	if nil != m.Latency {
+		m.Latency.UpdateSince(start)
+	}
+	if n <= 0 {
+		return
+	}
+	if nil != m.Bytes {
+		m.Bytes.Inc(int64(n))
+	}
+	if nil != m.Throughput {
+		m.Throughput.Mark(int64(n))
+	}
+}
+
+// start returns the time a Read or Write begins, if it's timed.
+func (m IOMetrics) start() time.Time {
+	if nil == m.Latency {
+		return time.Time{}
+	}
+	return now()
+}
+
+// NewMeteredReader returns a MeteredReader reading from r into m.
+func NewMeteredReader(r io.Reader, m IOMetrics) *MeteredReader {
+	return &MeteredReader{r: r, m: m}
+}
+
+// MeteredReader is an io.Reader which records the bytes read from the reader
+// it wraps, e.g. a request body or a proxied connection, in IOMetrics.
+type MeteredReader struct {
+	r io.Reader
+	m IOMetrics
+}
+
+// Close closes the reader wrapped if it's an io.Closer, so that a
+// MeteredReader can stand in for an io.ReadCloser such as an http.Request's
+// Body, and otherwise does nothing.
+func (r *MeteredReader) Close() error {
+	if c, ok := r.r.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// Read reads from the reader wrapped, recording the bytes read.
+func (r *MeteredReader) Read(p []byte) (int, error) {
+	start := r.m.start()
+	n, err := r.r.Read(p)
+	r.m.record(n, start)
+	return n, err
+}
+
+// NewMeteredWriter returns a MeteredWriter writing to w from m.
+func NewMeteredWriter(w io.Writer, m IOMetrics) *MeteredWriter {
+	return &MeteredWriter{w: w, m: m}
+}
+
+// MeteredWriter is an io.Writer which records the bytes written to the writer
+// it wraps, e.g. a download or a proxied connection, in IOMetrics.
+type MeteredWriter struct {
+	w io.Writer
+	m IOMetrics
+}
+
+// Close closes the writer wrapped if it's an io.Closer, and otherwise does
+// nothing.
+func (w *MeteredWriter) Close() error {
+	if c, ok := w.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// Write writes to the writer wrapped, recording the bytes written, even if
+// it fails part way.
+func (w *MeteredWriter) Write(p []byte) (int, error) {
+	start := w.m.start()
+	n, err := w.w.Write(p)
+	w.m.record(n, start)
+	return n, err
+}
@@ -0,0 +1,79 @@
+package metrics
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestMeteredReader(t *testing.T) {
+	r := NewRegistry()
+	m := NewIOMetrics("upload", r, true)
+	if _, err := io.Copy(ioutil.Discard, NewMeteredReader(strings.NewReader("hello, world"), m)); nil != err {
+		t.Fatal(err)
+	}
+	if c := r.Get("upload.bytes").(Counter).Count(); 12 != c {
+		t.Errorf("upload.bytes: 12 != %v\n", c)
+	}
+	if c := r.Get("upload.throughput").(Meter).Count(); 12 != c {
+		t.Errorf("upload.throughput: 12 != %v\n", c)
+	}
+	if c := r.Get("upload.latency").(Timer).Count(); c < 2 {
+		t.Errorf("upload.latency: %v Reads timed, including that at EOF\n", c)
+	}
+}
+
+func TestMeteredWriter(t *testing.T) {
+	r := NewRegistry()
+	m := NewIOMetrics("download", r, false)
+	var buf bytes.Buffer
+	w := NewMeteredWriter(&buf, m)
+	w.Write([]byte("abc"))
+	w.Write([]byte("de"))
+	if c := r.Get("download.bytes").(Counter).Count(); 5 != c {
+		t.Errorf("download.bytes: 5 != %v\n", c)
+	}
+	if nil != r.Get("download.latency") {
+		t.Error("download.latency: registered without timed\n")
+	}
+	if err := w.Close(); nil != err {
+		t.Errorf("w.Close(): %v\n", err)
+	}
+}
+
+type shortWriter struct{}
+
+func (shortWriter) Write(p []byte) (int, error) { return 1, errors.New("short write") }
+
+func TestMeteredWriterShortWrite(t *testing.T) {
+	c := NewCounter()
+	n, err := NewMeteredWriter(shortWriter{}, IOMetrics{Bytes: c}).Write([]byte("abc"))
+	if 1 != n || nil == err {
+		t.Errorf("Write(): %v, %v\n", n, err)
+	}
+	if 1 != c.Count() {
+		t.Errorf("c.Count(): 1 != %v\n", c.Count())
+	}
+}
+
+type closeRecorder struct {
+	io.Reader
+	closed bool
+}
+
+func (r *closeRecorder) Close() error {
+	r.closed = true
+	return nil
+}
+
+func TestMeteredReaderClose(t *testing.T) {
+	body := &closeRecorder{Reader: strings.NewReader("")}
+	var rc io.ReadCloser = NewMeteredReader(body, IOMetrics{})
+	rc.Close()
+	if !body.closed {
+		t.Error("body not closed\n")
+	}
+}
@@ -5,9 +5,97 @@
 // Coda Hale's original work: <https://github.com/codahale/metrics>
 package metrics
 
+import "sync/atomic"
+
 // UseNilMetrics is checked by the constructor functions for all of the
 // standard metrics.  If it is true, the metric returned is a stub.
 //
 // This global kill-switch helps quantify the observer effect and makes
-// for less cluttered pprof profiles.
+// for less cluttered pprof profiles.  It's read without synchronization, so
+// set it only before any metrics are constructed, e.g. in main; the function
+// SetUseNilMetrics flips the same switch safely at any time.
+//
+// Registries may also be switched to nil metrics individually and at any time
+// with their SetUseNilMetrics methods, which affect the GetOrRegister* and
+// NewRegistered* constructors for that registry only, and a library given a
+// NilRegistry records nothing at all.  Nil metrics are used wherever either
+// the global or the registry's setting is true.
 var UseNilMetrics bool = false
+
+// nilMetricsFlag is the atomic boolean set by SetUseNilMetrics.
+var nilMetricsFlag int32
+
+// SetUseNilMetrics switches the constructor functions of all the standard
+// metrics to returning stubs, or back again, like setting UseNilMetrics but
+// safe to call while metrics are being constructed.  Metrics already
+// constructed keep collecting.
+func SetUseNilMetrics(use bool) {
+	var v int32
+	if use {
+		v = 1
+	}
+	atomic.StoreInt32(&nilMetricsFlag, v)
+}
+
+// useNilMetrics reports whether UseNilMetrics or SetUseNilMetrics has
+// switched every constructor to stubs.
+func useNilMetrics() bool {
+	return UseNilMetrics || 1 == atomic.LoadInt32(&nilMetricsFlag)
+}
+
+// nilMetricsRegistry is implemented by registries which can be switched to
+// nil metrics at runtime.
+type nilMetricsRegistry interface {
+	UseNilMetrics() bool
+}
+
+// usesNilMetrics reports whether metrics constructed for r should be stubs.
+func usesNilMetrics(r Registry) bool {
+	if useNilMetrics() {
+		return true
+	}
+	n, ok := r.(nilMetricsRegistry)
+	return ok && n.UseNilMetrics()
+}
+
+// getOrRegister is r.GetOrRegister(name, i) unless r uses nil metrics, in
+// which case it returns the metric already registered under name or, if there
+// is none, nilMetric without registering it.
+func getOrRegister(r Registry, name string, i, nilMetric interface{}) interface{} {
+	if usesNilMetrics(r) {
+		if metric := r.Get(name); nil != metric {
+			return metric
+		}
+		return nilMetric
+	}
+	return r.GetOrRegister(name, i)
+}
+
+// nilMetric returns the stub equivalent of the given metric.
+func nilMetric(i interface{}) interface{} {
+	switch i.(type) {
+	case Counter:
+		return NilCounter{}
+	case CounterFloat64:
+		return NilCounterFloat64{}
+	case PeakGauge:
+		return NilPeakGauge{}
+	case Gauge:
+		return NilGauge{}
+	case GaugeFloat64:
+		return NilGaugeFloat64{}
+	case Healthcheck:
+		return NilHealthcheck{}
+	case Summary:
+		return NilSummary{}
+	case Histogram:
+		return NilHistogram{}
+	case Meter:
+		return NilMeter{}
+	case MergeableGaugeFloat64:
+		return NilMergeableGaugeFloat64{}
+	case Timer:
+		return NilTimer{}
+	}
+	return i
+}
@@ -0,0 +1,112 @@
+package metricstest
+
+import (
+	"math"
+	"testing"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+// AssertCounter fails the test unless the Counter registered in r by the
+// given name and tags counts want.
+func AssertCounter(t testing.TB, r metrics.Registry, name string, tags map[string]string, want int64) {
+	t.Helper()
+	i := lookup(t, r, name, tags)
+	if nil == i {
+		return
+	}
+	c, ok := i.(metrics.Counter)
+	if !ok {
+		t.Errorf("%s: not a Counter", metrics.TaggedName(name, tags))
+		return
+	}
+	if count := c.Count(); want != count {
+		t.Errorf("%s: count %d != %d", metrics.TaggedName(name, tags), want, count)
+	}
+}
+
+// AssertCount fails the test unless the metric registered in r by the given
+// name and tags, which may be any with a Count method such as a Meter,
+// Histogram or Timer, counts want.
+func AssertCount(t testing.TB, r metrics.Registry, name string, tags map[string]string, want int64) {
+	t.Helper()
+	i := lookup(t, r, name, tags)
+	if nil == i {
+		return
+	}
+	c, ok := i.(metrics.Countable)
+	if !ok {
+		t.Errorf("%s: not countable", metrics.TaggedName(name, tags))
+		return
+	}
+	if count := c.Count(); want != count {
+		t.Errorf("%s: count %d != %d", metrics.TaggedName(name, tags), want, count)
+	}
+}
+
+// AssertGauge fails the test unless the Gauge registered in r by the given
+// name and tags reads want.
+func AssertGauge(t testing.TB, r metrics.Registry, name string, tags map[string]string, want int64) {
+	t.Helper()
+	i := lookup(t, r, name, tags)
+	if nil == i {
+		return
+	}
+	g, ok := i.(metrics.Gauge)
+	if !ok {
+		t.Errorf("%s: not a Gauge", metrics.TaggedName(name, tags))
+		return
+	}
+	if value := g.Value(); want != value {
+		t.Errorf("%s: value %d != %d", metrics.TaggedName(name, tags), want, value)
+	}
+}
+
+// AssertGaugeFloat64 fails the test unless the GaugeFloat64 registered in r
+// by the given name and tags reads within epsilon of want.
+func AssertGaugeFloat64(t testing.TB, r metrics.Registry, name string, tags map[string]string, want, epsilon float64) {
+	t.Helper()
+	i := lookup(t, r, name, tags)
+	if nil == i {
+		return
+	}
+	g, ok := i.(metrics.GaugeFloat64)
+	if !ok {
+		t.Errorf("%s: not a GaugeFloat64", metrics.TaggedName(name, tags))
+		return
+	}
+	if value := g.Value(); math.Abs(want-value) > epsilon {
+		t.Errorf("%s: value %v != %v", metrics.TaggedName(name, tags), want, value)
+	}
+}
+
+// AssertNotRegistered fails the test if a metric is registered in r by the
+// given name and tags.
+func AssertNotRegistered(t testing.TB, r metrics.Registry, name string, tags map[string]string) {
+	t.Helper()
+	if nil != r.Get(metrics.TaggedName(name, tags)) {
+		t.Errorf("%s: registered", metrics.TaggedName(name, tags))
+	}
+}
+
+// CollectAll returns snapshots of every metric in r by the names they'd be
+// reported under, with the registry's default tags, for comparing the whole
+// registry at once.
+func CollectAll(r metrics.Registry) map[string]interface{} {
+	all := make(map[string]interface{})
+	r.EachSnapshot(func(name string, i interface{}) {
+		all[name] = i
+	})
+	return all
+}
+
+// lookup returns the metric registered in r by the given name and tags, or
+// nil, failing the test, if there's none.
+func lookup(t testing.TB, r metrics.Registry, name string, tags map[string]string) interface{} {
+	t.Helper()
+	i := r.Get(metrics.TaggedName(name, tags))
+	if nil == i {
+		t.Errorf("%s: not registered", metrics.TaggedName(name, tags))
+	}
+	return i
+}
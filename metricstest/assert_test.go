@@ -0,0 +1,77 @@
+package metricstest
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+// recordingT records the failures of the helpers under test rather than
+// failing the test running them.
+type recordingT struct {
+	testing.TB
+	errors []string
+}
+
+func (t *recordingT) Errorf(format string, args ...interface{}) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func (*recordingT) Helper() {}
+
+func TestAssertCounter(t *testing.T) {
+	r := metrics.NewRegistry()
+	tags := map[string]string{"code": "200"}
+	metrics.GetOrRegisterCounterT("requests", tags, r).Inc(3)
+	rt := &recordingT{TB: t}
+	AssertCounter(rt, r, "requests", tags, 3)
+	if 0 != len(rt.errors) {
+		t.Errorf("errors: %v", rt.errors)
+	}
+	AssertCounter(rt, r, "requests", tags, 4)
+	AssertCounter(rt, r, "requests", map[string]string{"code": "500"}, 0)
+	want := []string{
+		"requests;code=200: count 4 != 3",
+		"requests;code=500: not registered",
+	}
+	if fmt.Sprint(want) != fmt.Sprint(rt.errors) {
+		t.Errorf("errors: %q != %q\n", want, rt.errors)
+	}
+}
+
+func TestAssertWrongType(t *testing.T) {
+	r := metrics.NewRegistry()
+	metrics.GetOrRegisterCounter("foo", r)
+	rt := &recordingT{TB: t}
+	AssertGauge(rt, r, "foo", nil, 0)
+	if want := []string{"foo: not a Gauge"}; fmt.Sprint(want) != fmt.Sprint(rt.errors) {
+		t.Errorf("errors: %q != %q\n", want, rt.errors)
+	}
+}
+
+func TestAssertOthers(t *testing.T) {
+	r := metrics.NewRegistry()
+	metrics.GetOrRegisterGauge("gauge", r).Update(47)
+	metrics.GetOrRegisterGaugeFloat64("float", r).Update(0.5)
+	metrics.GetOrRegisterHistogram("histogram", r, metrics.NewUniformSample(10)).Update(1)
+	AssertGauge(t, r, "gauge", nil, 47)
+	AssertGaugeFloat64(t, r, "float", nil, 0.5, 0)
+	AssertCount(t, r, "histogram", nil, 1)
+	AssertNotRegistered(t, r, "missing", nil)
+}
+
+func TestCollectAll(t *testing.T) {
+	r := metrics.NewRegistry()
+	r.(*metrics.StandardRegistry).SetDefaultTags(map[string]string{"host": "a"})
+	c := metrics.GetOrRegisterCounter("foo", r)
+	c.Inc(1)
+	all := CollectAll(r)
+	c.Inc(1)
+	if 1 != len(all) {
+		t.Fatalf("len(all): 1 != %v\n", len(all))
+	}
+	if count := all["foo;host=a"].(metrics.Counter).Count(); 1 != count {
+		t.Errorf("count: 1 != %v\n", count)
+	}
+}
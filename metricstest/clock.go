@@ -0,0 +1,178 @@
+// Package metricstest provides helpers for testing code instrumented with
+// go-metrics.
+package metricstest
+
+import (
+	"sync"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+// Clock is a mock metrics.Clock whose time only moves when Add or Set is
+// called.  Set it with metrics.SetClock before creating the meters, timers,
+// registries and reporters under test, and restore the system clock after:
+//
+//	clock := metricstest.NewClock(time.Now())
+//	metrics.SetClock(clock)
+//	defer metrics.SetClock(nil)
+//
+// Advancing it delivers every tick which falls due, in order, to the
+// goroutines receiving them and waits for each to be handled, so that meters'
+// rates have decayed and reporters have flushed by the time Add returns.  A
+// ticker which nothing receives from blocks Add until it's stopped.
+// Reporters make their tickers in the goroutines they run in, so call
+// WaitForTicker after starting one and before advancing the clock.
+type Clock struct {
+	mutex   sync.Mutex
+	cond    *sync.Cond // signalled when a ticker is made
+	now     time.Time
+	tickers []*ticker
+}
+
+// NewClock constructs a new Clock set to the given time.
+func NewClock(now time.Time) *Clock {
+	c := &Clock{now: now}
+	c.cond = sync.NewCond(&c.mutex)
+	return c
+}
+
+// Add moves the clock on by d, delivering the ticks which fall due.
+func (c *Clock) Add(d time.Duration) {
+	c.mutex.Lock()
+	until := c.now.Add(d)
+	c.mutex.Unlock()
+	c.Set(until)
+}
+
+// Now returns the time of the clock.
+func (c *Clock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.now
+}
+
+// Set moves the clock on to the given time, delivering the ticks which fall
+// due.  It never moves the clock back.
+func (c *Clock) Set(until time.Time) {
+	for {
+		c.mutex.Lock()
+		t := c.next(until)
+		if nil == t {
+			if until.After(c.now) {
+				c.now = until
+			}
+			c.mutex.Unlock()
+			return
+		}
+		c.now = t.next
+		t.next = t.next.Add(t.d)
+		now := c.now
+		c.mutex.Unlock()
+		t.deliver(now)
+	}
+}
+
+// Ticker returns a Ticker which ticks every d of the clock's time, first d
+// from now.  It panics if d is not positive, as time.NewTicker does.
+func (c *Clock) Ticker(d time.Duration) metrics.Ticker {
+	if d <= 0 {
+		panic("non-positive interval for metricstest.Clock.Ticker")
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	t := &ticker{
+		c:       make(chan time.Time),
+		d:       d,
+		done:    make(chan struct{}, 1),
+		next:    c.now.Add(d),
+		stopped: make(chan struct{}),
+	}
+	c.tickers = append(c.tickers, t)
+	c.cond.Broadcast()
+	return t
+}
+
+// WaitForTicker blocks until a ticker of the clock with period d is running,
+// e.g. that of a reporter flushing every d.
+func (c *Clock) WaitForTicker(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for !c.running(d) {
+		c.cond.Wait()
+	}
+}
+
+// running returns true if a ticker with period d isn't yet stopped.  It must
+// be called with c.mutex held.
+func (c *Clock) running(d time.Duration) bool {
+	for _, t := range c.tickers {
+		if d == t.d && !t.isStopped() {
+			return true
+		}
+	}
+	return false
+}
+
+// next returns the running ticker due to tick soonest, if one is due by
+// until.  It must be called with c.mutex held.
+func (c *Clock) next(until time.Time) *ticker {
+	var next *ticker
+	tickers := c.tickers[:0]
+	for _, t := range c.tickers {
+		if t.isStopped() {
+			continue
+		}
+		tickers = append(tickers, t)
+		if !t.next.After(until) && (nil == next || t.next.Before(next.next)) {
+			next = t
+		}
+	}
+	c.tickers = tickers
+	return next
+}
+
+type ticker struct {
+	c       chan time.Time
+	d       time.Duration
+	done    chan struct{}
+	next    time.Time // guarded by the clock's mutex
+	stop    sync.Once
+	stopped chan struct{}
+}
+
+func (t *ticker) C() <-chan time.Time { return t.c }
+
+func (t *ticker) Done() {
+	select {
+	case t.done <- struct{}{}:
+	default:
+	}
+}
+
+func (t *ticker) Stop() {
+	t.stop.Do(func() { close(t.stopped) })
+}
+
+// deliver sends a tick and waits for it to be handled, unless the ticker is
+// stopped first.
+func (t *ticker) deliver(now time.Time) {
+	select {
+	case t.c <- now:
+	case <-t.stopped:
+		return
+	}
+	select {
+	case <-t.done:
+	case <-t.stopped:
+	}
+}
+
+func (t *ticker) isStopped() bool {
+	select {
+	case <-t.stopped:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,93 @@
+package metricstest
+
+import (
+	"bytes"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+func TestClockMeter(t *testing.T) {
+	clock := NewClock(time.Now())
+	metrics.SetClock(clock)
+	defer metrics.SetClock(nil)
+	m := metrics.NewMeter()
+	defer m.Stop()
+	m.Mark(5)
+	clock.Add(5 * time.Second)
+	if rate1 := m.Rate1(); 1 != rate1 {
+		t.Errorf("m.Rate1(): 1 != %v\n", rate1)
+	}
+	clock.Add(time.Minute)
+	if rate1 := m.Rate1(); math.Abs(math.Exp(-1)-rate1) > 1e-9 {
+		t.Errorf("m.Rate1(): %v != %v\n", math.Exp(-1), rate1)
+	}
+	if rateMean := m.RateMean(); 5.0/65 != rateMean {
+		t.Errorf("m.RateMean(): %v != %v\n", 5.0/65, rateMean)
+	}
+}
+
+func TestClockTimer(t *testing.T) {
+	clock := NewClock(time.Now())
+	metrics.SetClock(clock)
+	defer metrics.SetClock(nil)
+	timer := metrics.NewTimer()
+	defer timer.Stop()
+	timer.Time(func() { clock.Add(time.Second) })
+	if max := timer.Max(); int64(time.Second) != max {
+		t.Errorf("timer.Max(): %v != %v\n", int64(time.Second), max)
+	}
+	timer.UpdateSince(clock.Now().Add(-time.Millisecond))
+	if min := timer.Min(); int64(time.Millisecond) != min {
+		t.Errorf("timer.Min(): %v != %v\n", int64(time.Millisecond), min)
+	}
+}
+
+func TestClockTTL(t *testing.T) {
+	clock := NewClock(time.Now())
+	metrics.SetClock(clock)
+	defer metrics.SetClock(nil)
+	r := metrics.NewRegistry().(*metrics.StandardRegistry)
+	r.SetTTL(time.Minute)
+	defer r.SetTTL(0)
+	metrics.GetOrRegisterCounter("foo", r).Inc(1)
+	clock.Add(30 * time.Second)
+	if nil == r.Get("foo") {
+		t.Fatal("foo expired early")
+	}
+	clock.Add(2 * time.Minute)
+	if nil != r.Get("foo") {
+		t.Error("foo didn't expire")
+	}
+}
+
+func TestClockReporter(t *testing.T) {
+	clock := NewClock(time.Now())
+	metrics.SetClock(clock)
+	defer metrics.SetClock(nil)
+	r := metrics.NewRegistry()
+	metrics.GetOrRegisterCounter("foo", r).Inc(47)
+	var b bytes.Buffer
+	go metrics.Write(r, time.Minute, &b)
+	clock.WaitForTicker(time.Minute)
+	clock.Add(59 * time.Second)
+	if 0 != b.Len() {
+		t.Fatalf("flushed early: %q", b.String())
+	}
+	clock.Add(time.Second)
+	if "counter foo\n  count:              47\n" != b.String() {
+		t.Errorf("b.String(): %q", b.String())
+	}
+}
+
+func TestClockStoppedTicker(t *testing.T) {
+	clock := NewClock(time.Unix(0, 0))
+	ticker := clock.Ticker(time.Second)
+	ticker.Stop()
+	clock.Add(time.Minute)
+	if now := clock.Now(); !time.Unix(60, 0).Equal(now) {
+		t.Errorf("clock.Now(): %v != %v\n", time.Unix(60, 0), now)
+	}
+}
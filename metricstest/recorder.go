@@ -0,0 +1,91 @@
+package metricstest
+
+import (
+	"sync"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+// A Flush is what a Recorder recorded of its registry at one time.
+type Flush struct {
+	Time    time.Time
+	Metrics map[string]interface{} // snapshots by name, as from CollectAll
+}
+
+// Recorder is a reporter which keeps the snapshots it takes instead of
+// sending them anywhere, so tests can assert on what a real reporter of the
+// same registry would have flushed, and when.
+type Recorder struct {
+	Registry metrics.Registry
+
+	mutex   sync.Mutex
+	flushes []Flush
+}
+
+// NewRecorder constructs a new Recorder of the given registry, or of
+// metrics.DefaultRegistry if r is nil.
+func NewRecorder(r metrics.Registry) *Recorder {
+	if nil == r {
+		r = metrics.DefaultRegistry
+	}
+	return &Recorder{Registry: r}
+}
+
+// Flushes returns what has been recorded, oldest first.
+func (rec *Recorder) Flushes() []Flush {
+	rec.mutex.Lock()
+	defer rec.mutex.Unlock()
+	flushes := make([]Flush, len(rec.flushes))
+	copy(flushes, rec.flushes)
+	return flushes
+}
+
+// Last returns what was recorded most recently, or false if nothing has been.
+func (rec *Recorder) Last() (Flush, bool) {
+	rec.mutex.Lock()
+	defer rec.mutex.Unlock()
+	if 0 == len(rec.flushes) {
+		return Flush{}, false
+	}
+	return rec.flushes[len(rec.flushes)-1], true
+}
+
+// RecordOnce records the registry once, at the time of metrics.CurrentClock.
+func (rec *Recorder) RecordOnce() {
+	rec.record(metrics.CurrentClock().Now())
+}
+
+// Reset forgets what has been recorded.
+func (rec *Recorder) Reset() {
+	rec.mutex.Lock()
+	defer rec.mutex.Unlock()
+	rec.flushes = nil
+}
+
+// Run records the registry every d of metrics.CurrentClock until stop or
+// the registry is closed.  This is designed to be called as a
+// goroutine, like the other reporters; with a mock Clock, wait for it with
+// Clock.WaitForTicker(d) before moving the clock on.
+func (rec *Recorder) Run(d time.Duration, stop <-chan struct{}) {
+	ticker := metrics.CurrentClock().Ticker(d)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C():
+			rec.record(now)
+			ticker.Done()
+		case <-stop:
+			return
+		case <-metrics.Closed(rec.Registry):
+			return
+		}
+	}
+}
+
+func (rec *Recorder) record(now time.Time) {
+	f := Flush{Time: now, Metrics: CollectAll(rec.Registry)}
+	rec.mutex.Lock()
+	defer rec.mutex.Unlock()
+	rec.flushes = append(rec.flushes, f)
+}
@@ -0,0 +1,45 @@
+package metricstest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+func TestRecorder(t *testing.T) {
+	clock := NewClock(time.Unix(0, 0))
+	metrics.SetClock(clock)
+	defer metrics.SetClock(nil)
+	r := metrics.NewRegistry()
+	c := metrics.GetOrRegisterCounter("foo", r)
+	rec := NewRecorder(r)
+	stop := make(chan struct{})
+	defer close(stop)
+	go rec.Run(10*time.Second, stop)
+	clock.WaitForTicker(10 * time.Second)
+	c.Inc(1)
+	clock.Add(10 * time.Second)
+	c.Inc(1)
+	clock.Add(10 * time.Second)
+	flushes := rec.Flushes()
+	if 2 != len(flushes) {
+		t.Fatalf("len(flushes): 2 != %v\n", len(flushes))
+	}
+	for i, f := range flushes {
+		if want := time.Unix(int64(10*(i+1)), 0); !want.Equal(f.Time) {
+			t.Errorf("flushes[%d].Time: %v != %v\n", i, want, f.Time)
+		}
+		if count := f.Metrics["foo"].(metrics.Counter).Count(); int64(i+1) != count {
+			t.Errorf("flushes[%d] count: %v != %v\n", i, i+1, count)
+		}
+	}
+	rec.Reset()
+	if _, ok := rec.Last(); ok {
+		t.Error("rec.Last(): ok after Reset")
+	}
+	rec.RecordOnce()
+	if f, ok := rec.Last(); !ok || !time.Unix(20, 0).Equal(f.Time) {
+		t.Errorf("rec.Last(): %v, %v\n", f, ok)
+	}
+}
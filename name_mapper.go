@@ -0,0 +1,153 @@
+package metrics
+
+import (
+	"strings"
+	"time"
+	"unicode"
+)
+
+// A NameMapper maps a canonical metric name, without tags, to the name a
+// backend expects.  See NewMappedRegistry.
+type NameMapper func(string) string
+
+// ChainNameMappers returns a NameMapper which applies each of the given
+// mappers in turn.
+func ChainNameMappers(mappers ...NameMapper) NameMapper {
+	return func(name string) string {
+		for _, m := range mappers {
+			name = m(name)
+		}
+		return name
+	}
+}
+
+// PrometheusNameMapper makes a name a valid Prometheus metric name, matching
+// [a-zA-Z_:][a-zA-Z0-9_:]*, by replacing the other characters with
+// underscores and prefixing a leading digit with one.
+func PrometheusNameMapper(name string) string {
+	name = strings.Map(func(c rune) rune {
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || '_' == c || ':' == c {
+			return c
+		}
+		return '_'
+	}, name)
+	if "" == name || '0' <= name[0] && name[0] <= '9' {
+		name = "_" + name
+	}
+	return name
+}
+
+// GraphiteNameMapper makes a name a safe Graphite path by replacing every
+// character but letters, digits, dots, underscores and dashes with an
+// underscore and collapsing runs of dots, which would make empty nodes.
+func GraphiteNameMapper(name string) string {
+	name = strings.Map(func(c rune) rune {
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || '.' == c || '_' == c || '-' == c {
+			return c
+		}
+		return '_'
+	}, name)
+	for strings.Contains(name, "..") {
+		name = strings.Replace(name, "..", ".", -1)
+	}
+	return strings.Trim(name, ".")
+}
+
+// SnakeCaseNameMapper turns a dotted, dashed or camel-cased name into
+// lower-case snake_case, e.g. "http.requestLatency" into
+// "http_request_latency" and "HTTPServer" into "http_server".
+func SnakeCaseNameMapper(name string) string {
+	rs := []rune(name)
+	var b strings.Builder
+	for i, c := range rs {
+		switch {
+		case '.' == c || '-' == c || ' ' == c:
+			c = '_'
+		case unicode.IsUpper(c):
+			if i > 0 && (unicode.IsLower(rs[i-1]) || unicode.IsDigit(rs[i-1]) ||
+				unicode.IsUpper(rs[i-1]) && i+1 < len(rs) && unicode.IsLower(rs[i+1])) {
+				b.WriteByte('_')
+			}
+			c = unicode.ToLower(c)
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// MappedRegistry is a view of a registry which reports every metric under a
+// name mapped by a NameMapper, so that one registry of canonical names can be
+// exported to backends with different naming rules without registering
+// anything twice.  Pass it to an exporter in place of the registry.  Only the
+// names Each, EachSnapshot, Snapshot, SnapshotAndReset and Delta report are
+// mapped; the tags in them are left to the exporter.  Every other method
+// passes names through to the underlying registry as they are.
+type MappedRegistry struct {
+	Registry
+	mapper NameMapper
+}
+
+// NewMappedRegistry returns a view of r which reports names mapped by m.
+func NewMappedRegistry(r Registry, m NameMapper) *MappedRegistry {
+	return &MappedRegistry{Registry: r, mapper: m}
+}
+
+// Delta returns the change in count of each counter, histogram, meter and
+// timer since the last call with the given consumer ID, by mapped name.
+func (r *MappedRegistry) Delta(consumerID string) map[string]int64 {
+	deltas := r.Registry.Delta(consumerID)
+	mapped := make(map[string]int64, len(deltas))
+	for name, delta := range deltas {
+		mapped[r.mapName(name)] = delta
+	}
+	return mapped
+}
+
+// Each calls f for each registered metric with its mapped name.
+func (r *MappedRegistry) Each(f func(string, interface{})) {
+	r.Registry.Each(func(name string, i interface{}) {
+		f(r.mapName(name), i)
+	})
+}
+
+// EachSnapshot calls f with a read-only snapshot of each registered metric
+// and its mapped name, as the underlying registry's EachSnapshot would.
+func (r *MappedRegistry) EachSnapshot(f func(string, interface{})) {
+	eachSnapshot(r, f)
+}
+
+// GetAll returns the values of every registered metric by field, keyed by
+// mapped name.
+func (r *MappedRegistry) GetAll() map[string]map[string]interface{} {
+	return getAll(r.EachSnapshot, RegistryPercentiles(r))
+}
+
+// Snapshot returns a read-only snapshot of every registered metric by mapped
+// name.
+func (r *MappedRegistry) Snapshot() *RegistrySnapshot {
+	return newRegistrySnapshot(r)
+}
+
+// SnapshotAndReset returns a new registry holding a read-only copy of every
+// metric under its mapped name, resetting them as the underlying registry
+// would.
+func (r *MappedRegistry) SnapshotAndReset() Registry {
+	snapshots := NewRegistry()
+	r.Registry.SnapshotAndReset().Each(func(name string, i interface{}) {
+		snapshots.Register(r.mapName(name), i)
+	})
+	return snapshots
+}
+
+// Subscribe watches every registered metric, as described for
+// StandardRegistry, delivering events under mapped names.
+func (r *MappedRegistry) Subscribe(match func(string) bool, interval time.Duration, buffer int) *Subscription {
+	return subscribe(r, match, interval, buffer)
+}
+
+// mapName maps the name in a name in the form returned by TaggedName, keeping
+// its tags.
+func (r *MappedRegistry) mapName(name string) string {
+	name, tags := SplitTaggedName(name)
+	return r.mapper(name) + tagSuffix(tags)
+}
@@ -0,0 +1,57 @@
+package metrics
+
+import "testing"
+
+func TestNameMappers(t *testing.T) {
+	for _, c := range []struct {
+		mapper     NameMapper
+		name, want string
+	}{
+		{PrometheusNameMapper, "http.requests-total", "http_requests_total"},
+		{PrometheusNameMapper, "5xx.count", "_5xx_count"},
+		{GraphiteNameMapper, "http requests/sec..total.", "http_requests_sec.total"},
+		{SnakeCaseNameMapper, "http.requestLatency", "http_request_latency"},
+		{SnakeCaseNameMapper, "db.pool-size", "db_pool_size"},
+		{SnakeCaseNameMapper, "HTTPServer.p99", "http_server_p99"},
+		{ChainNameMappers(SnakeCaseNameMapper, PrometheusNameMapper), "api.GetUser/latency", "api_get_user_latency"},
+	} {
+		if got := c.mapper(c.name); c.want != got {
+			t.Errorf("%q: %q != %q\n", c.name, c.want, got)
+		}
+	}
+}
+
+func TestMappedRegistry(t *testing.T) {
+	r := NewRegistry()
+	r.(*StandardRegistry).SetDefaultTags(map[string]string{"host": "a"})
+	c := NewCounter()
+	c.(Taggable).AddTags(map[string]string{"path": "/a.b"})
+	r.Register("http.requestCount", c)
+	c.Inc(47)
+	m := NewMappedRegistry(r, SnakeCaseNameMapper)
+	var names []string
+	m.EachSnapshot(func(name string, i interface{}) {
+		names = append(names, name)
+		if count := i.(Counter).Count(); 47 != count {
+			t.Errorf("count: 47 != %v\n", count)
+		}
+	})
+	if 1 != len(names) || "http_request_count;host=a;path=/a.b" != names[0] {
+		t.Fatal(names)
+	}
+	if nil == m.Snapshot().Get("http_request_count;host=a;path=/a.b") {
+		t.Error("m.Snapshot() lacks the mapped name")
+	}
+	if deltas := m.Delta("test"); 47 != deltas["http_request_count;path=/a.b"] {
+		t.Errorf("m.Delta(): %v\n", deltas)
+	}
+	if nil == m.Get("http.requestCount;path=/a.b") {
+		t.Error("m.Get() didn't pass the canonical name through")
+	}
+	if nil == m.SnapshotAndReset().Get("http_request_count;path=/a.b") {
+		t.Error("m.SnapshotAndReset() lacks the mapped name")
+	}
+	if count := c.Count(); 0 != count {
+		t.Errorf("c.Count() after SnapshotAndReset: 0 != %v\n", count)
+	}
+}
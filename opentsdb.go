@@ -2,8 +2,8 @@ package metrics
 
 import (
 	"bufio"
+	"context"
 	"fmt"
-	"log"
 	"net"
 	"os"
 	"strings"
@@ -18,8 +18,31 @@ type OpenTSDBConfig struct {
 	Addr          *net.TCPAddr  // Network address to connect to
 	Registry      Registry      // Registry to be exported
 	FlushInterval time.Duration // Flush interval
+	Schedule      FlushSchedule // Alignment and jitter of flushes within FlushInterval
 	DurationUnit  time.Duration // Time conversion unit for durations
 	Prefix        string        // Prefix to be prepended to metric names
+
+	// CounterEmission selects whether counters are emitted as cumulative
+	// counts, deltas, rates or a combination.  Deltas and rates are computed
+	// between flushes and rates are per second elapsed between them.
+	CounterEmission CounterEmission
+
+	// AggregationInterval, if set, widens the window over which counter
+	// deltas and rates are computed.  They're then only emitted by the one
+	// flush which falls on each window boundary while everything else is
+	// still emitted every flush.  It must be a multiple of FlushInterval.
+	AggregationInterval time.Duration
+
+	// Percentiles are those of histograms and timers.  Nil means the
+	// registry's; see StandardRegistry.SetPercentiles.
+	Percentiles []float64
+
+	// OnError is called with the error of each flush which fails, instead
+	// of logging it.
+	OnError func(error)
+
+	// Metrics, if set, times each flush and counts those which fail.
+	Metrics *ReporterMetrics
 }
 
 // OpenTSDB is a blocking exporter function which reports metrics in r
@@ -38,11 +61,15 @@ func OpenTSDB(r Registry, d time.Duration, prefix string, addr *net.TCPAddr) {
 // OpenTSDBWithConfig is a blocking exporter function just like OpenTSDB,
 // but it takes a OpenTSDBConfig instead.
 func OpenTSDBWithConfig(c OpenTSDBConfig) {
-	for _ = range time.Tick(c.FlushInterval) {
-		if err := openTSDB(&c); nil != err {
-			log.Println(err)
-		}
-	}
+	OpenTSDBContext(context.Background(), c)
+}
+
+// OpenTSDBContext is OpenTSDBWithConfig until ctx is done, when it flushes a
+// final time before returning.
+func OpenTSDBContext(ctx context.Context, c OpenTSDBConfig) {
+	c.Schedule.RunContext(ctx, c.FlushInterval, Closed(c.Registry), func(due time.Time) {
+		ReportError(c.OnError, c.Metrics.Flush(func() error { return openTSDB(&c, due) }))
+	})
 }
 
 func getShortHostname() string {
@@ -57,37 +84,52 @@ func getShortHostname() string {
 	return shortHostName
 }
 
-func openTSDB(c *OpenTSDBConfig) error {
+func openTSDB(c *OpenTSDBConfig, ts time.Time) error {
+	if err := validateAggregationInterval(c.FlushInterval, c.AggregationInterval); nil != err {
+		return err
+	}
 	shortHostname := getShortHostname()
-	now := time.Now().Unix()
+	now := ts.Unix()
 	du := float64(c.DurationUnit)
+	ps := reportedPercentiles(c.Percentiles, c.Registry)
 	conn, err := net.DialTCP("tcp", nil, c.Addr)
 	if nil != err {
 		return err
 	}
 	defer conn.Close()
 	w := bufio.NewWriter(conn)
-	c.Registry.Each(func(name string, i interface{}) {
+	consumerID := "opentsdb " + c.Addr.String() + " " + c.Prefix
+	interval, aggregate := aggregationWindow(c.Registry, consumerID, ts, c.FlushInterval, c.AggregationInterval)
+	counters := newCounterEmitter(c.Registry, c.CounterEmission, consumerID, interval, aggregate)
+	eachSnapshotOf(c.Registry, func(key, name string, i, _ interface{}) {
 		switch metric := i.(type) {
 		case Counter:
-			fmt.Fprintf(w, "put %s.%s.count %d %d host=%s\n", c.Prefix, name, now, metric.Count(), shortHostname)
+			counters.emit(key, metric, func(suffix, v string) {
+				fmt.Fprintf(w, "put %s.%s.%s %d %s host=%s\n", c.Prefix, name, suffix, now, v, shortHostname)
+			})
+		case CounterFloat64:
+			fmt.Fprintf(w, "put %s.%s.count %d %f host=%s\n", c.Prefix, name, now, metric.Count(), shortHostname)
 		case Gauge:
 			fmt.Fprintf(w, "put %s.%s.value %d %d host=%s\n", c.Prefix, name, now, metric.Value(), shortHostname)
 		case GaugeFloat64:
 			fmt.Fprintf(w, "put %s.%s.value %d %f host=%s\n", c.Prefix, name, now, metric.Value(), shortHostname)
+		case MergeableGaugeFloat64:
+			g := metric.Snapshot()
+			fmt.Fprintf(w, "put %s.%s.value %d %f host=%s\n", c.Prefix, name, now, g.Value(), shortHostname)
+			fmt.Fprintf(w, "put %s.%s.count %d %d host=%s\n", c.Prefix, name, now, g.Count(), shortHostname)
 		case Histogram:
 			h := metric.Snapshot()
-			ps := h.Percentiles([]float64{0.5, 0.75, 0.95, 0.99, 0.999})
+			ps := MetricPercentiles(ps, h)
+			scores := h.Percentiles(ps)
 			fmt.Fprintf(w, "put %s.%s.count %d %d host=%s\n", c.Prefix, name, now, h.Count(), shortHostname)
 			fmt.Fprintf(w, "put %s.%s.min %d %d host=%s\n", c.Prefix, name, now, h.Min(), shortHostname)
 			fmt.Fprintf(w, "put %s.%s.max %d %d host=%s\n", c.Prefix, name, now, h.Max(), shortHostname)
 			fmt.Fprintf(w, "put %s.%s.mean %d %.2f host=%s\n", c.Prefix, name, now, h.Mean(), shortHostname)
 			fmt.Fprintf(w, "put %s.%s.std-dev %d %.2f host=%s\n", c.Prefix, name, now, h.StdDev(), shortHostname)
-			fmt.Fprintf(w, "put %s.%s.50-percentile %d %.2f host=%s\n", c.Prefix, name, now, ps[0], shortHostname)
-			fmt.Fprintf(w, "put %s.%s.75-percentile %d %.2f host=%s\n", c.Prefix, name, now, ps[1], shortHostname)
-			fmt.Fprintf(w, "put %s.%s.95-percentile %d %.2f host=%s\n", c.Prefix, name, now, ps[2], shortHostname)
-			fmt.Fprintf(w, "put %s.%s.99-percentile %d %.2f host=%s\n", c.Prefix, name, now, ps[3], shortHostname)
-			fmt.Fprintf(w, "put %s.%s.999-percentile %d %.2f host=%s\n", c.Prefix, name, now, ps[4], shortHostname)
+			for i, p := range ps {
+				key := strings.Replace(formatPercent(p), ".", "", 1)
+				fmt.Fprintf(w, "put %s.%s.%s-percentile %d %.2f host=%s\n", c.Prefix, name, key, now, scores[i], shortHostname)
+			}
 		case Meter:
 			m := metric.Snapshot()
 			fmt.Fprintf(w, "put %s.%s.count %d %d host=%s\n", c.Prefix, name, now, m.Count(), shortHostname)
@@ -97,17 +139,17 @@ func openTSDB(c *OpenTSDBConfig) error {
 			fmt.Fprintf(w, "put %s.%s.mean %d %.2f host=%s\n", c.Prefix, name, now, m.RateMean(), shortHostname)
 		case Timer:
 			t := metric.Snapshot()
-			ps := t.Percentiles([]float64{0.5, 0.75, 0.95, 0.99, 0.999})
+			ps := MetricPercentiles(ps, t)
+			scores := t.Percentiles(ps)
 			fmt.Fprintf(w, "put %s.%s.count %d %d host=%s\n", c.Prefix, name, now, t.Count(), shortHostname)
 			fmt.Fprintf(w, "put %s.%s.min %d %d host=%s\n", c.Prefix, name, now, t.Min()/int64(du), shortHostname)
 			fmt.Fprintf(w, "put %s.%s.max %d %d host=%s\n", c.Prefix, name, now, t.Max()/int64(du), shortHostname)
 			fmt.Fprintf(w, "put %s.%s.mean %d %.2f host=%s\n", c.Prefix, name, now, t.Mean()/du, shortHostname)
 			fmt.Fprintf(w, "put %s.%s.std-dev %d %.2f host=%s\n", c.Prefix, name, now, t.StdDev()/du, shortHostname)
-			fmt.Fprintf(w, "put %s.%s.50-percentile %d %.2f host=%s\n", c.Prefix, name, now, ps[0]/du, shortHostname)
-			fmt.Fprintf(w, "put %s.%s.75-percentile %d %.2f host=%s\n", c.Prefix, name, now, ps[1]/du, shortHostname)
-			fmt.Fprintf(w, "put %s.%s.95-percentile %d %.2f host=%s\n", c.Prefix, name, now, ps[2]/du, shortHostname)
-			fmt.Fprintf(w, "put %s.%s.99-percentile %d %.2f host=%s\n", c.Prefix, name, now, ps[3]/du, shortHostname)
-			fmt.Fprintf(w, "put %s.%s.999-percentile %d %.2f host=%s\n", c.Prefix, name, now, ps[4]/du, shortHostname)
+			for i, p := range ps {
+				key := strings.Replace(formatPercent(p), ".", "", 1)
+				fmt.Fprintf(w, "put %s.%s.%s-percentile %d %.2f host=%s\n", c.Prefix, name, key, now, scores[i]/du, shortHostname)
+			}
 			fmt.Fprintf(w, "put %s.%s.one-minute %d %.2f host=%s\n", c.Prefix, name, now, t.Rate1(), shortHostname)
 			fmt.Fprintf(w, "put %s.%s.five-minute %d %.2f host=%s\n", c.Prefix, name, now, t.Rate5(), shortHostname)
 			fmt.Fprintf(w, "put %s.%s.fifteen-minute %d %.2f host=%s\n", c.Prefix, name, now, t.Rate15(), shortHostname)
@@ -0,0 +1,126 @@
+package otel
+
+// The types below are the subset of the OTLP metrics data model which the
+// producer emits, with the field names of its JSON encoding.  Scalar 64-bit
+// integers are strings, as the protobuf JSON mapping prescribes; bucket counts
+// are numbers, which decoders accept as well.
+
+// ExportRequest is an OTLP ExportMetricsServiceRequest.
+type ExportRequest struct {
+	ResourceMetrics []ResourceMetrics `json:"resourceMetrics"`
+}
+
+// ResourceMetrics are the metrics of one resource.
+type ResourceMetrics struct {
+	Resource     Resource       `json:"resource"`
+	ScopeMetrics []ScopeMetrics `json:"scopeMetrics"`
+}
+
+// Resource describes the entity producing the metrics.
+type Resource struct {
+	Attributes []KeyValue `json:"attributes,omitempty"`
+}
+
+// ScopeMetrics are the metrics of one instrumentation scope.
+type ScopeMetrics struct {
+	Scope   Scope    `json:"scope"`
+	Metrics []Metric `json:"metrics"`
+}
+
+// Scope names an instrumentation scope.
+type Scope struct {
+	Name string `json:"name"`
+}
+
+// Metric is one named metric, exactly one of whose Sum, Gauge, Histogram and
+// ExponentialHistogram is set.
+type Metric struct {
+	Name                 string                `json:"name"`
+	Unit                 string                `json:"unit,omitempty"`
+	Sum                  *Sum                  `json:"sum,omitempty"`
+	Gauge                *Gauge                `json:"gauge,omitempty"`
+	Histogram            *Histogram            `json:"histogram,omitempty"`
+	ExponentialHistogram *ExponentialHistogram `json:"exponentialHistogram,omitempty"`
+}
+
+// Sum is a metric whose data points are sums over time.
+type Sum struct {
+	DataPoints             []NumberDataPoint `json:"dataPoints"`
+	AggregationTemporality int               `json:"aggregationTemporality"`
+	IsMonotonic            bool              `json:"isMonotonic"`
+}
+
+// Gauge is a metric whose data points are instantaneous values.
+type Gauge struct {
+	DataPoints []NumberDataPoint `json:"dataPoints"`
+}
+
+// Histogram is a metric whose data points are explicit-bucket distributions.
+type Histogram struct {
+	DataPoints             []HistogramDataPoint `json:"dataPoints"`
+	AggregationTemporality int                  `json:"aggregationTemporality"`
+}
+
+// ExponentialHistogram is a metric whose data points are base-2 exponential
+// bucket distributions.
+type ExponentialHistogram struct {
+	DataPoints             []ExponentialHistogramDataPoint `json:"dataPoints"`
+	AggregationTemporality int                             `json:"aggregationTemporality"`
+}
+
+// NumberDataPoint is one value of a sum or gauge, either AsInt or AsDouble.
+type NumberDataPoint struct {
+	Attributes        []KeyValue `json:"attributes,omitempty"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano,omitempty"`
+	TimeUnixNano      string     `json:"timeUnixNano"`
+	AsInt             *string    `json:"asInt,omitempty"`
+	AsDouble          *float64   `json:"asDouble,omitempty"`
+}
+
+// HistogramDataPoint is one distribution of a histogram.  BucketCounts has one
+// more element than ExplicitBounds, counting the values above the last bound.
+type HistogramDataPoint struct {
+	Attributes        []KeyValue `json:"attributes,omitempty"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano"`
+	TimeUnixNano      string     `json:"timeUnixNano"`
+	Count             string     `json:"count"`
+	Sum               float64    `json:"sum"`
+	BucketCounts      []uint64   `json:"bucketCounts,omitempty"`
+	ExplicitBounds    []float64  `json:"explicitBounds,omitempty"`
+	Min               *float64   `json:"min,omitempty"`
+	Max               *float64   `json:"max,omitempty"`
+}
+
+// ExponentialHistogramDataPoint is one distribution of an exponential
+// histogram, whose bucket bounds are powers of 2^(2^-Scale).
+type ExponentialHistogramDataPoint struct {
+	Attributes        []KeyValue `json:"attributes,omitempty"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano"`
+	TimeUnixNano      string     `json:"timeUnixNano"`
+	Count             string     `json:"count"`
+	Sum               float64    `json:"sum"`
+	Scale             int        `json:"scale"`
+	ZeroCount         string     `json:"zeroCount"`
+	Positive          Buckets    `json:"positive"`
+	Negative          Buckets    `json:"negative"`
+	Min               *float64   `json:"min,omitempty"`
+	Max               *float64   `json:"max,omitempty"`
+}
+
+// Buckets are the counts of consecutive buckets of an exponential histogram,
+// the first of which is bucket Offset.
+type Buckets struct {
+	Offset       int      `json:"offset"`
+	BucketCounts []uint64 `json:"bucketCounts,omitempty"`
+}
+
+// KeyValue is one attribute.
+type KeyValue struct {
+	Key   string   `json:"key"`
+	Value AnyValue `json:"value"`
+}
+
+// AnyValue is an attribute value.  Tags are always strings.
+type AnyValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+}
@@ -0,0 +1,331 @@
+// Package otel bridges a go-metrics Registry to OpenTelemetry, producing its
+// metrics in the OpenTelemetry data model and pushing them to a collector as
+// OTLP over HTTP, encoded as JSON, so exporters can move to OpenTelemetry
+// without rewriting instrumentation.
+package otel
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+// ScopeName names the instrumentation scope of every metric produced.
+const ScopeName = "github.com/rcrowley/go-metrics"
+
+// DefaultBounds are the explicit bucket bounds of histograms unless
+// Config.Bounds says otherwise, the OpenTelemetry SDK's defaults.
+var DefaultBounds = []float64{0, 5, 10, 25, 50, 75, 100, 250, 500, 750, 1000, 2500, 5000, 7500, 10000}
+
+// DefaultTimerBounds are the explicit bucket bounds of timers, in seconds,
+// unless Config.TimerBounds says otherwise.
+var DefaultTimerBounds = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Config configures the bridge.
+type Config struct {
+	Endpoint      string            // OTLP/HTTP metrics URL, e.g. http://localhost:4318/v1/metrics
+	Registry      metrics.Registry  // Registry to be exported
+	FlushInterval time.Duration     // Push interval
+	Resource      map[string]string // Resource attributes, e.g. service.name
+	Headers       map[string]string // Extra request headers, e.g. for authentication
+	Bounds        []float64         // Explicit bucket bounds of histograms, unless their sample is a metrics.BucketSample or ExponentialSample
+	TimerBounds   []float64         // Explicit bucket bounds of timers, in seconds, likewise
+	Client        *http.Client      // Nil means http.DefaultClient
+
+	// LargeInts converts the sums, minimums and maximums of histograms and
+	// timers, which OTLP carries as doubles, beyond ±2^53.
+	LargeInts metrics.Int64Coercer
+
+	// Schedule aligns and jitters the pushes of OTLP, e.g. so that a fleet
+	// of identical services doesn't push to the collector at once.
+	Schedule metrics.FlushSchedule
+
+	OnError func(error)              // Called with each error of OTLP, which logs it if nil
+	Metrics *metrics.ReporterMetrics // Records each Export
+}
+
+// AggregationTemporalityCumulative marks sums and histograms as cumulative
+// since the producer's start time, which is how go-metrics counts.
+const AggregationTemporalityCumulative = 2
+
+// Producer produces the metrics in a registry in the OpenTelemetry data
+// model.  Counters become non-monotonic sums, meters monotonic sums, gauges
+// gauges, and histograms and timers explicit-bucket histograms, timers in
+// seconds.  Tags, including the registry's default tags, become attributes.
+// Bucket counts are estimated from each histogram's sample; see
+// HistogramSnapshot.Buckets.
+type Producer struct {
+	c     Config
+	start time.Time
+}
+
+// NewProducer returns a Producer whose cumulative metrics start now.
+func NewProducer(c Config) *Producer {
+	if nil == c.Bounds {
+		c.Bounds = DefaultBounds
+	}
+	if nil == c.TimerBounds {
+		c.TimerBounds = DefaultTimerBounds
+	}
+	return &Producer{c: c, start: time.Now()}
+}
+
+// OTLP is a blocking exporter function which pushes metrics in c.Registry to
+// c.Endpoint every c.FlushInterval, passing errors to c.OnError, or logging
+// them, until c.Registry is closed.
+func OTLP(c Config) {
+	OTLPContext(context.Background(), c)
+}
+
+// OTLPContext is OTLP until ctx is done, when it exports a final time before
+// returning.
+func OTLPContext(ctx context.Context, c Config) {
+	p := NewProducer(c)
+	c.Schedule.RunContext(ctx, c.FlushInterval, metrics.Closed(c.Registry), func(time.Time) {
+		metrics.ReportError(c.OnError, p.Export())
+	})
+}
+
+// Export pushes every metric once to the configured endpoint.
+func (p *Producer) Export() error {
+	return p.c.Metrics.Flush(p.export)
+}
+
+func (p *Producer) export() error {
+	body, err := json.Marshal(p.Produce(time.Now()))
+	if nil != err {
+		return err
+	}
+	req, err := http.NewRequest("POST", p.c.Endpoint, bytes.NewReader(body))
+	if nil != err {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range p.c.Headers {
+		req.Header.Set(k, v)
+	}
+	client := p.c.Client
+	if nil == client {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if nil != err {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("OTLP export failed: %s %s", resp.Status, bytes.TrimSpace(respBody))
+	}
+	return nil
+}
+
+// Produce returns every metric in the registry as an OTLP export request
+// timestamped now.  Series sharing a name become data points of one metric;
+// series whose name is taken by a metric of another kind are dropped.
+func (p *Producer) Produce(now time.Time) *ExportRequest {
+	start := strconv.FormatInt(p.start.UnixNano(), 10)
+	ts := strconv.FormatInt(now.UnixNano(), 10)
+	byName := make(map[string]*Metric)
+	p.c.Registry.EachSnapshot(func(name string, i interface{}) {
+		name, tags := metrics.SplitTaggedName(name)
+		attrs := attributes(tags)
+		m := &Metric{Name: name}
+		switch metric := i.(type) {
+		case metrics.Counter:
+			m.Sum = &Sum{
+				DataPoints:             []NumberDataPoint{intPoint(attrs, start, ts, metric.Count())},
+				AggregationTemporality: AggregationTemporalityCumulative,
+			}
+		case metrics.CounterFloat64:
+			point := doublePoint(attrs, ts, metric.Count())
+			point.StartTimeUnixNano = start
+			m.Sum = &Sum{
+				DataPoints:             []NumberDataPoint{point},
+				AggregationTemporality: AggregationTemporalityCumulative,
+			}
+		case metrics.Gauge:
+			m.Gauge = &Gauge{DataPoints: []NumberDataPoint{intPoint(attrs, "", ts, metric.Value())}}
+		case metrics.GaugeFloat64:
+			m.Gauge = &Gauge{DataPoints: []NumberDataPoint{doublePoint(attrs, ts, metric.Value())}}
+		case metrics.MergeableGaugeFloat64:
+			m.Gauge = &Gauge{DataPoints: []NumberDataPoint{doublePoint(attrs, ts, metric.Value())}}
+		case metrics.Histogram:
+			if b, ok := metrics.ExponentialBucketsOf(metric); ok {
+				m.ExponentialHistogram = p.exponentialHistogram(attrs, start, ts, metric, b)
+				break
+			}
+			m.Histogram = p.histogram(attrs, start, ts, metric, p.c.Bounds, 1)
+		case metrics.Meter:
+			m.Sum = &Sum{
+				DataPoints:             []NumberDataPoint{intPoint(attrs, start, ts, metric.Count())},
+				AggregationTemporality: AggregationTemporalityCumulative,
+				IsMonotonic:            true,
+			}
+		case metrics.Timer:
+			if b, ok := metrics.ExponentialBucketsOf(metric); ok {
+				// Bounds in seconds wouldn't be powers of two.
+				m.Unit = "ns"
+				m.ExponentialHistogram = p.exponentialHistogram(attrs, start, ts, metric, b)
+				break
+			}
+			m.Unit = "s"
+			m.Histogram = p.histogram(attrs, start, ts, metric, p.c.TimerBounds, float64(time.Second))
+		default:
+			return
+		}
+		existing, ok := byName[name]
+		if !ok {
+			byName[name] = m
+			return
+		}
+		switch {
+		case nil != existing.Sum && nil != m.Sum && existing.Sum.IsMonotonic == m.Sum.IsMonotonic:
+			existing.Sum.DataPoints = append(existing.Sum.DataPoints, m.Sum.DataPoints...)
+		case nil != existing.Gauge && nil != m.Gauge:
+			existing.Gauge.DataPoints = append(existing.Gauge.DataPoints, m.Gauge.DataPoints...)
+		case nil != existing.Histogram && nil != m.Histogram && existing.Unit == m.Unit:
+			existing.Histogram.DataPoints = append(existing.Histogram.DataPoints, m.Histogram.DataPoints...)
+		case nil != existing.ExponentialHistogram && nil != m.ExponentialHistogram && existing.Unit == m.Unit:
+			existing.ExponentialHistogram.DataPoints = append(existing.ExponentialHistogram.DataPoints, m.ExponentialHistogram.DataPoints...)
+		}
+	})
+	names := make([]string, 0, len(byName))
+	for name := range byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	ms := make([]Metric, len(names))
+	for i, name := range names {
+		ms[i] = *byName[name]
+	}
+	return &ExportRequest{ResourceMetrics: []ResourceMetrics{{
+		Resource:     Resource{Attributes: attributes(p.c.Resource)},
+		ScopeMetrics: []ScopeMetrics{{Scope: Scope{Name: ScopeName}, Metrics: ms}},
+	}}}
+}
+
+// bucketer is implemented by histogram and timer snapshots.
+type bucketer interface {
+	Buckets([]float64) []uint64
+}
+
+// histogram converts a histogram or timer, whose values are divided by unit,
+// into a histogram with the given bounds in that unit, or with its own bounds
+// if its sample is a metrics.BucketSample, whose counts are exact.
+func (p *Producer) histogram(attrs []KeyValue, start, ts string, h interface {
+	Count() int64
+	Max() int64
+	Min() int64
+	Sum() int64
+}, bounds []float64, unit float64) *Histogram {
+	scaled := metrics.BucketBounds(h)
+	if nil != scaled {
+		bounds = make([]float64, len(scaled))
+		for i, bound := range scaled {
+			bounds[i] = bound / unit
+		}
+	} else {
+		scaled = make([]float64, len(bounds))
+		for i, bound := range bounds {
+			scaled[i] = bound * unit
+		}
+	}
+	dp := HistogramDataPoint{
+		Attributes:        attrs,
+		StartTimeUnixNano: start,
+		TimeUnixNano:      ts,
+		Count:             strconv.FormatInt(h.Count(), 10),
+		Sum:               p.c.LargeInts.Float64(h.Sum()) / unit,
+		ExplicitBounds:    bounds,
+	}
+	if 0 != h.Count() {
+		min, max := p.c.LargeInts.Float64(h.Min())/unit, p.c.LargeInts.Float64(h.Max())/unit
+		dp.Min, dp.Max = &min, &max
+	}
+	if b, ok := h.(bucketer); ok {
+		// Buckets are cumulative, OpenTelemetry's aren't and add one for
+		// values above the last bound.
+		cumulative := b.Buckets(scaled)
+		dp.BucketCounts = make([]uint64, len(bounds)+1)
+		var prev uint64
+		for i, n := range cumulative {
+			if n < prev {
+				n = prev
+			}
+			dp.BucketCounts[i] = n - prev
+			prev = n
+		}
+		if count := uint64(h.Count()); count > prev {
+			dp.BucketCounts[len(bounds)] = count - prev
+		}
+	}
+	return &Histogram{
+		DataPoints:             []HistogramDataPoint{dp},
+		AggregationTemporality: AggregationTemporalityCumulative,
+	}
+}
+
+// exponentialHistogram converts a histogram or timer whose sample is a
+// metrics.ExponentialSample, with the buckets b, into an exponential
+// histogram, its values in their own unit.
+func (p *Producer) exponentialHistogram(attrs []KeyValue, start, ts string, h interface {
+	Count() int64
+	Max() int64
+	Min() int64
+	Sum() int64
+}, b metrics.ExponentialBuckets) *ExponentialHistogram {
+	dp := ExponentialHistogramDataPoint{
+		Attributes:        attrs,
+		StartTimeUnixNano: start,
+		TimeUnixNano:      ts,
+		Count:             strconv.FormatInt(h.Count(), 10),
+		Sum:               p.c.LargeInts.Float64(h.Sum()),
+		Scale:             b.Scale,
+		ZeroCount:         strconv.FormatUint(b.ZeroCount, 10),
+		Positive:          Buckets{Offset: b.Positive.Offset, BucketCounts: b.Positive.Counts},
+		Negative:          Buckets{Offset: b.Negative.Offset, BucketCounts: b.Negative.Counts},
+	}
+	if 0 != h.Count() {
+		min, max := p.c.LargeInts.Float64(h.Min()), p.c.LargeInts.Float64(h.Max())
+		dp.Min, dp.Max = &min, &max
+	}
+	return &ExponentialHistogram{
+		DataPoints:             []ExponentialHistogramDataPoint{dp},
+		AggregationTemporality: AggregationTemporalityCumulative,
+	}
+}
+
+func attributes(tags map[string]string) []KeyValue {
+	if 0 == len(tags) {
+		return nil
+	}
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	attrs := make([]KeyValue, len(keys))
+	for i, k := range keys {
+		v := tags[k]
+		attrs[i] = KeyValue{Key: k, Value: AnyValue{StringValue: &v}}
+	}
+	return attrs
+}
+
+func intPoint(attrs []KeyValue, start, ts string, v int64) NumberDataPoint {
+	s := strconv.FormatInt(v, 10)
+	return NumberDataPoint{Attributes: attrs, StartTimeUnixNano: start, TimeUnixNano: ts, AsInt: &s}
+}
+
+func doublePoint(attrs []KeyValue, ts string, v float64) NumberDataPoint {
+	return NumberDataPoint{Attributes: attrs, TimeUnixNano: ts, AsDouble: &v}
+}
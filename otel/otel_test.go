@@ -0,0 +1,167 @@
+package otel
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+func TestProduce(t *testing.T) {
+	r := metrics.NewRegistry()
+	for _, endpoint := range []string{"/users", "/groups"} {
+		c := metrics.NewCounter()
+		c.(metrics.Taggable).AddTags(map[string]string{"endpoint": endpoint})
+		c.Inc(1)
+		r.Register("requests", c)
+	}
+	metrics.NewRegisteredGaugeFloat64("temperature", r).Update(21.5)
+	tm := metrics.NewRegisteredTimer("latency", r)
+	tm.Update(20 * time.Millisecond)
+	tm.Update(2 * time.Second)
+	p := NewProducer(Config{Registry: r, Resource: map[string]string{"service.name": "test"}, TimerBounds: []float64{0.1, 1}})
+
+	req := p.Produce(time.Now())
+	rm := req.ResourceMetrics[0]
+	if a := rm.Resource.Attributes; 1 != len(a) || "service.name" != a[0].Key || "test" != *a[0].Value.StringValue {
+		t.Errorf("Resource.Attributes: %v\n", a)
+	}
+	ms := rm.ScopeMetrics[0].Metrics
+	if 3 != len(ms) {
+		t.Fatalf("len(Metrics): 3 != %v\n", len(ms))
+	}
+	latency, requests, temperature := ms[0], ms[1], ms[2]
+
+	if "s" != latency.Unit || nil == latency.Histogram {
+		t.Fatalf("latency: %+v\n", latency)
+	}
+	dp := latency.Histogram.DataPoints[0]
+	if "2" != dp.Count || 2.02 != dp.Sum || 0.02 != *dp.Min || 2 != *dp.Max {
+		t.Errorf("latency: %+v\n", dp)
+	}
+	if b := dp.BucketCounts; 3 != len(b) || 1 != b[0] || 0 != b[1] || 1 != b[2] {
+		t.Errorf("BucketCounts: [1 0 1] != %v\n", b)
+	}
+
+	if nil == requests.Sum || requests.Sum.IsMonotonic || 2 != len(requests.Sum.DataPoints) {
+		t.Fatalf("requests: %+v\n", requests)
+	}
+	for _, dp := range requests.Sum.DataPoints {
+		if "1" != *dp.AsInt || "endpoint" != dp.Attributes[0].Key {
+			t.Errorf("requests: %+v\n", dp)
+		}
+	}
+
+	if nil == temperature.Gauge || 21.5 != *temperature.Gauge.DataPoints[0].AsDouble {
+		t.Errorf("temperature: %+v\n", temperature)
+	}
+}
+
+func TestProduceLargeInts(t *testing.T) {
+	r := metrics.NewRegistry()
+	metrics.NewRegisteredHistogram("bytes", r, metrics.NewUniformSample(10)).Update(1<<53 + 1)
+	lost := metrics.NewCounter()
+	p := NewProducer(Config{Registry: r, LargeInts: metrics.Int64Coercer{Handling: metrics.LargeIntWarn, PrecisionLoss: lost}})
+	dp := p.Produce(time.Now()).ResourceMetrics[0].ScopeMetrics[0].Metrics[0].Histogram.DataPoints[0]
+	if float64(1<<53) != dp.Sum || float64(1<<53) != *dp.Min || float64(1<<53) != *dp.Max {
+		t.Errorf("bytes: %+v\n", dp)
+	}
+	if count := lost.Count(); 3 != count {
+		t.Errorf("lost.Count(): 3 != %v\n", count)
+	}
+}
+
+func TestProduceBucketSample(t *testing.T) {
+	r := metrics.NewRegistry()
+	tm := metrics.NewTimerWithSample(metrics.NewBucketSample([]float64{float64(5 * time.Millisecond), float64(time.Second)}))
+	r.Register("latency", tm)
+	tm.Update(time.Millisecond)
+	tm.Update(2 * time.Second)
+	ms := NewProducer(Config{Registry: r}).Produce(time.Now()).ResourceMetrics[0].ScopeMetrics[0].Metrics
+	dp := ms[0].Histogram.DataPoints[0]
+	if b := dp.ExplicitBounds; 2 != len(b) || 0.005 != b[0] || 1 != b[1] {
+		t.Errorf("ExplicitBounds: [0.005 1] != %v\n", b)
+	}
+	if b := dp.BucketCounts; 3 != len(b) || 1 != b[0] || 0 != b[1] || 1 != b[2] {
+		t.Errorf("BucketCounts: [1 0 1] != %v\n", b)
+	}
+}
+
+func TestProduceExponentialSample(t *testing.T) {
+	r := metrics.NewRegistry()
+	h := metrics.NewRegisteredHistogram("sizes", r, metrics.NewExponentialSample(0))
+	h.Update(0)
+	h.Update(3)
+	h.Update(1000)
+	metrics.NewRegisteredHistogram("sizes;shard=2", r, metrics.NewExponentialSample(0)).Update(5)
+	tm := metrics.NewTimerWithSample(metrics.NewExponentialSample(0))
+	r.Register("latency", tm)
+	tm.Update(time.Millisecond)
+	ms := NewProducer(Config{Registry: r}).Produce(time.Now()).ResourceMetrics[0].ScopeMetrics[0].Metrics
+	latency, sizes := ms[0], ms[1]
+	if "ns" != latency.Unit || nil == latency.ExponentialHistogram || nil != latency.Histogram {
+		t.Fatalf("latency: %+v\n", latency)
+	}
+	if dp := latency.ExponentialHistogram.DataPoints[0]; "1" != dp.Count || 1e6 != dp.Sum || 1 != len(dp.Positive.BucketCounts) {
+		t.Errorf("latency: %+v\n", dp)
+	}
+	if nil == sizes.ExponentialHistogram || 2 != len(sizes.ExponentialHistogram.DataPoints) {
+		t.Fatalf("sizes: %+v\n", sizes)
+	}
+	dp := sizes.ExponentialHistogram.DataPoints[0]
+	if 0 != len(dp.Attributes) { // Series of one name come in no particular order.
+		dp = sizes.ExponentialHistogram.DataPoints[1]
+	}
+	if "3" != dp.Count || "1" != dp.ZeroCount || 1003 != dp.Sum || 0 != *dp.Min || 1000 != *dp.Max || ms[1].Unit != "" {
+		t.Errorf("sizes: %+v\n", dp)
+	}
+	var n uint64
+	for _, k := range dp.Positive.BucketCounts {
+		n += k
+	}
+	base := math.Exp2(math.Ldexp(1, -dp.Scale))
+	if 2 != n || !(math.Pow(base, float64(dp.Positive.Offset)) < 3) {
+		t.Errorf("sizes: %v values from bucket %v at scale %v\n", n, dp.Positive.Offset, dp.Scale)
+	}
+}
+
+func TestExport(t *testing.T) {
+	var got ExportRequest
+	var header http.Header
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		b, _ := ioutil.ReadAll(req.Body)
+		header = req.Header
+		if err := json.Unmarshal(b, &got); nil != err {
+			t.Error(err)
+		}
+	}))
+	defer s.Close()
+	r := metrics.NewRegistry()
+	metrics.NewRegisteredMeter("hits", r).Mark(3)
+	p := NewProducer(Config{Endpoint: s.URL + "/v1/metrics", Registry: r, Headers: map[string]string{"Authorization": "Bearer x"}})
+	if err := p.Export(); nil != err {
+		t.Fatal(err)
+	}
+	if "application/json" != header.Get("Content-Type") || "Bearer x" != header.Get("Authorization") {
+		t.Errorf("header: %v\n", header)
+	}
+	m := got.ResourceMetrics[0].ScopeMetrics[0].Metrics[0]
+	if "hits" != m.Name || !m.Sum.IsMonotonic || "3" != *m.Sum.DataPoints[0].AsInt {
+		t.Errorf("metric: %+v\n", m)
+	}
+}
+
+func TestExportError(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.Error(w, "bad", http.StatusBadRequest)
+	}))
+	defer s.Close()
+	if err := NewProducer(Config{Endpoint: s.URL, Registry: metrics.NewRegistry()}).Export(); nil == err {
+		t.Error("Export(): want error\n")
+	}
+}
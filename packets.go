@@ -0,0 +1,32 @@
+package metrics
+
+import "bytes"
+
+// PackLines packs lines, given without their newlines, into packets of at
+// most max bytes for exporters to datagram transports, which the network
+// would otherwise truncate or fragment.  The lines of a packet are separated
+// by newlines, and a packet only ever ends at a line boundary, so that no
+// line is split across packets.  A line longer than max fits in no packet:
+// it's left out rather than sent corrupt, and the number of lines left out
+// is returned as dropped.
+func PackLines(lines []string, max int) (packets [][]byte, dropped int) {
+	var buf bytes.Buffer
+	for _, line := range lines {
+		if len(line) > max {
+			dropped++
+			continue
+		}
+		if 0 != buf.Len() && buf.Len()+1+len(line) > max {
+			packets = append(packets, append([]byte(nil), buf.Bytes()...))
+			buf.Reset()
+		}
+		if 0 != buf.Len() {
+			buf.WriteByte('\n')
+		}
+		buf.WriteString(line)
+	}
+	if 0 != buf.Len() {
+		packets = append(packets, buf.Bytes())
+	}
+	return packets, dropped
+}
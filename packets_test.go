@@ -0,0 +1,43 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPackLines(t *testing.T) {
+	lines := []string{"a:1|g", "bb:1|g", "ccc:1|g", "dddd:1|g", "eeeee:1|g"}
+	packets, dropped := PackLines(lines, 16)
+	if 0 != dropped {
+		t.Errorf("dropped: 0 != %v\n", dropped)
+	}
+	var got []string
+	for _, p := range packets {
+		if len(p) > 16 {
+			t.Errorf("packet size: 16 < %v\n", len(p))
+		}
+		got = append(got, strings.Split(string(p), "\n")...)
+	}
+	if strings.Join(lines, ",") != strings.Join(got, ",") {
+		t.Errorf("lines: %v != %v\n", lines, got)
+	}
+	if 3 != len(packets) {
+		t.Errorf("packets: 3 != %v\n", len(packets))
+	}
+}
+
+func TestPackLinesDropsLongLines(t *testing.T) {
+	packets, dropped := PackLines([]string{"a:1|g", "a-name-far-too-long-for-a-packet:1|g", "bb:1|g"}, 16)
+	if 1 != dropped {
+		t.Errorf("dropped: 1 != %v\n", dropped)
+	}
+	if 1 != len(packets) || "a:1|g\nbb:1|g" != string(packets[0]) {
+		t.Errorf("packets: %q\n", packets)
+	}
+}
+
+func TestPackLinesEmpty(t *testing.T) {
+	if packets, dropped := PackLines(nil, 16); 0 != len(packets) || 0 != dropped {
+		t.Errorf("PackLines(nil): %q, %v\n", packets, dropped)
+	}
+}
@@ -0,0 +1,69 @@
+package metrics
+
+import "time"
+
+// processStart approximates the time the process started.
+var processStart = time.Now()
+
+// processStats are the statistics of the process read from the operating
+// system.
+type processStats struct {
+	cpuSeconds float64 // User and system CPU time
+	rssBytes   int64   // Resident set size
+	openFDs    int64   // Open file descriptors
+}
+
+// ProcessMetrics updates metrics describing the process itself: its CPU time
+// in seconds, resident memory in bytes, open file descriptors and uptime in
+// seconds, registered as process.cpu.seconds, process.resident_memory.bytes,
+// process.open_fds and process.uptime.seconds.  Uptime is measured from the
+// initialization of this package and is available everywhere.  The others are
+// read from /proc on Linux and aren't registered on other platforms.
+type ProcessMetrics struct {
+	cpu    GaugeFloat64
+	rss    Gauge
+	fds    Gauge
+	uptime GaugeFloat64
+}
+
+// RegisterProcessMetrics registers the process metrics in r and returns the
+// ProcessMetrics which captures them.
+func RegisterProcessMetrics(r Registry) *ProcessMetrics {
+	pm := &ProcessMetrics{uptime: NewGaugeFloat64()}
+	r.Register("process.uptime.seconds", pm.uptime)
+	if _, ok := readProcessStats(); ok {
+		pm.cpu, pm.rss, pm.fds = NewGaugeFloat64(), NewGauge(), NewGauge()
+		r.Register("process.cpu.seconds", pm.cpu)
+		r.Register("process.resident_memory.bytes", pm.rss)
+		r.Register("process.open_fds", pm.fds)
+	}
+	return pm
+}
+
+// Capture reads the process's statistics and updates the registered metrics.
+func (pm *ProcessMetrics) Capture() {
+	pm.uptime.Update(time.Since(processStart).Seconds())
+	if nil == pm.cpu {
+		return
+	}
+	if s, ok := readProcessStats(); ok {
+		pm.cpu.Update(s.cpuSeconds)
+		pm.rss.Update(s.rssBytes)
+		pm.fds.Update(s.openFDs)
+	}
+}
+
+// CaptureEvery calls Capture every d until stop is closed.  This is designed
+// to be called as a goroutine.
+func (pm *ProcessMetrics) CaptureEvery(d time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(d)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			pm.Capture()
+		case <-stop:
+			return
+		}
+	}
+}
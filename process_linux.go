@@ -0,0 +1,46 @@
+package metrics
+
+import (
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// readProcessStats reads the process's statistics from getrusage(2) and
+// /proc/self.
+func readProcessStats() (processStats, bool) {
+	var s processStats
+	var ru syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &ru); nil != err {
+		return s, false
+	}
+	s.cpuSeconds = timevalSeconds(ru.Utime) + timevalSeconds(ru.Stime)
+
+	// statm's second field is the resident set size in pages.
+	b, err := ioutil.ReadFile("/proc/self/statm")
+	if nil != err {
+		return s, false
+	}
+	fields := strings.Fields(string(b))
+	if len(fields) < 2 {
+		return s, false
+	}
+	pages, err := strconv.ParseInt(fields[1], 10, 64)
+	if nil != err {
+		return s, false
+	}
+	s.rssBytes = pages * int64(os.Getpagesize())
+
+	fds, err := ioutil.ReadDir("/proc/self/fd")
+	if nil != err {
+		return s, false
+	}
+	s.openFDs = int64(len(fds))
+	return s, true
+}
+
+func timevalSeconds(tv syscall.Timeval) float64 {
+	return float64(tv.Sec) + float64(tv.Usec)/1e6
+}
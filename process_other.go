@@ -0,0 +1,7 @@
+//go:build !linux
+// +build !linux
+
+package metrics
+
+// readProcessStats reports that the process's statistics aren't available.
+func readProcessStats() (processStats, bool) { return processStats{}, false }
@@ -0,0 +1,35 @@
+package metrics
+
+import (
+	"os"
+	"runtime"
+	"testing"
+)
+
+func TestProcessMetrics(t *testing.T) {
+	r := NewRegistry()
+	pm := RegisterProcessMetrics(r)
+	pm.Capture()
+	if u := r.Get("process.uptime.seconds").(GaugeFloat64).Value(); u <= 0 {
+		t.Errorf("uptime: 0 >= %v\n", u)
+	}
+	if "linux" != runtime.GOOS {
+		if nil != r.Get("process.cpu.seconds") {
+			t.Error("process.cpu.seconds is registered")
+		}
+		return
+	}
+	if rss := r.Get("process.resident_memory.bytes").(Gauge).Value(); rss <= 0 {
+		t.Errorf("rss: 0 >= %v\n", rss)
+	}
+	before := r.Get("process.open_fds").(Gauge).Value()
+	f, err := os.Open(os.DevNull)
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	pm.Capture()
+	if after := r.Get("process.open_fds").(Gauge).Value(); before+1 != after {
+		t.Errorf("open fds: %v != %v\n", before+1, after)
+	}
+}
@@ -0,0 +1,502 @@
+// Package prometheus serves the metrics in a go-metrics Registry in the
+// Prometheus text exposition format, or in OpenMetrics, so that Prometheus can
+// scrape them, and pushes them to a Pushgateway for jobs it can't scrape.
+package prometheus
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+// ContentType is the media type of the text exposition format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// OpenMetricsContentType is the media type of the OpenMetrics text format.
+const OpenMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+// DefaultQuantiles are the quantiles of histograms and timers exported unless
+// Config.Quantiles says otherwise.
+var DefaultQuantiles = []float64{0.5, 0.75, 0.95, 0.99, 0.999}
+
+// DefaultConsumerHeader is the request header by which a handler in
+// metrics.MetadataOnChange mode tells its consumers apart unless
+// Config.ConsumerHeader says otherwise.
+const DefaultConsumerHeader = "X-Metrics-Consumer"
+
+// Config configures the exposition of a registry.
+type Config struct {
+	Registry  metrics.Registry // Registry to be exported
+	Namespace string           // Prefix for every metric name, joined with an underscore
+	Quantiles []float64        // Quantiles of histograms and timers, defaulting to DefaultQuantiles
+
+	// MetadataMode selects when # TYPE lines are written, defaulting to
+	// metrics.MetadataAlways, as Prometheus expects of each scrape.  With
+	// metrics.MetadataOnChange a handler writes them only to consumers which
+	// haven't been sent them yet or were sent different ones, telling
+	// consumers apart by the value of their ConsumerHeader; a request
+	// without one is sent all of them.  WriteOnce, which keeps no state,
+	// always writes them.
+	MetadataMode metrics.MetadataMode
+
+	// ConsumerHeader names the request header identifying consumers in
+	// metrics.MetadataOnChange mode, defaulting to DefaultConsumerHeader.
+	ConsumerHeader string
+
+	// OpenMetrics selects the OpenMetrics text format, in which counter
+	// samples are suffixed _total and the exposition ends with "# EOF".
+	// Handlers also serve it to scrapers which accept it.
+	OpenMetrics bool
+
+	// Buckets and TimerBuckets, if set, are the upper bounds of buckets,
+	// timers' in seconds, into which histograms and timers are exported as
+	// histograms rather than as summaries.  Bucket counts are estimated from
+	// each metric's sample; see HistogramSnapshot.Buckets.  Those whose
+	// sample is a metrics.BucketSample are always exported as histograms,
+	// with its own buckets and their exact counts.
+	Buckets      []float64
+	TimerBuckets []float64
+
+	// CounterExemplar, if set, is asked for an exemplar of each counter and
+	// meter, by its registered name, to attach to its sample in OpenMetrics,
+	// e.g. the trace ID of the request which last incremented it, with
+	// the exemplar's value that of the increment.  Timers
+	// exported as histograms attach the exemplars they keep to their
+	// buckets without it.
+	CounterExemplar func(name string) (metrics.Exemplar, bool)
+
+	// metadata tracks the # TYPE lines sent to each consumer, consumer's
+	// among them, in metrics.MetadataOnChange mode.
+	metadata *metrics.MetadataTracker
+	consumer string
+
+	// created holds when a handler first served each series.
+	created *createdTimes
+}
+
+// Handler returns an http.Handler which serves every metric in r.
+func Handler(r metrics.Registry) http.Handler {
+	return HandlerWithConfig(Config{Registry: r})
+}
+
+// HandlerWithConfig returns an http.Handler which serves every metric in
+// c.Registry as configured.
+//
+// In OpenMetrics, each counter, summary and histogram has a _created sample
+// of when the handler first served it, so that Prometheus can tell a counter
+// which reset from one which started over with a new process.
+func HandlerWithConfig(c Config) http.Handler {
+	if metrics.MetadataOnChange == c.MetadataMode {
+		c.metadata = metrics.NewMetadataTracker(0)
+	}
+	if "" == c.ConsumerHeader {
+		c.ConsumerHeader = DefaultConsumerHeader
+	}
+	c.created = &createdTimes{times: make(map[string]time.Time)}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		c := c
+		c.consumer = req.Header.Get(c.ConsumerHeader)
+		if strings.Contains(req.Header.Get("Accept"), "application/openmetrics-text") {
+			c.OpenMetrics = true
+		}
+		if c.OpenMetrics {
+			if "" != c.consumer {
+				c.consumer += " openmetrics"
+			}
+			w.Header().Set("Content-Type", OpenMetricsContentType)
+		} else {
+			w.Header().Set("Content-Type", ContentType)
+		}
+		WriteOnce(c, w)
+	})
+}
+
+// WriteOnce writes every metric in c.Registry to w in the text exposition
+// format.
+//
+// Counters and meters become counters, gauges become gauges, and histograms
+// and timers become summaries of the configured quantiles, or histograms of
+// the configured buckets; timers are in seconds.  Healthchecks become gauges
+// named with the suffix _healthy, 1 if healthy as of their last check and 0
+// if not.  Metric and label names are sanitized, replacing invalid characters
+// with underscores, and the tags in each registered name, including the
+// registry's default tags, become labels.  If sanitized names collide between
+// metrics of different types, the series of all but the first type are
+// dropped.
+func WriteOnce(c Config, w io.Writer) error {
+	quantiles := c.Quantiles
+	if nil == quantiles {
+		quantiles = DefaultQuantiles
+	}
+	now := time.Now()
+	seen := make(map[string]bool)
+	families := make(map[string]*family)
+	c.Registry.EachSnapshot(func(registered string, i interface{}) {
+		name, tags := metrics.SplitTaggedName(registered)
+		if "" != c.Namespace {
+			name = c.Namespace + "_" + name
+		}
+		name = sanitizeName(name)
+		s := series{labels: labelPairs(tags)}
+		var typ string
+		switch metric := i.(type) {
+		case metrics.Counter:
+			typ = "counter"
+			name = counterName(&c, name, registered, &s, float64(metric.Count()))
+		case metrics.CounterFloat64:
+			typ = "counter"
+			name = counterName(&c, name, registered, &s, metric.Count())
+		case metrics.Gauge:
+			typ = "gauge"
+			s.add(name, "", float64(metric.Value()))
+		case metrics.GaugeFloat64:
+			typ = "gauge"
+			s.add(name, "", metric.Value())
+		case metrics.MergeableGaugeFloat64:
+			typ = "gauge"
+			s.add(name, "", metric.Value())
+		case metrics.Histogram:
+			if bounds := metrics.BucketBounds(metric); nil != bounds {
+				typ = "histogram"
+				s.addHistogram(&c, name, bounds, 1, metric.(bucketer).Buckets(bounds), float64(metric.Sum()), metric.Count(), nil)
+				break
+			}
+			if b, ok := metric.(bucketer); ok && nil != c.Buckets {
+				typ = "histogram"
+				s.addHistogram(&c, name, c.Buckets, 1, b.Buckets(c.Buckets), float64(metric.Sum()), metric.Count(), nil)
+				break
+			}
+			typ = "summary"
+			quantiles := metrics.MetricPercentiles(quantiles, metric)
+			s.addSummary(name, quantiles, metric.Percentiles(quantiles), float64(metric.Sum()), metric.Count())
+		case metrics.Meter:
+			typ = "counter"
+			name = counterName(&c, name, registered, &s, float64(metric.Count()))
+		case metrics.Timer:
+			if bounds := metrics.BucketBounds(metric); nil != bounds {
+				typ = "histogram"
+				seconds := make([]float64, len(bounds))
+				for i, bound := range bounds {
+					seconds[i] = bound / float64(time.Second)
+				}
+				s.addHistogram(&c, name, seconds, float64(time.Second), metric.(bucketer).Buckets(bounds), float64(metric.Sum()), metric.Count(), metric.Exemplars())
+				break
+			}
+			if b, ok := metric.(bucketer); ok && nil != c.TimerBuckets {
+				typ = "histogram"
+				bounds := make([]float64, len(c.TimerBuckets))
+				for i, bound := range c.TimerBuckets {
+					bounds[i] = bound * float64(time.Second)
+				}
+				s.addHistogram(&c, name, c.TimerBuckets, float64(time.Second), b.Buckets(bounds), float64(metric.Sum()), metric.Count(), metric.Exemplars())
+				break
+			}
+			typ = "summary"
+			quantiles := metrics.MetricPercentiles(quantiles, metric)
+			ps := metric.Percentiles(quantiles)
+			for i := range ps {
+				ps[i] /= float64(time.Second)
+			}
+			s.addSummary(name, quantiles, ps, float64(metric.Sum())/float64(time.Second), metric.Count())
+		case metrics.Healthcheck:
+			typ = "gauge"
+			name += "_healthy"
+			if nil == metric.Error() {
+				s.add(name, "", 1)
+			} else {
+				s.add(name, "", 0)
+			}
+		default:
+			return
+		}
+		if c.OpenMetrics && nil != c.created && "gauge" != typ {
+			key := name + "{" + strings.Join(s.labels, ",") + "}"
+			seen[key] = true
+			s.add(name+"_created", "", float64(c.created.get(key, now).UnixNano())/1e9)
+		}
+		f, ok := families[name]
+		if !ok {
+			f = &family{typ: typ}
+			families[name] = f
+		}
+		if f.typ == typ {
+			f.series = append(f.series, s)
+		}
+	})
+	if nil != c.created {
+		c.created.forget(seen)
+	}
+
+	names := make([]string, 0, len(families))
+	for name := range families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var sent, metadata map[string]string
+	if nil != c.metadata && "" != c.consumer {
+		sent = c.metadata.Sent(c.consumer)
+		metadata = make(map[string]string, len(names))
+	}
+	b := bufio.NewWriter(w)
+	for _, name := range names {
+		f := families[name]
+		sort.Sort(bySeriesLabels(f.series))
+		meta := "# TYPE " + name + " " + f.typ + "\n"
+		if nil == metadata || sent[name] != meta {
+			b.WriteString(meta)
+		}
+		if nil != metadata {
+			metadata[name] = meta
+		}
+		for _, s := range f.series {
+			for _, line := range s.lines {
+				b.WriteString(line)
+			}
+		}
+	}
+	if c.OpenMetrics {
+		b.WriteString("# EOF\n")
+	}
+	if err := b.Flush(); nil != err {
+		if nil != metadata {
+			c.metadata.Forget(c.consumer)
+		}
+		return err
+	}
+	if nil != metadata {
+		c.metadata.Set(c.consumer, metadata)
+	}
+	return nil
+}
+
+// WriteFile writes every metric in c.Registry to the named file, replacing it
+// atomically so that readers such as node_exporter's textfile collector never
+// see it half written.
+func WriteFile(c Config, path string) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if nil != err {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if err := WriteOnce(c, f); nil != err {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); nil != err {
+		return err
+	}
+	if err := os.Chmod(f.Name(), 0644); nil != err {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// counterName adds the sample of a counter to s and returns the name of its
+// family.  OpenMetrics names the family without the _total suffix its samples
+// carry, and may attach an exemplar to them.
+func counterName(c *Config, name, registered string, s *series, v float64) string {
+	if !c.OpenMetrics {
+		s.add(name, "", v)
+		return name
+	}
+	name = strings.TrimSuffix(name, "_total")
+	var exemplar string
+	if nil != c.CounterExemplar {
+		if e, ok := c.CounterExemplar(registered); ok {
+			exemplar = formatExemplar(e, 1)
+		}
+	}
+	s.addLine(name+"_total", "", v, exemplar)
+	return name
+}
+
+// bucketer is implemented by histogram and timer snapshots.
+type bucketer interface {
+	Buckets([]float64) []uint64
+}
+
+// formatExemplar renders an exemplar as OpenMetrics appends it to a sample,
+// its value divided by unit.
+func formatExemplar(e metrics.Exemplar, unit float64) string {
+	s := ` # {trace_id="` + escapeLabelValue(e.TraceID) + `"} ` + formatValue(float64(e.Value)/unit)
+	if !e.Timestamp.IsZero() {
+		s += " " + strconv.FormatFloat(float64(e.Timestamp.UnixNano()/1e6)/1e3, 'f', 3, 64)
+	}
+	return s
+}
+
+// createdTimes remembers when a handler first served each series.
+type createdTimes struct {
+	mutex sync.Mutex
+	times map[string]time.Time
+}
+
+// get returns when the series was first served, which is now if it wasn't
+// before.
+func (c *createdTimes) get(key string, now time.Time) time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	t, ok := c.times[key]
+	if !ok {
+		t = now
+		c.times[key] = t
+	}
+	return t
+}
+
+// forget forgets the series which weren't seen, e.g. because they expired,
+// so that a series registered again later is created anew.
+func (c *createdTimes) forget(seen map[string]bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for key := range c.times {
+		if !seen[key] {
+			delete(c.times, key)
+		}
+	}
+}
+
+// A family is every series with one metric name.
+type family struct {
+	typ    string
+	series []series
+}
+
+// A series is the sample lines of one registered metric.
+type series struct {
+	labels []string // rendered name="value" pairs, sorted
+	lines  []string
+}
+
+func (s *series) add(name, extraLabel string, v float64) {
+	s.addLine(name, extraLabel, v, "")
+}
+
+// addLine adds a sample followed by the rendered exemplar, if any.
+func (s *series) addLine(name, extraLabel string, v float64, exemplar string) {
+	labels := s.labels
+	if "" != extraLabel {
+		labels = append(append([]string(nil), labels...), extraLabel)
+	}
+	line := name
+	if 0 != len(labels) {
+		line += "{" + strings.Join(labels, ",") + "}"
+	}
+	s.lines = append(s.lines, line+" "+formatValue(v)+exemplar+"\n")
+}
+
+func (s *series) addSummary(name string, quantiles, values []float64, sum float64, count int64) {
+	for i, q := range quantiles {
+		s.add(name, `quantile="`+formatValue(q)+`"`, values[i])
+	}
+	s.add(name+"_sum", "", sum)
+	s.add(name+"_count", "", float64(count))
+}
+
+// addHistogram adds the samples of a histogram of the given cumulative bucket
+// counts, whose bounds and sum are divided by unit.  In OpenMetrics each
+// bucket carries the most recent of the exemplars which fell in it.
+func (s *series) addHistogram(c *Config, name string, bounds []float64, unit float64, buckets []uint64, sum float64, count int64, exemplars []metrics.Exemplar) {
+	var prev uint64
+	for i, bound := range bounds {
+		// Estimated counts mustn't go down from one bucket to the next.
+		n := buckets[i]
+		if n < prev {
+			n = prev
+		}
+		prev = n
+		var exemplar string
+		if c.OpenMetrics {
+			exemplar = bucketExemplar(exemplars, bounds, i, unit)
+		}
+		s.addLine(name+"_bucket", `le="`+formatValue(bound)+`"`, float64(n), exemplar)
+	}
+	var exemplar string
+	if c.OpenMetrics {
+		exemplar = bucketExemplar(exemplars, bounds, len(bounds), unit)
+	}
+	s.addLine(name+"_bucket", `le="+Inf"`, float64(count), exemplar)
+	s.add(name+"_sum", "", sum/unit)
+	s.add(name+"_count", "", float64(count))
+}
+
+// bucketExemplar renders the most recent exemplar above bounds[i-1] and at or
+// below bounds[i], or the last bound if i is past it.
+func bucketExemplar(exemplars []metrics.Exemplar, bounds []float64, i int, unit float64) string {
+	for j := len(exemplars) - 1; j >= 0; j-- {
+		v := float64(exemplars[j].Value) / unit
+		if (0 == i || v > bounds[i-1]) && (len(bounds) == i || v <= bounds[i]) {
+			return formatExemplar(exemplars[j], unit)
+		}
+	}
+	return ""
+}
+
+type bySeriesLabels []series
+
+func (s bySeriesLabels) Len() int      { return len(s) }
+func (s bySeriesLabels) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s bySeriesLabels) Less(i, j int) bool {
+	return strings.Join(s[i].labels, ",") < strings.Join(s[j].labels, ",")
+}
+
+// labelPairs renders tags as sorted, sanitized and escaped label pairs.
+func labelPairs(tags map[string]string) []string {
+	pairs := make([]string, 0, len(tags))
+	for k, v := range tags {
+		pairs = append(pairs, sanitizeLabelName(k)+`="`+escapeLabelValue(v)+`"`)
+	}
+	sort.Strings(pairs)
+	return pairs
+}
+
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// sanitizeName makes name a valid metric name, matching
+// [a-zA-Z_:][a-zA-Z0-9_:]*.
+func sanitizeName(name string) string {
+	return sanitize(name, true)
+}
+
+// sanitizeLabelName makes name a valid label name, matching
+// [a-zA-Z_][a-zA-Z0-9_]*.
+func sanitizeLabelName(name string) string {
+	return sanitize(name, false)
+}
+
+func sanitize(name string, colons bool) string {
+	if "" == name {
+		return "_"
+	}
+	b := []byte(name)
+	for i, c := range b {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9', '_' == c:
+		case ':' == c && colons:
+		default:
+			b[i] = '_'
+		}
+	}
+	if '0' <= b[0] && b[0] <= '9' {
+		return "_" + string(b)
+	}
+	return string(b)
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabelValue(v string) string {
+	return labelValueEscaper.Replace(v)
+}
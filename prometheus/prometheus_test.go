@@ -0,0 +1,344 @@
+package prometheus
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+func TestWriteOnce(t *testing.T) {
+	r := metrics.NewRegistry()
+	c := metrics.NewCounter()
+	c.(metrics.Taggable).AddTags(map[string]string{"endpoint": "/users"})
+	c.Inc(3)
+	r.Register("http.requests", c)
+	c = metrics.NewCounter()
+	c.(metrics.Taggable).AddTags(map[string]string{"endpoint": "/groups"})
+	c.Inc(2)
+	r.Register("http.requests", c)
+	metrics.NewRegisteredGauge("queue-depth", r).Update(7)
+	metrics.NewRegisteredGaugeFloat64("temperature", r).Update(21.5)
+	h := metrics.NewRegisteredHistogram("size", r, metrics.NewUniformSample(100))
+	for i := int64(1); i <= 4; i++ {
+		h.Update(i)
+	}
+	metrics.NewRegisteredTimer("latency", r).Update(2 * time.Second)
+
+	var b bytes.Buffer
+	if err := WriteOnce(Config{Registry: r, Quantiles: []float64{0.5}}, &b); nil != err {
+		t.Fatal(err)
+	}
+	want := `# TYPE http_requests counter
+http_requests{endpoint="/groups"} 2
+http_requests{endpoint="/users"} 3
+# TYPE latency summary
+latency{quantile="0.5"} 2
+latency_sum 2
+latency_count 1
+# TYPE queue_depth gauge
+queue_depth 7
+# TYPE size summary
+size{quantile="0.5"} 2.5
+size_sum 10
+size_count 4
+# TYPE temperature gauge
+temperature 21.5
+`
+	if got := b.String(); want != got {
+		t.Errorf("WriteOnce(): want %q != %q\n", want, got)
+	}
+}
+
+func TestWriteOnceHealthchecks(t *testing.T) {
+	r := metrics.NewRegistry()
+	metrics.NewRegisteredHealthcheck("db", r, func(h metrics.Healthcheck) { h.Healthy() }).Check()
+	metrics.NewRegisteredHealthcheck("cache", r, func(h metrics.Healthcheck) {
+		h.Unhealthy(errors.New("down"))
+	}).Check()
+
+	var b bytes.Buffer
+	if err := WriteOnce(Config{Registry: r}, &b); nil != err {
+		t.Fatal(err)
+	}
+	want := `# TYPE cache_healthy gauge
+cache_healthy 0
+# TYPE db_healthy gauge
+db_healthy 1
+`
+	if got := b.String(); want != got {
+		t.Errorf("WriteOnce(): want %q != %q\n", want, got)
+	}
+}
+
+func TestWriteOnceCounterFloat64(t *testing.T) {
+	r := metrics.NewRegistry()
+	metrics.GetOrRegisterCounterFloat64T("revenue", map[string]string{"currency": "eur"}, r).Inc(9.5)
+
+	var b bytes.Buffer
+	if err := WriteOnce(Config{Registry: r}, &b); nil != err {
+		t.Fatal(err)
+	}
+	want := `# TYPE revenue counter
+revenue{currency="eur"} 9.5
+`
+	if got := b.String(); want != got {
+		t.Errorf("WriteOnce(): want %q != %q\n", want, got)
+	}
+}
+
+func TestWriteOnceDefaultTagsAndNamespace(t *testing.T) {
+	r := metrics.NewRegistry()
+	r.(*metrics.StandardRegistry).SetDefaultTags(map[string]string{"host": "a"})
+	metrics.NewRegisteredCounter("hits", r).Inc(1)
+	var b bytes.Buffer
+	WriteOnce(Config{Registry: r, Namespace: "app"}, &b)
+	if want, got := "# TYPE app_hits counter\napp_hits{host=\"a\"} 1\n", b.String(); want != got {
+		t.Errorf("WriteOnce(): want %q != %q\n", want, got)
+	}
+}
+
+func TestWriteOnceLiveTags(t *testing.T) {
+	r := metrics.NewRegistry()
+	c := metrics.GetOrRegisterCounterT("req", map[string]string{"a": "1"}, r)
+	c.Inc(1)
+	c.(metrics.Taggable).SetTags(map[string]string{"a": "2", "b": "3"})
+	var b bytes.Buffer
+	if err := WriteOnce(Config{Registry: r}, &b); nil != err {
+		t.Fatal(err)
+	}
+	if want := "# TYPE req counter\nreq{a=\"2\",b=\"3\"} 1\n"; want != b.String() {
+		t.Errorf("body: %q != %q\n", want, b.String())
+	}
+}
+
+func TestWriteOnceTypeConflict(t *testing.T) {
+	r := metrics.NewRegistry()
+	metrics.NewRegisteredCounter("a.b", r).Inc(1)
+	metrics.NewRegisteredGauge("a_b", r).Update(2)
+	var b bytes.Buffer
+	WriteOnce(Config{Registry: r}, &b)
+	if n := strings.Count(b.String(), "# TYPE a_b "); 1 != n {
+		t.Errorf("strings.Count(): 1 != %v\n%s", n, b.String())
+	}
+}
+
+func TestHandler(t *testing.T) {
+	r := metrics.NewRegistry()
+	metrics.NewRegisteredCounter("hits", r).Inc(1)
+	w := httptest.NewRecorder()
+	Handler(r).ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := w.Header().Get("Content-Type"); ContentType != ct {
+		t.Errorf("Content-Type: %v != %v\n", ContentType, ct)
+	}
+	if want, got := "# TYPE hits counter\nhits 1\n", w.Body.String(); want != got {
+		t.Errorf("body: want %q != %q\n", want, got)
+	}
+}
+
+func TestHandlerMetadataOnChange(t *testing.T) {
+	r := metrics.NewRegistry()
+	metrics.NewRegisteredCounter("hits", r).Inc(1)
+	h := HandlerWithConfig(Config{Registry: r, MetadataMode: metrics.MetadataOnChange})
+	scrape := func(consumer string) string {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/metrics", nil)
+		if "" != consumer {
+			req.Header.Set(DefaultConsumerHeader, consumer)
+		}
+		h.ServeHTTP(w, req)
+		return w.Body.String()
+	}
+	if want, body := "# TYPE hits counter\nhits 1\n", scrape("a"); want != body {
+		t.Errorf("first scrape: %q != %q\n", want, body)
+	}
+	metrics.NewRegisteredGauge("depth", r).Update(2)
+	if want, body := "# TYPE depth gauge\ndepth 2\nhits 1\n", scrape("a"); want != body {
+		t.Errorf("second scrape: %q != %q\n", want, body)
+	}
+	if want, body := "# TYPE depth gauge\ndepth 2\n# TYPE hits counter\nhits 1\n", scrape("b"); want != body {
+		t.Errorf("another consumer's scrape: %q != %q\n", want, body)
+	}
+	if want, body := "# TYPE depth gauge\ndepth 2\n# TYPE hits counter\nhits 1\n", scrape(""); want != body {
+		t.Errorf("an unidentified consumer's scrape: %q != %q\n", want, body)
+	}
+	r.Unregister("depth")
+	r.Register("depth", metrics.NewCounter())
+	if want, body := "# TYPE depth counter\ndepth 0\nhits 1\n", scrape("a"); want != body {
+		t.Errorf("scrape after a change of type: %q != %q\n", want, body)
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	for _, c := range []struct{ in, name, label string }{
+		{"a.b-c", "a_b_c", "a_b_c"},
+		{"ns:sub", "ns:sub", "ns_sub"},
+		{"9lives", "_9lives", "_9lives"},
+		{"", "_", "_"},
+	} {
+		if got := sanitizeName(c.in); c.name != got {
+			t.Errorf("sanitizeName(%q): %v != %v\n", c.in, c.name, got)
+		}
+		if got := sanitizeLabelName(c.in); c.label != got {
+			t.Errorf("sanitizeLabelName(%q): %v != %v\n", c.in, c.label, got)
+		}
+	}
+	if want, got := `a\"b\\c\nd`, escapeLabelValue("a\"b\\c\nd"); want != got {
+		t.Errorf("escapeLabelValue(): %v != %v\n", want, got)
+	}
+}
+
+func TestWriteOnceOpenMetrics(t *testing.T) {
+	r := metrics.NewRegistry()
+	metrics.NewRegisteredCounter("hits", r).Inc(1)
+	metrics.NewRegisteredCounter("errors_total", r).Inc(2)
+	var b bytes.Buffer
+	WriteOnce(Config{Registry: r, OpenMetrics: true}, &b)
+	want := "# TYPE errors counter\nerrors_total 2\n# TYPE hits counter\nhits_total 1\n# EOF\n"
+	if got := b.String(); want != got {
+		t.Errorf("WriteOnce(): want %q != %q\n", want, got)
+	}
+}
+
+func TestWriteOnceBuckets(t *testing.T) {
+	r := metrics.NewRegistry()
+	h := metrics.NewRegisteredHistogram("size", r, metrics.NewUniformSample(100))
+	for i := int64(1); i <= 4; i++ {
+		h.Update(i)
+	}
+	var b bytes.Buffer
+	WriteOnce(Config{Registry: r, Buckets: []float64{2, 3}}, &b)
+	want := `# TYPE size histogram
+size_bucket{le="2"} 2
+size_bucket{le="3"} 3
+size_bucket{le="+Inf"} 4
+size_sum 10
+size_count 4
+`
+	if got := b.String(); want != got {
+		t.Errorf("WriteOnce(): want %q != %q\n", want, got)
+	}
+}
+
+func TestWriteOnceBucketSample(t *testing.T) {
+	r := metrics.NewRegistry()
+	h := metrics.NewRegisteredHistogram("size", r, metrics.NewBucketSample([]float64{1, 5}))
+	for _, v := range []int64{1, 4, 9} {
+		h.Update(v)
+	}
+	tm := metrics.NewTimerWithSample(metrics.NewBucketSample([]float64{float64(time.Millisecond)}))
+	r.Register("latency", tm)
+	tm.Update(2 * time.Millisecond)
+	var b bytes.Buffer
+	WriteOnce(Config{Registry: r}, &b)
+	got := b.String()
+	for _, want := range []string{
+		"size_bucket{le=\"1\"} 1\n",
+		"size_bucket{le=\"5\"} 2\n",
+		"size_bucket{le=\"+Inf\"} 3\n",
+		"size_sum 14\n",
+		"latency_bucket{le=\"0.001\"} 0\n",
+		"latency_bucket{le=\"+Inf\"} 1\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("WriteOnce(): %q doesn't contain %q\n", got, want)
+		}
+	}
+}
+
+type traceKey struct{}
+
+func TestWriteOnceExemplars(t *testing.T) {
+	r := metrics.NewRegistry()
+	tm := metrics.NewTimerWithExemplars(metrics.ExemplarConfig{ContextKey: traceKey{}})
+	r.Register("latency", tm)
+	tm.TimeContextWithExemplar(context.WithValue(context.Background(), traceKey{}, "abc"), func() { time.Sleep(time.Millisecond) })
+	metrics.NewRegisteredCounter("hits", r).Inc(1)
+	at := time.Unix(100, 500e6)
+	c := Config{
+		Registry:     r,
+		OpenMetrics:  true,
+		TimerBuckets: []float64{0.0001, 10},
+		CounterExemplar: func(name string) (metrics.Exemplar, bool) {
+			return metrics.Exemplar{TraceID: "def", Value: 1, Timestamp: at}, "hits" == name
+		},
+	}
+	var b bytes.Buffer
+	WriteOnce(c, &b)
+	got := b.String()
+	for _, want := range []string{
+		"hits_total 1 # {trace_id=\"def\"} 1 100.500\n",
+		"latency_bucket{le=\"0.0001\"} 0\n",
+		"latency_bucket{le=\"10\"} 1 # {trace_id=\"abc\"} 0.",
+		"latency_bucket{le=\"+Inf\"} 1\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("WriteOnce(): %q doesn't contain %q\n", got, want)
+		}
+	}
+}
+
+func TestHandlerCreated(t *testing.T) {
+	r := metrics.NewRegistry()
+	metrics.NewRegisteredCounter("hits", r).Inc(1)
+	metrics.NewRegisteredGauge("depth", r).Update(1)
+	h := Handler(r)
+	scrape := func() string {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/metrics", nil)
+		req.Header.Set("Accept", "application/openmetrics-text")
+		h.ServeHTTP(w, req)
+		return w.Body.String()
+	}
+	first := scrape()
+	if !strings.Contains(first, "\nhits_created ") || strings.Contains(first, "depth_created") {
+		t.Errorf("body: %q\n", first)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if second := scrape(); first != second {
+		t.Errorf("body: %q != %q\n", first, second)
+	}
+}
+
+func TestHandlerNegotiatesOpenMetrics(t *testing.T) {
+	r := metrics.NewRegistry()
+	metrics.NewRegisteredCounter("hits", r).Inc(1)
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	req.Header.Set("Accept", "application/openmetrics-text; version=1.0.0,text/plain;q=0.5")
+	Handler(r).ServeHTTP(w, req)
+	if ct := w.Header().Get("Content-Type"); OpenMetricsContentType != ct {
+		t.Errorf("Content-Type: %v != %v\n", OpenMetricsContentType, ct)
+	}
+	if !strings.HasSuffix(w.Body.String(), "# EOF\n") {
+		t.Errorf("body: %q\n", w.Body.String())
+	}
+}
+
+func TestWriteFile(t *testing.T) {
+	r := metrics.NewRegistry()
+	metrics.NewRegisteredCounter("hits", r).Inc(1)
+	path := filepath.Join(t.TempDir(), "metrics.prom")
+	for i := 0; i < 2; i++ {
+		if err := WriteFile(Config{Registry: r, OpenMetrics: true}, path); nil != err {
+			t.Fatal(err)
+		}
+	}
+	b, err := ioutil.ReadFile(path)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if want := "# TYPE hits counter\nhits_total 1\n# EOF\n"; want != string(b) {
+		t.Errorf("file: %q != %q\n", want, b)
+	}
+	if entries, _ := ioutil.ReadDir(filepath.Dir(path)); 1 != len(entries) {
+		t.Errorf("entries: %v\n", entries)
+	}
+}
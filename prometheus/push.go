@@ -0,0 +1,147 @@
+package prometheus
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+// PushConfig configures pushing a registry to a Pushgateway.
+type PushConfig struct {
+	Config // Exposition of the registry; Config.OpenMetrics is ignored
+
+	URL      string            // Base URL of the Pushgateway, e.g. http://localhost:9091
+	Job      string            // Job label of the group pushed to
+	Grouping map[string]string // Further labels of the group pushed to
+	Interval time.Duration     // Push interval of Pusher
+	Client   *http.Client      // Nil means http.DefaultClient
+
+	OnError func(error)              // Called with each error of Pusher, which logs it if nil
+	Metrics *metrics.ReporterMetrics // Records each PushOnce
+
+	// Schedule aligns and jitters the pushes of Pusher within Interval.
+	Schedule metrics.FlushSchedule
+}
+
+// Push replaces the metrics of the group of the given job and grouping labels
+// on the Pushgateway at the given URL with every metric in r, for batch jobs
+// which finish before Prometheus could scrape them.
+func Push(r metrics.Registry, job string, groupingLabels map[string]string, url string) error {
+	return PushOnce(PushConfig{Config: Config{Registry: r}, URL: url, Job: job, Grouping: groupingLabels})
+}
+
+// PushOnce replaces the metrics of the configured group with every metric in
+// c.Registry, rendered in the text exposition format as WriteOnce renders
+// them.
+func PushOnce(c PushConfig) error {
+	return c.Metrics.Flush(func() error { return pushOnce(c) })
+}
+
+func pushOnce(c PushConfig) error {
+	u, err := pushURL(&c)
+	if nil != err {
+		return err
+	}
+	c.OpenMetrics = false
+	if nil != c.metadata {
+		c.consumer = u
+	}
+	var body bytes.Buffer
+	if err := WriteOnce(c.Config, &body); nil != err {
+		return err
+	}
+	req, err := http.NewRequest("PUT", u, &body)
+	if nil != err {
+		return err
+	}
+	req.Header.Set("Content-Type", ContentType)
+	client := c.Client
+	if nil == client {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if nil != err {
+		c.forgetMetadata()
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		c.forgetMetadata()
+		return fmt.Errorf("Pushgateway push failed: %s %s", resp.Status, bytes.TrimSpace(respBody))
+	}
+	return nil
+}
+
+// Pusher is a blocking exporter function which pushes every metric in
+// c.Registry every c.Interval, passing errors to c.OnError, or logging them,
+// until c.Registry is closed.  It then pushes once more, so that a batch job
+// which closes its registry as it finishes leaves its final values behind.
+// In metrics.MetadataOnChange mode it sends # TYPE lines only while the group
+// lacks them, as of its last successful push.
+func Pusher(c PushConfig) {
+	PusherContext(context.Background(), c)
+}
+
+// PusherContext is Pusher until ctx is done, when it pushes once more too.
+func PusherContext(ctx context.Context, c PushConfig) {
+	if metrics.MetadataOnChange == c.MetadataMode {
+		c.metadata = metrics.NewMetadataTracker(0)
+	}
+	c.Schedule.Run(c.Interval, ctx.Done(), metrics.Closed(c.Registry), func(time.Time) {
+		metrics.ReportError(c.OnError, PushOnce(c))
+	})
+	metrics.ReportError(c.OnError, PushOnce(c))
+}
+
+// forgetMetadata forgets the metadata of a push which failed, which the
+// Pushgateway may not have received.
+func (c *PushConfig) forgetMetadata() {
+	if nil != c.metadata {
+		c.metadata.Forget(c.consumer)
+	}
+}
+
+// pushURL returns the URL of the configured group, each label as a pair of
+// path segments, the job's first and then the others sorted by name.
+func pushURL(c *PushConfig) (string, error) {
+	if "" == c.Job {
+		return "", errors.New("Pushgateway push needs a job")
+	}
+	path := "/metrics/job" + pathLabel(c.Job)
+	names := make([]string, 0, len(c.Grouping))
+	for name := range c.Grouping {
+		if "job" == name {
+			return "", errors.New("Pushgateway grouping labels can't include job")
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		path += "/" + sanitizeLabelName(name) + pathLabel(c.Grouping[name])
+	}
+	return strings.TrimSuffix(c.URL, "/") + path, nil
+}
+
+// pathLabel renders a label value as a path segment.  Values which are empty
+// or contain slashes are base64-encoded, as the Pushgateway expects, and the
+// label name is marked with @base64.
+func pathLabel(v string) string {
+	if "" == v {
+		return "@base64/="
+	}
+	if strings.Contains(v, "/") {
+		return "@base64/" + base64.URLEncoding.EncodeToString([]byte(v))
+	}
+	return "/" + url.PathEscape(v)
+}
@@ -0,0 +1,108 @@
+package prometheus
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+func TestPush(t *testing.T) {
+	var method, path, body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		b, _ := ioutil.ReadAll(req.Body)
+		method, path, body = req.Method, req.URL.EscapedPath(), string(b)
+	}))
+	defer server.Close()
+	r := metrics.NewRegistry()
+	metrics.NewRegisteredCounter("rows", r).Inc(3)
+	if err := Push(r, "etl", map[string]string{"instance": "a b", "path": "/tmp/x", "empty": ""}, server.URL+"/"); nil != err {
+		t.Fatal(err)
+	}
+	if "PUT" != method {
+		t.Errorf("method: PUT != %v\n", method)
+	}
+	if want := "/metrics/job/etl/empty@base64/=/instance/a%20b/path@base64/L3RtcC94"; want != path {
+		t.Errorf("path: %v != %v\n", want, path)
+	}
+	if want := "# TYPE rows counter\nrows 3\n"; want != body {
+		t.Errorf("body: %q != %q\n", want, body)
+	}
+}
+
+func TestPushErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.Error(w, "bad metrics", http.StatusBadRequest)
+	}))
+	defer server.Close()
+	r := metrics.NewRegistry()
+	if err := Push(r, "", nil, server.URL); nil == err {
+		t.Error("Push() without a job: want error\n")
+	}
+	if err := Push(r, "etl", map[string]string{"job": "x"}, server.URL); nil == err {
+		t.Error("Push() grouped by job: want error\n")
+	}
+	if err := Push(r, "etl", nil, server.URL); nil == err || "Pushgateway push failed: 400 Bad Request bad metrics" != err.Error() {
+		t.Errorf("Push(): %v\n", err)
+	}
+}
+
+func TestPusherPushesOnClose(t *testing.T) {
+	pushes := make(chan string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		b, _ := ioutil.ReadAll(req.Body)
+		pushes <- string(b)
+	}))
+	defer server.Close()
+	r := metrics.NewRegistry()
+	c := metrics.NewRegisteredCounter("rows", r)
+	done := make(chan struct{})
+	go func() {
+		Pusher(PushConfig{Config: Config{Registry: r}, URL: server.URL, Job: "etl", Interval: time.Hour})
+		close(done)
+	}()
+	c.Inc(5)
+	r.Close()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Pusher still running")
+	}
+	if want, got := "# TYPE rows counter\nrows 5\n", <-pushes; want != got {
+		t.Errorf("push: %q != %q\n", want, got)
+	}
+}
+
+func TestPushMetadataOnChange(t *testing.T) {
+	var bodies []string
+	fail := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		b, _ := ioutil.ReadAll(req.Body)
+		bodies = append(bodies, string(b))
+		if fail {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+	r := metrics.NewRegistry()
+	metrics.NewRegisteredCounter("rows", r).Inc(3)
+	c := PushConfig{Config: Config{Registry: r, MetadataMode: metrics.MetadataOnChange}, URL: server.URL, Job: "etl"}
+	c.metadata = metrics.NewMetadataTracker(0)
+	if err := PushOnce(c); nil == err {
+		t.Fatal("PushOnce(): want error\n")
+	}
+	fail = false
+	for i := 0; i < 2; i++ {
+		if err := PushOnce(c); nil != err {
+			t.Fatal(err)
+		}
+	}
+	want := []string{"# TYPE rows counter\nrows 3\n", "# TYPE rows counter\nrows 3\n", "rows 3\n"}
+	if !reflect.DeepEqual(want, bodies) {
+		t.Errorf("bodies: %q != %q\n", want, bodies)
+	}
+}
@@ -0,0 +1,81 @@
+package metrics
+
+// A Countable is any metric with a count, e.g. a Counter, Meter, Histogram or
+// Timer.
+type Countable interface {
+	Count() int64
+}
+
+// GetOrRegisterRatioGauge returns an existing GaugeFloat64 or constructs and
+// registers a new RatioGauge of the given metrics.  The metrics are only kept
+// if the gauge is new.
+func GetOrRegisterRatioGauge(name string, r Registry, numerator, denominator Countable) GaugeFloat64 {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	return getOrRegister(r, name, func() GaugeFloat64 { return NewRatioGauge(numerator, denominator) }, NilGaugeFloat64{}).(GaugeFloat64)
+}
+
+// GetOrRegisterRatioGaugeT returns the existing GaugeFloat64 identified by
+// name and tags together or constructs and registers a new RatioGauge
+// carrying the tags; see GetOrRegisterCounterT.
+func GetOrRegisterRatioGaugeT(name string, tags map[string]string, r Registry, numerator, denominator Countable) GaugeFloat64 {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	return getOrRegisterTagged(r, name, tags, func() interface{} { return NewRatioGauge(numerator, denominator) }, NilGaugeFloat64{}).(GaugeFloat64)
+}
+
+// NewRatioGauge constructs a new RatioGauge of the given metrics.
+func NewRatioGauge(numerator, denominator Countable) GaugeFloat64 {
+	if useNilMetrics() {
+		return NilGaugeFloat64{}
+	}
+	return &RatioGauge{numerator: numerator, denominator: denominator}
+}
+
+// NewRegisteredRatioGauge constructs and registers a new RatioGauge of the
+// given metrics.
+func NewRegisteredRatioGauge(name string, r Registry, numerator, denominator Countable) GaugeFloat64 {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	if usesNilMetrics(r) {
+		return NilGaugeFloat64{}
+	}
+	g := NewRatioGauge(numerator, denominator)
+	r.Register(name, g)
+	return g
+}
+
+// RatioGauge is a GaugeFloat64 whose value is the ratio of the counts of two
+// metrics, e.g. of errors to requests, worked out whenever it's read or
+// snapshotted so that dashboards needn't each divide one series by another.
+// The ratio is zero while the denominator's count is, rather than NaN, which
+// some reporters can't encode.  The counts of meters and timers are totals
+// since they started; for a ratio of recent rates, divide their Rate1s in a
+// FunctionalGaugeFloat64.
+type RatioGauge struct {
+	tagSet
+
+	numerator, denominator Countable
+}
+
+// Snapshot returns a read-only copy of the gauge.
+func (g *RatioGauge) Snapshot() GaugeFloat64 {
+	return GaugeFloat64Snapshot{value: g.Value(), timestamp: now()}
+}
+
+// Update panics.
+func (*RatioGauge) Update(float64) {
+	panic("Update called on a RatioGauge")
+}
+
+// Value returns the ratio of the numerator's count to the denominator's.
+func (g *RatioGauge) Value() float64 {
+	denominator := g.denominator.Count()
+	if 0 == denominator {
+		return 0
+	}
+	return float64(g.numerator.Count()) / float64(denominator)
+}
@@ -0,0 +1,50 @@
+package metrics
+
+import "testing"
+
+func TestRatioGauge(t *testing.T) {
+	errors, requests := NewCounter(), NewCounter()
+	g := NewRatioGauge(errors, requests)
+	if v := g.Value(); 0 != v {
+		t.Errorf("g.Value(): 0 != %v\n", v)
+	}
+	requests.Inc(4)
+	errors.Inc(1)
+	if v := g.Value(); 0.25 != v {
+		t.Errorf("g.Value(): 0.25 != %v\n", v)
+	}
+	snapshot := g.Snapshot()
+	errors.Inc(1)
+	if v := snapshot.Value(); 0.25 != v {
+		t.Errorf("snapshot.Value(): 0.25 != %v\n", v)
+	}
+	if v := g.Value(); 0.5 != v {
+		t.Errorf("g.Value(): 0.5 != %v\n", v)
+	}
+}
+
+func TestGetOrRegisterRatioGaugeT(t *testing.T) {
+	r := NewRegistry()
+	m, n := NewMeter(), NewMeter()
+	defer m.Stop()
+	defer n.Stop()
+	tags := map[string]string{"service": "users"}
+	g := GetOrRegisterRatioGaugeT("error_ratio", tags, r, m, n)
+	m.Mark(1)
+	n.Mark(2)
+	if v := r.Get("error_ratio;service=users").(GaugeFloat64).Value(); 0.5 != v {
+		t.Errorf("Value(): 0.5 != %v\n", v)
+	}
+	if g2 := GetOrRegisterRatioGaugeT("error_ratio", tags, r, n, m); g2 != g {
+		t.Error(g2)
+	}
+	var found bool
+	r.EachSnapshot(func(name string, i interface{}) {
+		if "error_ratio;service=users" == name {
+			found = 0.5 == i.(GaugeFloat64).Value()
+		}
+	})
+	if !found {
+		t.Error("snapshot not found")
+	}
+}
@@ -3,19 +3,72 @@ package metrics
 import (
 	"fmt"
 	"reflect"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
-// DuplicateMetric is the error returned by Registry.Register when a metric
-// already exists.  If you mean to Register that metric you must first
-// Unregister the existing metric.
+// DuplicateMetric names a metric which already exists.  Registries return a
+// *DuplicateMetricError, which errors.Is matches to the DuplicateMetric of its
+// name, or to DuplicateMetric("") whatever its name.
 type DuplicateMetric string
 
 func (err DuplicateMetric) Error() string {
 	return fmt.Sprintf("duplicate metric: %s", string(err))
 }
 
+// DuplicateMetricError is the error returned by Registry.Register and Alias
+// when a metric is already registered by the name, which includes any tags.
+// If you mean to Register that metric you must first Unregister the existing
+// metric.
+type DuplicateMetricError struct {
+	Name     string      // The name, including tags, in the form TaggedName returns
+	Existing interface{} // The metric already registered by the name
+}
+
+// Error names the metric and the type of the one already registered.
+func (err *DuplicateMetricError) Error() string {
+	return fmt.Sprintf("duplicate metric: %s, already registered as a %s", err.Name, err.Type())
+}
+
+// Is returns true if target is the DuplicateMetric of the error's name or
+// DuplicateMetric("").
+func (err *DuplicateMetricError) Is(target error) bool {
+	d, ok := target.(DuplicateMetric)
+	return ok && ("" == d || string(d) == err.Name)
+}
+
+// Type returns the type of the metric already registered, e.g.
+// "*metrics.StandardCounter".
+func (err *DuplicateMetricError) Type() string {
+	return fmt.Sprintf("%T", err.Existing)
+}
+
+// An Action tells EachAndUpdate what to do with the metric just visited.
+type Action int
+
+const (
+	// ActionKeep leaves the metric as it is.
+	ActionKeep Action = iota
+
+	// ActionUnregister unregisters the metric, as Unregister does.
+	ActionUnregister
+
+	// ActionClear resets the metric with its Clear method, e.g. a counter
+	// or histogram.  Metrics without one are left as they are.
+	ActionClear
+)
+
+// UnknownMetric is the error returned by Registry.Alias when no metric is
+// registered under the existing name.
+type UnknownMetric string
+
+func (err UnknownMetric) Error() string {
+	return fmt.Sprintf("unknown metric: %s", string(err))
+}
+
 // A Registry holds references to a set of metrics by name and can iterate
 // over them, calling callback functions provided by the user.
 //
@@ -23,132 +76,1414 @@ func (err DuplicateMetric) Error() string {
 // the Registry API as appropriate.
 type Registry interface {
 
+	// Unregister all metrics, stopping those with tickers.
+	Clear()
+
+	// Register the metric registered under the first name under the second
+	// name, too.
+	Alias(string, string) error
+
+	// Return the change in count of each counter, histogram, meter and timer
+	// since the last call with the given consumer ID.
+	Delta(string) map[string]int64
+
+	// Stop the registry's background goroutines, the reporters of it and
+	// every registered metric which is Stoppable, leaving the metrics
+	// registered.
+	Close()
+
 	// Call the given function for each registered metric.
 	Each(func(string, interface{}))
 
-	// Get the metric by the given name or nil if none is registered.
+	// Call the given function for each registered metric and apply the
+	// Action it returns before moving on to the next.
+	EachAndUpdate(func(string, interface{}) Action)
+
+	// Call the given function with a read-only snapshot of each registered
+	// metric, all taken before the function is first called.
+	EachSnapshot(func(string, interface{}))
+
+	// Get the metric by the given name, which includes any tags, or nil if
+	// none is registered.
 	Get(string) interface{}
 
+	// Return the values of every registered metric by field, such as
+	// "count", "95%" or "1m.rate", keyed by name, as MarshalJSON renders
+	// them.
+	GetAll() map[string]map[string]interface{}
+
 	// Gets an existing metric or registers the given one.
 	// The interface can be the metric to register if not found in registry,
 	// or a function returning the metric for lazy instantiation.
 	GetOrRegister(string, interface{}) interface{}
 
-	// Register the given metric under the given name.
+	// Register the given metric under the given name and the metric's tags.
 	Register(string, interface{}) error
 
+	// Reset every registered metric which accumulates values, leaving them
+	// registered.
+	ResetAll()
+
 	// Run all registered healthchecks.
 	RunHealthchecks()
 
-	// Unregister the metric with the given name.
+	// Return read-only snapshots of every registered metric by name.
+	Snapshot() *RegistrySnapshot
+
+	// Return a registry of snapshots of every metric, resetting those which
+	// accumulate values.
+	SnapshotAndReset() Registry
+
+	// Create a child registry whose metrics carry the given tags, along
+	// with a function which unregisters everything created through it.
+	SubRegistryWithTags(map[string]string) (Registry, func())
+
+	// Deliver an event for each metric whose name the given function
+	// matches whenever its value changes, comparing values at the given
+	// interval and buffering the given number of events.
+	Subscribe(func(string) bool, time.Duration, int) *Subscription
+
+	// Unregister the metric with the given name, stopping its ticker unless
+	// it's still registered under an alias.
 	Unregister(string)
 
-	// Unregister all metrics.  (Mostly for testing.)
+	// Unregister all metrics, stopping those with tickers.
 	UnregisterAll()
+
+	// Unregister the metric with the given name and all its aliases,
+	// stopping its ticker.
+	UnregisterWithAliases(string)
 }
 
 // The standard implementation of a Registry is a mutex-protected map
-// of names to metrics.
+// of names to metrics.  Get and GetOrRegister read a copy of the map kept in
+// a sync.Map instead, so looking up a metric which is already registered,
+// the common case on hot paths, never waits for the mutex.
+//
+// Metrics are identified by name and tags together, so two counters named
+// "requests" tagged endpoint=a and endpoint=b are distinct series.  The
+// registry keys each metric by its TaggedName, combining the name it was
+// registered under with the tags it had at the time, and passes that to Each.
+// Names given to Get, Unregister and the like may carry tags in the same form,
+// in any order, e.g. "requests;endpoint=a".  Tags added to a metric after it's
+// registered don't change its identity.
 type StandardRegistry struct {
-	metrics map[string]interface{}
-	mutex   sync.Mutex
+	metrics    map[string]interface{}
+	lookup     atomic.Value                   // *sync.Map mirroring metrics, see load
+	aliases    map[string]map[string]struct{} // names sharing a metric
+	mutex      sync.Mutex
+	deltas     map[string]map[string]int64 // last counts by consumer ID
+	deltaTimes map[string]deltaTime        // last calls by consumer ID
+	deltaMutex sync.Mutex
+	nilMetrics int32        // atomic boolean
+	sharded    int32        // atomic boolean, see SetUseShardedCounters
+	defaults   atomic.Value // Tags, see SetDefaultTags
+	sanitizer  atomic.Value // *TagSanitizer, see SetTagSanitizer
+	pcts       atomic.Value // []float64, see SetPercentiles
+	onUnreg    atomic.Value // func(string, interface{}), see SetOnUnregister
+	ttlMutex   sync.Mutex
+	ttlDone    chan struct{} // closed to stop sweeping, see SetTTL
+	closeOnce  sync.Once
+	closed     chan struct{} // see Close
+
+	seriesLimit int            // see SetSeriesLimit
+	series      map[string]int // series by base name, if limited
+
+	disabledBy []MetricSelector       // see Disable
+	disabled   map[string]interface{} // metrics swapped for stubs by key
+
+	hooks []RegisterHook // see OnRegister
 }
 
 // Create a new registry.
 func NewRegistry() Registry {
-	return &StandardRegistry{metrics: make(map[string]interface{})}
+	r := &StandardRegistry{
+		metrics: make(map[string]interface{}),
+		closed:  make(chan struct{}),
+	}
+	r.lookup.Store(&sync.Map{})
+	return r
+}
+
+// Alias registers the metric registered as existingName as aliasName, too, so
+// that both names report the same live metric, e.g. to rename a metric without
+// a gap in its data.  Returns an UnknownMetric if no metric is registered as
+// existingName and a *DuplicateMetricError if a metric is already registered
+// as aliasName.  Unregistering either name leaves the other intact; use
+// UnregisterWithAliases to remove them all.
+func (r *StandardRegistry) Alias(existingName, aliasName string) error {
+	existingName, aliasName = r.key(existingName), r.key(aliasName)
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	i, ok := r.metrics[existingName]
+	if !ok {
+		return UnknownMetric(existingName)
+	}
+	if existing, ok := r.metrics[aliasName]; ok {
+		return &DuplicateMetricError{Name: aliasName, Existing: existing}
+	}
+	r.set(aliasName, i)
+	r.countSeries(aliasName, 1)
+	if nil == r.aliases {
+		r.aliases = make(map[string]map[string]struct{})
+	}
+	names := r.aliases[existingName]
+	if nil == names {
+		names = map[string]struct{}{existingName: struct{}{}}
+		r.aliases[existingName] = names
+	}
+	names[aliasName] = struct{}{}
+	r.aliases[aliasName] = names
+	return nil
+}
+
+// Clear unregisters every metric, stopping the tickers of meters, timers and
+// windowed histograms first so they can be garbage collected, e.g. between
+// tests.  Concurrent calls to Each and Get see either all the metrics or none.
+// Metrics which are also registered elsewhere are stopped, too.
+func (r *StandardRegistry) Clear() {
+	r.UnregisterAll()
+}
+
+// Close stops the registry's TTL sweeper, the reporters in this package which
+// report it or a child of it, and every registered metric which is Stoppable,
+// such as windowed histograms, so that short-lived programs and tests leave
+// no goroutines behind.  The metrics stay registered and readable, for a last
+// flush.  Metrics registered after Close aren't stopped, and SetTTL doesn't
+// start sweeping again.  Closing a registry more than once is a no-op.
+func (r *StandardRegistry) Close() {
+	r.ttlMutex.Lock()
+	r.closeOnce.Do(func() { close(r.closed) })
+	r.ttlMutex.Unlock()
+	r.SetTTL(0)
+	for _, i := range r.registered() {
+		stopMetric(i)
+	}
+}
+
+// Closed returns a channel which is closed when the registry is; see Closed.
+func (r *StandardRegistry) Closed() <-chan struct{} { return r.closed }
+
+// Delta returns the change in count of each counter, histogram, meter and
+// timer since the last call with the same consumer ID, so that several delta
+// exporters can share one registry without each keeping track of previous
+// values.  The first call for a consumer ID returns the counts themselves, as
+// do calls for metrics registered since the consumer's previous call.  The
+// bookkeeping for a consumer only begins with its first call.
+func (r *StandardRegistry) Delta(consumerID string) map[string]int64 {
+	r.deltaMutex.Lock()
+	defer r.deltaMutex.Unlock()
+	counts := make(map[string]int64)
+	s := getEachScratch()
+	defer s.release()
+	s.names, s.metrics = r.appendRegistered(s.names, s.metrics)
+	for i, name := range s.names {
+		if count, ok := cumulativeCount(s.metrics[i]); ok {
+			counts[name] = count
+		}
+	}
+	if nil == r.deltas {
+		r.deltas = make(map[string]map[string]int64)
+		r.deltaTimes = make(map[string]deltaTime)
+	}
+	t := now()
+	var elapsed time.Duration
+	if last, ok := r.deltaTimes[consumerID]; ok {
+		elapsed = t.Sub(last.at)
+	}
+	r.deltaTimes[consumerID] = deltaTime{at: t, elapsed: elapsed}
+	last := r.deltas[consumerID]
+	deltas := make(map[string]int64, len(counts))
+	for name, count := range counts {
+		deltas[name] = count - last[name]
+	}
+	r.deltas[consumerID] = counts
+	return deltas
+}
+
+// deltaTime records when a consumer last called Delta and how long after its
+// call before that was, zero for its first.
+type deltaTime struct {
+	at      time.Time
+	elapsed time.Duration
+}
+
+// lastDelta returns the deltaTime of the consumer's last call to Delta of the
+// StandardRegistry at the root of r.  ok is false if it hasn't called it or r
+// isn't built on a StandardRegistry.
+func lastDelta(r Registry, consumerID string) (last deltaTime, ok bool) {
+	root := standardRegistryOf(r)
+	if nil == root {
+		return deltaTime{}, false
+	}
+	root.deltaMutex.Lock()
+	defer root.deltaMutex.Unlock()
+	last, ok = root.deltaTimes[consumerID]
+	return
+}
+
+// Call the given function for each registered metric.
+func (r *StandardRegistry) Each(f func(string, interface{})) {
+	s := getEachScratch()
+	defer s.release()
+	s.names, s.metrics = r.appendRegistered(s.names, s.metrics)
+	for i, name := range s.names {
+		f(name, s.metrics[i])
+	}
+}
+
+// EachAndUpdate calls f for each registered metric and applies the Action it
+// returns, holding the registry's lock across both so that nothing registers,
+// unregisters or replaces that metric in between, e.g. to unregister counters
+// which have gone stale.  Metrics registered during the sweep may or may not
+// be visited.  f must not call methods of the registry.
+func (r *StandardRegistry) EachAndUpdate(f func(string, interface{}) Action) {
+	var removed []removal
+	for name := range r.registered() {
+		if m, ok := r.update(name, f); ok {
+			removed = append(removed, m)
+		}
+	}
+	r.removed(removed...)
+}
+
+// EachSnapshot calls f with a read-only snapshot of each registered metric, so
+// that a reporter sees every metric as it was at one point in time however
+// long it takes to report them.  The snapshots are all taken before f is first
+// called, and no lock is held while f runs, so f may use the registry.
+// Healthchecks and metrics of types defined outside this package are passed
+// as they are.
+func (r *StandardRegistry) EachSnapshot(f func(string, interface{})) {
+	eachSnapshot(r, f)
+}
+
+// GetAll returns the values of every registered metric by field, keyed by
+// name, with the default tags merged in.
+func (r *StandardRegistry) GetAll() map[string]map[string]interface{} {
+	return getAll(r.EachSnapshot, RegistryPercentiles(r))
+}
+
+// Get the metric by the given name or nil if none is registered.
+func (r *StandardRegistry) Get(name string) interface{} {
+	i, _ := r.load(r.key(name))
+	return i
+}
+
+// Gets an existing metric or creates and registers a new one. Threadsafe
+// alternative to calling Get and Register on failure.
+// The interface can be the metric to register if not found in registry,
+// or a function returning the metric for lazy instantiation.
+// If the metric constructed has tags of its own, an existing metric with the
+// same name and those tags is returned instead; to avoid constructing a metric
+// only to discard it, put the tags in the name.
+func (r *StandardRegistry) GetOrRegister(name string, i interface{}) interface{} {
+	name = r.key(name)
+	if metric, ok := r.load(name); ok {
+		return metric
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if metric, ok := r.metrics[name]; ok {
+		return metric
+	}
+	if overflow, _, ok := r.overflow(name); ok {
+		if metric, ok := r.metrics[overflow]; ok {
+			r.dropSeries(baseName(name))
+			return metric
+		}
+	}
+	constructed := false
+	if v := reflect.ValueOf(i); v.Kind() == reflect.Func {
+		i = v.Call(nil)[0].Interface()
+		constructed = true
+	}
+	if metric, ok := r.metrics[r.key(tagsOf(i).Name(name))]; ok {
+		return metric
+	}
+	if metric, kept, _ := r.register(name, i); nil != metric {
+		// Redirected to an existing overflow series, or to an existing
+		// metric by a name a hook gave it, so nothing else will stop
+		// what was constructed.  A disabled metric, or a hook's
+		// replacement for one, is kept.
+		if constructed && !kept {
+			stopMetric(i)
+		}
+		return metric
+	}
+	return i
+}
+
+// Register the given metric under the given name and the metric's tags.
+// Returns a *DuplicateMetricError if a metric by the same name and tags is
+// already registered.
+func (r *StandardRegistry) Register(name string, i interface{}) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	_, _, err := r.register(name, i)
+	return err
+}
+
+// ResetAll resets every metric which accumulates values so that measurement
+// starts afresh, e.g. between the phases of a soak test, leaving them all
+// registered.  Counters, histograms, MergeableGaugeFloat64s and PeakGauges are
+// cleared, and meters and timers reset, rates and all, as though they were
+// new.  Gauges and healthchecks are left as they are.  Unlike
+// SnapshotAndReset, nothing is copied first.
+//
+// Note that Delta reports negative changes for metrics which have been reset.
+func (r *StandardRegistry) ResetAll() {
+	r.Each(resetMetric)
+}
+
+// Run all registered healthchecks.
+func (r *StandardRegistry) RunHealthchecks() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, i := range r.metrics {
+		if h, ok := i.(Healthcheck); ok {
+			h.Check()
+		}
+	}
+}
+
+// Snapshot returns a read-only snapshot of every registered metric, keyed by
+// the names EachSnapshot would pass, from one consistent view of what's
+// registered.  Each metric's tags are read at once, so no snapshot carries a
+// half-updated tag set.
+func (r *StandardRegistry) Snapshot() *RegistrySnapshot {
+	return newRegistrySnapshot(r)
+}
+
+// SnapshotAndReset returns a new registry holding a read-only copy of every
+// metric under the same name, and resets those metrics which accumulate values
+// so that the next interval starts afresh.  Each metric is copied and reset at
+// once so no update is lost.
+//
+// Counters, histograms (including the histograms underlying timers) and
+// MergeableGaugeFloat64s are reset.  Gauges, meters and the meters underlying
+// timers are copied but not reset.  Healthchecks are included as they are.
+// Resetting metrics of types defined outside this package relies on their
+// Clear method, so updates between the copy and the reset may be lost.
+//
+// Note that Delta reports negative changes for metrics which have been reset.
+func (r *StandardRegistry) SnapshotAndReset() Registry {
+	return snapshotAndResetEach(r)
+}
+
+// SubRegistryWithTags returns a child registry whose metrics carry the given
+// tags and are registered in r, and a function which unregisters every metric
+// registered through the child.  See NewTaggedSubRegistry.
+func (r *StandardRegistry) SubRegistryWithTags(tags map[string]string) (Registry, func()) {
+	return NewTaggedSubRegistry(r, tags)
+}
+
+// DefaultTags returns a copy of the tags set by SetDefaultTags.
+func (r *StandardRegistry) DefaultTags() map[string]string {
+	return r.defaultTags().Map()
+}
+
+// SetDefaultTags replaces the registry's default tags, e.g. host, region and
+// service, which EachSnapshot merges into the name of every metric it passes.
+// A metric's own tags take precedence.  The metrics themselves and their
+// identity in the registry are unaffected, so default tags may be changed at
+// any time.
+func (r *StandardRegistry) SetDefaultTags(tags map[string]string) {
+	if s := r.tagSanitizer(); nil != s {
+		mode := s.Mode
+		if TagReject == mode {
+			mode = TagDrop
+		}
+		tags, _ = s.sanitize(tags, mode)
+	}
+	r.defaults.Store(NewTags(tags))
+}
+
+// SetTagSanitizer makes the registry validate and normalize the tags of every
+// metric registered from now on, and of default tags set from now on, with s,
+// or stop if s is nil.  Tags become part of a metric's identity when it's
+// registered, so the sanitizer sees the tags a metric has then, including
+// those in the name it's registered under; call SetTagSanitizer before
+// registering anything.  Names given to Get, Unregister and the like are
+// sanitized the same way.  If s rejects invalid tags, Register returns an
+// InvalidTag, GetOrRegister returns the metric without registering it, and
+// SetDefaultTags drops the invalid tags.
+func (r *StandardRegistry) SetTagSanitizer(s *TagSanitizer) {
+	r.sanitizer.Store(s)
+}
+
+// Percentiles returns a copy of the percentiles set by SetPercentiles, or of
+// DefaultPercentiles if none are.
+func (r *StandardRegistry) Percentiles() []float64 {
+	return append([]float64(nil), r.percentiles()...)
+}
+
+// SetPercentiles sets the percentiles of histograms and timers which the
+// exporters in this package report of the registry and its children, in the
+// given order, unless they're configured with percentiles of their own.  Nil
+// restores DefaultPercentiles.  Each percentile must lie in the interval
+// [0, 1].
+func (r *StandardRegistry) SetPercentiles(ps []float64) error {
+	for _, p := range ps {
+		if p < 0 || p > 1 {
+			return fmt.Errorf("metrics: percentile %v out of range [0, 1]", p)
+		}
+	}
+	if nil != ps {
+		ps = append([]float64{}, ps...)
+	}
+	r.pcts.Store(ps)
+	return nil
+}
+
+// ReplaceWithNilMetrics replaces every registered metric with a stub so that
+// code which looks its metrics up in the registry stops collecting.  Metrics
+// already held by callers are unaffected.
+func (r *StandardRegistry) ReplaceWithNilMetrics() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	lookup := &sync.Map{}
+	for name, i := range r.metrics {
+		r.metrics[name] = nilMetric(i)
+		lookup.Store(name, r.metrics[name])
+	}
+	r.lookup.Store(lookup)
+	r.disabled = nil
+}
+
+// SetUseNilMetrics switches the GetOrRegister* and NewRegistered* constructors
+// to return stubs for this registry, without registering them, or back again.
+// Metrics already registered keep collecting; see ReplaceWithNilMetrics.  The
+// global UseNilMetrics and SetUseNilMetrics take precedence if either is true.
+func (r *StandardRegistry) SetUseNilMetrics(use bool) {
+	var v int32
+	if use {
+		v = 1
+	}
+	atomic.StoreInt32(&r.nilMetrics, v)
+}
+
+// UseNilMetrics reports whether the registry has been switched to nil metrics
+// by SetUseNilMetrics.
+func (r *StandardRegistry) UseNilMetrics() bool {
+	return 1 == atomic.LoadInt32(&r.nilMetrics)
+}
+
+// SetUseShardedCounters switches GetOrRegisterCounter and NewRegisteredCounter
+// for this registry to constructing ShardedCounters, or back to
+// StandardCounters.  Counters already registered are unaffected.
+func (r *StandardRegistry) SetUseShardedCounters(use bool) {
+	var v int32
+	if use {
+		v = 1
+	}
+	atomic.StoreInt32(&r.sharded, v)
+}
+
+// UseShardedCounters reports whether the registry has been switched to
+// ShardedCounters by SetUseShardedCounters.
+func (r *StandardRegistry) UseShardedCounters() bool {
+	return 1 == atomic.LoadInt32(&r.sharded)
+}
+
+// Unregister the metric with the given name, stopping its ticker if it's a
+// meter, timer or the like, unless it's still registered under an alias.  Any
+// aliases remain registered.
+func (r *StandardRegistry) Unregister(name string) {
+	name = r.key(name)
+	r.mutex.Lock()
+	_, ok := r.metrics[name]
+	m := r.unregister(name)
+	r.mutex.Unlock()
+	if ok {
+		r.removed(m)
+	}
+}
+
+// unregister removes the metric with the given name and its entry among the
+// aliases.  It must be called with r.mutex held.
+func (r *StandardRegistry) unregister(name string) removal {
+	i, ok := r.metrics[name]
+	if !ok {
+		return removal{}
+	}
+	m := removal{name: name, metric: r.original(name, i), stop: true}
+	r.del(name)
+	r.countSeries(name, -1)
+	if names, ok := r.aliases[name]; ok {
+		delete(names, name)
+		delete(r.aliases, name)
+		m.stop = 0 == len(names)
+		if 1 == len(names) {
+			for other := range names {
+				delete(r.aliases, other)
+			}
+		}
+	}
+	return m
+}
+
+// Unregister all metrics, stopping those with tickers.  (Mostly for testing.)
+func (r *StandardRegistry) UnregisterAll() {
+	r.mutex.Lock()
+	removed := make([]removal, 0, len(r.metrics))
+	for name, i := range r.metrics {
+		removed = append(removed, removal{name: name, metric: r.original(name, i), stop: true})
+		delete(r.metrics, name)
+	}
+	r.lookup.Store(&sync.Map{})
+	r.aliases = nil
+	r.disabled = nil
+	r.recountSeries()
+	r.mutex.Unlock()
+	r.removed(removed...)
+}
+
+// Unregister the metric with the given name and every alias of it, stopping
+// its ticker if it has one.
+func (r *StandardRegistry) UnregisterWithAliases(name string) {
+	name = r.key(name)
+	r.mutex.Lock()
+	names := []string{name}
+	for other := range r.aliases[name] {
+		if other != name {
+			names = append(names, other)
+		}
+	}
+	var removed []removal
+	for _, name := range names {
+		if i, ok := r.metrics[name]; ok {
+			removed = append(removed, removal{name: name, metric: r.original(name, i), stop: true})
+			r.del(name)
+			r.countSeries(name, -1)
+		}
+		delete(r.aliases, name)
+	}
+	r.mutex.Unlock()
+	r.removed(removed...)
+}
+
+// SetOnUnregister sets a function called with the name and metric of every
+// metric unregistered from now on, however it's unregistered, e.g. so that a
+// reporter can tell its backend the series has gone, or nil to stop.  It's
+// called once per name, aliases included, after the metric is unregistered
+// and stopped, and with no lock held, so it may use the registry.
+func (r *StandardRegistry) SetOnUnregister(f func(string, interface{})) {
+	r.onUnreg.Store(f)
+}
+
+// SetTTL makes the registry unregister, as Unregister does, every metric not
+// updated within the given time to live, so that series tagged with values
+// such as user IDs don't accumulate forever, or stops it expiring metrics if
+// ttl is zero.  Registering a metric counts as an update.  A goroutine sweeps
+// the registry every quarter of the TTL, so metrics are unregistered between
+// one and one and a half TTLs after their last update.  Functional gauges and
+// healthchecks, which aren't updated, never expire.
+//
+// Code holding a metric it got from the registry keeps updating it after it's
+// expired, unseen by reporters, so expiring registries suit metrics looked up
+// with GetOrRegister on each use, which registers a new one as needed.
+func (r *StandardRegistry) SetTTL(ttl time.Duration) {
+	r.ttlMutex.Lock()
+	defer r.ttlMutex.Unlock()
+	if nil != r.ttlDone {
+		close(r.ttlDone)
+		r.ttlDone = nil
+	}
+	if ttl <= 0 {
+		return
+	}
+	select {
+	case <-r.closed:
+		return
+	default:
+	}
+	advanceClock(now())
+	for _, i := range r.registered() {
+		touchMetric(i)
+	}
+	r.ttlDone = make(chan struct{})
+	go r.sweep(ttl, ttl/4, tick(ttl/4), r.ttlDone)
+}
+
+// SetSeriesLimit limits the number of series registered under each name, each
+// with different tags, to protect backends from tags with unbounded values,
+// or lifts the limit if n is zero.  A series registered beyond the limit
+// becomes its name's overflow series instead, whose tags all have the value
+// OverflowTagValue, and GetOrRegister returns the overflow series once there
+// is one, so that their updates are aggregated.  Overflow series don't count
+// against the limit, so unregistering a series makes room for another.  Register returns no error
+// for a metric redirected to an existing overflow series, but doesn't
+// register it.  Each redirection increments a counter registered under
+// SeriesDroppedName tagged with the name.
+func (r *StandardRegistry) SetSeriesLimit(n int) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if n < 0 {
+		n = 0
+	}
+	r.seriesLimit = n
+	r.recountSeries()
+}
+
+// A removal is a metric unregistered under a name, which is stopped unless
+// it's still registered under another.
+type removal struct {
+	name   string
+	metric interface{}
+	stop   bool
+}
+
+// removed forgets the deltas of metrics just unregistered, stops them and
+// passes them to the function set by SetOnUnregister.  It must be called
+// without r.mutex held.
+func (r *StandardRegistry) removed(removed ...removal) {
+	if 0 == len(removed) {
+		return
+	}
+	names := make([]string, len(removed))
+	for i, m := range removed {
+		names[i] = m.name
+		if m.stop {
+			stopMetric(m.metric)
+		}
+	}
+	r.forgetDeltas(names...)
+	if f, _ := r.onUnreg.Load().(func(string, interface{})); nil != f {
+		for _, m := range removed {
+			f(m.name, m.metric)
+		}
+	}
+}
+
+// forgetDeltas drops the last counts recorded by Delta for the given names so
+// that a metric registered under the same name later starts from zero.  It
+// must be called without r.mutex held.
+func (r *StandardRegistry) forgetDeltas(names ...string) {
+	r.deltaMutex.Lock()
+	defer r.deltaMutex.Unlock()
+	for _, counts := range r.deltas {
+		for _, name := range names {
+			delete(counts, name)
+		}
+	}
+}
+
+// update calls f for the metric registered under the given name, if it still
+// is, and applies the Action returned.  It reports whether the metric was
+// unregistered.
+func (r *StandardRegistry) update(name string, f func(string, interface{}) Action) (removal, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	i, ok := r.metrics[name]
+	if !ok {
+		return removal{}, false
+	}
+	switch f(name, i) {
+	case ActionUnregister:
+		return r.unregister(name), true
+	case ActionClear:
+		if c, ok := i.(interface {
+			Clear()
+		}); ok {
+			c.Clear()
+		}
+	}
+	return removal{}, false
+}
+
+// register registers the given metric, or what the hooks set by OnRegister
+// replace it with, under the TaggedName of the given name and its tags.  It
+// returns the overflow series instead if the metric was redirected to one
+// already registered, see SetSeriesLimit, or its stub, having kept the metric
+// registered, if it's disabled, see Disable, or the hooks' replacement,
+// having kept that.  On a DuplicateMetricError it returns the existing
+// metric.  It must be called with r.mutex held.
+func (r *StandardRegistry) register(name string, i interface{}) (interface{}, bool, error) {
+	name = tagsOf(i).Name(name)
+	var replacement interface{}
+	if 0 != len(r.hooks) {
+		var err error
+		if name, i, err = r.runHooks(name, i); nil != err {
+			return nil, false, err
+		}
+		name, replacement = tagsOf(i).Name(name), i
+	}
+	if s := r.tagSanitizer(); nil != s {
+		var err error
+		if name, err = s.sanitizeName(name); nil != err {
+			return nil, false, err
+		}
+	}
+	if existing, ok := r.metrics[name]; ok {
+		return existing, false, &DuplicateMetricError{Name: name, Existing: existing}
+	}
+	if overflow, tags, ok := r.overflow(name); ok {
+		r.dropSeries(baseName(name))
+		if metric, ok := r.metrics[overflow]; ok {
+			return metric, false, nil
+		}
+		if t, ok := i.(Taggable); ok {
+			t.AddTags(tags)
+		}
+		name = overflow
+	}
+	switch i.(type) {
+	case Counter, CounterFloat64, Gauge, GaugeFloat64, Healthcheck, Histogram, Meter, MergeableGaugeFloat64, Timer:
+		touchMetric(i)
+		if m, ok := i.(interface{ markRegistered() }); ok {
+			m.markRegistered()
+		}
+		r.set(name, i)
+		r.countSeries(name, 1)
+		if r.disables(name) {
+			return r.disable(name, i), true, nil
+		}
+	}
+	return replacement, nil != replacement, nil
+}
+
+// Stoppable is implemented by metrics and reporters which run in the
+// background, e.g. on a ticker, and can be stopped so that they can be garbage
+// collected.  Registries stop the Stoppable metrics they unregister, or all of
+// them when they're closed.  Stop must be safe to call more than once.
+type Stoppable interface {
+	Stop()
+}
+
+// stopMetric stops a metric which is Stoppable.
+func stopMetric(i interface{}) {
+	if s, ok := i.(Stoppable); ok {
+		s.Stop()
+	}
+}
+
+// Closed returns a channel which is closed once r, or the registry r is a
+// child or a view of, is closed, so that reporters can stop then.  It returns
+// nil, which is never closed, for registries which can't be closed.
+func Closed(r Registry) <-chan struct{} {
+	switch r := r.(type) {
+	case interface{ Closed() <-chan struct{} }:
+		return r.Closed()
+	case *PrefixedRegistry:
+		return Closed(r.underlying)
+	case *TaggedSubRegistry:
+		return Closed(r.underlying)
+	case *MappedRegistry:
+		return Closed(r.Registry)
+	case *DeltaRegistry:
+		return Closed(r.Registry)
+	case *FilteredRegistry:
+		return Closed(r.underlying)
+	}
+	return nil
+}
+
+// resettable is implemented by metrics which can be snapshotted and reset at
+// once.
+type resettable interface {
+	snapshotAndReset() interface{}
+}
+
+// eachSnapshot snapshots every metric in r and then calls f with each, with
+// the default tags of the registry at the root of r merged into its name.
+func eachSnapshot(r Registry, f func(string, interface{})) {
+	eachSnapshotOf(r, func(_, name string, snapshot, _ interface{}) { f(name, snapshot) })
+}
+
+// eachSnapshotOf is eachSnapshot, also passing f the key each metric is
+// registered under, which Registry.Delta keys its changes by, and the metric
+// itself.  The name f gets is the key with the metric's current tags, as
+// liveNames renames it, and the default tags.  A DeltaRegistry's snapshots
+// are its deltas, but its metrics are those of the underlying registry.
+func eachSnapshotOf(r Registry, f func(key, name string, snapshot, metric interface{})) {
+	var deltas map[string]int64
+	if d, ok := r.(*DeltaRegistry); ok {
+		r, deltas = d.Registry, d.Registry.Delta(d.consumerID)
+	}
+	s := getEachScratch()
+	defer s.release()
+	s.names, s.metrics = appendRegistered(r, s.names, s.metrics)
+	for i, key := range s.names {
+		if nil != deltas {
+			s.snapshots = append(s.snapshots, deltaSnapshot(s.metrics[i], deltas, key))
+		} else {
+			s.snapshots = append(s.snapshots, snapshotMetric(s.metrics[i]))
+		}
+	}
+	s.live = liveNames(s.live, s.names, s.metrics, s.snapshots)
+	defaults := defaultTagsOf(r)
+	for i, key := range s.names {
+		f(key, withDefaultTags(s.live[i], defaults), s.snapshots[i], s.metrics[i])
+	}
+}
+
+// eachScratch holds the names and metrics which Each and EachSnapshot collect
+// before calling back with them.  They're pooled so that flushing a registry
+// doesn't allocate them anew every time.
+type eachScratch struct {
+	names     []string
+	live      []string
+	metrics   []interface{}
+	snapshots []interface{}
+}
+
+var eachScratchPool = sync.Pool{New: func() interface{} { return &eachScratch{} }}
+
+func getEachScratch() *eachScratch {
+	return eachScratchPool.Get().(*eachScratch)
+}
+
+// release returns s to the pool emptied, so that it holds on to no metric.
+func (s *eachScratch) release() {
+	for i := range s.metrics {
+		s.metrics[i] = nil
+	}
+	for i := range s.snapshots {
+		s.snapshots[i] = nil
+	}
+	s.names, s.live = s.names[:0], s.live[:0]
+	s.metrics, s.snapshots = s.metrics[:0], s.snapshots[:0]
+	eachScratchPool.Put(s)
+}
+
+// appendRegistered appends the name and metric of everything registered in r
+// to names and metrics, without the map StandardRegistry.Each would copy.
+func appendRegistered(r Registry, names []string, metrics []interface{}) ([]string, []interface{}) {
+	if r, ok := r.(*StandardRegistry); ok {
+		return r.appendRegistered(names, metrics)
+	}
+	return appendEach(r, names, metrics)
+}
+
+// appendEach appends what r.Each passes to names and metrics.  It's apart from
+// appendRegistered so that the slices only escape, to the closure, for
+// registries other than StandardRegistry.
+func appendEach(r Registry, names []string, metrics []interface{}) ([]string, []interface{}) {
+	r.Each(func(name string, i interface{}) {
+		names = append(names, name)
+		metrics = append(metrics, i)
+	})
+	return names, metrics
+}
+
+// defaultTagsOf returns the default tags of the StandardRegistry r or the
+// registries it's a child of, if any, without copying.
+func defaultTagsOf(r Registry) Tags {
+	switch r := r.(type) {
+	case *StandardRegistry:
+		return r.defaultTags()
+	case *PrefixedRegistry:
+		return defaultTagsOf(r.underlying)
+	case *TaggedSubRegistry:
+		return defaultTagsOf(r.underlying)
+	case *MappedRegistry:
+		return defaultTagsOf(r.Registry)
+	case *DeltaRegistry:
+		return defaultTagsOf(r.Registry)
+	case *FilteredRegistry:
+		return defaultTagsOf(r.underlying)
+	}
+	return Tags{}
+}
+
+// RegistryPercentiles returns the percentiles of histograms and timers to
+// report of r, those of the StandardRegistry at its root, for exporters which
+// aren't configured with percentiles of their own.  The slice mustn't be
+// modified.
+func RegistryPercentiles(r Registry) []float64 {
+	switch r := r.(type) {
+	case *StandardRegistry:
+		return r.percentiles()
+	case *PrefixedRegistry:
+		return RegistryPercentiles(r.underlying)
+	case *TaggedSubRegistry:
+		return RegistryPercentiles(r.underlying)
+	case *MappedRegistry:
+		return RegistryPercentiles(r.Registry)
+	case *DeltaRegistry:
+		return RegistryPercentiles(r.Registry)
+	case *FilteredRegistry:
+		return RegistryPercentiles(r.underlying)
+	}
+	return DefaultPercentiles
+}
+
+// MetricPercentiles returns ps, the percentiles an exporter reports of every
+// histogram and timer, merged with those the given histogram or timer (or a
+// snapshot of one) declares of itself, as RegisterFromSpec's are.  ps is
+// returned as is if the metric declares none.
+func MetricPercentiles(ps []float64, i interface{}) []float64 {
+	var declared []float64
+	switch m := i.(type) {
+	case *HistogramSnapshot:
+		declared = m.percentiles
+	case *StandardHistogram:
+		declared = m.percentiles
+	case *TimerSnapshot:
+		if nil != m.histogram {
+			declared = m.histogram.percentiles
+		}
+	case *StandardTimer:
+		if h, ok := m.histogram.(*StandardHistogram); ok {
+			declared = h.percentiles
+		}
+	}
+	if 0 == len(declared) {
+		return ps
+	}
+	return mergePercentiles(ps, declared)
+}
+
+// standardRegistryOf returns the StandardRegistry at the root of r, or nil if
+// r isn't built on one.
+func standardRegistryOf(r Registry) *StandardRegistry {
+	switch r := r.(type) {
+	case *StandardRegistry:
+		return r
+	case *PrefixedRegistry:
+		return standardRegistryOf(r.underlying)
+	case *TaggedSubRegistry:
+		return standardRegistryOf(r.underlying)
+	case *MappedRegistry:
+		return standardRegistryOf(r.Registry)
+	case *DeltaRegistry:
+		return standardRegistryOf(r.Registry)
+	case *FilteredRegistry:
+		return standardRegistryOf(r.underlying)
+	}
+	return nil
+}
+
+// reportedPercentiles returns ps, the percentiles an exporter is configured
+// with, unless they're nil, in which case it returns those of r.
+func reportedPercentiles(ps []float64, r Registry) []float64 {
+	if nil != ps {
+		return ps
+	}
+	return RegistryPercentiles(r)
+}
+
+// withDefaultTags merges default tags into the given name, unless it already
+// has tags with the same keys.
+func withDefaultTags(name string, defaults Tags) string {
+	if 0 == defaults.Len() {
+		return name
+	}
+	if -1 == strings.IndexByte(name, ';') {
+		return name + defaults.String()
+	}
+	name, tags := SplitTaggedName(name)
+	return name + defaults.Merge(NewTags(tags)).String()
+}
+
+// snapshotMetric returns a read-only copy of a metric.
+func snapshotMetric(i interface{}) interface{} {
+	switch m := i.(type) {
+	case Counter:
+		return m.Snapshot()
+	case CounterFloat64:
+		return m.Snapshot()
+	case Gauge:
+		return m.Snapshot()
+	case GaugeFloat64:
+		return m.Snapshot()
+	case Histogram:
+		return m.Snapshot()
+	case Meter:
+		return m.Snapshot()
+	case MergeableGaugeFloat64:
+		return m.Snapshot()
+	case Timer:
+		return m.Snapshot()
+	}
+	return i
+}
+
+// RegistrySnapshot is a read-only set of metric snapshots by name, taken by
+// Registry.Snapshot.  It's safe for concurrent use.
+type RegistrySnapshot struct {
+	names       []string // sorted
+	metrics     map[string]interface{}
+	percentiles []float64 // those of the registry, or nil for the defaults
+	timestamp   time.Time // when the snapshots were taken, or zero if unknown
+
+	// updated holds when the gauges which record their updates were last
+	// updated, by name, for Stale.
+	updated map[string]time.Time
+}
+
+// Timestamped is implemented by snapshots which record when they were taken:
+// those of counters, gauges, meters, timers, histograms and mergeable gauges,
+// and RegistrySnapshots.  Those decoded by UnmarshalSnapshot or of metrics
+// defined outside this package may not know, so push reporters stamp them
+// with the time of the RegistrySnapshot they're in or, failing that, of the
+// flush.
+type Timestamped interface {
+	Timestamp() time.Time
+}
+
+// SnapshotTime returns the time the given snapshot was taken, if it's
+// Timestamped and knows, or else t, e.g. the time of the flush reporting it.
+func SnapshotTime(i interface{}, t time.Time) time.Time {
+	if ts, ok := i.(Timestamped); ok {
+		if taken := ts.Timestamp(); !taken.IsZero() {
+			return taken
+		}
+	}
+	return t
+}
+
+func newRegistrySnapshot(r Registry) *RegistrySnapshot {
+	s := &RegistrySnapshot{
+		metrics:     make(map[string]interface{}),
+		percentiles: RegistryPercentiles(r),
+		timestamp:   now(),
+	}
+	eachSnapshotOf(r, func(_, name string, snapshot, metric interface{}) {
+		s.names = append(s.names, name)
+		s.metrics[name] = snapshot
+		s.stamp(name, metric)
+	})
+	sort.Strings(s.names)
+	return s
+}
+
+// Each calls f with each snapshot in order of name.
+func (s *RegistrySnapshot) Each(f func(string, interface{})) {
+	for _, name := range s.names {
+		f(name, s.metrics[name])
+	}
+}
+
+// Get returns the snapshot of the metric by the given name, which includes
+// any tags, or nil if there is none.
+func (s *RegistrySnapshot) Get(name string) interface{} {
+	return s.metrics[TaggedName(name, nil)]
+}
+
+// Len returns the number of snapshots.
+func (s *RegistrySnapshot) Len() int { return len(s.names) }
+
+// Timestamp returns the time the snapshots were begun being taken, by the
+// clock set by SetClock, or the zero time if they were decoded by
+// UnmarshalSnapshot and the like.
+func (s *RegistrySnapshot) Timestamp() time.Time { return s.timestamp }
+
+// Names returns the names of the snapshots in order.
+func (s *RegistrySnapshot) Names() []string {
+	return append([]string(nil), s.names...)
+}
+
+// reportedPercentiles returns ps, the percentiles an exporter is configured
+// with, unless they're nil, in which case it returns those of the registry the
+// snapshots were taken of.
+func (s *RegistrySnapshot) reportedPercentiles(ps []float64) []float64 {
+	if nil != ps {
+		return ps
+	}
+	if nil != s.percentiles {
+		return s.percentiles
+	}
+	return DefaultPercentiles
+}
+
+// WithTags returns a copy of the snapshots with the given tags merged into
+// their names, e.g. those a reporter adds to every series, without touching
+// the metrics they were taken of.  Each snapshot's own tags, including the
+// registry's default tags, take precedence.  Should merging make two names
+// the same, the snapshot of the series which already had the tags is kept.
+func (s *RegistrySnapshot) WithTags(tags map[string]string) *RegistrySnapshot {
+	if 0 == len(tags) {
+		return s
+	}
+	t := NewTags(tags)
+	merged := &RegistrySnapshot{
+		metrics:     make(map[string]interface{}, len(s.names)),
+		percentiles: s.percentiles,
+		timestamp:   s.timestamp,
+	}
+	for _, name := range s.names {
+		taggedName := withDefaultTags(name, t)
+		if _, ok := merged.metrics[taggedName]; !ok {
+			merged.names = append(merged.names, taggedName)
+		} else if taggedName != name {
+			continue
+		}
+		merged.metrics[taggedName] = s.metrics[name]
+		if updated, ok := s.updated[name]; ok {
+			if nil == merged.updated {
+				merged.updated = make(map[string]time.Time)
+			}
+			merged.updated[taggedName] = updated
+		}
+	}
+	sort.Strings(merged.names)
+	return merged
+}
+
+// snapshotAndResetEach implements SnapshotAndReset for any registry.
+func snapshotAndResetEach(r Registry) Registry {
+	s := getEachScratch()
+	defer s.release()
+	s.names, s.metrics = appendEach(r, s.names, s.metrics)
+	for _, i := range s.metrics {
+		s.snapshots = append(s.snapshots, snapshotAndReset(i))
+	}
+	s.live = liveNames(s.live, s.names, s.metrics, s.snapshots)
+	// Set the snapshots under their names as they are, rather than
+	// registering them, which would add back the tags of one kept apart.
+	snapshots := NewRegistry().(*StandardRegistry)
+	snapshots.mutex.Lock()
+	defer snapshots.mutex.Unlock()
+	for i, name := range s.live {
+		snapshots.set(name, s.snapshots[i])
+	}
+	return snapshots
+}
+
+// newRegistrySnapshotAndReset returns the snapshots SnapshotAndReset of r
+// takes, with the default tags of the registry at the root of r merged into
+// their names, as Snapshot would.
+func newRegistrySnapshotAndReset(r Registry) *RegistrySnapshot {
+	updated := gaugesUpdated(r)
+	s := r.SnapshotAndReset().Snapshot().WithTags(defaultTagsOf(r).Map())
+	s.percentiles = RegistryPercentiles(r)
+	s.updated = updated
+	return s
+}
+
+// snapshotAndReset returns a read-only copy of a metric, resetting it if it
+// accumulates values.
+func snapshotAndReset(i interface{}) interface{} {
+	if m, ok := i.(resettable); ok {
+		return m.snapshotAndReset()
+	}
+	switch m := i.(type) {
+	case CounterSnapshot, CounterFloat64Snapshot, *HistogramSnapshot, *MergeableGaugeFloat64Snapshot:
+		return m
+	case Counter:
+		snapshot := m.Snapshot()
+		m.Clear()
+		return snapshot
+	case CounterFloat64:
+		snapshot := m.Snapshot()
+		m.Clear()
+		return snapshot
+	case Gauge:
+		return m.Snapshot()
+	case GaugeFloat64:
+		return m.Snapshot()
+	case Histogram:
+		snapshot := m.Snapshot()
+		m.Clear()
+		return snapshot
+	case Meter:
+		return m.Snapshot()
+	case MergeableGaugeFloat64:
+		snapshot := m.Snapshot()
+		m.Clear()
+		return snapshot
+	case Timer:
+		return m.Snapshot()
+	}
+	return i
+}
+
+// resetMetric resets a metric which accumulates values, as ResetAll does.
+func resetMetric(_ string, i interface{}) {
+	switch m := i.(type) {
+	case interface{ reset() }:
+		m.reset()
+	case Counter:
+		m.Clear()
+	case CounterFloat64:
+		m.Clear()
+	case PeakGauge:
+		m.Clear()
+	case Histogram:
+		m.Clear()
+	case MergeableGaugeFloat64:
+		m.Clear()
+	}
+}
+
+// cumulativeCount returns the count of metrics which count events.
+func cumulativeCount(i interface{}) (int64, bool) {
+	switch metric := i.(type) {
+	case Counter:
+		return metric.Count(), true
+	case Histogram:
+		return metric.Count(), true
+	case Meter:
+		return metric.Count(), true
+	case Timer:
+		return metric.Count(), true
+	}
+	return 0, false
 }
 
-// Call the given function for each registered metric.
-func (r *StandardRegistry) Each(f func(string, interface{})) {
-	for name, i := range r.registered() {
-		f(name, i)
+// key returns the name under which the metric by the given name, which may
+// include tags, would be registered.
+func (r *StandardRegistry) key(name string) string {
+	name = TaggedName(name, nil)
+	if s := r.tagSanitizer(); nil != s {
+		if sanitized, err := s.sanitizeName(name); nil == err {
+			return sanitized
+		}
 	}
+	return name
 }
 
-// Get the metric by the given name or nil if none is registered.
-func (r *StandardRegistry) Get(name string) interface{} {
-	r.mutex.Lock()
-	defer r.mutex.Unlock()
-	return r.metrics[name]
+func (r *StandardRegistry) tagSanitizer() *TagSanitizer {
+	s, _ := r.sanitizer.Load().(*TagSanitizer)
+	return s
 }
 
-// Gets an existing metric or creates and registers a new one. Threadsafe
-// alternative to calling Get and Register on failure.
-// The interface can be the metric to register if not found in registry,
-// or a function returning the metric for lazy instantiation.
-func (r *StandardRegistry) GetOrRegister(name string, i interface{}) interface{} {
-	r.mutex.Lock()
-	defer r.mutex.Unlock()
-	if metric, ok := r.metrics[name]; ok {
-		return metric
-	}
-	if v := reflect.ValueOf(i); v.Kind() == reflect.Func {
-		i = v.Call(nil)[0].Interface()
+func (r *StandardRegistry) defaultTags() Tags {
+	tags, _ := r.defaults.Load().(Tags)
+	return tags
+}
+
+func (r *StandardRegistry) percentiles() []float64 {
+	if ps, _ := r.pcts.Load().([]float64); nil != ps {
+		return ps
 	}
-	r.register(name, i)
-	return i
+	return DefaultPercentiles
 }
 
-// Register the given metric under the given name.  Returns a DuplicateMetric
-// if a metric by the given name is already registered.
-func (r *StandardRegistry) Register(name string, i interface{}) error {
-	r.mutex.Lock()
-	defer r.mutex.Unlock()
-	return r.register(name, i)
+// load returns the metric registered under the given key without locking.
+// Writers update the sync.Map under the mutex along with metrics, and replace
+// it whole when they replace every metric at once, so that Get during Clear
+// sees all the metrics or none.
+func (r *StandardRegistry) load(name string) (interface{}, bool) {
+	return r.lookup.Load().(*sync.Map).Load(name)
 }
 
-// Run all registered healthchecks.
-func (r *StandardRegistry) RunHealthchecks() {
-	r.mutex.Lock()
-	defer r.mutex.Unlock()
-	for _, i := range r.metrics {
-		if h, ok := i.(Healthcheck); ok {
-			h.Check()
-		}
-	}
+// set registers i under the given key.  It must be called with r.mutex held.
+func (r *StandardRegistry) set(name string, i interface{}) {
+	r.metrics[name] = i
+	r.lookup.Load().(*sync.Map).Store(name, i)
 }
 
-// Unregister the metric with the given name.
-func (r *StandardRegistry) Unregister(name string) {
-	r.mutex.Lock()
-	defer r.mutex.Unlock()
+// del unregisters the metric under the given key.  It must be called with
+// r.mutex held.
+func (r *StandardRegistry) del(name string) {
 	delete(r.metrics, name)
+	delete(r.disabled, name)
+	r.lookup.Load().(*sync.Map).Delete(name)
 }
 
-// Unregister all metrics.  (Mostly for testing.)
-func (r *StandardRegistry) UnregisterAll() {
+func (r *StandardRegistry) appendRegistered(names []string, metrics []interface{}) ([]string, []interface{}) {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
-	for name, _ := range r.metrics {
-		delete(r.metrics, name)
-	}
-}
-
-func (r *StandardRegistry) register(name string, i interface{}) error {
-	if _, ok := r.metrics[name]; ok {
-		return DuplicateMetric(name)
-	}
-	switch i.(type) {
-	case Counter, Gauge, GaugeFloat64, Healthcheck, Histogram, Meter, Timer:
-		r.metrics[name] = i
+	for name, i := range r.metrics {
+		if _, ok := r.disabled[name]; ok {
+			continue
+		}
+		names = append(names, name)
+		metrics = append(metrics, i)
 	}
-	return nil
+	return names, metrics
 }
 
+// registered returns every registered metric by key, the metrics disabled
+// rather than their stubs.
 func (r *StandardRegistry) registered() map[string]interface{} {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 	metrics := make(map[string]interface{}, len(r.metrics))
 	for name, i := range r.metrics {
-		metrics[name] = i
+		metrics[name] = r.original(name, i)
 	}
 	return metrics
 }
 
+// NilRegistry is a no-op Registry which registers nothing, so a library
+// given one records nothing while the rest of the program collects as usual.
+// The GetOrRegister* and NewRegistered* constructors return stubs for it.
+type NilRegistry struct{}
+
+// Alias is a no-op.
+func (NilRegistry) Alias(string, string) error { return nil }
+
+// Clear is a no-op.
+func (NilRegistry) Clear() {}
+
+// Close is a no-op.
+func (NilRegistry) Close() {}
+
+// Delta is a no-op.
+func (NilRegistry) Delta(string) map[string]int64 { return map[string]int64{} }
+
+// Each is a no-op.
+func (NilRegistry) Each(func(string, interface{})) {}
+
+// EachAndUpdate is a no-op.
+func (NilRegistry) EachAndUpdate(func(string, interface{}) Action) {}
+
+// EachSnapshot is a no-op.
+func (NilRegistry) EachSnapshot(func(string, interface{})) {}
+
+// Get is a no-op.
+func (NilRegistry) Get(string) interface{} { return nil }
+
+// GetAll returns an empty map.
+func (NilRegistry) GetAll() map[string]map[string]interface{} {
+	return map[string]map[string]interface{}{}
+}
+
+// GetOrRegister returns the stub equivalent of the given metric, or of the
+// metric the given function returns, without registering it.
+func (NilRegistry) GetOrRegister(_ string, i interface{}) interface{} {
+	if v := reflect.ValueOf(i); v.Kind() == reflect.Func {
+		i = v.Call(nil)[0].Interface()
+		stopMetric(i)
+	}
+	return nilMetric(i)
+}
+
+// Register is a no-op.
+func (NilRegistry) Register(string, interface{}) error { return nil }
+
+// ResetAll is a no-op.
+func (NilRegistry) ResetAll() {}
+
+// RunHealthchecks is a no-op.
+func (NilRegistry) RunHealthchecks() {}
+
+// Snapshot returns an empty snapshot.
+func (r NilRegistry) Snapshot() *RegistrySnapshot { return newRegistrySnapshot(r) }
+
+// SnapshotAndReset returns the NilRegistry.
+func (r NilRegistry) SnapshotAndReset() Registry { return r }
+
+// SubRegistryWithTags returns the NilRegistry and a no-op.
+func (r NilRegistry) SubRegistryWithTags(map[string]string) (Registry, func()) {
+	return r, func() {}
+}
+
+// Subscribe returns a Subscription which delivers no events.
+func (r NilRegistry) Subscribe(match func(string) bool, interval time.Duration, buffer int) *Subscription {
+	return subscribe(r, match, interval, buffer)
+}
+
+// Unregister is a no-op.
+func (NilRegistry) Unregister(string) {}
+
+// UnregisterAll is a no-op.
+func (NilRegistry) UnregisterAll() {}
+
+// UnregisterWithAliases is a no-op.
+func (NilRegistry) UnregisterWithAliases(string) {}
+
+// UseNilMetrics returns true, so that constructors return stubs rather than
+// metrics that would never be reported.
+func (NilRegistry) UseNilMetrics() bool { return true }
+
 type PrefixedRegistry struct {
 	underlying Registry
 	prefix     string
+	nilMetrics int32 // atomic boolean
 }
 
 func NewPrefixedRegistry(prefix string) Registry {
@@ -165,6 +1500,47 @@ func NewPrefixedChildRegistry(parent Registry, prefix string) Registry {
 	}
 }
 
+// Alias registers the metric with the given name under another name, too.
+// Both names will be prefixed.
+func (r *PrefixedRegistry) Alias(existingName, aliasName string) error {
+	return r.underlying.Alias(r.prefix+existingName, r.prefix+aliasName)
+}
+
+// Clear unregisters every metric whose name has the prefix, stopping those
+// with tickers.  Metrics without the prefix are left untouched.
+func (r *PrefixedRegistry) Clear() {
+	baseRegistry, _ := findPrefix(r, "")
+	r.Each(func(name string, i interface{}) {
+		baseRegistry.Unregister(name)
+		stopMetric(i)
+	})
+}
+
+// Close stops every metric whose name has the prefix which is Stoppable.  It
+// leaves the parent registry open.
+func (r *PrefixedRegistry) Close() {
+	r.Each(func(_ string, i interface{}) { stopMetric(i) })
+}
+
+// DefaultTags returns a copy of the parent registry's default tags.
+func (r *PrefixedRegistry) DefaultTags() map[string]string {
+	return defaultTagsOf(r).Map()
+}
+
+// Delta returns the change in count of each counter, histogram, meter and
+// timer whose name has the prefix since the last call with the same consumer
+// ID.  Names include the prefix, as they do in Each.
+func (r *PrefixedRegistry) Delta(consumerID string) map[string]int64 {
+	baseRegistry, prefix := findPrefix(r, "")
+	deltas := baseRegistry.Delta(consumerID)
+	for name := range deltas {
+		if !strings.HasPrefix(name, prefix) {
+			delete(deltas, name)
+		}
+	}
+	return deltas
+}
+
 // Call the given function for each registered metric.
 func (r *PrefixedRegistry) Each(fn func(string, interface{})) {
 	wrappedFn := func(prefix string) func(string, interface{}) {
@@ -181,14 +1557,37 @@ func (r *PrefixedRegistry) Each(fn func(string, interface{})) {
 	baseRegistry.Each(wrappedFn(prefix))
 }
 
+// EachAndUpdate calls f for each metric whose name has the prefix and applies
+// the Action it returns, as described for StandardRegistry.  Names include the
+// prefix, as they do in Each.
+func (r *PrefixedRegistry) EachAndUpdate(f func(string, interface{}) Action) {
+	baseRegistry, prefix := findPrefix(r, "")
+	baseRegistry.EachAndUpdate(func(name string, i interface{}) Action {
+		if !strings.HasPrefix(name, prefix) {
+			return ActionKeep
+		}
+		return f(name, i)
+	})
+}
+
+// EachSnapshot calls f with a read-only snapshot of each metric whose name has
+// the prefix, as described for StandardRegistry.
+func (r *PrefixedRegistry) EachSnapshot(f func(string, interface{})) {
+	eachSnapshot(r, f)
+}
+
+// GetAll returns the values of every metric with the registry's prefix by
+// field, keyed by name.
+func (r *PrefixedRegistry) GetAll() map[string]map[string]interface{} {
+	return getAll(r.EachSnapshot, RegistryPercentiles(r))
+}
+
 func findPrefix(registry Registry, prefix string) (Registry, string) {
 	switch r := registry.(type) {
 	case *PrefixedRegistry:
 		return findPrefix(r.underlying, r.prefix+prefix)
-	case *StandardRegistry:
-		return r, prefix
 	}
-	return nil, ""
+	return registry, prefix
 }
 
 // Get the metric by the given name or nil if none is registered.
@@ -211,9 +1610,68 @@ func (r *PrefixedRegistry) Register(name string, metric interface{}) error {
 	return r.underlying.Register(realName, metric)
 }
 
-// Run all registered healthchecks.
+// ResetAll resets the metrics whose names have the prefix, as described for
+// StandardRegistry.
+func (r *PrefixedRegistry) ResetAll() {
+	r.Each(resetMetric)
+}
+
+// Run the healthchecks whose names have the prefix.
 func (r *PrefixedRegistry) RunHealthchecks() {
-	r.underlying.RunHealthchecks()
+	r.Each(func(name string, i interface{}) {
+		if h, ok := i.(Healthcheck); ok {
+			h.Check()
+		}
+	})
+}
+
+// Snapshot returns a read-only snapshot of every metric whose name has the
+// prefix, as described for StandardRegistry.
+func (r *PrefixedRegistry) Snapshot() *RegistrySnapshot {
+	return newRegistrySnapshot(r)
+}
+
+// SnapshotAndReset returns a new registry holding a read-only copy of every
+// metric whose name has the prefix, resetting them as described for
+// StandardRegistry.  Names include the prefix, as they do in Each.
+func (r *PrefixedRegistry) SnapshotAndReset() Registry {
+	return snapshotAndResetEach(r)
+}
+
+// SubRegistryWithTags returns a child registry whose metrics carry the given
+// tags and are registered in r, and a function which unregisters every metric
+// registered through the child.  See NewTaggedSubRegistry.
+func (r *PrefixedRegistry) SubRegistryWithTags(tags map[string]string) (Registry, func()) {
+	return NewTaggedSubRegistry(r, tags)
+}
+
+// Subscribe watches the metrics whose names have the prefix, as described for
+// StandardRegistry.  Names in events include the prefix, as they do in Each.
+func (r *PrefixedRegistry) Subscribe(match func(string) bool, interval time.Duration, buffer int) *Subscription {
+	return subscribe(r, match, interval, buffer)
+}
+
+// SetUseNilMetrics switches the GetOrRegister* and NewRegistered* constructors
+// to return stubs for this registry, or back again, as for a StandardRegistry.
+// The parent registry is unaffected.
+func (r *PrefixedRegistry) SetUseNilMetrics(use bool) {
+	var v int32
+	if use {
+		v = 1
+	}
+	atomic.StoreInt32(&r.nilMetrics, v)
+}
+
+// UseNilMetrics reports whether this registry or its parent has been switched
+// to nil metrics.
+func (r *PrefixedRegistry) UseNilMetrics() bool {
+	return 1 == atomic.LoadInt32(&r.nilMetrics) || usesNilMetrics(r.underlying)
+}
+
+// UseShardedCounters reports whether the parent registry has been switched to
+// ShardedCounters.
+func (r *PrefixedRegistry) UseShardedCounters() bool {
+	return usesShardedCounters(r.underlying)
 }
 
 // Unregister the metric with the given name. The name will be prefixed.
@@ -222,41 +1680,388 @@ func (r *PrefixedRegistry) Unregister(name string) {
 	r.underlying.Unregister(realName)
 }
 
-// Unregister all metrics.  (Mostly for testing.)
+// Unregister every metric whose name has the prefix, leaving the rest of the
+// parent registry untouched.
 func (r *PrefixedRegistry) UnregisterAll() {
-	r.underlying.UnregisterAll()
+	r.EachAndUpdate(func(string, interface{}) Action { return ActionUnregister })
+}
+
+// Unregister the metric with the given name and all its aliases.  The name
+// will be prefixed.
+func (r *PrefixedRegistry) UnregisterWithAliases(name string) {
+	r.underlying.UnregisterWithAliases(r.prefix + name)
+}
+
+// TaggedSubRegistry is a child registry which registers its metrics in a
+// parent registry with a set of tags and keeps track of them so they can all
+// be unregistered at once, e.g. at the end of a request.
+//
+// The child's tags become part of each metric's identity in the parent, as
+// though written into its name, so the parent's Each passes names such as
+// "name;key1=value1;key2=value2".  Tags of the metric itself take precedence
+// over the child's.  The metric's own tags are left as they are.
+type TaggedSubRegistry struct {
+	mutex      sync.Mutex
+	names      map[string]struct{}
+	nilMetrics int32 // atomic boolean
+	tags       map[string]string
+	underlying Registry
+}
+
+// NewTaggedSubRegistry constructs a TaggedSubRegistry registering metrics in
+// parent with the given tags.  The returned function unregisters from parent
+// every metric registered through the child; it is safe to call more than
+// once.
+func NewTaggedSubRegistry(parent Registry, tags map[string]string) (*TaggedSubRegistry, func()) {
+	r := &TaggedSubRegistry{
+		names:      make(map[string]struct{}),
+		tags:       make(map[string]string, len(tags)),
+		underlying: parent,
+	}
+	for k, v := range tags {
+		r.tags[k] = v
+	}
+	return r, r.UnregisterAll
+}
+
+// Alias registers the metric with the given name under another name, too.
+// Both names will be tagged and the alias is unregistered along with the rest
+// of the child's metrics.
+func (r *TaggedSubRegistry) Alias(existingName, aliasName string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	realName := TaggedName(aliasName, r.tags)
+	if err := r.underlying.Alias(TaggedName(existingName, r.tags), realName); nil != err {
+		return err
+	}
+	r.names[realName] = struct{}{}
+	return nil
+}
+
+// Clear unregisters every metric registered through the child, stopping
+// those with tickers.
+func (r *TaggedSubRegistry) Clear() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for name := range r.names {
+		stopMetric(r.underlying.Get(name))
+		r.underlying.Unregister(name)
+		delete(r.names, name)
+	}
+}
+
+// Close stops every metric registered through the child which is Stoppable.
+// It leaves the parent registry open.
+func (r *TaggedSubRegistry) Close() {
+	r.Each(func(_ string, i interface{}) { stopMetric(i) })
+}
+
+// DefaultTags returns a copy of the parent registry's default tags.
+func (r *TaggedSubRegistry) DefaultTags() map[string]string {
+	return defaultTagsOf(r).Map()
+}
+
+// Delta returns the change in count of each counter, histogram, meter and
+// timer registered through the child since the last call with the same
+// consumer ID.  Names include the tags, as they do in Each.
+func (r *TaggedSubRegistry) Delta(consumerID string) map[string]int64 {
+	all := r.underlying.Delta(consumerID)
+	_, prefix := findPrefix(r.underlying, "")
+	deltas := make(map[string]int64)
+	for _, name := range r.registered() {
+		if delta, ok := all[prefix+name]; ok {
+			deltas[name] = delta
+		}
+	}
+	return deltas
+}
+
+// Call the given function for each metric registered through the child.  The
+// names passed include the tags.
+func (r *TaggedSubRegistry) Each(fn func(string, interface{})) {
+	for _, name := range r.registered() {
+		if i := r.underlying.Get(name); nil != i {
+			fn(name, i)
+		}
+	}
+}
+
+// EachAndUpdate calls f for each metric registered through the child and
+// applies the Action it returns, as described for StandardRegistry.  The names
+// passed include the tags.
+func (r *TaggedSubRegistry) EachAndUpdate(f func(string, interface{}) Action) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	_, prefix := findPrefix(r.underlying, "")
+	r.underlying.EachAndUpdate(func(name string, i interface{}) Action {
+		name = strings.TrimPrefix(name, prefix)
+		if _, ok := r.names[name]; !ok {
+			return ActionKeep
+		}
+		action := f(name, i)
+		if ActionUnregister == action {
+			delete(r.names, name)
+		}
+		return action
+	})
+}
+
+// EachSnapshot calls f with a read-only snapshot of each metric registered
+// through the child, as described for StandardRegistry.
+func (r *TaggedSubRegistry) EachSnapshot(f func(string, interface{})) {
+	eachSnapshot(r, f)
+}
+
+// GetAll returns the values of every metric registered through the
+// TaggedSubRegistry by field, keyed by name.
+func (r *TaggedSubRegistry) GetAll() map[string]map[string]interface{} {
+	return getAll(r.EachSnapshot, RegistryPercentiles(r))
+}
+
+// Get the metric by the given name or nil if none is registered.
+func (r *TaggedSubRegistry) Get(name string) interface{} {
+	return r.underlying.Get(TaggedName(name, r.tags))
+}
+
+// Gets an existing metric or registers the given one.  A metric registered
+// here is tracked and will be unregistered along with the rest of the child's
+// metrics; one the parent already held is left to whoever registered it.
+func (r *TaggedSubRegistry) GetOrRegister(name string, i interface{}) interface{} {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	realName := TaggedName(name, r.tags)
+	if existing := r.underlying.Get(tagsOf(i).Name(realName)); nil != existing {
+		return existing
+	}
+	metric := r.underlying.GetOrRegister(realName, i)
+	if nil == r.underlying.Get(realName) {
+		realName = tagsOf(metric).Name(realName)
+	}
+	r.names[realName] = struct{}{}
+	return metric
+}
+
+// Register the given metric under the given name.  The name will be tagged.
+func (r *TaggedSubRegistry) Register(name string, i interface{}) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	realName := TaggedName(name, r.tags)
+	if err := r.underlying.Register(realName, i); nil != err {
+		return err
+	}
+	r.names[tagsOf(i).Name(realName)] = struct{}{}
+	return nil
+}
+
+// ResetAll resets the metrics registered through the child, as described for
+// StandardRegistry.
+func (r *TaggedSubRegistry) ResetAll() {
+	r.Each(resetMetric)
+}
+
+// Run the healthchecks registered through the child.
+func (r *TaggedSubRegistry) RunHealthchecks() {
+	r.Each(func(name string, i interface{}) {
+		if h, ok := i.(Healthcheck); ok {
+			h.Check()
+		}
+	})
+}
+
+// Snapshot returns a read-only snapshot of every metric registered through
+// the child, as described for StandardRegistry.
+func (r *TaggedSubRegistry) Snapshot() *RegistrySnapshot {
+	return newRegistrySnapshot(r)
+}
+
+// SnapshotAndReset returns a new registry holding a read-only copy of every
+// metric registered through the child, resetting them as described for
+// StandardRegistry.  Names include the tags, as they do in Each.
+func (r *TaggedSubRegistry) SnapshotAndReset() Registry {
+	return snapshotAndResetEach(r)
+}
+
+// SubRegistryWithTags returns a grandchild registry whose metrics carry the
+// child's tags merged with the given ones, which take precedence.
+func (r *TaggedSubRegistry) SubRegistryWithTags(tags map[string]string) (Registry, func()) {
+	merged := make(map[string]string, len(r.tags)+len(tags))
+	for k, v := range r.tags {
+		merged[k] = v
+	}
+	for k, v := range tags {
+		merged[k] = v
+	}
+	return NewTaggedSubRegistry(r.underlying, merged)
+}
+
+// Subscribe watches the metrics registered through the child, as described
+// for StandardRegistry.  Names in events have the tags split off, as always.
+func (r *TaggedSubRegistry) Subscribe(match func(string) bool, interval time.Duration, buffer int) *Subscription {
+	return subscribe(r, match, interval, buffer)
+}
+
+// SetUseNilMetrics switches the GetOrRegister* and NewRegistered* constructors
+// to return stubs for this registry, or back again, as for a StandardRegistry.
+// The parent registry is unaffected.
+func (r *TaggedSubRegistry) SetUseNilMetrics(use bool) {
+	var v int32
+	if use {
+		v = 1
+	}
+	atomic.StoreInt32(&r.nilMetrics, v)
+}
+
+// UseNilMetrics reports whether this registry or its parent has been switched
+// to nil metrics.
+func (r *TaggedSubRegistry) UseNilMetrics() bool {
+	return 1 == atomic.LoadInt32(&r.nilMetrics) || usesNilMetrics(r.underlying)
+}
+
+// UseShardedCounters reports whether the parent registry has been switched to
+// ShardedCounters.
+func (r *TaggedSubRegistry) UseShardedCounters() bool {
+	return usesShardedCounters(r.underlying)
+}
+
+// Unregister the metric with the given name.  The name will be tagged.
+func (r *TaggedSubRegistry) Unregister(name string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	realName := TaggedName(name, r.tags)
+	delete(r.names, realName)
+	r.underlying.Unregister(realName)
+}
+
+// Unregister every metric registered through the child, leaving the rest of
+// the parent registry untouched.
+func (r *TaggedSubRegistry) UnregisterAll() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for name := range r.names {
+		r.underlying.Unregister(name)
+		delete(r.names, name)
+	}
+}
+
+// Unregister the metric with the given name and all its aliases.  The name
+// will be tagged.
+func (r *TaggedSubRegistry) UnregisterWithAliases(name string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	realName := TaggedName(name, r.tags)
+	delete(r.names, realName)
+	r.underlying.UnregisterWithAliases(realName)
+}
+
+func (r *TaggedSubRegistry) registered() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	names := make([]string, 0, len(r.names))
+	for name := range r.names {
+		names = append(names, name)
+	}
+	return names
 }
 
 var DefaultRegistry Registry = NewRegistry()
 
+// Register the metric registered under the first name under the second name,
+// too.
+func Alias(existingName, aliasName string) error {
+	return DefaultRegistry.Alias(existingName, aliasName)
+}
+
+// Unregister all metrics in the default registry, stopping those with tickers.
+func Clear() {
+	DefaultRegistry.Clear()
+}
+
+// Return the change in counts in the default registry since the last call
+// with the given consumer ID.
+func Delta(consumerID string) map[string]int64 {
+	return DefaultRegistry.Delta(consumerID)
+}
+
 // Call the given function for each registered metric.
 func Each(f func(string, interface{})) {
 	DefaultRegistry.Each(f)
 }
 
+// Call the given function for each registered metric and apply the Action it
+// returns.
+func EachAndUpdate(f func(string, interface{}) Action) {
+	DefaultRegistry.EachAndUpdate(f)
+}
+
+// Call the given function with a read-only snapshot of each registered metric.
+func EachSnapshot(f func(string, interface{})) {
+	DefaultRegistry.EachSnapshot(f)
+}
+
 // Get the metric by the given name or nil if none is registered.
 func Get(name string) interface{} {
 	return DefaultRegistry.Get(name)
 }
 
+// Return the values of every metric in the default registry by field, keyed
+// by name.
+func GetAll() map[string]map[string]interface{} {
+	return DefaultRegistry.GetAll()
+}
+
 // Gets an existing metric or creates and registers a new one. Threadsafe
 // alternative to calling Get and Register on failure.
 func GetOrRegister(name string, i interface{}) interface{} {
 	return DefaultRegistry.GetOrRegister(name, i)
 }
 
-// Register the given metric under the given name.  Returns a DuplicateMetric
-// if a metric by the given name is already registered.
+// Register the given metric under the given name.  Returns a
+// *DuplicateMetricError if a metric by the given name is already registered.
 func Register(name string, i interface{}) error {
 	return DefaultRegistry.Register(name, i)
 }
 
 // Register the given metric under the given name.  Panics if a metric by the
-// given name is already registered.
+// given name is already registered.  See MustRegisterIn.
 func MustRegister(name string, i interface{}) {
-	if err := Register(name, i); err != nil {
-		panic(err)
+	MustRegisterIn(DefaultRegistry, name, i)
+}
+
+// Register the given metric under the given name in r, or DefaultRegistry if
+// r is nil.  Panics if it can't be registered, e.g. because a metric by the
+// same name and tags is already registered, with an error naming both the
+// metric's type and tags and those of the metric registered already.
+func MustRegisterIn(r Registry, name string, i interface{}) {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	if err := r.Register(name, i); nil != err {
+		panic(&MustRegisterError{Name: name, Tags: tagsOf(i).Map(), Metric: i, Err: err})
+	}
+}
+
+// MustRegisterError is the value MustRegister and MustRegisterIn panic with.
+type MustRegisterError struct {
+	Name   string            // The name passed to MustRegister
+	Tags   map[string]string // The tags of the metric
+	Metric interface{}       // The metric which couldn't be registered
+	Err    error             // The error Register returned, usually a *DuplicateMetricError
+}
+
+func (err *MustRegisterError) Error() string {
+	tags := ""
+	if 0 != len(err.Tags) {
+		tags = " with tags " + strings.TrimPrefix(tagSuffix(err.Tags), ";")
 	}
+	return fmt.Sprintf("metrics: can't register %T %s%s: %v", err.Metric, err.Name, tags, err.Err)
+}
+
+// Unwrap returns the error Register returned.
+func (err *MustRegisterError) Unwrap() error { return err.Err }
+
+// Reset every metric in DefaultRegistry which accumulates values.
+func ResetAll() {
+	DefaultRegistry.ResetAll()
 }
 
 // Run all registered healthchecks.
@@ -264,7 +2069,34 @@ func RunHealthchecks() {
 	DefaultRegistry.RunHealthchecks()
 }
 
+// Return read-only snapshots of every metric in the default registry.
+func Snapshot() *RegistrySnapshot {
+	return DefaultRegistry.Snapshot()
+}
+
+// Return read-only snapshots of every metric in the default registry with the
+// given tags merged into their names; see RegistrySnapshot.WithTags.
+func SnapshotWith(tags map[string]string) *RegistrySnapshot {
+	return DefaultRegistry.Snapshot().WithTags(tags)
+}
+
+// Return a registry of snapshots of every metric in the default registry,
+// resetting those which accumulate values.
+func SnapshotAndReset() Registry {
+	return DefaultRegistry.SnapshotAndReset()
+}
+
+// Create a child of the default registry whose metrics carry the given tags.
+func SubRegistryWithTags(tags map[string]string) (Registry, func()) {
+	return DefaultRegistry.SubRegistryWithTags(tags)
+}
+
 // Unregister the metric with the given name.
 func Unregister(name string) {
 	DefaultRegistry.Unregister(name)
 }
+
+// Unregister the metric with the given name and all its aliases.
+func UnregisterWithAliases(name string) {
+	DefaultRegistry.UnregisterWithAliases(name)
+}
@@ -0,0 +1,116 @@
+package metrics
+
+// A MetricSelector selects metrics by their base name and tags, e.g. every
+// series of a timer or only those of one endpoint.  The zero MetricSelector
+// selects every metric.
+type MetricSelector struct {
+	Name string            // Base name, without tags, of the metrics selected; empty selects every name
+	Tags map[string]string // Tags every metric selected carries, with these values
+}
+
+// Match returns true if the selector selects the metric registered under the
+// given name, which may carry tags as TaggedName renders them.
+func (s MetricSelector) Match(name string) bool {
+	base, tags := SplitTaggedName(name)
+	if "" != s.Name && s.Name != base {
+		return false
+	}
+	for k, v := range s.Tags {
+		if tv, ok := tags[k]; !ok || tv != v {
+			return false
+		}
+	}
+	return true
+}
+
+// String renders the selector as TaggedName would, its tags sorted by key.
+func (s MetricSelector) String() string {
+	return TaggedName(s.Name, s.Tags)
+}
+
+// Disable swaps every registered metric the selector selects for a stub, in
+// place, so that code which looks its metrics up in the registry stops
+// collecting them, e.g. to turn off an expensive timer in production without
+// a redeploy.  Metrics registered later which it selects are swapped as
+// they're registered.  Disabled metrics aren't reported.  Metrics already
+// held by callers are unaffected, as by ReplaceWithNilMetrics.  Disabling with
+// a selector which is already disabling is a no-op.
+func (r *StandardRegistry) Disable(s MetricSelector) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	key := s.String()
+	for _, rule := range r.disabledBy {
+		if key == rule.String() {
+			return
+		}
+	}
+	r.disabledBy = append(r.disabledBy, s)
+	for name, i := range r.metrics {
+		if _, ok := r.disabled[name]; !ok && s.Match(name) {
+			r.disable(name, i)
+		}
+	}
+}
+
+// Enable stops the selector, one equal to one passed to Disable, disabling
+// metrics, and swaps the metrics it disabled back unless another selector
+// still disables them.  They're the metrics they were, which collected nothing
+// while the stubs stood in for them.
+func (r *StandardRegistry) Enable(s MetricSelector) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	key := s.String()
+	rules := r.disabledBy[:0]
+	for _, rule := range r.disabledBy {
+		if key != rule.String() {
+			rules = append(rules, rule)
+		}
+	}
+	r.disabledBy = rules
+	for name, i := range r.disabled {
+		if !r.disables(name) {
+			delete(r.disabled, name)
+			r.set(name, i)
+		}
+	}
+}
+
+// Disabled returns the selectors disabling metrics, in the order they were
+// passed to Disable.
+func (r *StandardRegistry) Disabled() []MetricSelector {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]MetricSelector(nil), r.disabledBy...)
+}
+
+// disables returns true if a selector disables the metric registered under
+// the given name.  It must be called with r.mutex held.
+func (r *StandardRegistry) disables(name string) bool {
+	for _, rule := range r.disabledBy {
+		if rule.Match(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// disable keeps i aside and registers its stub under the given key in its
+// place, returning the stub.  It must be called with r.mutex held.
+func (r *StandardRegistry) disable(name string, i interface{}) interface{} {
+	if nil == r.disabled {
+		r.disabled = make(map[string]interface{})
+	}
+	r.disabled[name] = i
+	stub := nilMetric(i)
+	r.set(name, stub)
+	return stub
+}
+
+// original returns the metric registered under the given key, i, or the one
+// i stands in for if it's disabled.  It must be called with r.mutex held.
+func (r *StandardRegistry) original(name string, i interface{}) interface{} {
+	if disabled, ok := r.disabled[name]; ok {
+		return disabled
+	}
+	return i
+}
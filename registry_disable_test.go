@@ -0,0 +1,93 @@
+package metrics
+
+import "testing"
+
+func TestMetricSelectorMatch(t *testing.T) {
+	for _, c := range []struct {
+		s    MetricSelector
+		name string
+		want bool
+	}{
+		{MetricSelector{}, "foo", true},
+		{MetricSelector{Name: "foo"}, "foo;a=b", true},
+		{MetricSelector{Name: "foo"}, "bar", false},
+		{MetricSelector{Tags: map[string]string{"a": "b"}}, "foo;a=b;c=d", true},
+		{MetricSelector{Name: "foo", Tags: map[string]string{"a": "b"}}, "foo;a=c", false},
+		{MetricSelector{Tags: map[string]string{"a": "b"}}, "foo", false},
+	} {
+		if got := c.s.Match(c.name); c.want != got {
+			t.Errorf("%v.Match(%q): %v != %v\n", c.s, c.name, c.want, got)
+		}
+	}
+}
+
+func TestRegistryDisable(t *testing.T) {
+	r := NewRegistry().(*StandardRegistry)
+	timer := GetOrRegisterTimer("db.query;table=users", r)
+	NewRegisteredTimer("db.query;table=orders", r)
+	GetOrRegisterCounter("requests", r).Inc(1)
+
+	s := MetricSelector{Name: "db.query", Tags: map[string]string{"table": "users"}}
+	r.Disable(s)
+	if _, ok := r.Get("db.query;table=users").(NilTimer); !ok {
+		t.Fatalf("Get(): %T, want NilTimer\n", r.Get("db.query;table=users"))
+	}
+	if _, ok := GetOrRegisterTimer("db.query;table=users", r).(NilTimer); !ok {
+		t.Error("GetOrRegisterTimer(): want NilTimer\n")
+	}
+	if _, ok := r.Get("db.query;table=orders").(*StandardTimer); !ok {
+		t.Errorf("Get(): %T, want *StandardTimer\n", r.Get("db.query;table=orders"))
+	}
+	var names []string
+	r.Each(func(name string, _ interface{}) { names = append(names, name) })
+	if 2 != len(names) {
+		t.Errorf("Each(): %v\n", names)
+	}
+	if _, ok := r.Delta("test")["db.query;table=users"]; ok {
+		t.Error("Delta(): reports a disabled timer\n")
+	}
+
+	r.Disable(MetricSelector{Name: "db.query"})
+	r.Disable(MetricSelector{Name: "db.query"})
+	if d := r.Disabled(); 2 != len(d) {
+		t.Errorf("Disabled(): %v\n", d)
+	}
+	later := GetOrRegisterTimer("db.query;table=items", r)
+	if _, ok := later.(NilTimer); !ok {
+		t.Errorf("GetOrRegisterTimer(): %T, want NilTimer\n", later)
+	}
+
+	r.Enable(s)
+	if _, ok := r.Get("db.query;table=users").(NilTimer); !ok {
+		t.Error("Enable(): enabled a timer another selector disables\n")
+	}
+	r.Enable(MetricSelector{Name: "db.query"})
+	if r.Get("db.query;table=users") != timer {
+		t.Errorf("Get(): %v != %v\n", timer, r.Get("db.query;table=users"))
+	}
+	if _, ok := r.Get("db.query;table=items").(*StandardTimer); !ok {
+		t.Errorf("Get(): %T, want the *StandardTimer registered while disabled\n", r.Get("db.query;table=items"))
+	}
+	if d := r.Disabled(); 0 != len(d) {
+		t.Errorf("Disabled(): %v\n", d)
+	}
+}
+
+func TestRegistryUnregisterDisabled(t *testing.T) {
+	r := NewRegistry().(*StandardRegistry)
+	meter := NewRegisteredMeter("foo", r).(*StandardMeter)
+	var unregistered interface{}
+	r.SetOnUnregister(func(_ string, i interface{}) { unregistered = i })
+	r.Disable(MetricSelector{Name: "foo"})
+	r.Unregister("foo")
+	if unregistered != meter {
+		t.Errorf("OnUnregister: %v != %v\n", meter, unregistered)
+	}
+	if 0 != len(r.disabled) {
+		t.Errorf("disabled: %v\n", r.disabled)
+	}
+	r.Enable(MetricSelector{Name: "foo"})
+	if nil != r.Get("foo") {
+		t.Errorf("Get(): %v, want nil\n", r.Get("foo"))
+	}
+}
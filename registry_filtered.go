@@ -0,0 +1,154 @@
+package metrics
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrReadOnlyRegistry is returned by registering a metric in a read-only view
+// of a registry, such as a FilteredRegistry.
+var ErrReadOnlyRegistry = errors.New("metrics: read-only registry")
+
+// FilteredRegistry is a read-only view of a registry which only holds the
+// metrics whose names match a predicate, so that one exporter or admin
+// endpoint can be given a scope of a registry without registering anything
+// twice.  The predicate is passed names as the underlying registry's Each
+// passes them, carrying the tags each metric was registered with but not
+// the registry's default tags; ReporterFilter.Match is one.
+//
+// Nothing can be registered or unregistered through the view: Register
+// returns ErrReadOnlyRegistry, the GetOrRegister* and NewRegistered*
+// constructors return matching metrics already registered or stubs,
+// EachAndUpdate ignores the Actions returned, and the rest are no-ops.
+// Closing the view leaves the underlying registry open, but reporters of the
+// view stop when the underlying registry is closed.
+type FilteredRegistry struct {
+	underlying Registry
+	match      func(name string) bool
+}
+
+// NewFilteredRegistry returns a view of parent holding the metrics whose
+// names match.
+func NewFilteredRegistry(parent Registry, match func(name string) bool) *FilteredRegistry {
+	return &FilteredRegistry{underlying: parent, match: match}
+}
+
+// Alias returns ErrReadOnlyRegistry.
+func (*FilteredRegistry) Alias(string, string) error { return ErrReadOnlyRegistry }
+
+// Clear is a no-op.
+func (*FilteredRegistry) Clear() {}
+
+// Close is a no-op.
+func (*FilteredRegistry) Close() {}
+
+// Delta returns the change in count of each matching counter, histogram,
+// meter and timer since the last call with the given consumer ID.  The
+// bookkeeping is the underlying registry's, so don't share a consumer ID
+// between views and the registry itself.
+func (r *FilteredRegistry) Delta(consumerID string) map[string]int64 {
+	deltas := r.underlying.Delta(consumerID)
+	for name := range deltas {
+		if !r.match(name) {
+			delete(deltas, name)
+		}
+	}
+	return deltas
+}
+
+// Each calls f for each matching metric.
+func (r *FilteredRegistry) Each(f func(string, interface{})) {
+	r.underlying.Each(func(name string, i interface{}) {
+		if r.match(name) {
+			f(name, i)
+		}
+	})
+}
+
+// EachAndUpdate calls f for each matching metric, keeping it whatever Action
+// f returns.
+func (r *FilteredRegistry) EachAndUpdate(f func(string, interface{}) Action) {
+	r.Each(func(name string, i interface{}) { f(name, i) })
+}
+
+// EachSnapshot calls f with a read-only snapshot of each matching metric, all
+// taken before f is first called.
+func (r *FilteredRegistry) EachSnapshot(f func(string, interface{})) {
+	eachSnapshot(r, f)
+}
+
+// Get returns the metric by the given name, or nil if none is registered or
+// it doesn't match.
+func (r *FilteredRegistry) Get(name string) interface{} {
+	if !r.match(TaggedName(name, nil)) {
+		return nil
+	}
+	return r.underlying.Get(name)
+}
+
+// GetAll returns the values of every matching metric by field, keyed by name.
+func (r *FilteredRegistry) GetAll() map[string]map[string]interface{} {
+	return getAll(r.EachSnapshot, RegistryPercentiles(r))
+}
+
+// GetOrRegister returns the matching metric by the given name, or the stub
+// equivalent of the given metric without registering it.
+func (r *FilteredRegistry) GetOrRegister(name string, i interface{}) interface{} {
+	if metric := r.Get(name); nil != metric {
+		return metric
+	}
+	return NilRegistry{}.GetOrRegister(name, i)
+}
+
+// Register returns ErrReadOnlyRegistry.
+func (*FilteredRegistry) Register(string, interface{}) error { return ErrReadOnlyRegistry }
+
+// ResetAll is a no-op, since the view is read-only.
+func (*FilteredRegistry) ResetAll() {}
+
+// RunHealthchecks runs the matching healthchecks.
+func (r *FilteredRegistry) RunHealthchecks() {
+	r.Each(func(_ string, i interface{}) {
+		if h, ok := i.(Healthcheck); ok {
+			h.Check()
+		}
+	})
+}
+
+// Snapshot returns read-only snapshots of every matching metric by name.
+func (r *FilteredRegistry) Snapshot() *RegistrySnapshot { return newRegistrySnapshot(r) }
+
+// SnapshotAndReset returns a new registry holding a read-only copy of every
+// matching metric.  Nothing is reset, since the view is read-only.
+func (r *FilteredRegistry) SnapshotAndReset() Registry {
+	snapshots := NewRegistry()
+	r.Each(func(name string, i interface{}) {
+		snapshots.Register(name, snapshotMetric(i))
+	})
+	return snapshots
+}
+
+// SubRegistryWithTags returns the view itself and a no-op, since nothing can
+// be registered through it.
+func (r *FilteredRegistry) SubRegistryWithTags(map[string]string) (Registry, func()) {
+	return r, func() {}
+}
+
+// Subscribe watches the metrics the view passes, as described for
+// StandardRegistry.
+func (r *FilteredRegistry) Subscribe(match func(string) bool, interval time.Duration, buffer int) *Subscription {
+	return subscribe(r, match, interval, buffer)
+}
+
+// Unregister is a no-op.
+func (*FilteredRegistry) Unregister(string) {}
+
+// UnregisterAll is a no-op.
+func (*FilteredRegistry) UnregisterAll() {}
+
+// UnregisterWithAliases is a no-op.
+func (*FilteredRegistry) UnregisterWithAliases(string) {}
+
+// UseNilMetrics returns true, so that constructors return stubs rather than
+// register metrics through the view.
+func (*FilteredRegistry) UseNilMetrics() bool { return true }
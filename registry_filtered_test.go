@@ -0,0 +1,77 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFilteredRegistry(t *testing.T) {
+	r := NewRegistry()
+	GetOrRegisterCounter("http.requests", r).Inc(1)
+	GetOrRegisterCounterT("http.errors", map[string]string{"code": "500"}, r).Inc(2)
+	GetOrRegisterGauge("db.connections", r).Update(3)
+	f := NewFilteredRegistry(r, func(name string) bool {
+		return strings.HasPrefix(name, "http.")
+	})
+
+	var names []string
+	f.Each(func(name string, _ interface{}) { names = append(names, name) })
+	if 2 != len(names) {
+		t.Fatalf("Each(): 2 != %v\n", names)
+	}
+	if nil != f.Get("db.connections") {
+		t.Errorf("Get(\"db.connections\"): nil != %v\n", f.Get("db.connections"))
+	}
+	if c, ok := f.Get("http.requests").(Counter); !ok || 1 != c.Count() {
+		t.Errorf("Get(\"http.requests\"): 1 != %v\n", f.Get("http.requests"))
+	}
+	if c, ok := f.Get(TaggedName("http.errors", map[string]string{"code": "500"})).(Counter); !ok || 2 != c.Count() {
+		t.Errorf("Get(\"http.errors;code=500\"): 2 != %v\n", c)
+	}
+
+	s := f.Snapshot()
+	if 2 != len(s.names) {
+		t.Errorf("Snapshot(): 2 != len(%v)\n", s.names)
+	}
+	if deltas := f.Delta("test"); 2 != len(deltas) || 1 != deltas["http.requests"] {
+		t.Errorf("Delta(): %v\n", deltas)
+	}
+}
+
+func TestFilteredRegistryReadOnly(t *testing.T) {
+	r := NewRegistry()
+	c := GetOrRegisterCounter("http.requests", r)
+	f := NewFilteredRegistry(r, ReporterFilter{Include: []string{"http."}}.Match)
+
+	if err := f.Register("http.new", NewCounter()); ErrReadOnlyRegistry != err {
+		t.Errorf("Register(): ErrReadOnlyRegistry != %v\n", err)
+	}
+	if got := GetOrRegisterCounter("http.requests", f); c != got {
+		t.Errorf("GetOrRegisterCounter(): %v != %v\n", c, got)
+	}
+	if _, ok := GetOrRegisterCounter("http.other", f).(NilCounter); !ok {
+		t.Errorf("GetOrRegisterCounter(\"http.other\"): not a NilCounter\n")
+	}
+	if _, ok := NewRegisteredMeter("http.meter", f).(NilMeter); !ok {
+		t.Errorf("NewRegisteredMeter(): not a NilMeter\n")
+	}
+	f.EachAndUpdate(func(string, interface{}) Action { return ActionUnregister })
+	f.Unregister("http.requests")
+	f.UnregisterAll()
+	f.Clear()
+	f.Close()
+	if 1 != len(r.Snapshot().names) {
+		t.Errorf("underlying registry changed: %v\n", r.Snapshot().names)
+	}
+	select {
+	case <-Closed(f):
+		t.Errorf("Closed(): closed by closing the view\n")
+	default:
+	}
+	r.Close()
+	select {
+	case <-Closed(f):
+	default:
+		t.Errorf("Closed(): not closed with the underlying registry\n")
+	}
+}
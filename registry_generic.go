@@ -0,0 +1,59 @@
+//go:build go1.18
+// +build go1.18
+
+package metrics
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// RegisterMetric registers m by the given name in r, or DefaultRegistry if r
+// is nil, and returns it, typed, or the metric already registered by that
+// name.  It panics if that metric isn't a T, e.g. a counter registered where
+// a timer is expected, which would otherwise panic in a type assertion at the
+// caller or go unnoticed:
+//
+//	requests := metrics.RegisterMetric(r, "requests", metrics.NewCounter())
+//
+// While the registry uses nil metrics, the stub of m is returned if it's a
+// T, such as a NilCounter for a Counter, and m itself otherwise.
+func RegisterMetric[T any](r Registry, name string, m T) T {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	return typedMetric(r, name, getOrRegister(r, name, m, nilMetric(m)), m)
+}
+
+// GetOrRegisterMetric returns the metric registered by the given name in r,
+// or DefaultRegistry if r is nil, typed, or registers and returns the one
+// newMetric constructs, which is only called if none is.  It panics as
+// RegisterMetric does:
+//
+//	latency := metrics.GetOrRegisterMetric(r, "latency", metrics.NewTimer)
+func GetOrRegisterMetric[T any](r Registry, name string, newMetric func() T) T {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	if usesNilMetrics(r) {
+		if i := r.Get(name); nil != i {
+			return typedMetric(r, name, i, *new(T))
+		}
+		m := newMetric()
+		stopMetric(m)
+		return typedMetric(r, name, nilMetric(m), m)
+	}
+	return typedMetric(r, name, r.GetOrRegister(name, newMetric), *new(T))
+}
+
+// typedMetric returns i as a T, or m if it's a nil metric which isn't one.
+// It panics if a metric registered by name isn't a T.
+func typedMetric[T any](r Registry, name string, i interface{}, m T) T {
+	if t, ok := i.(T); ok {
+		return t
+	}
+	if usesNilMetrics(r) && nil == r.Get(name) {
+		return m
+	}
+	panic(fmt.Sprintf("metrics: %s is registered as a %T, not a %v", name, i, reflect.TypeOf((*T)(nil)).Elem()))
+}
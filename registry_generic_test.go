@@ -0,0 +1,54 @@
+//go:build go1.18
+// +build go1.18
+
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRegisterMetric(t *testing.T) {
+	r := NewRegistry()
+	c := RegisterMetric(r, "foo", NewCounter())
+	c.Inc(1)
+	if c2 := RegisterMetric(r, "foo", NewCounter()); c != c2 || 1 != c2.Count() {
+		t.Errorf("RegisterMetric(): %v != %v\n", c, c2)
+	}
+	if s := RegisterMetric(r, "bar", NewCounter().(*StandardCounter)); s != r.Get("bar") {
+		t.Errorf("RegisterMetric(): %v != %v\n", s, r.Get("bar"))
+	}
+}
+
+func TestGetOrRegisterMetric(t *testing.T) {
+	r := NewRegistry()
+	tm := GetOrRegisterMetric(r, "latency", NewTimer)
+	defer tm.Stop()
+	calls := 0
+	tm2 := GetOrRegisterMetric(r, "latency", func() Timer { calls++; return NewTimer() })
+	if tm != tm2 || 0 != calls {
+		t.Errorf("GetOrRegisterMetric(): %v != %v, %d calls\n", tm, tm2, calls)
+	}
+}
+
+func TestGetOrRegisterMetricWrongType(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredCounter("foo", r)
+	defer func() {
+		msg, _ := recover().(string)
+		if !strings.Contains(msg, "foo is registered as a *metrics.StandardCounter, not a metrics.Timer") {
+			t.Errorf("recover(): %q\n", msg)
+		}
+	}()
+	GetOrRegisterMetric(r, "foo", NewTimer)
+}
+
+func TestGetOrRegisterMetricNil(t *testing.T) {
+	if _, ok := GetOrRegisterMetric(NilRegistry{}, "foo", NewCounter).(NilCounter); !ok {
+		t.Error("GetOrRegisterMetric(NilRegistry{}): not a NilCounter")
+	}
+	c := NewCounter().(*StandardCounter)
+	if got := RegisterMetric(NilRegistry{}, "foo", c); c != got {
+		t.Errorf("RegisterMetric(NilRegistry{}): %v != %v\n", c, got)
+	}
+}
@@ -0,0 +1,64 @@
+package metrics
+
+import "fmt"
+
+// A RegisterHook is called with the name, tags included as TaggedName renders
+// them, and the metric of each metric about to be registered, and returns the
+// name and metric to register instead, e.g. the metric wrapped or its name
+// with tags added, or an error to refuse to register it.  A hook which changes
+// nothing returns what it was given.
+type RegisterHook func(name string, i interface{}) (string, interface{}, error)
+
+// DeniedMetric is the error of a RegisterHook such as DenyMetrics refusing to
+// register the metric by the given name.
+type DeniedMetric string
+
+func (err DeniedMetric) Error() string {
+	return fmt.Sprintf("metric %q denied", string(err))
+}
+
+// DenyMetrics returns a RegisterHook refusing to register every metric the
+// selectors select, e.g. series of a high-cardinality timer some library
+// registers, with a DeniedMetric.
+func DenyMetrics(selectors ...MetricSelector) RegisterHook {
+	return func(name string, i interface{}) (string, interface{}, error) {
+		for _, s := range selectors {
+			if s.Match(name) {
+				return name, i, DeniedMetric(name)
+			}
+		}
+		return name, i, nil
+	}
+}
+
+// OnRegister adds a hook called on every metric registered from now on, by
+// Register, GetOrRegister and the GetOrRegisterXxx and NewRegisteredXxx
+// functions, so that policies such as sampling every timer, tagging metrics
+// by name or denying names apply without changing the code registering them.
+// Hooks are called in the order they were added, each with what the one
+// before returned, before tags are sanitized and series limited.
+//
+// Where a hook replaces a metric, GetOrRegister returns the replacement, so
+// the replacement must be of the same kind, e.g. a Timer in place of a Timer.
+// Where a hook refuses one, Register returns its error and GetOrRegister
+// returns the metric without registering it.  A hook adding tags to the name
+// makes GetOrRegister, which looks metrics up by the name it's given, wait on
+// the registry's lock every call; SetDefaultTags is cheaper for tags on every
+// metric.  Hooks are called with the registry locked, so they mustn't use it.
+func (r *StandardRegistry) OnRegister(hook RegisterHook) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.hooks = append(r.hooks, hook)
+}
+
+// runHooks passes the name and metric through every hook in turn, stopping at
+// the first error.  It must be called with r.mutex held.
+func (r *StandardRegistry) runHooks(name string, i interface{}) (string, interface{}, error) {
+	for _, hook := range r.hooks {
+		var err error
+		if name, i, err = hook(name, i); nil != err {
+			return name, i, err
+		}
+	}
+	return name, i, nil
+}
@@ -0,0 +1,89 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestOnRegisterWrap(t *testing.T) {
+	r := NewRegistry().(*StandardRegistry)
+	r.OnRegister(func(name string, i interface{}) (string, interface{}, error) {
+		if timer, ok := i.(Timer); ok {
+			return name, NewSampledTimer(timer, Sampling{Every: 10}), nil
+		}
+		return name, i, nil
+	})
+	timer := GetOrRegisterTimer("latency", r)
+	if _, ok := timer.(*SampledTimer); !ok {
+		t.Fatalf("GetOrRegisterTimer(): %T\n", timer)
+	}
+	if other := GetOrRegisterTimer("latency", r); other != timer {
+		t.Errorf("GetOrRegisterTimer(): %p != %p\n", other, timer)
+	}
+	if _, ok := r.Get("latency").(*SampledTimer); !ok {
+		t.Errorf("r.Get(): %T\n", r.Get("latency"))
+	}
+	GetOrRegisterCounter("hits", r)
+	if _, ok := r.Get("hits").(*SampledTimer); ok {
+		t.Error("counter wrapped\n")
+	}
+}
+
+func TestOnRegisterTags(t *testing.T) {
+	r := NewRegistry().(*StandardRegistry)
+	r.OnRegister(func(name string, i interface{}) (string, interface{}, error) {
+		if strings.HasPrefix(name, "db.") {
+			name = NewTags(map[string]string{"subsystem": "db"}).Name(name)
+		}
+		return name, i, nil
+	})
+	c := GetOrRegisterCounter("db.queries", r)
+	c.Inc(1)
+	if nil == r.Get("db.queries;subsystem=db") {
+		t.Fatal("db.queries;subsystem=db not registered\n")
+	}
+	if other := GetOrRegisterCounter("db.queries", r); other != c {
+		t.Errorf("GetOrRegisterCounter(): %p != %p\n", other, c)
+	}
+	if nil != r.Get("db.queries") {
+		t.Error("db.queries registered untagged\n")
+	}
+}
+
+func TestOnRegisterChain(t *testing.T) {
+	r := NewRegistry().(*StandardRegistry)
+	var order []string
+	for _, suffix := range []string{"a", "b"} {
+		suffix := suffix
+		r.OnRegister(func(name string, i interface{}) (string, interface{}, error) {
+			order = append(order, name)
+			return name + "." + suffix, i, nil
+		})
+	}
+	r.Register("foo", NewCounter())
+	if "foo foo.a" != strings.Join(order, " ") {
+		t.Errorf("hooks called with %v\n", order)
+	}
+	if nil == r.Get("foo.a.b") {
+		t.Error("foo.a.b not registered\n")
+	}
+}
+
+func TestDenyMetrics(t *testing.T) {
+	r := NewRegistry().(*StandardRegistry)
+	r.OnRegister(DenyMetrics(MetricSelector{Name: "debug"}, MetricSelector{Tags: map[string]string{"user": "x"}}))
+	if err := r.Register("debug", NewCounter()); DeniedMetric("debug") != err {
+		t.Errorf("r.Register(): %v\n", err)
+	}
+	c := GetOrRegisterCounterT("logins", map[string]string{"user": "x"}, r)
+	c.Inc(1)
+	if 1 != c.Count() {
+		t.Errorf("c.Count(): 1 != %v\n", c.Count())
+	}
+	if nil != r.Get("logins;user=x") {
+		t.Error("logins;user=x registered\n")
+	}
+	if err := r.Register("logins", NewCounter()); nil != err {
+		t.Errorf("r.Register(): %v\n", err)
+	}
+}
@@ -0,0 +1,175 @@
+package metrics
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultTenantTag is the tag a RegistryManager identifies tenants by when
+// it's given none.
+const DefaultTenantTag = "tenant"
+
+// RegistryManager keeps a child registry per tenant, e.g. per customer of a
+// service, created the first time it's asked for and, once idle timeouts are
+// set, unregistered again once the tenant has been idle.  Each child is a
+// TaggedSubRegistry of one parent registry, tagging its metrics with the
+// tenant's ID, so the parent holds every tenant's series and View exports
+// them together.
+type RegistryManager struct {
+	parent Registry
+	tag    string
+
+	mutex   sync.RWMutex // Guards tenants
+	tenants map[string]*tenantRegistry
+
+	idleMutex sync.Mutex // Guards idleDone
+	idleDone  chan struct{}
+}
+
+// tenantRegistry is the child registry of a tenant, stamped whenever it's
+// asked for.
+type tenantRegistry struct {
+	lastUpdate
+	r *TaggedSubRegistry
+}
+
+// NewRegistryManager constructs a RegistryManager registering the metrics of
+// every tenant in parent, or in a new registry if it's nil, tagged with the
+// given tag, or DefaultTenantTag if it's empty.
+func NewRegistryManager(parent Registry, tag string) *RegistryManager {
+	if nil == parent {
+		parent = NewRegistry()
+	}
+	if "" == tag {
+		tag = DefaultTenantTag
+	}
+	return &RegistryManager{
+		parent:  parent,
+		tag:     tag,
+		tenants: make(map[string]*tenantRegistry),
+	}
+}
+
+// Close stops evicting idle tenants.  It leaves their metrics registered and
+// the parent registry open.
+func (m *RegistryManager) Close() {
+	m.SetIdleTimeout(0)
+}
+
+// Evict unregisters every metric of the given tenant and forgets it, so that
+// asking for it again creates a new child registry.
+func (m *RegistryManager) Evict(id string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if t, ok := m.tenants[id]; ok {
+		t.r.Clear()
+		delete(m.tenants, id)
+	}
+}
+
+// SetIdleTimeout makes the manager evict, as Evict does, every tenant which
+// hasn't been asked for and none of whose metrics have been updated within
+// the given timeout, so that tenants which have gone away don't keep their
+// series forever, or stops it evicting tenants if timeout is zero.  Like
+// StandardRegistry.SetTTL, a goroutine checks every quarter of the timeout,
+// until the parent registry is closed, so tenants are evicted between one and
+// one and a half timeouts after they were last active.
+//
+// Code holding a tenant's registry or its metrics across requests keeps
+// updating them after the tenant's evicted, unseen by reporters, so ask for
+// the tenant's registry on each use while idle timeouts are set.
+func (m *RegistryManager) SetIdleTimeout(timeout time.Duration) {
+	m.idleMutex.Lock()
+	defer m.idleMutex.Unlock()
+	if nil != m.idleDone {
+		close(m.idleDone)
+		m.idleDone = nil
+	}
+	if timeout <= 0 {
+		return
+	}
+	advanceClock(now())
+	m.mutex.RLock()
+	for _, t := range m.tenants {
+		t.touch()
+		t.r.Each(func(_ string, i interface{}) { touchMetric(i) })
+	}
+	m.mutex.RUnlock()
+	m.idleDone = make(chan struct{})
+	go every(tick(timeout/4), m.idleDone, Closed(m.parent), func(now time.Time) {
+		advanceClock(now)
+		m.evictIdle(now, timeout+timeout/4)
+	})
+}
+
+// Tenant returns the child registry of the tenant by the given ID, which tags
+// its metrics with the ID, creating it if there's none.  It's cheap enough to
+// call on every request.
+func (m *RegistryManager) Tenant(id string) Registry {
+	m.mutex.RLock()
+	t, ok := m.tenants[id]
+	if ok {
+		// Stamped under the lock, so it can't be evicted in between.
+		t.touch()
+	}
+	m.mutex.RUnlock()
+	if ok {
+		return t.r
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if t, ok = m.tenants[id]; !ok {
+		r, _ := NewTaggedSubRegistry(m.parent, map[string]string{m.tag: id})
+		t = &tenantRegistry{r: r}
+		m.tenants[id] = t
+	}
+	t.touch()
+	return t.r
+}
+
+// Tenants returns the IDs of the tenants which have child registries, sorted.
+func (m *RegistryManager) Tenants() []string {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	ids := make([]string, 0, len(m.tenants))
+	for id := range m.tenants {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// View returns a read-only view of the metrics of every tenant, each carrying
+// the tenant's tag, for reporters and handlers to export together.  It leaves
+// out any metric registered in the parent registry without the tag.
+func (m *RegistryManager) View() *FilteredRegistry {
+	return NewFilteredRegistry(m.parent, func(name string) bool {
+		_, tags := SplitTaggedName(name)
+		_, ok := tags[m.tag]
+		return ok
+	})
+}
+
+// evictIdle evicts the tenants neither asked for nor updated since age before
+// now.
+func (m *RegistryManager) evictIdle(now time.Time, age time.Duration) {
+	cutoff := now.Add(-age)
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for id, t := range m.tenants {
+		if !t.LastUpdated().Before(cutoff) {
+			continue
+		}
+		idle := true
+		t.r.Each(func(_ string, i interface{}) {
+			if e, ok := i.(expirable); ok && !e.LastUpdated().Before(cutoff) {
+				idle = false
+			}
+		})
+		if idle {
+			t.r.Clear()
+			delete(m.tenants, id)
+		}
+	}
+}
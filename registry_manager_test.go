@@ -0,0 +1,85 @@
+package metrics
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRegistryManager(t *testing.T) {
+	parent := NewRegistry()
+	GetOrRegisterCounter("untenanted", parent).Inc(1)
+	GetOrRegisterCounterT("lookalike", map[string]string{"note;tenant": "b"}, parent).Inc(1)
+	m := NewRegistryManager(parent, "")
+	GetOrRegisterCounter("requests", m.Tenant("acme")).Inc(2)
+	GetOrRegisterCounter("requests", m.Tenant("globex")).Inc(3)
+	GetOrRegisterCounter("requests", m.Tenant("acme")).Inc(4)
+	if ids := m.Tenants(); !reflect.DeepEqual([]string{"acme", "globex"}, ids) {
+		t.Errorf("m.Tenants(): %v\n", ids)
+	}
+	var names []string
+	m.Tenant("acme").Each(func(name string, _ interface{}) { names = append(names, name) })
+	if !reflect.DeepEqual([]string{"requests;tenant=acme"}, names) {
+		t.Errorf("Tenant(\"acme\").Each(): %v\n", names)
+	}
+	s := m.View().Snapshot()
+	if !reflect.DeepEqual([]string{"requests;tenant=acme", "requests;tenant=globex"}, s.Names()) {
+		t.Errorf("m.View().Snapshot().Names(): %v\n", s.Names())
+	}
+	if c, ok := s.Get("requests;tenant=acme").(CounterSnapshot); !ok || 6 != c.Count() {
+		t.Errorf("requests;tenant=acme: %#v\n", s.Get("requests;tenant=acme"))
+	}
+	if err := m.View().Register("foo", NewCounter()); ErrReadOnlyRegistry != err {
+		t.Errorf("m.View().Register(): %v\n", err)
+	}
+
+	m.Evict("globex")
+	if nil != parent.Get("requests;tenant=globex") {
+		t.Error("evicted tenant's counter still registered\n")
+	}
+	if ids := m.Tenants(); !reflect.DeepEqual([]string{"acme"}, ids) {
+		t.Errorf("m.Tenants(): %v\n", ids)
+	}
+}
+
+func TestRegistryManagerEvictIdle(t *testing.T) {
+	parent := NewRegistry()
+	m := NewRegistryManager(parent, "customer")
+	// The clock never goes back, so don't move it past the present.
+	now := time.Now()
+	advanceClock(now)
+	GetOrRegisterCounter("requests", m.Tenant("idle"))
+	busy := GetOrRegisterCounter("requests", m.Tenant("busy"))
+	m.Tenant("asked")
+
+	time.Sleep(2 * time.Millisecond)
+	later := time.Now()
+	advanceClock(later)
+	busy.Inc(1)
+	m.Tenant("asked")
+
+	m.evictIdle(later, later.Sub(now)/2)
+	if ids := m.Tenants(); !reflect.DeepEqual([]string{"asked", "busy"}, ids) {
+		t.Errorf("m.Tenants(): %v\n", ids)
+	}
+	if nil != parent.Get("requests;customer=idle") {
+		t.Error("idle tenant's counter still registered\n")
+	}
+	if nil == parent.Get("requests;customer=busy") {
+		t.Error("busy tenant's counter unregistered\n")
+	}
+}
+
+func TestRegistryManagerSetIdleTimeout(t *testing.T) {
+	m := NewRegistryManager(nil, "")
+	defer m.Close()
+	m.Tenant("acme")
+	m.SetIdleTimeout(4 * time.Millisecond)
+	deadline := time.Now().Add(time.Second)
+	for 0 != len(m.Tenants()) {
+		if time.Now().After(deadline) {
+			t.Fatal("idle tenant never evicted\n")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,192 @@
+package metrics
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultSubscriptionBuffer is the number of events a Subscription buffers
+// when Subscribe is given a buffer of zero.
+const DefaultSubscriptionBuffer = 1024
+
+// DefaultSubscriptionInterval is how often a Subscription compares values
+// when Subscribe is given an interval which isn't positive.
+const DefaultSubscriptionInterval = time.Second
+
+// A MetricEvent tells a Subscription that a metric's value changed.
+type MetricEvent struct {
+	Name     string            // Name of the metric, without tags
+	Tags     map[string]string // Tags of the metric, the registry's default tags included
+	Time     time.Time         // When the change was observed
+	Value    float64           // Count of a counter, meter, histogram or timer, or value of a gauge
+	Delta    float64           // Change in Value since the last event, or Value for a metric new since the last check
+	Snapshot interface{}       // Snapshot of the metric when the change was observed
+}
+
+// A Subscription delivers events for the metrics of a registry whose values
+// change, for what watches them, such as debug UIs and anomaly detectors,
+// without their polling snapshots.  See StandardRegistry.Subscribe.
+type Subscription struct {
+	r       Registry
+	match   func(name string) bool
+	events  chan MetricEvent
+	dropped int64 // accessed atomically
+
+	mutex  sync.Mutex // Guards values and closed, and serializes checks
+	values map[string]float64
+	closed bool
+
+	stop chan struct{}
+	once sync.Once
+}
+
+// Subscribe starts watching the metrics whose names, tags and default tags
+// included, match selects, or every metric if it's nil, e.g. a
+// MetricSelector's or ReporterFilter's Match, and returns a Subscription
+// delivering an event for each whose value changes.
+//
+// Metrics mustn't slow down to tell anyone about updates, so values are
+// compared every interval, or DefaultSubscriptionInterval if it isn't
+// positive, and a metric updated several times in between
+// yields one event with the sum of their changes as its Delta.  Metrics
+// registered at the time of subscribing yield events once they change, those
+// registered later once they're first seen.  Healthchecks and metrics of other
+// kinds yield none.
+//
+// The channel of events has room for buffer of them, or
+// DefaultSubscriptionBuffer if it's zero.  Events which don't fit are dropped
+// rather than hold up the registry, and counted; see Dropped.  The
+// subscription lasts until it's closed or the registry is.
+func (r *StandardRegistry) Subscribe(match func(name string) bool, interval time.Duration, buffer int) *Subscription {
+	return subscribe(r, match, interval, buffer)
+}
+
+// subscribe is Subscribe for any registry, watching the metrics its Each
+// passes under the names it passes them by.
+func subscribe(r Registry, match func(name string) bool, interval time.Duration, buffer int) *Subscription {
+	if interval <= 0 {
+		interval = DefaultSubscriptionInterval
+	}
+	if 0 == buffer {
+		buffer = DefaultSubscriptionBuffer
+	}
+	s := &Subscription{
+		r:      r,
+		match:  match,
+		events: make(chan MetricEvent, buffer),
+		values: make(map[string]float64),
+		stop:   make(chan struct{}),
+	}
+	s.observe(now(), false)
+	t := tick(interval)
+	go func() {
+		every(t, s.stop, Closed(r), s.observeChanges)
+		s.Close()
+	}()
+	return s
+}
+
+// C returns the channel on which events are delivered, which is closed once
+// the subscription is.
+func (s *Subscription) C() <-chan MetricEvent {
+	return s.events
+}
+
+// Check compares the values of the metrics watched now rather than waiting
+// for the next interval, e.g. before rendering a debug page.
+func (s *Subscription) Check() {
+	s.observeChanges(now())
+}
+
+// Close stops watching metrics and closes the channel of events, once any
+// check under way has finished.  It's safe to call more than once.
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		close(s.stop)
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		s.closed = true
+		close(s.events)
+	})
+}
+
+// Dropped returns the number of events dropped because the channel of events
+// was full, e.g. to export as a FunctionalGauge.
+func (s *Subscription) Dropped() int64 {
+	return atomic.LoadInt64(&s.dropped)
+}
+
+// observeChanges compares the values of the metrics watched with those last
+// observed and delivers events for those which changed.
+func (s *Subscription) observeChanges(t time.Time) {
+	s.observe(t, true)
+}
+
+// observe records the value of every metric watched, delivering events if
+// deliver is true, and forgets those no longer registered.
+func (s *Subscription) observe(t time.Time, deliver bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return
+	}
+	defaults := defaultTagsOf(s.r)
+	seen := make(map[string]struct{}, len(s.values))
+	s.r.Each(func(name string, i interface{}) {
+		name = withDefaultTags(name, defaults)
+		if nil != s.match && !s.match(name) {
+			return
+		}
+		v, ok := eventValue(i)
+		if !ok {
+			return
+		}
+		seen[name] = struct{}{}
+		last, known := s.values[name]
+		if known && (v == last || math.IsNaN(v) && math.IsNaN(last)) {
+			return
+		}
+		s.values[name] = v
+		if !deliver {
+			return
+		}
+		e := MetricEvent{Time: t, Value: v, Delta: v - last, Snapshot: snapshotMetric(i)}
+		e.Name, e.Tags = SplitTaggedName(name)
+		select {
+		case s.events <- e:
+		default:
+			atomic.AddInt64(&s.dropped, 1)
+		}
+	})
+	for name := range s.values {
+		if _, ok := seen[name]; !ok {
+			delete(s.values, name)
+		}
+	}
+}
+
+// eventValue returns the value of a metric a MetricEvent reports, and false
+// for metrics of kinds which have none.
+func eventValue(i interface{}) (float64, bool) {
+	switch m := i.(type) {
+	case Counter:
+		return float64(m.Count()), true
+	case CounterFloat64:
+		return m.Count(), true
+	case Gauge:
+		return float64(m.Value()), true
+	case GaugeFloat64:
+		return m.Value(), true
+	case Histogram:
+		return float64(m.Count()), true
+	case Meter:
+		return float64(m.Count()), true
+	case MergeableGaugeFloat64:
+		return m.Value(), true
+	case Timer:
+		return float64(m.Count()), true
+	}
+	return 0, false
+}
@@ -0,0 +1,155 @@
+package metrics
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSubscribe(t *testing.T) {
+	r := NewRegistry().(*StandardRegistry)
+	r.SetDefaultTags(map[string]string{"host": "a"})
+	hits := GetOrRegisterCounterT("hits", map[string]string{"endpoint": "/users"}, r)
+	hits.Inc(1)
+	depth := NewRegisteredGauge("depth", r)
+	NewRegisteredHealthcheck("db", r, func(Healthcheck) {})
+	s := r.Subscribe(nil, time.Hour, 0)
+	defer s.Close()
+	s.Check()
+	if n := len(s.C()); 0 != n {
+		t.Fatalf("%d events without changes\n", n)
+	}
+	hits.Inc(2)
+	hits.Inc(3)
+	s.Check()
+	e := <-s.C()
+	if "hits" != e.Name || 6 != e.Value || 5 != e.Delta || !reflect.DeepEqual(map[string]string{"endpoint": "/users", "host": "a"}, e.Tags) {
+		t.Errorf("event: %+v\n", e)
+	}
+	if c, ok := e.Snapshot.(CounterSnapshot); !ok || 6 != c.Count() {
+		t.Errorf("event.Snapshot: %#v\n", e.Snapshot)
+	}
+	depth.Update(0)
+	NewRegisteredMeter("requests", r).Mark(4)
+	s.Check()
+	if e := <-s.C(); "requests" != e.Name || 4 != e.Value || 4 != e.Delta {
+		t.Errorf("event: %+v\n", e)
+	}
+	if n := len(s.C()); 0 != n {
+		t.Errorf("%d events left over\n", n)
+	}
+}
+
+func TestSubscribeMatch(t *testing.T) {
+	r := NewRegistry().(*StandardRegistry)
+	s := r.Subscribe(func(name string) bool { return strings.HasPrefix(name, "db.") }, time.Hour, 0)
+	defer s.Close()
+	NewRegisteredCounter("db.queries", r).Inc(1)
+	NewRegisteredCounter("http.requests", r).Inc(1)
+	s.Check()
+	if e := <-s.C(); "db.queries" != e.Name {
+		t.Errorf("event: %+v\n", e)
+	}
+	if n := len(s.C()); 0 != n {
+		t.Errorf("%d events left over\n", n)
+	}
+}
+
+func TestSubscribeDropped(t *testing.T) {
+	r := NewRegistry().(*StandardRegistry)
+	s := r.Subscribe(nil, time.Hour, 1)
+	defer s.Close()
+	c := NewRegisteredCounter("hits", r)
+	for i := 0; i < 3; i++ {
+		c.Inc(1)
+		s.Check()
+	}
+	if n := s.Dropped(); 2 != n {
+		t.Errorf("s.Dropped(): 2 != %v\n", n)
+	}
+	if e := <-s.C(); 1 != e.Value {
+		t.Errorf("event: %+v\n", e)
+	}
+}
+
+func TestSubscribeClose(t *testing.T) {
+	r := NewRegistry().(*StandardRegistry)
+	s := r.Subscribe(nil, time.Millisecond, 0)
+	r.Close()
+	select {
+	case _, ok := <-s.C():
+		if ok {
+			t.Error("event after closing\n")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("subscription outlived its registry\n")
+	}
+	s.Close()
+	s.Check()
+}
+
+// tickerClock is the system clock recording the period of each ticker made.
+type tickerClock struct {
+	SystemClock
+	mutex   sync.Mutex
+	periods map[time.Duration]int
+}
+
+func (c *tickerClock) Ticker(d time.Duration) Ticker {
+	c.mutex.Lock()
+	c.periods[d]++
+	c.mutex.Unlock()
+	return c.SystemClock.Ticker(d)
+}
+
+func TestSubscribeDefaultInterval(t *testing.T) {
+	clock := &tickerClock{periods: make(map[time.Duration]int)}
+	SetClock(clock)
+	defer SetClock(nil)
+	r := NewRegistry()
+	for _, interval := range []time.Duration{0, -time.Second} {
+		r.Subscribe(nil, interval, 0).Close()
+	}
+	clock.mutex.Lock()
+	defer clock.mutex.Unlock()
+	if n := clock.periods[DefaultSubscriptionInterval]; n < 2 {
+		t.Errorf("tickers of DefaultSubscriptionInterval: 2 > %v\n", n)
+	}
+}
+
+func TestSubscribeChildRegistries(t *testing.T) {
+	r := NewRegistry()
+	tagged, _ := r.SubRegistryWithTags(map[string]string{"tenant": "acme"})
+	for name, c := range map[string]struct {
+		r    Registry
+		want string
+	}{
+		"prefixed": {NewPrefixedChildRegistry(r, "db."), "db.queries"},
+		"tagged":   {tagged, "queries"},
+		"mapped":   {NewMappedRegistry(r, strings.ToUpper), "QUERIES"},
+		"delta":    {NewDeltaRegistry(r, "subscribe"), "queries"},
+		"filtered": {NewFilteredRegistry(r, func(string) bool { return true }), "queries"},
+	} {
+		s := c.r.Subscribe(nil, time.Hour, 0)
+		counter := NewCounter()
+		if _, readOnly := c.r.(*FilteredRegistry); readOnly {
+			r.Register("queries", counter)
+		} else {
+			c.r.Register("queries", counter)
+		}
+		counter.Inc(1)
+		s.Check()
+		select {
+		case e := <-s.C():
+			if c.want != e.Name || 1 != e.Value {
+				t.Errorf("%s: event: %+v\n", name, e)
+			}
+		default:
+			t.Errorf("%s: no event\n", name)
+		}
+		s.Close()
+		r.UnregisterAll()
+	}
+}
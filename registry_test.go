@@ -1,7 +1,14 @@
 package metrics
 
 import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"runtime"
+	"sync"
 	"testing"
+	"time"
 )
 
 func BenchmarkRegistry(b *testing.B) {
@@ -13,6 +20,66 @@ func BenchmarkRegistry(b *testing.B) {
 	}
 }
 
+// BenchmarkRegistryGetParallel looks up a registered counter from many
+// goroutines at once, both as Get does and behind the registry's mutex, as
+// Get used to, to show what lock-free lookups save under contention.
+func BenchmarkRegistryGetParallel(b *testing.B) {
+	r := NewRegistry().(*StandardRegistry)
+	r.Register("foo", NewCounter())
+	lockedGet := func(name string) interface{} {
+		name = r.key(name)
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+		return r.metrics[name]
+	}
+	for _, goroutines := range []int{1, 64, 256} {
+		parallelism := (goroutines + runtime.GOMAXPROCS(0) - 1) / runtime.GOMAXPROCS(0)
+		b.Run(fmt.Sprintf("lock-free-%d", goroutines), func(b *testing.B) {
+			b.SetParallelism(parallelism)
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					_ = r.Get("foo").(Counter)
+				}
+			})
+		})
+		b.Run(fmt.Sprintf("mutex-%d", goroutines), func(b *testing.B) {
+			b.SetParallelism(parallelism)
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					_ = lockedGet("foo").(Counter)
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkRegistryGetOrRegisterParallel looks up a registered counter by
+// GetOrRegisterCounter from 64 or more goroutines at once.
+func BenchmarkRegistryGetOrRegisterParallel(b *testing.B) {
+	r := NewRegistry()
+	GetOrRegisterCounter("foo", r)
+	b.SetParallelism((64 + runtime.GOMAXPROCS(0) - 1) / runtime.GOMAXPROCS(0))
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			GetOrRegisterCounter("foo", r)
+		}
+	})
+}
+
+// BenchmarkRegistryGetOrRegisterTaggedParallel looks up tagged series, whose
+// names are parsed on every lookup, from many goroutines at once.
+func BenchmarkRegistryGetOrRegisterTaggedParallel(b *testing.B) {
+	r := NewRegistry()
+	tags := map[string]string{"endpoint": "/users", "method": "GET"}
+	GetOrRegisterCounterT("requests", tags, r)
+	b.SetParallelism((64 + runtime.GOMAXPROCS(0) - 1) / runtime.GOMAXPROCS(0))
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			GetOrRegisterCounterT("requests", tags, r)
+		}
+	})
+}
+
 func TestRegistry(t *testing.T) {
 	r := NewRegistry()
 	r.Register("foo", NewCounter())
@@ -69,6 +136,36 @@ func TestRegistryGet(t *testing.T) {
 	}
 }
 
+func TestRegistryGetAll(t *testing.T) {
+	r := NewRegistry()
+	GetOrRegisterCounter("foo", r).Inc(47)
+	GetOrRegisterMeterT("bar", map[string]string{"host": "a"}, r).Mark(1)
+	GetOrRegisterHistogram("baz", r, NewUniformSample(100)).Update(3)
+	all := r.GetAll()
+	if 3 != len(all) {
+		t.Fatalf("GetAll(): 3 != len(%v)\n", all)
+	}
+	if count := all["foo"]["count"]; int64(47) != count {
+		t.Errorf("GetAll()[\"foo\"][\"count\"]: 47 != %v\n", count)
+	}
+	bar := all[TaggedName("bar", map[string]string{"host": "a"})]
+	if _, ok := bar["1m.rate"]; !ok {
+		t.Errorf("GetAll(): no 1m.rate in %v\n", bar)
+	}
+	if tags, _ := bar["tags"].(map[string]string); "a" != tags["host"] {
+		t.Errorf("GetAll(): tags: %v\n", bar["tags"])
+	}
+	if p95 := all["baz"]["95%"]; 3.0 != p95 {
+		t.Errorf("GetAll()[\"baz\"][\"95%%\"]: 3 != %v\n", p95)
+	}
+	if all := NewPrefixedChildRegistry(r, "x.").GetAll(); 0 != len(all) {
+		t.Errorf("PrefixedRegistry.GetAll(): 0 != len(%v)\n", all)
+	}
+	if all := (NilRegistry{}).GetAll(); nil == all || 0 != len(all) {
+		t.Errorf("NilRegistry.GetAll(): %v\n", all)
+	}
+}
+
 func TestRegistryGetOrRegister(t *testing.T) {
 	r := NewRegistry()
 
@@ -203,6 +300,31 @@ func TestPrefixedRegistryUnregister(t *testing.T) {
 	}
 }
 
+func TestPrefixedChildRegistryUnregisterAll(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredCounter("other", r)
+	db := NewPrefixedChildRegistry(r, "db.")
+	cache := NewPrefixedChildRegistry(r, "cache.")
+	NewRegisteredCounter("queries", db)
+	NewRegisteredCounter("hits", cache)
+	db.UnregisterAll()
+	if nil != db.Get("queries") || nil == cache.Get("hits") || nil == r.Get("other") {
+		t.Fatal(db.Get("queries"), cache.Get("hits"), r.Get("other"))
+	}
+}
+
+func TestPrefixedChildRegistryRunHealthchecks(t *testing.T) {
+	r := NewRegistry()
+	var checked []string
+	r.Register("other", NewHealthcheck(func(Healthcheck) { checked = append(checked, "other") }))
+	pr := NewPrefixedChildRegistry(r, "db.")
+	pr.Register("ping", NewHealthcheck(func(Healthcheck) { checked = append(checked, "db.ping") }))
+	pr.RunHealthchecks()
+	if 1 != len(checked) || "db.ping" != checked[0] {
+		t.Fatal(checked)
+	}
+}
+
 func TestPrefixedRegistryGet(t *testing.T) {
 	pr := NewPrefixedRegistry("prefix.")
 	name := "foo"
@@ -286,3 +408,1151 @@ func TestWalkRegistries(t *testing.T) {
 	}
 
 }
+
+func TestSubRegistryWithTags(t *testing.T) {
+	r := NewRegistry()
+	r.Register("bar", NewCounter())
+	child, cleanup := r.SubRegistryWithTags(map[string]string{"route": "/a", "method": "GET"})
+
+	c := GetOrRegisterCounter("foo", child)
+	c.Inc(47)
+	if m := r.Get("foo;method=GET;route=/a"); m != c {
+		t.Fatal(m)
+	}
+	if m := child.Get("foo"); m != c {
+		t.Fatal(m)
+	}
+
+	i := 0
+	child.Each(func(name string, m interface{}) {
+		i++
+		if name != "foo;method=GET;route=/a" {
+			t.Fatal(name)
+		}
+	})
+	if i != 1 {
+		t.Fatal(i)
+	}
+
+	cleanup()
+	cleanup()
+	if m := r.Get("foo;method=GET;route=/a"); nil != m {
+		t.Fatal(m)
+	}
+	if m := r.Get("bar"); nil == m {
+		t.Fatal(m)
+	}
+}
+
+func TestSubRegistryWithTagsLeavesParentMetrics(t *testing.T) {
+	r := NewRegistry()
+	existing := NewCounter()
+	r.Register("foo;route=/a", existing)
+	child, cleanup := r.SubRegistryWithTags(map[string]string{"route": "/a"})
+	if c := GetOrRegisterCounter("foo", child); c != existing {
+		t.Fatalf("GetOrRegisterCounter(): %v != %v\n", existing, c)
+	}
+	GetOrRegisterCounter("bar", child)
+	n := 0
+	child.Each(func(string, interface{}) { n++ })
+	if 1 != n {
+		t.Errorf("child.Each(): 1 != %v\n", n)
+	}
+	cleanup()
+	if m := r.Get("foo;route=/a"); existing != m {
+		t.Errorf("r.Get(\"foo;route=/a\"): %v != %v\n", existing, m)
+	}
+	if m := r.Get("bar;route=/a"); nil != m {
+		t.Errorf("r.Get(\"bar;route=/a\"): %v\n", m)
+	}
+}
+
+func TestSubRegistryWithTagsNested(t *testing.T) {
+	r := NewRegistry()
+	child, cleanup := r.SubRegistryWithTags(map[string]string{"a": "1", "b": "2"})
+	defer cleanup()
+	grandchild, grandchildCleanup := child.SubRegistryWithTags(map[string]string{"b": "3"})
+	grandchild.Register("foo", NewCounter())
+	if m := r.Get("foo;a=1;b=3"); nil == m {
+		t.Fatal(m)
+	}
+	grandchildCleanup()
+	if m := r.Get("foo;a=1;b=3"); nil != m {
+		t.Fatal(m)
+	}
+}
+
+func TestSubRegistryWithTagsPrefixed(t *testing.T) {
+	r := NewRegistry()
+	child, cleanup := NewPrefixedChildRegistry(r, "prefix.").SubRegistryWithTags(map[string]string{"a": "1"})
+	defer cleanup()
+	child.Register("foo", NewCounter())
+	pr := NewPrefixedChildRegistry(child, "inner.")
+	pr.Register("bar", NewCounter())
+
+	i := 0
+	pr.Each(func(name string, m interface{}) {
+		i++
+		if name != "inner.bar;a=1" {
+			t.Fatal(name)
+		}
+	})
+	if i != 1 {
+		t.Fatal(i)
+	}
+	if m := r.Get("prefix.foo;a=1"); nil == m {
+		t.Fatal(m)
+	}
+}
+
+func TestRegistryDelta(t *testing.T) {
+	r := NewRegistry()
+	c := NewRegisteredCounter("foo", r)
+	m := NewRegisteredMeter("bar", r)
+	NewRegisteredGauge("baz", r).Update(47)
+	c.Inc(3)
+	m.Mark(2)
+
+	deltas := r.Delta("a")
+	if 2 != len(deltas) || 3 != deltas["foo"] || 2 != deltas["bar"] {
+		t.Fatal(deltas)
+	}
+	c.Inc(4)
+	if deltas := r.Delta("a"); 4 != deltas["foo"] || 0 != deltas["bar"] {
+		t.Fatal(deltas)
+	}
+
+	// A new consumer starts from zero.
+	if deltas := r.Delta("b"); 7 != deltas["foo"] || 2 != deltas["bar"] {
+		t.Fatal(deltas)
+	}
+
+	r.Unregister("foo")
+	NewRegisteredCounter("foo", r).Inc(1)
+	if deltas := r.Delta("a"); 1 != deltas["foo"] {
+		t.Fatal(deltas)
+	}
+}
+
+func TestPrefixedRegistryDelta(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredCounter("foo", r).Inc(1)
+	pr := NewPrefixedChildRegistry(r, "prefix.")
+	NewRegisteredCounter("foo", pr).Inc(2)
+	if deltas := pr.Delta("a"); 1 != len(deltas) || 2 != deltas["prefix.foo"] {
+		t.Fatal(deltas)
+	}
+
+	child, cleanup := pr.SubRegistryWithTags(map[string]string{"a": "1"})
+	defer cleanup()
+	NewRegisteredCounter("foo", child).Inc(3)
+	if deltas := child.Delta("a"); 1 != len(deltas) || 3 != deltas["foo;a=1"] {
+		t.Fatal(deltas)
+	}
+}
+
+func TestRegistryAlias(t *testing.T) {
+	r := NewRegistry()
+	c := NewCounter()
+	r.Register("foo", c)
+	if err := r.Alias("foo", "bar"); nil != err {
+		t.Fatal(err)
+	}
+	r.Get("bar").(Counter).Inc(47)
+	if count := c.Count(); 47 != count {
+		t.Fatal(count)
+	}
+	i := 0
+	r.Each(func(name string, iface interface{}) {
+		i++
+		if iface != c {
+			t.Fatal(name, iface)
+		}
+	})
+	if 2 != i {
+		t.Fatal(i)
+	}
+	r.Unregister("foo")
+	if nil != r.Get("foo") || c != r.Get("bar") {
+		t.Fatal(r.Get("foo"), r.Get("bar"))
+	}
+}
+
+func TestRegistryAliasErrors(t *testing.T) {
+	r := NewRegistry()
+	r.Register("foo", NewCounter())
+	r.Register("bar", NewCounter())
+	if err := r.Alias("baz", "qux"); UnknownMetric("baz") != err {
+		t.Fatal(err)
+	}
+	if err := r.Alias("foo", "bar"); !errors.Is(err, DuplicateMetric("bar")) {
+		t.Fatal(err)
+	}
+}
+
+func TestRegistryDuplicateMetricError(t *testing.T) {
+	r := NewRegistry()
+	c := NewCounter()
+	r.Register("foo", c)
+	err := r.Register("foo", NewGauge())
+	var dup *DuplicateMetricError
+	if !errors.As(err, &dup) {
+		t.Fatalf("err: %#v", err)
+	}
+	if "foo" != dup.Name || c != dup.Existing || "*metrics.StandardCounter" != dup.Type() {
+		t.Fatalf("dup: %+v %s", dup, dup.Type())
+	}
+	if !errors.Is(err, DuplicateMetric("foo")) || !errors.Is(err, DuplicateMetric("")) || errors.Is(err, DuplicateMetric("bar")) {
+		t.Fatal(err)
+	}
+	if want := "duplicate metric: foo, already registered as a *metrics.StandardCounter"; want != err.Error() {
+		t.Errorf("err.Error(): %q != %q\n", want, err.Error())
+	}
+}
+
+func TestMustRegisterIn(t *testing.T) {
+	r := NewRegistry()
+	c, g := NewCounter(), NewGauge()
+	c.(Taggable).AddTags(map[string]string{"host": "a"})
+	g.(Taggable).AddTags(map[string]string{"host": "a"})
+	MustRegisterIn(r, "foo", c)
+	defer func() {
+		err, ok := recover().(*MustRegisterError)
+		if !ok {
+			t.Fatalf("recover(): %#v", err)
+		}
+		if !errors.Is(err, DuplicateMetric("foo;host=a")) {
+			t.Fatal(err)
+		}
+		if want := "metrics: can't register *metrics.StandardGauge foo with tags host=a: duplicate metric: foo;host=a, already registered as a *metrics.StandardCounter"; want != err.Error() {
+			t.Errorf("err.Error(): %q != %q\n", want, err.Error())
+		}
+	}()
+	MustRegisterIn(r, "foo", g)
+	t.Fatal("MustRegisterIn didn't panic")
+}
+
+func TestRegistryUnregisterWithAliases(t *testing.T) {
+	r := NewRegistry()
+	r.Register("foo", NewCounter())
+	r.Register("other", NewCounter())
+	r.Alias("foo", "bar")
+	r.Alias("bar", "baz")
+	r.UnregisterWithAliases("baz")
+	i := 0
+	r.Each(func(string, interface{}) { i++ })
+	if 1 != i || nil == r.Get("other") {
+		t.Fatal(i)
+	}
+	r.Register("foo", NewCounter())
+	r.UnregisterWithAliases("foo")
+	if nil != r.Get("foo") || nil == r.Get("other") {
+		t.Fatal(r.Get("foo"), r.Get("other"))
+	}
+}
+
+func TestPrefixedRegistryAlias(t *testing.T) {
+	r := NewRegistry()
+	pr := NewPrefixedChildRegistry(r, "prefix.")
+	c := NewRegisteredCounter("foo", pr)
+	if err := pr.Alias("foo", "bar"); nil != err {
+		t.Fatal(err)
+	}
+	if c != r.Get("prefix.bar") {
+		t.Fatal(r.Get("prefix.bar"))
+	}
+	pr.UnregisterWithAliases("bar")
+	if nil != r.Get("prefix.foo") {
+		t.Fatal(r.Get("prefix.foo"))
+	}
+}
+
+func TestRegistryUseNilMetrics(t *testing.T) {
+	r := NewRegistry().(*StandardRegistry)
+	c := GetOrRegisterCounter("foo", r)
+	r.SetUseNilMetrics(true)
+	if _, ok := GetOrRegisterCounter("bar", r).(NilCounter); !ok {
+		t.Fatal(GetOrRegisterCounter("bar", r))
+	}
+	if _, ok := NewRegisteredTimer("baz", r).(NilTimer); !ok {
+		t.Fatal(r.Get("baz"))
+	}
+	if nil != r.Get("bar") || nil != r.Get("baz") {
+		t.Fatal(r.Get("bar"), r.Get("baz"))
+	}
+	if GetOrRegisterCounter("foo", r) != c {
+		t.Fatal(GetOrRegisterCounter("foo", r))
+	}
+	r.SetUseNilMetrics(false)
+	if _, ok := GetOrRegisterCounter("bar", r).(*StandardCounter); !ok {
+		t.Fatal(GetOrRegisterCounter("bar", r))
+	}
+}
+
+func TestSetUseNilMetrics(t *testing.T) {
+	SetUseNilMetrics(true)
+	c, ok := NewCounter().(NilCounter)
+	SetUseNilMetrics(false)
+	if !ok {
+		t.Fatal(c)
+	}
+	if _, ok := NewCounter().(*StandardCounter); !ok {
+		t.Fatal(NewCounter())
+	}
+}
+
+func TestNilRegistry(t *testing.T) {
+	var r Registry = NilRegistry{}
+	if _, ok := GetOrRegisterCounter("foo", r).(NilCounter); !ok {
+		t.Fatal(GetOrRegisterCounter("foo", r))
+	}
+	if _, ok := NewRegisteredMeter("bar", r).(NilMeter); !ok {
+		t.Fatal(NewRegisteredMeter("bar", r))
+	}
+	if _, ok := r.GetOrRegister("baz", NewTimer).(NilTimer); !ok {
+		t.Fatal(r.GetOrRegister("baz", NewTimer))
+	}
+	if err := r.Register("qux", NewCounter()); nil != err {
+		t.Fatal(err)
+	}
+	if nil != r.Get("qux") {
+		t.Fatal(r.Get("qux"))
+	}
+	if n := r.Snapshot().Len(); 0 != n {
+		t.Errorf("r.Snapshot().Len(): 0 != %v\n", n)
+	}
+	sub, _ := r.SubRegistryWithTags(map[string]string{"a": "b"})
+	if _, ok := GetOrRegisterGaugeT("foo", map[string]string{"c": "d"}, sub).(NilGauge); !ok {
+		t.Fatal(GetOrRegisterGaugeT("foo", map[string]string{"c": "d"}, sub))
+	}
+	r.Close()
+	if nil != Closed(r) {
+		t.Fatal(Closed(r))
+	}
+}
+
+func TestRegistryReplaceWithNilMetrics(t *testing.T) {
+	r := NewRegistry().(*StandardRegistry)
+	NewRegisteredCounter("foo", r)
+	NewRegisteredHistogram("bar", r, NewUniformSample(10))
+	r.ReplaceWithNilMetrics()
+	if _, ok := r.Get("foo").(NilCounter); !ok {
+		t.Fatal(r.Get("foo"))
+	}
+	if _, ok := GetOrRegisterHistogram("bar", r, nil).(NilHistogram); !ok {
+		t.Fatal(r.Get("bar"))
+	}
+}
+
+func TestPrefixedRegistryUseNilMetrics(t *testing.T) {
+	r := NewRegistry()
+	pr := NewPrefixedChildRegistry(r, "prefix.").(*PrefixedRegistry)
+	pr.SetUseNilMetrics(true)
+	if _, ok := GetOrRegisterMeter("foo", pr).(NilMeter); !ok {
+		t.Fatal(pr.Get("foo"))
+	}
+	if _, ok := GetOrRegisterMeter("foo", r).(*StandardMeter); !ok {
+		t.Fatal(r.Get("foo"))
+	}
+	pr.SetUseNilMetrics(false)
+	r.(*StandardRegistry).SetUseNilMetrics(true)
+	if _, ok := GetOrRegisterGauge("bar", pr).(NilGauge); !ok {
+		t.Fatal(pr.Get("bar"))
+	}
+}
+
+func TestRegistrySnapshotAndReset(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredCounter("counter", r).Inc(47)
+	NewRegisteredGauge("gauge", r).Update(47)
+	NewRegisteredHistogram("histogram", r, NewUniformSample(10)).Update(47)
+	NewRegisteredMeter("meter", r).Mark(47)
+	NewRegisteredTimer("timer", r).Update(47)
+	snapshots := r.SnapshotAndReset()
+
+	if count := snapshots.Get("counter").(Counter).Count(); 47 != count {
+		t.Errorf("counter: 47 != %v\n", count)
+	}
+	if count := r.Get("counter").(Counter).Count(); 0 != count {
+		t.Errorf("counter: 0 != %v\n", count)
+	}
+	if value := r.Get("gauge").(Gauge).Value(); 47 != value {
+		t.Errorf("gauge: 47 != %v\n", value)
+	}
+	if max := snapshots.Get("histogram").(Histogram).Max(); 47 != max {
+		t.Errorf("histogram: 47 != %v\n", max)
+	}
+	if count := r.Get("histogram").(Histogram).Count(); 0 != count {
+		t.Errorf("histogram: 0 != %v\n", count)
+	}
+	if count := r.Get("meter").(Meter).Count(); 47 != count {
+		t.Errorf("meter: 47 != %v\n", count)
+	}
+	if count := snapshots.Get("timer").(Timer).Count(); 1 != count {
+		t.Errorf("timer: 1 != %v\n", count)
+	}
+	if count := r.Get("timer").(Timer).Count(); 0 != count {
+		t.Errorf("timer: 0 != %v\n", count)
+	}
+
+	again := snapshots.SnapshotAndReset()
+	if count := again.Get("counter").(Counter).Count(); 47 != count {
+		t.Errorf("counter: 47 != %v\n", count)
+	}
+}
+
+func TestRegistrySnapshotAndResetConcurrent(t *testing.T) {
+	r := NewRegistry()
+	c := NewRegisteredCounter("foo", r)
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 10000; i++ {
+			c.Inc(1)
+		}
+		close(done)
+	}()
+	var total int64
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+			runtime.Gosched()
+		}
+		total += r.SnapshotAndReset().Get("foo").(Counter).Count()
+	}
+	if 10000 != total {
+		t.Fatal(total)
+	}
+}
+
+func TestPrefixedRegistrySnapshotAndReset(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredCounter("other", r).Inc(1)
+	pr := NewPrefixedChildRegistry(r, "prefix.")
+	NewRegisteredCounter("foo", pr).Inc(47)
+	snapshots := pr.SnapshotAndReset()
+	if count := snapshots.Get("prefix.foo").(Counter).Count(); 47 != count {
+		t.Errorf("prefix.foo: 47 != %v\n", count)
+	}
+	if nil != snapshots.Get("other") {
+		t.Fatal(snapshots.Get("other"))
+	}
+	if count := r.Get("other").(Counter).Count(); 1 != count {
+		t.Errorf("other: 1 != %v\n", count)
+	}
+}
+
+func meterTicked(m *StandardMeter) bool {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return !m.stopped
+}
+
+func TestRegistryClear(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredCounter("foo", r)
+	m := NewRegisteredMeter("bar", r).(*StandardMeter)
+	tm := NewRegisteredTimer("baz", r).(*StandardTimer)
+	h := NewRegisteredWindowedHistogram("qux", r, time.Minute, time.Second).(*StandardWindowedHistogram)
+	r.Alias("bar", "quux")
+	r.Clear()
+	i := 0
+	r.Each(func(string, interface{}) { i++ })
+	if 0 != i {
+		t.Fatal(i)
+	}
+	if meterTicked(m) || meterTicked(tm.meter.(*StandardMeter)) {
+		t.Fatal("meter still ticked")
+	}
+	select {
+	case <-h.done:
+	default:
+		t.Fatal("windowed histogram still rotating")
+	}
+	if err := r.Register("foo", NewCounter()); nil != err {
+		t.Fatal(err)
+	}
+}
+
+func TestRegistryUnregisterStops(t *testing.T) {
+	r := NewRegistry()
+	m := NewRegisteredMeter("foo", r).(*StandardMeter)
+	tm := NewRegisteredTimer("bar", r).(*StandardTimer)
+	r.Alias("foo", "baz")
+	r.Unregister("foo")
+	if !meterTicked(m) {
+		t.Fatal("meter stopped while still registered as baz")
+	}
+	r.Unregister("baz")
+	if meterTicked(m) {
+		t.Fatal("meter still ticked")
+	}
+	r.UnregisterAll()
+	if meterTicked(tm.meter.(*StandardMeter)) {
+		t.Fatal("timer still ticked")
+	}
+
+	m = NewRegisteredMeter("foo", r).(*StandardMeter)
+	r.Alias("foo", "baz")
+	r.UnregisterWithAliases("baz")
+	if meterTicked(m) {
+		t.Fatal("meter still ticked")
+	}
+
+	m = NewRegisteredMeter("foo", r).(*StandardMeter)
+	r.EachAndUpdate(func(string, interface{}) Action { return ActionUnregister })
+	if meterTicked(m) {
+		t.Fatal("meter still ticked")
+	}
+}
+
+func TestRegistryOnUnregister(t *testing.T) {
+	r := NewRegistry().(*StandardRegistry)
+	var names []string
+	r.SetOnUnregister(func(name string, i interface{}) {
+		if nil == i {
+			t.Errorf("%s: nil metric\n", name)
+		}
+		if nil != r.Get(name) {
+			t.Errorf("%s: still registered\n", name)
+		}
+		names = append(names, name)
+	})
+	c := NewRegisteredCounter("foo", r)
+	NewRegisteredCounter("bar", r)
+	NewRegisteredCounter("quux", r)
+	r.Alias("foo", "baz")
+	r.Unregister("foo")
+	r.Unregister("foo")
+	r.Unregister("missing")
+	r.UnregisterWithAliases("baz")
+	r.EachAndUpdate(func(name string, _ interface{}) Action {
+		if "bar" == name {
+			return ActionUnregister
+		}
+		return ActionKeep
+	})
+	r.Clear()
+	if want := []string{"foo", "baz", "bar", "quux"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("names: %v != %v\n", want, names)
+	}
+
+	names = nil
+	r.SetOnUnregister(nil)
+	r.Register("foo", c)
+	r.UnregisterAll()
+	if nil != names {
+		t.Errorf("names: %v != nil\n", names)
+	}
+}
+
+func TestRegistryClearConcurrent(t *testing.T) {
+	r := NewRegistry()
+	for i := 0; i < 100; i++ {
+		NewRegisteredCounter(fmt.Sprintf("foo%d", i), r)
+	}
+	done := make(chan struct{})
+	go func() {
+		r.Clear()
+		close(done)
+	}()
+	i := 0
+	r.Each(func(string, interface{}) { i++ })
+	if 0 != i && 100 != i {
+		t.Fatal(i)
+	}
+	<-done
+}
+
+func TestPrefixedRegistryClear(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredCounter("other", r)
+	pr := NewPrefixedChildRegistry(r, "prefix.")
+	m := NewRegisteredMeter("foo", pr).(*StandardMeter)
+	pr.Clear()
+	if nil != r.Get("prefix.foo") || nil == r.Get("other") {
+		t.Fatal(r.Get("prefix.foo"), r.Get("other"))
+	}
+	if meterTicked(m) {
+		t.Fatal("meter still ticked")
+	}
+}
+
+func TestRegistryClose(t *testing.T) {
+	r := NewRegistry().(*StandardRegistry)
+	m := NewRegisteredMeter("foo", r).(*StandardMeter)
+	h := NewRegisteredWindowedHistogram("bar", r, time.Minute, time.Second).(*StandardWindowedHistogram)
+	r.SetTTL(time.Minute)
+	done := make(chan struct{})
+	go func() {
+		Write(r, time.Hour, ioutil.Discard)
+		close(done)
+	}()
+	r.Close()
+	r.Close()
+	if meterTicked(m) {
+		t.Fatal("meter still ticked")
+	}
+	select {
+	case <-h.done:
+	default:
+		t.Fatal("windowed histogram still rotating")
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Write still running")
+	}
+	if nil == r.Get("foo") {
+		t.Fatal("foo unregistered by Close")
+	}
+	r.SetTTL(time.Minute)
+	r.ttlMutex.Lock()
+	sweeping := nil != r.ttlDone
+	r.ttlMutex.Unlock()
+	if sweeping {
+		t.Fatal("SetTTL swept after Close")
+	}
+}
+
+func TestRegistryClosed(t *testing.T) {
+	r := NewRegistry()
+	pr := NewPrefixedChildRegistry(r, "prefix.")
+	sub, _ := r.SubRegistryWithTags(map[string]string{"a": "b"})
+	for _, c := range []Registry{r, pr, sub, NewMappedRegistry(pr, nil)} {
+		select {
+		case <-Closed(c):
+			t.Fatalf("%T closed before Close", c)
+		default:
+		}
+	}
+	r.Close()
+	for _, c := range []Registry{r, pr, sub, NewMappedRegistry(pr, nil)} {
+		select {
+		case <-Closed(c):
+		default:
+			t.Fatalf("%T not closed after Close", c)
+		}
+	}
+}
+
+func TestPrefixedRegistryClose(t *testing.T) {
+	r := NewRegistry()
+	other := NewRegisteredMeter("other", r).(*StandardMeter)
+	pr := NewPrefixedChildRegistry(r, "prefix.")
+	m := NewRegisteredMeter("foo", pr).(*StandardMeter)
+	pr.Close()
+	if meterTicked(m) {
+		t.Fatal("meter still ticked")
+	}
+	if !meterTicked(other) {
+		t.Fatal("other stopped")
+	}
+	select {
+	case <-Closed(pr):
+		t.Fatal("parent closed by child")
+	default:
+	}
+}
+
+func TestRegistryEachAndUpdate(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredCounter("stale", r)
+	NewRegisteredCounter("busy", r).Inc(47)
+	NewRegisteredHistogram("sizes", r, NewUniformSample(100)).Update(1)
+	NewRegisteredGauge("depth", r).Update(3)
+	r.Delta("test")
+	r.EachAndUpdate(func(name string, i interface{}) Action {
+		switch m := i.(type) {
+		case Counter:
+			if 0 == m.Count() {
+				return ActionUnregister
+			}
+		case Histogram, Gauge:
+			return ActionClear
+		}
+		return ActionKeep
+	})
+	if nil != r.Get("stale") {
+		t.Fatal(r.Get("stale"))
+	}
+	if c := r.Get("busy").(Counter); 47 != c.Count() {
+		t.Errorf("c.Count(): 47 != %v\n", c.Count())
+	}
+	if h := r.Get("sizes").(Histogram); 0 != h.Count() {
+		t.Errorf("h.Count(): 0 != %v\n", h.Count())
+	}
+	if g := r.Get("depth").(Gauge); 3 != g.Value() {
+		t.Errorf("g.Value(): 3 != %v\n", g.Value())
+	}
+	NewRegisteredCounter("stale", r).Inc(1)
+	if delta := r.Delta("test")["stale"]; 1 != delta {
+		t.Errorf("delta: 1 != %v\n", delta)
+	}
+}
+
+func TestRegistryEachAndUpdateConcurrent(t *testing.T) {
+	r := NewRegistry()
+	for i := 0; i < 100; i++ {
+		NewRegisteredCounter(fmt.Sprintf("foo%d", i), r)
+	}
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 100; i++ {
+			r.Unregister(fmt.Sprintf("foo%d", i))
+			NewRegisteredCounter(fmt.Sprintf("bar%d", i), r)
+		}
+		close(done)
+	}()
+	r.EachAndUpdate(func(name string, i interface{}) Action {
+		if nil == i {
+			t.Error(name)
+		}
+		return ActionUnregister
+	})
+	<-done
+	r.Each(func(name string, i interface{}) {
+		if "foo" == name[:3] {
+			t.Error(name)
+		}
+	})
+}
+
+func TestPrefixedRegistryEachAndUpdate(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredCounter("other", r)
+	pr := NewPrefixedChildRegistry(r, "prefix.")
+	NewRegisteredCounter("foo", pr)
+	var names []string
+	pr.EachAndUpdate(func(name string, i interface{}) Action {
+		names = append(names, name)
+		return ActionUnregister
+	})
+	if 1 != len(names) || "prefix.foo" != names[0] {
+		t.Fatal(names)
+	}
+	if nil != r.Get("prefix.foo") || nil == r.Get("other") {
+		t.Fatal(r.Get("prefix.foo"), r.Get("other"))
+	}
+}
+
+func TestTaggedSubRegistryEachAndUpdate(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredCounter("other", r)
+	tr, _ := r.SubRegistryWithTags(map[string]string{"host": "a"})
+	NewRegisteredCounter("foo", tr)
+	NewRegisteredCounter("bar", tr).Inc(1)
+	tr.EachAndUpdate(func(name string, i interface{}) Action {
+		if "other" == name {
+			t.Error(name)
+		}
+		if 0 == i.(Counter).Count() {
+			return ActionUnregister
+		}
+		return ActionKeep
+	})
+	if nil != r.Get("foo;host=a") || nil == r.Get("bar;host=a") || nil == r.Get("other") {
+		t.Fatal(r.Get("foo;host=a"), r.Get("bar;host=a"), r.Get("other"))
+	}
+	i := 0
+	tr.Each(func(string, interface{}) { i++ })
+	if 1 != i {
+		t.Fatal(i)
+	}
+}
+
+func TestRegistryTaggedIdentity(t *testing.T) {
+	r := NewRegistry()
+	a, b := NewCounter(), NewCounter()
+	a.(Taggable).AddTags(map[string]string{"endpoint": "a"})
+	b.(Taggable).AddTags(map[string]string{"endpoint": "b"})
+	if err := r.Register("requests", a); nil != err {
+		t.Fatal(err)
+	}
+	if err := r.Register("requests", b); nil != err {
+		t.Fatal(err)
+	}
+	if err := r.Register("requests;endpoint=a", NewCounter()); nil == err {
+		t.Fatal("duplicate registered")
+	}
+	if r.Get("requests;endpoint=a") != a || r.Get("requests;endpoint=b") != b || nil != r.Get("requests") {
+		t.Fatal(r.Get("requests;endpoint=a"), r.Get("requests;endpoint=b"), r.Get("requests"))
+	}
+	names := make(map[string]bool)
+	r.Each(func(name string, i interface{}) { names[name] = true })
+	if 2 != len(names) || !names["requests;endpoint=a"] || !names["requests;endpoint=b"] {
+		t.Fatal(names)
+	}
+	r.Unregister("requests;endpoint=a")
+	if nil != r.Get("requests;endpoint=a") || r.Get("requests;endpoint=b") != b {
+		t.Fatal(r.Get("requests;endpoint=a"), r.Get("requests;endpoint=b"))
+	}
+}
+
+func TestRegistryTaggedNameOrder(t *testing.T) {
+	r := NewRegistry()
+	c := GetOrRegisterCounter("foo;region=eu;host=a", r)
+	if GetOrRegisterCounter("foo;host=a;region=eu", r) != c {
+		t.Fatal("tag order changed identity")
+	}
+	if r.Get("foo;host=a;region=eu") != c {
+		t.Fatal(r.Get("foo;host=a;region=eu"))
+	}
+}
+
+func TestRegistryGetOrRegisterTagged(t *testing.T) {
+	r := NewRegistry()
+	newTagged := func() Counter {
+		c := NewCounter()
+		c.(Taggable).AddTags(map[string]string{"host": "a"})
+		return c
+	}
+	c := r.GetOrRegister("foo", newTagged)
+	if r.GetOrRegister("foo", newTagged) != c || r.Get("foo;host=a") != c {
+		t.Fatal(r.Get("foo;host=a"))
+	}
+}
+
+func TestTaggedSubRegistryMetricTags(t *testing.T) {
+	r := NewRegistry()
+	tr, unregister := r.SubRegistryWithTags(map[string]string{"host": "a", "region": "eu"})
+	c := NewCounter()
+	c.(Taggable).AddTags(map[string]string{"host": "b"})
+	tr.Register("foo", c)
+	if r.Get("foo;host=b;region=eu") != c {
+		t.Fatal(r.Get("foo;host=b;region=eu"))
+	}
+	i := 0
+	tr.Each(func(string, interface{}) { i++ })
+	if 1 != i {
+		t.Fatal(i)
+	}
+	unregister()
+	if nil != r.Get("foo;host=b;region=eu") {
+		t.Fatal(r.Get("foo;host=b;region=eu"))
+	}
+}
+
+func TestRegistryEachSnapshot(t *testing.T) {
+	r := NewRegistry()
+	c := NewRegisteredCounter("foo", r)
+	g := NewRegisteredGauge("bar", r)
+	r.Register("baz", NewHealthcheck(func(Healthcheck) {}))
+	c.Inc(1)
+	g.Update(1)
+	i := 0
+	r.EachSnapshot(func(name string, m interface{}) {
+		i++
+		// Updates while iterating don't show up in later snapshots.
+		c.Inc(1)
+		g.Update(2)
+		NewRegisteredCounter(fmt.Sprintf("new%d", i), r)
+		switch m := m.(type) {
+		case CounterSnapshot:
+			if 1 != m.Count() {
+				t.Errorf("%s.Count(): 1 != %v\n", name, m.Count())
+			}
+		case GaugeSnapshot:
+			if 1 != m.Value() {
+				t.Errorf("%s.Value(): 1 != %v\n", name, m.Value())
+			}
+		case Healthcheck:
+		default:
+			t.Errorf("%s: %T\n", name, m)
+		}
+	})
+	if 3 != i {
+		t.Fatal(i)
+	}
+}
+
+func TestPrefixedRegistryEachSnapshot(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredCounter("other", r)
+	pr := NewPrefixedChildRegistry(r, "prefix.")
+	NewRegisteredCounter("foo", pr).Inc(47)
+	var names []string
+	pr.EachSnapshot(func(name string, i interface{}) {
+		names = append(names, name)
+		if 47 != i.(CounterSnapshot).Count() {
+			t.Error(i)
+		}
+	})
+	if 1 != len(names) || "prefix.foo" != names[0] {
+		t.Fatal(names)
+	}
+}
+
+func TestRegistryDefaultTags(t *testing.T) {
+	r := NewRegistry()
+	r.(*StandardRegistry).SetDefaultTags(map[string]string{"host": "a", "region": "eu"})
+	c := NewCounter()
+	c.(Taggable).AddTags(map[string]string{"host": "b"})
+	r.Register("foo", c)
+	NewRegisteredCounter("bar", r)
+	names := make(map[string]bool)
+	r.EachSnapshot(func(name string, i interface{}) { names[name] = true })
+	if 2 != len(names) || !names["foo;host=b;region=eu"] || !names["bar;host=a;region=eu"] {
+		t.Fatal(names)
+	}
+	if tags := c.(Taggable).GetTags(); 1 != len(tags) {
+		t.Fatal(tags)
+	}
+	if nil == r.Get("bar") {
+		t.Fatal(r.Get("bar"))
+	}
+
+	pr := NewPrefixedChildRegistry(r, "prefix.")
+	NewRegisteredCounter("baz", pr)
+	var prefixed []string
+	pr.EachSnapshot(func(name string, i interface{}) { prefixed = append(prefixed, name) })
+	if 1 != len(prefixed) || "prefix.baz;host=a;region=eu" != prefixed[0] {
+		t.Fatal(prefixed)
+	}
+	if tags := pr.(*PrefixedRegistry).DefaultTags(); "eu" != tags["region"] {
+		t.Fatal(tags)
+	}
+}
+
+func TestRegistrySnapshot(t *testing.T) {
+	r := NewRegistry()
+	r.(*StandardRegistry).SetDefaultTags(map[string]string{"host": "a"})
+	c := NewRegisteredCounter("foo", r)
+	c.Inc(47)
+	NewRegisteredGauge("bar", r).Update(1)
+	s := r.Snapshot()
+	c.Inc(1)
+	if 2 != s.Len() {
+		t.Fatal(s.Len())
+	}
+	if names := s.Names(); "bar;host=a" != names[0] || "foo;host=a" != names[1] {
+		t.Fatal(names)
+	}
+	if count := s.Get("foo;host=a").(Counter).Count(); 47 != count {
+		t.Errorf("count: 47 != %v\n", count)
+	}
+	var names []string
+	s.Each(func(name string, i interface{}) { names = append(names, name) })
+	if 2 != len(names) || "bar;host=a" != names[0] {
+		t.Fatal(names)
+	}
+
+	pr := NewPrefixedChildRegistry(r, "prefix.")
+	NewRegisteredCounter("baz", pr)
+	if names := pr.Snapshot().Names(); 1 != len(names) || "prefix.baz;host=a" != names[0] {
+		t.Fatal(names)
+	}
+}
+
+func TestRegistrySnapshotWithTags(t *testing.T) {
+	r := NewRegistry()
+	r.(*StandardRegistry).SetDefaultTags(map[string]string{"host": "a"})
+	NewRegisteredCounter("foo", r).Inc(1)
+	GetOrRegisterCounterT("foo", map[string]string{"dc": "us"}, r).Inc(2)
+	GetOrRegisterCounterT("bar", map[string]string{"dc": "eu"}, r).Inc(3)
+	c := GetOrRegisterCounterT("bar", nil, r)
+	c.Inc(4)
+	s := r.Snapshot().WithTags(map[string]string{"dc": "eu", "host": "b"})
+	want := []string{"bar;dc=eu;host=a", "foo;dc=eu;host=a", "foo;dc=us;host=a"}
+	if names := s.Names(); !reflect.DeepEqual(want, names) {
+		t.Fatalf("Names(): %v != %v\n", want, names)
+	}
+	if count := s.Get("bar;dc=eu;host=a").(Counter).Count(); 3 != count {
+		t.Errorf("count: 3 != %v\n", count)
+	}
+	if count := s.Get("foo;dc=eu;host=a").(Counter).Count(); 1 != count {
+		t.Errorf("count: 1 != %v\n", count)
+	}
+	if tags := c.(Taggable).GetTags(); 0 != len(tags) {
+		t.Errorf("GetTags(): %v\n", tags)
+	}
+
+	GetOrRegisterCounterT("foo", map[string]string{"zone": "z"}, r).Inc(5)
+	s = r.Snapshot().WithTags(map[string]string{"zone": "z"})
+	if count := s.Get("foo;host=a;zone=z").(Counter).Count(); 5 != count {
+		t.Errorf("count: 5 != %v\n", count)
+	}
+}
+
+// TestRegistrySnapshotConcurrentTags would expose data race problems with
+// concurrent AddTags and Snapshot calls when test is called with -race
+// argument
+func TestRegistrySnapshotConcurrentTags(t *testing.T) {
+	r := NewRegistry()
+	c := NewRegisteredCounter("foo", r)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			c.(Taggable).AddTags(map[string]string{"k": "v"})
+		}
+	}()
+	for i := 0; i < 1000; i++ {
+		r.Snapshot()
+		c.Snapshot()
+		c.(Taggable).GetTags()
+	}
+	<-done
+}
+
+func TestRegistryResetAll(t *testing.T) {
+	r := NewRegistry()
+	c := GetOrRegisterCounter("counter", r)
+	c.Inc(3)
+	g := GetOrRegisterGauge("gauge", r)
+	g.Update(7)
+	p := GetOrRegisterMaxGauge("peak", r)
+	p.Update(9)
+	h := GetOrRegisterHistogram("histogram", r, NewUniformSample(10))
+	h.Update(1)
+	m := GetOrRegisterMeter("meter", r)
+	m.Mark(5)
+	tm := GetOrRegisterTimer("timer", r)
+	tm.Update(time.Second)
+	r.ResetAll()
+	if 0 != c.Count() || 7 != g.Value() || 0 != p.Value() || 0 != h.Count() {
+		t.Errorf("counter %v, gauge %v, peak %v, histogram %v\n", c.Count(), g.Value(), p.Value(), h.Count())
+	}
+	if 0 != m.Count() || 0 != m.RateMean() || 0 != m.Rate1() {
+		t.Errorf("meter: %v %v %v\n", m.Count(), m.RateMean(), m.Rate1())
+	}
+	if 0 != tm.Count() || 0 != tm.RateMean() || 0 != tm.Max() {
+		t.Errorf("timer: %v %v %v\n", tm.Count(), tm.RateMean(), tm.Max())
+	}
+	m.Mark(2)
+	tm.Update(time.Second)
+	if 2 != m.Count() || 1 != tm.Count() || 1 != tm.(*StandardTimer).meter.Count() {
+		t.Errorf("after reset: meter %v, timer %v\n", m.Count(), tm.Count())
+	}
+	if 6 != len(r.GetAll()) {
+		t.Errorf("r.GetAll(): %v\n", r.GetAll())
+	}
+}
+
+func TestPrefixedRegistryResetAll(t *testing.T) {
+	r := NewRegistry()
+	p := NewPrefixedChildRegistry(r, "prefix.")
+	c := GetOrRegisterCounter("foo", p)
+	other := GetOrRegisterCounter("foo", r)
+	c.Inc(1)
+	other.Inc(1)
+	p.ResetAll()
+	if 0 != c.Count() || 1 != other.Count() {
+		t.Errorf("c.Count(): %v, other.Count(): %v\n", c.Count(), other.Count())
+	}
+}
+
+func TestRegistrySetPercentiles(t *testing.T) {
+	r := NewRegistry().(*StandardRegistry)
+	if ps := r.Percentiles(); !reflect.DeepEqual(DefaultPercentiles, ps) {
+		t.Errorf("r.Percentiles(): %v != %v\n", DefaultPercentiles, ps)
+	}
+	if err := r.SetPercentiles([]float64{0.9, 1.5}); nil == err {
+		t.Error("r.SetPercentiles(): no error for 1.5\n")
+	}
+	ps := []float64{0.9, 0.99}
+	if err := r.SetPercentiles(ps); nil != err {
+		t.Fatal(err)
+	}
+	ps[0] = 0.1
+	child := NewPrefixedChildRegistry(r, "prefix.")
+	if ps := RegistryPercentiles(child); !reflect.DeepEqual([]float64{0.9, 0.99}, ps) {
+		t.Errorf("RegistryPercentiles(child): %v\n", ps)
+	}
+	r.SetPercentiles(nil)
+	if ps := RegistryPercentiles(child); !reflect.DeepEqual(DefaultPercentiles, ps) {
+		t.Errorf("RegistryPercentiles(child): %v != %v\n", DefaultPercentiles, ps)
+	}
+}
+
+func TestRegistryConcurrentGetOrRegister(t *testing.T) {
+	r := NewRegistry()
+	var wg sync.WaitGroup
+	counters := make([]Counter, 64)
+	for i := range counters {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			counters[i] = GetOrRegisterCounter("foo", r)
+			if 0 == i%2 {
+				r.Unregister("bar")
+			} else {
+				GetOrRegisterCounter("bar", r)
+			}
+		}(i)
+	}
+	wg.Wait()
+	for i, c := range counters {
+		if c != counters[0] {
+			t.Fatalf("GetOrRegisterCounter() %d: %p != %p\n", i, c, counters[0])
+		}
+	}
+	if r.Get("foo") != counters[0] {
+		t.Errorf("r.Get(): %v\n", r.Get("foo"))
+	}
+}
+
+func TestRegistryGetAfterClear(t *testing.T) {
+	r := NewRegistry()
+	GetOrRegisterCounter("foo", r).Inc(1)
+	r.(*StandardRegistry).ReplaceWithNilMetrics()
+	if _, ok := r.Get("foo").(NilCounter); !ok {
+		t.Errorf("r.Get(): %T\n", r.Get("foo"))
+	}
+	r.Clear()
+	if nil != r.Get("foo") {
+		t.Errorf("r.Get(): %v\n", r.Get("foo"))
+	}
+	if c := GetOrRegisterCounter("foo", r); c != r.Get("foo") {
+		t.Errorf("r.Get(): %v != %v\n", r.Get("foo"), c)
+	}
+	r.UnregisterAll()
+	if nil != r.Get("foo") {
+		t.Errorf("r.Get(): %v\n", r.Get("foo"))
+	}
+}
+
+func TestSnapshotTimestamps(t *testing.T) {
+	clock := &stepClock{now: time.Unix(100, 0)}
+	SetClock(clock)
+	defer SetClock(nil)
+	r := NewRegistry()
+	NewRegisteredCounter("counter", r).Inc(1)
+	NewRegisteredCounterFloat64("counterfloat64", r).Inc(1)
+	NewRegisteredGauge("gauge", r).Update(1)
+	NewRegisteredGaugeFloat64("gaugefloat64", r).Update(1)
+	NewRegisteredHistogram("histogram", r, NewUniformSample(10)).Update(1)
+	NewRegisteredMeter("meter", r).Mark(1)
+	NewRegisteredMergeableGaugeFloat64("mergeable", r).Update(1)
+	NewRegisteredTimer("timer", r).Update(time.Second)
+	clock.now = time.Unix(200, 0)
+	s := r.Snapshot()
+	clock.now = time.Unix(300, 0)
+	want := time.Unix(200, 0)
+	if !want.Equal(s.Timestamp()) {
+		t.Errorf("RegistrySnapshot.Timestamp(): %v != %v\n", want, s.Timestamp())
+	}
+	s.Each(func(name string, i interface{}) {
+		ts, ok := i.(Timestamped)
+		if !ok {
+			t.Fatalf("%s: %T isn't Timestamped\n", name, i)
+		}
+		if !want.Equal(ts.Timestamp()) {
+			t.Errorf("%s.Timestamp(): %v != %v\n", name, want, ts.Timestamp())
+		}
+	})
+	fallback := time.Unix(400, 0)
+	if got := SnapshotTime(NewCounterSnapshot(1, time.Time{}), fallback); !fallback.Equal(got) {
+		t.Errorf("SnapshotTime(untimed counter): %v != %v\n", fallback, got)
+	}
+	if got := SnapshotTime(s.Get("counter"), fallback); !want.Equal(got) {
+		t.Errorf("SnapshotTime(counter): %v != %v\n", want, got)
+	}
+	if got := SnapshotTime(&HistogramSnapshot{}, fallback); !fallback.Equal(got) {
+		t.Errorf("SnapshotTime(zero): %v != %v\n", fallback, got)
+	}
+	if got := SnapshotTime(s.Get("timer"), fallback); !want.Equal(got) {
+		t.Errorf("SnapshotTime(timer): %v != %v\n", want, got)
+	}
+}
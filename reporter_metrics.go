@@ -0,0 +1,118 @@
+package metrics
+
+import (
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// ReporterMetricsPrefix begins the names of the metrics reporters keep of
+// themselves.  It's reserved for them: metrics of an application shouldn't be
+// registered under it.
+const ReporterMetricsPrefix = "go-metrics.reporter."
+
+// ReporterMetrics are the metrics a reporter keeps of its own flushes, so that
+// an operator can alert on a pipeline which is failing quietly rather than on
+// the series it stopped delivering.  They're registered with the tag
+// "reporter" naming the reporter, under ReporterMetricsPrefix:
+//
+//	go-metrics.reporter.flush           Timer of the duration of every flush
+//	go-metrics.reporter.failed-flushes  Counter of the flushes which failed
+//	go-metrics.reporter.dropped-points  Counter of points which were never delivered
+//	go-metrics.reporter.export-lag      GaugeFloat64 of the seconds since the last successful flush
+//
+// ExportLag is read-only, computed whenever it's read; its Update panics.  A
+// nil *ReporterMetrics records nothing, so that a reporter's configuration can
+// leave it out.
+type ReporterMetrics struct {
+	FlushTimer    Timer
+	FailedFlushes Counter
+	DroppedPoints Counter
+	ExportLag     GaugeFloat64
+
+	lag *exportLagGauge // ExportLag, or an unregistered stand-in
+}
+
+// NewReporterMetrics constructs the metrics of the named reporter and
+// registers them in r, or DefaultRegistry if r is nil, reporting alongside the
+// application's own metrics unless r is another registry.  The export lag is
+// measured by the clock set by SetClock and, until the first successful flush,
+// from construction.  A second call for the same reporter and registry shares
+// every metric with the first, so a flush by either resets the export lag.
+func NewReporterMetrics(reporter string, r Registry) *ReporterMetrics {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	tags := map[string]string{"reporter": reporter}
+	m := &ReporterMetrics{
+		FlushTimer:    GetOrRegisterTimerT(ReporterMetricsPrefix+"flush", tags, r),
+		FailedFlushes: GetOrRegisterCounterT(ReporterMetricsPrefix+"failed-flushes", tags, r),
+		DroppedPoints: GetOrRegisterCounterT(ReporterMetricsPrefix+"dropped-points", tags, r),
+	}
+	m.ExportLag = getOrRegisterTagged(r, ReporterMetricsPrefix+"export-lag", tags, func() interface{} {
+		return newExportLagGauge()
+	}, NilGaugeFloat64{}).(GaugeFloat64)
+	if g, ok := m.ExportLag.(*exportLagGauge); ok {
+		m.lag = g
+	} else {
+		m.lag = newExportLagGauge()
+	}
+	return m
+}
+
+// Flush calls f, timing it, and counts it as failed if it returns an error,
+// which Flush returns.
+func (m *ReporterMetrics) Flush(f func() error) error {
+	if nil == m {
+		return f()
+	}
+	start := now()
+	err := f()
+	m.FlushTimer.UpdateSince(start)
+	if nil != err {
+		m.FailedFlushes.Inc(1)
+	} else {
+		atomic.StoreInt64(&m.lag.lastSuccess, now().UnixNano())
+	}
+	return err
+}
+
+// Drop counts n points which were rendered but never delivered, e.g. those
+// of the batches left once a reporter gave up reconnecting.
+func (m *ReporterMetrics) Drop(n int) {
+	if nil == m || 0 == n {
+		return
+	}
+	m.DroppedPoints.Inc(int64(n))
+}
+
+// exportLagGauge is a GaugeFloat64 of the seconds since lastSuccess, which
+// every ReporterMetrics of one reporter and registry shares.
+type exportLagGauge struct {
+	FunctionalGaugeFloat64
+	lastSuccess int64 // UnixNano of the last successful flush, or of construction
+}
+
+func newExportLagGauge() *exportLagGauge {
+	g := &exportLagGauge{lastSuccess: now().UnixNano()}
+	g.value = g.seconds
+	return g
+}
+
+func (g *exportLagGauge) seconds() float64 {
+	return float64(now().UnixNano()-atomic.LoadInt64(&g.lastSuccess)) / float64(time.Second)
+}
+
+// ReportError passes err, unless it's nil, to onError, the error callback of
+// a reporter's configuration, or logs it if onError is nil, as reporters
+// always have.
+func ReportError(onError func(error), err error) {
+	if nil == err {
+		return
+	}
+	if nil == onError {
+		log.Println(err)
+		return
+	}
+	onError(err)
+}
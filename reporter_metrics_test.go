@@ -0,0 +1,148 @@
+package metrics
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// stepClock is a Clock which only moves when a test moves it.
+type stepClock struct{ now time.Time }
+
+func (c *stepClock) Now() time.Time                { return c.now }
+func (c *stepClock) Ticker(d time.Duration) Ticker { return SystemClock{}.Ticker(d) }
+
+func TestReporterMetrics(t *testing.T) {
+	clock := &stepClock{now: time.Unix(100, 0)}
+	SetClock(clock)
+	defer SetClock(nil)
+	r := NewRegistry()
+	m := NewReporterMetrics("graphite", r)
+	tags := map[string]string{"reporter": "graphite"}
+	if nil == r.Get(TaggedName(ReporterMetricsPrefix+"export-lag", tags)) {
+		t.Fatal("export-lag not registered\n")
+	}
+
+	clock.now = clock.now.Add(3 * time.Second)
+	if lag := m.ExportLag.Value(); 3 != lag {
+		t.Errorf("export-lag before any flush: 3 != %v\n", lag)
+	}
+	if err := m.Flush(func() error {
+		clock.now = clock.now.Add(time.Second)
+		return nil
+	}); nil != err {
+		t.Fatal(err)
+	}
+	if lag := m.ExportLag.Value(); 0 != lag {
+		t.Errorf("export-lag after a flush: 0 != %v\n", lag)
+	}
+
+	boom := errors.New("boom")
+	if err := m.Flush(func() error {
+		clock.now = clock.now.Add(2 * time.Second)
+		return boom
+	}); boom != err {
+		t.Errorf("Flush(): %v != %v\n", boom, err)
+	}
+	m.Drop(5)
+	if lag := m.ExportLag.Value(); 2 != lag {
+		t.Errorf("export-lag after a failed flush: 2 != %v\n", lag)
+	}
+	if count := m.FlushTimer.Count(); 2 != count {
+		t.Errorf("flush count: 2 != %v\n", count)
+	}
+	if max := m.FlushTimer.Max(); int64(2*time.Second) != max {
+		t.Errorf("flush max: %v != %v\n", 2*time.Second, time.Duration(max))
+	}
+	if count := r.Get(TaggedName(ReporterMetricsPrefix+"failed-flushes", tags)).(Counter).Count(); 1 != count {
+		t.Errorf("failed-flushes: 1 != %v\n", count)
+	}
+	if count := r.Get(TaggedName(ReporterMetricsPrefix+"dropped-points", tags)).(Counter).Count(); 5 != count {
+		t.Errorf("dropped-points: 5 != %v\n", count)
+	}
+
+	again := NewReporterMetrics("graphite", r)
+	if again.FailedFlushes != m.FailedFlushes || again.ExportLag != m.ExportLag {
+		t.Error("NewReporterMetrics(): want the metrics registered already\n")
+	}
+	clock.now = clock.now.Add(time.Second)
+	again.Flush(func() error { return nil })
+	if lag := m.ExportLag.Value(); 0 != lag {
+		t.Errorf("export-lag after another instance's flush: 0 != %v\n", lag)
+	}
+}
+
+func TestReporterMetricsExportLagReadOnly(t *testing.T) {
+	m := NewReporterMetrics("graphite", NewRegistry())
+	defer func() {
+		if nil == recover() {
+			t.Error("ExportLag.Update(): want a panic\n")
+		}
+	}()
+	m.ExportLag.Update(1)
+}
+
+func TestNilReporterMetrics(t *testing.T) {
+	var m *ReporterMetrics
+	called := false
+	if err := m.Flush(func() error { called = true; return nil }); nil != err || !called {
+		t.Errorf("Flush(): %v %v\n", err, called)
+	}
+	m.Drop(1)
+}
+
+func TestReportError(t *testing.T) {
+	var got []error
+	onError := func(err error) { got = append(got, err) }
+	ReportError(onError, nil)
+	boom := errors.New("boom")
+	ReportError(onError, boom)
+	if 1 != len(got) || boom != got[0] {
+		t.Errorf("errors: %v\n", got)
+	}
+}
+
+func TestGraphiteReporterMetrics(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if nil != err {
+		t.Fatal(err)
+	}
+	addr := l.Addr().(*net.TCPAddr)
+	l.Close() // Refuse every connection.
+	r := NewRegistry()
+	for _, name := range []string{"a", "b", "c"} {
+		NewRegisteredGauge(name, r).Update(1)
+	}
+	m := NewReporterMetrics("graphite", NewRegistry())
+	if err := GraphiteOnce(GraphiteConfig{Addr: addr, Registry: r, BatchSize: 2, Metrics: m}); nil == err {
+		t.Fatal("GraphiteOnce(): want error\n")
+	}
+	if count := m.FailedFlushes.Count(); 1 != count {
+		t.Errorf("failed-flushes: 1 != %v\n", count)
+	}
+	if count := m.DroppedPoints.Count(); 3 != count {
+		t.Errorf("dropped-points: 3 != %v\n", count)
+	}
+}
+
+func TestEncodingReporterMetrics(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredCounter("a", r).Inc(1)
+	NewRegisteredCounter("b", r).Inc(1)
+	m := NewReporterMetrics("encoding", NewRegistry())
+	var got []error
+	e := NewEncodingReporter(r, JSONEncoder{}, failingWriter{})
+	e.Metrics, e.OnError = m, func(err error) { got = append(got, err) }
+	ReportError(e.OnError, e.Flush())
+	if 1 != len(got) {
+		t.Errorf("OnError calls: 1 != %v\n", len(got))
+	}
+	if count := m.DroppedPoints.Count(); 2 != count {
+		t.Errorf("dropped-points: 2 != %v\n", count)
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) { return 0, errors.New("disk full") }
@@ -0,0 +1,206 @@
+package metrics
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A SnapshotReporter sends one snapshot of a registry somewhere, e.g. an
+// EncodingReporter writing it to a file or socket.
+type SnapshotReporter interface {
+	Report(s *RegistrySnapshot) error
+}
+
+// SnapshotReporterFunc is a SnapshotReporter of an ordinary function.
+type SnapshotReporterFunc func(s *RegistrySnapshot) error
+
+// Report calls f(s).
+func (f SnapshotReporterFunc) Report(s *RegistrySnapshot) error { return f(s) }
+
+// ReporterFilter selects the series a reporter is sent by their names and
+// tags.  The zero ReporterFilter selects every series.
+type ReporterFilter struct {
+	Include []string          // Name prefixes of the series selected; none selects every name
+	Exclude []string          // Name prefixes of series left out, even if included
+	Tags    map[string]string // Tags every series selected carries, with these values
+
+	// AggregateTags are tag keys, e.g. "pod", aggregated away from the
+	// series selected before they're sent, so that the backend is sent one
+	// series for those which differ only by them; see
+	// RegistrySnapshot.Aggregate.  Match ignores them.
+	AggregateTags []string
+
+	// StaleAfter, if positive, leaves out the gauges selected which haven't
+	// been updated for that long, or with MarkStale set sends them as
+	// StaleNaN; see RegistrySnapshot.Stale.  Match ignores them too.
+	StaleAfter time.Duration
+	MarkStale  bool
+}
+
+// Match returns true if the filter selects the series by the given name,
+// which may carry tags as TaggedName renders them.
+func (f ReporterFilter) Match(name string) bool {
+	base, tags := SplitTaggedName(name)
+	if 0 != len(f.Include) && !hasAnyPrefix(base, f.Include) {
+		return false
+	}
+	if hasAnyPrefix(base, f.Exclude) {
+		return false
+	}
+	for k, v := range f.Tags {
+		if tv, ok := tags[k]; !ok || tv != v {
+			return false
+		}
+	}
+	return true
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Filter returns the snapshots whose names match, without touching the
+// metrics they were taken of.
+func (s *RegistrySnapshot) Filter(match func(name string) bool) *RegistrySnapshot {
+	filtered := &RegistrySnapshot{
+		metrics:     make(map[string]interface{}),
+		percentiles: s.percentiles,
+		timestamp:   s.timestamp,
+	}
+	for _, name := range s.names {
+		if match(name) {
+			filtered.names = append(filtered.names, name)
+			filtered.metrics[name] = s.metrics[name]
+			if updated, ok := s.updated[name]; ok {
+				if nil == filtered.updated {
+					filtered.updated = make(map[string]time.Time)
+				}
+				filtered.updated[name] = updated
+			}
+		}
+	}
+	return filtered
+}
+
+// ReporterErrors is every error of one flush of a MultiReporter, in the order
+// the reporters were added.
+type ReporterErrors []error
+
+func (errs ReporterErrors) Error() string {
+	s := make([]string, len(errs))
+	for i, err := range errs {
+		s[i] = err.Error()
+	}
+	return strings.Join(s, "; ")
+}
+
+// MultiReporter snapshots a registry once per flush and sends the series each
+// of its reporters selects to all of them at once, so that e.g. latency
+// timers go to one backend and business counters to another without
+// registering anything twice or snapshotting once per backend.
+type MultiReporter struct {
+	Registry Registry
+	Reset    bool          // Reset counters, histograms and peak gauges on each flush
+	Schedule FlushSchedule // Alignment and jitter of the flushes of Run
+
+	// OnError is called with the error of every flush of Run which fails,
+	// a ReporterErrors, instead of logging it.
+	OnError func(error)
+
+	// Metrics, if set, records every Flush as a whole, failing if any of
+	// its reporters failed.  Each reporter can record its own, too.
+	Metrics *ReporterMetrics
+
+	mutex     sync.Mutex
+	reporters []filteredReporter
+}
+
+type filteredReporter struct {
+	reporter SnapshotReporter
+	filter   ReporterFilter
+}
+
+// NewMultiReporter constructs a new MultiReporter of r, or of DefaultRegistry
+// if r is nil, with no reporters.
+func NewMultiReporter(r Registry) *MultiReporter {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	return &MultiReporter{Registry: r}
+}
+
+// Add adds a reporter sent the series the filter selects.  A flush which
+// selects no series for it doesn't call it.
+func (m *MultiReporter) Add(reporter SnapshotReporter, filter ReporterFilter) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.reporters = append(m.reporters, filteredReporter{reporter: reporter, filter: filter})
+}
+
+// Flush snapshots the registry and sends each reporter its series
+// concurrently, waiting for them all.  The error is a ReporterErrors of those
+// which failed.  With Reset set, the registry is snapshotted as an
+// EncodingReporter with Reset set does.
+func (m *MultiReporter) Flush() error {
+	return m.Metrics.Flush(m.flush)
+}
+
+func (m *MultiReporter) flush() error {
+	m.mutex.Lock()
+	reporters := append([]filteredReporter(nil), m.reporters...)
+	m.mutex.Unlock()
+	var s *RegistrySnapshot
+	if m.Reset {
+		s = newRegistrySnapshotAndReset(m.Registry)
+	} else {
+		s = m.Registry.Snapshot()
+	}
+	errs := make([]error, len(reporters))
+	var wg sync.WaitGroup
+	for i, r := range reporters {
+		filtered := s.Filter(r.filter.Match).withoutStale(r.filter.StaleAfter, r.filter.MarkStale)
+		if 0 == filtered.Len() {
+			continue
+		}
+		filtered = filtered.Aggregate(r.filter.AggregateTags...)
+		wg.Add(1)
+		go func(i int, r SnapshotReporter) {
+			defer wg.Done()
+			errs[i] = r.Report(filtered)
+		}(i, r.reporter)
+	}
+	wg.Wait()
+	var failed ReporterErrors
+	for _, err := range errs {
+		if nil != err {
+			failed = append(failed, err)
+		}
+	}
+	if 0 == len(failed) {
+		return nil
+	}
+	return failed
+}
+
+// Run calls Flush every d until stop or the registry is closed, logging
+// errors.  This is designed to be called as a goroutine.
+func (m *MultiReporter) Run(d time.Duration, stop <-chan struct{}) {
+	m.Schedule.Run(d, stop, Closed(m.Registry), func(time.Time) {
+		ReportError(m.OnError, m.Flush())
+	})
+}
+
+// RunContext calls Flush every d until ctx is done, when it flushes to every
+// reporter a final time, or the registry is closed, logging errors.
+func (m *MultiReporter) RunContext(ctx context.Context, d time.Duration) {
+	m.Schedule.RunContext(ctx, d, Closed(m.Registry), func(time.Time) {
+		ReportError(m.OnError, m.Flush())
+	})
+}
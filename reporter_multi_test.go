@@ -0,0 +1,79 @@
+package metrics
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestReporterFilter(t *testing.T) {
+	f := ReporterFilter{
+		Include: []string{"http.", "db."},
+		Exclude: []string{"http.debug."},
+		Tags:    map[string]string{"env": "prod"},
+	}
+	for name, want := range map[string]bool{
+		TaggedName("http.latency", map[string]string{"env": "prod"}):         true,
+		TaggedName("db.queries", map[string]string{"env": "prod", "a": "b"}): true,
+		TaggedName("http.latency", map[string]string{"env": "dev"}):          false,
+		"http.latency": false,
+		TaggedName("http.debug.x", map[string]string{"env": "prod"}): false,
+		TaggedName("cache.hits", map[string]string{"env": "prod"}):   false,
+	} {
+		if got := f.Match(name); want != got {
+			t.Errorf("Match(%q): %v != %v\n", name, want, got)
+		}
+	}
+	if !(ReporterFilter{}).Match("anything") {
+		t.Error("zero ReporterFilter doesn't match\n")
+	}
+}
+
+func TestMultiReporter(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredTimer("latency", r)
+	NewRegisteredCounter("orders", r)
+	NewRegisteredCounter("other", r)
+	m := NewMultiReporter(r)
+	var (
+		mutex sync.Mutex
+		got   = make(map[string][]string)
+	)
+	recorder := func(backend string) SnapshotReporter {
+		return SnapshotReporterFunc(func(s *RegistrySnapshot) error {
+			mutex.Lock()
+			defer mutex.Unlock()
+			got[backend] = s.Names()
+			return nil
+		})
+	}
+	m.Add(recorder("prometheus"), ReporterFilter{Include: []string{"latency"}})
+	m.Add(recorder("influx"), ReporterFilter{Include: []string{"orders"}})
+	m.Add(recorder("all"), ReporterFilter{Exclude: []string{"other"}})
+	m.Add(recorder("none"), ReporterFilter{Include: []string{"nothing"}})
+	if err := m.Flush(); nil != err {
+		t.Fatal(err)
+	}
+	want := map[string][]string{
+		"prometheus": {"latency"},
+		"influx":     {"orders"},
+		"all":        {"latency", "orders"},
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("reported: %v != %v\n", want, got)
+	}
+}
+
+func TestMultiReporterErrors(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredCounter("foo", r)
+	m := NewMultiReporter(r)
+	m.Add(SnapshotReporterFunc(func(*RegistrySnapshot) error { return errors.New("a") }), ReporterFilter{})
+	m.Add(SnapshotReporterFunc(func(*RegistrySnapshot) error { return nil }), ReporterFilter{})
+	m.Add(SnapshotReporterFunc(func(*RegistrySnapshot) error { return errors.New("b") }), ReporterFilter{})
+	err := m.Flush()
+	if errs, ok := err.(ReporterErrors); !ok || 2 != len(errs) || "a; b" != err.Error() {
+		t.Errorf("Flush(): %v\n", err)
+	}
+}
@@ -0,0 +1,41 @@
+package metrics
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// ResetHandler returns an http.HandlerFunc which calls ResetAll on the given
+// registry, or DefaultRegistry if it's nil, for an administrator or a soak
+// test's harness to start a clean measurement window.  Only a POST bearing the
+// token, as "Authorization: Bearer <token>", resets anything; it responds 204
+// No Content.  Other methods get 405 Method Not Allowed and requests without
+// the token 403 Forbidden, as do all requests if the token is empty, so that
+// an unconfigured token never leaves the endpoint open.
+func ResetHandler(r Registry, token string) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if http.MethodPost != req.Method {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !authorized(req, token) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		registry := r
+		if nil == registry {
+			registry = DefaultRegistry
+		}
+		registry.ResetAll()
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// authorized returns true if the request bears the token, which mustn't be
+// empty, as "Authorization: Bearer <token>".
+func authorized(req *http.Request, token string) bool {
+	given := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+	return "" != token && 1 == subtle.ConstantTimeCompare([]byte(given), []byte(token))
+}
@@ -0,0 +1,36 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestResetHandler(t *testing.T) {
+	r := NewRegistry()
+	c := GetOrRegisterCounter("foo", r)
+	for _, tc := range []struct {
+		method, token, handlerToken string
+		code                        int
+	}{
+		{"GET", "secret", "secret", http.StatusMethodNotAllowed},
+		{"POST", "", "secret", http.StatusForbidden},
+		{"POST", "wrong", "secret", http.StatusForbidden},
+		{"POST", "", "", http.StatusForbidden},
+		{"POST", "secret", "secret", http.StatusNoContent},
+	} {
+		c.Inc(1)
+		req := httptest.NewRequest(tc.method, "/admin/reset", nil)
+		if "" != tc.token {
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+		}
+		w := httptest.NewRecorder()
+		ResetHandler(r, tc.handlerToken)(w, req)
+		if tc.code != w.Code {
+			t.Errorf("%s with %q: %d != %d\n", tc.method, tc.token, tc.code, w.Code)
+		}
+		if reset := 0 == c.Count(); reset != (http.StatusNoContent == tc.code) {
+			t.Errorf("%s with %q: c.Count(): %v\n", tc.method, tc.token, c.Count())
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package riemann
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// The wire types of protocol buffers which Riemann's messages use.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// encodeMsg encodes the events as a Riemann Msg, preceded by its length as a
+// four-byte big-endian integer as the TCP transport frames it.
+func encodeMsg(events []Event) []byte {
+	var msg []byte
+	for _, e := range events {
+		msg = appendBytes(msg, 6, encodeEvent(e))
+	}
+	b := make([]byte, 4, 4+len(msg))
+	binary.BigEndian.PutUint32(b, uint32(len(msg)))
+	return append(b, msg...)
+}
+
+func encodeEvent(e Event) []byte {
+	var b []byte
+	b = appendVarint(b, 1, uint64(e.Time))
+	if "" != e.State {
+		b = appendBytes(b, 2, []byte(e.State))
+	}
+	b = appendBytes(b, 3, []byte(e.Service))
+	if "" != e.Host {
+		b = appendBytes(b, 4, []byte(e.Host))
+	}
+	for _, tag := range e.Tags {
+		b = appendBytes(b, 7, []byte(tag))
+	}
+	if 0 != e.TTL {
+		b = appendKey(b, 8, wireFixed32)
+		var ttl [4]byte
+		binary.LittleEndian.PutUint32(ttl[:], math.Float32bits(e.TTL))
+		b = append(b, ttl[:]...)
+	}
+	keys := make([]string, 0, len(e.Attributes))
+	for k := range e.Attributes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		var attribute []byte
+		attribute = appendBytes(attribute, 1, []byte(k))
+		attribute = appendBytes(attribute, 2, []byte(e.Attributes[k]))
+		b = appendBytes(b, 9, attribute)
+	}
+	var metric [8]byte
+	binary.LittleEndian.PutUint64(metric[:], math.Float64bits(e.Metric))
+	return append(appendKey(b, 14, wireFixed64), metric[:]...)
+}
+
+func appendUvarint(b []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(b, buf[:binary.PutUvarint(buf[:], v)]...)
+}
+
+func appendKey(b []byte, field int, wire int) []byte {
+	return appendUvarint(b, uint64(field<<3|wire))
+}
+
+func appendVarint(b []byte, field int, v uint64) []byte {
+	return appendUvarint(appendKey(b, field, wireVarint), v)
+}
+
+func appendBytes(b []byte, field int, v []byte) []byte {
+	b = appendUvarint(appendKey(b, field, wireBytes), uint64(len(v)))
+	return append(b, v...)
+}
+
+var errShortMsg = errors.New("riemann: short message")
+
+// decodeAck returns the error of the Msg with which Riemann acknowledges a
+// submission, if it isn't ok.
+func decodeAck(msg []byte) error {
+	ok, reason := false, ""
+	for 0 != len(msg) {
+		key, n := binary.Uvarint(msg)
+		if n <= 0 {
+			return errShortMsg
+		}
+		msg = msg[n:]
+		switch key & 7 {
+		case wireVarint:
+			v, n := binary.Uvarint(msg)
+			if n <= 0 {
+				return errShortMsg
+			}
+			msg = msg[n:]
+			if 2 == key>>3 {
+				ok = 0 != v
+			}
+		case wireFixed64:
+			if len(msg) < 8 {
+				return errShortMsg
+			}
+			msg = msg[8:]
+		case wireBytes:
+			l, n := binary.Uvarint(msg)
+			if n <= 0 || uint64(len(msg)-n) < l {
+				return errShortMsg
+			}
+			if 3 == key>>3 {
+				reason = string(msg[n : n+int(l)])
+			}
+			msg = msg[n+int(l):]
+		case wireFixed32:
+			if len(msg) < 4 {
+				return errShortMsg
+			}
+			msg = msg[4:]
+		default:
+			return fmt.Errorf("riemann: unknown wire type %d", key&7)
+		}
+	}
+	if !ok {
+		return fmt.Errorf("riemann: submission failed: %s", reason)
+	}
+	return nil
+}
@@ -0,0 +1,285 @@
+// Package riemann reports the metrics in a go-metrics Registry to Riemann as
+// events over its TCP protocol, or as a stream of JSON events, one per line,
+// to anything else listening on TCP.
+package riemann
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+// Protocol selects how events are sent.
+type Protocol int
+
+const (
+	// Protobuf sends each flush as a Riemann Msg of protocol buffers and
+	// waits for Riemann to acknowledge it.  This is the default.
+	Protobuf Protocol = iota
+
+	// JSON sends each event as a JSON object followed by a newline, and
+	// waits for nothing.
+	JSON
+)
+
+// Config configures the Riemann reporter.
+type Config struct {
+	Addr          string            // Network address of Riemann, e.g. localhost:5555
+	Registry      metrics.Registry  // Registry to be exported
+	FlushInterval time.Duration     // Flush interval
+	Prefix        string            // Prefix for every service, joined with a dot
+	Host          string            // Host of every event, or os.Hostname if empty
+	Tags          []string          // Riemann tags of every event
+	Attributes    map[string]string // Attributes added to every event, which the metric's own tags override
+	Percentiles   []float64         // Percentiles to export from timers and histograms
+	Protocol      Protocol          // Protobuf or JSON
+
+	// Schedule aligns the flushes of Run to multiples of FlushInterval and
+	// jitters them.
+	Schedule metrics.FlushSchedule
+
+	// TTL is how long Riemann keeps each event, in which the next flush must
+	// replace it before it expires.  Zero means twice FlushInterval, so
+	// that one late flush doesn't expire everything.
+	TTL time.Duration
+
+	// DialTimeout bounds connecting, and each write and acknowledgement.
+	// Zero means no timeout.
+	DialTimeout time.Duration
+
+	// ReconnectAttempts is how many times a flush which fails to connect,
+	// write or be acknowledged reconnects and sends again before giving up
+	// until the next flush.  The connection is kept open between flushes.
+	ReconnectAttempts int
+
+	// OnError is called with the error of each flush of Run which fails.
+	// Nil means it's logged.
+	OnError func(error)
+
+	// Metrics, if set, records each Flush, counting the events of those
+	// which give up reconnecting as dropped.
+	Metrics *metrics.ReporterMetrics
+}
+
+// Event is a Riemann event, as sent in either protocol.  Its service is the
+// name of the metric followed by a space and the name of the field, e.g.
+// "requests rate1", and its metric is the field's value.
+type Event struct {
+	Time       int64             `json:"time"`
+	State      string            `json:"state,omitempty"`
+	Service    string            `json:"service"`
+	Host       string            `json:"host,omitempty"`
+	Metric     float64           `json:"metric"`
+	TTL        float32           `json:"ttl,omitempty"`
+	Tags       []string          `json:"tags,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// Reporter sends the metrics in a registry to Riemann over a connection it
+// keeps open between flushes and replaces once sending fails.
+type Reporter struct {
+	c    Config
+	conn net.Conn
+}
+
+// NewReporter returns a Reporter sending to c.Addr.  It connects on the first
+// flush.
+func NewReporter(c Config) *Reporter {
+	if "" == c.Host {
+		c.Host, _ = os.Hostname()
+	}
+	return &Reporter{c: c}
+}
+
+// Riemann is a blocking exporter function which reports metrics in c.Registry
+// to Riemann every c.FlushInterval, passing errors to c.OnError, or logging
+// them, until c.Registry is closed.
+func Riemann(c Config) {
+	r := NewReporter(c)
+	defer r.Close()
+	r.Run()
+}
+
+// Close closes the reporter's connection, if it's open.
+func (r *Reporter) Close() error {
+	if nil == r.conn {
+		return nil
+	}
+	err := r.conn.Close()
+	r.conn = nil
+	return err
+}
+
+// Flush sends every metric once, reconnecting and sending again up to
+// ReconnectAttempts times.  It mustn't be called concurrently.
+func (r *Reporter) Flush() error {
+	return r.c.Metrics.Flush(r.flush)
+}
+
+func (r *Reporter) flush() error {
+	events := r.Events(time.Now())
+	if 0 == len(events) {
+		return nil
+	}
+	var payload []byte
+	if JSON == r.c.Protocol {
+		for _, e := range events {
+			b, err := json.Marshal(e)
+			if nil != err {
+				return err
+			}
+			payload = append(append(payload, b...), '\n')
+		}
+	} else {
+		payload = encodeMsg(events)
+	}
+	var err error
+	for attempt := 0; attempt <= r.c.ReconnectAttempts; attempt++ {
+		if nil == r.conn {
+			if r.conn, err = net.DialTimeout("tcp", r.c.Addr, r.c.DialTimeout); nil != err {
+				r.conn = nil
+				continue
+			}
+		}
+		if err = r.send(payload); nil == err {
+			return nil
+		}
+		r.Close()
+	}
+	r.c.Metrics.Drop(len(events))
+	return err
+}
+
+// Run flushes every c.FlushInterval, passing errors to c.OnError, or logging
+// them, until c.Registry is closed.
+func (r *Reporter) Run() {
+	r.RunContext(context.Background())
+}
+
+// RunContext is Run until ctx is done, when it flushes a final time,
+// reconnecting as any other flush would, before returning.
+func (r *Reporter) RunContext(ctx context.Context) {
+	r.c.Schedule.RunContext(ctx, r.c.FlushInterval, metrics.Closed(r.c.Registry), func(time.Time) {
+		metrics.ReportError(r.c.OnError, r.Flush())
+	})
+}
+
+// send writes the payload and, in the protobuf protocol, reads Riemann's
+// acknowledgement of it.
+func (r *Reporter) send(payload []byte) error {
+	if 0 != r.c.DialTimeout {
+		r.conn.SetDeadline(time.Now().Add(r.c.DialTimeout))
+	}
+	if _, err := r.conn.Write(payload); nil != err {
+		return err
+	}
+	if JSON == r.c.Protocol {
+		return nil
+	}
+	var header [4]byte
+	if _, err := io.ReadFull(r.conn, header[:]); nil != err {
+		return err
+	}
+	ack := make([]byte, binary.BigEndian.Uint32(header[:]))
+	if _, err := io.ReadFull(r.conn, ack); nil != err {
+		return err
+	}
+	return decodeAck(ack)
+}
+
+// Events renders every metric in c.Registry as events at the given time,
+// sorted by service.  The tags of each metric, and the registry's default
+// tags, become attributes.  Durations of timers are in milliseconds.
+func (r *Reporter) Events(now time.Time) []Event {
+	ttl := r.c.TTL
+	if 0 == ttl {
+		ttl = 2 * r.c.FlushInterval
+	}
+	var events []Event
+	r.c.Registry.EachSnapshot(func(name string, i interface{}) {
+		name, tags := metrics.SplitTaggedName(name)
+		if "" != r.c.Prefix {
+			name = r.c.Prefix + "." + name
+		}
+		attributes := r.attributes(tags)
+		event := func(field string, v float64) {
+			service := name
+			if "" != field {
+				service += " " + field
+			}
+			events = append(events, Event{
+				Time:       now.Unix(),
+				State:      "ok",
+				Service:    service,
+				Host:       r.c.Host,
+				Metric:     v,
+				TTL:        float32(ttl.Seconds()),
+				Tags:       r.c.Tags,
+				Attributes: attributes,
+			})
+		}
+		switch metric := i.(type) {
+		case metrics.Counter:
+			event("", float64(metric.Count()))
+		case metrics.CounterFloat64:
+			event("", metric.Count())
+		case metrics.Gauge:
+			event("", float64(metric.Value()))
+		case metrics.GaugeFloat64:
+			event("", metric.Value())
+		case metrics.MergeableGaugeFloat64:
+			event("", metric.Value())
+		case metrics.Histogram:
+			percentiles := metrics.MetricPercentiles(r.c.Percentiles, metric)
+			ps := metric.Percentiles(percentiles)
+			event("count", float64(metric.Count()))
+			event("min", float64(metric.Min()))
+			event("max", float64(metric.Max()))
+			event("mean", metric.Mean())
+			for i, p := range percentiles {
+				event(metrics.PercentileName(p), ps[i])
+			}
+		case metrics.Meter:
+			event("count", float64(metric.Count()))
+			event("rate1", metric.Rate1())
+			event("rate5", metric.Rate5())
+			event("rate15", metric.Rate15())
+		case metrics.Timer:
+			ms := float64(time.Millisecond)
+			percentiles := metrics.MetricPercentiles(r.c.Percentiles, metric)
+			ps := metric.Percentiles(percentiles)
+			event("count", float64(metric.Count()))
+			event("min", float64(metric.Min())/ms)
+			event("max", float64(metric.Max())/ms)
+			event("mean", metric.Mean()/ms)
+			for i, p := range percentiles {
+				event(metrics.PercentileName(p), ps[i]/ms)
+			}
+			event("rate1", metric.Rate1())
+		}
+	})
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Service < events[j].Service })
+	return events
+}
+
+// attributes merges the configured attributes and the tags.
+func (r *Reporter) attributes(tags map[string]string) map[string]string {
+	if 0 == len(r.c.Attributes)+len(tags) {
+		return nil
+	}
+	merged := make(map[string]string, len(r.c.Attributes)+len(tags))
+	for k, v := range r.c.Attributes {
+		merged[k] = v
+	}
+	for k, v := range tags {
+		merged[k] = v
+	}
+	return merged
+}
@@ -0,0 +1,162 @@
+package riemann
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+// riemannServer accepts connections on a local port, sends the Msg of each
+// submission it reads on the returned channel and acknowledges it with ack.
+func riemannServer(t *testing.T, ack []byte) (string, <-chan []byte) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if nil != err {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	msgs := make(chan []byte, 10)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if nil != err {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				for {
+					var header [4]byte
+					if _, err := io.ReadFull(conn, header[:]); nil != err {
+						return
+					}
+					msg := make([]byte, binary.BigEndian.Uint32(header[:]))
+					if _, err := io.ReadFull(conn, msg); nil != err {
+						return
+					}
+					msgs <- msg
+					binary.BigEndian.PutUint32(header[:], uint32(len(ack)))
+					conn.Write(append(header[:], ack...))
+				}
+			}()
+		}
+	}()
+	return l.Addr().String(), msgs
+}
+
+// countEvents returns the number of events in a Msg.
+func countEvents(t *testing.T, msg []byte) int {
+	n := 0
+	for 0 != len(msg) {
+		key, i := binary.Uvarint(msg)
+		l, j := binary.Uvarint(msg[i:])
+		if wireBytes != key&7 || i <= 0 || j <= 0 {
+			t.Fatalf("unexpected field %d", key)
+		}
+		if 6 == key>>3 {
+			n++
+		}
+		msg = msg[i+j+int(l):]
+	}
+	return n
+}
+
+func TestEncodeEvent(t *testing.T) {
+	got := encodeEvent(Event{Time: 100, Service: "a", Metric: 1})
+	want := []byte{0x08, 0x64, 0x1a, 0x01, 'a', 0x71, 0, 0, 0, 0, 0, 0, 0xf0, 0x3f}
+	if !bytes.Equal(want, got) {
+		t.Errorf("encodeEvent(): % x != % x\n", want, got)
+	}
+}
+
+func TestEvents(t *testing.T) {
+	reg := metrics.NewRegistry()
+	metrics.GetOrRegisterCounterT("hits", map[string]string{"endpoint": "/users"}, reg).Inc(3)
+	r := NewReporter(Config{Registry: reg, FlushInterval: 10 * time.Second, Prefix: "app", Host: "h", Tags: []string{"go"}, Attributes: map[string]string{"env": "prod"}})
+	want := []Event{{
+		Time:       100,
+		State:      "ok",
+		Service:    "app.hits",
+		Host:       "h",
+		Metric:     3,
+		TTL:        20,
+		Tags:       []string{"go"},
+		Attributes: map[string]string{"endpoint": "/users", "env": "prod"},
+	}}
+	if got := r.Events(time.Unix(100, 0)); !reflect.DeepEqual(want, got) {
+		t.Errorf("Events(): %+v != %+v\n", want, got)
+	}
+}
+
+func TestFlush(t *testing.T) {
+	addr, msgs := riemannServer(t, []byte{0x10, 0x01})
+	reg := metrics.NewRegistry()
+	metrics.NewRegisteredGauge("a", reg).Update(1)
+	metrics.NewRegisteredGauge("b", reg).Update(2)
+	r := NewReporter(Config{Addr: addr, Registry: reg, ReconnectAttempts: 1})
+	defer r.Close()
+	if err := r.Flush(); nil != err {
+		t.Fatal(err)
+	}
+	if n := countEvents(t, <-msgs); 2 != n {
+		t.Errorf("events: 2 != %v\n", n)
+	}
+
+	// A dead connection is replaced.
+	r.conn.Close()
+	if err := r.Flush(); nil != err {
+		t.Fatal(err)
+	}
+	<-msgs
+}
+
+func TestFlushNotOK(t *testing.T) {
+	addr, _ := riemannServer(t, []byte{0x10, 0x00, 0x1a, 0x04, 'n', 'o', 'p', 'e'})
+	reg := metrics.NewRegistry()
+	metrics.NewRegisteredGauge("a", reg).Update(1)
+	r := NewReporter(Config{Addr: addr, Registry: reg})
+	defer r.Close()
+	if err := r.Flush(); nil == err || "riemann: submission failed: nope" != err.Error() {
+		t.Errorf("Flush(): %v\n", err)
+	}
+}
+
+func TestFlushJSON(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	lines := make(chan string, 10)
+	go func() {
+		conn, err := l.Accept()
+		if nil != err {
+			return
+		}
+		defer conn.Close()
+		s := bufio.NewScanner(conn)
+		for s.Scan() {
+			lines <- s.Text()
+		}
+	}()
+	reg := metrics.NewRegistry()
+	metrics.NewRegisteredGauge("a", reg).Update(1)
+	r := NewReporter(Config{Addr: l.Addr().String(), Registry: reg, Protocol: JSON, Host: "h", TTL: time.Minute})
+	defer r.Close()
+	if err := r.Flush(); nil != err {
+		t.Fatal(err)
+	}
+	var e Event
+	if err := json.Unmarshal([]byte(<-lines), &e); nil != err {
+		t.Fatal(err)
+	}
+	if "a" != e.Service || 1 != e.Metric || 60 != e.TTL || "h" != e.Host {
+		t.Errorf("event: %+v\n", e)
+	}
+}
@@ -1,8 +1,11 @@
 package metrics
 
 import (
+	"fmt"
+	"reflect"
 	"runtime"
 	"runtime/pprof"
+	"strings"
 	"time"
 )
 
@@ -55,8 +58,37 @@ var (
 // Capture new values for the Go runtime statistics exported in
 // runtime.MemStats.  This is designed to be called as a goroutine.
 func CaptureRuntimeMemStats(r Registry, d time.Duration) {
-	for _ = range time.Tick(d) {
-		CaptureRuntimeMemStatsOnce(r)
+	CaptureRuntimeMemStatsPausable(r, d, nil)
+}
+
+// Capture new values for the Go runtime statistics exported in
+// runtime.MemStats like CaptureRuntimeMemStats, but stop capturing while
+// paused.  Sending true on pause pauses capturing, keeping the last values,
+// and sending false resumes it; closing pause resumes capturing for good.
+// Values derived from the change between captures, such as NumGC, don't
+// include what happened while paused.  It returns once r is closed.  This
+// is designed to be called as a goroutine.
+func CaptureRuntimeMemStatsPausable(r Registry, d time.Duration, pause <-chan bool) {
+	ticker := time.NewTicker(d)
+	defer ticker.Stop()
+	paused := false
+	for {
+		select {
+		case <-ticker.C:
+			if !paused {
+				CaptureRuntimeMemStatsOnce(r)
+			}
+		case p, ok := <-pause:
+			if !ok {
+				pause = nil
+			}
+			if paused && !p {
+				resetRuntimeMemStatsDeltas()
+			}
+			paused = p
+		case <-Closed(r):
+			return
+		}
 	}
 }
 
@@ -142,10 +174,71 @@ func CaptureRuntimeMemStatsOnce(r Registry) {
 	runtimeMetrics.NumThread.Update(int64(threadCreateProfile.Count()))
 }
 
+// resetRuntimeMemStatsDeltas records the current runtime statistics as the
+// baseline for the values CaptureRuntimeMemStatsOnce derives from the change
+// between captures, without updating any metrics.
+func resetRuntimeMemStatsDeltas() {
+	runtime.ReadMemStats(&memStats)
+	frees = memStats.Frees
+	lookups = memStats.Lookups
+	mallocs = memStats.Mallocs
+	numGC = memStats.NumGC
+	numCgoCalls = numCgoCall()
+}
+
 // Register runtimeMetrics for the Go runtime statistics exported in runtime and
 // specifically runtime.MemStats.  The runtimeMetrics are named by their
 // fully-qualified Go symbols, i.e. runtime.MemStats.Alloc.
 func RegisterRuntimeMemStats(r Registry) {
+	for _, m := range newRuntimeMetrics() {
+		r.Register(m.name, m.metric)
+	}
+}
+
+// Register only the selected runtimeMetrics, named as by
+// RegisterRuntimeMemStats.  Fields are given by their unqualified names, i.e.
+// HeapAlloc for runtime.MemStats.HeapAlloc and NumGoroutine for
+// runtime.NumGoroutine.  An unknown field is an error, in which case nothing
+// is registered.  CaptureRuntimeMemStats and CaptureRuntimeMemStatsOnce may be
+// used as usual; the runtimeMetrics which weren't selected are still updated
+// but never exported.
+func RegisterRuntimeMemStatsSelected(r Registry, fields []string) error {
+	for _, field := range fields {
+		if !isRuntimeStatistic(field) {
+			return fmt.Errorf("unknown runtime statistic %q", field)
+		}
+	}
+	all := newRuntimeMetrics()
+	byField := make(map[string]namedRuntimeMetric, len(all))
+	for _, m := range all {
+		byField[m.name[strings.LastIndex(m.name, ".")+1:]] = m
+	}
+	for _, field := range fields {
+		m := byField[field]
+		r.Register(m.name, m.metric)
+	}
+	return nil
+}
+
+// isRuntimeStatistic reports whether runtimeMetrics has a metric for the field
+// of the given unqualified name, so that fields can be checked before
+// newRuntimeMetrics replaces the metrics being captured.
+func isRuntimeStatistic(field string) bool {
+	if _, ok := reflect.TypeOf(runtimeMetrics.MemStats).FieldByName(field); ok {
+		return true
+	}
+	_, ok := reflect.TypeOf(runtimeMetrics).FieldByName(field)
+	return ok && "MemStats" != field
+}
+
+type namedRuntimeMetric struct {
+	name   string
+	metric interface{}
+}
+
+// newRuntimeMetrics constructs new runtimeMetrics and returns them along with
+// their names.
+func newRuntimeMetrics() []namedRuntimeMetric {
 	runtimeMetrics.MemStats.Alloc = NewGauge()
 	runtimeMetrics.MemStats.BuckHashSys = NewGauge()
 	runtimeMetrics.MemStats.DebugGC = NewGauge()
@@ -178,35 +271,37 @@ func RegisterRuntimeMemStats(r Registry) {
 	runtimeMetrics.NumThread = NewGauge()
 	runtimeMetrics.ReadMemStats = NewTimer()
 
-	r.Register("runtime.MemStats.Alloc", runtimeMetrics.MemStats.Alloc)
-	r.Register("runtime.MemStats.BuckHashSys", runtimeMetrics.MemStats.BuckHashSys)
-	r.Register("runtime.MemStats.DebugGC", runtimeMetrics.MemStats.DebugGC)
-	r.Register("runtime.MemStats.EnableGC", runtimeMetrics.MemStats.EnableGC)
-	r.Register("runtime.MemStats.Frees", runtimeMetrics.MemStats.Frees)
-	r.Register("runtime.MemStats.HeapAlloc", runtimeMetrics.MemStats.HeapAlloc)
-	r.Register("runtime.MemStats.HeapIdle", runtimeMetrics.MemStats.HeapIdle)
-	r.Register("runtime.MemStats.HeapInuse", runtimeMetrics.MemStats.HeapInuse)
-	r.Register("runtime.MemStats.HeapObjects", runtimeMetrics.MemStats.HeapObjects)
-	r.Register("runtime.MemStats.HeapReleased", runtimeMetrics.MemStats.HeapReleased)
-	r.Register("runtime.MemStats.HeapSys", runtimeMetrics.MemStats.HeapSys)
-	r.Register("runtime.MemStats.LastGC", runtimeMetrics.MemStats.LastGC)
-	r.Register("runtime.MemStats.Lookups", runtimeMetrics.MemStats.Lookups)
-	r.Register("runtime.MemStats.Mallocs", runtimeMetrics.MemStats.Mallocs)
-	r.Register("runtime.MemStats.MCacheInuse", runtimeMetrics.MemStats.MCacheInuse)
-	r.Register("runtime.MemStats.MCacheSys", runtimeMetrics.MemStats.MCacheSys)
-	r.Register("runtime.MemStats.MSpanInuse", runtimeMetrics.MemStats.MSpanInuse)
-	r.Register("runtime.MemStats.MSpanSys", runtimeMetrics.MemStats.MSpanSys)
-	r.Register("runtime.MemStats.NextGC", runtimeMetrics.MemStats.NextGC)
-	r.Register("runtime.MemStats.NumGC", runtimeMetrics.MemStats.NumGC)
-	r.Register("runtime.MemStats.GCCPUFraction", runtimeMetrics.MemStats.GCCPUFraction)
-	r.Register("runtime.MemStats.PauseNs", runtimeMetrics.MemStats.PauseNs)
-	r.Register("runtime.MemStats.PauseTotalNs", runtimeMetrics.MemStats.PauseTotalNs)
-	r.Register("runtime.MemStats.StackInuse", runtimeMetrics.MemStats.StackInuse)
-	r.Register("runtime.MemStats.StackSys", runtimeMetrics.MemStats.StackSys)
-	r.Register("runtime.MemStats.Sys", runtimeMetrics.MemStats.Sys)
-	r.Register("runtime.MemStats.TotalAlloc", runtimeMetrics.MemStats.TotalAlloc)
-	r.Register("runtime.NumCgoCall", runtimeMetrics.NumCgoCall)
-	r.Register("runtime.NumGoroutine", runtimeMetrics.NumGoroutine)
-	r.Register("runtime.NumThread", runtimeMetrics.NumThread)
-	r.Register("runtime.ReadMemStats", runtimeMetrics.ReadMemStats)
+	return []namedRuntimeMetric{
+		{"runtime.MemStats.Alloc", runtimeMetrics.MemStats.Alloc},
+		{"runtime.MemStats.BuckHashSys", runtimeMetrics.MemStats.BuckHashSys},
+		{"runtime.MemStats.DebugGC", runtimeMetrics.MemStats.DebugGC},
+		{"runtime.MemStats.EnableGC", runtimeMetrics.MemStats.EnableGC},
+		{"runtime.MemStats.Frees", runtimeMetrics.MemStats.Frees},
+		{"runtime.MemStats.HeapAlloc", runtimeMetrics.MemStats.HeapAlloc},
+		{"runtime.MemStats.HeapIdle", runtimeMetrics.MemStats.HeapIdle},
+		{"runtime.MemStats.HeapInuse", runtimeMetrics.MemStats.HeapInuse},
+		{"runtime.MemStats.HeapObjects", runtimeMetrics.MemStats.HeapObjects},
+		{"runtime.MemStats.HeapReleased", runtimeMetrics.MemStats.HeapReleased},
+		{"runtime.MemStats.HeapSys", runtimeMetrics.MemStats.HeapSys},
+		{"runtime.MemStats.LastGC", runtimeMetrics.MemStats.LastGC},
+		{"runtime.MemStats.Lookups", runtimeMetrics.MemStats.Lookups},
+		{"runtime.MemStats.Mallocs", runtimeMetrics.MemStats.Mallocs},
+		{"runtime.MemStats.MCacheInuse", runtimeMetrics.MemStats.MCacheInuse},
+		{"runtime.MemStats.MCacheSys", runtimeMetrics.MemStats.MCacheSys},
+		{"runtime.MemStats.MSpanInuse", runtimeMetrics.MemStats.MSpanInuse},
+		{"runtime.MemStats.MSpanSys", runtimeMetrics.MemStats.MSpanSys},
+		{"runtime.MemStats.NextGC", runtimeMetrics.MemStats.NextGC},
+		{"runtime.MemStats.NumGC", runtimeMetrics.MemStats.NumGC},
+		{"runtime.MemStats.GCCPUFraction", runtimeMetrics.MemStats.GCCPUFraction},
+		{"runtime.MemStats.PauseNs", runtimeMetrics.MemStats.PauseNs},
+		{"runtime.MemStats.PauseTotalNs", runtimeMetrics.MemStats.PauseTotalNs},
+		{"runtime.MemStats.StackInuse", runtimeMetrics.MemStats.StackInuse},
+		{"runtime.MemStats.StackSys", runtimeMetrics.MemStats.StackSys},
+		{"runtime.MemStats.Sys", runtimeMetrics.MemStats.Sys},
+		{"runtime.MemStats.TotalAlloc", runtimeMetrics.MemStats.TotalAlloc},
+		{"runtime.NumCgoCall", runtimeMetrics.NumCgoCall},
+		{"runtime.NumGoroutine", runtimeMetrics.NumGoroutine},
+		{"runtime.NumThread", runtimeMetrics.NumThread},
+		{"runtime.ReadMemStats", runtimeMetrics.ReadMemStats},
+	}
 }
@@ -0,0 +1,186 @@
+//go:build go1.16
+// +build go1.16
+
+package metrics
+
+import (
+	rtmetrics "runtime/metrics"
+	"sync"
+)
+
+// GCPauseHistogramName is the name NewRegisteredGCPauseHistogram is
+// conventionally given.
+const GCPauseHistogramName = "runtime.gc.pauses"
+
+// gcPauseMetrics are the runtime/metrics of GC pauses, most preferred first:
+// Go 1.22 deprecated /gc/pauses:seconds in favour of the first.
+var gcPauseMetrics = []string{
+	"/sched/pauses/total/gc:seconds",
+	"/gc/pauses:seconds",
+}
+
+// NewGCPauseHistogram constructs a new GCPauseHistogram, or a NilHistogram if
+// the running Go version's runtime/metrics doesn't measure GC pauses.
+func NewGCPauseHistogram() Histogram {
+	if useNilMetrics() {
+		return NilHistogram{}
+	}
+	name := gcPauseMetricName()
+	if "" == name {
+		return NilHistogram{}
+	}
+	h := &GCPauseHistogram{
+		StandardHistogram: &StandardHistogram{sample: NewExpDecaySample(1028, 0.015)},
+		samples:           []rtmetrics.Sample{{Name: name}},
+	}
+	// Start from the pauses so far, which happened before it existed.
+	rtmetrics.Read(h.samples)
+	h.last = append(h.last, h.samples[0].Value.Float64Histogram().Counts...)
+	return h
+}
+
+// NewRegisteredGCPauseHistogram constructs and registers a new
+// GCPauseHistogram, conventionally under GCPauseHistogramName.
+func NewRegisteredGCPauseHistogram(name string, r Registry) Histogram {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	if usesNilMetrics(r) {
+		return NilHistogram{}
+	}
+	h := NewGCPauseHistogram()
+	r.Register(name, h)
+	return h
+}
+
+// GCPauseHistogram is a Histogram of the stop-the-world pauses of the garbage
+// collector in nanoseconds, as measured by runtime/metrics on every platform.
+// It reads the pauses since it last did whenever it's read or snapshotted, so
+// it needs no goroutine polling the runtime and no callback from the garbage
+// collector.  As runtime/metrics counts pauses in buckets, each is recorded
+// at the midpoint of its bucket, which is within a few percent of the pause.
+type GCPauseHistogram struct {
+	*StandardHistogram
+
+	mutex   sync.Mutex
+	samples []rtmetrics.Sample
+	last    []uint64 // Bucket counts at the last read
+}
+
+// Count returns the number of pauses since the histogram was created or last
+// cleared.
+func (h *GCPauseHistogram) Count() int64 {
+	h.capture()
+	return h.StandardHistogram.Count()
+}
+
+// Max returns the longest pause in the sample.
+func (h *GCPauseHistogram) Max() int64 {
+	h.capture()
+	return h.StandardHistogram.Max()
+}
+
+// Mean returns the mean of the pauses in the sample.
+func (h *GCPauseHistogram) Mean() float64 {
+	h.capture()
+	return h.StandardHistogram.Mean()
+}
+
+// Min returns the shortest pause in the sample.
+func (h *GCPauseHistogram) Min() int64 {
+	h.capture()
+	return h.StandardHistogram.Min()
+}
+
+// Percentile returns an arbitrary percentile of the pauses in the sample.
+func (h *GCPauseHistogram) Percentile(p float64) float64 {
+	h.capture()
+	return h.StandardHistogram.Percentile(p)
+}
+
+// Percentiles returns a slice of arbitrary percentiles of the pauses in the
+// sample.
+func (h *GCPauseHistogram) Percentiles(ps []float64) []float64 {
+	h.capture()
+	return h.StandardHistogram.Percentiles(ps)
+}
+
+// Sample returns the Sample underlying the histogram, having read the pauses
+// into it.
+func (h *GCPauseHistogram) Sample() Sample {
+	h.capture()
+	return h.StandardHistogram.Sample()
+}
+
+// Snapshot returns a read-only copy of the histogram, having read the pauses
+// since the last read.
+func (h *GCPauseHistogram) Snapshot() Histogram {
+	h.capture()
+	return h.StandardHistogram.Snapshot()
+}
+
+// ReadInto copies the histogram into s, having read the pauses since the last
+// read; see StandardHistogram.ReadInto.
+func (h *GCPauseHistogram) ReadInto(s *HistogramSnapshot) {
+	h.capture()
+	h.StandardHistogram.ReadInto(s)
+}
+
+func (h *GCPauseHistogram) snapshotAndReset() interface{} {
+	h.capture()
+	return h.StandardHistogram.snapshotAndReset()
+}
+
+// StdDev returns the standard deviation of the pauses in the sample.
+func (h *GCPauseHistogram) StdDev() float64 {
+	h.capture()
+	return h.StandardHistogram.StdDev()
+}
+
+// Sum returns the total of the pauses since the histogram was created or last
+// cleared.
+func (h *GCPauseHistogram) Sum() int64 {
+	h.capture()
+	return h.StandardHistogram.Sum()
+}
+
+// SumOverflowed returns true if the total of the pauses doesn't fit in an
+// int64.
+func (h *GCPauseHistogram) SumOverflowed() bool {
+	h.capture()
+	return h.StandardHistogram.SumOverflowed()
+}
+
+// Update panics.
+func (*GCPauseHistogram) Update(int64) {
+	panic("Update called on a GCPauseHistogram")
+}
+
+// Variance returns the variance of the pauses in the sample.
+func (h *GCPauseHistogram) Variance() float64 {
+	h.capture()
+	return h.StandardHistogram.Variance()
+}
+
+// capture records the pauses since the last read.
+func (h *GCPauseHistogram) capture() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	rtmetrics.Read(h.samples)
+	h.last = updateFromRuntimeHistogram(h.StandardHistogram, h.last, h.samples[0].Value.Float64Histogram(), true)
+}
+
+// gcPauseMetricName returns the most preferred of gcPauseMetrics the running
+// Go version supports, or "" if it supports none.
+func gcPauseMetricName() string {
+	supported := make(map[string]bool)
+	for _, d := range rtmetrics.All() {
+		supported[d.Name] = true
+	}
+	for _, name := range gcPauseMetrics {
+		if supported[name] {
+			return name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,55 @@
+//go:build go1.16
+// +build go1.16
+
+package metrics
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestGCPauseHistogram(t *testing.T) {
+	r := NewRegistry()
+	h := NewRegisteredGCPauseHistogram(GCPauseHistogramName, r)
+	if _, ok := h.(*GCPauseHistogram); !ok {
+		t.Skipf("runtime/metrics doesn't measure GC pauses: %T\n", h)
+	}
+	before := h.Count()
+	runtime.GC()
+	runtime.GC()
+	s := r.Get(GCPauseHistogramName).(Histogram).Snapshot()
+	if s.Count()-before < 2 {
+		t.Errorf("s.Count(): %v + 2 > %v\n", before, s.Count())
+	}
+	if s.Max() <= 0 || s.Percentile(0.99) <= 0 {
+		t.Errorf("s.Max(): %v, s.Percentile(0.99): %v\n", s.Max(), s.Percentile(0.99))
+	}
+	if s.Sum() <= 0 {
+		t.Errorf("s.Sum(): %v\n", s.Sum())
+	}
+}
+
+func TestGCPauseHistogramUpdatePanics(t *testing.T) {
+	h := NewGCPauseHistogram()
+	if _, ok := h.(*GCPauseHistogram); !ok {
+		t.Skip("runtime/metrics doesn't measure GC pauses")
+	}
+	defer func() {
+		if nil == recover() {
+			t.Error("Update didn't panic")
+		}
+	}()
+	h.Update(1)
+}
+
+func TestGCPauseHistogramSnapshotAndReset(t *testing.T) {
+	r := NewRegistry()
+	if _, ok := NewRegisteredGCPauseHistogram(GCPauseHistogramName, r).(*GCPauseHistogram); !ok {
+		t.Skip("runtime/metrics doesn't measure GC pauses")
+	}
+	runtime.GC()
+	s := r.SnapshotAndReset().Get(GCPauseHistogramName).(Histogram)
+	if s.Count() < 1 {
+		t.Errorf("s.Count(): 1 > %v\n", s.Count())
+	}
+}
@@ -0,0 +1,193 @@
+//go:build go1.16
+// +build go1.16
+
+package metrics
+
+import (
+	"fmt"
+	"math"
+	rtmetrics "runtime/metrics"
+	"strings"
+	"time"
+)
+
+// DefaultRuntimeMetrics are the runtime/metrics registered by
+// RegisterRuntimeMetrics unless it's given others: heap sizes and allocation,
+// the GC cycle count and pauses, goroutines and scheduler latency.  Those the
+// running Go version doesn't support are skipped.
+var DefaultRuntimeMetrics = []string{
+	"/gc/cycles/total:gc-cycles",
+	"/gc/heap/allocs:bytes",
+	"/gc/heap/frees:bytes",
+	"/gc/heap/goal:bytes",
+	"/gc/heap/objects:objects",
+	"/gc/pauses:seconds",
+	"/memory/classes/heap/objects:bytes",
+	"/memory/classes/total:bytes",
+	"/sched/goroutines:goroutines",
+	"/sched/latencies:seconds",
+}
+
+// maxRuntimeHistogramUpdates bounds the updates one capture makes to each
+// histogram, so that capturing busy distributions such as scheduler latency
+// stays cheap.  Beyond it the buckets' new counts are scaled down
+// proportionally, so the histogram's count undercounts but its distribution
+// holds.
+const maxRuntimeHistogramUpdates = 1028
+
+// RuntimeMetrics updates metrics from the runtime/metrics package, which
+// unlike runtime.ReadMemStats doesn't stop the world.  Each runtime metric is
+// registered under its name with the leading slash dropped and the other
+// slashes and the colon replaced by dots prefixed "runtime.", e.g.
+// runtime.gc.heap.allocs.bytes for /gc/heap/allocs:bytes.  Cumulative integer
+// metrics become Counters, other integer metrics Gauges, floating-point
+// metrics GaugeFloat64s and distributions Histograms, whose values are in
+// nanoseconds if the runtime measures them in seconds.
+type RuntimeMetrics struct {
+	samples []rtmetrics.Sample
+	metrics []interface{}
+	last    []uint64   // Cumulative value of each counter at the last capture
+	buckets [][]uint64 // Bucket counts of each histogram at the last capture
+}
+
+// RegisterRuntimeMetrics registers metrics in r for the given runtime/metrics,
+// or DefaultRuntimeMetrics if none are given, and returns the RuntimeMetrics
+// which captures them.  Naming a runtime metric the running Go version doesn't
+// support is an error, in which case nothing is registered.
+func RegisterRuntimeMetrics(r Registry, names ...string) (*RuntimeMetrics, error) {
+	descriptions := make(map[string]rtmetrics.Description)
+	for _, d := range rtmetrics.All() {
+		descriptions[d.Name] = d
+	}
+	skipUnsupported := 0 == len(names)
+	if skipUnsupported {
+		names = DefaultRuntimeMetrics
+	}
+	rm := &RuntimeMetrics{}
+	for _, name := range names {
+		d, ok := descriptions[name]
+		if !ok {
+			if skipUnsupported {
+				continue
+			}
+			return nil, fmt.Errorf("unknown runtime metric %q", name)
+		}
+		var m interface{}
+		switch d.Kind {
+		case rtmetrics.KindUint64:
+			if d.Cumulative {
+				m = NewCounter()
+			} else {
+				m = NewGauge()
+			}
+		case rtmetrics.KindFloat64:
+			m = NewGaugeFloat64()
+		case rtmetrics.KindFloat64Histogram:
+			m = NewHistogram(NewExpDecaySample(1028, 0.015))
+		default:
+			if skipUnsupported {
+				continue
+			}
+			return nil, fmt.Errorf("unsupported kind of runtime metric %q", name)
+		}
+		rm.samples = append(rm.samples, rtmetrics.Sample{Name: name})
+		rm.metrics = append(rm.metrics, m)
+	}
+	rm.last = make([]uint64, len(rm.samples))
+	rm.buckets = make([][]uint64, len(rm.samples))
+	for i, s := range rm.samples {
+		r.Register(runtimeMetricName(s.Name), rm.metrics[i])
+	}
+	return rm, nil
+}
+
+// Capture reads the runtime metrics and updates the registered metrics.  It
+// isn't safe to call concurrently with itself.
+func (rm *RuntimeMetrics) Capture() {
+	rtmetrics.Read(rm.samples)
+	for i, s := range rm.samples {
+		switch m := rm.metrics[i].(type) {
+		case Counter:
+			v := s.Value.Uint64()
+			m.Inc(int64(v - rm.last[i]))
+			rm.last[i] = v
+		case Gauge:
+			m.Update(int64(s.Value.Uint64()))
+		case GaugeFloat64:
+			m.Update(s.Value.Float64())
+		case Histogram:
+			rm.updateHistogram(i, m, s.Value.Float64Histogram(), strings.HasSuffix(s.Name, ":seconds"))
+		}
+	}
+}
+
+// CaptureEvery calls Capture every d until stop is closed.  This is designed
+// to be called as a goroutine.
+func (rm *RuntimeMetrics) CaptureEvery(d time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(d)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			rm.Capture()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// updateHistogram records the values counted in each bucket since the last
+// capture at the bucket's midpoint.
+func (rm *RuntimeMetrics) updateHistogram(i int, h Histogram, rh *rtmetrics.Float64Histogram, seconds bool) {
+	rm.buckets[i] = updateFromRuntimeHistogram(h, rm.buckets[i], rh, seconds)
+}
+
+// updateFromRuntimeHistogram updates h with the values counted in each bucket
+// of rh since it held the counts in last, at the bucket's midpoint and in
+// nanoseconds if the runtime measures them in seconds.  It returns the counts
+// to pass as last next time, reusing last's storage.
+func updateFromRuntimeHistogram(h Histogram, last []uint64, rh *rtmetrics.Float64Histogram, seconds bool) []uint64 {
+	deltas := make([]uint64, len(rh.Counts))
+	var total uint64
+	for j, n := range rh.Counts {
+		if j < len(last) {
+			n -= last[j]
+		}
+		deltas[j] = n
+		total += n
+	}
+	last = append(last[:0], rh.Counts...)
+	scale := 1.0
+	if total > maxRuntimeHistogramUpdates {
+		scale = float64(maxRuntimeHistogramUpdates) / float64(total)
+	}
+	for j, n := range deltas {
+		if 0 == n {
+			continue
+		}
+		v := bucketMidpoint(rh.Buckets[j], rh.Buckets[j+1])
+		if seconds {
+			v *= float64(time.Second)
+		}
+		for k := uint64(float64(n)*scale + 0.5); k > 0; k-- {
+			h.Update(int64(v))
+		}
+	}
+	return last
+}
+
+// bucketMidpoint returns the midpoint of a bucket, or its finite bound if the
+// other is infinite.
+func bucketMidpoint(lo, hi float64) float64 {
+	switch {
+	case math.IsInf(lo, -1):
+		return hi
+	case math.IsInf(hi, 1):
+		return lo
+	}
+	return lo + (hi-lo)/2
+}
+
+func runtimeMetricName(name string) string {
+	return "runtime." + strings.NewReplacer("/", ".", ":", ".").Replace(strings.TrimPrefix(name, "/"))
+}
@@ -0,0 +1,66 @@
+//go:build go1.16
+// +build go1.16
+
+package metrics
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestRuntimeMetrics(t *testing.T) {
+	r := NewRegistry()
+	rm, err := RegisterRuntimeMetrics(r)
+	if nil != err {
+		t.Fatal(err)
+	}
+	rm.Capture()
+	cycles, ok := r.Get("runtime.gc.cycles.total.gc-cycles").(Counter)
+	if !ok {
+		t.Fatal(r.Get("runtime.gc.cycles.total.gc-cycles"))
+	}
+	before := cycles.Count()
+	runtime.GC()
+	rm.Capture()
+	if n := cycles.Count() - before; n < 1 {
+		t.Errorf("GC cycles: 1 > %v\n", n)
+	}
+	if g, ok := r.Get("runtime.sched.goroutines.goroutines").(Gauge); !ok || g.Value() < 1 {
+		t.Errorf("goroutines: %v\n", r.Get("runtime.sched.goroutines.goroutines"))
+	}
+	if h, ok := r.Get("runtime.gc.pauses.seconds").(Histogram); !ok || 0 == h.Count() {
+		t.Errorf("GC pauses: %v\n", r.Get("runtime.gc.pauses.seconds"))
+	}
+}
+
+func TestRegisterRuntimeMetricsUnknown(t *testing.T) {
+	r := NewRegistry()
+	if _, err := RegisterRuntimeMetrics(r, "/sched/goroutines:goroutines", "/no/such:metric"); nil == err {
+		t.Error("RegisterRuntimeMetrics(): want error\n")
+	}
+	n := 0
+	r.Each(func(string, interface{}) { n++ })
+	if 0 != n {
+		t.Errorf("registered: 0 != %v\n", n)
+	}
+}
+
+func TestRuntimeMetricsHistogramUpdatesBounded(t *testing.T) {
+	r := NewRegistry()
+	rm, err := RegisterRuntimeMetrics(r, "/sched/latencies:seconds")
+	if nil != err {
+		t.Skip(err)
+	}
+	rm.Capture()
+	if h := r.Get("runtime.sched.latencies.seconds").(Histogram); h.Count() > maxRuntimeHistogramUpdates+int64(len(rm.buckets[0])) {
+		t.Errorf("Count(): %v\n", h.Count())
+	}
+}
+
+func BenchmarkRuntimeMetrics(b *testing.B) {
+	rm, _ := RegisterRuntimeMetrics(NewRegistry())
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rm.Capture()
+	}
+}
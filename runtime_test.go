@@ -2,6 +2,7 @@ package metrics
 
 import (
 	"runtime"
+	"strings"
 	"testing"
 	"time"
 )
@@ -18,6 +19,7 @@ func BenchmarkRuntimeMemStats(b *testing.B) {
 func TestRuntimeMemStats(t *testing.T) {
 	r := NewRegistry()
 	RegisterRuntimeMemStats(r)
+	runtime.GC() // Finish any cycle earlier tests left in progress.
 	CaptureRuntimeMemStatsOnce(r)
 	zero := runtimeMetrics.MemStats.PauseNs.Count() // Get a "zero" since GC may have run before these tests.
 	runtime.GC()
@@ -47,6 +49,48 @@ func TestRuntimeMemStats(t *testing.T) {
 	}
 }
 
+func TestCaptureRuntimeMemStatsPausable(t *testing.T) {
+	r := NewRegistry()
+	RegisterRuntimeMemStats(r)
+	pause := make(chan bool)
+	exited := make(chan struct{})
+	go func() {
+		CaptureRuntimeMemStatsPausable(r, time.Millisecond, pause)
+		close(exited)
+	}()
+	defer func() {
+		close(pause)
+		r.Close()
+		<-exited
+	}()
+
+	pause <- true
+	count := runtimeMetrics.ReadMemStats.Count()
+	time.Sleep(20 * time.Millisecond)
+	if c := runtimeMetrics.ReadMemStats.Count(); count != c {
+		t.Fatalf("captured %d times while paused", c-count)
+	}
+
+	pause <- false
+	time.Sleep(20 * time.Millisecond)
+	if c := runtimeMetrics.ReadMemStats.Count(); count == c {
+		t.Fatal("didn't capture after resuming")
+	}
+}
+
+func TestRuntimeMemStatsResetDeltas(t *testing.T) {
+	r := NewRegistry()
+	RegisterRuntimeMemStats(r)
+	CaptureRuntimeMemStatsOnce(r)
+	runtime.GC()
+	runtime.GC()
+	resetRuntimeMemStatsDeltas()
+	CaptureRuntimeMemStatsOnce(r)
+	if value := runtimeMetrics.MemStats.NumGC.Value(); 0 != value {
+		t.Fatal(value)
+	}
+}
+
 func TestRuntimeMemStatsNumThread(t *testing.T) {
 	r := NewRegistry()
 	RegisterRuntimeMemStats(r)
@@ -57,6 +101,52 @@ func TestRuntimeMemStatsNumThread(t *testing.T) {
 	}
 }
 
+func TestRegisterRuntimeMemStatsSelected(t *testing.T) {
+	r := NewRegistry()
+	if err := RegisterRuntimeMemStatsSelected(r, []string{"HeapAlloc", "NumGoroutine"}); nil != err {
+		t.Fatal(err)
+	}
+	i := 0
+	r.Each(func(string, interface{}) { i++ })
+	if 2 != i {
+		t.Fatalf("registered %d metrics", i)
+	}
+	CaptureRuntimeMemStatsOnce(r)
+	if v := r.Get("runtime.MemStats.HeapAlloc").(Gauge).Value(); 0 == v {
+		t.Errorf("runtime.MemStats.HeapAlloc: 0 == %v\n", v)
+	}
+	if v := r.Get("runtime.NumGoroutine").(Gauge).Value(); 0 == v {
+		t.Errorf("runtime.NumGoroutine: 0 == %v\n", v)
+	}
+}
+
+func TestRegisterRuntimeMemStatsSelectedUnknown(t *testing.T) {
+	all := NewRegistry()
+	RegisterRuntimeMemStats(all)
+	r := NewRegistry()
+	if err := RegisterRuntimeMemStatsSelected(r, []string{"HeapAlloc", "HeapAloc"}); nil == err {
+		t.Fatal(err)
+	}
+	if nil != r.Get("runtime.MemStats.HeapAlloc") {
+		t.Fatal(r.Get("runtime.MemStats.HeapAlloc"))
+	}
+	// The metrics registered before are still the ones captured.
+	if runtimeMetrics.MemStats.HeapAlloc != all.Get("runtime.MemStats.HeapAlloc") {
+		t.Error("runtime.MemStats.HeapAlloc replaced by a failed selection\n")
+	}
+}
+
+func TestRuntimeStatistics(t *testing.T) {
+	for _, m := range newRuntimeMetrics() {
+		if field := m.name[strings.LastIndex(m.name, ".")+1:]; !isRuntimeStatistic(field) {
+			t.Errorf("isRuntimeStatistic(%q): false\n", field)
+		}
+	}
+	if isRuntimeStatistic("MemStats") {
+		t.Error("isRuntimeStatistic(\"MemStats\"): true\n")
+	}
+}
+
 func TestRuntimeMemStatsBlocking(t *testing.T) {
 	if g := runtime.GOMAXPROCS(0); g < 2 {
 		t.Skipf("skipping TestRuntimeMemStatsBlocking with GOMAXPROCS=%d\n", g)
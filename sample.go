@@ -2,8 +2,11 @@ package metrics
 
 import (
 	"math"
+	"math/bits"
 	"math/rand"
 	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
@@ -29,6 +32,30 @@ type Sample interface {
 	Variance() float64
 }
 
+// batchSample is implemented by samples which can record n copies of a value
+// at less cost than n calls to Update, as the built-in ones do.
+type batchSample interface {
+	UpdateN(v, n int64)
+}
+
+// sampleUpdateN records n copies of v in s, one at a time unless s is a
+// batchSample.
+func sampleUpdateN(s Sample, v, n int64) {
+	if b, ok := s.(batchSample); ok {
+		b.UpdateN(v, n)
+		return
+	}
+	for ; n > 0; n-- {
+		s.Update(v)
+	}
+}
+
+// clearingSample is implemented by samples which can be snapshotted and
+// cleared at once.
+type clearingSample interface {
+	snapshotAndClear() Sample
+}
+
 // ExpDecaySample is an exponentially-decaying sample using a forward-decaying
 // priority reservoir.  See Cormode et al's "Forward Decay: A Practical Time
 // Decay Model for Streaming Systems".
@@ -39,6 +66,7 @@ type ExpDecaySample struct {
 	count         int64
 	mutex         sync.Mutex
 	reservoirSize int
+	sum           runningSum
 	t0, t1        time.Time
 	values        *expDecaySampleHeap
 }
@@ -46,13 +74,13 @@ type ExpDecaySample struct {
 // NewExpDecaySample constructs a new exponentially-decaying sample with the
 // given reservoir size and alpha.
 func NewExpDecaySample(reservoirSize int, alpha float64) Sample {
-	if UseNilMetrics {
+	if useNilMetrics() {
 		return NilSample{}
 	}
 	s := &ExpDecaySample{
 		alpha:         alpha,
 		reservoirSize: reservoirSize,
-		t0:            time.Now(),
+		t0:            now(),
 		values:        newExpDecaySampleHeap(reservoirSize),
 	}
 	s.t1 = s.t0.Add(rescaleThreshold)
@@ -63,8 +91,14 @@ func NewExpDecaySample(reservoirSize int, alpha float64) Sample {
 func (s *ExpDecaySample) Clear() {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
+	s.clear()
+}
+
+func (s *ExpDecaySample) clear() {
+	// should run with s.mutex held
 	s.count = 0
-	s.t0 = time.Now()
+	s.sum = runningSum{}
+	s.t0 = now()
 	s.t1 = s.t0.Add(rescaleThreshold)
 	s.values.Clear()
 }
@@ -114,15 +148,48 @@ func (s *ExpDecaySample) Size() int {
 
 // Snapshot returns a read-only copy of the sample.
 func (s *ExpDecaySample) Snapshot() Sample {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.snapshot()
+}
+
+// snapshotAndClear returns a read-only copy of the sample and clears it
+// without letting any update in between.
+func (s *ExpDecaySample) snapshotAndClear() Sample {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	snapshot := s.snapshot()
+	s.clear()
+	return snapshot
+}
+
+// readInto copies the sample into dst, reusing its values.
+func (s *ExpDecaySample) readInto(dst *SampleSnapshot) {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 	vals := s.values.Values()
+	dst.values = dst.values[:0]
+	for _, v := range vals {
+		dst.values = append(dst.values, v.v)
+	}
+	dst.count = s.count
+	if nil == dst.sum {
+		dst.sum = &runningSum{}
+	}
+	*dst.sum = s.sum
+}
+
+func (s *ExpDecaySample) snapshot() *SampleSnapshot {
+	// should run with s.mutex held
+	vals := s.values.Values()
 	values := make([]int64, len(vals))
 	for i, v := range vals {
 		values[i] = v.v
 	}
+	sum := s.sum
 	return &SampleSnapshot{
 		count:  s.count,
+		sum:    &sum,
 		values: values,
 	}
 }
@@ -132,14 +199,31 @@ func (s *ExpDecaySample) StdDev() float64 {
 	return SampleStdDev(s.Values())
 }
 
-// Sum returns the sum of the values in the sample.
+// Sum returns the sum of every value recorded, like Count, not only of those
+// in the sample.
 func (s *ExpDecaySample) Sum() int64 {
-	return SampleSum(s.Values())
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.sum.value()
+}
+
+// SumOverflowed returns true if the sum doesn't fit in an int64, in which
+// case Sum is saturated.
+func (s *ExpDecaySample) SumOverflowed() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.sum.overflowed()
 }
 
 // Update samples a new value.
 func (s *ExpDecaySample) Update(v int64) {
-	s.update(time.Now(), v)
+	s.update(now(), v)
+}
+
+// UpdateN samples n copies of a value, as n calls to Update at once would,
+// but drawing at most as many priorities as the reservoir holds.
+func (s *ExpDecaySample) UpdateN(v, n int64) {
+	s.updateN(now(), v, n)
 }
 
 // Values returns a copy of the values in the sample.
@@ -165,6 +249,7 @@ func (s *ExpDecaySample) update(t time.Time, v int64) {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 	s.count++
+	s.sum.add(v)
 	if s.values.Size() == s.reservoirSize {
 		s.values.Pop()
 	}
@@ -172,16 +257,62 @@ func (s *ExpDecaySample) update(t time.Time, v int64) {
 		k: math.Exp(t.Sub(s.t0).Seconds()*s.alpha) / rand.Float64(),
 		v: v,
 	})
-	if t.After(s.t1) {
-		values := s.values.Values()
-		t0 := s.t0
-		s.values.Clear()
-		s.t0 = t
-		s.t1 = s.t0.Add(rescaleThreshold)
-		for _, v := range values {
-			v.k = v.k * math.Exp(-s.alpha*s.t0.Sub(t0).Seconds())
-			s.values.Push(v)
+	s.rescale(t)
+}
+
+// updateN samples n copies of a value at a particular timestamp.  Once the
+// reservoir is full, each update pops the lowest priority before pushing its
+// own, so n of them leave the last copy and the highest reservoirSize-1
+// priorities of the reservoir and the other n-1 copies.  All the copies share
+// a weight, so the highest of their priorities are those of the lowest of
+// n-1 uniform random numbers, which are drawn in ascending order.
+func (s *ExpDecaySample) updateN(t time.Time, v, n int64) {
+	if n <= 0 {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.count += n
+	s.sum.addN(v, n)
+	w := math.Exp(t.Sub(s.t0).Seconds() * s.alpha)
+	for ; n > 0 && s.values.Size() < s.reservoirSize; n-- {
+		s.values.Push(expDecaySample{k: w / rand.Float64(), v: v})
+	}
+	if n > 0 {
+		s.values.Pop()
+		keep, rest := s.reservoirSize-1, n-1
+		u := 0.0
+		for i := int64(0); i < rest && i < int64(keep); i++ {
+			u += (1 - u) * -math.Expm1(math.Log(rand.Float64())/float64(rest-i))
+			k := w / u
+			if s.values.Size() == keep {
+				if k <= s.values.s[0].k {
+					break
+				}
+				s.values.Pop()
+			}
+			s.values.Push(expDecaySample{k: k, v: v})
 		}
+		s.values.Push(expDecaySample{k: w / rand.Float64(), v: v})
+	}
+	s.rescale(t)
+}
+
+// rescale moves the landmark time on to t, scaling down every priority, once
+// it's more than rescaleThreshold on from the last.
+func (s *ExpDecaySample) rescale(t time.Time) {
+	// should run with s.mutex held
+	if !t.After(s.t1) {
+		return
+	}
+	values := s.values.Values()
+	t0 := s.t0
+	s.values.Clear()
+	s.t0 = t
+	s.t1 = s.t0.Add(rescaleThreshold)
+	for _, v := range values {
+		v.k = v.k * math.Exp(-s.alpha*s.t0.Sub(t0).Seconds())
+		s.values.Push(v)
 	}
 }
 
@@ -251,7 +382,9 @@ func SampleMean(values []int64) float64 {
 	if 0 == len(values) {
 		return 0.0
 	}
-	return float64(SampleSum(values)) / float64(len(values))
+	var sum runningSum
+	sum.addAll(values)
+	return sum.float64() / float64(len(values))
 }
 
 // SampleMin returns the minimum value of the slice of int64.
@@ -296,9 +429,49 @@ func SamplePercentiles(values int64Slice, ps []float64) []float64 {
 	return scores
 }
 
+// DefaultPercentiles are the percentiles of histograms and timers which the
+// exporters in this package report unless they or the registry are
+// configured otherwise; see StandardRegistry.SetPercentiles.
+var DefaultPercentiles = []float64{0.5, 0.75, 0.95, 0.99, 0.999}
+
+// PercentileName returns a name for the percentile p which preserves as much
+// precision as p has, replacing the decimal point with an underscore so that
+// it's safe in metric names, e.g. p50 for 0.5, p99_9 for 0.999 and p99_99 for
+// 0.9999.
+func PercentileName(p float64) string {
+	return "p" + strings.Replace(formatPercent(p), ".", "_", 1)
+}
+
+// percentileLabel labels the percentile p in text meant for people, e.g.
+// median for 0.5 and 99.9% for 0.999.
+func percentileLabel(p float64) string {
+	if 0.5 == p {
+		return "median"
+	}
+	return formatPercent(p) + "%"
+}
+
+// percentileKey names the percentile p as a field of structured output, e.g.
+// median for 0.5, p95 for 0.95 and p999 for 0.999.
+func percentileKey(p float64) string {
+	if 0.5 == p {
+		return "median"
+	}
+	return "p" + strings.Replace(formatPercent(p), ".", "", 1)
+}
+
+// formatPercent formats the percentile p as a percentage with no more decimal
+// places than it needs, ignoring the rounding error in multiplying by 100.
+func formatPercent(p float64) string {
+	s := strconv.FormatFloat(p*100, 'f', 6, 64)
+	s = strings.TrimRight(s, "0")
+	return strings.TrimSuffix(s, ".")
+}
+
 // SampleSnapshot is a read-only copy of another Sample.
 type SampleSnapshot struct {
 	count  int64
+	sum    *runningSum // of every value counted, or nil for those of values
 	values []int64
 }
 
@@ -348,8 +521,24 @@ func (s *SampleSnapshot) Snapshot() Sample { return s }
 // taken.
 func (s *SampleSnapshot) StdDev() float64 { return SampleStdDev(s.values) }
 
-// Sum returns the sum of values at the time the snapshot was taken.
-func (s *SampleSnapshot) Sum() int64 { return SampleSum(s.values) }
+// Sum returns the sum at the time the snapshot was taken, of every value
+// counted if the snapshot was taken of an ExpDecaySample or UniformSample and
+// of its values otherwise.
+func (s *SampleSnapshot) Sum() int64 {
+	if nil != s.sum {
+		return s.sum.value()
+	}
+	return SampleSum(s.values)
+}
+
+// SumOverflowed returns true if the sum at the time the snapshot was taken
+// doesn't fit in an int64, in which case Sum is saturated.
+func (s *SampleSnapshot) SumOverflowed() bool {
+	if nil != s.sum {
+		return s.sum.overflowed()
+	}
+	return SampleSumOverflowed(s.values)
+}
 
 // Update panics.
 func (*SampleSnapshot) Update(int64) {
@@ -371,13 +560,89 @@ func SampleStdDev(values []int64) float64 {
 	return math.Sqrt(SampleVariance(values))
 }
 
-// SampleSum returns the sum of the slice of int64.
+// SampleSum returns the sum of the slice of int64.  If the sum doesn't fit in
+// an int64 it saturates at math.MaxInt64 or math.MinInt64 rather than
+// wrapping around; SampleSumOverflowed reports whether that happened.
 func SampleSum(values []int64) int64 {
-	var sum int64
+	var sum runningSum
+	sum.addAll(values)
+	return sum.value()
+}
+
+// SampleSumOverflowed returns true if the sum of the slice of int64 doesn't
+// fit in an int64.
+func SampleSumOverflowed(values []int64) bool {
+	var sum runningSum
+	sum.addAll(values)
+	return sum.overflowed()
+}
+
+// runningSum is a sum of int64 kept as a 128-bit two's complement integer
+// split into its high and low 64 bits, which cannot overflow for any number of
+// values that could be counted in an int64.
+type runningSum struct {
+	hi int64
+	lo uint64
+}
+
+func (s *runningSum) add(v int64) {
+	var carry uint64
+	s.lo, carry = bits.Add64(s.lo, uint64(v), 0)
+	s.hi += int64(carry) + v>>63
+}
+
+// addN adds v to the sum n times, for n >= 0.
+func (s *runningSum) addN(v, n int64) {
+	hi, lo := mul128(v, n)
+	var carry uint64
+	s.lo, carry = bits.Add64(s.lo, lo, 0)
+	s.hi += hi + int64(carry)
+}
+
+// mul128 returns v*n as a 128-bit two's complement integer, for n >= 0.
+func mul128(v, n int64) (hi int64, lo uint64) {
+	abs := uint64(v)
+	if v < 0 {
+		abs = uint64(-v)
+	}
+	h, l := bits.Mul64(abs, uint64(n))
+	if v < 0 {
+		h, l = ^h, ^l+1
+		if 0 == l {
+			h++
+		}
+	}
+	return int64(h), l
+}
+
+func (s *runningSum) addAll(values []int64) {
 	for _, v := range values {
-		sum += v
+		s.add(v)
 	}
-	return sum
+}
+
+// float64 returns the sum, rounded to the nearest float64.  The low 64 bits
+// are taken as signed, borrowing from the high ones when they're negative, so
+// that a negative sum which fits in an int64 converts exactly as that int64.
+func (s runningSum) float64() float64 {
+	if !s.overflowed() {
+		return float64(int64(s.lo))
+	}
+	return math.Ldexp(float64(s.hi-(int64(s.lo)>>63)), 64) + float64(int64(s.lo))
+}
+
+// overflowed returns true if the sum doesn't fit in an int64.
+func (s runningSum) overflowed() bool { return s.hi != int64(s.lo)>>63 }
+
+// value returns the sum saturated to an int64.
+func (s runningSum) value() int64 {
+	if !s.overflowed() {
+		return int64(s.lo)
+	}
+	if s.hi < 0 {
+		return math.MinInt64
+	}
+	return math.MaxInt64
 }
 
 // SampleVariance returns the variance of the slice of int64.
@@ -401,13 +666,14 @@ type UniformSample struct {
 	count         int64
 	mutex         sync.Mutex
 	reservoirSize int
+	sum           runningSum
 	values        []int64
 }
 
 // NewUniformSample constructs a new uniform sample with the given reservoir
 // size.
 func NewUniformSample(reservoirSize int) Sample {
-	if UseNilMetrics {
+	if useNilMetrics() {
 		return NilSample{}
 	}
 	return &UniformSample{
@@ -420,7 +686,13 @@ func NewUniformSample(reservoirSize int) Sample {
 func (s *UniformSample) Clear() {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
+	s.clear()
+}
+
+func (s *UniformSample) clear() {
+	// should run with s.mutex held
 	s.count = 0
+	s.sum = runningSum{}
 	s.values = make([]int64, 0, s.reservoirSize)
 }
 
@@ -483,12 +755,38 @@ func (s *UniformSample) Snapshot() Sample {
 	defer s.mutex.Unlock()
 	values := make([]int64, len(s.values))
 	copy(values, s.values)
+	sum := s.sum
 	return &SampleSnapshot{
 		count:  s.count,
+		sum:    &sum,
 		values: values,
 	}
 }
 
+// readInto copies the sample into dst, reusing its values.
+func (s *UniformSample) readInto(dst *SampleSnapshot) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	dst.values = append(dst.values[:0], s.values...)
+	dst.count = s.count
+	if nil == dst.sum {
+		dst.sum = &runningSum{}
+	}
+	*dst.sum = s.sum
+}
+
+// snapshotAndClear returns a read-only copy of the sample and clears it
+// without letting any update in between.
+func (s *UniformSample) snapshotAndClear() Sample {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	// clear allocates new values so the old ones can be handed over.
+	sum := s.sum
+	snapshot := &SampleSnapshot{count: s.count, sum: &sum, values: s.values}
+	s.clear()
+	return snapshot
+}
+
 // StdDev returns the standard deviation of the values in the sample.
 func (s *UniformSample) StdDev() float64 {
 	s.mutex.Lock()
@@ -496,11 +794,20 @@ func (s *UniformSample) StdDev() float64 {
 	return SampleStdDev(s.values)
 }
 
-// Sum returns the sum of the values in the sample.
+// Sum returns the sum of every value recorded, like Count, not only of those
+// in the sample.
 func (s *UniformSample) Sum() int64 {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
-	return SampleSum(s.values)
+	return s.sum.value()
+}
+
+// SumOverflowed returns true if the sum doesn't fit in an int64, in which
+// case Sum is saturated.
+func (s *UniformSample) SumOverflowed() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.sum.overflowed()
 }
 
 // Update samples a new value.
@@ -508,6 +815,7 @@ func (s *UniformSample) Update(v int64) {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 	s.count++
+	s.sum.add(v)
 	if len(s.values) < s.reservoirSize {
 		s.values = append(s.values, v)
 	} else {
@@ -518,6 +826,41 @@ func (s *UniformSample) Update(v int64) {
 	}
 }
 
+// UpdateN samples n copies of a value, as n calls to Update would, but with
+// at most as many random numbers as the reservoir holds.
+func (s *UniformSample) UpdateN(v, n int64) {
+	if n <= 0 {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.sum.addN(v, n)
+	for ; n > 0 && len(s.values) < s.reservoirSize; n-- {
+		s.count++
+		s.values = append(s.values, v)
+	}
+	if n <= int64(len(s.values)) {
+		for ; n > 0; n-- {
+			s.count++
+			if r := rand.Int63n(s.count); r < int64(len(s.values)) {
+				s.values[int(r)] = v
+			}
+		}
+		return
+	}
+	// The reservoir is a uniformly random choice of len(s.values) of every
+	// value counted, so it holds as many of the new copies as drawing that
+	// many values one at a time without replacement would.
+	s.count += n
+	total := s.count
+	for i := range s.values {
+		if rand.Int63n(total-int64(i)) < n {
+			s.values[i] = v
+			n--
+		}
+	}
+}
+
 // Values returns a copy of the values in the sample.
 func (s *UniformSample) Values() []int64 {
 	s.mutex.Lock()
@@ -614,3 +957,151 @@ type int64Slice []int64
 func (p int64Slice) Len() int           { return len(p) }
 func (p int64Slice) Less(i, j int) bool { return p[i] < p[j] }
 func (p int64Slice) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+
+// moments are the exact statistics of the values counted by a sample which
+// keeps buckets rather than values, such as a DDSketchSample.
+type moments struct {
+	count    int64
+	min, max int64
+	mean, m2 float64 // Running mean and sum of squared deviations
+	sum      runningSum
+}
+
+func (m *moments) Max() int64 {
+	if 0 == m.count {
+		return 0
+	}
+	return m.max
+}
+
+func (m *moments) Mean() float64 { return m.mean }
+
+func (m *moments) Min() int64 {
+	if 0 == m.count {
+		return 0
+	}
+	return m.min
+}
+
+func (m *moments) Size() int { return int(m.count) }
+
+func (m *moments) StdDev() float64 { return math.Sqrt(m.Variance()) }
+
+func (m *moments) Sum() int64 { return m.sum.value() }
+
+func (m *moments) Variance() float64 {
+	if 0 == m.count {
+		return 0.0
+	}
+	return m.m2 / float64(m.count)
+}
+
+func (m *moments) clear() {
+	*m = moments{min: math.MaxInt64, max: math.MinInt64}
+}
+
+// merge adds the statistics of other to m.
+func (m *moments) merge(other *moments) {
+	if 0 == other.count {
+		return
+	}
+	prev := m.count
+	m.count += other.count
+	if other.min < m.min {
+		m.min = other.min
+	}
+	if other.max > m.max {
+		m.max = other.max
+	}
+	// Chan et al's parallel algorithm for the mean and squared deviations.
+	d := other.mean - m.mean
+	m.mean += d * float64(other.count) / float64(m.count)
+	m.m2 += other.m2 + d*d*float64(prev)*float64(other.count)/float64(m.count)
+	var carry uint64
+	m.sum.lo, carry = bits.Add64(m.sum.lo, other.sum.lo, 0)
+	m.sum.hi += other.sum.hi + int64(carry)
+}
+
+// updateN adds n copies of v, for n > 0, merging them into the running mean
+// and sum of squared deviations as a group whose own deviations are zero.
+func (m *moments) updateN(v, n int64) {
+	prev := m.count
+	m.count += n
+	if v < m.min {
+		m.min = v
+	}
+	if v > m.max {
+		m.max = v
+	}
+	d := float64(v) - m.mean
+	m.mean += d * float64(n) / float64(m.count)
+	m.m2 += d * d * float64(prev) * float64(n) / float64(m.count)
+	m.sum.addN(v, n)
+}
+
+// bucketsOf returns, for each of the given bounds, the number of values whose
+// bucket's representative value, as each passes them in increasing order, is
+// less than or equal to it.
+func bucketsOf(each func(func(v float64, n int64) bool), bounds []float64) []uint64 {
+	buckets := make([]uint64, len(bounds))
+	var n int64
+	j := 0
+	each(func(v float64, k int64) bool {
+		for ; j < len(bounds) && bounds[j] < v; j++ {
+			buckets[j] = uint64(n)
+		}
+		n += k
+		return j < len(bounds)
+	})
+	for ; j < len(bounds); j++ {
+		buckets[j] = uint64(n)
+	}
+	return buckets
+}
+
+// percentilesOf returns the representative value of the bucket, as each
+// passes them in increasing order, holding the value at each rank, that is the
+// smallest such that the given fraction of values are less than or equal to
+// it, but never beyond Min or Max.
+func (m *moments) percentilesOf(each func(func(v float64, n int64) bool), ps []float64) []float64 {
+	scores := make([]float64, len(ps))
+	if 0 == m.count {
+		return scores
+	}
+	for i, p := range ps {
+		rank := int64(math.Ceil(p * float64(m.count)))
+		if rank < 1 {
+			rank = 1
+		}
+		var n int64
+		each(func(v float64, k int64) bool {
+			if n += k; n < rank {
+				return true
+			}
+			scores[i] = math.Max(float64(m.min), math.Min(float64(m.max), v))
+			return false
+		})
+	}
+	return scores
+}
+
+// valuesOf returns a value for each value counted, as eachValueOf passes
+// them.
+func (m *moments) valuesOf(each func(func(v float64, n int64) bool)) []int64 {
+	values := make([]int64, 0, m.count)
+	m.eachValueOf(each, func(v, n int64) {
+		for ; n > 0; n-- {
+			values = append(values, v)
+		}
+	})
+	return values
+}
+
+// eachValueOf calls f with the representative value of each bucket each
+// passes, rounded and kept within Min and Max, and its count.
+func (m *moments) eachValueOf(each func(func(v float64, n int64) bool), f func(v, n int64)) {
+	each(func(v float64, n int64) bool {
+		f(int64(math.Max(float64(m.min), math.Min(float64(m.max), math.Round(v)))), n)
+		return true
+	})
+}
@@ -0,0 +1,427 @@
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync/atomic"
+)
+
+// BucketSample counts every value recorded into buckets with fixed upper
+// bounds, as Prometheus and OpenTelemetry explicit-bucket histograms do,
+// rather than keeping a reservoir of values.  Updates are a handful of atomic
+// adds, with no lock, and the counts are exact, so bucket samples with the
+// same bounds merge without loss and export as native histograms: see
+// BucketBounds.  Count, Min, Max, Sum and Mean are exact; percentiles are
+// interpolated within buckets and only as fine as the bounds, and Variance is
+// computed from a running sum of squares.
+//
+// A value is counted in the first bucket whose bound it doesn't exceed, or in
+// the bucket above the last bound.  The fields are updated one after another,
+// so a snapshot taken during an update may see it in some and not others.
+type BucketSample struct {
+	bounds  []float64
+	buckets []uint64 // one per bound, then one above the last
+	sum     int64
+	sumSq   uint64 // float64 bits
+	min     int64
+	max     int64
+}
+
+// NewBucketSample constructs a new bucket sample with the given upper bounds,
+// e.g. LinearBounds or ExponentialBounds, or for a Timer bounds in
+// nanoseconds.  Bounds must be strictly ascending and NewBucketSample panics
+// if they aren't; see ValidateBucketBounds.
+func NewBucketSample(bounds []float64) Sample {
+	if err := ValidateBucketBounds(bounds); nil != err {
+		panic(err)
+	}
+	if useNilMetrics() {
+		return NilSample{}
+	}
+	s := &BucketSample{
+		bounds:  append([]float64(nil), bounds...),
+		buckets: make([]uint64, len(bounds)+1),
+	}
+	s.Clear()
+	return s
+}
+
+// LinearBounds returns n bucket bounds, the first start and each width more
+// than the last.
+func LinearBounds(start, width float64, n int) []float64 {
+	bounds := make([]float64, n)
+	for i := range bounds {
+		bounds[i] = start + float64(i)*width
+	}
+	return bounds
+}
+
+// ExponentialBounds returns n bucket bounds, the first start and each factor
+// times the last.
+func ExponentialBounds(start, factor float64, n int) []float64 {
+	bounds := make([]float64, n)
+	for i := range bounds {
+		bounds[i] = start * math.Pow(factor, float64(i))
+	}
+	return bounds
+}
+
+// Bounds returns the upper bounds of the sample's buckets.
+func (s *BucketSample) Bounds() []float64 { return s.bounds }
+
+// Buckets returns, for each of the given bounds, the number of values recorded
+// which were less than or equal to it: exactly for bounds of the sample's own,
+// and otherwise the count of the buckets wholly at or below the bound.
+func (s *BucketSample) Buckets(bounds []float64) []uint64 {
+	c := s.load()
+	return c.Buckets(bounds)
+}
+
+// Clear clears all samples.  Values recorded while it clears may be partly
+// cleared.
+func (s *BucketSample) Clear() {
+	for i := range s.buckets {
+		atomic.StoreUint64(&s.buckets[i], 0)
+	}
+	atomic.StoreInt64(&s.sum, 0)
+	atomic.StoreUint64(&s.sumSq, 0)
+	atomic.StoreInt64(&s.min, math.MaxInt64)
+	atomic.StoreInt64(&s.max, math.MinInt64)
+}
+
+// Count returns the number of samples recorded.
+func (s *BucketSample) Count() int64 {
+	var n uint64
+	for i := range s.buckets {
+		n += atomic.LoadUint64(&s.buckets[i])
+	}
+	return int64(n)
+}
+
+// Max returns the maximum value recorded.
+func (s *BucketSample) Max() int64 {
+	c := s.load()
+	return c.Max()
+}
+
+// Mean returns the mean of the values recorded.
+func (s *BucketSample) Mean() float64 {
+	c := s.load()
+	return c.Mean()
+}
+
+// Merge adds the values counted by other, which must be a BucketSample or a
+// snapshot of one with the same bounds, to the sample.
+func (s *BucketSample) Merge(other Sample) error {
+	var c bucketCounts
+	switch o := other.(type) {
+	case *BucketSample:
+		c = o.load()
+	case *BucketSampleSnapshot:
+		c = o.bucketCounts
+	default:
+		return fmt.Errorf("metrics: can't merge a %T into a BucketSample", other)
+	}
+	if !sameBounds(s.bounds, c.bounds) {
+		return fmt.Errorf("metrics: can't merge buckets bounded by %v into a BucketSample bounded by %v", c.bounds, s.bounds)
+	}
+	if 0 == c.count {
+		return nil
+	}
+	for i, n := range c.buckets {
+		atomic.AddUint64(&s.buckets[i], n)
+	}
+	atomic.AddInt64(&s.sum, c.sum)
+	addFloat64(&s.sumSq, c.sumSq)
+	updateIfMin(&s.min, c.min)
+	updateIfMax(&s.max, c.max)
+	return nil
+}
+
+// Min returns the minimum value recorded.
+func (s *BucketSample) Min() int64 {
+	c := s.load()
+	return c.Min()
+}
+
+// Percentile returns an arbitrary percentile of the values recorded.
+func (s *BucketSample) Percentile(p float64) float64 {
+	c := s.load()
+	return c.Percentile(p)
+}
+
+// Percentiles returns a slice of arbitrary percentiles of the values
+// recorded.
+func (s *BucketSample) Percentiles(ps []float64) []float64 {
+	c := s.load()
+	return c.Percentiles(ps)
+}
+
+// Size returns the number of values recorded, all of which are counted.
+func (s *BucketSample) Size() int { return int(s.Count()) }
+
+// Snapshot returns a read-only copy of the sample.
+func (s *BucketSample) Snapshot() Sample {
+	return &BucketSampleSnapshot{bucketCounts: s.load()}
+}
+
+// snapshotAndClear returns a read-only copy of the sample and clears it.  Each
+// value recorded meanwhile is counted in the copy or after it, though its sum
+// may fall on the other side.
+func (s *BucketSample) snapshotAndClear() Sample {
+	c := bucketCounts{bounds: s.bounds, buckets: make([]uint64, len(s.buckets))}
+	for i := range s.buckets {
+		c.buckets[i] = atomic.SwapUint64(&s.buckets[i], 0)
+		c.count += int64(c.buckets[i])
+	}
+	c.sum = atomic.SwapInt64(&s.sum, 0)
+	c.sumSq = math.Float64frombits(atomic.SwapUint64(&s.sumSq, 0))
+	c.min = atomic.SwapInt64(&s.min, math.MaxInt64)
+	c.max = atomic.SwapInt64(&s.max, math.MinInt64)
+	return &BucketSampleSnapshot{bucketCounts: c}
+}
+
+// StdDev returns the standard deviation of the values recorded.
+func (s *BucketSample) StdDev() float64 {
+	c := s.load()
+	return c.StdDev()
+}
+
+// Sum returns the sum of the values recorded, which wraps around should it
+// overflow an int64.
+func (s *BucketSample) Sum() int64 { return atomic.LoadInt64(&s.sum) }
+
+// Update samples a new value.
+func (s *BucketSample) Update(v int64) { s.UpdateN(v, 1) }
+
+// UpdateN records n copies of a value at the cost of one.
+func (s *BucketSample) UpdateN(v, n int64) {
+	if n <= 0 {
+		return
+	}
+	atomic.AddUint64(&s.buckets[sort.SearchFloat64s(s.bounds, float64(v))], uint64(n))
+	atomic.AddInt64(&s.sum, v*n)
+	addFloat64(&s.sumSq, float64(v)*float64(v)*float64(n))
+	updateIfMin(&s.min, v)
+	updateIfMax(&s.max, v)
+}
+
+// Values returns the values recorded, each at its bucket's midpoint, which
+// makes as many of them as Count.  Prefer the other methods, which don't.
+func (s *BucketSample) Values() []int64 {
+	c := s.load()
+	return c.Values()
+}
+
+// Variance returns the variance of the values recorded.
+func (s *BucketSample) Variance() float64 {
+	c := s.load()
+	return c.Variance()
+}
+
+// load copies the sample's counts.
+func (s *BucketSample) load() bucketCounts {
+	c := bucketCounts{bounds: s.bounds, buckets: make([]uint64, len(s.buckets))}
+	for i := range s.buckets {
+		c.buckets[i] = atomic.LoadUint64(&s.buckets[i])
+		c.count += int64(c.buckets[i])
+	}
+	c.sum = atomic.LoadInt64(&s.sum)
+	c.sumSq = math.Float64frombits(atomic.LoadUint64(&s.sumSq))
+	c.min = atomic.LoadInt64(&s.min)
+	c.max = atomic.LoadInt64(&s.max)
+	return c
+}
+
+// BucketSampleSnapshot is a read-only copy of a BucketSample.
+type BucketSampleSnapshot struct {
+	bucketCounts
+}
+
+// Bounds returns the upper bounds of the sample's buckets.
+func (s *BucketSampleSnapshot) Bounds() []float64 { return s.bounds }
+
+// Clear panics.
+func (*BucketSampleSnapshot) Clear() {
+	panic("Clear called on a BucketSampleSnapshot")
+}
+
+// Count returns the number of samples recorded at the time the snapshot was
+// taken.
+func (s *BucketSampleSnapshot) Count() int64 { return s.count }
+
+// Snapshot returns the snapshot.
+func (s *BucketSampleSnapshot) Snapshot() Sample { return s }
+
+// Sum returns the sum of the values recorded at the time the snapshot was
+// taken.
+func (s *BucketSampleSnapshot) Sum() int64 { return s.sum }
+
+// Update panics.
+func (*BucketSampleSnapshot) Update(int64) {
+	panic("Update called on a BucketSampleSnapshot")
+}
+
+// bucketCounts is a copy of the counts of a BucketSample, which
+// BucketSampleSnapshot holds.  The count is the sum of the buckets, so that
+// the two always agree.
+type bucketCounts struct {
+	bounds   []float64
+	buckets  []uint64
+	count    int64
+	sum      int64
+	sumSq    float64
+	min, max int64
+}
+
+func (c *bucketCounts) Buckets(bounds []float64) []uint64 {
+	buckets := make([]uint64, len(bounds))
+	var n uint64
+	j := 0
+	for i, bound := range bounds {
+		for ; j < len(c.bounds) && c.bounds[j] <= bound; j++ {
+			n += c.buckets[j]
+		}
+		if math.IsInf(bound, 1) {
+			buckets[i] = uint64(c.count)
+		} else {
+			buckets[i] = n
+		}
+	}
+	return buckets
+}
+
+func (c *bucketCounts) Max() int64 {
+	if 0 == c.count {
+		return 0
+	}
+	return c.max
+}
+
+func (c *bucketCounts) Mean() float64 {
+	if 0 == c.count {
+		return 0.0
+	}
+	return float64(c.sum) / float64(c.count)
+}
+
+func (c *bucketCounts) Min() int64 {
+	if 0 == c.count {
+		return 0
+	}
+	return c.min
+}
+
+func (c *bucketCounts) Percentile(p float64) float64 {
+	return c.Percentiles([]float64{p})[0]
+}
+
+// Percentiles interpolates linearly within the bucket holding each rank,
+// between its bounds narrowed to Min and Max.
+func (c *bucketCounts) Percentiles(ps []float64) []float64 {
+	scores := make([]float64, len(ps))
+	if 0 == c.count {
+		return scores
+	}
+	for i, p := range ps {
+		rank := p * float64(c.count)
+		var below uint64
+		for j, n := range c.buckets {
+			if 0 == n || float64(below+n) < rank {
+				below += n
+				continue
+			}
+			lo, hi := c.bucketRange(j)
+			scores[i] = lo + (hi-lo)*math.Max(0, rank-float64(below))/float64(n)
+			break
+		}
+	}
+	return scores
+}
+
+func (c *bucketCounts) Size() int { return int(c.count) }
+
+func (c *bucketCounts) StdDev() float64 { return math.Sqrt(c.Variance()) }
+
+func (c *bucketCounts) Values() []int64 {
+	values := make([]int64, 0, c.count)
+	for j, n := range c.buckets {
+		lo, hi := c.bucketRange(j)
+		v := int64(lo + (hi-lo)/2)
+		for ; n > 0; n-- {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+func (c *bucketCounts) Variance() float64 {
+	if 0 == c.count {
+		return 0.0
+	}
+	mean := c.Mean()
+	return math.Max(0, c.sumSq/float64(c.count)-mean*mean)
+}
+
+// bucketRange returns the range of the values counted in buckets[j], its
+// bounds narrowed to Min and Max.
+func (c *bucketCounts) bucketRange(j int) (lo, hi float64) {
+	lo, hi = float64(c.min), float64(c.max)
+	if j > 0 && c.bounds[j-1] > lo {
+		lo = c.bounds[j-1]
+	}
+	if j < len(c.bounds) && c.bounds[j] < hi {
+		hi = c.bounds[j]
+	}
+	return lo, hi
+}
+
+// BucketBounds returns the bucket bounds of a histogram or timer, or a
+// snapshot of one, whose sample is a BucketSample, or nil if it has none.
+// Exporters of native histograms export those buckets, whose counts are
+// exact, rather than estimating buckets of their own from the sample.
+// Timers' bounds are in nanoseconds.
+func BucketBounds(i interface{}) []float64 {
+	if b, ok := sampleOf(i).(interface{ Bounds() []float64 }); ok {
+		return b.Bounds()
+	}
+	return nil
+}
+
+// sampleOf returns the sample of a histogram or timer, or a snapshot of one,
+// or nil if it's neither.
+func sampleOf(i interface{}) Sample {
+	switch m := i.(type) {
+	case *TimerSnapshot:
+		return m.histogram.Sample()
+	case *StandardTimer:
+		return m.histogram.Sample()
+	case Histogram:
+		return m.Sample()
+	}
+	return nil
+}
+
+// sameBounds returns true if a and b are the same bucket bounds.
+func sameBounds(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// addFloat64 atomically adds v to the float64 whose bits are at addr.
+func addFloat64(addr *uint64, v float64) {
+	for {
+		old := atomic.LoadUint64(addr)
+		if atomic.CompareAndSwapUint64(addr, old, math.Float64bits(math.Float64frombits(old)+v)) {
+			return
+		}
+	}
+}
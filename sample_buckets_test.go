@@ -0,0 +1,119 @@
+package metrics
+
+import (
+	"math"
+	"sync"
+	"testing"
+)
+
+func TestBucketSample(t *testing.T) {
+	s := NewBucketSample([]float64{10, 20, 30})
+	for _, v := range []int64{5, 10, 15, 25, 40} {
+		s.Update(v)
+	}
+	if count := s.Count(); 5 != count {
+		t.Errorf("s.Count(): 5 != %v\n", count)
+	}
+	if min, max := s.Min(), s.Max(); 5 != min || 40 != max {
+		t.Errorf("s.Min(), s.Max(): 5, 40 != %v, %v\n", min, max)
+	}
+	if sum, mean := s.Sum(), s.Mean(); 95 != sum || 19 != mean {
+		t.Errorf("s.Sum(), s.Mean(): 95, 19 != %v, %v\n", sum, mean)
+	}
+	if v := s.Variance(); math.Abs(154-v) > 1e-9 {
+		t.Errorf("s.Variance(): 154 != %v\n", v)
+	}
+	if b := s.(*BucketSample).Buckets([]float64{10, 20, 25, 30, math.Inf(1)}); 2 != b[0] || 3 != b[1] || 3 != b[2] || 4 != b[3] || 5 != b[4] {
+		t.Errorf("s.Buckets(): [2 3 3 4 5] != %v\n", b)
+	}
+	ps := s.Percentiles([]float64{0, 0.5, 1})
+	if 5 != ps[0] || 15 != ps[1] || 40 != ps[2] {
+		t.Errorf("s.Percentiles(): [5 15 40] != %v\n", ps)
+	}
+	if values := s.Values(); 5 != len(values) {
+		t.Errorf("s.Values(): %v\n", values)
+	}
+	snapshot := s.Snapshot()
+	s.Update(1)
+	if count := snapshot.Count(); 5 != count {
+		t.Errorf("snapshot.Count(): 5 != %v\n", count)
+	}
+	s.Clear()
+	if count, max := s.Count(), s.Max(); 0 != count || 0 != max {
+		t.Errorf("cleared: %v, %v\n", count, max)
+	}
+}
+
+func TestBucketSampleUpdateN(t *testing.T) {
+	s := NewBucketSample([]float64{10})
+	s.(*BucketSample).UpdateN(20, 3)
+	if count, sum := s.Count(), s.Sum(); 3 != count || 60 != sum {
+		t.Errorf("count, sum: 3, 60 != %v, %v\n", count, sum)
+	}
+}
+
+func TestBucketSampleMerge(t *testing.T) {
+	a, b := NewBucketSample([]float64{10, 20}).(*BucketSample), NewBucketSample([]float64{10, 20})
+	a.Update(5)
+	b.Update(15)
+	b.Update(25)
+	if err := a.Merge(b.Snapshot()); nil != err {
+		t.Fatal(err)
+	}
+	if count, min, max := a.Count(), a.Min(), a.Max(); 3 != count || 5 != min || 25 != max {
+		t.Errorf("merged: %v, %v, %v\n", count, min, max)
+	}
+	if err := a.Merge(NewBucketSample([]float64{10})); nil == err {
+		t.Error("Merge(): want an error for other bounds\n")
+	}
+	if err := a.Merge(NewUniformSample(10)); nil == err {
+		t.Error("Merge(): want an error for a UniformSample\n")
+	}
+}
+
+func TestBucketSampleConcurrent(t *testing.T) {
+	s := NewBucketSample(ExponentialBounds(1, 2, 10))
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for v := int64(0); v < 1000; v++ {
+				s.Update(v)
+			}
+		}()
+	}
+	wg.Wait()
+	if count, sum := s.Count(), s.Sum(); 4000 != count || 4*999*1000/2 != sum {
+		t.Errorf("count, sum: %v, %v\n", count, sum)
+	}
+}
+
+func TestBucketSampleSnapshotAndReset(t *testing.T) {
+	r := NewRegistry()
+	h := NewRegisteredHistogram("h", r, NewBucketSample([]float64{10}))
+	h.Update(5)
+	h.Update(50)
+	s := r.SnapshotAndReset().Get("h").(Histogram)
+	if count := s.Count(); 2 != count {
+		t.Errorf("snapshot count: 2 != %v\n", count)
+	}
+	if count := h.Count(); 0 != count {
+		t.Errorf("h.Count() after reset: 0 != %v\n", count)
+	}
+	if b := BucketBounds(s); 1 != len(b) || 10 != b[0] {
+		t.Errorf("BucketBounds(): [10] != %v\n", b)
+	}
+	if b := BucketBounds(NewHistogram(NewUniformSample(10))); nil != b {
+		t.Errorf("BucketBounds(): %v, want nil\n", b)
+	}
+}
+
+func TestBounds(t *testing.T) {
+	if b := LinearBounds(1, 2, 3); 1 != b[0] || 3 != b[1] || 5 != b[2] {
+		t.Errorf("LinearBounds(): %v\n", b)
+	}
+	if b := ExponentialBounds(1, 10, 3); 1 != b[0] || 10 != b[1] || 100 != b[2] {
+		t.Errorf("ExponentialBounds(): %v\n", b)
+	}
+}
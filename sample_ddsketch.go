@@ -0,0 +1,499 @@
+package metrics
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+)
+
+// ErrInvalidSketch is returned when decoding bytes which aren't a sketch
+// encoded by MarshalBinary.
+var ErrInvalidSketch = errors.New("metrics: invalid sketch")
+
+// DDSketchSample counts every value recorded into buckets whose bounds grow
+// geometrically, in the manner of Datadog's DDSketch, so that every
+// percentile is within a fixed relative error of the true one whatever the
+// distribution.  Each value costs a logarithm and an increment as it's
+// recorded, and percentiles are read from the counts without sorting
+// anything.  Unlike a reservoir, two sketches of the same accuracy merge
+// exactly: the merged sketch is the one that would have counted both streams,
+// which is what makes percentiles across processes possible.  Count, Min, Max,
+// Sum, Mean and Variance are exact.
+//
+// <https://arxiv.org/abs/1908.10693>
+//
+// Its memory grows with the logarithm of the ratio of the largest value to
+// the smallest, not with the number of values: at 1% accuracy, nanoseconds
+// from a microsecond to an hour take about 1100 buckets of eight bytes.
+type DDSketchSample struct {
+	mutex sync.Mutex
+	ddSketch
+}
+
+// NewDDSketchSample constructs a new DDSketch sample whose percentiles are
+// within the given relative accuracy, e.g. 0.01 for 1%, which is clamped to
+// between 0.0001 and 0.5.
+func NewDDSketchSample(relativeAccuracy float64) Sample {
+	if useNilMetrics() {
+		return NilSample{}
+	}
+	return &DDSketchSample{ddSketch: newDDSketch(relativeAccuracy)}
+}
+
+// Buckets returns, for each of the given bounds, the number of values recorded
+// which were less than or equal to it, to within the sample's accuracy.
+func (s *DDSketchSample) Buckets(bounds []float64) []uint64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.ddSketch.Buckets(bounds)
+}
+
+// Clear clears all samples.
+func (s *DDSketchSample) Clear() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.clear()
+}
+
+// Count returns the number of samples recorded.
+func (s *DDSketchSample) Count() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.count
+}
+
+// MarshalBinary encodes the sample, for UnmarshalDDSketchSample to decode,
+// e.g. in another process merging it into its own.
+func (s *DDSketchSample) MarshalBinary() ([]byte, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.ddSketch.MarshalBinary()
+}
+
+// Max returns the maximum value recorded.
+func (s *DDSketchSample) Max() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.ddSketch.Max()
+}
+
+// Mean returns the mean of the values recorded.
+func (s *DDSketchSample) Mean() float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.ddSketch.Mean()
+}
+
+// Merge adds the values counted by other, which must be a DDSketchSample or
+// a snapshot of one of the same accuracy, to the sample.
+func (s *DDSketchSample) Merge(other Sample) error {
+	o, ok := other.(sketchSample)
+	if !ok {
+		return fmt.Errorf("metrics: can't merge a %T into a DDSketchSample", other)
+	}
+	// Copy first, so that a sample can be merged into itself.
+	c := o.sketch()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.merge(&c)
+}
+
+// Min returns the minimum value recorded.
+func (s *DDSketchSample) Min() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.ddSketch.Min()
+}
+
+// Percentile returns an arbitrary percentile of the values recorded.
+func (s *DDSketchSample) Percentile(p float64) float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.ddSketch.Percentile(p)
+}
+
+// Percentiles returns a slice of arbitrary percentiles of the values
+// recorded.
+func (s *DDSketchSample) Percentiles(ps []float64) []float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.ddSketch.Percentiles(ps)
+}
+
+// RelativeAccuracy returns the relative accuracy of the sample's percentiles.
+func (s *DDSketchSample) RelativeAccuracy() float64 { return s.alpha }
+
+// Size returns the number of values recorded, all of which are counted.
+func (s *DDSketchSample) Size() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.ddSketch.Size()
+}
+
+// Snapshot returns a read-only copy of the sample.
+func (s *DDSketchSample) Snapshot() Sample {
+	return &DDSketchSampleSnapshot{ddSketch: s.sketch()}
+}
+
+// snapshotAndClear returns a read-only copy of the sample and clears it
+// without letting any update in between.
+func (s *DDSketchSample) snapshotAndClear() Sample {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	snapshot := &DDSketchSampleSnapshot{ddSketch: s.copy()}
+	s.clear()
+	return snapshot
+}
+
+// StdDev returns the standard deviation of the values recorded.
+func (s *DDSketchSample) StdDev() float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.ddSketch.StdDev()
+}
+
+// Sum returns the sum of the values recorded.
+func (s *DDSketchSample) Sum() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.ddSketch.Sum()
+}
+
+// SumOverflowed returns true if the sum of the values recorded doesn't fit in
+// an int64, in which case Sum is saturated.
+func (s *DDSketchSample) SumOverflowed() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.sum.overflowed()
+}
+
+// Update samples a new value.
+func (s *DDSketchSample) Update(v int64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.updateN(v, 1)
+}
+
+// UpdateN records n copies of a value at the cost of one.
+func (s *DDSketchSample) UpdateN(v, n int64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.updateN(v, n)
+}
+
+// Values returns the values recorded, each at its bucket's representative
+// value, which makes as many of them as Count.  Prefer the other methods,
+// which don't.
+func (s *DDSketchSample) Values() []int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.ddSketch.Values()
+}
+
+// Variance returns the variance of the values recorded.
+func (s *DDSketchSample) Variance() float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.ddSketch.Variance()
+}
+
+func (s *DDSketchSample) sketch() ddSketch {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.copy()
+}
+
+// DDSketchSampleSnapshot is a read-only copy of a DDSketchSample.
+type DDSketchSampleSnapshot struct {
+	ddSketch
+}
+
+// UnmarshalDDSketchSample decodes a sample encoded by the MarshalBinary method
+// of a DDSketchSample or its snapshot into a read-only snapshot, which may be
+// merged into a DDSketchSample of the same accuracy.
+func UnmarshalDDSketchSample(data []byte) (*DDSketchSampleSnapshot, error) {
+	s := &DDSketchSampleSnapshot{}
+	if err := s.unmarshalBinary(data); nil != err {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Clear panics.
+func (*DDSketchSampleSnapshot) Clear() {
+	panic("Clear called on a DDSketchSampleSnapshot")
+}
+
+// Count returns the number of samples recorded at the time the snapshot was
+// taken.
+func (s *DDSketchSampleSnapshot) Count() int64 { return s.count }
+
+// RelativeAccuracy returns the relative accuracy of the snapshot's
+// percentiles.
+func (s *DDSketchSampleSnapshot) RelativeAccuracy() float64 { return s.alpha }
+
+// Snapshot returns the snapshot.
+func (s *DDSketchSampleSnapshot) Snapshot() Sample { return s }
+
+// SumOverflowed returns true if the sum of the values recorded doesn't fit in
+// an int64, in which case Sum is saturated.
+func (s *DDSketchSampleSnapshot) SumOverflowed() bool { return s.sum.overflowed() }
+
+// Update panics.
+func (*DDSketchSampleSnapshot) Update(int64) {
+	panic("Update called on a DDSketchSampleSnapshot")
+}
+
+func (s *DDSketchSampleSnapshot) sketch() ddSketch { return s.copy() }
+
+// sketchSample is implemented by DDSketchSample and its snapshot, returning a
+// copy of the sketch to merge.
+type sketchSample interface {
+	sketch() ddSketch
+}
+
+// ddSketch is the state of a DDSketchSample, which DDSketchSample guards with
+// its mutex and DDSketchSampleSnapshot copies.
+//
+// A value v other than zero is counted by its magnitude in the bucket
+// ceil(log(|v|)/log(gamma)), which covers magnitudes in (gamma^(i-1),
+// gamma^i], where gamma = (1+alpha)/(1-alpha), in positive or negative as v
+// is.  Every magnitude in a bucket is within alpha of 2*gamma^i/(gamma+1),
+// which the bucket's values are all taken to be.
+type ddSketch struct {
+	alpha, logGamma    float64
+	positive, negative ddStore
+	zero               int64
+	moments
+}
+
+func newDDSketch(alpha float64) ddSketch {
+	if !(alpha >= 0.0001) {
+		alpha = 0.0001
+	} else if alpha > 0.5 {
+		alpha = 0.5
+	}
+	c := ddSketch{
+		alpha:    alpha,
+		logGamma: math.Log((1 + alpha) / (1 - alpha)),
+	}
+	c.clear()
+	return c
+}
+
+// Buckets returns, for each of the given bounds, the number of values recorded
+// whose bucket's representative value is less than or equal to it.
+func (c *ddSketch) Buckets(bounds []float64) []uint64 {
+	return bucketsOf(c.each, bounds)
+}
+
+func (c *ddSketch) Percentile(p float64) float64 {
+	return c.Percentiles([]float64{p})[0]
+}
+
+// Percentiles returns the representative value of the bucket holding the
+// value at each rank, that is the smallest such that the given fraction of
+// values are less than or equal to it, but never beyond Min or Max.
+func (c *ddSketch) Percentiles(ps []float64) []float64 {
+	return c.percentilesOf(c.each, ps)
+}
+
+func (c *ddSketch) Values() []int64 { return c.valuesOf(c.each) }
+
+func (c *ddSketch) clear() {
+	c.positive, c.negative = ddStore{}, ddStore{}
+	c.zero = 0
+	c.moments.clear()
+}
+
+func (c *ddSketch) copy() ddSketch {
+	copied := *c
+	copied.positive = c.positive.copy()
+	copied.negative = c.negative.copy()
+	return copied
+}
+
+// each calls f with the representative value and count of each bucket holding
+// any values, in increasing order of value, until f returns false.
+func (c *ddSketch) each(f func(v float64, n int64) bool) {
+	for i := len(c.negative.counts) - 1; i >= 0; i-- {
+		if n := c.negative.counts[i]; 0 != n && !f(-c.value(c.negative.offset+i), n) {
+			return
+		}
+	}
+	if 0 != c.zero && !f(0, c.zero) {
+		return
+	}
+	for i, n := range c.positive.counts {
+		if 0 != n && !f(c.value(c.positive.offset+i), n) {
+			return
+		}
+	}
+}
+
+// index returns the index of the bucket counting the magnitude m, which is at
+// least one.
+func (c *ddSketch) index(m float64) int {
+	return int(math.Ceil(math.Log(m) / c.logGamma))
+}
+
+// merge adds the values counted by other to c.
+func (c *ddSketch) merge(other *ddSketch) error {
+	if other.alpha != c.alpha {
+		return fmt.Errorf("metrics: can't merge a sketch of relative accuracy %v into one of %v", other.alpha, c.alpha)
+	}
+	if 0 == other.count {
+		return nil
+	}
+	c.positive.merge(&other.positive)
+	c.negative.merge(&other.negative)
+	c.zero += other.zero
+	c.moments.merge(&other.moments)
+	return nil
+}
+
+// updateN records n copies of v.
+func (c *ddSketch) updateN(v, n int64) {
+	if n <= 0 {
+		return
+	}
+	c.moments.updateN(v, n)
+	switch {
+	case v > 0:
+		c.positive.add(c.index(float64(v)), n)
+	case v < 0:
+		c.negative.add(c.index(-float64(v)), n)
+	default:
+		c.zero += n
+	}
+}
+
+// value returns the representative magnitude of bucket i.
+func (c *ddSketch) value(i int) float64 {
+	gamma := math.Exp(c.logGamma)
+	return 2 * math.Exp(float64(i)*c.logGamma) / (gamma + 1)
+}
+
+// ddSketchVersion is the first byte of an encoded sketch.
+const ddSketchVersion = 1
+
+// MarshalBinary encodes the sketch as its version, relative accuracy and
+// statistics, followed by the counts of zero and of each store.
+func (c *ddSketch) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 0, 64+binary.MaxVarintLen64*(len(c.positive.counts)+len(c.negative.counts)))
+	b = append(b, ddSketchVersion)
+	for _, u := range []uint64{
+		math.Float64bits(c.alpha),
+		math.Float64bits(c.mean),
+		math.Float64bits(c.m2),
+		uint64(c.sum.hi),
+		c.sum.lo,
+	} {
+		b = appendUint64(b, u)
+	}
+	for _, v := range []int64{c.count, c.min, c.max, c.zero} {
+		b = appendVarint(b, v)
+	}
+	b = c.positive.appendTo(b)
+	b = c.negative.appendTo(b)
+	return b, nil
+}
+
+func (c *ddSketch) unmarshalBinary(data []byte) error {
+	if 0 == len(data) || ddSketchVersion != data[0] {
+		return ErrInvalidSketch
+	}
+	d := binaryDecoder{data: data[1:]}
+	alpha := math.Float64frombits(d.uint64())
+	if !(alpha >= 0.0001 && alpha <= 0.5) {
+		return ErrInvalidSketch
+	}
+	*c = newDDSketch(alpha)
+	c.mean = math.Float64frombits(d.uint64())
+	c.m2 = math.Float64frombits(d.uint64())
+	c.sum.hi, c.sum.lo = int64(d.uint64()), d.uint64()
+	c.count, c.min, c.max, c.zero = d.varint(), d.varint(), d.varint(), d.varint()
+	c.positive = d.ddStore()
+	c.negative = d.ddStore()
+	if d.failed || 0 != len(d.data) {
+		return ErrInvalidSketch
+	}
+	if c.zero+c.positive.total()+c.negative.total() != c.count {
+		return ErrInvalidSketch
+	}
+	return nil
+}
+
+// ddStore holds the counts of consecutive buckets from offset on, growing to
+// cover each bucket counted.
+type ddStore struct {
+	offset int
+	counts []int64
+}
+
+func (s *ddStore) add(i int, n int64) {
+	switch {
+	case 0 == len(s.counts):
+		s.offset = i
+		s.counts = append(s.counts, n)
+		return
+	case i < s.offset:
+		grown := make([]int64, s.offset-i+len(s.counts))
+		copy(grown[s.offset-i:], s.counts)
+		s.offset, s.counts = i, grown
+	case i >= s.offset+len(s.counts):
+		s.counts = append(s.counts, make([]int64, i-s.offset-len(s.counts)+1)...)
+	}
+	s.counts[i-s.offset] += n
+}
+
+func (s *ddStore) appendTo(b []byte) []byte {
+	b = appendVarint(b, int64(s.offset))
+	b = appendVarint(b, int64(len(s.counts)))
+	for _, n := range s.counts {
+		b = appendVarint(b, n)
+	}
+	return b
+}
+
+func (s *ddStore) copy() ddStore {
+	copied := ddStore{offset: s.offset}
+	if 0 != len(s.counts) {
+		copied.counts = make([]int64, len(s.counts))
+		copy(copied.counts, s.counts)
+	}
+	return copied
+}
+
+func (s *ddStore) merge(other *ddStore) {
+	for i, n := range other.counts {
+		if 0 != n {
+			s.add(other.offset+i, n)
+		}
+	}
+}
+
+func (s *ddStore) total() int64 {
+	var n int64
+	for _, k := range s.counts {
+		n += k
+	}
+	return n
+}
+
+// ddStore reads a store appended by ddStore.appendTo.
+func (d *binaryDecoder) ddStore() ddStore {
+	s := ddStore{offset: int(d.varint())}
+	n := d.length()
+	if 0 != n {
+		s.counts = make([]int64, n)
+		for i := range s.counts {
+			if s.counts[i] = d.varint(); s.counts[i] < 0 {
+				d.failed = true
+			}
+		}
+	}
+	return s
+}
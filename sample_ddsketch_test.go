@@ -0,0 +1,123 @@
+package metrics
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func BenchmarkDDSketchSample(b *testing.B) {
+	benchmarkSample(b, NewDDSketchSample(0.01))
+}
+
+func TestDDSketchSample(t *testing.T) {
+	s := NewDDSketchSample(0.01)
+	for i := -1000; i <= 100000; i++ {
+		s.Update(int64(i))
+	}
+	if count := s.Count(); 101001 != count {
+		t.Errorf("s.Count(): 101001 != %v\n", count)
+	}
+	if min := s.Min(); -1000 != min {
+		t.Errorf("s.Min(): -1000 != %v\n", min)
+	}
+	if max := s.Max(); 100000 != max {
+		t.Errorf("s.Max(): 100000 != %v\n", max)
+	}
+	if sum := s.Sum(); 5000050000-500500 != sum {
+		t.Errorf("s.Sum(): %v != %v\n", 5000050000-500500, sum)
+	}
+	ps := []float64{0.005, 0.5, 0.99, 0.999, 1}
+	for i, p := range s.Percentiles(ps) {
+		want := math.Ceil(ps[i]*101001) - 1001
+		if math.Abs(p-want) > math.Abs(want)/100+1 {
+			t.Errorf("percentile %v: %v isn't within 1%% of %v\n", ps[i], p, want)
+		}
+	}
+	if buckets := s.(*DDSketchSample).Buckets([]float64{-0.5, 0, 1000}); 1000 != buckets[0] || 1001 != buckets[1] || buckets[2] < 1990 || buckets[2] > 2010 {
+		t.Errorf("s.Buckets(): %v\n", buckets)
+	}
+}
+
+func TestDDSketchSampleMerge(t *testing.T) {
+	a, b, all := NewDDSketchSample(0.01), NewDDSketchSample(0.01), NewDDSketchSample(0.01)
+	for i := int64(1); i <= 10000; i++ {
+		a.Update(i * int64(time.Microsecond))
+		all.Update(i * int64(time.Microsecond))
+	}
+	for i := int64(1); i <= 100; i++ {
+		b.Update(i * int64(time.Second))
+		all.Update(i * int64(time.Second))
+	}
+	if err := a.(*DDSketchSample).Merge(b.Snapshot()); nil != err {
+		t.Fatal(err)
+	}
+	if a.Count() != all.Count() || a.Min() != all.Min() || a.Max() != all.Max() || a.Sum() != all.Sum() {
+		t.Errorf("merged: %v %v %v %v\n", a.Count(), a.Min(), a.Max(), a.Sum())
+	}
+	if math.Abs(a.Mean()-all.Mean()) > 1e-6*all.Mean() || math.Abs(a.Variance()-all.Variance()) > 1e-6*all.Variance() {
+		t.Errorf("merged: mean %v != %v or variance %v != %v\n", a.Mean(), all.Mean(), a.Variance(), all.Variance())
+	}
+	ps := []float64{0.5, 0.99, 0.999}
+	want := all.Percentiles(ps)
+	for i, p := range a.Percentiles(ps) {
+		if want[i] != p {
+			t.Errorf("percentile %v: %v != %v\n", ps[i], want[i], p)
+		}
+	}
+	if err := a.(*DDSketchSample).Merge(a); nil != err || 2*all.Count() != a.Count() {
+		t.Errorf("merging into itself: %v, %v\n", err, a.Count())
+	}
+	if err := a.(*DDSketchSample).Merge(NewDDSketchSample(0.02)); nil == err {
+		t.Error("merging a sketch of another accuracy didn't fail")
+	}
+	if err := a.(*DDSketchSample).Merge(NewUniformSample(10)); nil == err {
+		t.Error("merging a UniformSample didn't fail")
+	}
+}
+
+func TestDDSketchSampleMarshalBinary(t *testing.T) {
+	s := NewDDSketchSample(0.02)
+	for _, v := range []int64{-5, 0, 0, 7, 1000, 1000, math.MaxInt64} {
+		s.Update(v)
+	}
+	b, err := s.(*DDSketchSample).MarshalBinary()
+	if nil != err {
+		t.Fatal(err)
+	}
+	decoded, err := UnmarshalDDSketchSample(b)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 0.02 != decoded.RelativeAccuracy() || s.Count() != decoded.Count() || s.Sum() != decoded.Sum() || !decoded.SumOverflowed() ||
+		s.Min() != decoded.Min() || s.Max() != decoded.Max() || s.Mean() != decoded.Mean() || s.Variance() != decoded.Variance() {
+		t.Errorf("decoded: %+v\n", decoded)
+	}
+	ps := []float64{0, 0.25, 0.5, 0.75, 1}
+	want := s.Percentiles(ps)
+	for i, p := range decoded.Percentiles(ps) {
+		if want[i] != p {
+			t.Errorf("percentile %v: %v != %v\n", ps[i], want[i], p)
+		}
+	}
+	for i := range b {
+		if _, err := UnmarshalDDSketchSample(b[:i]); nil == err {
+			t.Errorf("UnmarshalDDSketchSample(b[:%d]) didn't fail\n", i)
+		}
+	}
+	if _, err := UnmarshalDDSketchSample(append(b, 0)); ErrInvalidSketch != err {
+		t.Errorf("UnmarshalDDSketchSample with a trailing byte: %v\n", err)
+	}
+}
+
+func TestDDSketchSampleSnapshotAndClear(t *testing.T) {
+	s := NewDDSketchSample(0.01)
+	sampleUpdateN(s, 42, 10)
+	snapshot := s.(clearingSample).snapshotAndClear()
+	if 10 != snapshot.Count() || 420 != snapshot.Sum() || 0 != s.Count() {
+		t.Errorf("snapshot: %v %v; s.Count(): %v\n", snapshot.Count(), snapshot.Sum(), s.Count())
+	}
+	if v := snapshot.Values(); 10 != len(v) || 42 != v[0] {
+		t.Errorf("snapshot.Values(): %v\n", v)
+	}
+}
@@ -0,0 +1,512 @@
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"sync"
+)
+
+const (
+	// ExponentialMaxScale is the scale at which an ExponentialSample starts,
+	// the finest OpenTelemetry allows: bucket bounds grow by a factor of
+	// 2^(2^-20), so that every percentile is within about 0.00003% of the
+	// true one until values span too wide a range for the sample's buckets.
+	ExponentialMaxScale = 20
+
+	// ExponentialMinScale is the coarsest scale an ExponentialSample goes
+	// down to, at which one bucket covers every int64.
+	ExponentialMinScale = -10
+
+	// DefaultExponentialMaxSize is the number of buckets an ExponentialSample
+	// keeps for each sign unless told otherwise, the OpenTelemetry SDK's
+	// default.
+	DefaultExponentialMaxSize = 160
+)
+
+// ExponentialSample counts every value recorded into buckets whose bounds are
+// powers of 2^(2^-scale), as OpenTelemetry's exponential histogram does, so
+// that exporters such as the otel package's can export it natively rather
+// than as percentiles.  It starts at ExponentialMaxScale and lowers the
+// scale, merging neighbouring buckets in pairs, whenever the values recorded
+// span more buckets than it keeps, so its accuracy adapts to the range of
+// values without being configured.  Two samples merge exactly, at the coarser
+// of their scales.  Count, Min, Max, Sum, Mean and Variance are exact.
+//
+// With the default 160 buckets, nanoseconds from a microsecond to a minute are
+// counted at scale 2, each bucket 19% wider than the one before.
+type ExponentialSample struct {
+	mutex sync.Mutex
+	expHistogram
+}
+
+// NewExponentialSample constructs a new exponential sample keeping up to
+// maxSize buckets each for positive and negative values, or
+// DefaultExponentialMaxSize if maxSize isn't positive.
+func NewExponentialSample(maxSize int) Sample {
+	if useNilMetrics() {
+		return NilSample{}
+	}
+	return &ExponentialSample{expHistogram: newExpHistogram(maxSize)}
+}
+
+// Buckets returns, for each of the given bounds, the number of values recorded
+// which were less than or equal to it, to within the sample's accuracy.
+func (s *ExponentialSample) Buckets(bounds []float64) []uint64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.expHistogram.Buckets(bounds)
+}
+
+// Clear clears all samples, and returns the scale to ExponentialMaxScale.
+func (s *ExponentialSample) Clear() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.clear()
+}
+
+// Count returns the number of samples recorded.
+func (s *ExponentialSample) Count() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.count
+}
+
+// ExponentialBuckets returns the sample's scale and bucket counts.
+func (s *ExponentialSample) ExponentialBuckets() ExponentialBuckets {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.expHistogram.ExponentialBuckets()
+}
+
+// Max returns the maximum value recorded.
+func (s *ExponentialSample) Max() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.expHistogram.Max()
+}
+
+// Mean returns the mean of the values recorded.
+func (s *ExponentialSample) Mean() float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.expHistogram.Mean()
+}
+
+// Merge adds the values counted by other, which must be an ExponentialSample
+// or a snapshot of one, to the sample, lowering its scale to other's if
+// other's is coarser, and further if need be to fit both ranges of values.
+func (s *ExponentialSample) Merge(other Sample) error {
+	o, ok := other.(exponentialSample)
+	if !ok {
+		return fmt.Errorf("metrics: can't merge a %T into an ExponentialSample", other)
+	}
+	// Copy first, so that a sample can be merged into itself.
+	c := o.exponential()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.merge(&c)
+	return nil
+}
+
+// Min returns the minimum value recorded.
+func (s *ExponentialSample) Min() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.expHistogram.Min()
+}
+
+// Percentile returns an arbitrary percentile of the values recorded.
+func (s *ExponentialSample) Percentile(p float64) float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.expHistogram.Percentile(p)
+}
+
+// Percentiles returns a slice of arbitrary percentiles of the values
+// recorded.
+func (s *ExponentialSample) Percentiles(ps []float64) []float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.expHistogram.Percentiles(ps)
+}
+
+// Scale returns the sample's current scale.
+func (s *ExponentialSample) Scale() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.scale
+}
+
+// Size returns the number of values recorded, all of which are counted.
+func (s *ExponentialSample) Size() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.expHistogram.Size()
+}
+
+// Snapshot returns a read-only copy of the sample.
+func (s *ExponentialSample) Snapshot() Sample {
+	return &ExponentialSampleSnapshot{expHistogram: s.exponential()}
+}
+
+// snapshotAndClear returns a read-only copy of the sample and clears it
+// without letting any update in between.
+func (s *ExponentialSample) snapshotAndClear() Sample {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	snapshot := &ExponentialSampleSnapshot{expHistogram: s.copy()}
+	s.clear()
+	return snapshot
+}
+
+// StdDev returns the standard deviation of the values recorded.
+func (s *ExponentialSample) StdDev() float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.expHistogram.StdDev()
+}
+
+// Sum returns the sum of the values recorded.
+func (s *ExponentialSample) Sum() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.expHistogram.Sum()
+}
+
+// SumOverflowed returns true if the sum of the values recorded doesn't fit in
+// an int64, in which case Sum is saturated.
+func (s *ExponentialSample) SumOverflowed() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.sum.overflowed()
+}
+
+// Update samples a new value.
+func (s *ExponentialSample) Update(v int64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.updateN(v, 1)
+}
+
+// UpdateN records n copies of a value at the cost of one.
+func (s *ExponentialSample) UpdateN(v, n int64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.updateN(v, n)
+}
+
+// Values returns the values recorded, each at its bucket's representative
+// value, which makes as many of them as Count.  Prefer the other methods,
+// which don't.
+func (s *ExponentialSample) Values() []int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.expHistogram.Values()
+}
+
+// Variance returns the variance of the values recorded.
+func (s *ExponentialSample) Variance() float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.expHistogram.Variance()
+}
+
+func (s *ExponentialSample) exponential() expHistogram {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.copy()
+}
+
+// ExponentialSampleSnapshot is a read-only copy of an ExponentialSample.
+type ExponentialSampleSnapshot struct {
+	expHistogram
+}
+
+// Clear panics.
+func (*ExponentialSampleSnapshot) Clear() {
+	panic("Clear called on an ExponentialSampleSnapshot")
+}
+
+// Count returns the number of samples recorded at the time the snapshot was
+// taken.
+func (s *ExponentialSampleSnapshot) Count() int64 { return s.count }
+
+// Scale returns the scale of the sample at the time the snapshot was taken.
+func (s *ExponentialSampleSnapshot) Scale() int { return s.scale }
+
+// Snapshot returns the snapshot.
+func (s *ExponentialSampleSnapshot) Snapshot() Sample { return s }
+
+// SumOverflowed returns true if the sum of the values recorded doesn't fit in
+// an int64, in which case Sum is saturated.
+func (s *ExponentialSampleSnapshot) SumOverflowed() bool { return s.sum.overflowed() }
+
+// Update panics.
+func (*ExponentialSampleSnapshot) Update(int64) {
+	panic("Update called on an ExponentialSampleSnapshot")
+}
+
+func (s *ExponentialSampleSnapshot) exponential() expHistogram { return s.copy() }
+
+// exponentialSample is implemented by ExponentialSample and its snapshot,
+// returning a copy of the histogram to merge.
+type exponentialSample interface {
+	exponential() expHistogram
+}
+
+// ExponentialBuckets are the buckets of an ExponentialSample in the form of an
+// OpenTelemetry exponential histogram data point.
+type ExponentialBuckets struct {
+	Scale     int                     // The bucket bounds are powers of 2^(2^-Scale)
+	ZeroCount uint64                  // Values which are zero
+	Positive  ExponentialBucketCounts // Positive values
+	Negative  ExponentialBucketCounts // Magnitudes of negative values
+}
+
+// ExponentialBucketCounts are the counts of consecutive exponential buckets.
+// Counts[i] counts the magnitudes greater than base^(Offset+i) and less than
+// or equal to base^(Offset+i+1), where base is 2^(2^-Scale).
+type ExponentialBucketCounts struct {
+	Offset int
+	Counts []uint64
+}
+
+// ExponentialBucketsOf returns the buckets of a histogram or timer, or a
+// snapshot of one, whose sample is an ExponentialSample, or false if it has
+// none.  Timers' buckets count nanoseconds.
+func ExponentialBucketsOf(i interface{}) (ExponentialBuckets, bool) {
+	if b, ok := sampleOf(i).(interface{ ExponentialBuckets() ExponentialBuckets }); ok {
+		return b.ExponentialBuckets(), true
+	}
+	return ExponentialBuckets{}, false
+}
+
+// expHistogram is the state of an ExponentialSample, which ExponentialSample
+// guards with its mutex and ExponentialSampleSnapshot copies.
+//
+// A value v other than zero is counted by its magnitude in the bucket i such
+// that base^i < |v| <= base^(i+1), where base is 2^(2^-scale), in positive or
+// negative as v is.  Lowering the scale by one merges buckets 2i and 2i+1
+// into bucket i.  Every magnitude in a bucket is taken to be the one whose
+// relative error is the same at either bound.
+type expHistogram struct {
+	maxSize            int
+	scale              int
+	positive, negative ddStore
+	zero               int64
+	moments
+}
+
+func newExpHistogram(maxSize int) expHistogram {
+	if maxSize <= 0 {
+		maxSize = DefaultExponentialMaxSize
+	}
+	h := expHistogram{maxSize: maxSize}
+	h.clear()
+	return h
+}
+
+// Buckets returns, for each of the given bounds, the number of values recorded
+// whose bucket's representative value is less than or equal to it.
+func (h *expHistogram) Buckets(bounds []float64) []uint64 {
+	return bucketsOf(h.each, bounds)
+}
+
+// ExponentialBuckets returns the scale and bucket counts.
+func (h *expHistogram) ExponentialBuckets() ExponentialBuckets {
+	return ExponentialBuckets{
+		Scale:     h.scale,
+		ZeroCount: uint64(h.zero),
+		Positive:  h.positive.exponentialCounts(),
+		Negative:  h.negative.exponentialCounts(),
+	}
+}
+
+func (h *expHistogram) Percentile(p float64) float64 {
+	return h.Percentiles([]float64{p})[0]
+}
+
+// Percentiles returns the representative value of the bucket holding the
+// value at each rank, but never beyond Min or Max.
+func (h *expHistogram) Percentiles(ps []float64) []float64 {
+	return h.percentilesOf(h.each, ps)
+}
+
+func (h *expHistogram) Values() []int64 { return h.valuesOf(h.each) }
+
+func (h *expHistogram) clear() {
+	h.scale = ExponentialMaxScale
+	h.positive, h.negative = ddStore{}, ddStore{}
+	h.zero = 0
+	h.moments.clear()
+}
+
+func (h *expHistogram) copy() expHistogram {
+	copied := *h
+	copied.positive = h.positive.copy()
+	copied.negative = h.negative.copy()
+	return copied
+}
+
+// add counts n magnitudes in bucket i of the store s, which is h.positive or
+// h.negative, lowering the scale first if s can't otherwise keep it.
+func (h *expHistogram) add(s *ddStore, i int, n int64) {
+	if change := h.changeToFit(s, i, i); 0 < change {
+		h.downscale(change)
+		i >>= change
+	}
+	s.add(i, n)
+}
+
+// changeToFit returns how far the scale must be lowered for the store s to
+// keep buckets lo to hi as well as its own.
+func (h *expHistogram) changeToFit(s *ddStore, lo, hi int) int {
+	if 0 != len(s.counts) {
+		if s.offset < lo {
+			lo = s.offset
+		}
+		if last := s.offset + len(s.counts) - 1; last > hi {
+			hi = last
+		}
+	}
+	change := 0
+	for h.scale-change > ExponentialMinScale && (hi>>uint(change))-(lo>>uint(change)) >= h.maxSize {
+		change++
+	}
+	return change
+}
+
+// downscale lowers the scale by change, merging buckets.
+func (h *expHistogram) downscale(change int) {
+	if change <= 0 {
+		return
+	}
+	h.scale -= change
+	h.positive.downscale(change)
+	h.negative.downscale(change)
+}
+
+// each calls f with the representative value and count of each bucket holding
+// any values, in increasing order of value, until f returns false.
+func (h *expHistogram) each(f func(v float64, n int64) bool) {
+	for i := len(h.negative.counts) - 1; i >= 0; i-- {
+		if n := h.negative.counts[i]; 0 != n && !f(-h.value(h.negative.offset+i), n) {
+			return
+		}
+	}
+	if 0 != h.zero && !f(0, h.zero) {
+		return
+	}
+	for i, n := range h.positive.counts {
+		if 0 != n && !f(h.value(h.positive.offset+i), n) {
+			return
+		}
+	}
+}
+
+// index returns the index of the bucket counting the magnitude m, which is at
+// least one.  Powers of two are bucket bounds at every scale, so they're
+// indexed exactly rather than by a logarithm which might round either way.
+func (h *expHistogram) index(m float64) int {
+	frac, exp := math.Frexp(m) // m is frac * 2^exp, frac in [0.5, 1)
+	if 0.5 == frac {
+		// m is 2^(exp-1), the upper bound of bucket exp-2 at scale zero.
+		if h.scale < 0 {
+			return (exp - 2) >> uint(-h.scale)
+		}
+		return ((exp - 1) << uint(h.scale)) - 1
+	}
+	if h.scale <= 0 {
+		return (exp - 1) >> uint(-h.scale)
+	}
+	return int(math.Ceil(math.Log(m)*math.Ldexp(math.Log2E, h.scale))) - 1
+}
+
+// merge adds the values counted by other to h.
+func (h *expHistogram) merge(other *expHistogram) {
+	if 0 == other.count {
+		return
+	}
+	if other.scale < h.scale {
+		h.downscale(h.scale - other.scale)
+	}
+	shift := other.scale - h.scale
+	change := 0
+	for _, stores := range [][2]*ddStore{{&h.positive, &other.positive}, {&h.negative, &other.negative}} {
+		if o := stores[1]; 0 != len(o.counts) {
+			lo, hi := o.offset>>uint(shift), (o.offset+len(o.counts)-1)>>uint(shift)
+			if c := h.changeToFit(stores[0], lo, hi); c > change {
+				change = c
+			}
+		}
+	}
+	h.downscale(change)
+	shift += change
+	h.positive.mergeDownscaled(&other.positive, shift)
+	h.negative.mergeDownscaled(&other.negative, shift)
+	h.zero += other.zero
+	h.moments.merge(&other.moments)
+}
+
+// updateN records n copies of v.
+func (h *expHistogram) updateN(v, n int64) {
+	if n <= 0 {
+		return
+	}
+	h.moments.updateN(v, n)
+	switch {
+	case v > 0:
+		h.add(&h.positive, h.index(float64(v)), n)
+	case v < 0:
+		h.add(&h.negative, h.index(-float64(v)), n)
+	default:
+		h.zero += n
+	}
+}
+
+// value returns the representative magnitude of bucket i, whose bounds are
+// base^i and base^(i+1).
+func (h *expHistogram) value(i int) float64 {
+	base := math.Exp2(math.Ldexp(1, -h.scale))
+	return 2 * math.Exp2(math.Ldexp(float64(i), -h.scale)) * base / (1 + base)
+}
+
+// downscale merges the store's buckets as lowering the scale by change does.
+func (s *ddStore) downscale(change int) {
+	if 0 == len(s.counts) {
+		return
+	}
+	old := *s
+	*s = ddStore{}
+	s.mergeDownscaled(&old, change)
+}
+
+// mergeDownscaled adds the counts of other, lowered in scale by change, to s.
+func (s *ddStore) mergeDownscaled(other *ddStore, change int) {
+	for i, n := range other.counts {
+		if 0 != n {
+			s.add((other.offset+i)>>uint(change), n)
+		}
+	}
+}
+
+// exponentialCounts returns the store's counts, trimmed of empty buckets at
+// either end.
+func (s *ddStore) exponentialCounts() ExponentialBucketCounts {
+	counts := s.counts
+	offset := s.offset
+	for 0 != len(counts) && 0 == counts[0] {
+		counts, offset = counts[1:], offset+1
+	}
+	for 0 != len(counts) && 0 == counts[len(counts)-1] {
+		counts = counts[:len(counts)-1]
+	}
+	c := ExponentialBucketCounts{Offset: offset}
+	if 0 != len(counts) {
+		c.Counts = make([]uint64, len(counts))
+		for i, n := range counts {
+			c.Counts[i] = uint64(n)
+		}
+	}
+	return c
+}
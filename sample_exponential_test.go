@@ -0,0 +1,121 @@
+package metrics
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func BenchmarkExponentialSample(b *testing.B) {
+	benchmarkSample(b, NewExponentialSample(0))
+}
+
+func TestExponentialSampleIndex(t *testing.T) {
+	for scale := -3; scale <= 5; scale++ {
+		h := expHistogram{scale: scale}
+		base := math.Exp2(math.Ldexp(1, -scale))
+		for _, m := range []float64{1, 2, 3, 4, 7, 8, 1000, 1024, 1025, 1 << 40, 1<<40 + 1} {
+			i := h.index(m)
+			lower, upper := math.Pow(base, float64(i)), math.Pow(base, float64(i+1))
+			if !(lower < m*(1+1e-12) && m <= upper*(1+1e-12)) || m == lower {
+				t.Errorf("scale %d: index(%v): %d, covering (%v, %v]\n", scale, m, i, lower, upper)
+			}
+		}
+	}
+}
+
+func TestExponentialSample(t *testing.T) {
+	s := NewExponentialSample(0)
+	for i := -1000; i <= 100000; i++ {
+		s.Update(int64(i))
+	}
+	if count := s.Count(); 101001 != count {
+		t.Errorf("s.Count(): 101001 != %v\n", count)
+	}
+	if min, max := s.Min(), s.Max(); -1000 != min || 100000 != max {
+		t.Errorf("s.Min(), s.Max(): %v, %v\n", min, max)
+	}
+	if sum := s.Sum(); 5000050000-500500 != sum {
+		t.Errorf("s.Sum(): %v != %v\n", 5000050000-500500, sum)
+	}
+	b := s.(*ExponentialSample).ExponentialBuckets()
+	if scale := s.(*ExponentialSample).Scale(); scale != b.Scale || 3 != scale {
+		t.Errorf("s.Scale(): %v, buckets' %v\n", scale, b.Scale)
+	}
+	if 1 != b.ZeroCount || len(b.Positive.Counts) > DefaultExponentialMaxSize || len(b.Negative.Counts) > DefaultExponentialMaxSize {
+		t.Errorf("buckets: %v zeros, %d positive, %d negative\n", b.ZeroCount, len(b.Positive.Counts), len(b.Negative.Counts))
+	}
+	var total uint64
+	for _, n := range append(b.Positive.Counts, b.Negative.Counts...) {
+		total += n
+	}
+	if 101000 != total {
+		t.Errorf("buckets: 101000 != %v\n", total)
+	}
+	accuracy := math.Exp2(math.Ldexp(1, -b.Scale)) - 1
+	ps := []float64{0.005, 0.5, 0.99, 0.999, 1}
+	for i, p := range s.Percentiles(ps) {
+		want := math.Ceil(ps[i]*101001) - 1001
+		if math.Abs(p-want) > math.Abs(want)*accuracy+1 {
+			t.Errorf("percentile %v: %v isn't within %v of %v\n", ps[i], p, accuracy, want)
+		}
+	}
+}
+
+func TestExponentialSampleMerge(t *testing.T) {
+	a, b, all := NewExponentialSample(0), NewExponentialSample(0), NewExponentialSample(0)
+	for i := int64(1); i <= 10000; i++ {
+		a.Update(i * int64(time.Microsecond))
+		all.Update(i * int64(time.Microsecond))
+	}
+	for i := int64(1); i <= 100; i++ {
+		b.Update(i * int64(time.Second))
+		all.Update(i * int64(time.Second))
+	}
+	b.Update(-7)
+	all.Update(-7)
+	if a.(*ExponentialSample).Scale() <= all.(*ExponentialSample).Scale() {
+		t.Fatalf("scales: %v, %v\n", a.(*ExponentialSample).Scale(), all.(*ExponentialSample).Scale())
+	}
+	if err := a.(*ExponentialSample).Merge(b.Snapshot()); nil != err {
+		t.Fatal(err)
+	}
+	if merged, want := a.(*ExponentialSample).ExponentialBuckets(), all.(*ExponentialSample).ExponentialBuckets(); !reflect.DeepEqual(want, merged) {
+		t.Errorf("merged: %+v != %+v\n", want, merged)
+	}
+	if a.Count() != all.Count() || a.Min() != all.Min() || a.Max() != all.Max() || a.Sum() != all.Sum() {
+		t.Errorf("merged: %v %v %v %v\n", a.Count(), a.Min(), a.Max(), a.Sum())
+	}
+	if err := a.(*ExponentialSample).Merge(a); nil != err || 2*all.Count() != a.Count() {
+		t.Errorf("merging into itself: %v, %v\n", err, a.Count())
+	}
+	if err := a.(*ExponentialSample).Merge(NewDDSketchSample(0.01)); nil == err {
+		t.Error("merging a DDSketchSample didn't fail")
+	}
+}
+
+func TestExponentialSampleSnapshotAndClear(t *testing.T) {
+	s := NewExponentialSample(4).(*ExponentialSample)
+	s.UpdateN(1, 3)
+	s.Update(1 << 20)
+	snapshot := s.snapshotAndClear()
+	if 4 != snapshot.Count() || snapshot.(*ExponentialSampleSnapshot).Scale() >= ExponentialMaxScale {
+		t.Errorf("snapshot: %v values at scale %v\n", snapshot.Count(), snapshot.(*ExponentialSampleSnapshot).Scale())
+	}
+	if 0 != s.Count() || ExponentialMaxScale != s.Scale() {
+		t.Errorf("cleared: %v values at scale %v\n", s.Count(), s.Scale())
+	}
+}
+
+func TestExponentialBucketsOf(t *testing.T) {
+	tm := NewCustomTimer(NewHistogram(NewExponentialSample(0)), NewMeter())
+	tm.Update(time.Millisecond)
+	b, ok := ExponentialBucketsOf(tm.Snapshot())
+	if !ok || 1 != len(b.Positive.Counts) || 1 != b.Positive.Counts[0] {
+		t.Errorf("ExponentialBucketsOf(): %+v, %v\n", b, ok)
+	}
+	if _, ok := ExponentialBucketsOf(NewTimer()); ok {
+		t.Error("ExponentialBucketsOf(): a timer without an exponential sample\n")
+	}
+}
@@ -0,0 +1,451 @@
+package metrics
+
+import (
+	"math"
+	"math/bits"
+	"sync"
+)
+
+// HDRSample counts every value recorded into log-linear buckets in the manner
+// of Gil Tene's HdrHistogram, rather than keeping a reservoir of them, so that
+// high percentiles such as p99.9 and p99.99 are accurate to the configured
+// precision whatever the update rate, without sampling error.  Count, Min,
+// Max, Sum, Mean and Variance are exact; percentiles are exact to within the
+// precision.  Values outside the trackable range are counted at its ends.
+//
+// <https://hdrhistogram.github.io/HdrHistogram/>
+//
+// Its memory is fixed by the range and precision: tracking nanoseconds from
+// one to an hour at three significant figures takes about 270 KiB, which every
+// Snapshot copies.
+type HDRSample struct {
+	mutex sync.Mutex
+	hdrCounts
+}
+
+// NewHDRSample constructs a new HDR sample tracking values from lowest to
+// highest with the given number of significant decimal figures, between one
+// and five.  The lowest trackable value is at least one, the highest at least
+// twice the lowest, and the figures are clamped into range.
+//
+// For a Timer, NewTimerWithSample(NewHDRSample(int64(time.Microsecond),
+// int64(time.Minute), 3)) times up to a minute to within 0.1%.
+func NewHDRSample(lowest, highest int64, significantFigures int) Sample {
+	if useNilMetrics() {
+		return NilSample{}
+	}
+	return &HDRSample{hdrCounts: newHDRCounts(lowest, highest, significantFigures)}
+}
+
+// Buckets returns, for each of the given bounds, the number of values recorded
+// which were less than or equal to it, to within the sample's precision.
+func (s *HDRSample) Buckets(bounds []float64) []uint64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.hdrCounts.Buckets(bounds)
+}
+
+// Clear clears all samples.
+func (s *HDRSample) Clear() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.clear()
+}
+
+// Count returns the number of samples recorded.
+func (s *HDRSample) Count() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.count
+}
+
+// Max returns the maximum value recorded.
+func (s *HDRSample) Max() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.hdrCounts.Max()
+}
+
+// Mean returns the mean of the values recorded.
+func (s *HDRSample) Mean() float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.hdrCounts.Mean()
+}
+
+// Min returns the minimum value recorded.
+func (s *HDRSample) Min() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.hdrCounts.Min()
+}
+
+// Percentile returns an arbitrary percentile of the values recorded.
+func (s *HDRSample) Percentile(p float64) float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.hdrCounts.Percentile(p)
+}
+
+// Percentiles returns a slice of arbitrary percentiles of the values
+// recorded.
+func (s *HDRSample) Percentiles(ps []float64) []float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.hdrCounts.Percentiles(ps)
+}
+
+// Size returns the number of values recorded, all of which are counted.
+func (s *HDRSample) Size() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.hdrCounts.Size()
+}
+
+// Snapshot returns a read-only copy of the sample.
+func (s *HDRSample) Snapshot() Sample {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return &HDRSampleSnapshot{hdrCounts: s.copy()}
+}
+
+// snapshotAndClear returns a read-only copy of the sample and clears it
+// without letting any update in between.
+func (s *HDRSample) snapshotAndClear() Sample {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	snapshot := &HDRSampleSnapshot{hdrCounts: s.copy()}
+	s.clear()
+	return snapshot
+}
+
+// StdDev returns the standard deviation of the values recorded.
+func (s *HDRSample) StdDev() float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.hdrCounts.StdDev()
+}
+
+// Sum returns the sum of the values recorded.
+func (s *HDRSample) Sum() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.hdrCounts.Sum()
+}
+
+// SumOverflowed returns true if the sum of the values recorded doesn't fit in
+// an int64, in which case Sum is saturated.
+func (s *HDRSample) SumOverflowed() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.hdrCounts.SumOverflowed()
+}
+
+// Update samples a new value.
+func (s *HDRSample) Update(v int64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.update(v)
+}
+
+// UpdateN records n copies of a value at the cost of one.
+func (s *HDRSample) UpdateN(v, n int64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.updateN(v, n)
+}
+
+// Values returns the values recorded, each at its bucket's midpoint, which
+// makes as many of them as Count.  Prefer the other methods, which don't.
+func (s *HDRSample) Values() []int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.hdrCounts.Values()
+}
+
+// Variance returns the variance of the values recorded.
+func (s *HDRSample) Variance() float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.hdrCounts.Variance()
+}
+
+// HDRSampleSnapshot is a read-only copy of an HDRSample.
+type HDRSampleSnapshot struct {
+	hdrCounts
+}
+
+// Clear panics.
+func (*HDRSampleSnapshot) Clear() {
+	panic("Clear called on an HDRSampleSnapshot")
+}
+
+// Count returns the number of samples recorded at the time the snapshot was
+// taken.
+func (s *HDRSampleSnapshot) Count() int64 { return s.count }
+
+// Snapshot returns the snapshot.
+func (s *HDRSampleSnapshot) Snapshot() Sample { return s }
+
+// Update panics.
+func (*HDRSampleSnapshot) Update(int64) {
+	panic("Update called on an HDRSampleSnapshot")
+}
+
+// hdrCounts is the bucketed state of an HDRSample, which HDRSample guards
+// with its mutex and HDRSampleSnapshot copies.
+//
+// Values are shifted right by unitMagnitude, so that the lowest trackable
+// value counts as one, and then counted in buckets each double the width of
+// the last.  The first holds subBucketCount sub-buckets of width one; each
+// further bucket holds the upper half of those sub-buckets, subBucketCount/2
+// of them, since its lower half is covered by the buckets before it.
+type hdrCounts struct {
+	counts             []int64
+	count              int64
+	highest            int64
+	min, max           int64
+	mean, m2           float64 // Running mean and sum of squared deviations
+	sumHi              int64
+	sumLo              uint64
+	subBucketCount     int64
+	subBucketCountBits uint
+	unitMagnitude      uint
+}
+
+func newHDRCounts(lowest, highest int64, significantFigures int) hdrCounts {
+	if lowest < 1 {
+		lowest = 1
+	}
+	if highest < 2*lowest {
+		highest = 2 * lowest
+	}
+	if significantFigures < 1 {
+		significantFigures = 1
+	} else if significantFigures > 5 {
+		significantFigures = 5
+	}
+	// Sub-buckets of width one resolve 2*10^figures values to the precision.
+	subBucketCountBits := uint(bits.Len64(uint64(2*math.Pow10(significantFigures)) - 1))
+	c := hdrCounts{
+		highest:            highest,
+		subBucketCount:     1 << subBucketCountBits,
+		subBucketCountBits: subBucketCountBits,
+		unitMagnitude:      uint(bits.Len64(uint64(lowest)) - 1),
+	}
+	c.counts = make([]int64, c.index(highest)+1)
+	c.clear()
+	return c
+}
+
+// Buckets returns, for each of the given bounds, the number of values recorded
+// which were less than or equal to it.
+func (c *hdrCounts) Buckets(bounds []float64) []uint64 {
+	buckets := make([]uint64, len(bounds))
+	var n int64
+	j := 0
+	for i, bound := range bounds {
+		for ; j < len(c.counts) && float64(c.highestEquivalent(j)) <= bound; j++ {
+			n += c.counts[j]
+		}
+		buckets[i] = uint64(n)
+	}
+	return buckets
+}
+
+func (c *hdrCounts) Max() int64 {
+	if 0 == c.count {
+		return 0
+	}
+	return c.max
+}
+
+func (c *hdrCounts) Mean() float64 { return c.mean }
+
+func (c *hdrCounts) Min() int64 {
+	if 0 == c.count {
+		return 0
+	}
+	return c.min
+}
+
+func (c *hdrCounts) Percentile(p float64) float64 {
+	return c.Percentiles([]float64{p})[0]
+}
+
+// Percentiles returns the highest value equivalent, to within the precision,
+// to the one at each rank, that is the smallest such that the given fraction
+// of values are less than or equal to it, but never beyond Min or Max.
+func (c *hdrCounts) Percentiles(ps []float64) []float64 {
+	scores := make([]float64, len(ps))
+	if 0 == c.count {
+		return scores
+	}
+	for i, p := range ps {
+		rank := int64(math.Ceil(p * float64(c.count)))
+		if rank < 1 {
+			rank = 1
+		}
+		var n int64
+		for j, k := range c.counts {
+			if n += k; n >= rank {
+				v := c.highestEquivalent(j)
+				if v > c.max {
+					v = c.max
+				}
+				if v < c.min {
+					v = c.min
+				}
+				scores[i] = float64(v)
+				break
+			}
+		}
+	}
+	return scores
+}
+
+func (c *hdrCounts) Size() int { return int(c.count) }
+
+func (c *hdrCounts) StdDev() float64 { return math.Sqrt(c.Variance()) }
+
+func (c *hdrCounts) Sum() int64 {
+	if !c.SumOverflowed() {
+		return int64(c.sumLo)
+	}
+	if c.sumHi < 0 {
+		return math.MinInt64
+	}
+	return math.MaxInt64
+}
+
+func (c *hdrCounts) SumOverflowed() bool {
+	return c.sumHi != int64(c.sumLo)>>63
+}
+
+func (c *hdrCounts) Values() []int64 {
+	values := make([]int64, 0, c.count)
+	for i, n := range c.counts {
+		if 0 == n {
+			continue
+		}
+		lo, hi := c.lowestEquivalent(i), c.highestEquivalent(i)
+		v := lo + (hi-lo)/2
+		for ; n > 0; n-- {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+func (c *hdrCounts) Variance() float64 {
+	if 0 == c.count {
+		return 0.0
+	}
+	return c.m2 / float64(c.count)
+}
+
+func (c *hdrCounts) clear() {
+	for i := range c.counts {
+		c.counts[i] = 0
+	}
+	c.count = 0
+	c.min, c.max = math.MaxInt64, math.MinInt64
+	c.mean, c.m2 = 0, 0
+	c.sumHi, c.sumLo = 0, 0
+}
+
+func (c *hdrCounts) copy() hdrCounts {
+	copied := *c
+	copied.counts = make([]int64, len(c.counts))
+	copy(copied.counts, c.counts)
+	return copied
+}
+
+// highestEquivalent returns the highest value counted in counts[i].
+func (c *hdrCounts) highestEquivalent(i int) int64 {
+	lo := c.lowestEquivalent(i)
+	return lo + c.width(i) - 1
+}
+
+// index returns the index in counts of the sub-bucket counting v, which must
+// be within the trackable range.
+func (c *hdrCounts) index(v int64) int {
+	scaled := v >> c.unitMagnitude
+	if scaled < c.subBucketCount {
+		return int(scaled)
+	}
+	bucket := uint(bits.Len64(uint64(scaled))) - c.subBucketCountBits
+	half := c.subBucketCount / 2
+	return int(c.subBucketCount + int64(bucket-1)*half + (scaled>>bucket - half))
+}
+
+// lowestEquivalent returns the lowest value counted in counts[i].
+func (c *hdrCounts) lowestEquivalent(i int) int64 {
+	if int64(i) < c.subBucketCount {
+		return int64(i) << c.unitMagnitude
+	}
+	half := c.subBucketCount / 2
+	j := int64(i) - c.subBucketCount
+	bucket := uint(j/half) + 1
+	return (j%half + half) << (bucket + c.unitMagnitude)
+}
+
+func (c *hdrCounts) update(v int64) {
+	c.count++
+	if v < c.min {
+		c.min = v
+	}
+	if v > c.max {
+		c.max = v
+	}
+	d := float64(v) - c.mean
+	c.mean += d / float64(c.count)
+	c.m2 += d * (float64(v) - c.mean)
+	var carry uint64
+	c.sumLo, carry = bits.Add64(c.sumLo, uint64(v), 0)
+	c.sumHi += int64(carry) + v>>63
+	if v < 0 {
+		v = 0
+	} else if v > c.highest {
+		v = c.highest
+	}
+	c.counts[c.index(v)]++
+}
+
+// updateN records n copies of v, merging them into the running mean and sum
+// of squared deviations as a group whose own deviations are zero.
+func (c *hdrCounts) updateN(v, n int64) {
+	if n <= 0 {
+		return
+	}
+	prev := c.count
+	c.count += n
+	if v < c.min {
+		c.min = v
+	}
+	if v > c.max {
+		c.max = v
+	}
+	d := float64(v) - c.mean
+	c.mean += d * float64(n) / float64(c.count)
+	c.m2 += d * d * float64(prev) * float64(n) / float64(c.count)
+	hi, lo := mul128(v, n)
+	var carry uint64
+	c.sumLo, carry = bits.Add64(c.sumLo, lo, 0)
+	c.sumHi += hi + int64(carry)
+	if v < 0 {
+		v = 0
+	} else if v > c.highest {
+		v = c.highest
+	}
+	c.counts[c.index(v)] += n
+}
+
+// width returns the width of the range of values counted in counts[i].
+func (c *hdrCounts) width(i int) int64 {
+	if int64(i) < c.subBucketCount {
+		return 1 << c.unitMagnitude
+	}
+	bucket := uint((int64(i)-c.subBucketCount)/(c.subBucketCount/2)) + 1
+	return 1 << (bucket + c.unitMagnitude)
+}
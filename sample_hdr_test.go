@@ -0,0 +1,151 @@
+package metrics
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func BenchmarkHDRSample(b *testing.B) {
+	benchmarkSample(b, NewHDRSample(1, int64(time.Hour), 3))
+}
+
+func TestHDRSample(t *testing.T) {
+	s := NewHDRSample(1, 1000000, 3)
+	for i := 1; i <= 1000000; i++ {
+		s.Update(int64(i))
+	}
+	if count := s.Count(); 1000000 != count {
+		t.Errorf("s.Count(): 1000000 != %v\n", count)
+	}
+	if min := s.Min(); 1 != min {
+		t.Errorf("s.Min(): 1 != %v\n", min)
+	}
+	if max := s.Max(); 1000000 != max {
+		t.Errorf("s.Max(): 1000000 != %v\n", max)
+	}
+	if sum := s.Sum(); 500000500000 != sum {
+		t.Errorf("s.Sum(): 500000500000 != %v\n", sum)
+	}
+	if mean := s.Mean(); 500000.5 != mean {
+		t.Errorf("s.Mean(): 500000.5 != %v\n", mean)
+	}
+	ps := []float64{0.5, 0.99, 0.999, 0.9999, 1}
+	for i, p := range s.Percentiles(ps) {
+		want := ps[i] * 1000000
+		if math.Abs(p-want) > want/1000 {
+			t.Errorf("percentile %v: %v isn't within 0.1%% of %v\n", ps[i], p, want)
+		}
+	}
+}
+
+func TestHDRSampleHighPercentilesUnderSkew(t *testing.T) {
+	rand.Seed(1)
+	s := NewHDRSample(1, int64(time.Minute), 3)
+	// 99.99% fast, 0.01% slow: a 1028-value reservoir would mostly miss them.
+	for i := 0; i < 1000000; i++ {
+		if 0 == i%10000 {
+			s.Update(int64(time.Second))
+		} else {
+			s.Update(int64(time.Millisecond) + rand.Int63n(int64(time.Millisecond)))
+		}
+	}
+	if p := s.Percentile(0.99995); math.Abs(p-float64(time.Second)) > float64(time.Second)/1000 {
+		t.Errorf("s.Percentile(0.99995): %v isn't about a second\n", p)
+	}
+	if p := s.Percentile(0.999); p > 2*float64(time.Millisecond) {
+		t.Errorf("s.Percentile(0.999): %v isn't under 2ms\n", p)
+	}
+}
+
+func TestHDRSampleClampsToRange(t *testing.T) {
+	s := NewHDRSample(1, 1000, 2)
+	s.Update(-5)
+	s.Update(5000)
+	if min := s.Min(); -5 != min {
+		t.Errorf("s.Min(): -5 != %v\n", min)
+	}
+	if max := s.Max(); 5000 != max {
+		t.Errorf("s.Max(): 5000 != %v\n", max)
+	}
+	if sum := s.Sum(); 4995 != sum {
+		t.Errorf("s.Sum(): 4995 != %v\n", sum)
+	}
+	if size := len(s.Values()); 2 != size {
+		t.Errorf("len(s.Values()): 2 != %v\n", size)
+	}
+}
+
+func TestHDRSampleSnapshot(t *testing.T) {
+	s := NewHDRSample(1, 100000, 3)
+	for i := 1; i <= 100; i++ {
+		s.Update(int64(i))
+	}
+	snapshot := s.Snapshot()
+	s.Update(1000)
+	if count := snapshot.Count(); 100 != count {
+		t.Errorf("snapshot.Count(): 100 != %v\n", count)
+	}
+	if max := snapshot.Max(); 100 != max {
+		t.Errorf("snapshot.Max(): 100 != %v\n", max)
+	}
+	if p := snapshot.Percentile(0.5); 50 != p {
+		t.Errorf("snapshot.Percentile(0.5): 50 != %v\n", p)
+	}
+	s.Clear()
+	if count := s.Count(); 0 != count {
+		t.Errorf("s.Count(): 0 != %v\n", count)
+	}
+	if ps := s.Percentiles([]float64{0.5}); 0 != ps[0] {
+		t.Errorf("s.Percentiles(): %v\n", ps)
+	}
+}
+
+func TestHDRSampleBuckets(t *testing.T) {
+	h := NewHistogram(NewHDRSample(1, 100000, 3))
+	for i := 1; i <= 10000; i++ {
+		h.Update(int64(i))
+	}
+	buckets := h.Snapshot().(*HistogramSnapshot).Buckets([]float64{0, 100, 1000, 1e6})
+	if 0 != buckets[0] || 100 != buckets[1] || 1000 != buckets[2] || 10000 != buckets[3] {
+		t.Errorf("buckets: [0 100 1000 10000] != %v\n", buckets)
+	}
+	if h.SumOverflowed() {
+		t.Error("h.SumOverflowed()")
+	}
+}
+
+func TestTimerWithHDRSample(t *testing.T) {
+	tm := NewTimerWithSample(NewHDRSample(int64(time.Microsecond), int64(time.Minute), 3))
+	for i := 1; i <= 10000; i++ {
+		tm.Update(time.Duration(i) * time.Millisecond / 10)
+	}
+	snapshot := tm.Snapshot()
+	if count := snapshot.Count(); 10000 != count {
+		t.Errorf("snapshot.Count(): 10000 != %v\n", count)
+	}
+	want := 0.9999 * float64(time.Second)
+	if p := snapshot.Percentile(0.9999); math.Abs(p-want) > want/1000 {
+		t.Errorf("snapshot.Percentile(0.9999): %v isn't within 0.1%% of %v\n", p, want)
+	}
+}
+
+func TestHDRSampleUpdateN(t *testing.T) {
+	s, want := NewHDRSample(1, 1000000, 3), NewHDRSample(1, 1000000, 3)
+	for _, v := range []int64{5, 700, 12000} {
+		s.(*HDRSample).UpdateN(v, 100)
+		for i := 0; i < 100; i++ {
+			want.Update(v)
+		}
+	}
+	if s.Count() != want.Count() || s.Sum() != want.Sum() || s.Min() != want.Min() || s.Max() != want.Max() {
+		t.Errorf("count %v, sum %v; want %v, %v\n", s.Count(), s.Sum(), want.Count(), want.Sum())
+	}
+	if math.Abs(s.Mean()-want.Mean()) > 1e-9 || math.Abs(s.StdDev()-want.StdDev()) > 1e-6 {
+		t.Errorf("mean %v, stddev %v; want %v, %v\n", s.Mean(), s.StdDev(), want.Mean(), want.StdDev())
+	}
+	if s.Percentile(0.5) != want.Percentile(0.5) {
+		t.Errorf("median %v; want %v\n", s.Percentile(0.5), want.Percentile(0.5))
+	}
+}
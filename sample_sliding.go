@@ -0,0 +1,196 @@
+package metrics
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// SlidingTimeWindowSample keeps every value recorded within the last window,
+// so that percentiles of a Timer or Histogram backed by it are exact for that
+// window rather than the approximation of an ExpDecaySample, e.g. for alerting
+// on the p99 of the last five minutes.  Values older than the window are
+// trimmed as the sample is read or updated.  Memory grows with the update rate
+// times the window, so it suits moderate rates.
+type SlidingTimeWindowSample struct {
+	count  int64
+	mutex  sync.Mutex
+	window time.Duration
+	times  []int64 // UnixNano of each value, in order of recording
+	values []int64
+}
+
+// NewSlidingTimeWindowSample constructs a new sliding-time-window sample
+// keeping values recorded within the given window.
+func NewSlidingTimeWindowSample(window time.Duration) Sample {
+	if useNilMetrics() {
+		return NilSample{}
+	}
+	return &SlidingTimeWindowSample{window: window}
+}
+
+// Clear clears all samples.
+func (s *SlidingTimeWindowSample) Clear() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.clear()
+}
+
+func (s *SlidingTimeWindowSample) clear() {
+	// should run with s.mutex held
+	s.count = 0
+	s.times = nil
+	s.values = nil
+}
+
+// Count returns the number of samples recorded, which may exceed the number
+// within the window.
+func (s *SlidingTimeWindowSample) Count() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.count
+}
+
+// Max returns the maximum value recorded within the window.
+func (s *SlidingTimeWindowSample) Max() int64 {
+	return SampleMax(s.Values())
+}
+
+// Mean returns the mean of the values recorded within the window.
+func (s *SlidingTimeWindowSample) Mean() float64 {
+	return SampleMean(s.Values())
+}
+
+// Min returns the minimum value recorded within the window.
+func (s *SlidingTimeWindowSample) Min() int64 {
+	return SampleMin(s.Values())
+}
+
+// Percentile returns an arbitrary percentile of values recorded within the
+// window.
+func (s *SlidingTimeWindowSample) Percentile(p float64) float64 {
+	return SamplePercentile(s.Values(), p)
+}
+
+// Percentiles returns a slice of arbitrary percentiles of values recorded
+// within the window.
+func (s *SlidingTimeWindowSample) Percentiles(ps []float64) []float64 {
+	return SamplePercentiles(s.Values(), ps)
+}
+
+// Size returns the number of values recorded within the window.
+func (s *SlidingTimeWindowSample) Size() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.trim(now())
+	return len(s.values)
+}
+
+// Snapshot returns a read-only copy of the sample.
+func (s *SlidingTimeWindowSample) Snapshot() Sample {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.snapshot(now())
+}
+
+// snapshotAndClear returns a read-only copy of the sample and clears it
+// without letting any update in between.
+func (s *SlidingTimeWindowSample) snapshotAndClear() Sample {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	snapshot := s.snapshot(now())
+	s.clear()
+	return snapshot
+}
+
+func (s *SlidingTimeWindowSample) snapshot(now time.Time) *SampleSnapshot {
+	// should run with s.mutex held
+	s.trim(now)
+	values := make([]int64, len(s.values))
+	copy(values, s.values)
+	return &SampleSnapshot{
+		count:  s.count,
+		values: values,
+	}
+}
+
+// StdDev returns the standard deviation of the values recorded within the
+// window.
+func (s *SlidingTimeWindowSample) StdDev() float64 {
+	return SampleStdDev(s.Values())
+}
+
+// Sum returns the sum of the values recorded within the window.
+func (s *SlidingTimeWindowSample) Sum() int64 {
+	return SampleSum(s.Values())
+}
+
+// Update samples a new value.
+func (s *SlidingTimeWindowSample) Update(v int64) {
+	s.update(now(), v)
+}
+
+// Values returns a copy of the values recorded within the window.
+func (s *SlidingTimeWindowSample) Values() []int64 {
+	return s.valuesAt(now())
+}
+
+// Variance returns the variance of the values recorded within the window.
+func (s *SlidingTimeWindowSample) Variance() float64 {
+	return SampleVariance(s.Values())
+}
+
+// update samples a new value at a particular timestamp.  This is a method all
+// its own to facilitate testing.
+func (s *SlidingTimeWindowSample) update(t time.Time, v int64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.count++
+	s.trim(t)
+	s.times = append(s.times, t.UnixNano())
+	s.values = append(s.values, v)
+}
+
+// UpdateN records n copies of a value at once.
+func (s *SlidingTimeWindowSample) UpdateN(v, n int64) {
+	s.updateN(now(), v, n)
+}
+
+func (s *SlidingTimeWindowSample) updateN(t time.Time, v, n int64) {
+	if n <= 0 {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.count += n
+	s.trim(t)
+	for nanos := t.UnixNano(); n > 0; n-- {
+		s.times = append(s.times, nanos)
+		s.values = append(s.values, v)
+	}
+}
+
+// valuesAt returns a copy of the values recorded within the window ending at
+// now.
+func (s *SlidingTimeWindowSample) valuesAt(now time.Time) []int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.trim(now)
+	values := make([]int64, len(s.values))
+	copy(values, s.values)
+	return values
+}
+
+// trim drops the values recorded before the window ending at now.
+func (s *SlidingTimeWindowSample) trim(now time.Time) {
+	// should run with s.mutex held
+	cutoff := now.Add(-s.window).UnixNano()
+	i := sort.Search(len(s.times), func(i int) bool { return s.times[i] > cutoff })
+	if 0 == i {
+		return
+	}
+	n := copy(s.times, s.times[i:])
+	s.times = s.times[:n]
+	copy(s.values, s.values[i:])
+	s.values = s.values[:n]
+}
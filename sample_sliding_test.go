@@ -0,0 +1,94 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+)
+
+func BenchmarkSlidingTimeWindowSample(b *testing.B) {
+	benchmarkSample(b, NewSlidingTimeWindowSample(time.Second))
+}
+
+func TestSlidingTimeWindowSample(t *testing.T) {
+	s := NewSlidingTimeWindowSample(time.Minute).(*SlidingTimeWindowSample)
+	now := time.Now()
+	for i := 0; i < 10; i++ {
+		s.update(now.Add(-2*time.Minute), 1000)
+	}
+	for i := 1; i <= 100; i++ {
+		s.update(now.Add(-30*time.Second), int64(i))
+	}
+	if count := s.Count(); 110 != count {
+		t.Errorf("s.Count(): 110 != %v\n", count)
+	}
+	values := s.valuesAt(now)
+	if 100 != len(values) {
+		t.Fatalf("len(values): 100 != %v\n", len(values))
+	}
+	if max := SampleMax(values); 100 != max {
+		t.Errorf("max: 100 != %v\n", max)
+	}
+	if p := SamplePercentile(values, 0.99); 99.99 != p {
+		t.Errorf("99th percentile: 99.99 != %v\n", p)
+	}
+	if values := s.valuesAt(now.Add(time.Minute)); 0 != len(values) {
+		t.Errorf("values a minute later: %v\n", values)
+	}
+	if count := s.Count(); 110 != count {
+		t.Errorf("s.Count() after trimming: 110 != %v\n", count)
+	}
+}
+
+func TestSlidingTimeWindowSampleTrimsOnUpdate(t *testing.T) {
+	s := NewSlidingTimeWindowSample(time.Minute).(*SlidingTimeWindowSample)
+	now := time.Now()
+	for i := 0; i < 60; i++ {
+		s.update(now.Add(time.Duration(i)*time.Second), 1)
+	}
+	s.update(now.Add(90*time.Second), 2)
+	if 30 != len(s.values) || 30 != len(s.times) {
+		t.Errorf("len(s.values): 30 != %v\n", len(s.values))
+	}
+}
+
+func TestSlidingTimeWindowSampleUpdateN(t *testing.T) {
+	s := NewSlidingTimeWindowSample(time.Minute).(*SlidingTimeWindowSample)
+	now := time.Now()
+	s.updateN(now, 1, 10)
+	s.updateN(now.Add(90*time.Second), 2, 5)
+	if 15 != s.count || 5 != len(s.values) || 5 != len(s.times) {
+		t.Errorf("count %v, len(s.values) %v\n", s.count, len(s.values))
+	}
+}
+
+func TestSlidingTimeWindowSampleSnapshot(t *testing.T) {
+	s := NewSlidingTimeWindowSample(time.Minute)
+	for i := 1; i <= 10; i++ {
+		s.Update(int64(i))
+	}
+	snapshot := s.Snapshot()
+	s.Update(11)
+	if size := snapshot.Size(); 10 != size {
+		t.Errorf("snapshot.Size(): 10 != %v\n", size)
+	}
+	if mean := snapshot.Mean(); 5.5 != mean {
+		t.Errorf("snapshot.Mean(): 5.5 != %v\n", mean)
+	}
+	if size := s.Size(); 11 != size {
+		t.Errorf("s.Size(): 11 != %v\n", size)
+	}
+	s.Clear()
+	if count := s.Count(); 0 != count {
+		t.Errorf("s.Count(): 0 != %v\n", count)
+	}
+}
+
+func TestTimerWithSlidingTimeWindowSample(t *testing.T) {
+	tm := NewTimerWithSample(NewSlidingTimeWindowSample(5 * time.Minute))
+	for i := 1; i <= 1000; i++ {
+		tm.Update(time.Duration(i) * time.Millisecond)
+	}
+	if p := tm.Percentile(0.999); 999.999*float64(time.Millisecond) != p {
+		t.Errorf("tm.Percentile(0.999): %v\n", p)
+	}
+}
@@ -1,6 +1,7 @@
 package metrics
 
 import (
+	"math"
 	"math/rand"
 	"runtime"
 	"testing"
@@ -180,6 +181,33 @@ func TestExpDecaySampleRescale(t *testing.T) {
 	}
 }
 
+// TestExpDecaySampleRecencyBias checks that forward decay favours recent
+// values where a uniform sample doesn't: of values counting up one per
+// second, the decaying sample's median is well above the uniform sample's.
+func TestExpDecaySampleRecencyBias(t *testing.T) {
+	rand.Seed(1)
+	now := time.Now()
+	es := NewExpDecaySample(100, 0.015)
+	us := NewUniformSample(100)
+	for i := 0; i < 3600; i++ {
+		es.(*ExpDecaySample).update(now.Add(time.Duration(i)*time.Second), int64(i))
+		us.Update(int64(i))
+	}
+	if em, um := es.Percentile(0.5), us.Percentile(0.5); em < um+1000 {
+		t.Errorf("es.Percentile(0.5): %v isn't well above us.Percentile(0.5): %v\n", em, um)
+	}
+	if size := es.Size(); 100 != size {
+		t.Errorf("es.Size(): 100 != %v\n", size)
+	}
+	es.Clear()
+	if count := es.Count(); 0 != count {
+		t.Errorf("es.Count(): 0 != %v\n", count)
+	}
+	if values := es.Values(); 0 != len(values) {
+		t.Errorf("es.Values(): %v\n", values)
+	}
+}
+
 func TestExpDecaySampleSnapshot(t *testing.T) {
 	now := time.Now()
 	rand.Seed(1)
@@ -261,6 +289,74 @@ func TestUniformSampleStatistics(t *testing.T) {
 	testUniformSampleStatistics(t, s)
 }
 
+// TestUniformSampleInclusionProbability checks that reservoir sampling keeps
+// every value with equal probability, size/count, regardless of when it was
+// seen.
+func TestUniformSampleInclusionProbability(t *testing.T) {
+	rand.Seed(1)
+	const size, count, trials = 10, 100, 10000
+	var kept [count]int
+	for i := 0; i < trials; i++ {
+		s := NewUniformSample(size)
+		for v := 0; v < count; v++ {
+			s.Update(int64(v))
+		}
+		for _, v := range s.Values() {
+			kept[v]++
+		}
+	}
+	want := float64(trials) * size / count
+	for v, n := range kept {
+		if math.Abs(float64(n)-want) > 0.15*want {
+			t.Errorf("kept[%d]: %v != %v\n", v, n, want)
+		}
+	}
+}
+
+func TestPercentileName(t *testing.T) {
+	for p, name := range map[float64]string{
+		0:      "p0",
+		0.5:    "p50",
+		0.75:   "p75",
+		0.99:   "p99",
+		0.999:  "p99_9",
+		0.9999: "p99_99",
+		0.29:   "p29",
+		1:      "p100",
+	} {
+		if s := PercentileName(p); name != s {
+			t.Errorf("PercentileName(%v): %v != %v\n", p, name, s)
+		}
+	}
+}
+
+func TestSamplePercentilesHighQuantiles(t *testing.T) {
+	values := make(int64Slice, 10000)
+	for i := range values {
+		values[i] = int64(i + 1)
+	}
+	ps := SamplePercentiles(values, []float64{0.99, 0.999, 0.9999})
+	for i, want := range []float64{9900.99, 9990.999, 9999.9999} {
+		if math.Abs(want-ps[i]) > 1e-6 {
+			t.Errorf("ps[%d]: %v != %v\n", i, want, ps[i])
+		}
+	}
+
+	// With fewer values than p99.99 needs to tell apart from the maximum,
+	// the extreme tail is the largest value rather than an extrapolation.
+	values = make(int64Slice, 1028)
+	for i := range values {
+		values[i] = int64(i + 1)
+	}
+	ps = SamplePercentiles(values, []float64{0.9995, 0.9999})
+	if 1028 != ps[0] {
+		t.Errorf("ps[0]: 1028 != %v\n", ps[0])
+	}
+	if 1028 != ps[1] {
+		t.Errorf("ps[1]: 1028 != %v\n", ps[1])
+	}
+}
+
 func benchmarkSample(b *testing.B, s Sample) {
 	var memStats runtime.MemStats
 	runtime.ReadMemStats(&memStats)
@@ -361,3 +457,176 @@ func TestUniformSampleConcurrentUpdateCount(t *testing.T) {
 	}
 	quit <- struct{}{}
 }
+
+func TestSampleSumOfEveryValue(t *testing.T) {
+	for _, s := range []Sample{NewExpDecaySample(10, 0.015), NewUniformSample(10)} {
+		for i := 1; i <= 100; i++ {
+			s.Update(int64(i))
+		}
+		if size := s.Size(); 10 != size {
+			t.Errorf("s.Size(): 10 != %v\n", size)
+		}
+		if sum := s.Sum(); 5050 != sum {
+			t.Errorf("s.Sum(): 5050 != %v\n", sum)
+		}
+		snapshot := s.Snapshot()
+		s.Update(1)
+		if sum := snapshot.Sum(); 5050 != sum {
+			t.Errorf("snapshot.Sum(): 5050 != %v\n", sum)
+		}
+		s.Clear()
+		if sum := s.Sum(); 0 != sum {
+			t.Errorf("s.Sum(): 0 != %v\n", sum)
+		}
+	}
+}
+
+func TestHistogramSumAndCount(t *testing.T) {
+	h := NewHistogram(NewUniformSample(10))
+	for i := 1; i <= 100; i++ {
+		h.Update(int64(i))
+	}
+	snapshot := h.(*StandardHistogram).snapshotAndReset().(Histogram)
+	if count := snapshot.Count(); 100 != count {
+		t.Errorf("snapshot.Count(): 100 != %v\n", count)
+	}
+	if sum := snapshot.Sum(); 5050 != sum {
+		t.Errorf("snapshot.Sum(): 5050 != %v\n", sum)
+	}
+	if sum := h.Sum(); 0 != sum {
+		t.Errorf("h.Sum(): 0 != %v\n", sum)
+	}
+}
+
+func TestUniformSampleUpdateN(t *testing.T) {
+	rand.Seed(1)
+	const size, trials = 10, 10000
+	var kept int
+	for i := 0; i < trials; i++ {
+		s := NewUniformSample(size)
+		for v := 0; v < 50; v++ {
+			s.Update(int64(v))
+		}
+		s.(*UniformSample).UpdateN(999, 50)
+		if 100 != s.Count() {
+			t.Fatalf("s.Count(): 100 != %v\n", s.Count())
+		}
+		for _, v := range s.Values() {
+			if 999 == v {
+				kept++
+			}
+		}
+	}
+	// Half the values counted are copies, so half the reservoir should be.
+	if want := float64(trials) * size / 2; math.Abs(float64(kept)-want) > 0.05*want {
+		t.Errorf("copies kept: %v != %v\n", kept, want)
+	}
+
+	s := NewUniformSample(size)
+	s.(*UniformSample).UpdateN(7, 4)
+	if 4 != s.Count() || 28 != s.Sum() || 4 != len(s.Values()) {
+		t.Errorf("s: count %v, sum %v, values %v\n", s.Count(), s.Sum(), s.Values())
+	}
+}
+
+func TestExpDecaySampleUpdateN(t *testing.T) {
+	rand.Seed(1)
+	const size, trials = 10, 10000
+	ts := time.Now()
+	copies := func(update func(*ExpDecaySample)) int {
+		var kept int
+		for i := 0; i < trials; i++ {
+			s := NewExpDecaySample(size, 0.015).(*ExpDecaySample)
+			for v := 0; v < 50; v++ {
+				s.update(ts, int64(v))
+			}
+			update(s)
+			for _, v := range s.Values() {
+				if 999 == v {
+					kept++
+				}
+			}
+		}
+		return kept
+	}
+	want := copies(func(s *ExpDecaySample) {
+		for i := 0; i < 50; i++ {
+			s.update(ts, 999)
+		}
+	})
+	got := copies(func(s *ExpDecaySample) { s.updateN(ts, 999, 50) })
+	if math.Abs(float64(got-want)) > 0.05*float64(want) {
+		t.Errorf("copies kept: %v != %v\n", got, want)
+	}
+
+	s := NewExpDecaySample(size, 0.015)
+	s.(*ExpDecaySample).UpdateN(-3, 1000)
+	if 1000 != s.Count() || -3000 != s.Sum() || size != s.Size() {
+		t.Errorf("s: count %v, sum %v, size %v\n", s.Count(), s.Sum(), s.Size())
+	}
+}
+
+func TestRunningSumAddN(t *testing.T) {
+	var s runningSum
+	s.addN(-5, 4)
+	if -20 != s.value() {
+		t.Errorf("s.value(): -20 != %v\n", s.value())
+	}
+	s.addN(math.MaxInt64, 3)
+	if !s.overflowed() {
+		t.Errorf("s.overflowed(): false\n")
+	}
+	s.addN(math.MinInt64, 3)
+	s.addN(3, 1)
+	if s.overflowed() || -20 != s.value() {
+		t.Errorf("s.value(): -20 != %v\n", s.value())
+	}
+}
+
+func TestHistogramNegativeValues(t *testing.T) {
+	for _, c := range []struct {
+		values                 []int64
+		mean, variance, stdDev float64
+	}{
+		{[]int64{-5, -1}, -3, 4, 2},
+		{[]int64{-3, 5}, 1, 16, 4},
+		{[]int64{-7, 0, 1}, -2, 38.0 / 3, math.Sqrt(38.0 / 3)},
+	} {
+		for _, s := range []Sample{NewExpDecaySample(10, 0.015), NewUniformSample(10), NewDDSketchSample(0.01)} {
+			h := NewHistogram(s)
+			for _, v := range c.values {
+				h.Update(v)
+			}
+			for _, m := range []Histogram{h, h.Snapshot()} {
+				if mean := m.Mean(); math.Abs(c.mean-mean) > 1e-9 {
+					t.Errorf("%T %v: Mean(): %v != %v\n", s, c.values, c.mean, mean)
+				}
+				if variance := m.Variance(); math.Abs(c.variance-variance) > 1e-9 {
+					t.Errorf("%T %v: Variance(): %v != %v\n", s, c.values, c.variance, variance)
+				}
+				if stdDev := m.StdDev(); math.Abs(c.stdDev-stdDev) > 1e-9 {
+					t.Errorf("%T %v: StdDev(): %v != %v\n", s, c.values, c.stdDev, stdDev)
+				}
+			}
+		}
+	}
+}
+
+func TestRunningSumFloat64(t *testing.T) {
+	for _, c := range []struct {
+		values []int64
+		want   float64
+	}{
+		{[]int64{-5, -1}, -6},
+		{[]int64{-3, 5}, 2},
+		{[]int64{math.MinInt64, math.MinInt64}, -0x1p64},
+		{[]int64{math.MinInt64, math.MinInt64, 1}, -0x1p64 + 1},
+		{[]int64{math.MaxInt64, math.MaxInt64, 2}, 0x1p64},
+	} {
+		var s runningSum
+		s.addAll(c.values)
+		if f := s.float64(); c.want != f {
+			t.Errorf("%v: s.float64(): %v != %v\n", c.values, c.want, f)
+		}
+	}
+}
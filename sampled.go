@@ -0,0 +1,215 @@
+package metrics
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"sync/atomic"
+	"time"
+)
+
+// Sampling configures which updates a SampledCounter or SampledTimer records,
+// for code paths so hot that even the atomic add of a StandardCounter per
+// event costs too much.  The updates recorded are scaled up to stand for the
+// ones skipped, so counts and rates stay about right while the distribution of
+// a timer's durations is only as representative as the updates recorded.
+type Sampling struct {
+	Every int64 // Record 1 in Every updates, chosen at random; 0 or 1 records every one
+
+	// PerSecond, if positive, records about at most PerSecond updates a
+	// second, adapting Every, from which it starts, each second to the rate
+	// of updates in the second before.  Updates over the limit while Every
+	// catches up with a burst are skipped and added to the next recorded.
+	PerSecond int64
+}
+
+// updateSampler decides, in a way costing no atomic writes for the updates
+// skipped at random, which updates a SampledCounter or SampledTimer records.
+type updateSampler struct {
+	perSecond int64
+	every     int64 // Current 1 in every, accessed atomically
+	window    int64 // Unix nanoseconds the current second began, accessed atomically
+	recorded  int64 // Updates chosen in the current second, accessed atomically
+}
+
+func newUpdateSampler(s Sampling) *updateSampler {
+	every := s.Every
+	if every < 1 {
+		every = 1
+	}
+	return &updateSampler{perSecond: s.PerSecond, every: every}
+}
+
+// sample returns the number of updates the one at hand stands for if it's to
+// be recorded or, if it's to be skipped, 0 and how many it would've stood for
+// if it's only skipped for being over the limit per second.
+func (s *updateSampler) sample() (weight, over int64) {
+	every := atomic.LoadInt64(&s.every)
+	if 1 < every && 0 != rand.Int63n(every) {
+		return 0, 0
+	}
+	if s.perSecond <= 0 {
+		return every, 0
+	}
+	t := now().UnixNano()
+	window := atomic.LoadInt64(&s.window)
+	if elapsed := t - window; elapsed >= int64(time.Second) && atomic.CompareAndSwapInt64(&s.window, window, t) {
+		recorded := atomic.SwapInt64(&s.recorded, 0)
+		if 0 != window {
+			rate := float64(recorded*every) * float64(time.Second) / float64(elapsed)
+			atomic.StoreInt64(&s.every, int64(math.Max(1, math.Ceil(rate/float64(s.perSecond)))))
+		}
+	}
+	if atomic.AddInt64(&s.recorded, 1) > s.perSecond {
+		return 0, every
+	}
+	return every, 0
+}
+
+// NewSampledCounter constructs a new SampledCounter incrementing the given
+// Counter.
+func NewSampledCounter(c Counter, s Sampling) *SampledCounter {
+	return &SampledCounter{Counter: c, sampler: newUpdateSampler(s)}
+}
+
+// SampledCounter is a Counter which increments the Counter it wraps for only
+// some of the calls to Inc and Dec, by their amounts multiplied by the number
+// of calls each stands for; see Sampling.  Register the SampledCounter, or the
+// Counter it wraps if the amounts owed for calls over the limit per second
+// needn't be reported until the next call recorded.
+type SampledCounter struct {
+	Counter
+	sampler *updateSampler
+	owed    int64 // Amount of the calls skipped over the limit, accessed atomically
+}
+
+// Count returns the count of the counter wrapped and the amount owed to it.
+func (c *SampledCounter) Count() int64 {
+	return c.Counter.Count() + atomic.LoadInt64(&c.owed)
+}
+
+// Dec decrements the counter by the given amount, for some calls.
+func (c *SampledCounter) Dec(i int64) {
+	c.Inc(-i)
+}
+
+// Inc increments the counter by the given amount, for some calls.
+func (c *SampledCounter) Inc(i int64) {
+	weight, over := c.sampler.sample()
+	if 0 != over {
+		atomic.AddInt64(&c.owed, i*over)
+		return
+	}
+	if 0 != weight {
+		c.Counter.Inc(i*weight + takeOwed(&c.owed))
+	}
+}
+
+// Snapshot returns a read-only copy of the counter, including what's owed.
+func (c *SampledCounter) Snapshot() Counter {
+	return CounterSnapshot{count: c.Count(), timestamp: now()}
+}
+
+// NewSampledTimer constructs a new SampledTimer recording into the given
+// Timer.
+func NewSampledTimer(t Timer, s Sampling) *SampledTimer {
+	return &SampledTimer{Timer: t, sampler: newUpdateSampler(s)}
+}
+
+// SampledTimer is a Timer which records only some of the durations it's given
+// in the Timer it wraps, each as many times as the number of updates it
+// stands for; see Sampling.  Time and TimeContextWithExemplar don't read the
+// clock for the calls skipped, and UpdateAggregate, being already cheap per
+// event, records every aggregate.
+type SampledTimer struct {
+	Timer
+	sampler *updateSampler
+	owed    int64 // Updates skipped over the limit, accessed atomically
+}
+
+// Start starts a Stopwatch which, once stopped, is recorded or skipped.
+func (t *SampledTimer) Start() Stopwatch {
+	return Stopwatch{timer: t, started: now()}
+}
+
+// Time runs the given function, recording its duration for some calls.
+func (t *SampledTimer) Time(f func()) {
+	weight := t.weight()
+	if 0 == weight {
+		f()
+		return
+	}
+	ts := now()
+	f()
+	t.Timer.UpdateN(since(ts), weight)
+}
+
+// TimeContextWithExemplar runs the given function, recording its duration and
+// keeping it as an exemplar if the timer wrapped would for some calls.  Calls
+// which stand for more than one update are recorded without exemplars.
+func (t *SampledTimer) TimeContextWithExemplar(ctx context.Context, f func()) {
+	weight := t.weight()
+	switch weight {
+	case 0:
+		f()
+	case 1:
+		t.Timer.TimeContextWithExemplar(ctx, f)
+	default:
+		ts := now()
+		f()
+		t.Timer.UpdateN(since(ts), weight)
+	}
+}
+
+// Update records the duration of an event, for some calls.
+func (t *SampledTimer) Update(d time.Duration) {
+	if weight := t.weight(); 0 != weight {
+		t.Timer.UpdateN(d, weight)
+	}
+}
+
+// UpdateN records the duration of a batch of n events, for some calls.
+func (t *SampledTimer) UpdateN(d time.Duration, n int64) {
+	if n <= 0 {
+		return
+	}
+	weight, over := t.sampler.sample()
+	if 0 != over {
+		atomic.AddInt64(&t.owed, n*over)
+		return
+	}
+	if 0 != weight {
+		t.Timer.UpdateN(d, n*weight+takeOwed(&t.owed))
+	}
+}
+
+// UpdateSince records the duration of an event that started at a time and
+// ends now, for some calls.
+func (t *SampledTimer) UpdateSince(ts time.Time) {
+	if weight := t.weight(); 0 != weight {
+		t.Timer.UpdateN(since(ts), weight)
+	}
+}
+
+// weight returns the number of updates the one at hand stands for, including
+// those owed, or 0 if it's skipped.
+func (t *SampledTimer) weight() int64 {
+	weight, over := t.sampler.sample()
+	if 0 != over {
+		atomic.AddInt64(&t.owed, over)
+		return 0
+	}
+	if 0 != weight {
+		weight += takeOwed(&t.owed)
+	}
+	return weight
+}
+
+// takeOwed zeroes and returns what's owed, only writing if anything is, as
+// it's nothing unless updates are limited per second.
+func takeOwed(owed *int64) int64 {
+	if 0 == atomic.LoadInt64(owed) {
+		return 0
+	}
+	return atomic.SwapInt64(owed, 0)
+}
@@ -0,0 +1,100 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSampledCounterEvery(t *testing.T) {
+	c := NewSampledCounter(NewCounter(), Sampling{Every: 10})
+	for i := 0; i < 100000; i++ {
+		c.Inc(2)
+	}
+	if count := c.Count(); count < 160000 || 240000 < count {
+		t.Errorf("c.Count(): 200000 != %v\n", count)
+	}
+	if count := c.Snapshot().Count(); c.Count() != count {
+		t.Errorf("c.Snapshot().Count(): %v != %v\n", c.Count(), count)
+	}
+}
+
+func TestSampledCounterEveryOne(t *testing.T) {
+	c := NewSampledCounter(NewCounter(), Sampling{})
+	c.Inc(3)
+	c.Dec(1)
+	if count := c.Count(); 2 != count {
+		t.Errorf("c.Count(): 2 != %v\n", count)
+	}
+}
+
+func TestSampledCounterPerSecond(t *testing.T) {
+	clock := &stepClock{now: time.Unix(100, 0)}
+	SetClock(clock)
+	defer SetClock(nil)
+	wrapped := NewCounter()
+	c := NewSampledCounter(wrapped, Sampling{PerSecond: 100})
+	for i := 0; i < 1000; i++ {
+		c.Inc(1)
+	}
+	if count := wrapped.Count(); 100 != count {
+		t.Errorf("wrapped.Count(): 100 != %v\n", count)
+	}
+	if count := c.Count(); 1000 != count {
+		t.Errorf("c.Count(): 1000 != %v\n", count)
+	}
+
+	clock.now = clock.now.Add(time.Second)
+	for i := 0; i < 10000; i++ {
+		c.Inc(1)
+	}
+	if every := c.sampler.every; 10 != every {
+		t.Errorf("every: 10 != %v\n", every)
+	}
+	if count := c.Count(); count < 8000 || 14000 < count {
+		t.Errorf("c.Count(): 11000 != %v\n", count)
+	}
+}
+
+func TestSampledTimer(t *testing.T) {
+	wrapped := NewTimer()
+	tm := NewSampledTimer(wrapped, Sampling{Every: 4})
+	for i := 0; i < 40000; i++ {
+		tm.Update(time.Millisecond)
+	}
+	if count := tm.Count(); count < 32000 || 48000 < count {
+		t.Errorf("tm.Count(): 40000 != %v\n", count)
+	}
+	if max := tm.Max(); int64(time.Millisecond) != max {
+		t.Errorf("tm.Max(): %v != %v\n", time.Millisecond, max)
+	}
+	calls := 0
+	for i := 0; i < 100; i++ {
+		tm.Time(func() { calls++ })
+	}
+	if 100 != calls {
+		t.Errorf("calls: 100 != %v\n", calls)
+	}
+}
+
+func TestSampledTimerPerSecond(t *testing.T) {
+	clock := &stepClock{now: time.Unix(100, 0)}
+	SetClock(clock)
+	defer SetClock(nil)
+	tm := NewSampledTimer(NewTimer(), Sampling{PerSecond: 10})
+	for i := 0; i < 15; i++ {
+		tm.Update(time.Millisecond)
+	}
+	if count := tm.Count(); 10 != count {
+		t.Errorf("tm.Count(): 10 != %v\n", count)
+	}
+	// The first update of the next second, chosen 1 in 1, adapts every to 2
+	// for the 15 updates a second and is recorded with the 5 owed.
+	clock.now = clock.now.Add(time.Second)
+	tm.Update(time.Millisecond)
+	if count := tm.Count(); 10+5+1 != count {
+		t.Errorf("tm.Count(): 16 != %v\n", count)
+	}
+	if every := tm.sampler.every; 2 != every {
+		t.Errorf("every: 2 != %v\n", every)
+	}
+}
@@ -0,0 +1,313 @@
+package metrics
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// Aggregate returns a copy of the snapshots with the given tag keys, e.g.
+// "pod", removed from their names, merging the snapshots of series which then
+// share a name, so that a backend is sent one series where the registry keeps
+// one per pod.  The metrics they were taken of keep every tag.
+//
+// Counters, gauges and meters' counts and rates are summed, as are timers'
+// interval rates, and mergeable gauges' means are weighted by their counts.
+// Histograms and timers merge their samples: exactly if they're all
+// BucketSamples of the same bounds or DDSketchSamples of the same accuracy,
+// otherwise into a sample of all of their values.  Where the series merged
+// aren't all of one type, as well as for healthchecks and metrics of types
+// defined outside this package, the first by name is kept.  Gauges marked by
+// MarkStale are left out of merges unless every one of them is marked, and a
+// merged gauge was last updated when the latest of those merged was.
+func (s *RegistrySnapshot) Aggregate(keys ...string) *RegistrySnapshot {
+	if 0 == len(keys) {
+		return s
+	}
+	var names []string
+	groups := make(map[string][]interface{}, len(s.names))
+	for _, name := range s.names {
+		aggregated := withoutTagKeys(name, keys)
+		if _, ok := groups[aggregated]; !ok {
+			names = append(names, aggregated)
+		}
+		groups[aggregated] = append(groups[aggregated], s.metrics[name])
+	}
+	sort.Strings(names)
+	aggregated := &RegistrySnapshot{
+		names:       names,
+		metrics:     make(map[string]interface{}, len(names)),
+		percentiles: s.percentiles,
+		timestamp:   s.timestamp,
+	}
+	for _, name := range s.names {
+		updated, ok := s.updated[name]
+		if !ok {
+			continue
+		}
+		if nil == aggregated.updated {
+			aggregated.updated = make(map[string]time.Time)
+		}
+		name = withoutTagKeys(name, keys)
+		if updated.After(aggregated.updated[name]) {
+			aggregated.updated[name] = updated
+		}
+	}
+	for _, name := range names {
+		aggregated.metrics[name] = mergeSnapshots(groups[name], keys)
+	}
+	return aggregated
+}
+
+// withoutTagKeys returns the given name without the tags of the given keys.
+func withoutTagKeys(name string, keys []string) string {
+	if -1 == strings.IndexByte(name, ';') {
+		return name
+	}
+	base, tags := SplitTaggedName(name)
+	n := len(tags)
+	for _, key := range keys {
+		delete(tags, key)
+	}
+	if n == len(tags) {
+		return name
+	}
+	return TaggedName(base, tags)
+}
+
+// mergeSnapshots merges snapshots of series which Aggregate has found share a
+// name, without the tags of the given keys.
+func mergeSnapshots(snapshots []interface{}, keys []string) interface{} {
+	if 1 == len(snapshots) {
+		return snapshots[0]
+	}
+	var live []interface{}
+	for _, i := range snapshots {
+		if !isStale(i) {
+			live = append(live, i)
+		}
+	}
+	if 0 == len(live) {
+		return snapshots[0]
+	}
+	snapshots = live
+	if 1 == len(snapshots) {
+		return snapshots[0]
+	}
+	switch first := snapshots[0].(type) {
+	case Counter:
+		var (
+			count     int64
+			timestamp time.Time
+		)
+		for _, i := range snapshots {
+			if c, ok := i.(Counter); ok {
+				count += c.Count()
+				timestamp = latest(timestamp, i)
+			}
+		}
+		return CounterSnapshot{count: count, timestamp: timestamp}
+	case CounterFloat64:
+		var (
+			count     float64
+			timestamp time.Time
+		)
+		for _, i := range snapshots {
+			if c, ok := i.(CounterFloat64); ok {
+				count += c.Count()
+				timestamp = latest(timestamp, i)
+			}
+		}
+		return CounterFloat64Snapshot{count: count, timestamp: timestamp}
+	case Gauge:
+		var (
+			value     int64
+			timestamp time.Time
+		)
+		for _, i := range snapshots {
+			if g, ok := i.(Gauge); ok {
+				value += g.Value()
+				timestamp = latest(timestamp, i)
+			}
+		}
+		return GaugeSnapshot{value: value, timestamp: timestamp}
+	case GaugeFloat64:
+		var (
+			value     float64
+			timestamp time.Time
+		)
+		for _, i := range snapshots {
+			if g, ok := i.(GaugeFloat64); ok {
+				value += g.Value()
+				timestamp = latest(timestamp, i)
+			}
+		}
+		return GaugeFloat64Snapshot{value: value, timestamp: timestamp}
+	case Histogram:
+		var histograms []Histogram
+		for _, i := range snapshots {
+			if h, ok := i.(Histogram); ok {
+				histograms = append(histograms, h)
+			}
+		}
+		return mergeHistograms(histograms, keys)
+	case Meter:
+		var meters []Meter
+		for _, i := range snapshots {
+			if m, ok := i.(Meter); ok {
+				meters = append(meters, m)
+			}
+		}
+		return mergeMeters(meters, keys)
+	case MergeableGaugeFloat64:
+		merged := &MergeableGaugeFloat64Snapshot{}
+		var sum float64
+		for _, i := range snapshots {
+			if g, ok := i.(MergeableGaugeFloat64); ok {
+				merged.count += g.Count()
+				sum += g.Value() * float64(g.Count())
+				merged.timestamp = latest(merged.timestamp, i)
+			}
+		}
+		if 0 != merged.count {
+			merged.value = sum / float64(merged.count)
+		}
+		return merged
+	case *TimerSnapshot:
+		var histograms []Histogram
+		var meters []Meter
+		merged := &TimerSnapshot{tags: first.tags.Without(keys...)}
+		for _, i := range snapshots {
+			if t, ok := i.(*TimerSnapshot); ok {
+				histograms = append(histograms, t.histogram)
+				meters = append(meters, t.meter)
+				merged.exemplars = append(merged.exemplars, t.exemplars...)
+				merged.intervalRate += t.intervalRate
+				merged.timestamp = latest(merged.timestamp, t)
+			}
+		}
+		merged.histogram = mergeHistograms(histograms, keys)
+		merged.meter = mergeMeters(meters, keys)
+		return merged
+	}
+	return snapshots[0]
+}
+
+// mergeHistograms merges the samples of histogram snapshots.
+func mergeHistograms(histograms []Histogram, keys []string) *HistogramSnapshot {
+	merged := &HistogramSnapshot{}
+	samples := make([]Sample, len(histograms))
+	for i, h := range histograms {
+		samples[i] = h.Sample()
+		merged.timestamp = latest(merged.timestamp, h)
+	}
+	merged.sample = mergeSamples(samples)
+	if t, ok := histograms[0].(interface{ Tags() Tags }); ok {
+		merged.tags = t.Tags().Without(keys...)
+	}
+	return merged
+}
+
+// mergeSamples merges read-only samples exactly if they're all bucket
+// samples of the same bounds, sketches of the same accuracy or exponential
+// samples, and otherwise into a SampleSnapshot of all of their values.
+func mergeSamples(samples []Sample) Sample {
+	if first, ok := samples[0].(*BucketSampleSnapshot); ok {
+		c := bucketCounts{
+			bounds:  first.bounds,
+			buckets: make([]uint64, len(first.buckets)),
+			min:     first.min,
+			max:     first.max,
+		}
+		exact := true
+		for _, s := range samples {
+			b, ok := s.(*BucketSampleSnapshot)
+			if !ok || !sameBounds(c.bounds, b.bounds) {
+				exact = false
+				break
+			}
+			for i, n := range b.buckets {
+				c.buckets[i] += n
+			}
+			c.count += b.count
+			c.sum += b.sum
+			c.sumSq += b.sumSq
+			if b.min < c.min {
+				c.min = b.min
+			}
+			if b.max > c.max {
+				c.max = b.max
+			}
+		}
+		if exact {
+			return &BucketSampleSnapshot{bucketCounts: c}
+		}
+	}
+	if first, ok := samples[0].(sketchSample); ok {
+		c := first.sketch()
+		exact := true
+		for _, s := range samples[1:] {
+			sk, ok := s.(sketchSample)
+			if !ok {
+				exact = false
+				break
+			}
+			other := sk.sketch()
+			if nil != c.merge(&other) {
+				exact = false
+				break
+			}
+		}
+		if exact {
+			return &DDSketchSampleSnapshot{ddSketch: c}
+		}
+	}
+	if first, ok := samples[0].(exponentialSample); ok {
+		h := first.exponential()
+		exact := true
+		for _, s := range samples[1:] {
+			e, ok := s.(exponentialSample)
+			if !ok {
+				exact = false
+				break
+			}
+			other := e.exponential()
+			h.merge(&other)
+		}
+		if exact {
+			return &ExponentialSampleSnapshot{expHistogram: h}
+		}
+	}
+	merged := &SampleSnapshot{sum: &runningSum{}}
+	for _, s := range samples {
+		merged.count += s.Count()
+		merged.sum.add(s.Sum())
+		merged.values = append(merged.values, s.Values()...)
+	}
+	return merged
+}
+
+// mergeMeters sums the counts and rates of meter snapshots.
+func mergeMeters(meters []Meter, keys []string) *MeterSnapshot {
+	merged := &MeterSnapshot{}
+	for _, m := range meters {
+		merged.count += m.Count()
+		merged.rate1 += m.Rate1()
+		merged.rate5 += m.Rate5()
+		merged.rate15 += m.Rate15()
+		merged.rateMean += m.RateMean()
+		merged.timestamp = latest(merged.timestamp, m)
+	}
+	if t, ok := meters[0].(interface{ Tags() Tags }); ok {
+		merged.tags = t.Tags().Without(keys...)
+	}
+	return merged
+}
+
+// latest returns the later of t and the time the given snapshot was taken.
+func latest(t time.Time, i interface{}) time.Time {
+	if taken := SnapshotTime(i, t); taken.After(t) {
+		return taken
+	}
+	return t
+}
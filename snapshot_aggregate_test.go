@@ -0,0 +1,82 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRegistrySnapshotAggregate(t *testing.T) {
+	r := NewRegistry()
+	for _, pod := range []string{"a", "b"} {
+		tags := map[string]string{"pod": pod, "route": "/users"}
+		GetOrRegisterCounterT("requests", tags, r).Inc(2)
+		GetOrRegisterGaugeT("queue", tags, r).Update(3)
+		GetOrRegisterMeterT("hits", tags, r).Mark(4)
+		GetOrRegisterTimerT("latency", tags, r).Update(time.Second)
+		h := GetOrRegisterHistogramT("size", tags, r, NewBucketSample([]float64{10}))
+		h.Update(5)
+		GetOrRegisterMergeableGaugeFloat64T("load", tags, r).Update(map[string]float64{"a": 1, "b": 3}[pod])
+	}
+	NewRegisteredCounter("other", r).Inc(1)
+
+	s := r.Snapshot().Aggregate("pod")
+	if names := s.Names(); 7 != len(names) {
+		t.Fatalf("Names(): %v\n", names)
+	}
+	if c := s.Get("requests;route=/users").(Counter).Count(); 4 != c {
+		t.Errorf("requests: 4 != %v\n", c)
+	}
+	if v := s.Get("queue;route=/users").(Gauge).Value(); 6 != v {
+		t.Errorf("queue: 6 != %v\n", v)
+	}
+	if c := s.Get("hits;route=/users").(Meter).Count(); 8 != c {
+		t.Errorf("hits: 8 != %v\n", c)
+	}
+	latency := s.Get("latency;route=/users").(Timer)
+	if c, max := latency.Count(), latency.Max(); 2 != c || int64(time.Second) != max {
+		t.Errorf("latency: %v, %v\n", c, max)
+	}
+	size := s.Get("size;route=/users").(Histogram)
+	if b := BucketBounds(size); 1 != len(b) {
+		t.Errorf("size: BucketBounds(): %v, want the merged BucketSample's\n", b)
+	}
+	if c, sum := size.Count(), size.Sum(); 2 != c || 10 != sum {
+		t.Errorf("size: %v, %v\n", c, sum)
+	}
+	if v := s.Get("load;route=/users").(MergeableGaugeFloat64).Value(); 2 != v {
+		t.Errorf("load: 2 != %v\n", v)
+	}
+	if nil == s.Get("other") {
+		t.Error("other: missing\n")
+	}
+	if c := r.Get("requests;pod=a;route=/users").(Counter).Count(); 2 != c {
+		t.Errorf("registry's requests: 2 != %v\n", c)
+	}
+}
+
+func TestRegistrySnapshotAggregateMixedSamples(t *testing.T) {
+	r := NewRegistry()
+	GetOrRegisterHistogramT("size", map[string]string{"pod": "a"}, r, NewUniformSample(10)).Update(1)
+	GetOrRegisterHistogramT("size", map[string]string{"pod": "b"}, r, NewBucketSample([]float64{10})).Update(3)
+	h := r.Snapshot().Aggregate("pod").Get("size").(Histogram)
+	if c, sum, max := h.Count(), h.Sum(), h.Max(); 2 != c || 4 != sum || 3 < max {
+		t.Errorf("size: %v, %v, %v\n", c, sum, max)
+	}
+}
+
+func TestMultiReporterAggregateTags(t *testing.T) {
+	r := NewRegistry()
+	GetOrRegisterCounterT("requests", map[string]string{"pod": "a"}, r).Inc(1)
+	GetOrRegisterCounterT("requests", map[string]string{"pod": "b"}, r).Inc(2)
+	var buf bytes.Buffer
+	m := NewMultiReporter(r)
+	m.Add(NewEncodingReporter(r, TextEncoder{}, &buf), ReporterFilter{AggregateTags: []string{"pod"}})
+	if err := m.Flush(); nil != err {
+		t.Fatal(err)
+	}
+	if got := buf.String(); strings.Contains(got, "pod") || !strings.Contains(got, "3") {
+		t.Errorf("flushed: %q\n", got)
+	}
+}
@@ -0,0 +1,164 @@
+package metrics
+
+// A SnapshotBuffer takes snapshots of every metric in a registry into
+// snapshots it keeps from one call to the next, so that a reporter flushing
+// thousands of metrics every few seconds stops allocating once the buffer has
+// grown to fit them.  Counters, gauges, histograms, meters and timers of the
+// standard types are read by their ReadInto methods, which is why counters
+// and gauges are passed as pointers to their snapshots, e.g. a
+// *CounterSnapshot; other metrics are snapshotted as EachSnapshot would.
+//
+// The snapshots passed to f are only valid until the next call, which
+// overwrites them; a reporter which keeps them, e.g. to send them from
+// another goroutine, must take them with EachSnapshot instead.  A
+// SnapshotBuffer isn't safe for concurrent use.  The zero value is ready to
+// use.
+type SnapshotBuffer struct {
+	entries    map[string]*snapshotEntry // by registered name
+	names      []string
+	metrics    []interface{}
+	order      []*snapshotEntry
+	generation uint64
+}
+
+// snapshotEntry is the snapshot a SnapshotBuffer keeps of one metric.
+type snapshotEntry struct {
+	metric     interface{} // read into snapshot, or nil if it's snapshotted anew
+	snapshot   interface{}
+	defaults   string // the suffix of the default tags merged into name
+	name       string
+	generation uint64 // of the last call which saw the metric
+}
+
+// EachSnapshot calls f with a snapshot of each metric in r, or in
+// DefaultRegistry if r is nil, with the default tags of the registry at the
+// root of r merged into its name, as r.EachSnapshot would.  The snapshots are
+// all taken before f is first called, and no lock is held while f runs.
+func (b *SnapshotBuffer) EachSnapshot(r Registry, f func(string, interface{})) {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	if nil == b.entries {
+		b.entries = make(map[string]*snapshotEntry)
+	}
+	b.generation++
+	defaults := defaultTagsOf(r)
+	b.names, b.metrics = appendRegistered(r, b.names[:0], b.metrics[:0])
+	b.order = b.order[:0]
+	for i, name := range b.names {
+		e, ok := b.entries[name]
+		if !ok {
+			e = &snapshotEntry{}
+			b.entries[name] = e
+			e.name = withDefaultTags(name, defaults)
+			e.defaults = defaults.String()
+		} else if e.defaults != defaults.String() {
+			e.name = withDefaultTags(name, defaults)
+			e.defaults = defaults.String()
+		}
+		e.generation = b.generation
+		e.read(b.metrics[i])
+		b.metrics[i] = nil
+		b.order = append(b.order, e)
+	}
+	for name, e := range b.entries {
+		if e.generation != b.generation {
+			delete(b.entries, name)
+		}
+	}
+	for _, e := range b.order {
+		f(e.name, e.snapshot)
+	}
+}
+
+// read snapshots i, reading it into the entry's snapshot if that was taken of
+// the same metric by the same method.
+func (e *snapshotEntry) read(i interface{}) {
+	reader, ok := i.(snapshotReader)
+	if !ok {
+		e.metric, e.snapshot = nil, snapshotMetric(i)
+		return
+	}
+	if e.metric != i {
+		e.metric, e.snapshot = i, nil
+	}
+	e.snapshot = reader.readSnapshot(e.snapshot)
+}
+
+// snapshotReader is implemented by metrics which can read themselves into a
+// snapshot they returned before, or into a new one if that's nil.
+type snapshotReader interface {
+	readSnapshot(interface{}) interface{}
+}
+
+func (c *StandardCounter) readSnapshot(i interface{}) interface{} {
+	s, ok := i.(*CounterSnapshot)
+	if !ok {
+		s = new(CounterSnapshot)
+	}
+	c.ReadInto(s)
+	return s
+}
+
+func (c *StandardCounterFloat64) readSnapshot(i interface{}) interface{} {
+	s, ok := i.(*CounterFloat64Snapshot)
+	if !ok {
+		s = new(CounterFloat64Snapshot)
+	}
+	c.ReadInto(s)
+	return s
+}
+
+func (g *StandardGauge) readSnapshot(i interface{}) interface{} {
+	s, ok := i.(*GaugeSnapshot)
+	if !ok {
+		s = new(GaugeSnapshot)
+	}
+	g.ReadInto(s)
+	return s
+}
+
+func (g *StandardGaugeFloat64) readSnapshot(i interface{}) interface{} {
+	s, ok := i.(*GaugeFloat64Snapshot)
+	if !ok {
+		s = new(GaugeFloat64Snapshot)
+	}
+	g.ReadInto(s)
+	return s
+}
+
+func (h *StandardHistogram) readSnapshot(i interface{}) interface{} {
+	s, ok := i.(*HistogramSnapshot)
+	if !ok {
+		s = &HistogramSnapshot{}
+	}
+	h.ReadInto(s)
+	return s
+}
+
+func (h *GCPauseHistogram) readSnapshot(i interface{}) interface{} {
+	s, ok := i.(*HistogramSnapshot)
+	if !ok {
+		s = &HistogramSnapshot{}
+	}
+	h.ReadInto(s)
+	return s
+}
+
+func (m *StandardMeter) readSnapshot(i interface{}) interface{} {
+	s, ok := i.(*MeterSnapshot)
+	if !ok {
+		s = &MeterSnapshot{}
+	}
+	m.ReadInto(s)
+	return s
+}
+
+func (t *StandardTimer) readSnapshot(i interface{}) interface{} {
+	s, ok := i.(*TimerSnapshot)
+	if !ok {
+		s = &TimerSnapshot{}
+	}
+	t.ReadInto(s)
+	return s
+}
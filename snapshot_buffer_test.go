@@ -0,0 +1,105 @@
+package metrics
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// newFlushBenchmarkRegistry returns a registry of 1000 counters and 100 each
+// of histograms and timers, as a reporter might flush every few seconds.
+func newFlushBenchmarkRegistry() Registry {
+	r := NewRegistry()
+	for i := 0; i < 1000; i++ {
+		GetOrRegisterCounter(fmt.Sprintf("counter%d", i), r).Inc(int64(i))
+	}
+	for i := 0; i < 100; i++ {
+		h := GetOrRegisterHistogram(fmt.Sprintf("histogram%d", i), r, NewExpDecaySample(1028, 0.015))
+		t := GetOrRegisterTimer(fmt.Sprintf("timer%d", i), r)
+		for j := 0; j < 2000; j++ {
+			h.Update(int64(j))
+			t.Update(time.Duration(j))
+		}
+	}
+	return r
+}
+
+func BenchmarkRegistryEachSnapshot(b *testing.B) {
+	r := newFlushBenchmarkRegistry()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r.EachSnapshot(func(string, interface{}) {})
+	}
+}
+
+func BenchmarkSnapshotBuffer(b *testing.B) {
+	r := newFlushBenchmarkRegistry()
+	var buf SnapshotBuffer
+	buf.EachSnapshot(r, func(string, interface{}) {})
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf.EachSnapshot(r, func(string, interface{}) {})
+	}
+}
+
+func TestSnapshotBuffer(t *testing.T) {
+	r := NewRegistry()
+	c := GetOrRegisterCounter("counter", r)
+	h := GetOrRegisterHistogram("histogram", r, NewUniformSample(10))
+	tm := GetOrRegisterTimer("timer", r)
+	GetOrRegisterHealthcheck("healthcheck", r, func(Healthcheck) {})
+	c.Inc(47)
+	h.Update(1)
+	tm.Update(time.Second)
+
+	var buf SnapshotBuffer
+	snapshots := make(map[string]interface{})
+	buf.EachSnapshot(r, func(name string, i interface{}) { snapshots[name] = i })
+	if 4 != len(snapshots) {
+		t.Fatal(snapshots)
+	}
+	if s, ok := snapshots["counter"].(*CounterSnapshot); !ok || 47 != s.Count() {
+		t.Errorf("counter: %v\n", snapshots["counter"])
+	}
+	h.Update(2)
+	var hs Histogram
+	buf.EachSnapshot(r, func(name string, i interface{}) {
+		if "histogram" == name {
+			hs = i.(Histogram)
+		}
+	})
+	if hs != snapshots["histogram"] {
+		t.Errorf("histogram snapshot not reused: %p != %p\n", hs, snapshots["histogram"])
+	}
+	if 2 != hs.Count() || 3 != hs.Sum() {
+		t.Errorf("histogram: count %v, sum %v\n", hs.Count(), hs.Sum())
+	}
+	if 1 != snapshots["timer"].(Timer).Count() {
+		t.Errorf("timer: %v\n", snapshots["timer"].(Timer).Count())
+	}
+
+	r.Unregister("counter")
+	r.(*StandardRegistry).SetDefaultTags(map[string]string{"host": "a"})
+	names := make(map[string]bool)
+	buf.EachSnapshot(r, func(name string, _ interface{}) { names[name] = true })
+	if !names["timer;host=a"] || names["counter;host=a"] || 3 != len(names) {
+		t.Errorf("names: %v\n", names)
+	}
+}
+
+func TestSnapshotBufferAllocs(t *testing.T) {
+	r := NewRegistry()
+	GetOrRegisterCounter("counter", r).Inc(1)
+	GetOrRegisterGaugeFloat64("gauge", r).Update(1.5)
+	GetOrRegisterHistogram("histogram", r, NewExpDecaySample(1028, 0.015)).Update(1)
+	GetOrRegisterMeter("meter", r).Mark(1)
+	GetOrRegisterTimer("timer", r).Update(time.Second)
+	var buf SnapshotBuffer
+	f := func(string, interface{}) {}
+	buf.EachSnapshot(r, f)
+	if n := testing.AllocsPerRun(10, func() { buf.EachSnapshot(r, f) }); 0 != n {
+		t.Errorf("buf.EachSnapshot(): %v allocations\n", n)
+	}
+}
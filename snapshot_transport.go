@@ -0,0 +1,553 @@
+package metrics
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrInvalidSnapshot is returned when decoding bytes which aren't a snapshot
+// encoded by MarshalSnapshot.
+var ErrInvalidSnapshot = errors.New("metrics: invalid snapshot")
+
+// MarshalSnapshot encodes a registry snapshot in a compact binary form for
+// UnmarshalSnapshot to decode, e.g. in a supervisor process collecting the
+// metrics of its workers.  Counters, gauges, meters, histograms and timers are
+// encoded, keeping every value the sample of a histogram or timer holds; a
+// Summary's sketch is encoded whole, so it merges exactly.  Healthchecks and
+// metrics of other types are left out.
+func MarshalSnapshot(s *RegistrySnapshot) ([]byte, error) {
+	records := snapshotRecords(s)
+	b := []byte{snapshotVersion}
+	b = appendVarint(b, int64(len(records)))
+	for i := range records {
+		b = records[i].appendTo(b)
+	}
+	return b, nil
+}
+
+// UnmarshalSnapshot decodes a snapshot encoded by MarshalSnapshot.  The
+// snapshots of histograms and timers hold the values that were encoded as
+// their sample, so their statistics are as they were in the other process.
+func UnmarshalSnapshot(data []byte) (*RegistrySnapshot, error) {
+	if 0 == len(data) || snapshotVersion != data[0] {
+		return nil, ErrInvalidSnapshot
+	}
+	d := binaryDecoder{data: data[1:]}
+	records := make([]snapshotRecord, d.length())
+	for i := range records {
+		records[i].readFrom(&d)
+	}
+	if d.failed || 0 != len(d.data) {
+		return nil, ErrInvalidSnapshot
+	}
+	return newSnapshotOfRecords(records)
+}
+
+// MarshalSnapshotJSON encodes a registry snapshot as JSON for
+// UnmarshalSnapshotJSON to decode, keeping what MarshalSnapshot keeps.  Unlike
+// RegistrySnapshot.MarshalJSON, which renders statistics for people and
+// dashboards, it keeps enough to rebuild the snapshot.
+func MarshalSnapshotJSON(s *RegistrySnapshot) ([]byte, error) {
+	return json.Marshal(snapshotJSON{Metrics: snapshotRecords(s)})
+}
+
+// UnmarshalSnapshotJSON decodes a snapshot encoded by MarshalSnapshotJSON.
+func UnmarshalSnapshotJSON(data []byte) (*RegistrySnapshot, error) {
+	var s snapshotJSON
+	if err := json.Unmarshal(data, &s); nil != err {
+		return nil, err
+	}
+	return newSnapshotOfRecords(s.Metrics)
+}
+
+// SnapshotEncoder is an Encoder of snapshots for a SnapshotDecoder to decode
+// from a stream, such as a pipe from a worker process to its supervisor: each
+// is MarshalSnapshot's encoding preceded by its length as a uvarint or, with
+// JSON set, MarshalSnapshotJSON's followed by a newline.  Give it to an
+// EncodingReporter with Reset set, so that each snapshot holds what
+// accumulated since the last, as a SnapshotMerger expects.
+type SnapshotEncoder struct {
+	JSON bool
+}
+
+// Encode renders s for a SnapshotDecoder.
+func (e SnapshotEncoder) Encode(s *RegistrySnapshot, _ time.Time) ([]byte, error) {
+	if e.JSON {
+		b, err := MarshalSnapshotJSON(s)
+		if nil != err {
+			return nil, err
+		}
+		return append(b, '\n'), nil
+	}
+	b, err := MarshalSnapshot(s)
+	if nil != err {
+		return nil, err
+	}
+	var buf [binary.MaxVarintLen64]byte
+	return append(buf[:binary.PutUvarint(buf[:], uint64(len(b)))], b...), nil
+}
+
+// SnapshotDecoder decodes the snapshots a SnapshotEncoder writes to a
+// stream, one at a time.
+type SnapshotDecoder struct {
+	json   *json.Decoder
+	reader *bufio.Reader
+}
+
+// NewSnapshotDecoder constructs a new SnapshotDecoder reading snapshots from
+// r, encoded as JSON if asJSON is true or else in the binary form.
+func NewSnapshotDecoder(r io.Reader, asJSON bool) *SnapshotDecoder {
+	if asJSON {
+		return &SnapshotDecoder{json: json.NewDecoder(r)}
+	}
+	return &SnapshotDecoder{reader: bufio.NewReader(r)}
+}
+
+// Decode returns the next snapshot, or io.EOF at the end of the stream.
+func (d *SnapshotDecoder) Decode() (*RegistrySnapshot, error) {
+	if nil != d.json {
+		var s snapshotJSON
+		if err := d.json.Decode(&s); nil != err {
+			return nil, err
+		}
+		return newSnapshotOfRecords(s.Metrics)
+	}
+	n, err := binary.ReadUvarint(d.reader)
+	if nil != err {
+		return nil, err
+	}
+	// Read through a LimitReader, so that a corrupt length runs out of
+	// stream rather than memory.
+	b, err := ioutil.ReadAll(io.LimitReader(d.reader, int64(n)))
+	if nil != err {
+		return nil, err
+	}
+	if uint64(len(b)) != n {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return UnmarshalSnapshot(b)
+}
+
+// A SnapshotMerger merges the snapshots of several sources, such as worker
+// processes, into one registry, for export as though all of their metrics
+// had been recorded in it.  Each snapshot should hold what accumulated since
+// the source's last, as a reporter with Reset set sends: counters, histograms
+// and timers are added to the registry's, and the values of gauges replace
+// its.  Meters aren't reset, so the merger marks the registry's by how much
+// each source's count has grown since its last snapshot, taking a fall, as
+// when a worker restarts, for a count from zero.
+//
+// Giving each source a tag of its own, e.g. worker=3 among its registry's
+// default tags, keeps its series apart; otherwise those of every source are
+// merged, and gauges hold whichever value came last.
+type SnapshotMerger struct {
+	registry Registry
+
+	mutex  sync.Mutex
+	meters map[string]map[string]int64 // Counts by name by source
+}
+
+// NewSnapshotMerger constructs a new SnapshotMerger merging into r, or into
+// DefaultRegistry if r is nil.
+func NewSnapshotMerger(r Registry) *SnapshotMerger {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	return &SnapshotMerger{registry: r, meters: make(map[string]map[string]int64)}
+}
+
+// Forget drops what the merger knows of the given source, e.g. once a worker
+// has exited, so that its next snapshot, if any, counts in full.
+func (m *SnapshotMerger) Forget(source string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	delete(m.meters, source)
+}
+
+// Merge merges a snapshot from the given source into the registry.  A metric
+// registered already with another type isn't merged, and the first such is
+// returned as an error; every other metric is merged regardless.
+func (m *SnapshotMerger) Merge(source string, s *RegistrySnapshot) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	counts := m.meters[source]
+	if nil == counts {
+		counts = make(map[string]int64)
+		m.meters[source] = counts
+	}
+	var err error
+	s.Each(func(name string, i interface{}) {
+		if e := m.merge(counts, name, i); nil != e && nil == err {
+			err = e
+		}
+	})
+	return err
+}
+
+func (m *SnapshotMerger) merge(counts map[string]int64, name string, i interface{}) error {
+	r := m.registry
+	base, tags := SplitTaggedName(name)
+	var existing interface{}
+	switch s := i.(type) {
+	case Counter:
+		if c, ok := getOrRegisterTagged(r, base, tags, func() interface{} { return NewCounter() }, NilCounter{}).(Counter); ok {
+			c.Inc(s.Count())
+			return nil
+		}
+	case CounterFloat64:
+		if c, ok := getOrRegisterTagged(r, base, tags, func() interface{} { return NewCounterFloat64() }, NilCounterFloat64{}).(CounterFloat64); ok {
+			c.Inc(s.Count())
+			return nil
+		}
+	case Gauge:
+		if g, ok := getOrRegisterTagged(r, base, tags, func() interface{} { return NewGauge() }, NilGauge{}).(Gauge); ok {
+			g.Update(s.Value())
+			return nil
+		}
+	case GaugeFloat64:
+		if g, ok := getOrRegisterTagged(r, base, tags, func() interface{} { return NewGaugeFloat64() }, NilGaugeFloat64{}).(GaugeFloat64); ok {
+			g.Update(s.Value())
+			return nil
+		}
+	case MergeableGaugeFloat64:
+		if g, ok := getOrRegisterTagged(r, base, tags, func() interface{} { return NewMergeableGaugeFloat64() }, NilMergeableGaugeFloat64{}).(MergeableGaugeFloat64); ok {
+			g.Merge(s)
+			return nil
+		}
+	case Meter:
+		if meter, ok := getOrRegisterTagged(r, base, tags, func() interface{} { return NewMeter() }, NilMeter{}).(Meter); ok {
+			count := s.Count()
+			delta := count - counts[name]
+			if delta < 0 {
+				delta = count
+			}
+			counts[name] = count
+			meter.Mark(delta)
+			return nil
+		}
+	case Histogram:
+		sample := s.Sample()
+		newMetric := func() interface{} { return NewHistogram(NewExpDecaySample(1028, 0.015)) }
+		sk, isSketch := sample.(sketchSample)
+		if isSketch {
+			alpha := sk.sketch().alpha
+			newMetric = func() interface{} { return NewSummary(alpha) }
+		}
+		existing = getOrRegisterTagged(r, base, tags, newMetric, NilHistogram{})
+		if sum, ok := existing.(Summary); ok && isSketch {
+			return sum.Merge(s)
+		}
+		if h, ok := existing.(Histogram); ok {
+			replaySample(sample, h.UpdateN)
+			return nil
+		}
+	case *TimerSnapshot:
+		if t, ok := getOrRegisterTagged(r, base, tags, func() interface{} { return newTimerIn(name, r) }, NilTimer{}).(Timer); ok {
+			replaySample(s.histogram.Sample(), func(v, n int64) { t.UpdateN(time.Duration(v), n) })
+			return nil
+		}
+	default:
+		return nil
+	}
+	if nil == existing {
+		existing = r.Get(name)
+	}
+	return fmt.Errorf("metrics: can't merge a %T into %s, a %T", i, name, existing)
+}
+
+// replaySample records the values s stands for by calls to updateN: those a
+// sketch counted or, for samples keeping a selection of values, each of those
+// weighted so that the counts add up to s.Count().
+func replaySample(s Sample, updateN func(v, n int64)) {
+	if sk, ok := s.(sketchSample); ok {
+		c := sk.sketch()
+		c.eachValueOf(c.each, updateN)
+		return
+	}
+	values := s.Values()
+	if 0 == len(values) {
+		return
+	}
+	q, r := s.Count()/int64(len(values)), s.Count()%int64(len(values))
+	for i, v := range values {
+		n := q
+		if int64(i) < r {
+			n++
+		}
+		if n > 0 {
+			updateN(v, n)
+		}
+	}
+}
+
+// snapshotVersion is the first byte of an encoded snapshot.
+const snapshotVersion = 1
+
+// snapshotJSON is the form MarshalSnapshotJSON encodes.
+type snapshotJSON struct {
+	Metrics []snapshotRecord `json:"metrics"`
+}
+
+// snapshotRecord is the encoded form of a snapshot of one metric.  Which
+// fields are used depends on the type.
+type snapshotRecord struct {
+	Name   string    `json:"name"`
+	Type   string    `json:"type"`
+	Count  int64     `json:"count,omitempty"`  // Of counters, meters and the values of histograms, timers and mergeable gauges
+	Value  int64     `json:"value,omitempty"`  // Of gauges, or the count of a timer's meter
+	Float  float64   `json:"float,omitempty"`  // Of float counters and gauges, and mergeable gauges' means
+	Rates  []float64 `json:"rates,omitempty"`  // One, five and fifteen minute and mean rates, then a timer's interval rate
+	Sum    int64     `json:"sum,omitempty"`    // Of the values of histograms and timers
+	Values []int64   `json:"values,omitempty"` // Of the samples of histograms and timers
+	Sketch []byte    `json:"sketch,omitempty"` // Of a histogram or timer whose sample is a DDSketchSample
+}
+
+// snapshotRecords returns the records of the snapshots in s of the types
+// MarshalSnapshot encodes.
+func snapshotRecords(s *RegistrySnapshot) []snapshotRecord {
+	records := make([]snapshotRecord, 0, s.Len())
+	s.Each(func(name string, i interface{}) {
+		record := snapshotRecord{Name: name}
+		switch m := i.(type) {
+		case Counter:
+			record.Type, record.Count = "counter", m.Count()
+		case CounterFloat64:
+			record.Type, record.Float = "counterfloat64", m.Count()
+		case Gauge:
+			record.Type, record.Value = "gauge", m.Value()
+		case GaugeFloat64:
+			record.Type, record.Float = "gaugefloat64", m.Value()
+		case MergeableGaugeFloat64:
+			record.Type, record.Count, record.Float = "mergeablegaugefloat64", m.Count(), m.Value()
+		case Meter:
+			record.Type, record.Count = "meter", m.Count()
+			record.Rates = []float64{m.Rate1(), m.Rate5(), m.Rate15(), m.RateMean()}
+		case Histogram:
+			record.Type = "histogram"
+			record.setSample(m.Sample())
+		case *TimerSnapshot:
+			record.Type, record.Value = "timer", m.meter.Count()
+			record.Rates = []float64{m.Rate1(), m.Rate5(), m.Rate15(), m.RateMean(), m.IntervalRate()}
+			record.setSample(m.histogram.Sample())
+		default:
+			return
+		}
+		records = append(records, record)
+	})
+	return records
+}
+
+func (record *snapshotRecord) setSample(s Sample) {
+	record.Count, record.Sum = s.Count(), s.Sum()
+	if sk, ok := s.(sketchSample); ok {
+		c := sk.sketch()
+		record.Sketch, _ = c.MarshalBinary()
+		return
+	}
+	record.Values = s.Values()
+}
+
+// sample returns the snapshot of the sample the record holds.
+func (record *snapshotRecord) sample() (Sample, error) {
+	if 0 != len(record.Sketch) {
+		return UnmarshalDDSketchSample(record.Sketch)
+	}
+	return &SampleSnapshot{
+		count:  record.Count,
+		sum:    &runningSum{hi: record.Sum >> 63, lo: uint64(record.Sum)},
+		values: record.Values,
+	}, nil
+}
+
+// snapshot returns the snapshot of a metric the record holds.
+func (record *snapshotRecord) snapshot() (interface{}, error) {
+	_, tags := SplitTaggedName(record.Name)
+	switch record.Type {
+	case "counter":
+		return CounterSnapshot{count: record.Count}, nil
+	case "counterfloat64":
+		return CounterFloat64Snapshot{count: record.Float}, nil
+	case "gauge":
+		return GaugeSnapshot{value: record.Value}, nil
+	case "gaugefloat64":
+		return GaugeFloat64Snapshot{value: record.Float}, nil
+	case "mergeablegaugefloat64":
+		return &MergeableGaugeFloat64Snapshot{count: record.Count, value: record.Float}, nil
+	case "meter":
+		if 4 != len(record.Rates) {
+			return nil, ErrInvalidSnapshot
+		}
+		return &MeterSnapshot{
+			count:    record.Count,
+			rate1:    record.Rates[0],
+			rate5:    record.Rates[1],
+			rate15:   record.Rates[2],
+			rateMean: record.Rates[3],
+			tags:     NewTags(tags),
+		}, nil
+	case "histogram":
+		s, err := record.sample()
+		if nil != err {
+			return nil, err
+		}
+		return &HistogramSnapshot{sample: s, tags: NewTags(tags)}, nil
+	case "timer":
+		if 5 != len(record.Rates) {
+			return nil, ErrInvalidSnapshot
+		}
+		s, err := record.sample()
+		if nil != err {
+			return nil, err
+		}
+		t := NewTags(tags)
+		return &TimerSnapshot{
+			histogram: &HistogramSnapshot{sample: s, tags: t},
+			meter: &MeterSnapshot{
+				count:    record.Value,
+				rate1:    record.Rates[0],
+				rate5:    record.Rates[1],
+				rate15:   record.Rates[2],
+				rateMean: record.Rates[3],
+				tags:     t,
+			},
+			intervalRate: record.Rates[4],
+			tags:         t,
+		}, nil
+	}
+	return nil, fmt.Errorf("metrics: unknown type %q of %s in snapshot", record.Type, record.Name)
+}
+
+// newSnapshotOfRecords returns the RegistrySnapshot of the metrics the given
+// records hold.
+func newSnapshotOfRecords(records []snapshotRecord) (*RegistrySnapshot, error) {
+	s := &RegistrySnapshot{metrics: make(map[string]interface{}, len(records))}
+	for i := range records {
+		name := TaggedName(records[i].Name, nil)
+		if _, ok := s.metrics[name]; ok {
+			return nil, fmt.Errorf("metrics: %s is in snapshot twice", name)
+		}
+		i, err := records[i].snapshot()
+		if nil != err {
+			return nil, err
+		}
+		s.names = append(s.names, name)
+		s.metrics[name] = i
+	}
+	sort.Strings(s.names)
+	return s, nil
+}
+
+func (record *snapshotRecord) appendTo(b []byte) []byte {
+	b = appendString(b, record.Name)
+	b = appendString(b, record.Type)
+	b = appendVarint(b, record.Count)
+	b = appendVarint(b, record.Value)
+	b = appendUint64(b, math.Float64bits(record.Float))
+	b = appendVarint(b, int64(len(record.Rates)))
+	for _, rate := range record.Rates {
+		b = appendUint64(b, math.Float64bits(rate))
+	}
+	b = appendVarint(b, record.Sum)
+	b = appendVarint(b, int64(len(record.Values)))
+	for _, v := range record.Values {
+		b = appendVarint(b, v)
+	}
+	b = appendVarint(b, int64(len(record.Sketch)))
+	return append(b, record.Sketch...)
+}
+
+func (record *snapshotRecord) readFrom(d *binaryDecoder) {
+	record.Name = string(d.bytes())
+	record.Type = string(d.bytes())
+	record.Count = d.varint()
+	record.Value = d.varint()
+	record.Float = math.Float64frombits(d.uint64())
+	if n := d.length(); 0 != n {
+		record.Rates = make([]float64, n)
+		for i := range record.Rates {
+			record.Rates[i] = math.Float64frombits(d.uint64())
+		}
+	}
+	record.Sum = d.varint()
+	if n := d.length(); 0 != n {
+		record.Values = make([]int64, n)
+		for i := range record.Values {
+			record.Values[i] = d.varint()
+		}
+	}
+	if sketch := d.bytes(); 0 != len(sketch) {
+		record.Sketch = append([]byte(nil), sketch...)
+	}
+}
+
+func appendString(b []byte, s string) []byte {
+	b = appendVarint(b, int64(len(s)))
+	return append(b, s...)
+}
+
+func appendUint64(b []byte, u uint64) []byte {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], u)
+	return append(b, buf[:]...)
+}
+
+func appendVarint(b []byte, v int64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(b, buf[:binary.PutVarint(buf[:], v)]...)
+}
+
+// binaryDecoder reads what the append functions appended, recording rather
+// than returning failures so that what's decoded is checked once it's all
+// read.
+type binaryDecoder struct {
+	data   []byte
+	failed bool
+}
+
+// bytes reads a length and that many bytes, which alias the data.
+func (d *binaryDecoder) bytes() []byte {
+	n := d.length()
+	b := d.data[:n]
+	d.data = d.data[n:]
+	return b
+}
+
+// length reads the length of what follows.  Everything encoded takes at least
+// a byte, which bounds a corrupt length by what's left.
+func (d *binaryDecoder) length() int {
+	n := d.varint()
+	if n < 0 || n > int64(len(d.data)) {
+		d.failed = true
+		return 0
+	}
+	return int(n)
+}
+
+func (d *binaryDecoder) uint64() uint64 {
+	if len(d.data) < 8 {
+		d.failed = true
+		return 0
+	}
+	u := binary.BigEndian.Uint64(d.data)
+	d.data = d.data[8:]
+	return u
+}
+
+func (d *binaryDecoder) varint() int64 {
+	v, n := binary.Varint(d.data)
+	if n <= 0 {
+		d.failed = true
+		return 0
+	}
+	d.data = d.data[n:]
+	return v
+}
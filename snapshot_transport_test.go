@@ -0,0 +1,193 @@
+package metrics
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+)
+
+func newTransportTestRegistry() Registry {
+	r := NewRegistry()
+	GetOrRegisterCounter("counter", r).Inc(3)
+	GetOrRegisterCounterFloat64("counterfloat64", r).Inc(1.5)
+	GetOrRegisterGauge("gauge", r).Update(-7)
+	GetOrRegisterGaugeFloat64("gaugefloat64", r).Update(2.25)
+	GetOrRegisterMergeableGaugeFloat64("mergeable", r).Update(4)
+	GetOrRegisterMeterT("meter", map[string]string{"host": "a"}, r).Mark(5)
+	h := GetOrRegisterHistogram("histogram", r, NewUniformSample(100))
+	for i := int64(1); i <= 10; i++ {
+		h.Update(i)
+	}
+	s := GetOrRegisterSummary("summary", r, 0.01)
+	for i := int64(1); i <= 1000; i++ {
+		s.Update(i)
+	}
+	GetOrRegisterTimer("timer", r).Update(time.Second)
+	r.Register("healthcheck", NewHealthcheck(func(Healthcheck) {}))
+	return r
+}
+
+func testTransportedSnapshot(t *testing.T, s *RegistrySnapshot) {
+	if 9 != s.Len() {
+		t.Fatalf("s.Names(): %v\n", s.Names())
+	}
+	if c := s.Get("counter").(Counter); 3 != c.Count() {
+		t.Errorf("counter: %v\n", c.Count())
+	}
+	if c := s.Get("counterfloat64").(CounterFloat64); 1.5 != c.Count() {
+		t.Errorf("counterfloat64: %v\n", c.Count())
+	}
+	if g := s.Get("gauge").(Gauge); -7 != g.Value() {
+		t.Errorf("gauge: %v\n", g.Value())
+	}
+	if g := s.Get("gaugefloat64").(GaugeFloat64); 2.25 != g.Value() {
+		t.Errorf("gaugefloat64: %v\n", g.Value())
+	}
+	if g := s.Get("mergeable").(MergeableGaugeFloat64); 1 != g.Count() || 4 != g.Value() {
+		t.Errorf("mergeable: %v %v\n", g.Count(), g.Value())
+	}
+	if m := s.Get("meter;host=a").(Meter); 5 != m.Count() || "a" != m.(Taggable).GetTags()["host"] {
+		t.Errorf("meter: %v %v\n", m.Count(), m.(Taggable).GetTags())
+	}
+	if h := s.Get("histogram").(Histogram); 10 != h.Count() || 55 != h.Sum() || 5.5 != h.Mean() || 10 != h.Max() {
+		t.Errorf("histogram: %v %v %v %v\n", h.Count(), h.Sum(), h.Mean(), h.Max())
+	}
+	if h := s.Get("summary").(Histogram); 1000 != h.Count() || 500500 != h.Sum() {
+		t.Errorf("summary: %v %v\n", h.Count(), h.Sum())
+	} else if _, ok := h.Sample().(*DDSketchSampleSnapshot); !ok {
+		t.Errorf("summary: %T\n", h.Sample())
+	}
+	if tm := s.Get("timer").(Timer); 1 != tm.Count() || int64(time.Second) != tm.Max() {
+		t.Errorf("timer: %v %v\n", tm.Count(), tm.Max())
+	}
+}
+
+func TestMarshalSnapshot(t *testing.T) {
+	b, err := MarshalSnapshot(newTransportTestRegistry().Snapshot())
+	if nil != err {
+		t.Fatal(err)
+	}
+	s, err := UnmarshalSnapshot(b)
+	if nil != err {
+		t.Fatal(err)
+	}
+	testTransportedSnapshot(t, s)
+	for i := range b {
+		if _, err := UnmarshalSnapshot(b[:i]); nil == err {
+			t.Errorf("UnmarshalSnapshot(b[:%d]) didn't fail\n", i)
+		}
+	}
+}
+
+func TestMarshalSnapshotJSON(t *testing.T) {
+	b, err := MarshalSnapshotJSON(newTransportTestRegistry().Snapshot())
+	if nil != err {
+		t.Fatal(err)
+	}
+	s, err := UnmarshalSnapshotJSON(b)
+	if nil != err {
+		t.Fatal(err)
+	}
+	testTransportedSnapshot(t, s)
+	if _, err := UnmarshalSnapshotJSON([]byte(`{"metrics":[{"name":"foo","type":"bar"}]}`)); nil == err {
+		t.Error("decoding an unknown type didn't fail")
+	}
+}
+
+func TestSnapshotDecoder(t *testing.T) {
+	for _, asJSON := range []bool{false, true} {
+		var buf bytes.Buffer
+		reporter := NewEncodingReporter(newTransportTestRegistry(), SnapshotEncoder{JSON: asJSON}, &buf)
+		reporter.Reset = true
+		for i := 0; i < 2; i++ {
+			if err := reporter.Flush(); nil != err {
+				t.Fatal(err)
+			}
+		}
+		d := NewSnapshotDecoder(&buf, asJSON)
+		s, err := d.Decode()
+		if nil != err {
+			t.Fatal(err)
+		}
+		testTransportedSnapshot(t, s)
+		if s, err = d.Decode(); nil != err {
+			t.Fatal(err)
+		}
+		if c := s.Get("counter").(Counter); 0 != c.Count() {
+			t.Errorf("counter after reset: %v\n", c.Count())
+		}
+		if _, err := d.Decode(); io.EOF != err {
+			t.Errorf("d.Decode() at the end: %v\n", err)
+		}
+	}
+}
+
+func TestSnapshotMerger(t *testing.T) {
+	r := NewRegistry()
+	m := NewSnapshotMerger(r)
+	workers := []Registry{newTransportTestRegistry(), newTransportTestRegistry()}
+	for _, source := range []string{"a", "b"} {
+		w := workers[0]
+		if "b" == source {
+			w = workers[1]
+		}
+		if err := m.Merge(source, newRegistrySnapshotAndReset(w)); nil != err {
+			t.Fatal(err)
+		}
+	}
+	if c := r.Get("counter").(Counter); 6 != c.Count() {
+		t.Errorf("counter: %v\n", c.Count())
+	}
+	if g := r.Get("gauge").(Gauge); -7 != g.Value() {
+		t.Errorf("gauge: %v\n", g.Value())
+	}
+	if g := r.Get("mergeable").(MergeableGaugeFloat64); 2 != g.Count() || 4 != g.Value() {
+		t.Errorf("mergeable: %v %v\n", g.Count(), g.Value())
+	}
+	if h := r.Get("histogram").(Histogram); 20 != h.Count() || 110 != h.Sum() {
+		t.Errorf("histogram: %v %v\n", h.Count(), h.Sum())
+	}
+	if s, ok := r.Get("summary").(Summary); !ok || 2000 != s.Count() || 1001000 != s.Sum() {
+		t.Errorf("summary: %#v\n", r.Get("summary"))
+	}
+	if tm := r.Get("timer").(Timer); 2 != tm.Count() || int64(time.Second) != tm.Min() {
+		t.Errorf("timer: %v %v\n", tm.Count(), tm.Min())
+	}
+	if _, ok := r.Get("healthcheck").(Healthcheck); ok {
+		t.Error("healthcheck merged")
+	}
+
+	// Meters carry on, so only the growth since a source's last counts.
+	GetOrRegisterMeterT("meter", map[string]string{"host": "a"}, workers[0]).Mark(2)
+	if err := m.Merge("a", newRegistrySnapshotAndReset(workers[0])); nil != err {
+		t.Fatal(err)
+	}
+	if meter := r.Get("meter;host=a").(Meter); 12 != meter.Count() {
+		t.Errorf("meter: %v\n", meter.Count())
+	}
+	if c := r.Get("counter").(Counter); 6 != c.Count() {
+		t.Errorf("counter after merging a reset snapshot: %v\n", c.Count())
+	}
+	m.Forget("a")
+	if err := m.Merge("a", newRegistrySnapshotAndReset(workers[0])); nil != err {
+		t.Fatal(err)
+	}
+	if meter := r.Get("meter;host=a").(Meter); 19 != meter.Count() {
+		t.Errorf("meter after Forget: %v\n", meter.Count())
+	}
+}
+
+func TestSnapshotMergerTypeMismatch(t *testing.T) {
+	r := NewRegistry()
+	GetOrRegisterGauge("counter", r)
+	src := NewRegistry()
+	GetOrRegisterCounter("counter", src).Inc(1)
+	GetOrRegisterCounter("other", src).Inc(1)
+	if err := NewSnapshotMerger(r).Merge("a", src.Snapshot()); nil == err {
+		t.Error("merging a counter into a gauge didn't fail")
+	}
+	if c := r.Get("other").(Counter); 1 != c.Count() {
+		t.Errorf("other: %v\n", c.Count())
+	}
+}
@@ -0,0 +1,177 @@
+package metrics
+
+import (
+	"fmt"
+	"sort"
+)
+
+// MetricSpec declares a metric to be constructed and registered by
+// RegisterFromSpec.  The struct tags allow a slice of MetricSpecs to be
+// decoded directly from JSON or, by the caller, from YAML.
+type MetricSpec struct {
+	Name string `json:"name" yaml:"name"`
+
+	// Tags identify the series along with Name, as the tags given to
+	// GetOrRegisterCounterT and the like do.
+	Tags map[string]string `json:"tags,omitempty" yaml:"tags,omitempty"`
+
+	// Type is one of "counter", "gauge", "gaugefloat64",
+	// "mergeablegaugefloat64", "histogram", "meter" or "timer".
+	Type string `json:"type" yaml:"type"`
+
+	// Description and Unit document the metric.  They're not interpreted by
+	// this package.
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+	Unit        string `json:"unit,omitempty" yaml:"unit,omitempty"`
+
+	// Percentiles lists the percentiles of interest for histograms and
+	// timers.  Each must lie in the interval [0, 1].  Exporters report them
+	// of this metric alone, along with those they report of every histogram
+	// and timer; see MetricPercentiles.
+	Percentiles []float64 `json:"percentiles,omitempty" yaml:"percentiles,omitempty"`
+
+	// Sample selects the reservoir backing a histogram or timer, either
+	// "expdecay" (the default) or "uniform".  ReservoirSize and Alpha
+	// default to 1028 and 0.015, the values used by NewTimer.
+	Sample        string  `json:"sample,omitempty" yaml:"sample,omitempty"`
+	ReservoirSize int     `json:"reservoir_size,omitempty" yaml:"reservoir_size,omitempty"`
+	Alpha         float64 `json:"alpha,omitempty" yaml:"alpha,omitempty"`
+}
+
+// RegisterFromSpec constructs and registers a metric for each of the given
+// specs and returns them keyed by the name TaggedName gives them, which is
+// the spec's name if it has no tags.  All specs are validated before
+// anything is registered; if registration of any metric fails, those already
+// registered by this call are unregistered again so that the registry is left
+// as it was found.
+func RegisterFromSpec(specs []MetricSpec, r Registry) (map[string]interface{}, error) {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	seen := make(map[string]bool, len(specs))
+	for i, spec := range specs {
+		if err := spec.validate(); nil != err {
+			return nil, fmt.Errorf("metric spec %d (%q): %v", i, spec.Name, err)
+		}
+		name := TaggedName(spec.Name, spec.Tags)
+		if seen[name] {
+			return nil, fmt.Errorf("metric spec %d: duplicate name %q", i, name)
+		}
+		seen[name] = true
+	}
+	handles := make(map[string]interface{}, len(specs))
+	for _, spec := range specs {
+		t := NewTags(spec.Tags)
+		name := t.Name(spec.Name)
+		m := spec.newMetric()
+		applyTags(m, t)
+		if err := r.Register(name, m); nil != err {
+			for name := range handles {
+				r.Unregister(name)
+			}
+			return nil, fmt.Errorf("metric %q: %v", name, err)
+		}
+		handles[name] = m
+	}
+	return handles, nil
+}
+
+// mergePercentiles returns the union of ps and more, sorted.
+func mergePercentiles(ps, more []float64) []float64 {
+	seen := make(map[float64]bool, len(ps)+len(more))
+	merged := make([]float64, 0, len(ps)+len(more))
+	for _, p := range append(append([]float64{}, ps...), more...) {
+		if !seen[p] {
+			seen[p] = true
+			merged = append(merged, p)
+		}
+	}
+	sort.Float64s(merged)
+	return merged
+}
+
+func (spec *MetricSpec) validate() error {
+	if "" == spec.Name {
+		return fmt.Errorf("missing name")
+	}
+	switch spec.Type {
+	case "counter", "gauge", "gaugefloat64", "mergeablegaugefloat64", "meter":
+		if 0 != len(spec.Percentiles) {
+			return fmt.Errorf("percentiles not supported by type %q", spec.Type)
+		}
+		if "" != spec.Sample || 0 != spec.ReservoirSize || 0 != spec.Alpha {
+			return fmt.Errorf("sample not supported by type %q", spec.Type)
+		}
+	case "histogram", "timer":
+		for _, p := range spec.Percentiles {
+			if p < 0 || p > 1 {
+				return fmt.Errorf("percentile %v out of range [0, 1]", p)
+			}
+		}
+		switch spec.Sample {
+		case "", "expdecay":
+		case "uniform":
+			if 0 != spec.Alpha {
+				return fmt.Errorf("alpha not supported by sample %q", spec.Sample)
+			}
+		default:
+			return fmt.Errorf("unknown sample %q", spec.Sample)
+		}
+		if spec.ReservoirSize < 0 {
+			return fmt.Errorf("negative reservoir size %d", spec.ReservoirSize)
+		}
+		if spec.Alpha < 0 {
+			return fmt.Errorf("negative alpha %v", spec.Alpha)
+		}
+	case "":
+		return fmt.Errorf("missing type")
+	default:
+		return fmt.Errorf("unknown type %q", spec.Type)
+	}
+	return nil
+}
+
+func (spec *MetricSpec) newMetric() interface{} {
+	switch spec.Type {
+	case "counter":
+		return NewCounter()
+	case "gauge":
+		return NewGauge()
+	case "gaugefloat64":
+		return NewGaugeFloat64()
+	case "mergeablegaugefloat64":
+		return NewMergeableGaugeFloat64()
+	case "histogram":
+		return spec.newHistogram()
+	case "meter":
+		return NewMeter()
+	case "timer":
+		return NewCustomTimer(spec.newHistogram(), NewMeter())
+	}
+	return nil
+}
+
+// newHistogram returns a histogram, or the histogram of a timer, which
+// declares the spec's percentiles.
+func (spec *MetricSpec) newHistogram() Histogram {
+	h := NewHistogram(spec.newSample())
+	if s, ok := h.(*StandardHistogram); ok && 0 != len(spec.Percentiles) {
+		s.percentiles = mergePercentiles(nil, spec.Percentiles)
+	}
+	return h
+}
+
+func (spec *MetricSpec) newSample() Sample {
+	reservoirSize := spec.ReservoirSize
+	if 0 == reservoirSize {
+		reservoirSize = 1028
+	}
+	if "uniform" == spec.Sample {
+		return NewUniformSample(reservoirSize)
+	}
+	alpha := spec.Alpha
+	if 0 == alpha {
+		alpha = 0.015
+	}
+	return NewExpDecaySample(reservoirSize, alpha)
+}
@@ -0,0 +1,164 @@
+package metrics
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRegisterFromSpec(t *testing.T) {
+	var specs []MetricSpec
+	if err := json.Unmarshal([]byte(`[
+		{"name": "requests", "type": "counter", "description": "Requests served"},
+		{"name": "queue.depth", "type": "gauge"},
+		{"name": "latency", "type": "timer", "unit": "ns", "percentiles": [0.5, 0.99]},
+		{"name": "sizes", "type": "histogram", "sample": "uniform", "reservoir_size": 100}
+	]`), &specs); nil != err {
+		t.Fatal(err)
+	}
+	r := NewRegistry()
+	handles, err := RegisterFromSpec(specs, r)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 4 != len(handles) {
+		t.Fatal(handles)
+	}
+	if _, ok := handles["requests"].(Counter); !ok {
+		t.Fatal(handles["requests"])
+	}
+	if _, ok := handles["latency"].(Timer); !ok {
+		t.Fatal(handles["latency"])
+	}
+	h, ok := handles["sizes"].(Histogram)
+	if !ok {
+		t.Fatal(handles["sizes"])
+	}
+	if _, ok := h.Sample().(*UniformSample); !ok {
+		t.Fatal(h.Sample())
+	}
+	if r.Get("queue.depth") != handles["queue.depth"] {
+		t.Fatal(r.Get("queue.depth"))
+	}
+}
+
+func TestRegisterFromSpecInvalid(t *testing.T) {
+	for _, specs := range [][]MetricSpec{
+		{{Type: "counter"}},
+		{{Name: "foo"}},
+		{{Name: "foo", Type: "countre"}},
+		{{Name: "foo", Type: "counter", Percentiles: []float64{0.5}}},
+		{{Name: "foo", Type: "timer", Percentiles: []float64{99}}},
+		{{Name: "foo", Type: "histogram", Sample: "reservoir"}},
+		{{Name: "foo", Type: "counter"}, {Name: "foo", Type: "gauge"}},
+	} {
+		r := NewRegistry()
+		if _, err := RegisterFromSpec(specs, r); nil == err {
+			t.Errorf("RegisterFromSpec(%v): expected error", specs)
+		}
+		i := 0
+		r.Each(func(string, interface{}) { i++ })
+		if 0 != i {
+			t.Errorf("RegisterFromSpec(%v): registered %d metrics", specs, i)
+		}
+	}
+}
+
+func TestRegisterFromSpecDuplicateRollsBack(t *testing.T) {
+	r := NewRegistry()
+	r.Register("bar", NewGauge())
+	if _, err := RegisterFromSpec([]MetricSpec{
+		{Name: "foo", Type: "counter"},
+		{Name: "bar", Type: "counter"},
+	}, r); nil == err {
+		t.Fatal(err)
+	}
+	if nil != r.Get("foo") {
+		t.Fatal(r.Get("foo"))
+	}
+	if _, ok := r.Get("bar").(Gauge); !ok {
+		t.Fatal(r.Get("bar"))
+	}
+}
+
+func TestRegisterFromSpecTags(t *testing.T) {
+	r := NewRegistry()
+	handles, err := RegisterFromSpec([]MetricSpec{
+		{Name: "requests", Type: "counter", Tags: map[string]string{"method": "GET"}},
+		{Name: "requests", Type: "counter", Tags: map[string]string{"method": "POST"}},
+	}, r)
+	if nil != err {
+		t.Fatal(err)
+	}
+	get := GetOrRegisterCounterT("requests", map[string]string{"method": "GET"}, r)
+	if handles["requests;method=GET"] != get {
+		t.Fatalf("GetOrRegisterCounterT(): %v != %v\n", handles["requests;method=GET"], get)
+	}
+	if tags := get.(Taggable).GetTags(); "GET" != tags["method"] {
+		t.Errorf("tags: %v\n", tags)
+	}
+	if nil == handles["requests;method=POST"] || nil != r.Get("requests") {
+		t.Errorf("handles: %v\n", handles)
+	}
+	if _, err := RegisterFromSpec([]MetricSpec{
+		{Name: "requests", Type: "counter", Tags: map[string]string{"method": "GET"}},
+	}, r); nil == err {
+		t.Error("RegisterFromSpec(): want an error for a registered series\n")
+	}
+}
+
+func TestRegisterFromSpecPercentiles(t *testing.T) {
+	r := NewRegistry()
+	handles, err := RegisterFromSpec([]MetricSpec{
+		{Name: "latency", Type: "timer", Percentiles: []float64{0.999, 0.1}},
+		{Name: "sizes", Type: "histogram", Percentiles: []float64{0.2}},
+	}, r)
+	if nil != err {
+		t.Fatal(err)
+	}
+	other := GetOrRegisterHistogram("other", r, NewUniformSample(10))
+	if ps := RegistryPercentiles(r); !reflect.DeepEqual(DefaultPercentiles, ps) {
+		t.Errorf("RegistryPercentiles(): %v != %v\n", DefaultPercentiles, ps)
+	}
+	ps := []float64{0.5, 0.999}
+	for _, c := range []struct {
+		metric interface{}
+		want   []float64
+	}{
+		{handles["latency"].(Timer).Snapshot(), []float64{0.1, 0.5, 0.999}},
+		{handles["latency"], []float64{0.1, 0.5, 0.999}},
+		{handles["sizes"].(Histogram).Snapshot(), []float64{0.2, 0.5, 0.999}},
+		{other.Snapshot(), ps},
+	} {
+		if got := MetricPercentiles(ps, c.metric); !reflect.DeepEqual(c.want, got) {
+			t.Errorf("MetricPercentiles(%T): %v != %v\n", c.metric, c.want, got)
+		}
+	}
+}
+
+func TestRegisterFromSpecPercentilesExported(t *testing.T) {
+	r := NewRegistry()
+	if _, err := RegisterFromSpec([]MetricSpec{
+		{Name: "sizes", Type: "histogram", Percentiles: []float64{0.2}},
+	}, r); nil != err {
+		t.Fatal(err)
+	}
+	GetOrRegisterHistogram("other", r, NewUniformSample(10))
+	points, err := graphitePoints(&GraphiteConfig{DurationUnit: time.Nanosecond, Percentiles: []float64{0.5}, Prefix: "p", Registry: r}, time.Now())
+	if nil != err {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, p := range points {
+		if strings.HasSuffix(p.path, "-percentile") {
+			paths = append(paths, p.path)
+		}
+	}
+	sort.Strings(paths)
+	if want := []string{"p.other.50-percentile", "p.sizes.20-percentile", "p.sizes.50-percentile"}; !reflect.DeepEqual(want, paths) {
+		t.Errorf("percentiles: %v != %v\n", want, paths)
+	}
+}
@@ -0,0 +1,161 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// DBMetrics wraps a *sql.DB to time its queries and statements and count
+// their errors, and updates gauges of its connection pool from DB.Stats(),
+// all tagged with db=<name>.  Queries are timed as sql.latency and their
+// errors counted as sql.errors, tagged op=exec, op=query, op=query_row or
+// op=prepare.  Statements run in transactions or through prepared statements
+// go straight to the database and aren't recorded; preparing them is.
+//
+// The pool gauges are sql.connections.max_open, sql.connections.open,
+// sql.connections.in_use, sql.connections.idle, sql.wait.count,
+// sql.wait.seconds, sql.closed.max_idle, sql.closed.max_idle_time and
+// sql.closed.max_lifetime, named after the fields of sql.DBStats.
+type DBMetrics struct {
+	*sql.DB
+
+	ops map[string]dbOpMetrics
+
+	maxOpen, open, inUse, idle       Gauge
+	waitCount                        Gauge
+	waitSeconds                      GaugeFloat64
+	maxIdleClosed, maxIdleTimeClosed Gauge
+	maxLifetimeClosed                Gauge
+}
+
+type dbOpMetrics struct {
+	latency Timer
+	errors  Counter
+}
+
+// RegisterDBMetrics registers the metrics of the database db, tagged with
+// the given name, in r and returns the DBMetrics which records them.
+func RegisterDBMetrics(db *sql.DB, name string, r Registry) *DBMetrics {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	tags := map[string]string{"db": name}
+	gauge := func(name string) Gauge { return GetOrRegisterGaugeT(name, tags, r) }
+	m := &DBMetrics{
+		DB:                db,
+		ops:               make(map[string]dbOpMetrics),
+		maxOpen:           gauge("sql.connections.max_open"),
+		open:              gauge("sql.connections.open"),
+		inUse:             gauge("sql.connections.in_use"),
+		idle:              gauge("sql.connections.idle"),
+		waitCount:         gauge("sql.wait.count"),
+		waitSeconds:       GetOrRegisterGaugeFloat64T("sql.wait.seconds", tags, r),
+		maxIdleClosed:     gauge("sql.closed.max_idle"),
+		maxIdleTimeClosed: gauge("sql.closed.max_idle_time"),
+		maxLifetimeClosed: gauge("sql.closed.max_lifetime"),
+	}
+	for _, op := range []string{"exec", "query", "query_row", "prepare"} {
+		opTags := map[string]string{"db": name, "op": op}
+		m.ops[op] = dbOpMetrics{
+			latency: GetOrRegisterTimerT("sql.latency", opTags, r),
+			errors:  GetOrRegisterCounterT("sql.errors", opTags, r),
+		}
+	}
+	m.Capture()
+	return m
+}
+
+// Capture reads the statistics of the connection pool and updates the
+// gauges.
+func (m *DBMetrics) Capture() {
+	s := m.DB.Stats()
+	m.maxOpen.Update(int64(s.MaxOpenConnections))
+	m.open.Update(int64(s.OpenConnections))
+	m.inUse.Update(int64(s.InUse))
+	m.idle.Update(int64(s.Idle))
+	m.waitCount.Update(s.WaitCount)
+	m.waitSeconds.Update(s.WaitDuration.Seconds())
+	m.maxIdleClosed.Update(s.MaxIdleClosed)
+	m.maxIdleTimeClosed.Update(s.MaxIdleTimeClosed)
+	m.maxLifetimeClosed.Update(s.MaxLifetimeClosed)
+}
+
+// CaptureEvery calls Capture every d until stop is closed.  This is designed
+// to be called as a goroutine.
+func (m *DBMetrics) CaptureEvery(d time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(d)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			m.Capture()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Exec executes a query without returning any rows, timing it.
+func (m *DBMetrics) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return m.ExecContext(context.Background(), query, args...)
+}
+
+// ExecContext executes a query without returning any rows, timing it.
+func (m *DBMetrics) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	start := time.Now()
+	result, err := m.DB.ExecContext(ctx, query, args...)
+	m.record("exec", start, err)
+	return result, err
+}
+
+// Prepare creates a prepared statement, timing its preparation.
+func (m *DBMetrics) Prepare(query string) (*sql.Stmt, error) {
+	return m.PrepareContext(context.Background(), query)
+}
+
+// PrepareContext creates a prepared statement, timing its preparation.
+func (m *DBMetrics) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	start := time.Now()
+	stmt, err := m.DB.PrepareContext(ctx, query)
+	m.record("prepare", start, err)
+	return stmt, err
+}
+
+// Query executes a query returning rows, timing it until the rows are ready
+// to be read.
+func (m *DBMetrics) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return m.QueryContext(context.Background(), query, args...)
+}
+
+// QueryContext executes a query returning rows, timing it until the rows are
+// ready to be read.
+func (m *DBMetrics) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	start := time.Now()
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	m.record("query", start, err)
+	return rows, err
+}
+
+// QueryRow executes a query expected to return at most one row, timing it.
+func (m *DBMetrics) QueryRow(query string, args ...interface{}) *sql.Row {
+	return m.QueryRowContext(context.Background(), query, args...)
+}
+
+// QueryRowContext executes a query expected to return at most one row,
+// timing it.  sql.ErrNoRows, which Scan returns when there is none, isn't
+// counted as an error.
+func (m *DBMetrics) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	start := time.Now()
+	row := m.DB.QueryRowContext(ctx, query, args...)
+	m.record("query_row", start, row.Err())
+	return row
+}
+
+func (m *DBMetrics) record(op string, start time.Time, err error) {
+	om := m.ops[op]
+	om.latency.UpdateSince(start)
+	if nil != err {
+		om.errors.Inc(1)
+	}
+}
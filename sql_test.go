@@ -0,0 +1,108 @@
+package metrics
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"testing"
+)
+
+// fakeDriver is a database/sql driver whose statements succeed unless their
+// query is "fail", and whose queries return a single row.
+type fakeDriver struct{}
+
+func (fakeDriver) Open(string) (driver.Conn, error) { return fakeConn{}, nil }
+
+type fakeConn struct{}
+
+func (fakeConn) Begin() (driver.Tx, error) { return nil, errors.New("unsupported") }
+func (fakeConn) Close() error              { return nil }
+func (fakeConn) Prepare(query string) (driver.Stmt, error) {
+	if "fail" == query {
+		return nil, errors.New("fail")
+	}
+	return fakeStmt{}, nil
+}
+
+type fakeStmt struct{}
+
+func (fakeStmt) Close() error                               { return nil }
+func (fakeStmt) Exec([]driver.Value) (driver.Result, error) { return driver.RowsAffected(1), nil }
+func (fakeStmt) NumInput() int                              { return -1 }
+func (fakeStmt) Query([]driver.Value) (driver.Rows, error)  { return &fakeRows{}, nil }
+
+type fakeRows struct{ done bool }
+
+func (*fakeRows) Close() error      { return nil }
+func (*fakeRows) Columns() []string { return []string{"n"} }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0] = int64(47)
+	return nil
+}
+
+func init() {
+	sql.Register("metrics-fake", fakeDriver{})
+}
+
+func TestDBMetrics(t *testing.T) {
+	db, err := sql.Open("metrics-fake", "")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(3)
+	r := NewRegistry()
+	m := RegisterDBMetrics(db, "users", r)
+
+	if _, err := m.Exec("insert"); nil != err {
+		t.Fatal(err)
+	}
+	if _, err := m.Exec("fail"); nil == err {
+		t.Fatal("no error")
+	}
+	var n int64
+	if err := m.QueryRow("select").Scan(&n); nil != err || 47 != n {
+		t.Fatal(n, err)
+	}
+	rows, err := m.Query("select")
+	if nil != err {
+		t.Fatal(err)
+	}
+	m.Capture()
+	if v := r.Get("sql.connections.in_use;db=users").(Gauge).Value(); 1 != v {
+		t.Errorf("in_use: 1 != %v\n", v)
+	}
+	rows.Close()
+	m.Capture()
+
+	for name, want := range map[string]int64{
+		"sql.latency;db=users;op=exec":      2,
+		"sql.latency;db=users;op=query":     1,
+		"sql.latency;db=users;op=query_row": 1,
+	} {
+		if tm := r.Get(name).(Timer); want != tm.Count() {
+			t.Errorf("%s: %v != %v\n", name, want, tm.Count())
+		}
+	}
+	if c := r.Get("sql.errors;db=users;op=exec").(Counter); 1 != c.Count() {
+		t.Errorf("exec errors: 1 != %v\n", c.Count())
+	}
+	if c := r.Get("sql.errors;db=users;op=query").(Counter); 0 != c.Count() {
+		t.Errorf("query errors: 0 != %v\n", c.Count())
+	}
+	for name, want := range map[string]int64{
+		"sql.connections.max_open;db=users": 3,
+		"sql.connections.in_use;db=users":   0,
+		"sql.connections.idle;db=users":     1,
+		"sql.connections.open;db=users":     1,
+	} {
+		if v := r.Get(name).(Gauge).Value(); want != v {
+			t.Errorf("%s: %v != %v\n", name, want, v)
+		}
+	}
+}
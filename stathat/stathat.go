@@ -2,6 +2,7 @@
 package stathat
 
 import (
+	"context"
 	"github.com/rcrowley/go-metrics"
 	"github.com/stathat/go"
 	"log"
@@ -9,12 +10,19 @@ import (
 )
 
 func Stathat(r metrics.Registry, d time.Duration, userkey string) {
-	for {
+	StathatContext(context.Background(), r, d, userkey)
+}
+
+// StathatContext posts the metrics in r at once and then every d until ctx
+// is done, when it posts a final time, or r is closed.
+func StathatContext(ctx context.Context, r metrics.Registry, d time.Duration, userkey string) {
+	post := func(time.Time) {
 		if err := sh(r, userkey); nil != err {
 			log.Println(err)
 		}
-		time.Sleep(d)
 	}
+	post(time.Now())
+	metrics.FlushSchedule{}.RunContext(ctx, d, metrics.Closed(r), post)
 }
 
 func sh(r metrics.Registry, userkey string) error {
@@ -26,6 +34,10 @@ func sh(r metrics.Registry, userkey string) error {
 			stathat.PostEZValue(name, userkey, float64(metric.Value()))
 		case metrics.GaugeFloat64:
 			stathat.PostEZValue(name, userkey, float64(metric.Value()))
+		case metrics.MergeableGaugeFloat64:
+			g := metric.Snapshot()
+			stathat.PostEZValue(name, userkey, g.Value())
+			stathat.PostEZCount(name+".count", userkey, int(g.Count()))
 		case metrics.Histogram:
 			h := metric.Snapshot()
 			ps := h.Percentiles([]float64{0.5, 0.75, 0.95, 0.99, 0.999})
@@ -0,0 +1,285 @@
+// Package statsd reports the metrics in a go-metrics Registry to StatsD, or to
+// DogStatsD with its tag extension, over UDP.
+package statsd
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+// DefaultMaxPacketSize keeps packets within the usual Ethernet MTU once IP
+// and UDP headers are added.
+const DefaultMaxPacketSize = 1432
+
+// Config configures the StatsD reporter.
+type Config struct {
+	Addr          string           // Network address of the StatsD server, e.g. localhost:8125
+	Registry      metrics.Registry // Registry to be exported
+	FlushInterval time.Duration    // Flush interval
+	Prefix        string           // Prefix for every metric name, joined with a dot
+	Percentiles   []float64        // Percentiles of histograms, exported as gauges, or nil for the registry's
+
+	// Schedule aligns and jitters the flushes of Run within FlushInterval.
+	Schedule metrics.FlushSchedule
+
+	// DogStatsD appends each metric's tags, and Tags, in the DogStatsD
+	// extension, "|#key:value,key:value".  Otherwise tags are appended to
+	// the metric name as two more components, the key and then the value,
+	// sorted by key.
+	DogStatsD bool
+
+	// Tags are added to every metric sent to DogStatsD.  The metric's own
+	// tags override them.
+	Tags map[string]string
+
+	// SampleRate, if between zero and one, sends each counter and timer
+	// line that fraction of flushes, chosen at random, marked "|@rate" so
+	// that the server scales up what it receives.  Gauges are always sent.
+	SampleRate float64
+
+	// MaxPacketSize is the most bytes of lines, separated by newlines, sent
+	// in one packet.  A single longer line is dropped, and counted as such
+	// by Metrics, rather than be sent in a packet the network would have to
+	// fragment.  Zero means DefaultMaxPacketSize.
+	MaxPacketSize int
+
+	// OnError is called with the error of every flush of Run which fails,
+	// instead of logging it.
+	OnError func(error)
+
+	// Metrics, if set, records every Flush, counting the lines longer than
+	// MaxPacketSize and those of packets which fail to be written as dropped.
+	Metrics *metrics.ReporterMetrics
+}
+
+// Reporter sends the metrics in a registry to StatsD.  Counters and meters are
+// sent as "|c" with their change in count since the previous flush, gauges as
+// "|g", and timers as "|ms" with their mean duration in milliseconds in each
+// flush in which they recorded something.  Histograms are sent as gauges of
+// their mean and percentiles.
+type Reporter struct {
+	c      Config
+	conn   net.Conn
+	mutex  sync.Mutex
+	counts map[string]int64
+	random func() float64
+}
+
+// NewReporter returns a Reporter sending to c.Addr.
+func NewReporter(c Config) (*Reporter, error) {
+	conn, err := net.Dial("udp", c.Addr)
+	if nil != err {
+		return nil, err
+	}
+	return &Reporter{
+		c:      c,
+		conn:   conn,
+		counts: make(map[string]int64),
+		random: rand.New(rand.NewSource(time.Now().UnixNano())).Float64,
+	}, nil
+}
+
+// StatsD is a blocking exporter function which reports metrics in c.Registry to
+// StatsD every c.FlushInterval, passing errors to c.OnError, or logging them.
+func StatsD(c Config) {
+	r, err := NewReporter(c)
+	if nil != err {
+		metrics.ReportError(c.OnError, err)
+		return
+	}
+	defer r.Close()
+	r.Run()
+}
+
+// Close closes the reporter's socket.
+func (r *Reporter) Close() error { return r.conn.Close() }
+
+// Flush sends every metric once, returning the first error writing a packet.
+func (r *Reporter) Flush() error {
+	return r.c.Metrics.Flush(r.flush)
+}
+
+func (r *Reporter) flush() error {
+	var err error
+	for _, packet := range r.packets() {
+		if _, e := r.conn.Write(packet); nil != e {
+			r.c.Metrics.Drop(bytes.Count(packet, []byte("\n")) + 1)
+			if nil == err {
+				err = e
+			}
+		}
+	}
+	return err
+}
+
+// Run flushes every c.FlushInterval, passing errors to c.OnError, or logging
+// them, until c.Registry is closed.
+func (r *Reporter) Run() {
+	r.RunContext(context.Background())
+}
+
+// RunContext is Run until ctx is done, when it flushes a final time before
+// returning, so that a service shutting down sends what it counted since the
+// last flush.
+func (r *Reporter) RunContext(ctx context.Context) {
+	r.c.Schedule.RunContext(ctx, r.c.FlushInterval, metrics.Closed(r.c.Registry), func(time.Time) {
+		metrics.ReportError(r.c.OnError, r.Flush())
+	})
+}
+
+// packets renders every metric and packs the lines into packets, dropping
+// those which don't fit in one.
+func (r *Reporter) packets() [][]byte {
+	max := r.c.MaxPacketSize
+	if max <= 0 {
+		max = DefaultMaxPacketSize
+	}
+	packets, dropped := metrics.PackLines(r.lines(), max)
+	r.c.Metrics.Drop(dropped)
+	return packets
+}
+
+// lines renders every metric in the registry, one StatsD line per value.
+func (r *Reporter) lines() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	var lines []string
+	seen := make(map[string]bool)
+	percentiles := r.c.Percentiles
+	if nil == percentiles {
+		percentiles = metrics.RegistryPercentiles(r.c.Registry)
+	}
+	r.c.Registry.EachSnapshot(func(name string, i interface{}) {
+		base, tags := metrics.SplitTaggedName(name)
+		line := func(field, value, typ string, sampled bool) {
+			if sampled && !r.sampled() {
+				return
+			}
+			l := r.name(base, field, tags) + ":" + value + "|" + typ
+			if sampled && r.c.SampleRate > 0 && r.c.SampleRate < 1 {
+				l += "|@" + strconv.FormatFloat(r.c.SampleRate, 'g', -1, 64)
+			}
+			lines = append(lines, l+r.tagSuffix(tags))
+		}
+		gauge := func(field string, v float64) {
+			if v < 0 {
+				// A signed value changes a StatsD gauge rather than set it.
+				line(field, "0", "g", false)
+			}
+			line(field, formatFloat(v), "g", false)
+		}
+		switch metric := i.(type) {
+		case metrics.Counter:
+			seen[name] = true
+			if delta := r.delta(name, metric.Count()); 0 != delta {
+				line("", strconv.FormatInt(delta, 10), "c", true)
+			}
+		case metrics.Gauge:
+			gauge("", float64(metric.Value()))
+		case metrics.GaugeFloat64:
+			gauge("", metric.Value())
+		case metrics.MergeableGaugeFloat64:
+			gauge("", metric.Value())
+		case metrics.Histogram:
+			gauge("mean", metric.Mean())
+			percentiles := metrics.MetricPercentiles(percentiles, metric)
+			ps := metric.Percentiles(percentiles)
+			for i, p := range percentiles {
+				gauge(metrics.PercentileName(p), ps[i])
+			}
+		case metrics.Meter:
+			seen[name] = true
+			if delta := r.delta(name, metric.Count()); 0 != delta {
+				line("", strconv.FormatInt(delta, 10), "c", true)
+			}
+		case metrics.Timer:
+			seen[name] = true
+			if 0 != r.delta(name, metric.Count()) {
+				line("", formatFloat(metric.Mean()/float64(time.Millisecond)), "ms", true)
+			}
+		}
+	})
+	for name := range r.counts {
+		if !seen[name] {
+			delete(r.counts, name)
+		}
+	}
+	return lines
+}
+
+// delta returns the change in the named count since the previous flush.
+func (r *Reporter) delta(name string, count int64) int64 {
+	delta := count - r.counts[name]
+	r.counts[name] = count
+	return delta
+}
+
+func (r *Reporter) sampled() bool {
+	return r.c.SampleRate <= 0 || r.c.SampleRate >= 1 || r.random() < r.c.SampleRate
+}
+
+var (
+	nameReplacer      = strings.NewReplacer(":", "_", "|", "_", "@", "_", "\n", "_")
+	componentReplacer = strings.NewReplacer(":", "_", "|", "_", "@", "_", "\n", "_", ".", "_", " ", "_")
+)
+
+func (r *Reporter) name(base, field string, tags map[string]string) string {
+	name := base
+	if "" != r.c.Prefix {
+		name = r.c.Prefix + "." + name
+	}
+	if !r.c.DogStatsD {
+		for _, k := range sortedKeys(tags) {
+			name += "." + componentReplacer.Replace(k) + "." + componentReplacer.Replace(tags[k])
+		}
+	}
+	if "" != field {
+		name += "." + field
+	}
+	return nameReplacer.Replace(name)
+}
+
+var tagReplacer = strings.NewReplacer(",", "_", "|", "_", "#", "_", "\n", "_")
+
+func (r *Reporter) tagSuffix(tags map[string]string) string {
+	if !r.c.DogStatsD {
+		return ""
+	}
+	merged := make(map[string]string, len(r.c.Tags)+len(tags))
+	for k, v := range r.c.Tags {
+		merged[k] = v
+	}
+	for k, v := range tags {
+		merged[k] = v
+	}
+	if 0 == len(merged) {
+		return ""
+	}
+	pairs := make([]string, 0, len(merged))
+	for _, k := range sortedKeys(merged) {
+		pairs = append(pairs, tagReplacer.Replace(k)+":"+tagReplacer.Replace(merged[k]))
+	}
+	return "|#" + strings.Join(pairs, ",")
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
@@ -0,0 +1,173 @@
+package statsd
+
+import (
+	"net"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+func newTestReporter(t *testing.T, c Config) (*Reporter, net.PacketConn) {
+	l, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if nil != err {
+		t.Fatal(err)
+	}
+	c.Addr = l.LocalAddr().String()
+	r, err := NewReporter(c)
+	if nil != err {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		r.Close()
+		l.Close()
+	})
+	return r, l
+}
+
+func sortedLines(r *Reporter) []string {
+	lines := r.lines()
+	sort.Strings(lines)
+	return lines
+}
+
+func TestLines(t *testing.T) {
+	reg := metrics.NewRegistry()
+	c := metrics.NewCounter()
+	c.(metrics.Taggable).AddTags(map[string]string{"endpoint": "/users"})
+	c.Inc(3)
+	reg.Register("hits", c)
+	metrics.NewRegisteredGauge("depth", reg).Update(7)
+	metrics.NewRegisteredTimer("latency", reg).Update(1500 * time.Microsecond)
+	r, _ := newTestReporter(t, Config{Registry: reg, Prefix: "app"})
+	want := []string{
+		"app.depth:7|g",
+		"app.hits.endpoint./users:3|c",
+		"app.latency:1.5|ms",
+	}
+	if got := sortedLines(r); strings.Join(want, "\n") != strings.Join(got, "\n") {
+		t.Errorf("lines(): %v != %v\n", want, got)
+	}
+
+	// Counters and timers are only sent when they change.
+	c.Inc(2)
+	want = []string{"app.depth:7|g", "app.hits.endpoint./users:2|c"}
+	if got := sortedLines(r); strings.Join(want, "\n") != strings.Join(got, "\n") {
+		t.Errorf("lines(): %v != %v\n", want, got)
+	}
+}
+
+func TestLinesRegistryPercentiles(t *testing.T) {
+	reg := metrics.NewRegistry()
+	if err := reg.(*metrics.StandardRegistry).SetPercentiles([]float64{0.9}); nil != err {
+		t.Fatal(err)
+	}
+	metrics.NewRegisteredHistogram("size", reg, metrics.NewUniformSample(100)).Update(4)
+	r, _ := newTestReporter(t, Config{Registry: reg})
+	want := []string{"size.mean:4|g", "size.p90:4|g"}
+	if got := sortedLines(r); strings.Join(want, "\n") != strings.Join(got, "\n") {
+		t.Errorf("lines(): %v != %v\n", want, got)
+	}
+}
+
+func TestLinesDogStatsD(t *testing.T) {
+	reg := metrics.NewRegistry()
+	c := metrics.NewCounter()
+	c.(metrics.Taggable).AddTags(map[string]string{"endpoint": "/users", "env": "dev"})
+	c.Inc(1)
+	reg.Register("hits", c)
+	r, _ := newTestReporter(t, Config{Registry: reg, DogStatsD: true, Tags: map[string]string{"env": "prod", "host": "a"}})
+	if got := r.lines(); 1 != len(got) || "hits:1|c|#endpoint:/users,env:dev,host:a" != got[0] {
+		t.Errorf("lines(): %v\n", got)
+	}
+}
+
+func TestLinesNegativeGauge(t *testing.T) {
+	reg := metrics.NewRegistry()
+	metrics.NewRegisteredGauge("g", reg).Update(-5)
+	r, _ := newTestReporter(t, Config{Registry: reg})
+	if got := r.lines(); 2 != len(got) || "g:0|g" != got[0] || "g:-5|g" != got[1] {
+		t.Errorf("lines(): %v\n", got)
+	}
+}
+
+func TestLinesSampleRate(t *testing.T) {
+	reg := metrics.NewRegistry()
+	a := metrics.NewRegisteredCounter("a", reg)
+	metrics.NewRegisteredGauge("g", reg).Update(1)
+	r, _ := newTestReporter(t, Config{Registry: reg, SampleRate: 0.5})
+	r.random = func() float64 { return 0.25 }
+	a.Inc(4)
+	if got := sortedLines(r); 2 != len(got) || "a:4|c|@0.5" != got[0] || "g:1|g" != got[1] {
+		t.Errorf("lines(): %v\n", got)
+	}
+	r.random = func() float64 { return 0.75 }
+	a.Inc(4)
+	if got := r.lines(); 1 != len(got) || "g:1|g" != got[0] {
+		t.Errorf("lines(): %v\n", got)
+	}
+}
+
+func TestFlushPacketSize(t *testing.T) {
+	reg := metrics.NewRegistry()
+	for _, name := range []string{"aaaa", "bbbb", "cccc", "dddd"} {
+		metrics.NewRegisteredGauge(name, reg).Update(1)
+	}
+	r, l := newTestReporter(t, Config{Registry: reg, MaxPacketSize: 20})
+	if err := r.Flush(); nil != err {
+		t.Fatal(err)
+	}
+	// Each line is 8 bytes, so two fit in a packet with their separator.
+	buf := make([]byte, 1500)
+	var lines []string
+	for i := 0; i < 2; i++ {
+		l.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := l.ReadFrom(buf)
+		if nil != err {
+			t.Fatal(err)
+		}
+		if n > 20 {
+			t.Errorf("packet size: 20 < %v\n", n)
+		}
+		lines = append(lines, strings.Split(string(buf[:n]), "\n")...)
+	}
+	if 4 != len(lines) {
+		t.Errorf("lines: %v\n", lines)
+	}
+}
+
+func TestFlushSmallMTU(t *testing.T) {
+	reg := metrics.NewRegistry()
+	for _, name := range []string{"a", "bb", "ccc", "dddd", "eeeee", "a-name-far-too-long-for-a-packet"} {
+		metrics.NewRegisteredGauge(name, reg).Update(1)
+	}
+	m := metrics.NewReporterMetrics("statsd", metrics.NewRegistry())
+	r, l := newTestReporter(t, Config{Registry: reg, MaxPacketSize: 16, Metrics: m})
+	if err := r.Flush(); nil != err {
+		t.Fatal(err)
+	}
+	want := map[string]bool{"a:1|g": true, "bb:1|g": true, "ccc:1|g": true, "dddd:1|g": true, "eeeee:1|g": true}
+	buf := make([]byte, 1500)
+	for 0 != len(want) {
+		l.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := l.ReadFrom(buf)
+		if nil != err {
+			t.Fatalf("%v, still awaiting %v\n", err, want)
+		}
+		if n > 16 {
+			t.Errorf("packet size: 16 < %v\n", n)
+		}
+		// Every packet ends at a line boundary: each line in it is whole.
+		for _, line := range strings.Split(string(buf[:n]), "\n") {
+			if !want[line] {
+				t.Errorf("line: %q\n", line)
+			}
+			delete(want, line)
+		}
+	}
+	if count := m.DroppedPoints.Count(); 1 != count {
+		t.Errorf("dropped-points: 1 != %v\n", count)
+	}
+}
@@ -0,0 +1,61 @@
+package metrics
+
+import "time"
+
+// A Stopwatch times one operation, from when Timer.Start started it until
+// it's stopped, e.g. a request whose status is only known once it's been
+// handled:
+//
+//	sw := metrics.GetOrRegisterTimer("requests", r).Start()
+//	err := handle(req)
+//	sw.StopWithTags(map[string]string{"error": strconv.FormatBool(nil != err)})
+//
+// A Stopwatch is a value, so starting one allocates nothing.  It should be
+// stopped once; stopping it again records another duration.
+type Stopwatch struct {
+	timer   Timer
+	started time.Time
+}
+
+// Elapsed returns the time since the stopwatch was started, by the clock set
+// by SetClock.
+func (s Stopwatch) Elapsed() time.Duration { return since(s.started) }
+
+// Stop records the time since the stopwatch was started in its timer and
+// returns it.
+func (s Stopwatch) Stop() time.Duration {
+	d := since(s.started)
+	s.timer.Update(d)
+	return d
+}
+
+// StopWithTags records the time since the stopwatch was started in the timer
+// by the same name as its own, carrying its tags and the given ones, which
+// override them, and returns it.  That timer is registered in the same
+// registry if it isn't already, so the timer started must have been made by
+// GetOrRegisterTimer, GetOrRegisterTimerT, NewRegisteredTimer or a TimerVec;
+// any other records the time itself, ignoring the tags.
+func (s Stopwatch) StopWithTags(tags map[string]string) time.Duration {
+	d := since(s.started)
+	t, ok := s.timer.(*StandardTimer)
+	if !ok || nil == t.family || 0 == len(tags) {
+		s.timer.Update(d)
+		return d
+	}
+	name, own := SplitTaggedName(t.family.name)
+	merged := make(map[string]string, len(own)+len(tags))
+	for k, v := range own {
+		merged[k] = v
+	}
+	for k, v := range tags {
+		merged[k] = v
+	}
+	GetOrRegisterTimerT(name, merged, t.family.registry).Update(d)
+	return d
+}
+
+// timerFamily records the name and registry a timer was registered by.
+type timerFamily struct {
+	name     string
+	registry Registry
+}
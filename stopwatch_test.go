@@ -0,0 +1,50 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStopwatch(t *testing.T) {
+	r := NewRegistry()
+	tm := GetOrRegisterTimer("requests", r)
+	defer tm.Stop()
+	sw := tm.Start()
+	time.Sleep(time.Millisecond)
+	if d := sw.Stop(); d < time.Millisecond {
+		t.Errorf("sw.Stop(): %v < 1ms\n", d)
+	}
+	if count := tm.Count(); 1 != count {
+		t.Errorf("tm.Count(): 1 != %v\n", count)
+	}
+}
+
+func TestStopwatchWithTags(t *testing.T) {
+	r := NewRegistry()
+	tm := GetOrRegisterTimerT("requests", map[string]string{"route": "/users"}, r)
+	defer tm.Stop()
+	tm.Start().StopWithTags(map[string]string{"status": "500"})
+	tm.Start().StopWithTags(map[string]string{"status": "500"})
+	tm.Start().StopWithTags(nil)
+	tagged, ok := r.Get(TaggedName("requests", map[string]string{"route": "/users", "status": "500"})).(Timer)
+	if !ok {
+		t.Fatalf("no timer with both tags: %v\n", r.Snapshot().Names())
+	}
+	defer tagged.Stop()
+	if count := tagged.Count(); 2 != count {
+		t.Errorf("tagged.Count(): 2 != %v\n", count)
+	}
+	if count := tm.Count(); 1 != count {
+		t.Errorf("tm.Count(): 1 != %v\n", count)
+	}
+}
+
+func TestStopwatchUnregisteredTimer(t *testing.T) {
+	tm := NewTimer()
+	defer tm.Stop()
+	tm.Start().StopWithTags(map[string]string{"status": "200"})
+	if count := tm.Count(); 1 != count {
+		t.Errorf("tm.Count(): 1 != %v\n", count)
+	}
+	NilTimer{}.Start().StopWithTags(map[string]string{"status": "200"})
+}
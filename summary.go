@@ -0,0 +1,108 @@
+package metrics
+
+import "fmt"
+
+// Summaries are Histograms over a DDSketchSample, whose percentiles are
+// within a fixed relative accuracy and which merge exactly, so that the
+// summaries of several processes, e.g. the workers behind a sidecar, combine
+// into one whose percentiles are those of every value any of them recorded,
+// which averaging their percentiles doesn't give.  A process sends its summary
+// as MarshalBinary encodes it and the receiver decodes it with UnmarshalSummary
+// and merges it into its own.
+//
+// Reporters treat a Summary as any other Histogram.
+type Summary interface {
+	Histogram
+	MarshalBinary() ([]byte, error)
+	Merge(Histogram) error
+}
+
+// GetOrRegisterSummary returns an existing Summary or constructs and
+// registers a new StandardSummary of the given relative accuracy.
+func GetOrRegisterSummary(name string, r Registry, relativeAccuracy float64) Summary {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	return getOrRegister(r, name, func() Summary { return NewSummary(relativeAccuracy) }, NilSummary{}).(Summary)
+}
+
+// GetOrRegisterSummaryT returns the existing Summary identified by name and
+// tags together or constructs and registers a new one carrying the tags; see
+// GetOrRegisterCounterT.
+func GetOrRegisterSummaryT(name string, tags map[string]string, r Registry, relativeAccuracy float64) Summary {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	return getOrRegisterTagged(r, name, tags, func() interface{} { return NewSummary(relativeAccuracy) }, NilSummary{}).(Summary)
+}
+
+// NewSummary constructs a new StandardSummary whose percentiles are within the
+// given relative accuracy, e.g. 0.01 for 1%; see NewDDSketchSample.
+func NewSummary(relativeAccuracy float64) Summary {
+	if useNilMetrics() {
+		return NilSummary{}
+	}
+	s := &DDSketchSample{ddSketch: newDDSketch(relativeAccuracy)}
+	return &StandardSummary{StandardHistogram: StandardHistogram{sample: s}, sketch: s}
+}
+
+// NewRegisteredSummary constructs and registers a new StandardSummary of the
+// given relative accuracy.
+func NewRegisteredSummary(name string, r Registry, relativeAccuracy float64) Summary {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	if usesNilMetrics(r) {
+		return NilSummary{}
+	}
+	s := NewSummary(relativeAccuracy)
+	r.Register(name, s)
+	return s
+}
+
+// UnmarshalSummary decodes a summary encoded by Summary.MarshalBinary into a
+// read-only Histogram, which can be merged into a Summary of the same
+// accuracy or reported itself.
+func UnmarshalSummary(data []byte) (Histogram, error) {
+	s, err := UnmarshalDDSketchSample(data)
+	if nil != err {
+		return nil, err
+	}
+	return &HistogramSnapshot{sample: s}, nil
+}
+
+// NilSummary is a no-op Summary.
+type NilSummary struct {
+	NilHistogram
+}
+
+// MarshalBinary is a no-op.
+func (NilSummary) MarshalBinary() ([]byte, error) { return nil, nil }
+
+// Merge is a no-op.
+func (NilSummary) Merge(Histogram) error { return nil }
+
+// StandardSummary is the standard implementation of a Summary, a
+// StandardHistogram over a DDSketchSample.
+type StandardSummary struct {
+	StandardHistogram
+	sketch *DDSketchSample
+}
+
+// MarshalBinary encodes the summary's sketch, for UnmarshalSummary to decode.
+// Tags aren't encoded.
+func (s *StandardSummary) MarshalBinary() ([]byte, error) {
+	return s.sketch.MarshalBinary()
+}
+
+// Merge adds the values recorded by h to the summary.  h must be a Summary
+// of the same relative accuracy, a snapshot of one or one UnmarshalSummary
+// decoded; merging any other Histogram returns an error, since the values it
+// has sampled aren't all the values it recorded.
+func (s *StandardSummary) Merge(h Histogram) error {
+	if _, ok := h.Sample().(sketchSample); !ok {
+		return fmt.Errorf("metrics: can't merge a histogram of a %T into a Summary", h.Sample())
+	}
+	s.touch()
+	return s.sketch.Merge(h.Sample())
+}
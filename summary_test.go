@@ -0,0 +1,60 @@
+package metrics
+
+import "testing"
+
+func TestGetOrRegisterSummary(t *testing.T) {
+	r := NewRegistry()
+	s := GetOrRegisterSummary("foo", r, 0.01)
+	s.Update(47)
+	if h := GetOrRegisterSummary("foo", r, 0.02); s != h || 1 != h.Count() {
+		t.Fatal(h)
+	}
+	if _, ok := r.Get("foo").(Histogram); !ok {
+		t.Fatal(r.Get("foo"))
+	}
+}
+
+func TestSummaryMerge(t *testing.T) {
+	workers := []Summary{NewSummary(0.01), NewSummary(0.01)}
+	for i := int64(1); i <= 1000; i++ {
+		workers[i%2].Update(i)
+	}
+	merged := NewSummary(0.01)
+	for _, w := range workers {
+		b, err := w.MarshalBinary()
+		if nil != err {
+			t.Fatal(err)
+		}
+		h, err := UnmarshalSummary(b)
+		if nil != err {
+			t.Fatal(err)
+		}
+		if err := merged.Merge(h); nil != err {
+			t.Fatal(err)
+		}
+	}
+	if 1000 != merged.Count() || 500500 != merged.Sum() || 1 != merged.Min() || 1000 != merged.Max() {
+		t.Errorf("merged: %v %v %v %v\n", merged.Count(), merged.Sum(), merged.Min(), merged.Max())
+	}
+	if p := merged.Percentile(0.99); p < 980 || p > 1000 {
+		t.Errorf("merged.Percentile(0.99): %v\n", p)
+	}
+	if err := merged.Merge(workers[0].Snapshot()); nil != err || 1500 != merged.Count() {
+		t.Errorf("merging a snapshot: %v, %v\n", err, merged.Count())
+	}
+	if err := merged.Merge(NewHistogram(NewUniformSample(10))); nil == err {
+		t.Error("merging a Histogram didn't fail")
+	}
+}
+
+func TestNilSummary(t *testing.T) {
+	SetUseNilMetrics(true)
+	defer SetUseNilMetrics(false)
+	s := NewSummary(0.01)
+	if _, ok := s.(NilSummary); !ok {
+		t.Fatalf("NewSummary(): %T\n", s)
+	}
+	if err := s.Merge(NewHistogram(NewUniformSample(10))); nil != err {
+		t.Error(err)
+	}
+}
@@ -3,76 +3,212 @@
 package metrics
 
 import (
+	"context"
 	"fmt"
 	"log/syslog"
+	"strings"
 	"time"
 )
 
+// SyslogConfig provides a container with configuration parameters for the
+// syslog exporter.
+type SyslogConfig struct {
+	Registry      Registry      // Registry to be exported
+	FlushInterval time.Duration // Flush interval
+	Schedule      FlushSchedule // Alignment and jitter of flushes within FlushInterval
+
+	// Network and Raddr are those of the syslog server, as passed to
+	// syslog.Dial.  Empty ones mean the local syslog server.
+	Network string
+	Raddr   string
+
+	// Tag prefixes every message, as in syslog.Dial.  Empty means the
+	// program's name.
+	Tag string
+
+	// Facility is that of every message, e.g. syslog.LOG_LOCAL0.  Zero
+	// means syslog.LOG_USER, since programs can't log as the kernel.
+	Facility syslog.Priority
+
+	// Severity is that of every message.  Zero means syslog.LOG_INFO,
+	// since metrics are never an emergency.
+	Severity syslog.Priority
+
+	// Percentiles are those of histograms and timers.  Nil means the
+	// registry's; see StandardRegistry.SetPercentiles.
+	Percentiles []float64
+
+	// OnError, if set, is given each error of SyslogWithConfig, connecting
+	// or writing, which is otherwise logged.
+	OnError func(error)
+
+	// Metrics, if set, records each flush of SyslogOnce and SyslogWithConfig,
+	// counting those which fail to connect as failed, too.
+	Metrics *ReporterMetrics
+}
+
 // Output each metric in the given registry to syslog periodically using
 // the given syslogger.
 func Syslog(r Registry, d time.Duration, w *syslog.Writer) {
-	for _ = range time.Tick(d) {
-		r.Each(func(name string, i interface{}) {
-			switch metric := i.(type) {
-			case Counter:
-				w.Info(fmt.Sprintf("counter %s: count: %d", name, metric.Count()))
-			case Gauge:
-				w.Info(fmt.Sprintf("gauge %s: value: %d", name, metric.Value()))
-			case GaugeFloat64:
-				w.Info(fmt.Sprintf("gauge %s: value: %f", name, metric.Value()))
-			case Healthcheck:
-				metric.Check()
-				w.Info(fmt.Sprintf("healthcheck %s: error: %v", name, metric.Error()))
-			case Histogram:
-				h := metric.Snapshot()
-				ps := h.Percentiles([]float64{0.5, 0.75, 0.95, 0.99, 0.999})
-				w.Info(fmt.Sprintf(
-					"histogram %s: count: %d min: %d max: %d mean: %.2f stddev: %.2f median: %.2f 75%%: %.2f 95%%: %.2f 99%%: %.2f 99.9%%: %.2f",
-					name,
-					h.Count(),
-					h.Min(),
-					h.Max(),
-					h.Mean(),
-					h.StdDev(),
-					ps[0],
-					ps[1],
-					ps[2],
-					ps[3],
-					ps[4],
-				))
-			case Meter:
-				m := metric.Snapshot()
-				w.Info(fmt.Sprintf(
-					"meter %s: count: %d 1-min: %.2f 5-min: %.2f 15-min: %.2f mean: %.2f",
-					name,
-					m.Count(),
-					m.Rate1(),
-					m.Rate5(),
-					m.Rate15(),
-					m.RateMean(),
-				))
-			case Timer:
-				t := metric.Snapshot()
-				ps := t.Percentiles([]float64{0.5, 0.75, 0.95, 0.99, 0.999})
-				w.Info(fmt.Sprintf(
-					"timer %s: count: %d min: %d max: %d mean: %.2f stddev: %.2f median: %.2f 75%%: %.2f 95%%: %.2f 99%%: %.2f 99.9%%: %.2f 1-min: %.2f 5-min: %.2f 15-min: %.2f mean-rate: %.2f",
-					name,
-					t.Count(),
-					t.Min(),
-					t.Max(),
-					t.Mean(),
-					t.StdDev(),
-					ps[0],
-					ps[1],
-					ps[2],
-					ps[3],
-					ps[4],
-					t.Rate1(),
-					t.Rate5(),
-					t.Rate15(),
-					t.RateMean(),
-				))
+	every(tick(d), nil, Closed(r), func(time.Time) {
+		for _, line := range syslogLines(r, RegistryPercentiles(r)) {
+			w.Info(line)
+		}
+	})
+}
+
+// SyslogWithConfig is a blocking exporter function just like Syslog, but it
+// connects to syslog itself and sends at the configured facility and
+// severity.  It connects again on the next flush if connecting fails, and
+// returns once the registry is closed.
+func SyslogWithConfig(c SyslogConfig) {
+	SyslogContext(context.Background(), c)
+}
+
+// SyslogContext is SyslogWithConfig until ctx is done, when it flushes a final
+// time before closing its connection and returning.
+func SyslogContext(ctx context.Context, c SyslogConfig) {
+	var w *syslog.Writer
+	defer func() {
+		if nil != w {
+			w.Close()
+		}
+	}()
+	c.Schedule.RunContext(ctx, c.FlushInterval, Closed(c.Registry), func(time.Time) {
+		ReportError(c.OnError, c.Metrics.Flush(func() error {
+			if nil == w {
+				var err error
+				if w, err = syslogDial(&c); nil != err {
+					return err
+				}
 			}
-		})
+			return syslogOnce(&c, w)
+		}))
+	})
+}
+
+// SyslogOnce writes each metric in c.Registry to w once, at the configured
+// severity, returning the first error writing a message.  The facility is
+// w's.
+func SyslogOnce(c SyslogConfig, w *syslog.Writer) error {
+	return c.Metrics.Flush(func() error { return syslogOnce(&c, w) })
+}
+
+func syslogOnce(c *SyslogConfig, w *syslog.Writer) error {
+	severity := c.Severity & 0x07
+	if 0 == severity {
+		severity = syslog.LOG_INFO
+	}
+	var err error
+	for _, line := range syslogLines(c.Registry, reportedPercentiles(c.Percentiles, c.Registry)) {
+		if e := syslogWrite(w, severity, line); nil != e && nil == err {
+			err = e
+		}
+	}
+	return err
+}
+
+func syslogDial(c *SyslogConfig) (*syslog.Writer, error) {
+	facility := c.Facility &^ 0x07
+	if 0 == facility {
+		facility = syslog.LOG_USER
+	}
+	return syslog.Dial(c.Network, c.Raddr, facility|syslog.LOG_INFO, c.Tag)
+}
+
+func syslogWrite(w *syslog.Writer, severity syslog.Priority, m string) error {
+	switch severity {
+	case syslog.LOG_EMERG:
+		return w.Emerg(m)
+	case syslog.LOG_ALERT:
+		return w.Alert(m)
+	case syslog.LOG_CRIT:
+		return w.Crit(m)
+	case syslog.LOG_ERR:
+		return w.Err(m)
+	case syslog.LOG_WARNING:
+		return w.Warning(m)
+	case syslog.LOG_NOTICE:
+		return w.Notice(m)
+	case syslog.LOG_DEBUG:
+		return w.Debug(m)
+	}
+	return w.Info(m)
+}
+
+// syslogLines renders each metric in the registry as a syslog message, with
+// the percentiles ps of histograms and timers.
+func syslogLines(r Registry, ps []float64) []string {
+	var lines []string
+	add := func(line string) { lines = append(lines, line) }
+	r.Each(func(name string, i interface{}) {
+		switch metric := i.(type) {
+		case Counter:
+			add(fmt.Sprintf("counter %s: count: %d", name, metric.Count()))
+		case CounterFloat64:
+			add(fmt.Sprintf("counter %s: count: %f", name, metric.Count()))
+		case Gauge:
+			add(fmt.Sprintf("gauge %s: value: %d", name, metric.Value()))
+		case GaugeFloat64:
+			add(fmt.Sprintf("gauge %s: value: %f", name, metric.Value()))
+		case MergeableGaugeFloat64:
+			g := metric.Snapshot()
+			add(fmt.Sprintf("gauge %s: value: %f count: %d", name, g.Value(), g.Count()))
+		case Healthcheck:
+			metric.Check()
+			add(fmt.Sprintf("healthcheck %s: error: %v", name, metric.Error()))
+		case Histogram:
+			h := metric.Snapshot()
+			ps := MetricPercentiles(ps, h)
+			add(fmt.Sprintf(
+				"histogram %s: count: %d min: %d max: %d mean: %.2f stddev: %.2f%s",
+				name,
+				h.Count(),
+				h.Min(),
+				h.Max(),
+				h.Mean(),
+				h.StdDev(),
+				syslogPercentiles(ps, h.Percentiles(ps)),
+			))
+		case Meter:
+			m := metric.Snapshot()
+			add(fmt.Sprintf(
+				"meter %s: count: %d 1-min: %.2f 5-min: %.2f 15-min: %.2f mean: %.2f",
+				name,
+				m.Count(),
+				m.Rate1(),
+				m.Rate5(),
+				m.Rate15(),
+				m.RateMean(),
+			))
+		case Timer:
+			t := metric.Snapshot()
+			ps := MetricPercentiles(ps, t)
+			add(fmt.Sprintf(
+				"timer %s: count: %d min: %d max: %d mean: %.2f stddev: %.2f%s 1-min: %.2f 5-min: %.2f 15-min: %.2f mean-rate: %.2f",
+				name,
+				t.Count(),
+				t.Min(),
+				t.Max(),
+				t.Mean(),
+				t.StdDev(),
+				syslogPercentiles(ps, t.Percentiles(ps)),
+				t.Rate1(),
+				t.Rate5(),
+				t.Rate15(),
+				t.RateMean(),
+			))
+		}
+	})
+	return lines
+}
+
+// syslogPercentiles renders the scores of the percentiles ps, each preceded
+// by a space.
+func syslogPercentiles(ps, scores []float64) string {
+	var b strings.Builder
+	for i, p := range ps {
+		fmt.Fprintf(&b, " %s: %.2f", percentileLabel(p), scores[i])
 	}
+	return b.String()
 }
@@ -0,0 +1,75 @@
+//go:build !windows
+// +build !windows
+
+package metrics
+
+import (
+	"log/syslog"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestSyslogOnce(t *testing.T) {
+	l, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	r := NewRegistry()
+	NewRegisteredGauge("depth", r).Update(7)
+	c := SyslogConfig{
+		Registry: r,
+		Network:  "udp",
+		Raddr:    l.LocalAddr().String(),
+		Tag:      "app",
+		Facility: syslog.LOG_LOCAL0,
+		Severity: syslog.LOG_WARNING,
+	}
+	w, err := syslogDial(&c)
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if err := SyslogOnce(c, w); nil != err {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 1024)
+	n, _, err := l.ReadFrom(buf)
+	if nil != err {
+		t.Fatal(err)
+	}
+	m := string(buf[:n])
+	// LOG_LOCAL0 is facility 16, and LOG_WARNING is severity 4.
+	if !strings.HasPrefix(m, "<132>") || !strings.Contains(m, "app[") || !strings.HasSuffix(strings.TrimSpace(m), "gauge depth: value: 7") {
+		t.Errorf("message: %q\n", m)
+	}
+}
+
+func TestSyslogDefaults(t *testing.T) {
+	l, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	r := NewRegistry()
+	NewRegisteredCounter("hits", r)
+	c := SyslogConfig{Registry: r, Network: "udp", Raddr: l.LocalAddr().String()}
+	w, err := syslogDial(&c)
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if err := SyslogOnce(c, w); nil != err {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 1024)
+	n, _, err := l.ReadFrom(buf)
+	if nil != err {
+		t.Fatal(err)
+	}
+	// LOG_USER is facility 1, and LOG_INFO is severity 6.
+	if m := string(buf[:n]); !strings.HasPrefix(m, "<14>") {
+		t.Errorf("message: %q\n", m)
+	}
+}
@@ -0,0 +1,167 @@
+package metrics
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// InvalidTag is the error returned by TagSanitizer.Sanitize, and so by
+// Registry.Register, when a tag is invalid and the sanitizer rejects it.
+type InvalidTag string
+
+func (err InvalidTag) Error() string {
+	return fmt.Sprintf("invalid tag: %s", string(err))
+}
+
+// A TagSanitizerMode says what a TagSanitizer does with an invalid tag.
+type TagSanitizerMode int
+
+const (
+	// TagRewrite replaces the invalid characters of a tag with underscores,
+	// truncates it to the length limits and renames a reserved key k to
+	// exported_k, as Prometheus does with clashing labels.  Tags whose key
+	// is empty are dropped.
+	TagRewrite TagSanitizerMode = iota
+
+	// TagDrop drops invalid tags.
+	TagDrop
+
+	// TagReject refuses to register a metric with an invalid tag, returning
+	// an InvalidTag.
+	TagReject
+)
+
+// A TagSanitizer validates and normalizes the tags of the metrics registered
+// in a registry, so that backends such as Prometheus and InfluxDB don't reject
+// their series.  See StandardRegistry.SetTagSanitizer.
+//
+// Whatever the sanitizer allows, keys may never contain ';' or '=' nor values
+// ';', which TaggedName escapes but Graphite's tagged series can't carry.
+type TagSanitizer struct {
+	Mode           TagSanitizerMode // What to do with invalid tags
+	MaxKeyLength   int              // Longest key in bytes, or zero for no limit
+	MaxValueLength int              // Longest value in bytes, or zero for no limit
+	ValidKeyRune   func(rune) bool  // Nil allows ASCII letters, digits and underscores
+	ValidValueRune func(rune) bool  // Nil allows any printable character
+	ReservedKeys   []string         // Keys metrics may not use, e.g. le and quantile
+}
+
+// Sanitize returns a copy of tags with invalid tags rewritten or dropped, or
+// an InvalidTag if the sanitizer rejects invalid tags and there is one.
+func (s *TagSanitizer) Sanitize(tags map[string]string) (map[string]string, error) {
+	return s.sanitize(tags, s.Mode)
+}
+
+func (s *TagSanitizer) sanitize(tags map[string]string, mode TagSanitizerMode) (map[string]string, error) {
+	sanitized := make(map[string]string, len(tags))
+	for k, v := range tags {
+		reason := s.invalid(k, v)
+		if "" == reason {
+			sanitized[k] = v
+			continue
+		}
+		switch mode {
+		case TagReject:
+			return nil, InvalidTag(fmt.Sprintf("%s=%s: %s", k, v, reason))
+		case TagRewrite:
+			if k, v = s.rewrite(k, v); "" != k {
+				sanitized[k] = v
+			}
+		}
+	}
+	return sanitized, nil
+}
+
+// sanitizeName sanitizes the tags in a name in the form returned by
+// TaggedName.
+func (s *TagSanitizer) sanitizeName(name string) (string, error) {
+	name, tags := SplitTaggedName(name)
+	if 0 == len(tags) {
+		return name, nil
+	}
+	tags, err := s.Sanitize(tags)
+	if nil != err {
+		return "", err
+	}
+	return name + tagSuffix(tags), nil
+}
+
+// invalid returns why a tag is invalid, or the empty string if it's valid.
+func (s *TagSanitizer) invalid(k, v string) string {
+	switch {
+	case "" == k:
+		return "empty key"
+	case s.MaxKeyLength > 0 && len(k) > s.MaxKeyLength:
+		return "key too long"
+	case s.MaxValueLength > 0 && len(v) > s.MaxValueLength:
+		return "value too long"
+	case -1 != strings.IndexFunc(k, func(c rune) bool { return !s.validKeyRune(c) }):
+		return "invalid character in key"
+	case -1 != strings.IndexFunc(v, func(c rune) bool { return !s.validValueRune(c) }):
+		return "invalid character in value"
+	case s.reserved(k):
+		return "reserved key"
+	}
+	return ""
+}
+
+func (s *TagSanitizer) rewrite(k, v string) (string, string) {
+	k = strings.Map(func(c rune) rune {
+		if s.validKeyRune(c) {
+			return c
+		}
+		return '_'
+	}, k)
+	v = strings.Map(func(c rune) rune {
+		if s.validValueRune(c) {
+			return c
+		}
+		return '_'
+	}, v)
+	if s.reserved(k) {
+		k = "exported_" + k
+	}
+	return truncate(k, s.MaxKeyLength), truncate(v, s.MaxValueLength)
+}
+
+func (s *TagSanitizer) reserved(k string) bool {
+	for _, reserved := range s.ReservedKeys {
+		if k == reserved {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *TagSanitizer) validKeyRune(c rune) bool {
+	if ';' == c || '=' == c {
+		return false
+	}
+	if nil != s.ValidKeyRune {
+		return s.ValidKeyRune(c)
+	}
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || '_' == c
+}
+
+func (s *TagSanitizer) validValueRune(c rune) bool {
+	if ';' == c {
+		return false
+	}
+	if nil != s.ValidValueRune {
+		return s.ValidValueRune(c)
+	}
+	return unicode.IsPrint(c)
+}
+
+// truncate cuts s to at most max bytes, without splitting a character.
+func truncate(s string, max int) string {
+	if max <= 0 || len(s) <= max {
+		return s
+	}
+	for max > 0 && !utf8.RuneStart(s[max]) {
+		max--
+	}
+	return s[:max]
+}
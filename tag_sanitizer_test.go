@@ -0,0 +1,107 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTagSanitizerRewrite(t *testing.T) {
+	s := &TagSanitizer{MaxValueLength: 8, ReservedKeys: []string{"le"}}
+	tags, err := s.Sanitize(map[string]string{
+		"http-method": "GET",
+		"path":        "/users/12345",
+		"le":          "1",
+		"":            "x",
+		"ok":          "fine",
+	})
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 4 != len(tags) || "GET" != tags["http_method"] || "/users/1" != tags["path"] || "1" != tags["exported_le"] || "fine" != tags["ok"] {
+		t.Errorf("tags: %v\n", tags)
+	}
+}
+
+func TestTagSanitizerDrop(t *testing.T) {
+	s := &TagSanitizer{Mode: TagDrop, MaxKeyLength: 4}
+	tags, err := s.Sanitize(map[string]string{"host": "a", "region": "eu", "bad key": "b"})
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 1 != len(tags) || "a" != tags["host"] {
+		t.Errorf("tags: %v\n", tags)
+	}
+}
+
+func TestTagSanitizerReject(t *testing.T) {
+	s := &TagSanitizer{Mode: TagReject, ValidValueRune: func(c rune) bool { return 'a' <= c && c <= 'z' }}
+	if _, err := s.Sanitize(map[string]string{"host": "a"}); nil != err {
+		t.Fatal(err)
+	}
+	_, err := s.Sanitize(map[string]string{"host": "A"})
+	if _, ok := err.(InvalidTag); !ok {
+		t.Fatal(err)
+	}
+	if !strings.Contains(err.Error(), "host=A") {
+		t.Errorf("err.Error(): %v\n", err)
+	}
+}
+
+func TestTagSanitizerTruncatesWholeCharacters(t *testing.T) {
+	s := &TagSanitizer{MaxValueLength: 2}
+	tags, _ := s.Sanitize(map[string]string{"city": "Zürich"})
+	if "Z" != tags["city"] {
+		t.Errorf("tags[\"city\"]: Z != %v\n", tags["city"])
+	}
+}
+
+func TestRegistryTagSanitizer(t *testing.T) {
+	r := NewRegistry().(*StandardRegistry)
+	r.SetTagSanitizer(&TagSanitizer{ReservedKeys: []string{"quantile"}})
+	c := NewCounter()
+	c.(Taggable).AddTags(map[string]string{"http-method": "GET"})
+	if err := r.Register("requests;quantile=x", c); nil != err {
+		t.Fatal(err)
+	}
+	if nil == r.Get("requests;exported_quantile=x;http_method=GET") {
+		t.Error("not registered under the sanitized name")
+	}
+	if r.Get("requests;http-method=GET;quantile=x") != c {
+		t.Error("Get didn't sanitize the name")
+	}
+	r.Unregister("requests;http-method=GET;quantile=x")
+	if nil != r.Get("requests;exported_quantile=x;http_method=GET") {
+		t.Error("Unregister didn't sanitize the name")
+	}
+
+	r.SetDefaultTags(map[string]string{"host name": "a"})
+	if tags := r.DefaultTags(); "a" != tags["host_name"] {
+		t.Errorf("r.DefaultTags(): %v\n", tags)
+	}
+}
+
+func TestRegistryTagSanitizerReject(t *testing.T) {
+	r := NewRegistry().(*StandardRegistry)
+	r.SetTagSanitizer(&TagSanitizer{Mode: TagReject, MaxValueLength: 3})
+	if err := r.Register("foo;host=abcd", NewCounter()); nil == err {
+		t.Fatal("Register accepted an invalid tag")
+	} else if _, ok := err.(InvalidTag); !ok {
+		t.Fatal(err)
+	}
+	c := GetOrRegisterCounter("bar;host=abcd", r)
+	c.Inc(1)
+	if 0 != len(r.registered()) {
+		t.Errorf("registered: %v\n", r.registered())
+	}
+	r.SetDefaultTags(map[string]string{"host": "abcd", "dc": "eu"})
+	if tags := r.DefaultTags(); 1 != len(tags) || "eu" != tags["dc"] {
+		t.Errorf("r.DefaultTags(): %v\n", tags)
+	}
+	sub, _ := r.SubRegistryWithTags(map[string]string{"host": "abc"})
+	if err := sub.Register("baz", NewCounter()); nil != err {
+		t.Fatal(err)
+	}
+	if nil == r.Get("baz;host=abc") {
+		t.Error("not registered through the sub-registry")
+	}
+}
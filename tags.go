@@ -0,0 +1,556 @@
+package metrics
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Taggable metrics carry a set of tags, key-value pairs describing the series
+// the metric belongs to, e.g. endpoint="/users".  Every Standard metric type is
+// Taggable, as are the Nil types, which ignore tags.
+//
+// AddTags merges tags into the set, SetTags replaces the whole set and
+// RemoveTag removes one key, each atomically, so GetTags never sees a set
+// half changed.  A registry keys a metric by the name and tags it had when
+// it was registered, so changing the tags of one already registered changes
+// the name EachSnapshot, RegistrySnapshot and SnapshotAndReset give it, and so
+// what reporters label it with, but not the name Get and Unregister find it
+// by; unregister it and register it again to move it.
+type Taggable interface {
+	AddTags(map[string]string)
+	GetTags() map[string]string
+	RemoveTag(key string)
+	SetTags(map[string]string)
+}
+
+// TaggedName returns the name under which registries identify the metric with
+// the given name and tags: the name followed by the tags sorted by key, in the
+// Graphite tagged-series form "name;key1=value1;key2=value2".  Tags already
+// written into name are kept unless tags overrides them, so TaggedName is also
+// how registries bring names given with tags in any order into one form.
+// A ';', '=' or '\' in a key or value is escaped with a '\', so that no two
+// sets of tags share a name and SplitTaggedName returns them as they were
+// given.
+func TaggedName(name string, tags map[string]string) string {
+	return NewTags(tags).Name(name)
+}
+
+// SplitTaggedName splits a name in the form returned by TaggedName into the
+// name itself and its tags, unescaped, which are nil if it has none.
+func SplitTaggedName(taggedName string) (string, map[string]string) {
+	if -1 != strings.IndexByte(taggedName, '\\') {
+		return splitEscapedName(taggedName)
+	}
+	parts := strings.Split(taggedName, ";")
+	if 1 == len(parts) {
+		return taggedName, nil
+	}
+	tags := make(map[string]string, len(parts)-1)
+	for _, part := range parts[1:] {
+		if "" == part {
+			continue
+		}
+		kv := strings.SplitN(part, "=", 2)
+		if 2 == len(kv) {
+			tags[kv[0]] = kv[1]
+		} else {
+			tags[kv[0]] = ""
+		}
+	}
+	return parts[0], tags
+}
+
+// splitEscapedName is SplitTaggedName for names with an escaped character,
+// which takes the character after each '\' literally.
+func splitEscapedName(taggedName string) (string, map[string]string) {
+	i := strings.IndexByte(taggedName, ';')
+	if -1 == i {
+		return taggedName, nil
+	}
+	tags := make(map[string]string)
+	var key, value strings.Builder
+	inValue := false
+	flush := func() {
+		if 0 != key.Len() || inValue {
+			tags[key.String()] = value.String()
+		}
+		key.Reset()
+		value.Reset()
+		inValue = false
+	}
+	for j := i + 1; j < len(taggedName); j++ {
+		c := taggedName[j]
+		switch {
+		case '\\' == c && j+1 < len(taggedName):
+			j++
+			c = taggedName[j]
+		case ';' == c:
+			flush()
+			continue
+		case '=' == c && !inValue:
+			inValue = true
+			continue
+		}
+		if inValue {
+			value.WriteByte(c)
+		} else {
+			key.WriteByte(c)
+		}
+	}
+	flush()
+	return taggedName[:i], tags
+}
+
+// escapeTag escapes the characters of s which would break the form of
+// TaggedName.
+func escapeTag(s string) string {
+	if -1 == strings.IndexAny(s, ";=\\") {
+		return s
+	}
+	var b strings.Builder
+	b.Grow(len(s) + 2)
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; ';' == c || '=' == c || '\\' == c {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// getOrRegisterTagged is getOrRegister for the series identified by name and
+// tags together.  The metric newMetric constructs is given the tags before
+// it's registered, all while the registry holds its lock.
+func getOrRegisterTagged(r Registry, name string, tags map[string]string, newMetric func() interface{}, nilMetric interface{}) interface{} {
+	t := NewTags(tags)
+	return getOrRegister(r, t.Name(name), func() interface{} {
+		i := newMetric()
+		applyTags(i, t)
+		return i
+	}, nilMetric)
+}
+
+// applyTags gives the metric i the tags t if it's able to carry tags.
+func applyTags(i interface{}, t Tags) {
+	if s, ok := i.(interface{ addTags(Tags) }); ok {
+		s.addTags(t)
+	} else if s, ok := i.(Taggable); ok {
+		s.AddTags(t.Map())
+	}
+}
+
+// tagSet is the copy-on-write tag storage embedded in the Standard metric
+// types.  Readers load the current map atomically and never lock; writers
+// serialize on the mutex, copy the map and store the copy, so a map once
+// stored is never modified.  The zero value is an empty set.  Dynamic tags are
+// kept apart, and aren't among those GetTags returns.
+type tagSet struct {
+	mutex      sync.Mutex
+	tags       atomic.Value // Tags
+	registered atomic.Value // Tags as of the last registration
+	dynamicTags
+}
+
+// AddTags adds the given tags to the metric, replacing the values of any keys
+// it already has.  It's safe to call concurrently with GetTags and with
+// itself.
+func (t *tagSet) AddTags(tags map[string]string) {
+	if 0 != len(tags) {
+		t.addTags(NewTags(tags))
+	}
+}
+
+func (t *tagSet) addTags(tags Tags) {
+	if 0 == tags.Len() {
+		return
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.tags.Store(t.load().Merge(tags))
+}
+
+// GetTags returns a copy of the metric's tags, which the caller may modify.
+func (t *tagSet) GetTags() map[string]string { return t.load().Map() }
+
+// RemoveTag removes the tag with the given key from the metric, if it has
+// one, and its dynamic tag of that key.
+func (t *tagSet) RemoveTag(key string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if tags := t.load(); tags.Has(key) {
+		t.tags.Store(tags.Without(key))
+	}
+	t.removeDynamicTag(key)
+}
+
+// SetTags replaces all of the metric's tags with the given ones, so that
+// SetTags(nil) removes them all, and removes its dynamic tags.
+func (t *tagSet) SetTags(tags map[string]string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.tags.Store(NewTags(tags))
+	t.clearDynamicTags()
+}
+
+// Tags returns the metric's tags without copying them.
+func (t *tagSet) Tags() Tags { return t.load() }
+
+// load returns the metric's current tags.  Taking a snapshot shares them
+// rather than copying.
+func (t *tagSet) load() Tags {
+	tags, _ := t.tags.Load().(Tags)
+	return tags
+}
+
+// resolve returns the metric's tags along with the current values of its
+// dynamic tags, calling their functions, for a snapshot.
+func (t *tagSet) resolve() Tags {
+	tags := t.load()
+	var pairs []Tag
+	t.eachDynamicTag(func(key, value string) {
+		if _, ok := tags.Get(key); !ok {
+			pairs = append(pairs, Tag{Key: key, Value: value})
+		}
+	})
+	if 0 == len(pairs) {
+		return tags
+	}
+	return tags.Merge(newSortedTags(pairs))
+}
+
+// markRegistered records the tags the metric has as a registry names it by
+// them.
+func (t *tagSet) markRegistered() { t.registered.Store(t.load()) }
+
+// registeredTags returns the tags the metric had when it was last registered.
+// ok is false if it was never registered.
+func (t *tagSet) registeredTags() (registered Tags, ok bool) {
+	registered, ok = t.registered.Load().(Tags)
+	return
+}
+
+// registeredMetric is implemented by the metrics which remember the tags they
+// were registered with, those embedding a tagSet.
+type registeredMetric interface {
+	registeredTags() (Tags, bool)
+	resolve() Tags
+}
+
+// liveName returns name, which i is registered under, with the tags i had
+// when it was registered replaced by those it has now, so that a metric whose
+// tags changed is reported with them.  Its current tags are those of snapshot,
+// which was taken of i for the same report, if it carries them, so that its
+// dynamic tags are read once.  It returns name itself, at no cost, if they
+// didn't change.
+func liveName(name string, i, snapshot interface{}) string {
+	m, ok := i.(registeredMetric)
+	if !ok {
+		return name
+	}
+	registered, ok := m.registeredTags()
+	if !ok {
+		return name
+	}
+	var current Tags
+	switch s := snapshot.(type) {
+	case registeredMetric:
+		// The metric is its own snapshot, whose Tags leave out dynamic ones.
+		current = m.resolve()
+	case interface{ Tags() Tags }:
+		current = s.Tags()
+	default:
+		current = m.resolve()
+	}
+	if registered.Equal(current) {
+		return name
+	}
+	keys := make([]string, 0, registered.Len())
+	registered.Each(func(key, _ string) { keys = append(keys, key) })
+	name, tags := SplitTaggedName(name)
+	return NewTags(tags).Without(keys...).Merge(current).Name(name)
+}
+
+// liveNames appends to names the name each metric is reported under, given
+// the keys the metrics are registered under and the snapshots taken of them:
+// its liveName, unless another metric is registered under or renamed to the
+// same name, in which case it keeps its key.  Dynamic tags thereby can't make
+// two metrics one series, nor change the keys their deltas are tracked by.
+func liveNames(names, keys []string, metrics, snapshots []interface{}) []string {
+	renamed := false
+	for i, key := range keys {
+		name := liveName(key, metrics[i], snapshots[i])
+		renamed = renamed || name != key
+		names = append(names, name)
+	}
+	if !renamed {
+		return names
+	}
+	live := names[len(names)-len(keys):]
+	counts := make(map[string]int, len(keys))
+	for i, key := range keys {
+		counts[key]++
+		if live[i] != key {
+			counts[live[i]]++
+		}
+	}
+	for i, key := range keys {
+		if live[i] != key && counts[live[i]] > 1 {
+			live[i] = key
+		}
+	}
+	return names
+}
+
+// tagSuffix renders tags in the Graphite tagged-series form, sorted by key.
+func tagSuffix(tags map[string]string) string { return NewTags(tags).String() }
+
+// tagsOf returns the tags of the given metric, which are empty if it isn't
+// Taggable.
+func tagsOf(i interface{}) Tags {
+	switch t := i.(type) {
+	case interface{ Tags() Tags }:
+		return t.Tags()
+	case Taggable:
+		return NewTags(t.GetTags())
+	}
+	return Tags{}
+}
+
+// A Tag is one key-value pair of Tags.
+type Tag struct {
+	Key, Value string
+}
+
+// Tags is an immutable set of tags sorted by key, the form metrics store
+// theirs in and share with their snapshots.  It carries its rendering in the
+// Graphite tagged-series form, so naming a series by it, comparing it and
+// hashing it need no sorting or allocation.  Being immutable, Tags may be
+// shared between goroutines, and copying one copies only a slice header and a
+// string.  The zero value is empty.
+type Tags struct {
+	pairs  []Tag
+	suffix string // ";key1=value1;key2=value2"
+}
+
+// NewTags returns the Tags of the given map.
+func NewTags(tags map[string]string) Tags {
+	if 0 == len(tags) {
+		return Tags{}
+	}
+	pairs := make([]Tag, 0, len(tags))
+	for k, v := range tags {
+		pairs = append(pairs, Tag{k, v})
+	}
+	sortTags(pairs)
+	return newSortedTags(pairs)
+}
+
+// TagsOf returns the Tags of alternating keys and values, keeping the last
+// value of any key given more than once.  It panics if it's given an odd
+// number of strings.
+func TagsOf(keyValues ...string) Tags {
+	if 0 != len(keyValues)%2 {
+		panic("metrics: TagsOf given an odd number of strings")
+	}
+	if 0 == len(keyValues) {
+		return Tags{}
+	}
+	pairs := make([]Tag, 0, len(keyValues)/2)
+	for i := 0; i < len(keyValues); i += 2 {
+		pairs = append(pairs, Tag{keyValues[i], keyValues[i+1]})
+	}
+	// A stable sort leaves the last of duplicate keys last, which is the one
+	// dedupe keeps.
+	sortTags(pairs)
+	return newSortedTags(dedupeTags(pairs))
+}
+
+// newSortedTags returns the Tags of pairs sorted by key without duplicates,
+// which it takes ownership of.
+func newSortedTags(pairs []Tag) Tags {
+	n := 0
+	for _, p := range pairs {
+		n += 2 + len(p.Key) + len(p.Value)
+	}
+	var b strings.Builder
+	b.Grow(n)
+	for _, p := range pairs {
+		b.WriteByte(';')
+		b.WriteString(escapeTag(p.Key))
+		b.WriteByte('=')
+		b.WriteString(escapeTag(p.Value))
+	}
+	return Tags{pairs: pairs, suffix: b.String()}
+}
+
+// sortTags sorts pairs by key, stably.  Insertion sort suits the handful of
+// tags a series has and allocates nothing.
+func sortTags(pairs []Tag) {
+	for i := 1; i < len(pairs); i++ {
+		for j := i; j > 0 && pairs[j].Key < pairs[j-1].Key; j-- {
+			pairs[j], pairs[j-1] = pairs[j-1], pairs[j]
+		}
+	}
+}
+
+// dedupeTags keeps the last of each run of sorted pairs with the same key.
+func dedupeTags(pairs []Tag) []Tag {
+	deduped := pairs[:0]
+	for i, p := range pairs {
+		if i+1 < len(pairs) && pairs[i+1].Key == p.Key {
+			continue
+		}
+		deduped = append(deduped, p)
+	}
+	return deduped
+}
+
+// Each calls f with each tag in order of key.
+func (t Tags) Each(f func(key, value string)) {
+	for _, p := range t.pairs {
+		f(p.Key, p.Value)
+	}
+}
+
+// Equal returns true if t and other hold the same tags.
+func (t Tags) Equal(other Tags) bool { return t.suffix == other.suffix }
+
+// Get returns the value of the given key and whether there is one.
+func (t Tags) Get(key string) (string, bool) {
+	lo, hi := 0, len(t.pairs)
+	for lo < hi {
+		mid := int(uint(lo+hi) >> 1)
+		if t.pairs[mid].Key < key {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	if lo < len(t.pairs) && key == t.pairs[lo].Key {
+		return t.pairs[lo].Value, true
+	}
+	return "", false
+}
+
+// Has returns true if the tags include the given key.
+func (t Tags) Has(key string) bool {
+	_, ok := t.Get(key)
+	return ok
+}
+
+// Hash returns the 64-bit FNV-1a hash of the tags.
+func (t Tags) Hash() uint64 {
+	h := uint64(fnvOffset)
+	for i := 0; i < len(t.suffix); i++ {
+		h ^= uint64(t.suffix[i])
+		h *= fnvPrime
+	}
+	return h
+}
+
+// Len returns the number of tags.
+func (t Tags) Len() int { return len(t.pairs) }
+
+// Map returns the tags as a new map, which the caller may modify.
+func (t Tags) Map() map[string]string {
+	m := make(map[string]string, len(t.pairs))
+	for _, p := range t.pairs {
+		m[p.Key] = p.Value
+	}
+	return m
+}
+
+// Merge returns the union of t and other, taking the values of keys in both
+// from other.
+func (t Tags) Merge(other Tags) Tags {
+	switch {
+	case 0 == len(other.pairs):
+		return t
+	case 0 == len(t.pairs):
+		return other
+	}
+	pairs := make([]Tag, 0, len(t.pairs)+len(other.pairs))
+	i, j := 0, 0
+	for i < len(t.pairs) && j < len(other.pairs) {
+		switch a, b := t.pairs[i], other.pairs[j]; {
+		case a.Key < b.Key:
+			pairs = append(pairs, a)
+			i++
+		case a.Key > b.Key:
+			pairs = append(pairs, b)
+			j++
+		default:
+			pairs = append(pairs, b)
+			i++
+			j++
+		}
+	}
+	pairs = append(pairs, t.pairs[i:]...)
+	pairs = append(pairs, other.pairs[j:]...)
+	return newSortedTags(pairs)
+}
+
+// Name returns TaggedName(name, tags) for these tags.  A name without tags of
+// its own costs at most the one concatenation, and one already in the form
+// TaggedName returns costs nothing when there are no tags to add.
+func (t Tags) Name(name string) string {
+	i := strings.IndexByte(name, ';')
+	if -1 == i {
+		return name + t.suffix
+	}
+	if 0 == len(t.pairs) && isTagSuffix(name[i:]) {
+		return name
+	}
+	name, tags := SplitTaggedName(name)
+	return name + NewTags(tags).Merge(t).suffix
+}
+
+// String returns the tags in the Graphite tagged-series form, e.g.
+// ";key1=value1;key2=value2", or "" if there are none.
+func (t Tags) String() string { return t.suffix }
+
+// Without returns t without the tags of the given keys.
+func (t Tags) Without(keys ...string) Tags {
+	pairs := make([]Tag, 0, len(t.pairs))
+outer:
+	for _, p := range t.pairs {
+		for _, key := range keys {
+			if key == p.Key {
+				continue outer
+			}
+		}
+		pairs = append(pairs, p)
+	}
+	if len(pairs) == len(t.pairs) {
+		return t
+	}
+	return newSortedTags(pairs)
+}
+
+// isTagSuffix returns true if s is already in the form Tags renders, with
+// every tag having a key and an '=' and the keys strictly increasing.  It
+// leaves suffixes with escaped characters to be split and rendered again.
+func isTagSuffix(s string) bool {
+	if -1 != strings.IndexByte(s, '\\') {
+		return false
+	}
+	prev := ""
+	for 0 != len(s) {
+		if ';' != s[0] {
+			return false
+		}
+		s = s[1:]
+		end := strings.IndexByte(s, ';')
+		if -1 == end {
+			end = len(s)
+		}
+		eq := strings.IndexByte(s[:end], '=')
+		if eq < 1 || s[:eq] <= prev {
+			return false
+		}
+		prev = s[:eq]
+		s = s[end:]
+	}
+	return true
+}
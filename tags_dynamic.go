@@ -0,0 +1,109 @@
+package metrics
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// MaxDynamicTags is the most dynamic tags one metric may have.
+const MaxDynamicTags = 8
+
+// ErrTooManyDynamicTags is returned by AddDynamicTag when the metric has
+// MaxDynamicTags dynamic tags already.
+var ErrTooManyDynamicTags = errors.New("metrics: too many dynamic tags")
+
+// DynamicTaggable metrics carry dynamic tags, whose values are those of
+// functions called each time the metric is reported, e.g. a version read from
+// configuration which can be reloaded, so that they stay current without the
+// application setting them again on every change.  Every Standard metric
+// type is DynamicTaggable, as are the Nil types, which ignore them.
+//
+// AddDynamicTag adds the dynamic tag of the given key, replacing any it has
+// already, unless the metric has MaxDynamicTags others, when it returns
+// ErrTooManyDynamicTags.  Each function is called once every time the metric
+// is reported, so it should be as cheap as reading a variable, and safe to
+// call concurrently.  A tag of the same key wins over a dynamic tag, and a
+// dynamic tag whose value is empty is left out.  RemoveTag removes the dynamic
+// tag of its key too, and SetTags all of them.
+type DynamicTaggable interface {
+	AddDynamicTag(key string, value func() string) error
+}
+
+// dynamicTags is the copy-on-write storage of dynamic tags.  Readers load the
+// current slice atomically and never lock; writers serialize on the mutex and
+// store a new slice, so a slice once stored is never modified.  The zero value
+// has no dynamic tags.
+type dynamicTags struct {
+	mutex   sync.Mutex
+	dynamic atomic.Value // []dynamicTag, sorted by key
+}
+
+// A dynamicTag is the key and value function of one dynamic tag.
+type dynamicTag struct {
+	key   string
+	value func() string
+}
+
+// AddDynamicTag adds a tag whose value is that returned by value each time the
+// metric is reported.  See DynamicTaggable.
+func (d *dynamicTags) AddDynamicTag(key string, value func() string) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	dynamic := d.without(key)
+	if len(dynamic) >= MaxDynamicTags {
+		return ErrTooManyDynamicTags
+	}
+	dynamic = append(dynamic, dynamicTag{key: key, value: value})
+	sort.Slice(dynamic, func(i, j int) bool { return dynamic[i].key < dynamic[j].key })
+	d.dynamic.Store(dynamic)
+	return nil
+}
+
+// clearDynamicTags removes every dynamic tag.
+func (d *dynamicTags) clearDynamicTags() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if 0 != len(d.loadDynamic()) {
+		d.dynamic.Store([]dynamicTag(nil))
+	}
+}
+
+// eachDynamicTag calls f with the key and current value of each dynamic tag in
+// order of key, calling each value function once, and skipping those whose
+// value is empty.
+func (d *dynamicTags) eachDynamicTag(f func(key, value string)) {
+	for _, t := range d.loadDynamic() {
+		if v := t.value(); "" != v {
+			f(t.key, v)
+		}
+	}
+}
+
+func (d *dynamicTags) loadDynamic() []dynamicTag {
+	dynamic, _ := d.dynamic.Load().([]dynamicTag)
+	return dynamic
+}
+
+// removeDynamicTag removes the dynamic tag of the given key, if there is one.
+func (d *dynamicTags) removeDynamicTag(key string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if dynamic := d.without(key); len(dynamic) != len(d.loadDynamic()) {
+		d.dynamic.Store(dynamic)
+	}
+}
+
+// without returns a copy of the dynamic tags without that of the given key.  It
+// must be called with the mutex held.
+func (d *dynamicTags) without(key string) []dynamicTag {
+	old := d.loadDynamic()
+	dynamic := make([]dynamicTag, 0, len(old)+1)
+	for _, t := range old {
+		if key != t.key {
+			dynamic = append(dynamic, t)
+		}
+	}
+	return dynamic
+}
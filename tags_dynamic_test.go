@@ -0,0 +1,127 @@
+package metrics
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestDynamicTags(t *testing.T) {
+	var d dynamicTags
+	version, calls := "1.0", 0
+	if err := d.AddDynamicTag("version", func() string { calls++; return version }); nil != err {
+		t.Fatal(err)
+	}
+	d.AddDynamicTag("host", func() string { return "a" })
+	d.AddDynamicTag("empty", func() string { return "" })
+	resolve := func() []string {
+		var tags []string
+		d.eachDynamicTag(func(key, value string) { tags = append(tags, key+"="+value) })
+		return tags
+	}
+	if want := []string{"host=a", "version=1.0"}; !reflect.DeepEqual(want, resolve()) {
+		t.Errorf("tags: %v != %v\n", want, resolve())
+	}
+	version = "1.1"
+	calls = 0
+	if want, tags := []string{"host=a", "version=1.1"}, resolve(); !reflect.DeepEqual(want, tags) {
+		t.Errorf("tags after a change: %v != %v\n", want, tags)
+	}
+	if 1 != calls {
+		t.Errorf("calls: 1 != %v\n", calls)
+	}
+	d.AddDynamicTag("host", func() string { return "b" })
+	d.removeDynamicTag("version")
+	if want := []string{"host=b"}; !reflect.DeepEqual(want, resolve()) {
+		t.Errorf("tags after replacing and removing: %v != %v\n", want, resolve())
+	}
+	d.clearDynamicTags()
+	if tags := resolve(); 0 != len(tags) {
+		t.Errorf("tags after clearing: %v\n", tags)
+	}
+}
+
+func TestDynamicTagsBounded(t *testing.T) {
+	var d dynamicTags
+	for i := 0; i < MaxDynamicTags; i++ {
+		if err := d.AddDynamicTag(fmt.Sprint(i), func() string { return "v" }); nil != err {
+			t.Fatal(err)
+		}
+	}
+	if err := d.AddDynamicTag("one-more", func() string { return "v" }); ErrTooManyDynamicTags != err {
+		t.Errorf("AddDynamicTag(): %v != %v\n", ErrTooManyDynamicTags, err)
+	}
+	if err := d.AddDynamicTag("0", func() string { return "w" }); nil != err {
+		t.Errorf("AddDynamicTag() replacing one: %v\n", err)
+	}
+	d.clearDynamicTags()
+	if err := d.AddDynamicTag("one-more", func() string { return "v" }); nil != err {
+		t.Errorf("AddDynamicTag() after clearing: %v\n", err)
+	}
+}
+
+func TestDynamicTagsResolvedOncePerReport(t *testing.T) {
+	r := NewRegistry()
+	calls := 0
+	version := func() string { calls++; return "1.0" }
+	GetOrRegisterCounter("counter", r).(DynamicTaggable).AddDynamicTag("version", version)
+	GetOrRegisterHistogram("histogram", r, NewUniformSample(10)).(DynamicTaggable).AddDynamicTag("version", version)
+	s := r.Snapshot()
+	if want := []string{"counter;version=1.0", "histogram;version=1.0"}; !reflect.DeepEqual(want, s.Names()) {
+		t.Errorf("s.Names(): %v != %v\n", want, s.Names())
+	}
+	if 2 != calls {
+		t.Errorf("calls: 2 != %v\n", calls)
+	}
+}
+
+func TestDynamicTagsCollide(t *testing.T) {
+	r := NewRegistry()
+	GetOrRegisterCounterT("requests", map[string]string{"version": "1.0"}, r).Inc(1)
+	c := GetOrRegisterCounter("requests", r)
+	c.Inc(2)
+	c.(DynamicTaggable).AddDynamicTag("version", func() string { return "1.0" })
+	s := r.Snapshot()
+	if want := []string{"requests", "requests;version=1.0"}; !reflect.DeepEqual(want, s.Names()) {
+		t.Fatalf("s.Names(): %v != %v\n", want, s.Names())
+	}
+	if count := s.Get("requests").(Counter).Count(); 2 != count {
+		t.Errorf("requests: 2 != %v\n", count)
+	}
+	if count := s.Get("requests;version=1.0").(Counter).Count(); 1 != count {
+		t.Errorf("requests;version=1.0: 1 != %v\n", count)
+	}
+}
+
+func TestDynamicTagsDeltas(t *testing.T) {
+	r := NewRegistry()
+	version := "1.0"
+	c := GetOrRegisterCounter("requests", r)
+	c.(DynamicTaggable).AddDynamicTag("version", func() string { return version })
+	d := NewDeltaRegistry(r, "test")
+	c.Inc(10)
+	d.Snapshot()
+	for _, v := range []string{"1.1", "1.2"} {
+		version = v
+		c.Inc(1)
+		name := "requests;version=" + v
+		if count := d.Snapshot().Get(name).(Counter).Count(); 1 != count {
+			t.Errorf("%v: 1 != %v\n", name, count)
+		}
+	}
+}
+
+func TestDynamicTagsCollideSnapshotAndReset(t *testing.T) {
+	r := NewRegistry()
+	GetOrRegisterHistogramT("latency", map[string]string{"version": "1.0"}, r, NewUniformSample(10)).Update(1)
+	h := GetOrRegisterHistogram("latency", r, NewUniformSample(10))
+	h.Update(2)
+	h.(DynamicTaggable).AddDynamicTag("version", func() string { return "1.0" })
+	s := r.SnapshotAndReset().Snapshot()
+	if want := []string{"latency", "latency;version=1.0"}; !reflect.DeepEqual(want, s.Names()) {
+		t.Fatalf("s.Names(): %v != %v\n", want, s.Names())
+	}
+	if max := s.Get("latency").(Histogram).Max(); 2 != max {
+		t.Errorf("latency: 2 != %v\n", max)
+	}
+}
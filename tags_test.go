@@ -0,0 +1,391 @@
+package metrics
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTaggable(t *testing.T) {
+	for _, i := range []interface{}{
+		NewCounter(),
+		NewGauge(),
+		NewGaugeFloat64(),
+		NewMergeableGaugeFloat64(),
+		NewHealthcheck(func(Healthcheck) {}),
+		NewHistogram(NewUniformSample(100)),
+		NewMeter(),
+		NewTimer(),
+		NewWindowedHistogram(time.Minute, time.Second),
+	} {
+		m, ok := i.(Taggable)
+		if !ok {
+			t.Fatalf("%T isn't Taggable", i)
+		}
+		if _, ok := i.(DynamicTaggable); !ok {
+			t.Errorf("%T isn't DynamicTaggable\n", i)
+		}
+		m.AddTags(map[string]string{"host": "a", "region": "eu"})
+		m.AddTags(map[string]string{"host": "b"})
+		tags := m.GetTags()
+		if 2 != len(tags) || "b" != tags["host"] || "eu" != tags["region"] {
+			t.Errorf("%T.GetTags(): %v\n", m, tags)
+		}
+		m.RemoveTag("region")
+		m.RemoveTag("missing")
+		if tags := m.GetTags(); 1 != len(tags) || "b" != tags["host"] {
+			t.Errorf("%T.GetTags() after RemoveTag: %v\n", m, tags)
+		}
+		m.SetTags(map[string]string{"zone": "1"})
+		if tags := m.GetTags(); 1 != len(tags) || "1" != tags["zone"] {
+			t.Errorf("%T.GetTags() after SetTags: %v\n", m, tags)
+		}
+		m.SetTags(nil)
+		if tags := m.GetTags(); 0 != len(tags) {
+			t.Errorf("%T.GetTags() after SetTags(nil): %v\n", m, tags)
+		}
+		stopMetric(m)
+	}
+}
+
+func TestTaggableGetTagsCopies(t *testing.T) {
+	c := NewCounter().(*StandardCounter)
+	c.AddTags(map[string]string{"host": "a"})
+	c.GetTags()["host"] = "b"
+	if tags := c.GetTags(); "a" != tags["host"] {
+		t.Errorf("c.GetTags(): %v\n", tags)
+	}
+}
+
+func TestTaggableConcurrent(t *testing.T) {
+	c := NewCounter().(*StandardCounter)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				c.AddTags(map[string]string{fmt.Sprintf("k%d", i): fmt.Sprint(j)})
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				for k, v := range c.GetTags() {
+					if "" == k || "" == v {
+						t.Error(k, v)
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if tags := c.GetTags(); 4 != len(tags) || "99" != tags["k0"] {
+		t.Errorf("c.GetTags(): %v\n", tags)
+	}
+}
+
+func TestNilTaggable(t *testing.T) {
+	for _, m := range []Taggable{
+		NilCounter{},
+		NilGauge{},
+		NilGaugeFloat64{},
+		NilMergeableGaugeFloat64{},
+		NilHealthcheck{},
+		NilHistogram{},
+		NilMeter{},
+		NilTimer{},
+		NilWindowedHistogram{},
+	} {
+		m.AddTags(map[string]string{"host": "a"})
+		m.SetTags(map[string]string{"host": "a"})
+		m.RemoveTag("host")
+		if tags := m.GetTags(); 0 != len(tags) {
+			t.Errorf("%T.GetTags(): %v\n", m, tags)
+		}
+		if err := m.(DynamicTaggable).AddDynamicTag("a", func() string { return "b" }); nil != err {
+			t.Errorf("%T.AddDynamicTag(): %v\n", m, err)
+		}
+	}
+}
+
+func TestSetTagsAndRemoveTagDropDynamicTags(t *testing.T) {
+	h := NewHistogram(NewUniformSample(10))
+	h.(DynamicTaggable).AddDynamicTag("version", func() string { return "1.0" })
+	h.(DynamicTaggable).AddDynamicTag("zone", func() string { return "1" })
+	h.(Taggable).RemoveTag("version")
+	if tags := h.Snapshot().(*HistogramSnapshot).GetTags(); 1 != len(tags) || "1" != tags["zone"] {
+		t.Errorf("Snapshot().GetTags() after RemoveTag: %v\n", tags)
+	}
+	h.(Taggable).SetTags(map[string]string{"host": "a"})
+	if tags := h.Snapshot().(*HistogramSnapshot).GetTags(); 1 != len(tags) || "a" != tags["host"] {
+		t.Errorf("Snapshot().GetTags() after SetTags: %v\n", tags)
+	}
+}
+
+func TestTaggedName(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		tags map[string]string
+		want string
+	}{
+		{"foo", nil, "foo"},
+		{"foo", map[string]string{"b": "2", "a": "1"}, "foo;a=1;b=2"},
+		{"foo;b=2;a=1", nil, "foo;a=1;b=2"},
+		{"foo;a=1", map[string]string{"a": "3", "b": "2"}, "foo;a=3;b=2"},
+		{"foo;a=", nil, "foo;a="},
+		{"foo;a", nil, "foo;a="},
+		{"foo;a=1;a=2", nil, "foo;a=2"},
+		{"foo;", nil, "foo"},
+		{"foo;;a=1", nil, "foo;a=1"},
+		{"foo", map[string]string{"q": "x;b=c"}, `foo;q=x\;b\=c`},
+		{"foo", map[string]string{`a\`: `\`}, `foo;a\\=\\`},
+		{`foo;q=x\;b\=c;a=1`, nil, `foo;a=1;q=x\;b\=c`},
+	} {
+		if s := TaggedName(c.name, c.tags); c.want != s {
+			t.Errorf("TaggedName(%q, %v): %q != %q\n", c.name, c.tags, c.want, s)
+		}
+	}
+}
+
+func TestTaggedNameAllocs(t *testing.T) {
+	if n := testing.AllocsPerRun(100, func() { TaggedName("foo;a=1;b=2", nil) }); 0 != n {
+		t.Errorf("allocs of an already tagged name: 0 != %v\n", n)
+	}
+	tags := TagsOf("a", "1", "b", "2")
+	if n := testing.AllocsPerRun(100, func() { tags.Name("foo") }); n > 1 {
+		t.Errorf("allocs of Tags.Name: 1 < %v\n", n)
+	}
+}
+
+func TestTags(t *testing.T) {
+	tags := TagsOf("b", "2", "a", "1", "b", "3")
+	if 2 != tags.Len() || ";a=1;b=3" != tags.String() {
+		t.Fatalf("TagsOf(): %q\n", tags.String())
+	}
+	if !tags.Equal(NewTags(map[string]string{"a": "1", "b": "3"})) {
+		t.Error("tags are not Equal to NewTags of the same map")
+	}
+	if tags.Hash() != NewTags(map[string]string{"b": "3", "a": "1"}).Hash() {
+		t.Error("equal tags hash differently")
+	}
+	if tags.Hash() == TagsOf("a", "1").Hash() {
+		t.Error("different tags hash the same")
+	}
+	if v, ok := tags.Get("b"); !ok || "3" != v {
+		t.Errorf("Get(b): 3 != %q, %v\n", v, ok)
+	}
+	if _, ok := tags.Get("c"); ok {
+		t.Error("Get(c) found a value")
+	}
+	if m := tags.Map(); 2 != len(m) || "1" != m["a"] {
+		t.Errorf("Map(): %v\n", m)
+	}
+	var keys string
+	tags.Each(func(k, v string) { keys += k })
+	if "ab" != keys {
+		t.Errorf("Each(): ab != %q\n", keys)
+	}
+	if merged := tags.Merge(TagsOf("c", "4", "a", "0")); ";a=0;b=3;c=4" != merged.String() {
+		t.Errorf("Merge(): %q\n", merged.String())
+	}
+	if ";a=1;b=3" != tags.String() {
+		t.Errorf("Merge modified the tags: %q\n", tags.String())
+	}
+	if 0 != (Tags{}).Len() || "foo" != (Tags{}).Name("foo") {
+		t.Error("the zero Tags aren't empty")
+	}
+}
+
+func TestTagsWithout(t *testing.T) {
+	tags := TagsOf("a", "1", "b", "2", "c", "3")
+	if s := tags.Without("b", "d").String(); ";a=1;c=3" != s {
+		t.Errorf("tags.Without(b, d): %q\n", s)
+	}
+	if s := tags.Without("d").String(); ";a=1;b=2;c=3" != s {
+		t.Errorf("tags.Without(d): %q\n", s)
+	}
+	if !tags.Has("a") || tags.Has("d") {
+		t.Error(tags)
+	}
+}
+
+func TestTagsOfOddNumber(t *testing.T) {
+	defer func() {
+		if nil == recover() {
+			t.Error("TagsOf didn't panic")
+		}
+	}()
+	TagsOf("a")
+}
+
+func TestTaggableTags(t *testing.T) {
+	c := NewCounter()
+	c.(Taggable).AddTags(map[string]string{"b": "2", "a": "1"})
+	if tags := c.(interface{ Tags() Tags }).Tags(); ";a=1;b=2" != tags.String() {
+		t.Errorf("Tags(): %q\n", tags.String())
+	}
+	tm := NewTimer()
+	tm.(Taggable).AddTags(map[string]string{"a": "1"})
+	if tags := tm.Snapshot().(*TimerSnapshot).Tags(); ";a=1" != tags.String() {
+		t.Errorf("TimerSnapshot.Tags(): %q\n", tags.String())
+	}
+}
+
+func BenchmarkGetOrRegisterCounterT(b *testing.B) {
+	r := NewRegistry()
+	tags := map[string]string{"method": "GET", "status": "2xx"}
+	GetOrRegisterCounterT("requests", tags, r)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		GetOrRegisterCounterT("requests", tags, r).Inc(1)
+	}
+}
+
+func TestSplitTaggedName(t *testing.T) {
+	name, tags := SplitTaggedName("foo;a=1;b=x=y")
+	if "foo" != name || 2 != len(tags) || "1" != tags["a"] || "x=y" != tags["b"] {
+		t.Fatal(name, tags)
+	}
+	if name, tags := SplitTaggedName("foo"); "foo" != name || nil != tags {
+		t.Fatal(name, tags)
+	}
+}
+
+func TestSplitTaggedNameEscaped(t *testing.T) {
+	tags := map[string]string{"q": "x;b=c", `k=\`: "v", "e": ""}
+	name, split := SplitTaggedName(TaggedName("req", tags))
+	if "req" != name || !reflect.DeepEqual(tags, split) {
+		t.Errorf("SplitTaggedName(TaggedName()): %q %v\n", name, split)
+	}
+}
+
+func TestTaggedNameCollision(t *testing.T) {
+	r := NewRegistry()
+	escaped := GetOrRegisterCounterT("req", map[string]string{"q": "x;b=c"}, r)
+	plain := GetOrRegisterCounterT("req", map[string]string{"b": "c", "q": "x"}, r)
+	if escaped == plain {
+		t.Fatal("tags differing in escaped characters registered one counter\n")
+	}
+	escaped.Inc(1)
+	if c := r.Get(TaggedName("req", map[string]string{"q": "x;b=c"})); c != escaped {
+		t.Errorf("r.Get(): %v != %v\n", escaped, c)
+	}
+	if c := GetOrRegisterCounterT("req", map[string]string{"q": "x;b=c"}, r); c != escaped {
+		t.Errorf("GetOrRegisterCounterT(): %v != %v\n", escaped, c)
+	}
+	if 2 != len(r.GetAll()) {
+		t.Errorf("series: 2 != %v\n", len(r.GetAll()))
+	}
+}
+
+func TestGetOrRegisterCounterT(t *testing.T) {
+	r := NewRegistry()
+	tags := map[string]string{"endpoint": "/users"}
+	var wg sync.WaitGroup
+	counters := make([]Counter, 16)
+	for i := range counters {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			counters[i] = GetOrRegisterCounterT("requests", tags, r)
+			counters[i].Inc(1)
+		}(i)
+	}
+	wg.Wait()
+	for _, c := range counters[1:] {
+		if c != counters[0] {
+			t.Fatal("concurrent first uses registered more than one counter")
+		}
+	}
+	if count := counters[0].Count(); 16 != count {
+		t.Errorf("count: 16 != %v\n", count)
+	}
+	if tags := counters[0].(Taggable).GetTags(); "/users" != tags["endpoint"] {
+		t.Errorf("tags: %v\n", tags)
+	}
+	if c := r.Get("requests;endpoint=/users"); c != counters[0] {
+		t.Errorf("r.Get(): %v\n", c)
+	}
+	if c := GetOrRegisterCounterT("requests", map[string]string{"endpoint": "/posts"}, r); c == counters[0] {
+		t.Error("other tags returned the same counter")
+	}
+}
+
+func TestTagChangesRenameSnapshots(t *testing.T) {
+	r := NewRegistry()
+	c := GetOrRegisterCounterT("req;tier=web", map[string]string{"a": "1"}, r)
+	c.Inc(1)
+	c.(Taggable).SetTags(map[string]string{"a": "2", "b": "3"})
+	want := "req;a=2;b=3;tier=web"
+	var names []string
+	r.EachSnapshot(func(name string, _ interface{}) { names = append(names, name) })
+	if !reflect.DeepEqual([]string{want}, names) {
+		t.Errorf("EachSnapshot(): %v != %v\n", want, names)
+	}
+	if names := r.Snapshot().Names(); !reflect.DeepEqual([]string{want}, names) {
+		t.Errorf("RegistrySnapshot: %v != %v\n", want, names)
+	}
+	c.(Taggable).RemoveTag("b")
+	if nil == r.SnapshotAndReset().Get("req;a=2;tier=web") {
+		t.Error("SnapshotAndReset(): want the live tags\n")
+	}
+	if r.Get("req;a=1;tier=web") != c {
+		t.Error("Get(): want the name it was registered under\n")
+	}
+}
+
+func TestDynamicTagsRenameSnapshots(t *testing.T) {
+	r := NewRegistry()
+	version := "1.0"
+	h := GetOrRegisterHistogramT("latency", map[string]string{"host": "a"}, r, NewUniformSample(10))
+	d := h.(DynamicTaggable)
+	d.AddDynamicTag("version", func() string { return version })
+	d.AddDynamicTag("host", func() string { return "b" })
+	d.AddDynamicTag("empty", func() string { return "" })
+	names := func() []string {
+		var names []string
+		r.EachSnapshot(func(name string, _ interface{}) { names = append(names, name) })
+		return names
+	}
+	if want := []string{"latency;host=a;version=1.0"}; !reflect.DeepEqual(want, names()) {
+		t.Errorf("EachSnapshot(): %v != %v\n", want, names())
+	}
+	version = "1.1"
+	if want := []string{"latency;host=a;version=1.1"}; !reflect.DeepEqual(want, names()) {
+		t.Errorf("EachSnapshot() after a change: %v != %v\n", want, names())
+	}
+	if r.Get("latency;host=a") != h {
+		t.Error("Get(): want the name without dynamic tags\n")
+	}
+	h.(Taggable).RemoveTag("version")
+	if want := []string{"latency;host=a"}; !reflect.DeepEqual(want, names()) {
+		t.Errorf("EachSnapshot() after RemoveTag: %v != %v\n", want, names())
+	}
+}
+
+func TestGetOrRegisterTaggedTypes(t *testing.T) {
+	r := NewRegistry()
+	tags := map[string]string{"k": "v"}
+	GetOrRegisterGaugeT("gauge", tags, r)
+	GetOrRegisterGaugeFloat64T("gauge_float64", tags, r)
+	GetOrRegisterMergeableGaugeFloat64T("mergeable", tags, r)
+	GetOrRegisterHistogramT("histogram", tags, r, NewUniformSample(10))
+	m := GetOrRegisterMeterT("meter", tags, r)
+	defer m.Stop()
+	tm := GetOrRegisterTimerT("timer", tags, r)
+	defer tm.Stop()
+	for _, name := range []string{"gauge", "gauge_float64", "mergeable", "histogram", "meter", "timer"} {
+		i := r.Get(name + ";k=v")
+		if nil == i {
+			t.Errorf("%s isn't registered with its tags\n", name)
+			continue
+		}
+		if tags := i.(Taggable).GetTags(); "v" != tags["k"] {
+			t.Errorf("%s: tags: %v\n", name, tags)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package metrics
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// A Threshold is a limit on a value read from metrics, e.g. a timer's 99th
+// percentile or a gauge, for load shedding and adaptive concurrency based on
+// the same metrics as are exported.  It's crossed once the value reaches
+// CrossAt and cleared once it's back at ClearAt, so that a value wavering
+// about one limit doesn't flap.  It's a rising threshold if CrossAt is above
+// ClearAt, or equal to it, and a falling one, e.g. for a success rate, if
+// it's below.
+type Threshold struct {
+	Value   func() float64 // Reads the value on each check; NaN leaves the state as it is
+	CrossAt float64        // Value at or beyond which the threshold is crossed
+	ClearAt float64        // Value at or back within which it's cleared
+
+	// Checks is how many checks in a row the value must be at or beyond
+	// CrossAt to cross, or at or within ClearAt to clear.  Zero means one.
+	Checks int
+
+	OnCross func(v float64) // Called with the value when the threshold is crossed, if not nil
+	OnClear func(v float64) // Called with the value when it's cleared, if not nil
+}
+
+// A ThresholdWatch is a Threshold a ThresholdWatcher checks.
+type ThresholdWatch struct {
+	Threshold
+	crossed int32 // 1 if crossed, accessed atomically
+	run     int   // Checks in a row which would change the state, under the watcher's check mutex
+}
+
+// Crossed returns true if the threshold is crossed and not yet cleared.  It's
+// cheap enough to call on every request, e.g. to shed load while it's true.
+func (w *ThresholdWatch) Crossed() bool {
+	return 1 == atomic.LoadInt32(&w.crossed)
+}
+
+// check reads the value and returns the callback to call with it, if any.
+func (w *ThresholdWatch) check() (func(float64), float64) {
+	v := w.Value()
+	if math.IsNaN(v) {
+		return nil, v
+	}
+	rising := w.CrossAt >= w.ClearAt
+	var changes bool
+	if w.Crossed() {
+		changes = rising && v <= w.ClearAt || !rising && v >= w.ClearAt
+	} else {
+		changes = rising && v >= w.CrossAt || !rising && v <= w.CrossAt
+	}
+	if !changes {
+		w.run = 0
+		return nil, v
+	}
+	if w.run++; w.run < w.Checks {
+		return nil, v
+	}
+	w.run = 0
+	if w.Crossed() {
+		atomic.StoreInt32(&w.crossed, 0)
+		return w.OnClear, v
+	}
+	atomic.StoreInt32(&w.crossed, 1)
+	return w.OnCross, v
+}
+
+// ThresholdWatcher checks thresholds, all at once, whenever Check is called
+// or on every tick of Run, and calls their callbacks as they're crossed and
+// cleared.
+type ThresholdWatcher struct {
+	mutex   sync.Mutex // Guards watches
+	watches []*ThresholdWatch
+	check   sync.Mutex // Serializes checks, so that callbacks are called in order
+}
+
+// NewThresholdWatcher constructs a new ThresholdWatcher watching nothing.
+func NewThresholdWatcher() *ThresholdWatcher {
+	return &ThresholdWatcher{}
+}
+
+// Watch starts checking the given threshold, which is clear until a check
+// finds otherwise, and returns its watch.
+func (w *ThresholdWatcher) Watch(t Threshold) *ThresholdWatch {
+	watch := &ThresholdWatch{Threshold: t}
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.watches = append(w.watches, watch)
+	return watch
+}
+
+// Unwatch stops checking the threshold of the given watch, leaving it crossed
+// or clear as it was.
+func (w *ThresholdWatcher) Unwatch(watch *ThresholdWatch) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	for i, other := range w.watches {
+		if other == watch {
+			w.watches = append(w.watches[:i:i], w.watches[i+1:]...)
+			return
+		}
+	}
+}
+
+// Check reads the value of every threshold watched, in the order they were
+// watched, and calls the callbacks of those crossed or cleared, on the calling
+// goroutine after all of them have been read.  Callbacks mustn't call Check.
+func (w *ThresholdWatcher) Check() {
+	w.check.Lock()
+	defer w.check.Unlock()
+	w.mutex.Lock()
+	watches := append([]*ThresholdWatch(nil), w.watches...)
+	w.mutex.Unlock()
+	type call struct {
+		f func(float64)
+		v float64
+	}
+	var calls []call
+	for _, watch := range watches {
+		if f, v := watch.check(); nil != f {
+			calls = append(calls, call{f, v})
+		}
+	}
+	for _, c := range calls {
+		c.f(c.v)
+	}
+}
+
+// Run calls Check every d until stop is closed, or forever if stop is nil.
+// This is designed to be called as a goroutine.
+func (w *ThresholdWatcher) Run(d time.Duration, stop <-chan struct{}) {
+	every(tick(d), stop, nil, func(time.Time) { w.Check() })
+}
@@ -0,0 +1,118 @@
+package metrics
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestThresholdWatcherHysteresis(t *testing.T) {
+	g := NewGauge()
+	var events []string
+	w := NewThresholdWatcher()
+	watch := w.Watch(Threshold{
+		Value:   func() float64 { return float64(g.Value()) },
+		CrossAt: 100,
+		ClearAt: 80,
+		OnCross: func(v float64) { events = append(events, "cross") },
+		OnClear: func(v float64) { events = append(events, "clear") },
+	})
+	for _, v := range []int64{50, 100, 90, 99, 80, 90, 120} {
+		g.Update(v)
+		w.Check()
+	}
+	if want := []string{"cross", "clear", "cross"}; !reflect.DeepEqual(want, events) {
+		t.Errorf("events: %v != %v\n", want, events)
+	}
+	if !watch.Crossed() {
+		t.Error("watch.Crossed(): false\n")
+	}
+}
+
+func TestThresholdWatcherFalling(t *testing.T) {
+	v := 0.99
+	w := NewThresholdWatcher()
+	watch := w.Watch(Threshold{Value: func() float64 { return v }, CrossAt: 0.9, ClearAt: 0.95})
+	w.Check()
+	if watch.Crossed() {
+		t.Error("0.99: crossed\n")
+	}
+	v = 0.85
+	w.Check()
+	if !watch.Crossed() {
+		t.Error("0.85: not crossed\n")
+	}
+	v = 0.93
+	w.Check()
+	if !watch.Crossed() {
+		t.Error("0.93: cleared\n")
+	}
+	v = 0.96
+	w.Check()
+	if watch.Crossed() {
+		t.Error("0.96: crossed\n")
+	}
+}
+
+func TestThresholdWatcherChecks(t *testing.T) {
+	v := 200.0
+	crossed := 0
+	w := NewThresholdWatcher()
+	watch := w.Watch(Threshold{
+		Value:   func() float64 { return v },
+		CrossAt: 100,
+		ClearAt: 100,
+		Checks:  3,
+		OnCross: func(float64) { crossed++ },
+	})
+	w.Check()
+	w.Check()
+	v = math.NaN()
+	w.Check()
+	v = 50
+	w.Check()
+	v = 200
+	w.Check()
+	w.Check()
+	if watch.Crossed() {
+		t.Error("crossed after 2 checks in a row\n")
+	}
+	w.Check()
+	if !watch.Crossed() || 1 != crossed {
+		t.Errorf("after 3 checks in a row: %v, %v\n", watch.Crossed(), crossed)
+	}
+}
+
+func TestThresholdWatcherUnwatch(t *testing.T) {
+	calls := 0
+	w := NewThresholdWatcher()
+	watch := w.Watch(Threshold{Value: func() float64 { calls++; return 0 }})
+	w.Check()
+	w.Unwatch(watch)
+	w.Check()
+	if 1 != calls {
+		t.Errorf("calls: 1 != %v\n", calls)
+	}
+}
+
+func TestThresholdWatcherRun(t *testing.T) {
+	crossed := make(chan float64, 1)
+	w := NewThresholdWatcher()
+	w.Watch(Threshold{
+		Value:   func() float64 { return 1 },
+		CrossAt: 1,
+		OnCross: func(v float64) { crossed <- v },
+	})
+	stop := make(chan struct{})
+	defer close(stop)
+	go w.Run(time.Millisecond, stop)
+	select {
+	case v := <-crossed:
+		if 1 != v {
+			t.Errorf("OnCross(): 1 != %v\n", v)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Run(): never crossed\n")
+	}
+}
@@ -1,6 +1,7 @@
 package metrics
 
 import (
+	"context"
 	"sync"
 	"time"
 )
@@ -8,6 +9,8 @@ import (
 // Timers capture the duration and rate of events.
 type Timer interface {
 	Count() int64
+	Exemplars() []Exemplar
+	IntervalRate() float64
 	Max() int64
 	Mean() float64
 	Min() int64
@@ -18,10 +21,15 @@ type Timer interface {
 	Rate15() float64
 	RateMean() float64
 	Snapshot() Timer
+	Start() Stopwatch
 	StdDev() float64
+	Stop()
 	Sum() int64
 	Time(func())
+	TimeContextWithExemplar(context.Context, func())
 	Update(time.Duration)
+	UpdateAggregate(Aggregate)
+	UpdateN(time.Duration, int64)
 	UpdateSince(time.Time)
 	Variance() float64
 }
@@ -32,12 +40,22 @@ func GetOrRegisterTimer(name string, r Registry) Timer {
 	if nil == r {
 		r = DefaultRegistry
 	}
-	return r.GetOrRegister(name, NewTimer).(Timer)
+	return getOrRegister(r, name, func() Timer { return newTimerIn(name, r) }, NilTimer{}).(Timer)
+}
+
+// GetOrRegisterTimerT returns the existing Timer identified by name and tags
+// together or constructs and registers a new one carrying the tags; see
+// GetOrRegisterCounterT.
+func GetOrRegisterTimerT(name string, tags map[string]string, r Registry) Timer {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	return getOrRegisterTagged(r, name, tags, func() interface{} { return newTimerIn(TaggedName(name, tags), r) }, NilTimer{}).(Timer)
 }
 
 // NewCustomTimer constructs a new StandardTimer from a Histogram and a Meter.
 func NewCustomTimer(h Histogram, m Meter) Timer {
-	if UseNilMetrics {
+	if useNilMetrics() {
 		return NilTimer{}
 	}
 	return &StandardTimer{
@@ -46,12 +64,29 @@ func NewCustomTimer(h Histogram, m Meter) Timer {
 	}
 }
 
+// NewTimerWithExemplars constructs a new StandardTimer like NewTimer which
+// keeps the trace IDs of slow operations timed by TimeContextWithExemplar as
+// exemplars.
+func NewTimerWithExemplars(c ExemplarConfig) Timer {
+	if useNilMetrics() {
+		return NilTimer{}
+	}
+	return &StandardTimer{
+		exemplars: newExemplarRing(c),
+		histogram: NewHistogram(NewExpDecaySample(1028, 0.015)),
+		meter:     NewMeter(),
+	}
+}
+
 // NewRegisteredTimer constructs and registers a new StandardTimer.
 func NewRegisteredTimer(name string, r Registry) Timer {
-	c := NewTimer()
 	if nil == r {
 		r = DefaultRegistry
 	}
+	if usesNilMetrics(r) {
+		return NilTimer{}
+	}
+	c := newTimerIn(name, r)
 	r.Register(name, c)
 	return c
 }
@@ -59,7 +94,7 @@ func NewRegisteredTimer(name string, r Registry) Timer {
 // NewTimer constructs a new StandardTimer using an exponentially-decaying
 // sample with the same reservoir size and alpha as UNIX load averages.
 func NewTimer() Timer {
-	if UseNilMetrics {
+	if useNilMetrics() {
 		return NilTimer{}
 	}
 	return &StandardTimer{
@@ -68,15 +103,48 @@ func NewTimer() Timer {
 	}
 }
 
+// newTimerIn constructs a new StandardTimer like NewTimer which knows it's
+// registered by the given name in r, so that StopWithTags of its Stopwatches
+// can find the timers of the same name with other tags.
+func newTimerIn(name string, r Registry) Timer {
+	t := NewTimer()
+	if s, ok := t.(*StandardTimer); ok {
+		s.family = &timerFamily{name: name, registry: r}
+	}
+	return t
+}
+
+// NewTimerWithSample constructs a new StandardTimer whose durations are kept
+// in the given sample, e.g. a UniformSample for statistics over the whole run
+// rather than biased toward the last five minutes.
+func NewTimerWithSample(s Sample) Timer {
+	return NewCustomTimer(NewHistogram(s), NewMeter())
+}
+
 // NilTimer is a no-op Timer.
 type NilTimer struct {
 	h Histogram
 	m Meter
 }
 
+// AddDynamicTag is a no-op.
+func (NilTimer) AddDynamicTag(string, func() string) error { return nil }
+
+// AddTags is a no-op.
+func (NilTimer) AddTags(map[string]string) {}
+
 // Count is a no-op.
 func (NilTimer) Count() int64 { return 0 }
 
+// Exemplars is a no-op.
+func (NilTimer) Exemplars() []Exemplar { return nil }
+
+// GetTags is a no-op.
+func (NilTimer) GetTags() map[string]string { return nil }
+
+// IntervalRate is a no-op.
+func (NilTimer) IntervalRate() float64 { return 0.0 }
+
 // Max is a no-op.
 func (NilTimer) Max() int64 { return 0 }
 
@@ -106,21 +174,42 @@ func (NilTimer) Rate15() float64 { return 0.0 }
 // RateMean is a no-op.
 func (NilTimer) RateMean() float64 { return 0.0 }
 
+// RemoveTag is a no-op.
+func (NilTimer) RemoveTag(string) {}
+
+// SetTags is a no-op.
+func (NilTimer) SetTags(map[string]string) {}
+
 // Snapshot is a no-op.
 func (NilTimer) Snapshot() Timer { return NilTimer{} }
 
+// Start returns a Stopwatch which records nothing.
+func (NilTimer) Start() Stopwatch { return Stopwatch{timer: NilTimer{}} }
+
 // StdDev is a no-op.
 func (NilTimer) StdDev() float64 { return 0.0 }
 
+// Stop is a no-op.
+func (NilTimer) Stop() {}
+
 // Sum is a no-op.
 func (NilTimer) Sum() int64 { return 0 }
 
 // Time is a no-op.
 func (NilTimer) Time(func()) {}
 
+// TimeContextWithExemplar is a no-op.
+func (NilTimer) TimeContextWithExemplar(context.Context, func()) {}
+
 // Update is a no-op.
 func (NilTimer) Update(time.Duration) {}
 
+// UpdateAggregate is a no-op.
+func (NilTimer) UpdateAggregate(Aggregate) {}
+
+// UpdateN is a no-op.
+func (NilTimer) UpdateN(time.Duration, int64) {}
+
 // UpdateSince is a no-op.
 func (NilTimer) UpdateSince(time.Time) {}
 
@@ -130,6 +219,11 @@ func (NilTimer) Variance() float64 { return 0.0 }
 // StandardTimer is the standard implementation of a Timer and uses a Histogram
 // and Meter.
 type StandardTimer struct {
+	tagSet
+	lastUpdate
+
+	exemplars *exemplarRing
+	family    *timerFamily // nil unless made by GetOrRegisterTimer and the like
 	histogram Histogram
 	meter     Meter
 	mutex     sync.Mutex
@@ -140,6 +234,29 @@ func (t *StandardTimer) Count() int64 {
 	return t.histogram.Count()
 }
 
+// Exemplars returns the most recent exemplars kept by
+// TimeContextWithExemplar, oldest first, or nil if the timer wasn't
+// constructed by NewTimerWithExemplars.
+func (t *StandardTimer) Exemplars() []Exemplar {
+	if nil == t.exemplars {
+		return nil
+	}
+	return t.exemplars.values()
+}
+
+// IntervalRate returns the rate of events per second over the latest complete
+// five-second interval of the timer's meter: the events counted in that
+// interval divided by its length, rather than a moving average.  It's zero
+// until the first interval completes, and after any interval in which nothing
+// happened.  It's noisier than the moving averages but responds within an
+// interval to changes in traffic, which makes it useful for short-lived
+// processes and tests.  The intervals follow the clock set by SetClock rather
+// than reads, so any number of consumers may read it, or take snapshots, and
+// see the same rate.
+func (t *StandardTimer) IntervalRate() float64 {
+	return intervalRateOf(t.meter.Snapshot())
+}
+
 // Max returns the maximum value in the sample.
 func (t *StandardTimer) Max() int64 {
 	return t.histogram.Max()
@@ -190,10 +307,82 @@ func (t *StandardTimer) RateMean() float64 {
 func (t *StandardTimer) Snapshot() Timer {
 	t.mutex.Lock()
 	defer t.mutex.Unlock()
-	return &TimerSnapshot{
+	s := &TimerSnapshot{
+		exemplars: t.Exemplars(),
 		histogram: t.histogram.Snapshot().(*HistogramSnapshot),
 		meter:     t.meter.Snapshot().(*MeterSnapshot),
+		tags:      t.resolve(),
+		timestamp: now(),
+	}
+	s.intervalRate = s.meter.intervalRate
+	return s
+}
+
+// ReadInto copies the timer into s, as Snapshot would, reusing the histogram
+// and meter snapshots s holds from a previous call; see
+// StandardHistogram.ReadInto.
+func (t *StandardTimer) ReadInto(s *TimerSnapshot) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	s.exemplars = t.Exemplars()
+	if h, ok := t.histogram.(interface{ ReadInto(*HistogramSnapshot) }); ok {
+		if nil == s.histogram {
+			s.histogram = &HistogramSnapshot{}
+		}
+		h.ReadInto(s.histogram)
+	} else {
+		s.histogram = t.histogram.Snapshot().(*HistogramSnapshot)
+	}
+	if m, ok := t.meter.(interface{ ReadInto(*MeterSnapshot) }); ok {
+		if nil == s.meter {
+			s.meter = &MeterSnapshot{}
+		}
+		m.ReadInto(s.meter)
+	} else {
+		s.meter = t.meter.Snapshot().(*MeterSnapshot)
+	}
+	s.intervalRate = s.meter.intervalRate
+	s.tags = t.resolve()
+	s.timestamp = now()
+}
+
+// snapshotAndReset returns a read-only copy of the timer and atomically clears
+// its histogram.  The meter, and with it the rates, carries on regardless.
+func (t *StandardTimer) snapshotAndReset() interface{} {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	var histogram *HistogramSnapshot
+	if h, ok := t.histogram.(resettable); ok {
+		histogram = h.snapshotAndReset().(*HistogramSnapshot)
+	} else {
+		histogram = t.histogram.Snapshot().(*HistogramSnapshot)
+		t.histogram.Clear()
+	}
+	snapshot := &TimerSnapshot{
+		exemplars: t.Exemplars(),
+		histogram: histogram,
+		meter:     t.meter.Snapshot().(*MeterSnapshot),
+		tags:      t.resolve(),
+		timestamp: now(),
 	}
+	snapshot.intervalRate = snapshot.meter.intervalRate
+	return snapshot
+}
+
+// reset clears the timer's histogram and resets its meter, for
+// Registry.ResetAll.
+func (t *StandardTimer) reset() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.histogram.Clear()
+	if m, ok := t.meter.(interface{ reset() }); ok {
+		m.reset()
+	}
+}
+
+// Start returns a Stopwatch timing an operation from now until it's stopped.
+func (t *StandardTimer) Start() Stopwatch {
+	return Stopwatch{timer: t, started: now()}
 }
 
 // StdDev returns the standard deviation of the values in the sample.
@@ -201,6 +390,13 @@ func (t *StandardTimer) StdDev() float64 {
 	return t.histogram.StdDev()
 }
 
+// Stop stops the timer's meter, and its histogram if that has a ticker, so
+// that the timer can be garbage collected.  Its rates stop decaying.
+func (t *StandardTimer) Stop() {
+	stopMetric(t.meter)
+	stopMetric(t.histogram)
+}
+
 // Sum returns the sum in the sample.
 func (t *StandardTimer) Sum() int64 {
 	return t.histogram.Sum()
@@ -208,24 +404,66 @@ func (t *StandardTimer) Sum() int64 {
 
 // Record the duration of the execution of the given function.
 func (t *StandardTimer) Time(f func()) {
-	ts := time.Now()
+	ts := now()
 	f()
-	t.Update(time.Since(ts))
+	t.Update(since(ts))
+}
+
+// Record the duration of the execution of the given function like Time and,
+// if it exceeds the timer's exemplar threshold, keep it as an exemplar along
+// with the trace ID found in the context.
+func (t *StandardTimer) TimeContextWithExemplar(ctx context.Context, f func()) {
+	ts := now()
+	f()
+	d := since(ts)
+	t.Update(d)
+	if nil != t.exemplars {
+		t.exemplars.update(d, ctx.Value(t.exemplars.config.ContextKey))
+	}
 }
 
 // Record the duration of an event.
 func (t *StandardTimer) Update(d time.Duration) {
+	t.touch()
 	t.mutex.Lock()
 	defer t.mutex.Unlock()
 	t.histogram.Update(int64(d))
 	t.meter.Mark(1)
 }
 
-// Record the duration of an event that started at a time and ends now.
+// Record a block of events from the count, sum, min and max of their
+// durations in nanoseconds; see Aggregate.
+func (t *StandardTimer) UpdateAggregate(a Aggregate) {
+	if a.Count <= 0 {
+		return
+	}
+	t.touch()
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.histogram.UpdateAggregate(a)
+	t.meter.Mark(a.Count)
+}
+
+// Record n events of the same duration at once, e.g. those of a batch timed
+// as a whole.
+func (t *StandardTimer) UpdateN(d time.Duration, n int64) {
+	if n <= 0 {
+		return
+	}
+	t.touch()
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.histogram.UpdateN(int64(d), n)
+	t.meter.Mark(n)
+}
+
+// Record the duration of an event that started at a time and ends now, by
+// the clock set by SetClock.
 func (t *StandardTimer) UpdateSince(ts time.Time) {
+	t.touch()
 	t.mutex.Lock()
 	defer t.mutex.Unlock()
-	t.histogram.Update(int64(time.Since(ts)))
+	t.histogram.Update(int64(since(ts)))
 	t.meter.Mark(1)
 }
 
@@ -234,16 +472,64 @@ func (t *StandardTimer) Variance() float64 {
 	return t.histogram.Variance()
 }
 
+// intervalRateOf returns the rate over the latest complete interval of a meter
+// snapshot, or zero if the meter keeps none.
+func intervalRateOf(m Meter) float64 {
+	if s, ok := m.(*MeterSnapshot); ok {
+		return s.intervalRate
+	}
+	return 0
+}
+
 // TimerSnapshot is a read-only copy of another Timer.
 type TimerSnapshot struct {
-	histogram *HistogramSnapshot
-	meter     *MeterSnapshot
+	exemplars    []Exemplar
+	histogram    *HistogramSnapshot
+	meter        *MeterSnapshot
+	intervalRate float64
+	tags         Tags
+	timestamp    time.Time
+}
+
+// AddTags panics.
+func (*TimerSnapshot) AddTags(map[string]string) {
+	panic("AddTags called on a TimerSnapshot")
+}
+
+// Buckets returns cumulative bucket counts of the durations, in nanoseconds,
+// at the time the snapshot was taken, like HistogramSnapshot.Buckets.
+func (t *TimerSnapshot) Buckets(bounds []float64) []uint64 {
+	return t.histogram.Buckets(bounds)
 }
 
 // Count returns the number of events recorded at the time the snapshot was
 // taken.
 func (t *TimerSnapshot) Count() int64 { return t.histogram.Count() }
 
+// Exemplars returns the exemplars kept at the time the snapshot was taken.
+func (t *TimerSnapshot) Exemplars() []Exemplar { return t.exemplars }
+
+// GetTags returns a copy of the tags the timer had at the time the snapshot was
+// taken.
+func (t *TimerSnapshot) GetTags() map[string]string { return t.tags.Map() }
+
+// RemoveTag panics.
+func (*TimerSnapshot) RemoveTag(string) {
+	panic("RemoveTag called on a TimerSnapshot")
+}
+
+// SetTags panics.
+func (*TimerSnapshot) SetTags(map[string]string) {
+	panic("SetTags called on a TimerSnapshot")
+}
+
+// Tags returns the tags the timer had at the time the snapshot was taken.
+func (t *TimerSnapshot) Tags() Tags { return t.tags }
+
+// IntervalRate returns the rate of events per second over the latest complete
+// interval of the timer's meter at the time the snapshot was taken.
+func (t *TimerSnapshot) IntervalRate() float64 { return t.intervalRate }
+
 // Max returns the maximum value at the time the snapshot was taken.
 func (t *TimerSnapshot) Max() int64 { return t.histogram.Max() }
 
@@ -284,10 +570,18 @@ func (t *TimerSnapshot) RateMean() float64 { return t.meter.RateMean() }
 // Snapshot returns the snapshot.
 func (t *TimerSnapshot) Snapshot() Timer { return t }
 
+// Start panics.
+func (*TimerSnapshot) Start() Stopwatch {
+	panic("Start called on a TimerSnapshot")
+}
+
 // StdDev returns the standard deviation of the values at the time the snapshot
 // was taken.
 func (t *TimerSnapshot) StdDev() float64 { return t.histogram.StdDev() }
 
+// Stop is a no-op.
+func (*TimerSnapshot) Stop() {}
+
 // Sum returns the sum at the time the snapshot was taken.
 func (t *TimerSnapshot) Sum() int64 { return t.histogram.Sum() }
 
@@ -296,11 +590,30 @@ func (*TimerSnapshot) Time(func()) {
 	panic("Time called on a TimerSnapshot")
 }
 
+// Timestamp returns the time the snapshot was taken, by the clock set by
+// SetClock.
+func (t *TimerSnapshot) Timestamp() time.Time { return t.timestamp }
+
+// TimeContextWithExemplar panics.
+func (*TimerSnapshot) TimeContextWithExemplar(context.Context, func()) {
+	panic("TimeContextWithExemplar called on a TimerSnapshot")
+}
+
 // Update panics.
 func (*TimerSnapshot) Update(time.Duration) {
 	panic("Update called on a TimerSnapshot")
 }
 
+// UpdateAggregate panics.
+func (*TimerSnapshot) UpdateAggregate(Aggregate) {
+	panic("UpdateAggregate called on a TimerSnapshot")
+}
+
+// UpdateN panics.
+func (*TimerSnapshot) UpdateN(time.Duration, int64) {
+	panic("UpdateN called on a TimerSnapshot")
+}
+
 // UpdateSince panics.
 func (*TimerSnapshot) UpdateSince(time.Time) {
 	panic("UpdateSince called on a TimerSnapshot")
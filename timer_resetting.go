@@ -0,0 +1,82 @@
+package metrics
+
+// ResettingTimerMode selects how a ResettingTimer computes its percentiles.
+type ResettingTimerMode int
+
+const (
+	// ExactReservoir keeps the values recorded since the last reset, up to
+	// ResettingTimerReservoirSize of them, and sorts them to compute the
+	// percentiles of a snapshot.  They're exact as long as the timer records
+	// no more values between resets than that, which suits timers of a
+	// modest rate; past it, the reservoir holds a uniform sample of them.
+	ExactReservoir ResettingTimerMode = iota
+
+	// StreamingSketch counts the values into a DDSketchSample of
+	// DefaultResettingTimerAccuracy as they're recorded, so that memory
+	// grows only with the logarithm of their range and a snapshot sorts
+	// nothing, which suits the timers of the hottest paths.  Its percentiles
+	// are within DefaultResettingTimerAccuracy of the exact ones, relative to
+	// their value, however many values are recorded; Count, Min, Max, Sum
+	// and Mean stay exact.
+	StreamingSketch
+)
+
+// DefaultResettingTimerAccuracy is the relative accuracy of the percentiles
+// of a ResettingTimer in StreamingSketch mode.
+const DefaultResettingTimerAccuracy = 0.01
+
+// ResettingTimerReservoirSize bounds the values a ResettingTimer in
+// ExactReservoir mode keeps between resets.
+const ResettingTimerReservoirSize = 4096
+
+// ResettingTimer is a StandardTimer whose histogram describes the values
+// recorded since it was last reset, rather than decaying over time, for
+// reporters which reset what they report, as StandardRegistry.SnapshotAndReset
+// does.  Its Snapshot, like any other, leaves it as it is, so that reading it
+// elsewhere doesn't take values from the reporter.  Its meter, and with it
+// the rates, carries on regardless of resets.
+type ResettingTimer struct {
+	*StandardTimer
+	mode ResettingTimerMode
+}
+
+// GetOrRegisterResettingTimer returns an existing Timer or constructs and
+// registers a new ResettingTimer of the given mode.
+func GetOrRegisterResettingTimer(name string, r Registry, mode ResettingTimerMode) Timer {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	return getOrRegister(r, name, func() Timer { return NewResettingTimer(mode) }, NilTimer{}).(Timer)
+}
+
+// NewRegisteredResettingTimer constructs and registers a new ResettingTimer
+// of the given mode.
+func NewRegisteredResettingTimer(name string, r Registry, mode ResettingTimerMode) Timer {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	if usesNilMetrics(r) {
+		return NilTimer{}
+	}
+	t := NewResettingTimer(mode)
+	r.Register(name, t)
+	return t
+}
+
+// NewResettingTimer constructs a new ResettingTimer of the given mode.
+func NewResettingTimer(mode ResettingTimerMode) Timer {
+	if useNilMetrics() {
+		return NilTimer{}
+	}
+	s := NewUniformSample(ResettingTimerReservoirSize)
+	if StreamingSketch == mode {
+		s = NewDDSketchSample(DefaultResettingTimerAccuracy)
+	}
+	return &ResettingTimer{
+		StandardTimer: NewCustomTimer(NewHistogram(s), NewMeter()).(*StandardTimer),
+		mode:          mode,
+	}
+}
+
+// Mode returns the mode the timer was constructed with.
+func (t *ResettingTimer) Mode() ResettingTimerMode { return t.mode }
@@ -0,0 +1,82 @@
+package metrics
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestResettingTimerModes(t *testing.T) {
+	exact, streaming := NewResettingTimer(ExactReservoir), NewResettingTimer(StreamingSketch)
+	rng := rand.New(rand.NewSource(1))
+	var values []int64
+	for i := 0; i < ResettingTimerReservoirSize; i++ {
+		d := time.Duration(math.Exp(rng.NormFloat64()) * float64(time.Millisecond))
+		exact.Update(d)
+		streaming.Update(d)
+		values = append(values, int64(d))
+	}
+	sort.Sort(int64Slice(values))
+	ps := []float64{0.5, 0.75, 0.95, 0.99, 0.999}
+	e, s := exact.Snapshot(), streaming.Snapshot()
+	if e.Count() != s.Count() || e.Min() != s.Min() || e.Max() != s.Max() || e.Sum() != s.Sum() {
+		t.Errorf("exact %v %v %v %v != streaming %v %v %v %v\n", e.Count(), e.Min(), e.Max(), e.Sum(), s.Count(), s.Min(), s.Max(), s.Sum())
+	}
+	want := SamplePercentiles(values, ps)
+	for i, got := range e.Percentiles(ps) {
+		if want[i] != got {
+			t.Errorf("p%v: exact %v != %v\n", ps[i], got, want[i])
+		}
+	}
+	// The sketch's percentiles are of the value at each rank, which the
+	// exact ones interpolate between.
+	for i, got := range s.Percentiles(ps) {
+		want := float64(values[int(math.Ceil(ps[i]*float64(len(values))))-1])
+		if math.Abs(got-want) > DefaultResettingTimerAccuracy*want {
+			t.Errorf("p%v: streaming %v not within %v of exact %v\n", ps[i], got, DefaultResettingTimerAccuracy, want)
+		}
+	}
+}
+
+func TestResettingTimerExactReservoirIsBounded(t *testing.T) {
+	timer := NewResettingTimer(ExactReservoir)
+	for i := 0; i < 2*ResettingTimerReservoirSize; i++ {
+		timer.Update(time.Duration(i))
+	}
+	s := timer.Snapshot().(*TimerSnapshot)
+	if count := s.Count(); 2*ResettingTimerReservoirSize != count {
+		t.Errorf("count: %v != %v\n", 2*ResettingTimerReservoirSize, count)
+	}
+	if size := s.histogram.Sample().Size(); ResettingTimerReservoirSize != size {
+		t.Errorf("size: %v != %v\n", ResettingTimerReservoirSize, size)
+	}
+}
+
+func TestResettingTimerResetsOnlyWhenReported(t *testing.T) {
+	r := NewRegistry()
+	timer := NewRegisteredResettingTimer("latency", r, StreamingSketch)
+	timer.Update(time.Millisecond)
+	if count := timer.Snapshot().Count(); 1 != count {
+		t.Errorf("count: 1 != %v\n", count)
+	}
+	if count := timer.Snapshot().Count(); 1 != count {
+		t.Errorf("count after a snapshot: 1 != %v\n", count)
+	}
+	var counts []int64
+	for i := 0; i < 2; i++ {
+		r.(*StandardRegistry).SnapshotAndReset().Each(func(name string, i interface{}) {
+			counts = append(counts, i.(Timer).Count())
+		})
+	}
+	if 2 != len(counts) || 1 != counts[0] || 0 != counts[1] {
+		t.Errorf("counts: %v\n", counts)
+	}
+	if mode := timer.(*ResettingTimer).Mode(); StreamingSketch != mode {
+		t.Errorf("Mode(): %v\n", mode)
+	}
+	if GetOrRegisterResettingTimer("latency", r, ExactReservoir) != timer {
+		t.Error("GetOrRegisterResettingTimer(): want the registered timer\n")
+	}
+}
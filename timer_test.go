@@ -1,6 +1,7 @@
 package metrics
 
 import (
+	"context"
 	"fmt"
 	"math"
 	"testing"
@@ -32,6 +33,25 @@ func TestTimerExtremes(t *testing.T) {
 	}
 }
 
+func TestTimerUpdateN(t *testing.T) {
+	tm := NewTimer()
+	defer tm.Stop()
+	tm.UpdateN(time.Millisecond, 50)
+	tm.UpdateAggregate(Aggregate{Count: 3, Sum: int64(6 * time.Millisecond), Min: int64(time.Millisecond), Max: int64(3 * time.Millisecond)})
+	if count := tm.Count(); 53 != count {
+		t.Errorf("tm.Count(): 53 != %v\n", count)
+	}
+	if sum := tm.Sum(); int64(56*time.Millisecond) != sum {
+		t.Errorf("tm.Sum(): 56ms != %v\n", time.Duration(sum))
+	}
+	if max := tm.Max(); int64(3*time.Millisecond) != max {
+		t.Errorf("tm.Max(): 3ms != %v\n", time.Duration(max))
+	}
+	if count := tm.(*StandardTimer).meter.Count(); 53 != count {
+		t.Errorf("meter.Count(): 53 != %v\n", count)
+	}
+}
+
 func TestTimerFunc(t *testing.T) {
 	tm := NewTimer()
 	tm.Time(func() { time.Sleep(50e6) })
@@ -87,3 +107,136 @@ func ExampleGetOrRegisterTimer() {
 	t.Update(47)
 	fmt.Println(t.Max()) // Output: 47
 }
+
+func TestTimerIntervalRate(t *testing.T) {
+	clock := &stepClock{now: time.Unix(100, 0)}
+	SetClock(clock)
+	defer SetClock(nil)
+	tm := NewTimer()
+	tm.UpdateN(time.Millisecond, 10)
+	if rate := tm.IntervalRate(); 0.0 != rate {
+		t.Errorf("tm.IntervalRate() within the first interval: 0.0 != %v\n", rate)
+	}
+	clock.now = clock.now.Add(5 * time.Second)
+	tm.UpdateN(time.Millisecond, 5)
+	if rate := tm.IntervalRate(); 2.0 != rate {
+		t.Errorf("tm.IntervalRate(): 2.0 != %v\n", rate)
+	}
+	clock.now = clock.now.Add(5 * time.Second)
+	if rate := tm.IntervalRate(); 1.0 != rate {
+		t.Errorf("tm.IntervalRate(): 1.0 != %v\n", rate)
+	}
+	clock.now = clock.now.Add(10 * time.Second)
+	if rate := tm.IntervalRate(); 0.0 != rate {
+		t.Errorf("tm.IntervalRate() after an idle interval: 0.0 != %v\n", rate)
+	}
+}
+
+func TestTimerIntervalRateConsumers(t *testing.T) {
+	clock := &stepClock{now: time.Unix(100, 0)}
+	SetClock(clock)
+	defer SetClock(nil)
+	tm := NewTimer().(*StandardTimer)
+	tm.UpdateN(time.Millisecond, 10)
+	clock.now = clock.now.Add(6 * time.Second)
+	var into TimerSnapshot
+	for i := 0; i < 3; i++ {
+		clock.now = clock.now.Add(time.Second)
+		exporter := tm.Snapshot()
+		tm.ReadInto(&into)
+		if a, b, c := exporter.IntervalRate(), into.IntervalRate(), tm.IntervalRate(); 2.0 != a || 2.0 != b || 2.0 != c {
+			t.Errorf("read %d: Snapshot %v, ReadInto %v, IntervalRate %v, all != 2.0\n", i, a, b, c)
+		}
+	}
+}
+
+type traceIDKey struct{}
+
+func TestTimerExemplars(t *testing.T) {
+	tm := NewTimerWithExemplars(ExemplarConfig{
+		ContextKey: traceIDKey{},
+		Threshold:  5 * time.Millisecond,
+		Size:       2,
+	})
+	for _, id := range []string{"a", "b", "c"} {
+		ctx := context.WithValue(context.Background(), traceIDKey{}, id)
+		tm.TimeContextWithExemplar(ctx, func() { time.Sleep(10 * time.Millisecond) })
+	}
+	tm.TimeContextWithExemplar(context.WithValue(context.Background(), traceIDKey{}, "fast"), func() {})
+	tm.TimeContextWithExemplar(context.Background(), func() { time.Sleep(10 * time.Millisecond) })
+	if count := tm.Count(); 5 != count {
+		t.Errorf("tm.Count(): 5 != %v\n", count)
+	}
+	exemplars := tm.Snapshot().Exemplars()
+	if 2 != len(exemplars) || "b" != exemplars[0].TraceID || "c" != exemplars[1].TraceID {
+		t.Fatal(exemplars)
+	}
+	if exemplars[0].Value < int64(10*time.Millisecond) {
+		t.Error(exemplars[0])
+	}
+}
+
+func TestTimerWithoutExemplars(t *testing.T) {
+	tm := NewTimer()
+	ctx := context.WithValue(context.Background(), traceIDKey{}, "a")
+	tm.TimeContextWithExemplar(ctx, func() {})
+	if count := tm.Count(); 1 != count {
+		t.Errorf("tm.Count(): 1 != %v\n", count)
+	}
+	if exemplars := tm.Exemplars(); nil != exemplars {
+		t.Fatal(exemplars)
+	}
+}
+
+func TestTimerSnapshotTags(t *testing.T) {
+	tm := NewTimer()
+	defer tm.Stop()
+	tm.(Taggable).AddTags(map[string]string{"endpoint": "/users"})
+	tm.(DynamicTaggable).AddDynamicTag("version", func() string { return "1.0" })
+	tm.Update(time.Millisecond)
+	snapshot := tm.Snapshot()
+	if tags := snapshot.(Taggable).GetTags(); "/users" != tags["endpoint"] || "1.0" != tags["version"] {
+		t.Errorf("snapshot.GetTags(): %v\n", tags)
+	}
+	if count := snapshot.Count(); 1 != count {
+		t.Errorf("snapshot.Count(): 1 != %v\n", count)
+	}
+}
+
+func TestTimerStop(t *testing.T) {
+	tm := NewTimer()
+	tm.Stop()
+	if meterTicked(tm.(*StandardTimer).meter.(*StandardMeter)) {
+		t.Fatal("meter still ticked")
+	}
+	tm.Update(time.Millisecond)
+	if count := tm.Count(); 1 != count {
+		t.Errorf("tm.Count(): 1 != %v\n", count)
+	}
+}
+
+func TestTimerSnapshotBuckets(t *testing.T) {
+	tm := NewTimer()
+	tm.Update(time.Millisecond)
+	tm.Update(3 * time.Millisecond)
+	b := tm.Snapshot().(*TimerSnapshot).Buckets([]float64{float64(time.Millisecond), float64(2 * time.Millisecond)})
+	if 2 != len(b) || 1 != b[0] || 1 != b[1] {
+		t.Errorf("Buckets(): [1 1] != %v\n", b)
+	}
+}
+
+func TestTimerWithSample(t *testing.T) {
+	tm := NewTimerWithSample(NewUniformSample(10))
+	for i := 1; i <= 100; i++ {
+		tm.Update(time.Duration(i))
+	}
+	if count := tm.Count(); 100 != count {
+		t.Errorf("tm.Count(): 100 != %v\n", count)
+	}
+	if max := tm.Max(); max > 100 || max < 1 {
+		t.Errorf("tm.Max(): %v\n", max)
+	}
+	if size := tm.(*StandardTimer).histogram.Sample().Size(); 10 != size {
+		t.Errorf("sample size: 10 != %v\n", size)
+	}
+}
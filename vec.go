@@ -0,0 +1,208 @@
+package metrics
+
+import (
+	"fmt"
+	"sync"
+)
+
+// CounterVec is a family of Counters by the same name, one for each
+// combination of values of a fixed list of tag keys.  With finds or registers
+// the counter of some values once and caches it, so that recording on a hot
+// path needs neither a map of tags nor a lookup in the registry.
+type CounterVec struct {
+	vec
+}
+
+// NewCounterVec constructs a new CounterVec of counters registered in r, or
+// DefaultRegistry if r is nil, by the given name and tag keys.
+func NewCounterVec(name string, r Registry, tagKeys ...string) *CounterVec {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	return &CounterVec{newVec(name, tagKeys, func(tags map[string]string) interface{} {
+		return GetOrRegisterCounterT(name, tags, r)
+	})}
+}
+
+// With returns the Counter of the given tag values, which are in the order
+// of the vector's tag keys.  It panics if their number differs from that of
+// the keys.
+func (v *CounterVec) With(tagValues ...string) Counter {
+	return v.with(tagValues).(Counter)
+}
+
+// GaugeVec is a family of Gauges by the same name; see CounterVec.
+type GaugeVec struct {
+	vec
+}
+
+// NewGaugeVec constructs a new GaugeVec of gauges registered in r, or
+// DefaultRegistry if r is nil, by the given name and tag keys.
+func NewGaugeVec(name string, r Registry, tagKeys ...string) *GaugeVec {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	return &GaugeVec{newVec(name, tagKeys, func(tags map[string]string) interface{} {
+		return GetOrRegisterGaugeT(name, tags, r)
+	})}
+}
+
+// With returns the Gauge of the given tag values; see CounterVec.With.
+func (v *GaugeVec) With(tagValues ...string) Gauge {
+	return v.with(tagValues).(Gauge)
+}
+
+// MeterVec is a family of Meters by the same name; see CounterVec.
+type MeterVec struct {
+	vec
+}
+
+// NewMeterVec constructs a new MeterVec of meters registered in r, or
+// DefaultRegistry if r is nil, by the given name and tag keys.
+func NewMeterVec(name string, r Registry, tagKeys ...string) *MeterVec {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	return &MeterVec{newVec(name, tagKeys, func(tags map[string]string) interface{} {
+		return GetOrRegisterMeterT(name, tags, r)
+	})}
+}
+
+// With returns the Meter of the given tag values; see CounterVec.With.
+func (v *MeterVec) With(tagValues ...string) Meter {
+	return v.with(tagValues).(Meter)
+}
+
+// TimerVec is a family of Timers by the same name; see CounterVec.
+type TimerVec struct {
+	vec
+}
+
+// NewTimerVec constructs a new TimerVec of timers registered in r, or
+// DefaultRegistry if r is nil, by the given name and tag keys.
+func NewTimerVec(name string, r Registry, tagKeys ...string) *TimerVec {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	return &TimerVec{newVec(name, tagKeys, func(tags map[string]string) interface{} {
+		return GetOrRegisterTimerT(name, tags, r)
+	})}
+}
+
+// With returns the Timer of the given tag values; see CounterVec.With.
+func (v *TimerVec) With(tagValues ...string) Timer {
+	return v.with(tagValues).(Timer)
+}
+
+// vec caches the metrics of a vector by a hash of their tag values, keeping
+// the values alongside to tell apart those which collide.  A metric stays
+// cached once it's been found, so it keeps being updated if it's later
+// unregistered, e.g. by a registry's TTL; call Delete when a combination of
+// values is done with.
+type vec struct {
+	name      string
+	keys      []string
+	newMetric func(map[string]string) interface{}
+
+	mutex   sync.RWMutex
+	metrics map[uint64][]vecEntry
+}
+
+type vecEntry struct {
+	values []string
+	metric interface{}
+}
+
+func newVec(name string, keys []string, newMetric func(map[string]string) interface{}) vec {
+	return vec{
+		name:      name,
+		keys:      append([]string(nil), keys...),
+		newMetric: newMetric,
+		metrics:   make(map[uint64][]vecEntry),
+	}
+}
+
+// Delete forgets the metric of the given tag values, so that With registers
+// it anew next time, e.g. after it's been unregistered.  It doesn't
+// unregister it.
+func (v *vec) Delete(tagValues ...string) {
+	v.check(tagValues)
+	h := hashValues(tagValues)
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	entries := v.metrics[h]
+	for i, e := range entries {
+		if equalValues(e.values, tagValues) {
+			entries = append(entries[:i:i], entries[i+1:]...)
+			break
+		}
+	}
+	if 0 == len(entries) {
+		delete(v.metrics, h)
+	} else {
+		v.metrics[h] = entries
+	}
+}
+
+func (v *vec) with(values []string) interface{} {
+	v.check(values)
+	h := hashValues(values)
+	v.mutex.RLock()
+	for _, e := range v.metrics[h] {
+		if equalValues(e.values, values) {
+			v.mutex.RUnlock()
+			return e.metric
+		}
+	}
+	v.mutex.RUnlock()
+
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	for _, e := range v.metrics[h] {
+		if equalValues(e.values, values) {
+			return e.metric
+		}
+	}
+	tags := make(map[string]string, len(v.keys))
+	for i, k := range v.keys {
+		tags[k] = values[i]
+	}
+	e := vecEntry{values: append([]string(nil), values...), metric: v.newMetric(tags)}
+	v.metrics[h] = append(v.metrics[h], e)
+	return e.metric
+}
+
+func (v *vec) check(values []string) {
+	if len(values) != len(v.keys) {
+		panic(fmt.Sprintf("metrics: %d tag values for %s, which has %d tag keys", len(values), v.name, len(v.keys)))
+	}
+}
+
+// The parameters of the 64-bit FNV-1a hash.
+const (
+	fnvOffset = 14695981039346656037
+	fnvPrime  = 1099511628211
+)
+
+// hashValues returns the 64-bit FNV-1a hash of the values, each followed by a
+// zero byte so that ("ab", "c") and ("a", "bc") differ.
+func hashValues(values []string) uint64 {
+	h := uint64(fnvOffset)
+	for _, s := range values {
+		for i := 0; i < len(s); i++ {
+			h ^= uint64(s[i])
+			h *= fnvPrime
+		}
+		h *= fnvPrime
+	}
+	return h
+}
+
+func equalValues(a, b []string) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,88 @@
+package metrics
+
+import "testing"
+
+func BenchmarkCounterVecWith(b *testing.B) {
+	v := NewCounterVec("requests", NewRegistry(), "method", "status")
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		v.With("GET", "2xx").Inc(1)
+	}
+}
+
+func TestCounterVec(t *testing.T) {
+	r := NewRegistry()
+	v := NewCounterVec("requests", r, "method", "status")
+	v.With("GET", "2xx").Inc(1)
+	v.With("GET", "2xx").Inc(2)
+	v.With("POST", "5xx").Inc(1)
+	if c := GetOrRegisterCounterT("requests", map[string]string{"method": "GET", "status": "2xx"}, r); 3 != c.Count() {
+		t.Errorf("c.Count(): 3 != %v\n", c.Count())
+	}
+	if c := GetOrRegisterCounterT("requests", map[string]string{"method": "POST", "status": "5xx"}, r); 1 != c.Count() {
+		t.Errorf("c.Count(): 1 != %v\n", c.Count())
+	}
+	if v.With("GET", "2xx") != v.With("GET", "2xx") {
+		t.Error("With returned different counters for the same values")
+	}
+}
+
+func TestCounterVecWithDoesNotAllocate(t *testing.T) {
+	v := NewCounterVec("requests", NewRegistry(), "method", "status")
+	v.With("GET", "2xx")
+	if n := testing.AllocsPerRun(100, func() { v.With("GET", "2xx").Inc(1) }); 0 != n {
+		t.Errorf("allocs: 0 != %v\n", n)
+	}
+}
+
+func TestVecValuesDoNotRunTogether(t *testing.T) {
+	v := NewCounterVec("x", NewRegistry(), "a", "b")
+	v.With("ab", "c").Inc(1)
+	if c := v.With("a", "bc"); 0 != c.Count() {
+		t.Errorf("c.Count(): 0 != %v\n", c.Count())
+	}
+}
+
+func TestVecCollisions(t *testing.T) {
+	v := NewCounterVec("x", NewRegistry(), "a")
+	h := hashValues([]string{"foo"})
+	// Plant another metric under the same hash to exercise the comparison.
+	v.metrics[h] = append(v.metrics[h], vecEntry{values: []string{"bar"}, metric: NewCounter()})
+	v.With("foo").Inc(1)
+	if c := v.With("foo"); 1 != c.Count() {
+		t.Errorf("c.Count(): 1 != %v\n", c.Count())
+	}
+	v.Delete("foo")
+	if entries := v.metrics[h]; 1 != len(entries) || "bar" != entries[0].values[0] {
+		t.Errorf("v.metrics[h]: %v\n", entries)
+	}
+}
+
+func TestVecDelete(t *testing.T) {
+	r := NewRegistry()
+	v := NewMeterVec("events", r, "kind")
+	m := v.With("click")
+	r.Unregister(TaggedName("events", map[string]string{"kind": "click"}))
+	v.Delete("click")
+	if v.With("click") == m {
+		t.Error("With returned the deleted meter")
+	}
+}
+
+func TestVecWrongNumberOfValues(t *testing.T) {
+	defer func() {
+		if nil == recover() {
+			t.Error("With didn't panic")
+		}
+	}()
+	NewTimerVec("latency", NewRegistry(), "route").With("/a", "GET")
+}
+
+func TestGaugeVecNilMetrics(t *testing.T) {
+	SetUseNilMetrics(true)
+	defer SetUseNilMetrics(false)
+	if _, ok := NewGaugeVec("depth", NewRegistry(), "queue").With("jobs").(NilGauge); !ok {
+		t.Error("With didn't return a NilGauge")
+	}
+}
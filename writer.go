@@ -1,6 +1,7 @@
 package metrics
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"sort"
@@ -10,16 +11,26 @@ import (
 // Write sorts writes each metric in the given registry periodically to the
 // given io.Writer.
 func Write(r Registry, d time.Duration, w io.Writer) {
-	for _ = range time.Tick(d) {
-		WriteOnce(r, w)
-	}
+	WriteContext(context.Background(), r, d, w)
+}
+
+// WriteContext is Write until ctx is done, when it writes the metrics a final
+// time before returning.
+func WriteContext(ctx context.Context, r Registry, d time.Duration, w io.Writer) {
+	FlushSchedule{}.RunContext(ctx, d, Closed(r), func(time.Time) { WriteOnce(r, w) })
 }
 
 // WriteOnce sorts and writes metrics in the given registry to the given
 // io.Writer.
 func WriteOnce(r Registry, w io.Writer) {
+	writeText(r.EachSnapshot, RegistryPercentiles(r), w)
+}
+
+// writeText sorts and writes the metric snapshots passed by each to w, with
+// the percentiles ps of histograms and timers.
+func writeText(each func(func(string, interface{})), ps []float64, w io.Writer) {
 	var namedMetrics namedMetricSlice
-	r.Each(func(name string, i interface{}) {
+	each(func(name string, i interface{}) {
 		namedMetrics = append(namedMetrics, namedMetric{name, i})
 	})
 
@@ -29,30 +40,37 @@ func WriteOnce(r Registry, w io.Writer) {
 		case Counter:
 			fmt.Fprintf(w, "counter %s\n", namedMetric.name)
 			fmt.Fprintf(w, "  count:       %9d\n", metric.Count())
+		case CounterFloat64:
+			fmt.Fprintf(w, "counter %s\n", namedMetric.name)
+			fmt.Fprintf(w, "  count:       %f\n", metric.Count())
 		case Gauge:
 			fmt.Fprintf(w, "gauge %s\n", namedMetric.name)
 			fmt.Fprintf(w, "  value:       %9d\n", metric.Value())
 		case GaugeFloat64:
 			fmt.Fprintf(w, "gauge %s\n", namedMetric.name)
 			fmt.Fprintf(w, "  value:       %f\n", metric.Value())
+		case MergeableGaugeFloat64:
+			g := metric.Snapshot()
+			fmt.Fprintf(w, "gauge %s\n", namedMetric.name)
+			fmt.Fprintf(w, "  value:       %f\n", g.Value())
+			fmt.Fprintf(w, "  count:       %9d\n", g.Count())
 		case Healthcheck:
 			metric.Check()
 			fmt.Fprintf(w, "healthcheck %s\n", namedMetric.name)
 			fmt.Fprintf(w, "  error:       %v\n", metric.Error())
 		case Histogram:
 			h := metric.Snapshot()
-			ps := h.Percentiles([]float64{0.5, 0.75, 0.95, 0.99, 0.999})
+			ps := MetricPercentiles(ps, h)
+			scores := h.Percentiles(ps)
 			fmt.Fprintf(w, "histogram %s\n", namedMetric.name)
 			fmt.Fprintf(w, "  count:       %9d\n", h.Count())
 			fmt.Fprintf(w, "  min:         %9d\n", h.Min())
 			fmt.Fprintf(w, "  max:         %9d\n", h.Max())
 			fmt.Fprintf(w, "  mean:        %12.2f\n", h.Mean())
 			fmt.Fprintf(w, "  stddev:      %12.2f\n", h.StdDev())
-			fmt.Fprintf(w, "  median:      %12.2f\n", ps[0])
-			fmt.Fprintf(w, "  75%%:         %12.2f\n", ps[1])
-			fmt.Fprintf(w, "  95%%:         %12.2f\n", ps[2])
-			fmt.Fprintf(w, "  99%%:         %12.2f\n", ps[3])
-			fmt.Fprintf(w, "  99.9%%:       %12.2f\n", ps[4])
+			for i, p := range ps {
+				fmt.Fprintf(w, "  %-13s%12.2f\n", percentileLabel(p)+":", scores[i])
+			}
 		case Meter:
 			m := metric.Snapshot()
 			fmt.Fprintf(w, "meter %s\n", namedMetric.name)
@@ -63,18 +81,17 @@ func WriteOnce(r Registry, w io.Writer) {
 			fmt.Fprintf(w, "  mean rate:   %12.2f\n", m.RateMean())
 		case Timer:
 			t := metric.Snapshot()
-			ps := t.Percentiles([]float64{0.5, 0.75, 0.95, 0.99, 0.999})
+			ps := MetricPercentiles(ps, t)
+			scores := t.Percentiles(ps)
 			fmt.Fprintf(w, "timer %s\n", namedMetric.name)
 			fmt.Fprintf(w, "  count:       %9d\n", t.Count())
 			fmt.Fprintf(w, "  min:         %9d\n", t.Min())
 			fmt.Fprintf(w, "  max:         %9d\n", t.Max())
 			fmt.Fprintf(w, "  mean:        %12.2f\n", t.Mean())
 			fmt.Fprintf(w, "  stddev:      %12.2f\n", t.StdDev())
-			fmt.Fprintf(w, "  median:      %12.2f\n", ps[0])
-			fmt.Fprintf(w, "  75%%:         %12.2f\n", ps[1])
-			fmt.Fprintf(w, "  95%%:         %12.2f\n", ps[2])
-			fmt.Fprintf(w, "  99%%:         %12.2f\n", ps[3])
-			fmt.Fprintf(w, "  99.9%%:       %12.2f\n", ps[4])
+			for i, p := range ps {
+				fmt.Fprintf(w, "  %-13s%12.2f\n", percentileLabel(p)+":", scores[i])
+			}
 			fmt.Fprintf(w, "  1-min rate:  %12.2f\n", t.Rate1())
 			fmt.Fprintf(w, "  5-min rate:  %12.2f\n", t.Rate5())
 			fmt.Fprintf(w, "  15-min rate: %12.2f\n", t.Rate15())
@@ -1,8 +1,12 @@
 package metrics
 
 import (
+	"bytes"
+	"context"
 	"sort"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestMetricsSorting(t *testing.T) {
@@ -20,3 +24,33 @@ func TestMetricsSorting(t *testing.T) {
 		}
 	}
 }
+
+func TestWriteOncePercentiles(t *testing.T) {
+	r := NewRegistry()
+	h := NewRegisteredHistogram("foo", r, NewUniformSample(100))
+	for i := int64(1); i <= 100; i++ {
+		h.Update(i)
+	}
+	r.(*StandardRegistry).SetPercentiles([]float64{0.9, 0.9999})
+	var buf bytes.Buffer
+	WriteOnce(r, &buf)
+	s := buf.String()
+	if !strings.Contains(s, "  90%:                90.90\n  99.99%:            100.00\n") {
+		t.Error(s)
+	}
+	if strings.Contains(s, "median") {
+		t.Error(s)
+	}
+}
+
+func TestWriteContext(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredCounter("foo", r).Inc(1)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var buf bytes.Buffer
+	WriteContext(ctx, r, time.Hour, &buf)
+	if !strings.Contains(buf.String(), "counter foo") {
+		t.Errorf("WriteContext(): %q\n", buf.String())
+	}
+}